@@ -0,0 +1,252 @@
+// Package aferofs adapts file systems between wrfs and afero, so that the backends written for either are usable
+// through the other.
+//
+// FromAfero accesses an afero.Fs as a wrfs file system, and ToAfero accesses a wrfs file system as an afero.Fs.
+// The operations the two share are mapped onto each other: opening, creating and reading files and directories,
+// Mkdir, MkdirAll, Remove, RemoveAll, Rename, Chmod, Chown and Chtimes, and Lstat, Symlink and Readlink where the
+// file system supports them. Operations that the underlying file system does not support fail with an error
+// matching wrfs.ErrUnsupported.
+//
+// The package is a separate module, so that the wrfs module does not depend on afero.
+package aferofs
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/errno"
+	"github.com/spf13/afero"
+)
+
+// FromAfero returns a file system accessing afs. Names are passed to afs rooted at "/", with the separator of the
+// operating system, as the backends of afero such as afero.MemMapFs expect, so an afero.OsFs must be rooted with
+// afero.NewBasePathFs.
+//
+// The files opened through it are the afero.Files returned by afs, which support reading, writing, seeking,
+// ReadAt, WriteAt, Sync and Truncate, with a ReadDir method implemented by their Readdir method.
+func FromAfero(afs afero.Fs) wrfs.FS {
+	return &fromAfero{afs: afs}
+}
+
+type fromAfero struct {
+	afs afero.Fs
+}
+
+// path returns the name afs knows the file name by, or an error if name is not a valid path.
+func (f *fromAfero) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &wrfs.PathError{Op: op, Path: name, Err: wrfs.ErrInvalid}
+	}
+	return aferoName(name), nil
+}
+
+// aferoName returns the name afs knows the file with the valid path name by.
+func aferoName(name string) string {
+	return filepath.FromSlash(path.Join("/", name))
+}
+
+func (f *fromAfero) Open(name string) (wrfs.File, error) {
+	return f.OpenFile(name, wrfs.O_RDONLY, 0)
+}
+
+func (f *fromAfero) OpenFile(name string, flag int, perm wrfs.FileMode) (wrfs.File, error) {
+	p, err := f.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if flag&wrfs.O_CREATE != 0 {
+		if err := f.checkParent("open", name); err != nil {
+			return nil, err
+		}
+	}
+	file, err := f.afs.OpenFile(p, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &fromFile{File: file}, nil
+}
+
+func (f *fromAfero) Stat(name string) (wrfs.FileInfo, error) {
+	p, err := f.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return f.afs.Stat(p)
+}
+
+// Lstat uses the LstatIfPossible method of afs, falling back to Stat for file systems without symbolic links.
+func (f *fromAfero) Lstat(name string) (wrfs.FileInfo, error) {
+	p, err := f.path("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	if afs, ok := f.afs.(afero.Lstater); ok {
+		fi, _, err := afs.LstatIfPossible(p)
+		return fi, err
+	}
+	return f.afs.Stat(p)
+}
+
+func (f *fromAfero) ReadDir(name string) ([]wrfs.DirEntry, error) {
+	p, err := f.path("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := afero.ReadDir(f.afs, p)
+	return dirEntries(infos), err
+}
+
+func (f *fromAfero) Mkdir(name string, perm wrfs.FileMode) error {
+	p, err := f.path("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if err := f.checkParent("mkdir", name); err != nil {
+		return err
+	}
+	return f.afs.Mkdir(p, perm)
+}
+
+func (f *fromAfero) MkdirAll(name string, perm wrfs.FileMode) error {
+	p, err := f.path("mkdir", name)
+	if err != nil {
+		return err
+	}
+	// Like os.MkdirAll, fail if name or the nearest of its parents that exists is not a directory.
+	for dir := name; dir != "."; dir = path.Dir(dir) {
+		if fi, err := f.afs.Stat(aferoName(dir)); err == nil {
+			if !fi.IsDir() {
+				return &wrfs.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+			}
+			break
+		}
+	}
+	return f.afs.MkdirAll(p, perm)
+}
+
+// checkParent returns an error if the parent directory of name does not exist or is not a directory, which some
+// backends, such as afero.MemMapFs, do not check themselves.
+func (f *fromAfero) checkParent(op, name string) error {
+	dir := path.Dir(name)
+	if dir == "." {
+		return nil
+	}
+	fi, err := f.afs.Stat(aferoName(dir))
+	switch {
+	case errors.Is(err, wrfs.ErrNotExist):
+		return &wrfs.PathError{Op: op, Path: name, Err: wrfs.ErrNotExist}
+	case err != nil:
+		return err
+	case !fi.IsDir():
+		return &wrfs.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+	}
+	return nil
+}
+
+// Remove refuses to remove a non-empty directory itself, since some backends, such as afero.MemMapFs, do not.
+func (f *fromAfero) Remove(name string) error {
+	p, err := f.path("remove", name)
+	if err != nil {
+		return err
+	}
+	if empty, err := afero.IsEmpty(f.afs, p); err == nil && !empty {
+		if fi, err := f.afs.Stat(p); err == nil && fi.IsDir() {
+			return &wrfs.PathError{Op: "remove", Path: name, Err: errno.ENOTEMPTY}
+		}
+	}
+	return f.afs.Remove(p)
+}
+
+func (f *fromAfero) RemoveAll(name string) error {
+	p, err := f.path("removeall", name)
+	if err != nil {
+		return err
+	}
+	return f.afs.RemoveAll(p)
+}
+
+func (f *fromAfero) Rename(oldname, newname string) error {
+	if !fs.ValidPath(oldname) || !fs.ValidPath(newname) {
+		return &wrfs.LinkError{Op: "rename", Old: oldname, New: newname, Err: wrfs.ErrInvalid}
+	}
+	return f.afs.Rename(aferoName(oldname), aferoName(newname))
+}
+
+func (f *fromAfero) Chmod(name string, mode wrfs.FileMode) error {
+	p, err := f.path("chmod", name)
+	if err != nil {
+		return err
+	}
+	return f.afs.Chmod(p, mode)
+}
+
+func (f *fromAfero) Chown(name string, uid, gid int) error {
+	p, err := f.path("chown", name)
+	if err != nil {
+		return err
+	}
+	return f.afs.Chown(p, uid, gid)
+}
+
+func (f *fromAfero) Chtimes(name string, atime, mtime time.Time) error {
+	p, err := f.path("chtimes", name)
+	if err != nil {
+		return err
+	}
+	return f.afs.Chtimes(p, atime, mtime)
+}
+
+func (f *fromAfero) Symlink(oldname, newname string) error {
+	if !fs.ValidPath(newname) {
+		return &wrfs.LinkError{Op: "symlink", Old: oldname, New: newname, Err: wrfs.ErrInvalid}
+	}
+	afs, ok := f.afs.(afero.Linker)
+	if !ok {
+		return &wrfs.LinkError{Op: "symlink", Old: oldname, New: newname, Err: wrfs.ErrUnsupported}
+	}
+	err := afs.SymlinkIfPossible(filepath.FromSlash(oldname), aferoName(newname))
+	if errors.Is(err, afero.ErrNoSymlink) {
+		return &wrfs.LinkError{Op: "symlink", Old: oldname, New: newname, Err: wrfs.ErrUnsupported}
+	}
+	return err
+}
+
+func (f *fromAfero) Readlink(name string) (string, error) {
+	p, err := f.path("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	afs, ok := f.afs.(afero.LinkReader)
+	if !ok {
+		return "", &wrfs.PathError{Op: "readlink", Path: name, Err: wrfs.ErrUnsupported}
+	}
+	target, err := afs.ReadlinkIfPossible(p)
+	if errors.Is(err, afero.ErrNoReadlink) {
+		return "", &wrfs.PathError{Op: "readlink", Path: name, Err: wrfs.ErrUnsupported}
+	}
+	return filepath.ToSlash(target), err
+}
+
+// fromFile is an afero.File with the ReadDir method of wrfs.ReadDirFile.
+type fromFile struct {
+	afero.File
+}
+
+func (f *fromFile) ReadDir(n int) ([]wrfs.DirEntry, error) {
+	infos, err := f.Readdir(n)
+	return dirEntries(infos), err
+}
+
+// dirEntries returns the directory entries describing infos.
+func dirEntries(infos []fs.FileInfo) []wrfs.DirEntry {
+	entries := make([]wrfs.DirEntry, len(infos))
+	for i, fi := range infos {
+		entries[i] = fs.FileInfoToDirEntry(fi)
+	}
+	return entries
+}
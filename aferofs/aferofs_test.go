@@ -0,0 +1,76 @@
+package aferofs_test
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/aferofs"
+	"github.com/relab/wrfs/memfs"
+	"github.com/relab/wrfs/wrfstest"
+	"github.com/spf13/afero"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFromAfero(t *testing.T) {
+	fsys := aferofs.FromAfero(afero.NewMemMapFs())
+	if err := wrfstest.TestWriteFS(fsys, wrfstest.SkipChown(), wrfstest.SkipLinks()); err != nil {
+		t.Fatal(err)
+	}
+	if err := wrfs.Symlink(fsys, "target", "link"); !errors.Is(err, wrfs.ErrUnsupported) {
+		t.Errorf("Symlink on a MemMapFs: got %v, want ErrUnsupported", err)
+	}
+	if _, err := wrfs.Stat(fsys, "/abs"); !errors.Is(err, wrfs.ErrInvalid) {
+		t.Errorf("Stat of an absolute name: got %v, want ErrInvalid", err)
+	}
+}
+
+func TestToAfero(t *testing.T) {
+	fsys := memfs.New()
+	afs := aferofs.ToAfero(fsys)
+	check(t, afs.MkdirAll("/dir/sub", 0755))
+	check(t, afero.WriteFile(afs, "/dir/file", []byte("hello"), 0644))
+	f, err := afs.OpenFile("dir/file", wrfs.O_RDWR, 0)
+	check(t, err)
+	_, err = f.WriteAt([]byte("J"), 0)
+	check(t, err)
+	check(t, f.Truncate(4))
+	check(t, f.Close())
+	data, err := wrfs.ReadFile(fsys, "dir/file")
+	check(t, err)
+	if string(data) != "Jell" {
+		t.Errorf("dir/file contains %q", data)
+	}
+
+	dir, err := afs.Open("/dir")
+	check(t, err)
+	names, err := dir.Readdirnames(-1)
+	check(t, err)
+	check(t, dir.Close())
+	sort.Strings(names)
+	if got := strings.Join(names, " "); got != "file sub" {
+		t.Errorf("Readdirnames returned %q", got)
+	}
+
+	check(t, afs.Rename("/dir/file", "/moved"))
+	if exists, err := afero.Exists(afs, "moved"); err != nil || !exists {
+		t.Errorf("Rename did not create moved: %v", err)
+	}
+	check(t, afs.RemoveAll("dir"))
+	if _, err := wrfs.Stat(fsys, "dir"); !errors.Is(err, wrfs.ErrNotExist) {
+		t.Errorf("RemoveAll did not remove dir: %v", err)
+	}
+
+	// Round trip through both adapters.
+	if err := wrfstest.TestWriteFS(aferofs.FromAfero(aferofs.ToAfero(memfs.New()))); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/relab/wrfs/aferofs
+
+go 1.21
+
+require (
+	github.com/relab/wrfs v0.0.0
+	github.com/spf13/afero v1.11.0
+)
+
+require golang.org/x/text v0.14.0 // indirect
+
+replace github.com/relab/wrfs => ../
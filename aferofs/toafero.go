@@ -0,0 +1,209 @@
+package aferofs
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/spf13/afero"
+)
+
+// ToAfero returns an afero.Fs accessing fsys. Names may use the separator of the operating system and be absolute,
+// and are made relative to the root of fsys, so that "/dir/file" and "dir/file" name the same file.
+//
+// The files it opens support the methods of afero.File that the files of fsys support, and fail with an error
+// matching wrfs.ErrUnsupported otherwise: ReadAt, WriteAt and Truncate require the corresponding methods, and
+// Readdir requires a wrfs.ReadDirFile.
+func ToAfero(fsys wrfs.FS) afero.Fs {
+	return &toAfero{fsys: fsys}
+}
+
+type toAfero struct {
+	fsys wrfs.FS
+}
+
+// name returns the name of the file the afero name refers to in fsys.
+func name(aferoName string) string {
+	name := strings.TrimPrefix(path.Clean(filepath.ToSlash(aferoName)), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (t *toAfero) Name() string {
+	return "wrfs"
+}
+
+func (t *toAfero) Create(aferoName string) (afero.File, error) {
+	return t.OpenFile(aferoName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (t *toAfero) Open(aferoName string) (afero.File, error) {
+	return t.OpenFile(aferoName, os.O_RDONLY, 0)
+}
+
+func (t *toAfero) OpenFile(aferoName string, flag int, perm os.FileMode) (afero.File, error) {
+	file, err := wrfs.OpenFile(t.fsys, name(aferoName), flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &toFile{file: file, name: aferoName}, nil
+}
+
+func (t *toAfero) Stat(aferoName string) (os.FileInfo, error) {
+	return wrfs.Stat(t.fsys, name(aferoName))
+}
+
+func (t *toAfero) Mkdir(aferoName string, perm os.FileMode) error {
+	return wrfs.Mkdir(t.fsys, name(aferoName), perm)
+}
+
+func (t *toAfero) MkdirAll(aferoName string, perm os.FileMode) error {
+	return wrfs.MkdirAll(t.fsys, name(aferoName), perm)
+}
+
+func (t *toAfero) Remove(aferoName string) error {
+	return wrfs.Remove(t.fsys, name(aferoName))
+}
+
+func (t *toAfero) RemoveAll(aferoName string) error {
+	return wrfs.RemoveAll(t.fsys, name(aferoName))
+}
+
+func (t *toAfero) Rename(oldname, newname string) error {
+	return wrfs.Rename(t.fsys, name(oldname), name(newname))
+}
+
+func (t *toAfero) Chmod(aferoName string, mode os.FileMode) error {
+	return wrfs.Chmod(t.fsys, name(aferoName), mode)
+}
+
+func (t *toAfero) Chown(aferoName string, uid, gid int) error {
+	return wrfs.Chown(t.fsys, name(aferoName), uid, gid)
+}
+
+func (t *toAfero) Chtimes(aferoName string, atime, mtime time.Time) error {
+	return wrfs.Chtimes(t.fsys, name(aferoName), atime, mtime)
+}
+
+// LstatIfPossible implements afero.Lstater, reporting whether fsys supports Lstat.
+func (t *toAfero) LstatIfPossible(aferoName string) (os.FileInfo, bool, error) {
+	fi, err := wrfs.Lstat(t.fsys, name(aferoName))
+	if wrfs.IsNotSupported(err) {
+		fi, err = wrfs.Stat(t.fsys, name(aferoName))
+		return fi, false, err
+	}
+	return fi, true, err
+}
+
+// SymlinkIfPossible implements afero.Linker. The target of the link is stored as given, with slashes.
+func (t *toAfero) SymlinkIfPossible(oldname, newname string) error {
+	return wrfs.Symlink(t.fsys, filepath.ToSlash(oldname), name(newname))
+}
+
+// ReadlinkIfPossible implements afero.LinkReader.
+func (t *toAfero) ReadlinkIfPossible(aferoName string) (string, error) {
+	target, err := wrfs.Readlink(t.fsys, name(aferoName))
+	return filepath.FromSlash(target), err
+}
+
+// toFile is a wrfs.File implementing afero.File.
+type toFile struct {
+	file wrfs.File
+	name string // the name the file was opened by
+}
+
+func (f *toFile) err(op string) error {
+	return &wrfs.PathError{Op: op, Path: f.name, Err: wrfs.ErrUnsupported}
+}
+
+func (f *toFile) Name() string {
+	return f.name
+}
+
+func (f *toFile) Close() error {
+	return f.file.Close()
+}
+
+func (f *toFile) Read(p []byte) (int, error) {
+	return f.file.Read(p)
+}
+
+func (f *toFile) ReadAt(p []byte, off int64) (int, error) {
+	if file, ok := f.file.(io.ReaderAt); ok {
+		return file.ReadAt(p, off)
+	}
+	return 0, f.err("read")
+}
+
+func (f *toFile) Seek(offset int64, whence int) (int64, error) {
+	return wrfs.Seek(f.file, offset, whence)
+}
+
+func (f *toFile) Write(p []byte) (int, error) {
+	return wrfs.Write(f.file, p)
+}
+
+func (f *toFile) WriteAt(p []byte, off int64) (int, error) {
+	if file, ok := f.file.(io.WriterAt); ok {
+		return file.WriteAt(p, off)
+	}
+	return 0, f.err("write")
+}
+
+func (f *toFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *toFile) Readdir(count int) ([]os.FileInfo, error) {
+	dir, ok := f.file.(wrfs.ReadDirFile)
+	if !ok {
+		return nil, f.err("readdir")
+	}
+	entries, err := dir.ReadDir(count)
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		fi, infoErr := e.Info()
+		if infoErr != nil {
+			return infos, infoErr
+		}
+		infos = append(infos, fi)
+	}
+	return infos, err
+}
+
+func (f *toFile) Readdirnames(n int) ([]string, error) {
+	dir, ok := f.file.(wrfs.ReadDirFile)
+	if !ok {
+		return nil, f.err("readdir")
+	}
+	entries, err := dir.ReadDir(n)
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return names, err
+}
+
+func (f *toFile) Stat() (os.FileInfo, error) {
+	return f.file.Stat()
+}
+
+func (f *toFile) Sync() error {
+	if file, ok := f.file.(wrfs.SyncFile); ok {
+		return file.Sync()
+	}
+	return f.err("sync")
+}
+
+func (f *toFile) Truncate(size int64) error {
+	if file, ok := f.file.(wrfs.TruncateFile); ok {
+		return file.Truncate(size)
+	}
+	return f.err("truncate")
+}
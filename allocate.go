@@ -0,0 +1,43 @@
+package wrfs
+
+// AllocMode selects what Allocate does with a range of a file.
+type AllocMode uint32
+
+// The modes of Allocate. They have the values of the corresponding flags of fallocate(2) on Linux.
+const (
+	// AllocKeepSize allocates space without changing the size of the file, even if the range extends beyond it.
+	AllocKeepSize AllocMode = 0x1
+	// AllocPunchHole deallocates the space of the range, which then reads as zeros. It must be combined with
+	// AllocKeepSize.
+	AllocPunchHole AllocMode = 0x2
+)
+
+// AllocateFile is a file with an Allocate method.
+type AllocateFile interface {
+	File
+
+	// Allocate allocates or deallocates the space of length bytes of the file starting at off, according to
+	// mode. With mode 0, it allocates the space and extends the file if the range extends beyond its end.
+	Allocate(off, length int64, mode AllocMode) error
+}
+
+// Allocate allocates or deallocates the space of length bytes of file starting at off, according to mode, such
+// that later writes to the range do not fail for lack of space, or such that the space of data no longer needed
+// is released. With mode 0, Allocate allocates the space and extends the file if the range extends beyond its
+// end, like posix_fallocate(3). The file must be open for writing.
+//
+// If file implements AllocateFile, Allocate calls its Allocate method. Otherwise, files of the host file system
+// are allocated with fallocate(2) on Linux, and Allocate fails with ErrUnsupported for other files.
+func Allocate(file File, off, length int64, mode AllocMode) error {
+	if off < 0 || length <= 0 || mode&^(AllocKeepSize|AllocPunchHole) != 0 ||
+		mode&AllocPunchHole != 0 && mode&AllocKeepSize == 0 {
+		return fileErr("allocate", file, ErrInvalid)
+	}
+	if file, ok := file.(AllocateFile); ok {
+		return file.Allocate(off, length, mode)
+	}
+	if f, ok := OSFile(file); ok {
+		return allocate(f, off, length, mode)
+	}
+	return fileErr("allocate", file, ErrUnsupported)
+}
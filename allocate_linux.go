@@ -0,0 +1,28 @@
+package wrfs
+
+import (
+	"os"
+	"syscall"
+)
+
+func allocate(file *os.File, off, length int64, mode AllocMode) (err error) {
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return err
+	}
+	cerr := conn.Control(func(fd uintptr) {
+		for {
+			err = syscall.Fallocate(int(fd), uint32(mode), off, length)
+			if err != syscall.EINTR {
+				return
+			}
+		}
+	})
+	if cerr != nil {
+		return cerr
+	}
+	if err != nil {
+		return &PathError{Op: "allocate", Path: file.Name(), Err: err}
+	}
+	return nil
+}
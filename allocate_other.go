@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package wrfs
+
+import "os"
+
+func allocate(file *os.File, off, length int64, mode AllocMode) error {
+	return &PathError{Op: "allocate", Path: file.Name(), Err: ErrUnsupported}
+}
@@ -0,0 +1,40 @@
+package wrfs_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+)
+
+func TestAllocate(t *testing.T) {
+	testCase := func(fsys FS) {
+		check(t, WriteFile(fsys, "file", []byte("0123456789"), 0644))
+		file, err := OpenFile(fsys, "file", O_RDWR, 0)
+		check(t, err)
+		err = Allocate(file, 0, 20, 0)
+		if errors.Is(err, ErrUnsupported) {
+			file.Close()
+			return
+		}
+		check(t, err)
+		check(t, Allocate(file, 0, 100, AllocKeepSize))
+		want := "01\x00\x00\x0056789" + strings.Repeat("\x00", 10)
+		err = Allocate(file, 2, 3, AllocPunchHole|AllocKeepSize)
+		if errors.Is(err, ErrUnsupported) {
+			want = "0123456789" + strings.Repeat("\x00", 10)
+		} else if err != nil {
+			t.Errorf("punching a hole: %v", err)
+		}
+		if err := Allocate(file, 0, 1, AllocPunchHole); !errors.Is(err, ErrInvalid) {
+			t.Errorf("AllocPunchHole without AllocKeepSize: got %v, want ErrInvalid", err)
+		}
+		check(t, file.Close())
+		checkContents(t, fsys, "file", want)
+	}
+
+	t.Run("memfs", func(t *testing.T) { testCase(memfs.New()) })
+	t.Run("DirFS", func(t *testing.T) { testCase(DirFS(t.TempDir())) })
+}
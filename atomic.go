@@ -0,0 +1,59 @@
+package wrfs
+
+import (
+	"io"
+	"path"
+)
+
+// WriteFileAtomic writes data to the named file, such that readers see either the old contents
+// or the new contents, but never a partially written file.
+//
+// WriteFileAtomic writes data to a uniquely named temporary file in the same directory as name,
+// syncs it to stable storage if the file supports it, and renames it over name, syncing the directory
+// afterwards if the file system supports it, so that the rename survives a crash. The resulting file
+// has permissions perm (before umask), even if name already existed. If fsys does not support
+// Rename, WriteFileAtomic removes the temporary file and returns an error matching ErrUnsupported,
+// leaving the named file untouched.
+func WriteFileAtomic(fsys FS, name string, data []byte, perm FileMode) (err error) {
+	if _, ok := fsys.(RenameFS); !ok {
+		// Don't leave a temporary file behind that we cannot rename.
+		return &PathError{Op: "writeatomic", Path: name, Err: ErrUnsupported}
+	}
+	file, tmpName, err := createTemp(fsys, path.Dir(name), "."+path.Base(name)+".tmp*", perm)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			Remove(fsys, tmpName)
+		}
+	}()
+
+	n, err := Write(file, data)
+	if IsNotSupported(err) {
+		err = &PathError{Op: "write", Path: tmpName, Err: ErrUnsupported}
+	} else if err == nil && n < len(data) {
+		err = io.ErrShortWrite
+	}
+	if err == nil {
+		err = syncFile(file)
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := Rename(fsys, tmpName, name); err != nil {
+		return err
+	}
+	return syncDir(fsys, path.Dir(name))
+}
+
+// syncFile commits the contents of file to stable storage, if the file supports it.
+func syncFile(file File) error {
+	if file, ok := file.(SyncFile); ok {
+		return file.Sync()
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wrfs_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	fsys := getFS(t)
+	fileName := "TestWriteFileAtomic"
+	writeFile(t, fsys, fileName, []byte("old contents"))
+
+	check(t, WriteFileAtomic(fsys, fileName, []byte("new"), 0600))
+	got, err := ReadFile(fsys, fileName)
+	check(t, err)
+	if string(got) != "new" {
+		t.Errorf("got: %q, want: %q", got, "new")
+	}
+	checkMode(t, fsys, fileName, 0600)
+
+	entries, err := ReadDir(fsys, ".")
+	check(t, err)
+	if len(entries) != 1 {
+		t.Errorf("temporary file was left behind: %v", entries)
+	}
+
+	err = WriteFileAtomic(openFileOnly{fsys.(OpenFileFS)}, fileName, []byte("x"), 0600)
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("got error %v, want %v", err, ErrUnsupported)
+	}
+}
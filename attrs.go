@@ -0,0 +1,111 @@
+package wrfs
+
+import (
+	"strconv"
+	"strings"
+)
+
+// FileAttributes are attributes of files on Windows, with the values of the FILE_ATTRIBUTE_ constants
+// of the Windows API.
+type FileAttributes uint32
+
+const (
+	AttrReadOnly FileAttributes = 0x1  // the file cannot be written or removed
+	AttrHidden   FileAttributes = 0x2  // the file is not listed by default
+	AttrSystem   FileAttributes = 0x4  // the file is used by the operating system
+	AttrArchive  FileAttributes = 0x20 // the file has changed since it was last backed up
+)
+
+// attrNames are the names of the attributes, in the order of their bits.
+var attrNames = []struct {
+	attr FileAttributes
+	name string
+}{
+	{AttrReadOnly, "readonly"},
+	{AttrHidden, "hidden"},
+	{AttrSystem, "system"},
+	{AttrArchive, "archive"},
+}
+
+func (a FileAttributes) String() string {
+	var names []string
+	for _, n := range attrNames {
+		if a&n.attr != 0 {
+			names = append(names, n.name)
+			a &^= n.attr
+		}
+	}
+	if a != 0 {
+		names = append(names, "0x"+strconv.FormatUint(uint64(a), 16))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// AttributesFS is a file system with Windows file attributes.
+type AttributesFS interface {
+	FS
+
+	// Attributes returns the attributes of the named file, including those other than the Attr
+	// constants, such as FILE_ATTRIBUTE_DIRECTORY.
+	Attributes(name string) (FileAttributes, error)
+
+	// SetAttributes sets the read-only, hidden, system and archive attributes of the named file
+	// to those in attrs.
+	SetAttributes(name string, attrs FileAttributes) error
+}
+
+// Attributes returns the Windows attributes of the named file.
+func Attributes(fsys FS, name string) (FileAttributes, error) {
+	if fsys, ok := fsys.(AttributesFS); ok {
+		return fsys.Attributes(name)
+	}
+	return 0, &PathError{Op: "attributes", Path: name, Err: ErrUnsupported}
+}
+
+// SetAttributes sets the read-only, hidden, system and archive attributes of the named file to those
+// in attrs, leaving its other attributes unchanged.
+func SetAttributes(fsys FS, name string, attrs FileAttributes) error {
+	if fsys, ok := fsys.(AttributesFS); ok {
+		return fsys.SetAttributes(name, attrs)
+	}
+	return &PathError{Op: "setattributes", Path: name, Err: ErrUnsupported}
+}
+
+// SecurityFS is a file system with Windows security descriptors. Security descriptors are exchanged
+// as strings in the Security Descriptor Definition Language (SDDL), such as
+// "O:BAG:SYD:P(A;;FA;;;SY)(A;;FA;;;BA)", in which owners, groups and trustees are security
+// identifiers (SIDs) or their SDDL abbreviations.
+type SecurityFS interface {
+	FS
+
+	// SecurityDescriptor returns the owner (O:), primary group (G:) and discretionary access
+	// control list (D:) of the named file.
+	SecurityDescriptor(name string) (string, error)
+
+	// SetSecurityDescriptor sets the owner, primary group and discretionary access control list
+	// of the named file to those present in sddl, leaving the absent ones unchanged.
+	SetSecurityDescriptor(name, sddl string) error
+}
+
+// SecurityDescriptor returns the owner, primary group and discretionary access control list (DACL)
+// of the named file, as a security descriptor in SDDL. The system access control list is left out,
+// since reading it requires privileges.
+func SecurityDescriptor(fsys FS, name string) (string, error) {
+	if fsys, ok := fsys.(SecurityFS); ok {
+		return fsys.SecurityDescriptor(name)
+	}
+	return "", &PathError{Op: "getsecurity", Path: name, Err: ErrUnsupported}
+}
+
+// SetSecurityDescriptor sets the owner, primary group and DACL of the named file to those present in
+// the security descriptor sddl. A DACL marked as protected (D:P) stops the file from inheriting
+// access control entries from its parent. Changing the owner usually requires privileges.
+func SetSecurityDescriptor(fsys FS, name, sddl string) error {
+	if fsys, ok := fsys.(SecurityFS); ok {
+		return fsys.SetSecurityDescriptor(name, sddl)
+	}
+	return &PathError{Op: "setsecurity", Path: name, Err: ErrUnsupported}
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package wrfs
+
+func (hostFS) Attributes(name string) (FileAttributes, error) {
+	return 0, &PathError{Op: "attributes", Path: name, Err: ErrUnsupported}
+}
+
+func (hostFS) SetAttributes(name string, attrs FileAttributes) error {
+	return &PathError{Op: "setattributes", Path: name, Err: ErrUnsupported}
+}
+
+func (hostFS) SecurityDescriptor(name string) (string, error) {
+	return "", &PathError{Op: "getsecurity", Path: name, Err: ErrUnsupported}
+}
+
+func (hostFS) SetSecurityDescriptor(name, sddl string) error {
+	return &PathError{Op: "setsecurity", Path: name, Err: ErrUnsupported}
+}
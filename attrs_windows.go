@@ -0,0 +1,143 @@
+package wrfs
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modadvapi32                                              = syscall.NewLazyDLL("advapi32.dll")
+	procGetNamedSecurityInfoW                                = modadvapi32.NewProc("GetNamedSecurityInfoW")
+	procSetNamedSecurityInfoW                                = modadvapi32.NewProc("SetNamedSecurityInfoW")
+	procConvertSecurityDescriptorToStringSecurityDescriptorW = modadvapi32.NewProc("ConvertSecurityDescriptorToStringSecurityDescriptorW")
+	procConvertStringSecurityDescriptorToSecurityDescriptorW = modadvapi32.NewProc("ConvertStringSecurityDescriptorToSecurityDescriptorW")
+	procGetSecurityDescriptorOwner                           = modadvapi32.NewProc("GetSecurityDescriptorOwner")
+	procGetSecurityDescriptorGroup                           = modadvapi32.NewProc("GetSecurityDescriptorGroup")
+	procGetSecurityDescriptorDacl                            = modadvapi32.NewProc("GetSecurityDescriptorDacl")
+	procGetSecurityDescriptorControl                         = modadvapi32.NewProc("GetSecurityDescriptorControl")
+)
+
+const (
+	// settableAttrs are the attributes set by SetAttributes.
+	settableAttrs = AttrReadOnly | AttrHidden | AttrSystem | AttrArchive
+	// keptAttrs are the other attributes that SetFileAttributes accepts, which SetAttributes preserves.
+	keptAttrs FileAttributes = 0x100 | 0x1000 | 0x2000 // temporary, offline and not content indexed
+
+	seFileObject                       = 1
+	ownerSecurityInformation           = 0x1
+	groupSecurityInformation           = 0x2
+	daclSecurityInformation            = 0x4
+	protectedDaclSecurityInformation   = 0x80000000
+	unprotectedDaclSecurityInformation = 0x20000000
+	sddlRevision1                      = 1
+	seDaclProtected                    = 0x1000
+)
+
+func (hostFS) Attributes(name string) (FileAttributes, error) {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return 0, &PathError{Op: "attributes", Path: name, Err: err}
+	}
+	attrs, err := syscall.GetFileAttributes(p)
+	if err != nil {
+		return 0, &PathError{Op: "attributes", Path: name, Err: err}
+	}
+	return FileAttributes(attrs), nil
+}
+
+func (hostFS) SetAttributes(name string, attrs FileAttributes) error {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return &PathError{Op: "setattributes", Path: name, Err: err}
+	}
+	old, err := syscall.GetFileAttributes(p)
+	if err != nil {
+		return &PathError{Op: "setattributes", Path: name, Err: err}
+	}
+	// FILE_ATTRIBUTE_NORMAL is only valid alone, for files without any other attribute.
+	attrs = FileAttributes(old)&keptAttrs | attrs&settableAttrs
+	if attrs == 0 {
+		attrs = syscall.FILE_ATTRIBUTE_NORMAL
+	}
+	if err := syscall.SetFileAttributes(p, uint32(attrs)); err != nil {
+		return &PathError{Op: "setattributes", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (hostFS) SecurityDescriptor(name string) (string, error) {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return "", &PathError{Op: "getsecurity", Path: name, Err: err}
+	}
+	const info = ownerSecurityInformation | groupSecurityInformation | daclSecurityInformation
+	var sd uintptr
+	// GetNamedSecurityInfoW returns an error code rather than setting the last error.
+	r, _, _ := procGetNamedSecurityInfoW.Call(uintptr(unsafe.Pointer(p)), seFileObject, info, 0, 0, 0, 0,
+		uintptr(unsafe.Pointer(&sd)))
+	if r != 0 {
+		return "", &PathError{Op: "getsecurity", Path: name, Err: syscall.Errno(r)}
+	}
+	defer syscall.LocalFree(syscall.Handle(sd))
+	var s *uint16
+	var n uint32
+	r, _, err = procConvertSecurityDescriptorToStringSecurityDescriptorW.Call(sd, sddlRevision1, info,
+		uintptr(unsafe.Pointer(&s)), uintptr(unsafe.Pointer(&n)))
+	if r == 0 {
+		return "", &PathError{Op: "getsecurity", Path: name, Err: err}
+	}
+	defer syscall.LocalFree(syscall.Handle(unsafe.Pointer(s)))
+	return syscall.UTF16ToString(unsafe.Slice(s, n)), nil
+}
+
+func (hostFS) SetSecurityDescriptor(name, sddl string) error {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return &PathError{Op: "setsecurity", Path: name, Err: err}
+	}
+	s, err := syscall.UTF16PtrFromString(sddl)
+	if err != nil {
+		return &PathError{Op: "setsecurity", Path: name, Err: ErrInvalid}
+	}
+	var sd uintptr
+	r, _, err := procConvertStringSecurityDescriptorToSecurityDescriptorW.Call(uintptr(unsafe.Pointer(s)),
+		sddlRevision1, uintptr(unsafe.Pointer(&sd)), 0)
+	if r == 0 {
+		return &PathError{Op: "setsecurity", Path: name, Err: err}
+	}
+	defer syscall.LocalFree(syscall.Handle(sd))
+
+	// Only the parts present in the descriptor are set.
+	var owner, group, dacl uintptr
+	var present, defaulted uint32
+	var control uint16
+	var revision uint32
+	procGetSecurityDescriptorOwner.Call(sd, uintptr(unsafe.Pointer(&owner)), uintptr(unsafe.Pointer(&defaulted)))
+	procGetSecurityDescriptorGroup.Call(sd, uintptr(unsafe.Pointer(&group)), uintptr(unsafe.Pointer(&defaulted)))
+	procGetSecurityDescriptorDacl.Call(sd, uintptr(unsafe.Pointer(&present)), uintptr(unsafe.Pointer(&dacl)),
+		uintptr(unsafe.Pointer(&defaulted)))
+	procGetSecurityDescriptorControl.Call(sd, uintptr(unsafe.Pointer(&control)), uintptr(unsafe.Pointer(&revision)))
+	var info uintptr
+	if owner != 0 {
+		info |= ownerSecurityInformation
+	}
+	if group != 0 {
+		info |= groupSecurityInformation
+	}
+	if present != 0 {
+		info |= daclSecurityInformation
+		if control&seDaclProtected != 0 {
+			info |= protectedDaclSecurityInformation
+		} else {
+			info |= unprotectedDaclSecurityInformation
+		}
+	}
+	if info == 0 {
+		return &PathError{Op: "setsecurity", Path: name, Err: ErrInvalid}
+	}
+	r, _, _ = procSetNamedSecurityInfoW.Call(uintptr(unsafe.Pointer(p)), seFileObject, info, owner, group, dacl, 0)
+	if r != 0 {
+		return &PathError{Op: "setsecurity", Path: name, Err: syscall.Errno(r)}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package wrfs_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestAttributes(t *testing.T) {
+	fsys := DirFS(t.TempDir())
+	check(t, WriteFile(fsys, "file", []byte("data"), 0644))
+	attrs, err := Attributes(fsys, "file")
+	check(t, err)
+	check(t, SetAttributes(fsys, "file", attrs|AttrHidden|AttrReadOnly))
+	if attrs, err := Attributes(fsys, "file"); err != nil || attrs&(AttrHidden|AttrReadOnly) != AttrHidden|AttrReadOnly {
+		t.Errorf("Attributes after SetAttributes: got %v, %v, want hidden and readonly", attrs, err)
+	}
+	check(t, SetAttributes(fsys, "file", 0))
+	if attrs, err := Attributes(fsys, "file"); err != nil || attrs&(AttrHidden|AttrReadOnly) != 0 {
+		t.Errorf("Attributes after clearing them: got %v, %v", attrs, err)
+	}
+
+	sddl, err := SecurityDescriptor(fsys, "file")
+	check(t, err)
+	i := strings.Index(sddl, "D:")
+	if !strings.HasPrefix(sddl, "O:") || i < 0 {
+		t.Fatalf("SecurityDescriptor = %q, want an owner and a DACL", sddl)
+	}
+	check(t, SetSecurityDescriptor(fsys, "file", sddl[i:]))
+	if got, err := SecurityDescriptor(fsys, "file"); err != nil || !strings.Contains(got, "D:") {
+		t.Errorf("SecurityDescriptor after setting the DACL: got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,162 @@
+package wrfs
+
+import "time"
+
+// An AuditEvent describes a mutating operation passed to the hooks of Audit.
+type AuditEvent struct {
+	// Op is the name of the operation, as reported by WithStats: "openfile", "mkdir", "mkdirall", "remove",
+	// "removeall", "rename", "symlink", "link", "chmod", "chown", "lchown", "chtimes", "truncate" or "openlock".
+	Op string
+
+	Path    string   // the file operated on; the old name for rename and link, and the link for symlink
+	NewPath string   // the new name for rename and link
+	Target  string   // the target for symlink
+	Flag    int      // the flags for openfile
+	Mode    FileMode // the permission bits for openfile, mkdir and mkdirall, and the mode for chmod
+	UID     int      // the user ID for chown and lchown
+	GID     int      // the group ID for chown and lchown
+	Size    int64    // the size for truncate
+}
+
+// err returns err wrapped in a *PathError or, for operations with two paths, a *LinkError.
+func (e AuditEvent) err(err error) error {
+	switch e.Op {
+	case "rename", "link":
+		return &LinkError{Op: e.Op, Old: e.Path, New: e.NewPath, Err: err}
+	case "symlink":
+		return &LinkError{Op: e.Op, Old: e.Target, New: e.Path, Err: err}
+	}
+	return &PathError{Op: e.Op, Path: e.Path, Err: err}
+}
+
+// Hooks holds the callbacks invoked by Audit. Either may be nil.
+type Hooks struct {
+	// Before is called before each mutating operation. If it returns an error, the operation is not
+	// performed, and fails with a *PathError or *LinkError wrapping that error.
+	Before func(e AuditEvent) error
+
+	// After is called after each mutating operation that was not vetoed by Before, with the error
+	// returned by the operation.
+	After func(e AuditEvent, err error)
+}
+
+// Audit returns a file system that calls hooks before and after every operation that modifies fsys,
+// enabling audit logging and policy enforcement. Opening a file with OpenFile counts as a mutating operation
+// if the flags include O_WRONLY, O_RDWR, O_APPEND, O_CREATE or O_TRUNC; the writes to the file are covered
+// by that event and are not reported individually. Operations that only read fsys are passed through, and
+// changes made through the methods of open files, such as Chmod on a file returned by Open, are not audited.
+//
+// Hooks may be called concurrently if the file system is used by multiple goroutines.
+func Audit(fsys FS, hooks Hooks) FS {
+	return &auditFS{fsWrapper{fsys}, hooks}
+}
+
+type auditFS struct {
+	fsWrapper
+	hooks Hooks
+}
+
+// audit runs op if Before allows e, and reports its result to After.
+func (a *auditFS) audit(e AuditEvent, op func() error) error {
+	if a.hooks.Before != nil {
+		if err := a.hooks.Before(e); err != nil {
+			return e.err(err)
+		}
+	}
+	err := op()
+	if a.hooks.After != nil {
+		a.hooks.After(e, err)
+	}
+	return err
+}
+
+func (a *auditFS) OpenFile(name string, flag int, perm FileMode) (file File, err error) {
+	if flag&(O_WRONLY|O_RDWR|O_APPEND|O_CREATE|O_TRUNC) == 0 {
+		return OpenFile(a.fsys, name, flag, perm)
+	}
+	err = a.audit(AuditEvent{Op: "openfile", Path: name, Flag: flag, Mode: perm}, func() (err error) {
+		file, err = OpenFile(a.fsys, name, flag, perm)
+		return err
+	})
+	return file, err
+}
+
+func (a *auditFS) OpenLock(name string) (file LockFile, err error) {
+	err = a.audit(AuditEvent{Op: "openlock", Path: name}, func() (err error) {
+		file, err = OpenLock(a.fsys, name)
+		return err
+	})
+	return file, err
+}
+
+func (a *auditFS) Chmod(name string, mode FileMode) error {
+	return a.audit(AuditEvent{Op: "chmod", Path: name, Mode: mode}, func() error {
+		return Chmod(a.fsys, name, mode)
+	})
+}
+
+func (a *auditFS) Chown(name string, uid, gid int) error {
+	return a.audit(AuditEvent{Op: "chown", Path: name, UID: uid, GID: gid}, func() error {
+		return Chown(a.fsys, name, uid, gid)
+	})
+}
+
+func (a *auditFS) Lchown(name string, uid, gid int) error {
+	return a.audit(AuditEvent{Op: "lchown", Path: name, UID: uid, GID: gid}, func() error {
+		return Lchown(a.fsys, name, uid, gid)
+	})
+}
+
+func (a *auditFS) Chtimes(name string, atime, mtime time.Time) error {
+	return a.audit(AuditEvent{Op: "chtimes", Path: name}, func() error {
+		return Chtimes(a.fsys, name, atime, mtime)
+	})
+}
+
+func (a *auditFS) Mkdir(name string, perm FileMode) error {
+	return a.audit(AuditEvent{Op: "mkdir", Path: name, Mode: perm}, func() error {
+		return Mkdir(a.fsys, name, perm)
+	})
+}
+
+func (a *auditFS) MkdirAll(path string, perm FileMode) error {
+	return a.audit(AuditEvent{Op: "mkdirall", Path: path, Mode: perm}, func() error {
+		return MkdirAll(a.fsys, path, perm)
+	})
+}
+
+func (a *auditFS) Remove(name string) error {
+	return a.audit(AuditEvent{Op: "remove", Path: name}, func() error {
+		return Remove(a.fsys, name)
+	})
+}
+
+func (a *auditFS) RemoveAll(path string) error {
+	return a.audit(AuditEvent{Op: "removeall", Path: path}, func() error {
+		return RemoveAll(a.fsys, path)
+	})
+}
+
+func (a *auditFS) Rename(oldpath, newpath string) error {
+	return a.audit(AuditEvent{Op: "rename", Path: oldpath, NewPath: newpath}, func() error {
+		return Rename(a.fsys, oldpath, newpath)
+	})
+}
+
+func (a *auditFS) Symlink(oldname, newname string) error {
+	return a.audit(AuditEvent{Op: "symlink", Path: newname, Target: oldname}, func() error {
+		return Symlink(a.fsys, oldname, newname)
+	})
+}
+
+func (a *auditFS) Link(oldname, newname string) error {
+	return a.audit(AuditEvent{Op: "link", Path: oldname, NewPath: newname}, func() error {
+		return Link(a.fsys, oldname, newname)
+	})
+}
+
+func (a *auditFS) Truncate(name string, size int64) error {
+	return a.audit(AuditEvent{Op: "truncate", Path: name, Size: size}, func() error {
+		return Truncate(a.fsys, name, size)
+	})
+}
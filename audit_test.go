@@ -0,0 +1,43 @@
+package wrfs_test
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestAudit(t *testing.T) {
+	errDenied := errors.New("denied")
+	var before, after []string
+	fsys := Audit(newLowerFS(t), Hooks{
+		Before: func(e AuditEvent) error {
+			before = append(before, e.Op+" "+e.Path)
+			if path.Dir(e.Path) == "dir/sub" {
+				return errDenied
+			}
+			return nil
+		},
+		After: func(e AuditEvent, err error) {
+			after = append(after, e.Op+" "+e.Path)
+		},
+	})
+
+	check(t, WriteFile(fsys, "dir/new", []byte("data"), 0644))
+	checkContents(t, fsys, "dir/new", "data")
+	check(t, Rename(fsys, "dir/new", "dir/renamed"))
+	if err := Remove(fsys, "dir/sub/file"); !errors.Is(err, errDenied) {
+		t.Errorf("Remove: got %v, want errDenied", err)
+	}
+	checkContents(t, fsys, "dir/sub/file", "lower")
+
+	wantBefore := []string{"openfile dir/new", "rename dir/new", "remove dir/sub/file"}
+	if strings.Join(before, ",") != strings.Join(wantBefore, ",") {
+		t.Errorf("Before called with %q, want %q", before, wantBefore)
+	}
+	if wantAfter := wantBefore[:2]; strings.Join(after, ",") != strings.Join(wantAfter, ",") {
+		t.Errorf("After called with %q, want %q", after, wantAfter)
+	}
+}
@@ -0,0 +1,390 @@
+// Package blobfs provides file systems on top of blob stores, so that a cloud storage service can be accessed as a
+// wrfs file system by implementing the narrow BlobStore interface for it.
+package blobfs
+
+import (
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// A BlobStore stores blobs of data under keys, such as a bucket of Google Cloud Storage, a container of Azure Blob
+// Storage, or one of MinIO. Keys are slash-separated paths, but stores need not treat slashes specially.
+type BlobStore interface {
+	// Get returns the contents of the blob with the given key, or an error matching wrfs.ErrNotExist if there is
+	// none.
+	Get(key string) (io.ReadCloser, error)
+
+	// Put stores the contents read from r as the blob with the given key, replacing any existing one.
+	Put(key string, r io.Reader) error
+
+	// Delete deletes the blob with the given key. Deleting a blob that does not exist either succeeds or fails
+	// with an error matching wrfs.ErrNotExist.
+	Delete(key string) error
+
+	// List calls fn for each blob whose key starts with prefix, in any order. If fn returns an error, List stops
+	// and returns it.
+	List(prefix string, fn func(BlobInfo) error) error
+}
+
+// BlobInfo describes a blob, as listed by a BlobStore.
+type BlobInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// FS is a file system on top of a BlobStore.
+type FS struct {
+	store BlobStore
+}
+
+// New returns a file system on top of store. The names of files are the keys of blobs, and directories are
+// synthesized from the prefixes of keys up to a slash: a directory exists if any key starts with its name and a
+// slash. Mkdir stores an empty blob with such a key as a marker, so that empty directories can exist.
+//
+// Files opened for reading are read with Get, and those opened for writing are buffered in memory and stored with
+// Put when closed. Rename copies blobs and deletes the originals, so it is not atomic. Blobs have no permission bits,
+// so directories are reported with mode 0755, files with mode 0644, and the permission bits passed to OpenFile and
+// Mkdir are ignored.
+func New(store BlobStore) *FS {
+	return &FS{store}
+}
+
+// dirKey returns the prefix of the keys of the blobs in the named directory.
+func dirKey(name string) string {
+	if name == "." {
+		return ""
+	}
+	return name + "/"
+}
+
+// errFound stops listing once a file has been found.
+var errFound = errors.New("found")
+
+// stat returns the information on name, which is a directory if there is no blob with its key but some with its
+// name as a prefix.
+func (fsys *FS) stat(name string) (*fileInfo, error) {
+	if name == "." {
+		return &fileInfo{name: ".", dir: true}, nil
+	}
+	var fi *fileInfo
+	err := fsys.store.List(name, func(b BlobInfo) error {
+		switch {
+		case b.Key == name:
+			fi = &fileInfo{name: path.Base(name), size: b.Size, modTime: b.ModTime}
+			return errFound
+		case strings.HasPrefix(b.Key, name+"/"):
+			fi = &fileInfo{name: path.Base(name), dir: true}
+		}
+		return nil
+	})
+	switch {
+	case err != nil && err != errFound:
+		return nil, err
+	case fi == nil:
+		return nil, wrfs.ErrNotExist
+	}
+	return fi, nil
+}
+
+func (fsys *FS) Stat(name string) (wrfs.FileInfo, error) {
+	if !wrfs.ValidPath(name) {
+		return nil, &wrfs.PathError{Op: "stat", Path: name, Err: wrfs.ErrInvalid}
+	}
+	fi, err := fsys.stat(name)
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return fi, nil
+}
+
+func (fsys *FS) ReadDir(name string) ([]wrfs.DirEntry, error) {
+	if !wrfs.ValidPath(name) {
+		return nil, &wrfs.PathError{Op: "readdir", Path: name, Err: wrfs.ErrInvalid}
+	}
+	entries, err := fsys.readDir(name)
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+func (fsys *FS) readDir(name string) ([]wrfs.DirEntry, error) {
+	prefix := dirKey(name)
+	infos := make(map[string]*fileInfo)
+	found := name == "."
+	err := fsys.store.List(prefix, func(b BlobInfo) error {
+		found = true
+		elem, rest, dir := strings.Cut(b.Key[len(prefix):], "/")
+		switch {
+		case elem == "" || elem == "." || elem == "..":
+			// Keys with such elements cannot be accessed as files.
+		case dir:
+			infos[elem] = &fileInfo{name: elem, dir: true}
+		case infos[elem] == nil && rest == "":
+			infos[elem] = &fileInfo{name: elem, size: b.Size, modTime: b.ModTime}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		if _, err := fsys.stat(name); err != nil {
+			return nil, err
+		}
+		return nil, syscall.ENOTDIR
+	}
+	entries := make([]wrfs.DirEntry, 0, len(infos))
+	for _, fi := range infos {
+		entries = append(entries, fi)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (fsys *FS) Open(name string) (wrfs.File, error) {
+	if !wrfs.ValidPath(name) {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrInvalid}
+	}
+	fi, err := fsys.stat(name)
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if fi.dir {
+		return &dir{fsys: fsys, name: name, info: fi}, nil
+	}
+	body, err := fsys.store.Get(name)
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &reader{name: name, info: fi, body: body}, nil
+}
+
+// OpenFile opens the named file. Files opened for writing are stored with an empty Put if O_CREATE is given and
+// they do not exist, and read into memory unless O_TRUNC is given; their contents are stored when they are closed.
+func (fsys *FS) OpenFile(name string, flag int, perm wrfs.FileMode) (wrfs.File, error) {
+	write := flag&(wrfs.O_WRONLY|wrfs.O_RDWR) != 0
+	if !write && flag&wrfs.O_CREATE == 0 {
+		return fsys.Open(name)
+	}
+	if !wrfs.ValidPath(name) || name == "." {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrInvalid}
+	}
+	fi, err := fsys.stat(name)
+	switch {
+	case err == nil && flag&(wrfs.O_CREATE|wrfs.O_EXCL) == wrfs.O_CREATE|wrfs.O_EXCL:
+		err = wrfs.ErrExist
+	case err == nil && fi.dir && write:
+		err = syscall.EISDIR
+	case errors.Is(err, wrfs.ErrNotExist) && flag&wrfs.O_CREATE != 0:
+		if err = fsys.checkParent(name); err == nil {
+			err = fsys.store.Put(name, strings.NewReader(""))
+			fi = &fileInfo{name: path.Base(name), modTime: time.Now()}
+		}
+	}
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if !write {
+		return fsys.Open(name)
+	}
+	w := &writer{fsys: fsys, name: name, info: *fi, append: flag&wrfs.O_APPEND != 0, read: flag&wrfs.O_RDWR != 0}
+	if flag&wrfs.O_TRUNC == 0 && fi.size > 0 {
+		if w.data, err = wrfs.ReadFile(fsys, name); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// checkParent returns an error unless the parent directory of name exists, as blob stores store blobs regardless.
+func (fsys *FS) checkParent(name string) error {
+	fi, err := fsys.stat(path.Dir(name))
+	if err == nil && !fi.dir {
+		err = syscall.ENOTDIR
+	}
+	return err
+}
+
+func (fsys *FS) Mkdir(name string, perm wrfs.FileMode) error {
+	if !wrfs.ValidPath(name) {
+		return &wrfs.PathError{Op: "mkdir", Path: name, Err: wrfs.ErrInvalid}
+	}
+	_, err := fsys.stat(name)
+	switch {
+	case err == nil:
+		err = wrfs.ErrExist
+	case errors.Is(err, wrfs.ErrNotExist):
+		if err = fsys.checkParent(name); err == nil {
+			err = fsys.store.Put(dirKey(name), strings.NewReader(""))
+		}
+	}
+	if err != nil {
+		return &wrfs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (fsys *FS) Remove(name string) error {
+	if !wrfs.ValidPath(name) || name == "." {
+		return &wrfs.PathError{Op: "remove", Path: name, Err: wrfs.ErrInvalid}
+	}
+	if err := fsys.remove(name); err != nil {
+		return &wrfs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (fsys *FS) remove(name string) error {
+	fi, err := fsys.stat(name)
+	if err != nil {
+		return err
+	}
+	key := name
+	if fi.dir {
+		key = dirKey(name)
+		err := fsys.store.List(key, func(b BlobInfo) error {
+			if b.Key != key {
+				return errno.ENOTEMPTY
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := fsys.store.Delete(key); err != nil && (!fi.dir || !errors.Is(err, wrfs.ErrNotExist)) {
+		return err
+	}
+	return nil
+}
+
+// keys returns the key of the blob for name, if any, and those of all blobs with its name as a prefix, up to a slash.
+func (fsys *FS) keys(name string) ([]string, error) {
+	var keys []string
+	err := fsys.store.List(name, func(b BlobInfo) error {
+		if b.Key == name || strings.HasPrefix(b.Key, dirKey(name)) {
+			keys = append(keys, b.Key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+func (fsys *FS) RemoveAll(name string) error {
+	if !wrfs.ValidPath(name) {
+		return &wrfs.PathError{Op: "removeall", Path: name, Err: wrfs.ErrInvalid}
+	}
+	keys, err := fsys.keys(name)
+	for _, key := range keys {
+		if err != nil {
+			break
+		}
+		if err = fsys.store.Delete(key); errors.Is(err, wrfs.ErrNotExist) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return &wrfs.PathError{Op: "removeall", Path: name, Err: err}
+	}
+	return nil
+}
+
+// Rename renames oldpath to newpath by copying the blobs for it and deleting the originals. Renaming a directory
+// copies every blob in it.
+func (fsys *FS) Rename(oldpath, newpath string) error {
+	if err := fsys.rename(oldpath, newpath); err != nil {
+		return &wrfs.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	return nil
+}
+
+func (fsys *FS) rename(oldpath, newpath string) error {
+	if !wrfs.ValidPath(oldpath) || !wrfs.ValidPath(newpath) || oldpath == "." || newpath == "." {
+		return wrfs.ErrInvalid
+	}
+	oldInfo, err := fsys.stat(oldpath)
+	if err != nil {
+		return err
+	}
+	if oldpath == newpath {
+		return nil
+	}
+	if oldInfo.dir && strings.HasPrefix(newpath, oldpath+"/") {
+		return wrfs.ErrInvalid
+	}
+	newInfo, err := fsys.stat(newpath)
+	switch {
+	case err == nil && oldInfo.dir && !newInfo.dir:
+		return syscall.ENOTDIR
+	case err == nil && !oldInfo.dir && newInfo.dir:
+		return syscall.EISDIR
+	case err == nil && newInfo.dir:
+		if err := fsys.remove(newpath); err != nil {
+			return err
+		}
+	case errors.Is(err, wrfs.ErrNotExist):
+		if err := fsys.checkParent(newpath); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	}
+	keys, err := fsys.keys(oldpath)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := fsys.copy(key, newpath+key[len(oldpath):]); err != nil {
+			return err
+		}
+	}
+	for _, key := range keys {
+		if err := fsys.store.Delete(key); err != nil && !errors.Is(err, wrfs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// copy copies the blob with the key src to the key dst.
+func (fsys *FS) copy(src, dst string) error {
+	body, err := fsys.store.Get(src)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return fsys.store.Put(dst, body)
+}
+
+// fileInfo describes a blob, or a directory synthesized from the prefixes of keys.
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (fi *fileInfo) Name() string                 { return fi.name }
+func (fi *fileInfo) Size() int64                  { return fi.size }
+func (fi *fileInfo) ModTime() time.Time           { return fi.modTime }
+func (fi *fileInfo) IsDir() bool                  { return fi.dir }
+func (fi *fileInfo) Sys() any                     { return nil }
+func (fi *fileInfo) Type() wrfs.FileMode          { return fi.Mode().Type() }
+func (fi *fileInfo) Info() (wrfs.FileInfo, error) { return fi, nil }
+
+func (fi *fileInfo) Mode() wrfs.FileMode {
+	if fi.dir {
+		return wrfs.ModeDir | 0755
+	}
+	return 0644
+}
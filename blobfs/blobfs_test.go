@@ -0,0 +1,102 @@
+package blobfs_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/blobfs"
+	"github.com/relab/wrfs/wrfstest"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// mapStore is an in-memory BlobStore.
+type mapStore struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+func (s *mapStore) Get(key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, wrfs.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *mapStore) Put(key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = data
+	return nil
+}
+
+func (s *mapStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
+
+func (s *mapStore) List(prefix string, fn func(blobfs.BlobInfo) error) error {
+	s.mu.Lock()
+	var infos []blobfs.BlobInfo
+	for key, data := range s.blobs {
+		if strings.HasPrefix(key, prefix) {
+			infos = append(infos, blobfs.BlobInfo{Key: key, Size: int64(len(data)), ModTime: time.Unix(1e9, 0)})
+		}
+	}
+	s.mu.Unlock()
+	for _, info := range infos {
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestFS(t *testing.T) {
+	store := &mapStore{blobs: map[string][]byte{
+		"dir/file":        []byte("hello, world"),
+		"dir/sub/":        nil,
+		"implicit/a/file": []byte("x"),
+		"bad//key":        []byte("x"),
+	}}
+	fsys := blobfs.New(store)
+
+	check(t, fstest.TestFS(fsys, "dir/file", "dir/sub", "implicit/a/file"))
+	if err := wrfstest.TestWriteFS(fsys, wrfstest.SkipChmod(), wrfstest.SkipChown(), wrfstest.SkipChtimes(),
+		wrfstest.SkipLinks()); err != nil {
+		t.Fatal(err)
+	}
+
+	check(t, wrfs.Rename(fsys, "implicit", "dir/moved"))
+	if string(store.blobs["dir/moved/a/file"]) != "x" || len(store.blobs) != 4 {
+		t.Errorf("Rename of a directory left blobs %v", store.blobs)
+	}
+	if err := wrfs.Remove(fsys, "dir"); err == nil {
+		t.Error("Remove of a non-empty directory succeeded")
+	}
+	check(t, wrfs.RemoveAll(fsys, "dir"))
+	if _, err := wrfs.Stat(fsys, "dir"); !errors.Is(err, wrfs.ErrNotExist) {
+		t.Errorf("RemoveAll did not remove dir: %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package blobfs
+
+import (
+	"bytes"
+	"io"
+	"syscall"
+
+	"github.com/relab/wrfs"
+)
+
+// dir is an open directory, listed when first read.
+type dir struct {
+	fsys    *FS
+	name    string
+	info    *fileInfo
+	entries []wrfs.DirEntry
+	listed  bool
+}
+
+func (d *dir) Stat() (wrfs.FileInfo, error) { return d.info, nil }
+func (d *dir) Close() error                 { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &wrfs.PathError{Op: "read", Path: d.name, Err: syscall.EISDIR}
+}
+
+func (d *dir) ReadDir(n int) ([]wrfs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.listed = entries, true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// reader is a blob opened for reading.
+type reader struct {
+	name string
+	info *fileInfo
+	body io.ReadCloser
+}
+
+func (r *reader) Stat() (wrfs.FileInfo, error) { return r.info, nil }
+func (r *reader) Read(p []byte) (int, error)   { return r.body.Read(p) }
+func (r *reader) Close() error                 { return r.body.Close() }
+
+// writer is a blob opened for writing, whose contents are stored when it is closed.
+type writer struct {
+	fsys   *FS
+	name   string
+	info   fileInfo
+	data   []byte
+	off    int64
+	append bool
+	read   bool
+	closed bool
+}
+
+func (w *writer) Stat() (wrfs.FileInfo, error) {
+	fi := w.info
+	fi.size = int64(len(w.data))
+	return &fi, nil
+}
+
+func (w *writer) Read(p []byte) (int, error) {
+	if !w.read {
+		return 0, &wrfs.PathError{Op: "read", Path: w.name, Err: wrfs.ErrPermission}
+	}
+	if w.off >= int64(len(w.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, w.data[w.off:])
+	w.off += int64(n)
+	return n, nil
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, &wrfs.PathError{Op: "write", Path: w.name, Err: wrfs.ErrClosed}
+	}
+	if w.append {
+		w.off = int64(len(w.data))
+	}
+	if end := w.off + int64(len(p)); end > int64(len(w.data)) {
+		w.data = append(w.data, make([]byte, end-int64(len(w.data)))...)
+	}
+	n := copy(w.data[w.off:], p)
+	w.off += int64(n)
+	return n, nil
+}
+
+func (w *writer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += w.off
+	case io.SeekEnd:
+		offset += int64(len(w.data))
+	}
+	if offset < 0 {
+		return 0, &wrfs.PathError{Op: "seek", Path: w.name, Err: wrfs.ErrInvalid}
+	}
+	w.off = offset
+	return offset, nil
+}
+
+func (w *writer) Truncate(size int64) error {
+	if size < 0 {
+		return &wrfs.PathError{Op: "truncate", Path: w.name, Err: wrfs.ErrInvalid}
+	}
+	if size <= int64(len(w.data)) {
+		w.data = w.data[:size]
+	} else {
+		w.data = append(w.data, make([]byte, size-int64(len(w.data)))...)
+	}
+	return nil
+}
+
+// Close stores the contents of the file.
+func (w *writer) Close() error {
+	if w.closed {
+		return &wrfs.PathError{Op: "close", Path: w.name, Err: wrfs.ErrClosed}
+	}
+	w.closed = true
+	if err := w.fsys.store.Put(w.name, bytes.NewReader(w.data)); err != nil {
+		return &wrfs.PathError{Op: "close", Path: w.name, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,474 @@
+// Package boltfs provides a writable file system stored in a bbolt database, so that embedded applications can
+// keep a tree of files in a single file without cgo.
+//
+// The tree is kept in the bucket "wrfs" of the database, so the database can hold the other buckets of the
+// application too. Directories are nested buckets, and the files in them are keys whose values are the numbers of
+// their inodes. The contents of files are stored in chunks of 64 KiB, keyed by the inode and the index of the
+// chunk, so that writes to a large file only rewrite the chunks they touch.
+//
+// The package is a separate module, so that the wrfs module does not depend on bbolt.
+package boltfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/errno"
+	bolt "go.etcd.io/bbolt"
+)
+
+// chunkSize is the size of the chunks of the contents of files.
+const chunkSize = 64 << 10
+
+// The buckets of the file system, nested in rootBucket.
+var (
+	rootBucket   = []byte("wrfs")
+	treeBucket   = []byte("tree")   // the root directory
+	inodesBucket = []byte("inodes") // the inodes of files, by number
+	chunksBucket = []byte("chunks") // the chunks of files, by inode number and index
+)
+
+// metaKey is the key of the inode of a directory in its bucket. It cannot be the name of a file, since names
+// do not contain slashes.
+var metaKey = []byte("/")
+
+// FS is a file system stored in a bbolt database.
+type FS struct {
+	db *bolt.DB
+}
+
+var (
+	_ wrfs.OpenFileFS = (*FS)(nil)
+	_ wrfs.MkdirFS    = (*FS)(nil)
+	_ wrfs.RemoveFS   = (*FS)(nil)
+	_ wrfs.RenameFS   = (*FS)(nil)
+	_ wrfs.ChmodFS    = (*FS)(nil)
+	_ wrfs.ChtimesFS  = (*FS)(nil)
+	_ wrfs.TruncateFS = (*FS)(nil)
+)
+
+// New returns the file system stored in db, creating an empty one if db has none. The caller remains responsible
+// for closing db once done with the file system.
+//
+// Every operation is a transaction of its own, including each write to a file, so changes are durable once the
+// operation returns, and are immediately visible through other open files. Writes should therefore be buffered,
+// such as with bufio.Writer. Files have no owners, and their access times are not recorded.
+func New(db *bolt.DB) (*FS, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists(rootBucket)
+		if err != nil {
+			return err
+		}
+		if root.Bucket(treeBucket) == nil {
+			tree, err := root.CreateBucket(treeBucket)
+			if err != nil {
+				return err
+			}
+			if err := tree.Put(metaKey, inode{mode: wrfs.ModeDir | 0755, modTime: time.Now()}.encode()); err != nil {
+				return err
+			}
+		}
+		if _, err := root.CreateBucketIfNotExists(inodesBucket); err != nil {
+			return err
+		}
+		_, err = root.CreateBucketIfNotExists(chunksBucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &FS{db: db}, nil
+}
+
+// view runs fn in a read-only transaction.
+func (fsys *FS) view(fn func(t *txn) error) error {
+	return fsys.db.View(func(tx *bolt.Tx) error { return fn(newTxn(tx)) })
+}
+
+// update runs fn in a read-write transaction.
+func (fsys *FS) update(fn func(t *txn) error) error {
+	return fsys.db.Update(func(tx *bolt.Tx) error { return fn(newTxn(tx)) })
+}
+
+// Open opens the named file for reading.
+func (fsys *FS) Open(name string) (wrfs.File, error) {
+	return fsys.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens the named file with the specified flag (O_RDONLY etc.). If the file does not exist, and the
+// O_CREATE flag is passed, it is created with mode perm.
+func (fsys *FS) OpenFile(name string, flag int, perm wrfs.FileMode) (wrfs.File, error) {
+	if !wrfs.ValidPath(name) {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrInvalid}
+	}
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	f := &file{fsys: fsys, name: name, flag: flag}
+	open := func(t *txn) error {
+		e, err := t.lookup(name)
+		switch {
+		case err == nil && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+			return wrfs.ErrExist
+		case errors.Is(err, wrfs.ErrNotExist) && flag&os.O_CREATE != 0:
+			if e, err = t.create(name, perm); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		}
+		if e.dir != nil {
+			if writable {
+				return syscall.EISDIR
+			}
+			f.dir = true
+			f.entries, err = t.readDir(e.dir)
+			return err
+		}
+		f.id = e.id
+		if flag&os.O_TRUNC != 0 && writable {
+			n, err := t.inode(e.id)
+			if err != nil {
+				return err
+			}
+			if n.size > 0 {
+				return t.truncate(e.id, n, 0)
+			}
+		}
+		return nil
+	}
+	var err error
+	if writable || flag&os.O_CREATE != 0 {
+		err = fsys.update(open)
+	} else {
+		err = fsys.view(open)
+	}
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return f, nil
+}
+
+// Stat returns a FileInfo describing the named file.
+func (fsys *FS) Stat(name string) (wrfs.FileInfo, error) {
+	if !wrfs.ValidPath(name) {
+		return nil, &wrfs.PathError{Op: "stat", Path: name, Err: wrfs.ErrInvalid}
+	}
+	var fi wrfs.FileInfo
+	err := fsys.view(func(t *txn) error {
+		e, err := t.lookup(name)
+		if err != nil {
+			return err
+		}
+		fi, err = t.stat(path.Base(name), e)
+		return err
+	})
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return fi, nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by name.
+func (fsys *FS) ReadDir(name string) ([]wrfs.DirEntry, error) {
+	if !wrfs.ValidPath(name) {
+		return nil, &wrfs.PathError{Op: "readdir", Path: name, Err: wrfs.ErrInvalid}
+	}
+	var entries []wrfs.DirEntry
+	err := fsys.view(func(t *txn) error {
+		e, err := t.lookup(name)
+		if err != nil {
+			return err
+		}
+		if e.dir == nil {
+			return syscall.ENOTDIR
+		}
+		entries, err = t.readDir(e.dir)
+		return err
+	})
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+// Mkdir creates a new directory with the specified name and permission bits.
+func (fsys *FS) Mkdir(name string, perm wrfs.FileMode) error {
+	err := fsys.update(func(t *txn) error {
+		dir, base, err := t.parent(name)
+		if err != nil {
+			return err
+		}
+		if _, ok := t.child(dir, base); ok {
+			return wrfs.ErrExist
+		}
+		sub, err := dir.CreateBucket([]byte(base))
+		if err != nil {
+			return err
+		}
+		return sub.Put(metaKey, inode{mode: wrfs.ModeDir | perm&wrfs.ModePerm, modTime: time.Now()}.encode())
+	})
+	if err != nil {
+		return &wrfs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return nil
+}
+
+// Remove removes the named file or empty directory.
+func (fsys *FS) Remove(name string) error {
+	err := fsys.update(func(t *txn) error {
+		dir, base, err := t.parent(name)
+		if err != nil {
+			return err
+		}
+		e, ok := t.child(dir, base)
+		switch {
+		case !ok:
+			return wrfs.ErrNotExist
+		case e.dir != nil:
+			if !isEmpty(e.dir) {
+				return errno.ENOTEMPTY
+			}
+			return dir.DeleteBucket([]byte(base))
+		}
+		if err := t.removeInode(e.id); err != nil {
+			return err
+		}
+		return dir.Delete([]byte(base))
+	})
+	if err != nil {
+		return &wrfs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+// isEmpty reports whether the bucket of a directory has no entries.
+func isEmpty(dir *bolt.Bucket) bool {
+	c := dir.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		if string(k) != string(metaKey) {
+			return false
+		}
+	}
+	return true
+}
+
+// RemoveAll removes name and any children it contains. It returns nil if name does not exist.
+func (fsys *FS) RemoveAll(name string) error {
+	err := fsys.update(func(t *txn) error {
+		dir, base, err := t.parent(name)
+		if errors.Is(err, wrfs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		e, ok := t.child(dir, base)
+		switch {
+		case !ok:
+			return nil
+		case e.dir != nil:
+			if err := t.removeInodes(e.dir); err != nil {
+				return err
+			}
+			return dir.DeleteBucket([]byte(base))
+		}
+		if err := t.removeInode(e.id); err != nil {
+			return err
+		}
+		return dir.Delete([]byte(base))
+	})
+	if err != nil {
+		return &wrfs.PathError{Op: "removeall", Path: name, Err: err}
+	}
+	return nil
+}
+
+// Rename renames (moves) oldpath to newpath. An existing file at newpath is replaced, but, like os.Rename, an
+// existing directory never is.
+func (fsys *FS) Rename(oldpath, newpath string) error {
+	err := fsys.update(func(t *txn) error {
+		oldDir, oldBase, err := t.parent(oldpath)
+		if err != nil {
+			return err
+		}
+		newDir, newBase, err := t.parent(newpath)
+		if err != nil {
+			return err
+		}
+		e, ok := t.child(oldDir, oldBase)
+		if !ok {
+			return wrfs.ErrNotExist
+		}
+		existing, ok := t.child(newDir, newBase)
+		switch {
+		case ok && existing.dir != nil:
+			return wrfs.ErrExist
+		case e.dir != nil && strings.HasPrefix(newpath, oldpath+"/"):
+			return wrfs.ErrInvalid
+		case ok && e.dir != nil:
+			return syscall.ENOTDIR
+		case ok && existing.id == e.id:
+			return nil
+		case ok:
+			if err := t.removeInode(existing.id); err != nil {
+				return err
+			}
+		}
+		if e.dir == nil {
+			if err := newDir.Put([]byte(newBase), idKey(e.id)); err != nil {
+				return err
+			}
+			return oldDir.Delete([]byte(oldBase))
+		}
+		dst, err := newDir.CreateBucket([]byte(newBase))
+		if err != nil {
+			return err
+		}
+		if err := copyBucket(dst, e.dir); err != nil {
+			return err
+		}
+		return oldDir.DeleteBucket([]byte(oldBase))
+	})
+	if err != nil {
+		return &wrfs.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	return nil
+}
+
+// copyBucket copies the keys and nested buckets of src to dst.
+func copyBucket(dst, src *bolt.Bucket) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		sub, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(sub, src.Bucket(k))
+	})
+}
+
+// Chmod changes the permission bits of the named file to those of mode.
+func (fsys *FS) Chmod(name string, mode wrfs.FileMode) error {
+	return fsys.modify("chmod", name, func(n *inode) {
+		n.mode = n.mode&^wrfs.ModePerm | mode&wrfs.ModePerm
+	})
+}
+
+// Chtimes changes the modification time of the named file. Access times are not recorded, so atime is ignored.
+func (fsys *FS) Chtimes(name string, atime, mtime time.Time) error {
+	return fsys.modify("chtimes", name, func(n *inode) {
+		n.modTime = mtime
+	})
+}
+
+// modify applies fn to the inode of the named file or directory.
+func (fsys *FS) modify(op, name string, fn func(n *inode)) error {
+	if !wrfs.ValidPath(name) {
+		return &wrfs.PathError{Op: op, Path: name, Err: wrfs.ErrInvalid}
+	}
+	err := fsys.update(func(t *txn) error {
+		e, err := t.lookup(name)
+		if err != nil {
+			return err
+		}
+		if e.dir != nil {
+			n := decodeInode(e.dir.Get(metaKey))
+			fn(&n)
+			return e.dir.Put(metaKey, n.encode())
+		}
+		n, err := t.inode(e.id)
+		if err != nil {
+			return err
+		}
+		fn(&n)
+		return t.inodes.Put(idKey(e.id), n.encode())
+	})
+	if err != nil {
+		return &wrfs.PathError{Op: op, Path: name, Err: err}
+	}
+	return nil
+}
+
+// Truncate changes the size of the named file.
+func (fsys *FS) Truncate(name string, size int64) error {
+	if !wrfs.ValidPath(name) || size < 0 {
+		return &wrfs.PathError{Op: "truncate", Path: name, Err: wrfs.ErrInvalid}
+	}
+	err := fsys.update(func(t *txn) error {
+		e, err := t.lookup(name)
+		if err != nil {
+			return err
+		}
+		if e.dir != nil {
+			return syscall.EISDIR
+		}
+		n, err := t.inode(e.id)
+		if err != nil {
+			return err
+		}
+		return t.truncate(e.id, n, size)
+	})
+	if err != nil {
+		return &wrfs.PathError{Op: "truncate", Path: name, Err: err}
+	}
+	return nil
+}
+
+// An inode describes a file or directory.
+type inode struct {
+	mode    wrfs.FileMode
+	modTime time.Time
+	size    int64
+}
+
+// encode encodes n as its mode, modification time in nanoseconds since the Unix epoch, and size, in big-endian
+// order.
+func (n inode) encode() []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(n.mode))
+	b = binary.BigEndian.AppendUint64(b, uint64(n.modTime.UnixNano()))
+	return binary.BigEndian.AppendUint64(b, uint64(n.size))
+}
+
+// decodeInode decodes an inode encoded by encode.
+func decodeInode(b []byte) inode {
+	if len(b) < 20 {
+		return inode{}
+	}
+	return inode{
+		mode:    wrfs.FileMode(binary.BigEndian.Uint32(b)),
+		modTime: time.Unix(0, int64(binary.BigEndian.Uint64(b[4:]))),
+		size:    int64(binary.BigEndian.Uint64(b[12:])),
+	}
+}
+
+// idKey returns the key of the inode with number id.
+func idKey(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, id)
+}
+
+// chunkKey returns the key of the chunk of the inode with number id at the given index.
+func chunkKey(id uint64, index int64) []byte {
+	return binary.BigEndian.AppendUint64(idKey(id), uint64(index))
+}
+
+// fileInfo describes a file or directory, and is also its directory entry.
+type fileInfo struct {
+	name string
+	inode
+}
+
+func (fi *fileInfo) Name() string                 { return fi.name }
+func (fi *fileInfo) Size() int64                  { return fi.size }
+func (fi *fileInfo) Mode() wrfs.FileMode          { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time           { return fi.modTime }
+func (fi *fileInfo) IsDir() bool                  { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() any                     { return nil }
+func (fi *fileInfo) Type() wrfs.FileMode          { return fi.mode.Type() }
+func (fi *fileInfo) Info() (wrfs.FileInfo, error) { return fi, nil }
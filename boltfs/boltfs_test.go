@@ -0,0 +1,65 @@
+package boltfs_test
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/boltfs"
+	"github.com/relab/wrfs/wrfstest"
+	bolt "go.etcd.io/bbolt"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func open(t *testing.T, path string) (*bolt.DB, *boltfs.FS) {
+	t.Helper()
+	db, err := bolt.Open(path, 0600, nil)
+	check(t, err)
+	fsys, err := boltfs.New(db)
+	check(t, err)
+	return db, fsys
+}
+
+func TestFS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, fsys := open(t, path)
+	if err := wrfstest.TestWriteFS(fsys, wrfstest.SkipChown(), wrfstest.SkipLinks()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Contents spanning several chunks survive writes in the middle and truncation.
+	data := bytes.Repeat([]byte("0123456789abcdef"), 20000)
+	check(t, wrfs.MkdirAll(fsys, "dir/sub", 0755))
+	check(t, wrfs.WriteFile(fsys, "dir/big", data, 0644))
+	file, err := wrfs.OpenFile(fsys, "dir/big", wrfs.O_RDWR, 0)
+	check(t, err)
+	_, err = file.(io.WriterAt).WriteAt([]byte("hello"), 100000)
+	check(t, err)
+	check(t, file.(wrfs.TruncateFile).Truncate(200000))
+	check(t, file.Close())
+	copy(data[100000:], "hello")
+	data = data[:200000]
+	check(t, db.Close())
+
+	// The files persist in the database.
+	db, fsys = open(t, path)
+	defer db.Close()
+	got, err := wrfs.ReadFile(fsys, "dir/big")
+	check(t, err)
+	if !bytes.Equal(got, data) {
+		t.Errorf("dir/big has %d bytes, want %d, or differs from what was written", len(got), len(data))
+	}
+	entries, err := wrfs.ReadDir(fsys, "dir")
+	check(t, err)
+	if len(entries) != 2 || entries[0].Name() != "big" || !entries[1].IsDir() {
+		t.Errorf("ReadDir returned %v", entries)
+	}
+}
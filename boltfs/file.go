@@ -0,0 +1,252 @@
+package boltfs
+
+import (
+	"io"
+	"os"
+	"path"
+	"syscall"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// file is an open file or directory. Every read and write of a file is a transaction of its own.
+type file struct {
+	fsys   *FS
+	name   string
+	flag   int
+	id     uint64 // the inode of a file
+	off    int64
+	dir    bool
+	closed bool
+
+	entries []wrfs.DirEntry // the entries of a directory not yet read
+}
+
+var (
+	_ wrfs.WriterFile   = (*file)(nil)
+	_ wrfs.ReadDirFile  = (*file)(nil)
+	_ wrfs.TruncateFile = (*file)(nil)
+	_ wrfs.SyncFile     = (*file)(nil)
+	_ io.ReaderAt       = (*file)(nil)
+	_ io.WriterAt       = (*file)(nil)
+	_ io.Seeker         = (*file)(nil)
+)
+
+func (f *file) readable() bool {
+	return f.flag&(os.O_WRONLY|os.O_RDWR) != os.O_WRONLY
+}
+
+func (f *file) writable() bool {
+	return f.flag&(os.O_WRONLY|os.O_RDWR) != 0
+}
+
+// check returns an error if the file is closed, or if it is a directory, which cannot be read and written as a
+// file.
+func (f *file) check(op string) error {
+	switch {
+	case f.closed:
+		return &wrfs.PathError{Op: op, Path: f.name, Err: wrfs.ErrClosed}
+	case f.dir:
+		return &wrfs.PathError{Op: op, Path: f.name, Err: syscall.EISDIR}
+	}
+	return nil
+}
+
+func (f *file) Stat() (wrfs.FileInfo, error) {
+	if f.closed {
+		return nil, &wrfs.PathError{Op: "stat", Path: f.name, Err: wrfs.ErrClosed}
+	}
+	var fi wrfs.FileInfo
+	err := f.fsys.view(func(t *txn) error {
+		if f.dir {
+			e, err := t.lookup(f.name)
+			if err != nil {
+				return err
+			}
+			fi, err = t.stat(path.Base(f.name), e)
+			return err
+		}
+		var err error
+		fi, err = t.stat(path.Base(f.name), entry{id: f.id})
+		return err
+	})
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "stat", Path: f.name, Err: err}
+	}
+	return fi, nil
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	n, err := f.readAt("read", p, f.off)
+	f.off += int64(n)
+	if err == nil && n == 0 && len(p) > 0 {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &wrfs.PathError{Op: "readat", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	n, err := f.readAt("readat", p, off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *file) readAt(op string, p []byte, off int64) (int, error) {
+	if err := f.check(op); err != nil {
+		return 0, err
+	}
+	if !f.readable() {
+		return 0, &wrfs.PathError{Op: op, Path: f.name, Err: errno.EBADF}
+	}
+	var read int
+	err := f.fsys.view(func(t *txn) error {
+		n, err := t.inode(f.id)
+		if err != nil {
+			return err
+		}
+		read = t.readAt(f.id, n, p, off)
+		return nil
+	})
+	if err != nil {
+		return 0, &wrfs.PathError{Op: op, Path: f.name, Err: err}
+	}
+	return read, nil
+}
+
+func (f *file) Write(p []byte) (int, error) {
+	n, err := f.writeAt("write", p, f.off)
+	if err == nil {
+		f.off += int64(n)
+	}
+	return n, err
+}
+
+func (f *file) WriteAt(p []byte, off int64) (int, error) {
+	if f.flag&os.O_APPEND != 0 || off < 0 {
+		return 0, &wrfs.PathError{Op: "writeat", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	return f.writeAt("writeat", p, off)
+}
+
+// writeAt writes p at offset off, or at the end of the file if it was opened with O_APPEND, and moves the offset
+// of the file to the end of the write in the latter case.
+func (f *file) writeAt(op string, p []byte, off int64) (int, error) {
+	if err := f.check(op); err != nil {
+		return 0, err
+	}
+	if !f.writable() {
+		return 0, &wrfs.PathError{Op: op, Path: f.name, Err: errno.EBADF}
+	}
+	err := f.fsys.update(func(t *txn) error {
+		n, err := t.inode(f.id)
+		if err != nil {
+			return err
+		}
+		if f.flag&os.O_APPEND != 0 {
+			off = n.size
+			f.off = off
+		}
+		return t.writeAt(f.id, n, p, off)
+	})
+	if err != nil {
+		return 0, &wrfs.PathError{Op: op, Path: f.name, Err: err}
+	}
+	return len(p), nil
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &wrfs.PathError{Op: "seek", Path: f.name, Err: wrfs.ErrClosed}
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		if f.dir {
+			return 0, &wrfs.PathError{Op: "seek", Path: f.name, Err: syscall.EISDIR}
+		}
+		err := f.fsys.view(func(t *txn) error {
+			n, err := t.inode(f.id)
+			offset += n.size
+			return err
+		})
+		if err != nil {
+			return 0, &wrfs.PathError{Op: "seek", Path: f.name, Err: err}
+		}
+	default:
+		return 0, &wrfs.PathError{Op: "seek", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &wrfs.PathError{Op: "seek", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+// ReadDir returns the entries of a directory, as they were when it was opened.
+func (f *file) ReadDir(count int) ([]wrfs.DirEntry, error) {
+	switch {
+	case f.closed:
+		return nil, &wrfs.PathError{Op: "readdir", Path: f.name, Err: wrfs.ErrClosed}
+	case !f.dir:
+		return nil, &wrfs.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+	}
+	if count <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	count = min(count, len(f.entries))
+	entries := f.entries[:count]
+	f.entries = f.entries[count:]
+	return entries, nil
+}
+
+func (f *file) Truncate(size int64) error {
+	if err := f.check("truncate"); err != nil {
+		return err
+	}
+	if !f.writable() {
+		return &wrfs.PathError{Op: "truncate", Path: f.name, Err: errno.EBADF}
+	}
+	if size < 0 {
+		return &wrfs.PathError{Op: "truncate", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	err := f.fsys.update(func(t *txn) error {
+		n, err := t.inode(f.id)
+		if err != nil {
+			return err
+		}
+		return t.truncate(f.id, n, size)
+	})
+	if err != nil {
+		return &wrfs.PathError{Op: "truncate", Path: f.name, Err: err}
+	}
+	return nil
+}
+
+// Sync does nothing but check that the file is open, since every write is committed when it returns.
+func (f *file) Sync() error {
+	if f.closed {
+		return &wrfs.PathError{Op: "sync", Path: f.name, Err: wrfs.ErrClosed}
+	}
+	return nil
+}
+
+func (f *file) Close() error {
+	if f.closed {
+		return &wrfs.PathError{Op: "close", Path: f.name, Err: wrfs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
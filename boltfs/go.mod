@@ -0,0 +1,12 @@
+module github.com/relab/wrfs/boltfs
+
+go 1.21
+
+require (
+	github.com/relab/wrfs v0.0.0
+	go.etcd.io/bbolt v1.3.10
+)
+
+require golang.org/x/sys v0.4.0 // indirect
+
+replace github.com/relab/wrfs => ../
@@ -0,0 +1,230 @@
+package boltfs
+
+import (
+	"encoding/binary"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/relab/wrfs"
+	bolt "go.etcd.io/bbolt"
+)
+
+// txn holds the buckets of the file system in a transaction. Its methods return bare errors, which the callers
+// wrap in *PathErrors.
+type txn struct {
+	tree, inodes, chunks *bolt.Bucket
+}
+
+func newTxn(tx *bolt.Tx) *txn {
+	root := tx.Bucket(rootBucket)
+	return &txn{tree: root.Bucket(treeBucket), inodes: root.Bucket(inodesBucket), chunks: root.Bucket(chunksBucket)}
+}
+
+// An entry is a file or directory found in the tree.
+type entry struct {
+	dir *bolt.Bucket // the bucket of a directory, or nil for files
+	id  uint64       // the number of the inode of a file
+}
+
+// child returns the entry named base in the bucket dir, and reports whether there is one.
+func (t *txn) child(dir *bolt.Bucket, base string) (entry, bool) {
+	if sub := dir.Bucket([]byte(base)); sub != nil {
+		return entry{dir: sub}, true
+	}
+	if v := dir.Get([]byte(base)); len(v) == 8 {
+		return entry{id: binary.BigEndian.Uint64(v)}, true
+	}
+	return entry{}, false
+}
+
+// lookup returns the entry of the named file, which must be a valid path.
+func (t *txn) lookup(name string) (entry, error) {
+	if name == "." {
+		return entry{dir: t.tree}, nil
+	}
+	dir, base, err := t.parent(name)
+	if err != nil {
+		return entry{}, err
+	}
+	e, ok := t.child(dir, base)
+	if !ok {
+		return entry{}, wrfs.ErrNotExist
+	}
+	return e, nil
+}
+
+// parent returns the bucket of the directory containing name and the last element of name.
+func (t *txn) parent(name string) (*bolt.Bucket, string, error) {
+	if !wrfs.ValidPath(name) || name == "." {
+		return nil, "", wrfs.ErrInvalid
+	}
+	dirName, base := path.Split(name)
+	dir := t.tree
+	if dirName != "" {
+		for _, elem := range strings.Split(strings.TrimSuffix(dirName, "/"), "/") {
+			e, ok := t.child(dir, elem)
+			switch {
+			case !ok:
+				return nil, "", wrfs.ErrNotExist
+			case e.dir == nil:
+				return nil, "", syscall.ENOTDIR
+			}
+			dir = e.dir
+		}
+	}
+	return dir, base, nil
+}
+
+// create creates the named file, which does not exist, with the permission bits of perm.
+func (t *txn) create(name string, perm wrfs.FileMode) (entry, error) {
+	dir, base, err := t.parent(name)
+	if err != nil {
+		return entry{}, err
+	}
+	id, err := t.inodes.NextSequence()
+	if err != nil {
+		return entry{}, err
+	}
+	if err := t.inodes.Put(idKey(id), inode{mode: perm & wrfs.ModePerm, modTime: time.Now()}.encode()); err != nil {
+		return entry{}, err
+	}
+	return entry{id: id}, dir.Put([]byte(base), idKey(id))
+}
+
+// inode returns the inode with number id, or an error matching ErrNotExist if the file has been removed.
+func (t *txn) inode(id uint64) (inode, error) {
+	v := t.inodes.Get(idKey(id))
+	if v == nil {
+		return inode{}, wrfs.ErrNotExist
+	}
+	return decodeInode(v), nil
+}
+
+// stat returns the information on the entry e named name.
+func (t *txn) stat(name string, e entry) (*fileInfo, error) {
+	if e.dir != nil {
+		return &fileInfo{name: name, inode: decodeInode(e.dir.Get(metaKey))}, nil
+	}
+	n, err := t.inode(e.id)
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: name, inode: n}, nil
+}
+
+// readDir returns the entries of the bucket dir, sorted by name.
+func (t *txn) readDir(dir *bolt.Bucket) ([]wrfs.DirEntry, error) {
+	var entries []wrfs.DirEntry
+	err := dir.ForEach(func(k, _ []byte) error {
+		if string(k) == string(metaKey) {
+			return nil
+		}
+		e, _ := t.child(dir, string(k))
+		fi, err := t.stat(string(k), e)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, fi)
+		return nil
+	})
+	return entries, err
+}
+
+// removeInode removes the inode with number id and the chunks of its contents.
+func (t *txn) removeInode(id uint64) error {
+	if err := t.deleteChunks(id, 0); err != nil {
+		return err
+	}
+	return t.inodes.Delete(idKey(id))
+}
+
+// removeInodes removes the inodes of the files in the bucket dir and its subdirectories.
+func (t *txn) removeInodes(dir *bolt.Bucket) error {
+	return dir.ForEach(func(k, v []byte) error {
+		switch {
+		case v == nil:
+			return t.removeInodes(dir.Bucket(k))
+		case len(v) == 8:
+			return t.removeInode(binary.BigEndian.Uint64(v))
+		}
+		return nil
+	})
+}
+
+// deleteChunks deletes the chunks of the inode with number id from the given index on.
+func (t *txn) deleteChunks(id uint64, from int64) error {
+	prefix := idKey(id)
+	var keys [][]byte
+	c := t.chunks.Cursor()
+	for k, _ := c.Seek(chunkKey(id, from)); k != nil && string(k[:8]) == string(prefix); k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	for _, k := range keys {
+		if err := t.chunks.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncate changes the size of the file of the inode n with number id.
+func (t *txn) truncate(id uint64, n inode, size int64) error {
+	if size < n.size {
+		if err := t.deleteChunks(id, (size+chunkSize-1)/chunkSize); err != nil {
+			return err
+		}
+		if rest := size % chunkSize; rest != 0 {
+			key := chunkKey(id, size/chunkSize)
+			if chunk := t.chunks.Get(key); int64(len(chunk)) > rest {
+				if err := t.chunks.Put(key, append([]byte(nil), chunk[:rest]...)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	n.size = size
+	n.modTime = time.Now()
+	return t.inodes.Put(idKey(id), n.encode())
+}
+
+// readAt reads from the file of the inode n with number id at offset off, returning the number of bytes read,
+// which is less than len(p) at the end of the file. Missing parts of chunks read as zeros.
+func (t *txn) readAt(id uint64, n inode, p []byte, off int64) int {
+	read := 0
+	for len(p) > 0 && off < n.size {
+		within := off % chunkSize
+		m := int64(len(p))
+		m = min(m, chunkSize-within, n.size-off)
+		chunk := t.chunks.Get(chunkKey(id, off/chunkSize))
+		copied := 0
+		if within < int64(len(chunk)) {
+			copied = copy(p[:m], chunk[within:])
+		}
+		clear(p[copied:m])
+		p, off, read = p[m:], off+m, read+int(m)
+	}
+	return read
+}
+
+// writeAt writes p to the file of the inode n with number id at offset off, extending it if needed.
+func (t *txn) writeAt(id uint64, n inode, p []byte, off int64) error {
+	end := off + int64(len(p))
+	for len(p) > 0 {
+		key := chunkKey(id, off/chunkSize)
+		within := off % chunkSize
+		m := min(int64(len(p)), chunkSize-within)
+		old := t.chunks.Get(key)
+		chunk := make([]byte, max(int64(len(old)), within+m))
+		copy(chunk, old)
+		copy(chunk[within:], p[:m])
+		if err := t.chunks.Put(key, chunk); err != nil {
+			return err
+		}
+		p, off = p[m:], off+m
+	}
+	n.size = max(n.size, end)
+	n.modTime = time.Now()
+	return t.inodes.Put(idKey(id), n.encode())
+}
@@ -0,0 +1,164 @@
+package wrfs
+
+import "strings"
+
+// A CapSet is a set of capabilities of a file system. Each capability corresponds to an extension interface.
+type CapSet uint64
+
+const (
+	CapOpenFile CapSet = 1 << iota // OpenFileFS
+	CapMkdir                       // MkdirFS
+	CapRemove                      // RemoveFS
+	CapRename                      // RenameFS
+	CapSymlink                     // SymlinkFS
+	CapReadlink                    // ReadlinkFS
+	CapLink                        // LinkFS
+	CapLstat                       // LstatFS
+	CapSameFile                    // SameFileFS
+	CapChmod                       // ChmodFS
+	CapChown                       // ChownFS
+	CapLchown                      // LchownFS
+	CapChtimes                     // ChtimesFS
+	CapTruncate                    // TruncateFS
+	CapSync                        // SyncFS
+	CapStatfs                      // StatfsFS
+	CapLock                        // LockFS
+	CapWatch                       // WatchFS
+	CapMkfifo                      // MkfifoFS
+	CapMknod                       // MknodFS
+	CapLchtimes                    // LchtimesFS
+	CapSyncDir                     // SyncDirFS
+)
+
+var capNames = []string{
+	"openfile",
+	"mkdir",
+	"remove",
+	"rename",
+	"symlink",
+	"readlink",
+	"link",
+	"lstat",
+	"samefile",
+	"chmod",
+	"chown",
+	"lchown",
+	"chtimes",
+	"truncate",
+	"sync",
+	"statfs",
+	"lock",
+	"watch",
+	"mkfifo",
+	"mknod",
+	"lchtimes",
+	"syncdir",
+}
+
+// Has reports whether s contains all capabilities in c.
+func (s CapSet) Has(c CapSet) bool {
+	return s&c == c
+}
+
+func (s CapSet) String() string {
+	var names []string
+	for i, name := range capNames {
+		if s&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// CapabilityFS is a file system that reports its capabilities explicitly.
+// Wrappers and remote file systems implement it when the methods they implement
+// do not reflect what the underlying file system supports.
+type CapabilityFS interface {
+	FS
+
+	// Capabilities returns the capabilities of the file system.
+	Capabilities() CapSet
+}
+
+// Capabilities returns the capabilities of fsys.
+//
+// If fsys implements CapabilityFS, Capabilities calls fsys.Capabilities.
+// Otherwise Capabilities reports the extension interfaces implemented by fsys.
+// Note that some helpers can also perform an operation through the methods of open files,
+// for example Chmod through ChmodFile, so an operation may succeed even if its capability is missing.
+func Capabilities(fsys FS) CapSet {
+	if fsys, ok := fsys.(CapabilityFS); ok {
+		return fsys.Capabilities()
+	}
+	var s CapSet
+	if _, ok := fsys.(OpenFileFS); ok {
+		s |= CapOpenFile
+	}
+	if _, ok := fsys.(MkdirFS); ok {
+		s |= CapMkdir
+	}
+	if _, ok := fsys.(RemoveFS); ok {
+		s |= CapRemove
+	}
+	if _, ok := fsys.(RenameFS); ok {
+		s |= CapRename
+	}
+	if _, ok := fsys.(SymlinkFS); ok {
+		s |= CapSymlink
+	}
+	if _, ok := fsys.(ReadlinkFS); ok {
+		s |= CapReadlink
+	}
+	if _, ok := fsys.(LinkFS); ok {
+		s |= CapLink
+	}
+	if _, ok := fsys.(LstatFS); ok {
+		s |= CapLstat
+	}
+	if _, ok := fsys.(SameFileFS); ok {
+		s |= CapSameFile
+	}
+	if _, ok := fsys.(ChmodFS); ok {
+		s |= CapChmod
+	}
+	if _, ok := fsys.(ChownFS); ok {
+		s |= CapChown
+	}
+	if _, ok := fsys.(LchownFS); ok {
+		s |= CapLchown
+	}
+	if _, ok := fsys.(ChtimesFS); ok {
+		s |= CapChtimes
+	}
+	if _, ok := fsys.(TruncateFS); ok {
+		s |= CapTruncate
+	}
+	if _, ok := fsys.(SyncFS); ok {
+		s |= CapSync
+	}
+	if _, ok := fsys.(StatfsFS); ok {
+		s |= CapStatfs
+	}
+	if _, ok := fsys.(LockFS); ok {
+		s |= CapLock
+	}
+	if _, ok := fsys.(WatchFS); ok {
+		s |= CapWatch
+	}
+	if _, ok := fsys.(MkfifoFS); ok {
+		s |= CapMkfifo
+	}
+	if _, ok := fsys.(MknodFS); ok {
+		s |= CapMknod
+	}
+	if _, ok := fsys.(LchtimesFS); ok {
+		s |= CapLchtimes
+	}
+	if _, ok := fsys.(SyncDirFS); ok {
+		s |= CapSyncDir
+	}
+	return s
+}
@@ -0,0 +1,25 @@
+package wrfs_test
+
+import (
+	"testing"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+)
+
+func TestCapabilities(t *testing.T) {
+	fsys := memfs.New()
+	caps := Capabilities(fsys)
+	if want := CapOpenFile | CapMkdir | CapSymlink | CapChown; !caps.Has(want) {
+		t.Errorf("Capabilities(memfs) = %v, want at least %v", caps, want)
+	}
+	if caps.Has(CapWatch) {
+		t.Errorf("Capabilities(memfs) = %v, want no %v", caps, CapWatch)
+	}
+	if caps := Capabilities(ReadOnly(fsys)); caps.Has(CapOpenFile) || !caps.Has(CapReadlink) {
+		t.Errorf("Capabilities(ReadOnly(memfs)) = %v, want readlink but not openfile", caps)
+	}
+	if caps := Capabilities(WithStats(noRename{FS: fsys}, NewStatsCollector(0))); caps.Has(CapRename) {
+		t.Errorf("Capabilities(WithStats(noRename)) = %v, want no rename", caps)
+	}
+}
@@ -0,0 +1,189 @@
+package wrfs
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"time"
+)
+
+// CaseInsensitive returns a file system that looks up the names of fsys case-insensitively, as the default file
+// systems of macOS and Windows do, so that code behaves the same on case-sensitive file systems. Each path element
+// that does not exist with the given case refers to the entry of its directory whose name equals it under Unicode
+// case folding. Creating a file or directory whose name differs from an existing one only in case therefore
+// refers to the existing one, failing with ErrExist where creating an existing file would, while Rename can change
+// the case of a name. Names are reported with the case they have in fsys, and Glob patterns match case-sensitively.
+//
+// If fsys holds several names that differ only in case, the exact one is used, or else the first one listed.
+func CaseInsensitive(fsys FS) FS {
+	return &caseFS{fsWrapper{fsys}}
+}
+
+type caseFS struct {
+	fsWrapper
+}
+
+// resolve returns the name in fsys that name refers to, leaving elements that do not exist as they are.
+func (c *caseFS) resolve(name string) string {
+	if name == "." || !ValidPath(name) {
+		return name
+	}
+	if _, err := Lstat(c.fsys, name); err == nil {
+		return name
+	}
+	resolved := "."
+	for _, elem := range strings.Split(name, "/") {
+		next := path.Join(resolved, elem)
+		if _, err := Lstat(c.fsys, next); err != nil {
+			entries, _ := ReadDir(c.fsys, resolved)
+			for _, entry := range entries {
+				if strings.EqualFold(entry.Name(), elem) {
+					next = path.Join(resolved, entry.Name())
+					break
+				}
+			}
+		}
+		resolved = next
+	}
+	return resolved
+}
+
+// action performs fn with the resolved name, reporting errors with the given name.
+func (c *caseFS) action(name string, fn func(fsys FS, name string) error) error {
+	resolved := c.resolve(name)
+	err := fn(c.fsys, resolved)
+	var pathErr *PathError
+	if errors.As(err, &pathErr) && pathErr.Path == resolved {
+		pathErr.Path = name
+	}
+	return err
+}
+
+func (c *caseFS) Open(name string) (file File, err error) {
+	err = c.action(name, func(fsys FS, name string) (err error) {
+		file, err = fsys.Open(name)
+		return err
+	})
+	return file, err
+}
+
+func (c *caseFS) Stat(name string) (fi FileInfo, err error) {
+	err = c.action(name, func(fsys FS, name string) (err error) {
+		fi, err = Stat(fsys, name)
+		return err
+	})
+	return fi, err
+}
+
+func (c *caseFS) Lstat(name string) (fi FileInfo, err error) {
+	err = c.action(name, func(fsys FS, name string) (err error) {
+		fi, err = Lstat(fsys, name)
+		return err
+	})
+	return fi, err
+}
+
+func (c *caseFS) ReadDir(name string) (entries []DirEntry, err error) {
+	err = c.action(name, func(fsys FS, name string) (err error) {
+		entries, err = ReadDir(fsys, name)
+		return err
+	})
+	return entries, err
+}
+
+func (c *caseFS) Readlink(name string) (target string, err error) {
+	err = c.action(name, func(fsys FS, name string) (err error) {
+		target, err = Readlink(fsys, name)
+		return err
+	})
+	return target, err
+}
+
+func (c *caseFS) OpenFile(name string, flag int, perm FileMode) (file File, err error) {
+	err = c.action(name, func(fsys FS, name string) (err error) {
+		file, err = OpenFile(fsys, name, flag, perm)
+		return err
+	})
+	return file, err
+}
+
+func (c *caseFS) Chmod(name string, mode FileMode) error {
+	return c.action(name, func(fsys FS, name string) error { return Chmod(fsys, name, mode) })
+}
+
+func (c *caseFS) Chown(name string, uid, gid int) error {
+	return c.action(name, func(fsys FS, name string) error { return Chown(fsys, name, uid, gid) })
+}
+
+func (c *caseFS) Lchown(name string, uid, gid int) error {
+	return c.action(name, func(fsys FS, name string) error { return Lchown(fsys, name, uid, gid) })
+}
+
+func (c *caseFS) Chtimes(name string, atime, mtime time.Time) error {
+	return c.action(name, func(fsys FS, name string) error { return Chtimes(fsys, name, atime, mtime) })
+}
+
+func (c *caseFS) Mkdir(name string, perm FileMode) error {
+	return c.action(name, func(fsys FS, name string) error { return Mkdir(fsys, name, perm) })
+}
+
+func (c *caseFS) MkdirAll(path string, perm FileMode) error {
+	return c.action(path, func(fsys FS, path string) error { return MkdirAll(fsys, path, perm) })
+}
+
+func (c *caseFS) Remove(name string) error {
+	return c.action(name, Remove)
+}
+
+func (c *caseFS) RemoveAll(path string) error {
+	return c.action(path, RemoveAll)
+}
+
+// Rename renames oldpath to newpath. If both refer to the same file, it gives it the case of newpath.
+func (c *caseFS) Rename(oldpath, newpath string) error {
+	oldResolved, newResolved := c.resolve(oldpath), c.resolve(newpath)
+	if oldResolved == newResolved && newpath != "." {
+		newResolved = path.Join(path.Dir(newResolved), path.Base(newpath))
+	}
+	return Rename(c.fsys, oldResolved, newResolved)
+}
+
+func (c *caseFS) Symlink(oldname, newname string) error {
+	return Symlink(c.fsys, oldname, c.resolve(newname))
+}
+
+func (c *caseFS) Link(oldname, newname string) error {
+	return Link(c.fsys, c.resolve(oldname), c.resolve(newname))
+}
+
+func (c *caseFS) Truncate(name string, size int64) error {
+	return c.action(name, func(fsys FS, name string) error { return Truncate(fsys, name, size) })
+}
+
+func (c *caseFS) Sync(name string) error {
+	return c.action(name, Sync)
+}
+
+func (c *caseFS) SyncDir(dir string) error {
+	return c.action(dir, SyncDir)
+}
+
+func (c *caseFS) Statfs(name string) (info FSInfo, err error) {
+	err = c.action(name, func(fsys FS, name string) (err error) {
+		info, err = Statfs(fsys, name)
+		return err
+	})
+	return info, err
+}
+
+func (c *caseFS) OpenLock(name string) (file LockFile, err error) {
+	err = c.action(name, func(fsys FS, name string) (err error) {
+		file, err = OpenLock(fsys, name)
+		return err
+	})
+	return file, err
+}
+
+func (c *caseFS) Watch(name string, opts ...WatchOption) (<-chan Event, func(), error) {
+	return Watch(c.fsys, c.resolve(name), opts...)
+}
@@ -0,0 +1,36 @@
+package wrfs_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestCaseInsensitive(t *testing.T) {
+	lower := newLowerFS(t)
+	fsys := CaseInsensitive(lower)
+	checkContents(t, fsys, "DIR/Sub/FILE", "lower")
+	check(t, WriteFile(fsys, "Dir/FILE", []byte("upper"), 0644))
+	checkContents(t, lower, "dir/file", "upper")
+	if err := Mkdir(fsys, "DIR/SUB", 0755); !errors.Is(err, ErrExist) {
+		t.Errorf("Mkdir of name differing in case: got %v, want ErrExist", err)
+	}
+	if _, err := OpenFile(fsys, "dir/File", O_RDWR|O_CREATE|O_EXCL, 0644); !errors.Is(err, ErrExist) {
+		t.Errorf("exclusive create of name differing in case: got %v, want ErrExist", err)
+	}
+	check(t, Rename(fsys, "dir/file", "DIR/File"))
+	entries, err := ReadDir(fsys, "dir")
+	check(t, err)
+	if len(entries) != 2 || entries[0].Name() != "File" {
+		t.Errorf("ReadDir(dir) = %v, want File and sub", entries)
+	}
+	check(t, RemoveAll(fsys, "DIR/SUB"))
+	if _, err := Stat(lower, "dir/sub"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("RemoveAll(DIR/SUB) left dir/sub: %v", err)
+	}
+	if _, err := Stat(fsys, "dir/Missing"); err == nil || !strings.Contains(err.Error(), "dir/Missing") {
+		t.Errorf("Stat(dir/Missing): got %v, want error naming dir/Missing", err)
+	}
+}
@@ -0,0 +1,270 @@
+package wrfs
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrInjected is the default error returned by operations that fail due to a fault injected by WithChaos.
+var ErrInjected = errors.New("injected fault")
+
+// A Fault describes the latency and failures injected into an operation.
+type Fault struct {
+	Latency     time.Duration // delay added to every call
+	Jitter      time.Duration // maximum additional random delay
+	FailureRate float64       // probability that a call fails, between 0 and 1
+	Err         error         // error wrapped by failing calls; ErrInjected if nil
+}
+
+// ChaosConfig configures the faults injected by WithChaos.
+type ChaosConfig struct {
+	// Default is the fault injected into operations that have no entry in Ops.
+	Default Fault
+
+	// Ops holds the fault injected into each operation, keyed by operation name.
+	// The names are those reported by WithStats, such as "open", "stat", "readdir" and "rename".
+	Ops map[string]Fault
+
+	// Seed seeds the random source used for jitter and failures, making runs reproducible.
+	Seed int64
+}
+
+// WithChaos returns a file system that injects latency, jitter and random failures into the operations of fsys,
+// as described by config. It is useful for testing code against slow or unreliable backends.
+// Failing operations do not reach fsys, and return a *PathError or *LinkError wrapping the fault's error.
+// Faults are injected into file system operations only, not into reads and writes of open files.
+func WithChaos(fsys FS, config ChaosConfig) FS {
+	return &chaosFS{fsWrapper: fsWrapper{fsys}, config: config, rnd: rand.New(rand.NewSource(config.Seed))}
+}
+
+type chaosFS struct {
+	fsWrapper
+	config ChaosConfig
+
+	mu  sync.Mutex // guards rnd
+	rnd *rand.Rand
+}
+
+// fault sleeps for the latency of op and reports whether op should fail, returning the error to wrap.
+func (c *chaosFS) fault(op string) error {
+	f, ok := c.config.Ops[op]
+	if !ok {
+		f = c.config.Default
+	}
+	c.mu.Lock()
+	var jitter time.Duration
+	if f.Jitter > 0 {
+		jitter = time.Duration(c.rnd.Int63n(int64(f.Jitter)))
+	}
+	fail := f.FailureRate > 0 && c.rnd.Float64() < f.FailureRate
+	c.mu.Unlock()
+
+	if d := f.Latency + jitter; d > 0 {
+		time.Sleep(d)
+	}
+	if !fail {
+		return nil
+	}
+	if f.Err != nil {
+		return f.Err
+	}
+	return ErrInjected
+}
+
+func (c *chaosFS) inject(op, name string) error {
+	if err := c.fault(op); err != nil {
+		return &PathError{Op: op, Path: name, Err: err}
+	}
+	return nil
+}
+
+func (c *chaosFS) injectLink(op, oldname, newname string) error {
+	if err := c.fault(op); err != nil {
+		return &LinkError{Op: op, Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+func (c *chaosFS) Open(name string) (File, error) {
+	if err := c.inject("open", name); err != nil {
+		return nil, err
+	}
+	return c.fsys.Open(name)
+}
+
+func (c *chaosFS) Stat(name string) (FileInfo, error) {
+	if err := c.inject("stat", name); err != nil {
+		return nil, err
+	}
+	return Stat(c.fsys, name)
+}
+
+func (c *chaosFS) Lstat(name string) (FileInfo, error) {
+	if err := c.inject("lstat", name); err != nil {
+		return nil, err
+	}
+	return Lstat(c.fsys, name)
+}
+
+func (c *chaosFS) ReadDir(name string) ([]DirEntry, error) {
+	if err := c.inject("readdir", name); err != nil {
+		return nil, err
+	}
+	return ReadDir(c.fsys, name)
+}
+
+func (c *chaosFS) ReadFile(name string) ([]byte, error) {
+	if err := c.inject("readfile", name); err != nil {
+		return nil, err
+	}
+	return ReadFile(c.fsys, name)
+}
+
+func (c *chaosFS) Glob(pattern string) ([]string, error) {
+	if err := c.inject("glob", pattern); err != nil {
+		return nil, err
+	}
+	return Glob(c.fsys, pattern)
+}
+
+func (c *chaosFS) OpenFile(name string, flag int, perm FileMode) (File, error) {
+	if err := c.inject("openfile", name); err != nil {
+		return nil, err
+	}
+	return OpenFile(c.fsys, name, flag, perm)
+}
+
+func (c *chaosFS) WriteFile(name string, data []byte, perm FileMode) error {
+	if err := c.inject("writefile", name); err != nil {
+		return err
+	}
+	return WriteFile(c.fsys, name, data, perm)
+}
+
+func (c *chaosFS) Chmod(name string, mode FileMode) error {
+	if err := c.inject("chmod", name); err != nil {
+		return err
+	}
+	return Chmod(c.fsys, name, mode)
+}
+
+func (c *chaosFS) Chown(name string, uid, gid int) error {
+	if err := c.inject("chown", name); err != nil {
+		return err
+	}
+	return Chown(c.fsys, name, uid, gid)
+}
+
+func (c *chaosFS) Lchown(name string, uid, gid int) error {
+	if err := c.inject("lchown", name); err != nil {
+		return err
+	}
+	return Lchown(c.fsys, name, uid, gid)
+}
+
+func (c *chaosFS) Chtimes(name string, atime, mtime time.Time) error {
+	if err := c.inject("chtimes", name); err != nil {
+		return err
+	}
+	return Chtimes(c.fsys, name, atime, mtime)
+}
+
+func (c *chaosFS) Mkdir(name string, perm FileMode) error {
+	if err := c.inject("mkdir", name); err != nil {
+		return err
+	}
+	return Mkdir(c.fsys, name, perm)
+}
+
+func (c *chaosFS) MkdirAll(path string, perm FileMode) error {
+	if err := c.inject("mkdirall", path); err != nil {
+		return err
+	}
+	return MkdirAll(c.fsys, path, perm)
+}
+
+func (c *chaosFS) Readlink(name string) (string, error) {
+	if err := c.inject("readlink", name); err != nil {
+		return "", err
+	}
+	return Readlink(c.fsys, name)
+}
+
+func (c *chaosFS) Remove(name string) error {
+	if err := c.inject("remove", name); err != nil {
+		return err
+	}
+	return Remove(c.fsys, name)
+}
+
+func (c *chaosFS) RemoveAll(path string) error {
+	if err := c.inject("removeall", path); err != nil {
+		return err
+	}
+	return RemoveAll(c.fsys, path)
+}
+
+func (c *chaosFS) Rename(oldpath, newpath string) error {
+	if err := c.injectLink("rename", oldpath, newpath); err != nil {
+		return err
+	}
+	return Rename(c.fsys, oldpath, newpath)
+}
+
+func (c *chaosFS) Symlink(oldname, newname string) error {
+	if err := c.injectLink("symlink", oldname, newname); err != nil {
+		return err
+	}
+	return Symlink(c.fsys, oldname, newname)
+}
+
+func (c *chaosFS) Link(oldname, newname string) error {
+	if err := c.injectLink("link", oldname, newname); err != nil {
+		return err
+	}
+	return Link(c.fsys, oldname, newname)
+}
+
+func (c *chaosFS) Sync(name string) error {
+	if err := c.inject("sync", name); err != nil {
+		return err
+	}
+	return Sync(c.fsys, name)
+}
+
+func (c *chaosFS) SyncDir(dir string) error {
+	if err := c.inject("syncdir", dir); err != nil {
+		return err
+	}
+	return SyncDir(c.fsys, dir)
+}
+
+func (c *chaosFS) Statfs(name string) (FSInfo, error) {
+	if err := c.inject("statfs", name); err != nil {
+		return FSInfo{}, err
+	}
+	return Statfs(c.fsys, name)
+}
+
+func (c *chaosFS) OpenLock(name string) (LockFile, error) {
+	if err := c.inject("openlock", name); err != nil {
+		return nil, err
+	}
+	return OpenLock(c.fsys, name)
+}
+
+func (c *chaosFS) Watch(name string, opts ...WatchOption) (<-chan Event, func(), error) {
+	if err := c.inject("watch", name); err != nil {
+		return nil, nil, err
+	}
+	return Watch(c.fsys, name, opts...)
+}
+
+func (c *chaosFS) Truncate(name string, size int64) error {
+	if err := c.inject("truncate", name); err != nil {
+		return err
+	}
+	return Truncate(c.fsys, name, size)
+}
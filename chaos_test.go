@@ -0,0 +1,33 @@
+package wrfs_test
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestWithChaos(t *testing.T) {
+	fsys := WithChaos(newLowerFS(t), ChaosConfig{
+		Ops: map[string]Fault{
+			"stat":   {FailureRate: 1},
+			"rename": {FailureRate: 1, Err: syscall.EIO},
+			"open":   {Latency: 10 * time.Millisecond},
+		},
+	})
+	if _, err := Stat(fsys, "dir/file"); !errors.Is(err, ErrInjected) {
+		t.Errorf("Stat: got %v, want ErrInjected", err)
+	}
+	if err := Rename(fsys, "dir/file", "dir/new"); !errors.Is(err, syscall.EIO) {
+		t.Errorf("Rename: got %v, want EIO", err)
+	}
+	start := time.Now()
+	file, err := fsys.Open("dir/file")
+	check(t, err)
+	check(t, file.Close())
+	if d := time.Since(start); d < 10*time.Millisecond {
+		t.Errorf("Open took %v, want at least 10ms", d)
+	}
+}
@@ -0,0 +1,448 @@
+package wrfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrCorrupt is returned when data read from a file does not match its recorded checksums.
+var ErrCorrupt = errors.New("checksum mismatch")
+
+// CorruptionError records a checksum mismatch and the file and offset at which it was detected.
+type CorruptionError struct {
+	Path   string
+	Offset int64
+}
+
+func (e *CorruptionError) Error() string {
+	return "read " + e.Path + ": " + ErrCorrupt.Error() + " at offset " + strconv.FormatInt(e.Offset, 10)
+}
+
+func (e *CorruptionError) Unwrap() error { return ErrCorrupt }
+
+// DefaultChecksumBlockSize is the block size used by Checksummed when blockSize is not positive.
+const DefaultChecksumBlockSize = 64 << 10
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Checksummed returns a file system that records a CRC-32C checksum for every blockSize bytes of each file
+// written through it, and verifies these checksums on every read. A read that returns data not matching its
+// checksum fails with a *CorruptionError describing the path and the offset of the corrupt block.
+//
+// The checksums are stored in a hidden sidecar file next to each file, which is updated when a file opened for
+// writing is closed or the file is truncated. Sidecar files are hidden from ReadDir and Glob.
+// Files that have no sidecar, for example because they were written without the wrapper, are read unverified.
+// Reads through a file opened for writing are not verified.
+//
+// Since sidecars belong to names rather than to files, Link fails with ErrUnsupported, and so do writing and
+// truncating files through symbolic links, which would leave the sidecar of the other name stale.
+func Checksummed(fsys FS, blockSize int) FS {
+	if blockSize <= 0 {
+		blockSize = DefaultChecksumBlockSize
+	}
+	return &checksumFS{fsWrapper{fsys}, blockSize}
+}
+
+type checksumFS struct {
+	fsWrapper
+	blockSize int
+}
+
+// checksumName returns the name of the sidecar file that stores the checksums for name.
+func checksumName(name string) string {
+	dir, file := path.Split(name)
+	return dir + ".wrfs." + file + ".crc"
+}
+
+func isChecksumName(name string) bool {
+	name = path.Base(name)
+	return strings.HasPrefix(name, ".wrfs.") && strings.HasSuffix(name, ".crc")
+}
+
+func (c *checksumFS) Open(name string) (File, error) {
+	file, err := c.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.verify(name, file)
+}
+
+func (c *checksumFS) OpenFile(name string, flag int, perm FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_TRUNC) != 0 && c.isSymlink(name) {
+		return nil, &PathError{Op: "open", Path: name, Err: ErrUnsupported}
+	}
+	file, err := OpenFile(c.fsys, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_TRUNC) == 0 {
+		return c.verify(name, file)
+	}
+	return &updateWriter{File: file, name: name, update: c.updateChecksums}, nil
+}
+
+// OpenLock opens the named file for locking, verifying reads like Open.
+func (c *checksumFS) OpenLock(name string) (LockFile, error) {
+	file, err := OpenLock(c.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := c.verify(name, file)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := f.(*verifiedFile); ok {
+		return &lockingFile{f, file}, nil
+	}
+	return file, nil
+}
+
+// verify wraps file such that reads are checked against the checksums recorded for name.
+func (c *checksumFS) verify(name string, file File) (File, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if fi.IsDir() {
+		return hidingDir{file, isChecksumName}, nil
+	}
+	blockSize, sums, err := c.readChecksums(name)
+	if errors.Is(err, ErrNotExist) {
+		return file, nil
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &verifiedFile{File: file, name: name, blockSize: blockSize, sums: sums, blockOff: -1}, nil
+}
+
+func (c *checksumFS) readChecksums(name string) (blockSize int64, sums []uint32, err error) {
+	data, err := ReadFile(c.fsys, checksumName(name))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(data) < 4 || len(data)%4 != 0 {
+		return 0, nil, &CorruptionError{Path: checksumName(name)}
+	}
+	blockSize = int64(binary.BigEndian.Uint32(data))
+	if blockSize == 0 {
+		return 0, nil, &CorruptionError{Path: checksumName(name)}
+	}
+	for i := 4; i < len(data); i += 4 {
+		sums = append(sums, binary.BigEndian.Uint32(data[i:]))
+	}
+	return blockSize, sums, nil
+}
+
+// updateChecksums recomputes the checksums of name and stores them in its sidecar file.
+func (c *checksumFS) updateChecksums(name string) (err error) {
+	file, err := c.fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer safeClose(file, &err)
+
+	data := make([]byte, 4, 4+4*16)
+	binary.BigEndian.PutUint32(data, uint32(c.blockSize))
+	block := make([]byte, c.blockSize)
+	var sum [4]byte
+	for {
+		n, err := io.ReadFull(file, block)
+		if n > 0 {
+			binary.BigEndian.PutUint32(sum[:], crc32.Checksum(block[:n], castagnoli))
+			data = append(data, sum[:]...)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	sidecar, err := OpenFile(c.fsys, checksumName(name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer safeClose(sidecar, &err)
+	_, err = Write(sidecar, data)
+	return err
+}
+
+// isSymlink reports whether name is a symbolic link.
+func (c *checksumFS) isSymlink(name string) bool {
+	fi, err := Lstat(c.fsys, name)
+	return err == nil && fi.Mode()&ModeSymlink != 0
+}
+
+// removeChecksums removes the sidecar file of name, if there is one.
+func (c *checksumFS) removeChecksums(name string) error {
+	err := Remove(c.fsys, checksumName(name))
+	if errors.Is(err, ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (c *checksumFS) ReadDir(name string) ([]DirEntry, error) {
+	entries, err := ReadDir(c.fsys, name)
+	return filterEntries(entries, isChecksumName), err
+}
+
+func (c *checksumFS) Glob(pattern string) ([]string, error) {
+	matches, err := Glob(c.fsys, pattern)
+	filtered := matches[:0]
+	for _, match := range matches {
+		if !isChecksumName(match) {
+			filtered = append(filtered, match)
+		}
+	}
+	return filtered, err
+}
+
+func (c *checksumFS) Remove(name string) error {
+	if err := Remove(c.fsys, name); err != nil {
+		return err
+	}
+	return c.removeChecksums(name)
+}
+
+func (c *checksumFS) RemoveAll(name string) error {
+	if err := RemoveAll(c.fsys, name); err != nil {
+		return err
+	}
+	return c.removeChecksums(name)
+}
+
+func (c *checksumFS) Rename(oldpath, newpath string) error {
+	if err := Rename(c.fsys, oldpath, newpath); err != nil {
+		return err
+	}
+	err := Rename(c.fsys, checksumName(oldpath), checksumName(newpath))
+	if errors.Is(err, ErrNotExist) {
+		// oldpath was not checksummed, so neither is newpath.
+		return c.removeChecksums(newpath)
+	}
+	return err
+}
+
+// Capabilities reports the capabilities of the wrapped file system, except for Link.
+func (c *checksumFS) Capabilities() CapSet {
+	return c.fsWrapper.Capabilities() &^ CapLink
+}
+
+func (c *checksumFS) Link(oldname, newname string) error {
+	return &LinkError{Op: "link", Old: oldname, New: newname, Err: ErrUnsupported}
+}
+
+func (c *checksumFS) Truncate(name string, size int64) error {
+	if c.isSymlink(name) {
+		return &PathError{Op: "truncate", Path: name, Err: ErrUnsupported}
+	}
+	if err := Truncate(c.fsys, name, size); err != nil {
+		return err
+	}
+	return c.updateChecksums(name)
+}
+
+func (c *checksumFS) Watch(name string, opts ...WatchOption) (<-chan Event, func(), error) {
+	events, stop, err := Watch(c.fsys, name, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	events, stop = mapEvents(events, stop, NewWatchConfig(opts...).Buffer, func(name string) (string, bool) {
+		return name, !isChecksumName(name)
+	})
+	return events, stop, nil
+}
+
+// filterEntries removes the entries whose names hide reports true for.
+func filterEntries(entries []DirEntry, hide func(name string) bool) []DirEntry {
+	filtered := entries[:0]
+	for _, entry := range entries {
+		if !hide(entry.Name()) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+
+// hidingDir is a directory that hides the entries whose names hide reports true for,
+// such as checksum sidecar files.
+type hidingDir struct {
+	File
+	hide func(name string) bool
+}
+
+func (d hidingDir) ReadDir(n int) ([]DirEntry, error) {
+	dir, ok := d.File.(ReadDirFile)
+	if !ok {
+		return nil, &PathError{Op: "readdir", Path: ".", Err: ErrUnsupported}
+	}
+	for {
+		entries, err := dir.ReadDir(n)
+		entries = filterEntries(entries, d.hide)
+		if len(entries) > 0 || err != nil || n <= 0 {
+			return entries, err
+		}
+	}
+}
+
+// verifiedFile is a file whose contents are verified block by block as they are read.
+// It reads whole blocks from the underlying file, using ReadAt if possible and Seek otherwise.
+type verifiedFile struct {
+	File
+	name      string
+	blockSize int64
+	sums      []uint32
+	off       int64  // offset of the next Read
+	pos       int64  // offset of the underlying file
+	block     []byte // the most recently verified block
+	blockOff  int64  // offset of block, or -1 if no block has been read
+}
+
+func (f *verifiedFile) Read(p []byte) (int, error) {
+	n, err := f.readAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *verifiedFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &PathError{Op: "readat", Path: f.name, Err: ErrInvalid}
+	}
+	return f.readAt(p, off)
+}
+
+func (f *verifiedFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		fi, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		offset += fi.Size()
+	}
+	if offset < 0 {
+		return 0, &PathError{Op: "seek", Path: f.name, Err: ErrInvalid}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *verifiedFile) readAt(p []byte, off int64) (n int, err error) {
+	for n < len(p) {
+		pos := off + int64(n)
+		blockOff := pos - pos%f.blockSize
+		block, err := f.loadBlock(blockOff)
+		if err != nil {
+			return n, err
+		}
+		if pos-blockOff >= int64(len(block)) {
+			return n, io.EOF
+		}
+		n += copy(p[n:], block[pos-blockOff:])
+	}
+	return n, nil
+}
+
+// loadBlock reads and verifies the block starting at off.
+func (f *verifiedFile) loadBlock(off int64) ([]byte, error) {
+	if f.blockOff == off {
+		return f.block, nil
+	}
+	if f.block == nil {
+		f.block = make([]byte, f.blockSize)
+	}
+	block := f.block[:f.blockSize]
+
+	var n int
+	var err error
+	if r, ok := f.File.(io.ReaderAt); ok {
+		n, err = r.ReadAt(block, off)
+	} else {
+		if f.pos != off {
+			if f.pos, err = Seek(f.File, off, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		n, err = io.ReadFull(f.File, block)
+		f.pos += int64(n)
+	}
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	block = block[:n]
+
+	i := off / f.blockSize
+	if i >= int64(len(f.sums)) {
+		if n > 0 {
+			return nil, &CorruptionError{Path: f.name, Offset: off}
+		}
+	} else if n == 0 || crc32.Checksum(block, castagnoli) != f.sums[i] {
+		return nil, &CorruptionError{Path: f.name, Offset: off}
+	}
+	f.block, f.blockOff = block, off
+	return block, nil
+}
+
+// updateWriter is a file opened for writing that calls update with its name when it is closed,
+// such as to update its checksums.
+type updateWriter struct {
+	File
+	name   string
+	update func(name string) error
+}
+
+func (w *updateWriter) Write(p []byte) (int, error) {
+	return Write(w.File, p)
+}
+
+func (w *updateWriter) Seek(offset int64, whence int) (int64, error) {
+	return Seek(w.File, offset, whence)
+}
+
+func (w *updateWriter) ReadAt(p []byte, off int64) (int, error) {
+	if r, ok := w.File.(io.ReaderAt); ok {
+		return r.ReadAt(p, off)
+	}
+	return 0, &PathError{Op: "readat", Path: w.name, Err: ErrUnsupported}
+}
+
+func (w *updateWriter) WriteAt(p []byte, off int64) (int, error) {
+	if wr, ok := w.File.(io.WriterAt); ok {
+		return wr.WriteAt(p, off)
+	}
+	return 0, &PathError{Op: "writeat", Path: w.name, Err: ErrUnsupported}
+}
+
+func (w *updateWriter) Truncate(size int64) error {
+	if file, ok := w.File.(TruncateFile); ok {
+		return file.Truncate(size)
+	}
+	return &PathError{Op: "truncate", Path: w.name, Err: ErrUnsupported}
+}
+
+func (w *updateWriter) Sync() error {
+	if file, ok := w.File.(SyncFile); ok {
+		return file.Sync()
+	}
+	return &PathError{Op: "sync", Path: w.name, Err: ErrUnsupported}
+}
+
+func (w *updateWriter) Close() error {
+	if err := w.File.Close(); err != nil {
+		return err
+	}
+	return w.update(w.name)
+}
@@ -0,0 +1,92 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wrfs_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestChecksummed(t *testing.T) {
+	inner := getFS(t)
+	fsys := Checksummed(inner, 16)
+	fileName := "TestChecksummed"
+	data := []byte("0123456789abcdef0123456789abcdef0123")
+
+	file, err := Create(fsys, fileName)
+	check(t, err)
+	_, err = file.Write(data)
+	check(t, err)
+	check(t, file.Close())
+
+	got, err := ReadFile(fsys, fileName)
+	check(t, err)
+	if string(got) != string(data) {
+		t.Fatalf("got: %q, want: %q", got, data)
+	}
+
+	entries, err := ReadDir(fsys, ".")
+	check(t, err)
+	if len(entries) != 1 || entries[0].Name() != fileName {
+		t.Errorf("checksum sidecar was not hidden: %v", entries)
+	}
+
+	// Corrupt the second block behind the wrapper's back.
+	raw, err := OpenFile(inner, fileName, os.O_WRONLY, 0)
+	check(t, err)
+	_, err = Seek(raw, 20, io.SeekStart)
+	check(t, err)
+	_, err = Write(raw, []byte("X"))
+	check(t, err)
+	check(t, raw.Close())
+
+	_, err = ReadFile(fsys, fileName)
+	var corruptErr *CorruptionError
+	if !errors.As(err, &corruptErr) {
+		t.Fatalf("expected a CorruptionError, got: %v", err)
+	}
+	if corruptErr.Offset != 16 {
+		t.Errorf("wrong offset: got: %d, want: %d", corruptErr.Offset, 16)
+	}
+
+	lockFile, err := Lock(fsys, fileName)
+	check(t, err)
+	if _, err := io.ReadAll(lockFile); !errors.As(err, &corruptErr) {
+		t.Errorf("reading a corrupt file opened with OpenLock: got %v, want a CorruptionError", err)
+	}
+	check(t, lockFile.Close())
+}
+
+func TestChecksummedLinks(t *testing.T) {
+	fsys := Checksummed(getFS(t), 16)
+	data := []byte("0123456789abcdef0123456789abcdef0123")
+	check(t, WriteFile(fsys, "file", data, 0644))
+
+	var linkErr *LinkError
+	if err := Link(fsys, "file", "hard"); !IsNotSupported(err) || !errors.As(err, &linkErr) {
+		t.Errorf("Link: got %v, want *LinkError matching ErrUnsupported", err)
+	}
+	if Capabilities(fsys).Has(CapLink) {
+		t.Errorf("Capabilities() = %v, want no link", Capabilities(fsys))
+	}
+
+	check(t, Symlink(fsys, "file", "link"))
+	if err := WriteFile(fsys, "link", []byte("changed"), 0644); !IsNotSupported(err) {
+		t.Errorf("WriteFile through a symbolic link: got %v, want ErrUnsupported", err)
+	}
+	if err := Truncate(fsys, "link", 0); !IsNotSupported(err) {
+		t.Errorf("Truncate through a symbolic link: got %v, want ErrUnsupported", err)
+	}
+	for _, name := range []string{"file", "link"} {
+		got, err := ReadFile(fsys, name)
+		check(t, err)
+		if string(got) != string(data) {
+			t.Errorf("%s: got %q, want %q", name, got, data)
+		}
+	}
+}
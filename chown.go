@@ -54,5 +54,5 @@ func Lchown(fsys FS, name string, uid, gid int) (err error) {
 	if fsys, ok := fsys.(LchownFS); ok {
 		return fsys.Lchown(name, uid, gid)
 	}
-	return &PathError{Op: "chown", Path: name, Err: ErrUnsupported}
+	return &PathError{Op: "lchown", Path: name, Err: ErrUnsupported}
 }
@@ -36,3 +36,35 @@ func Chtimes(fsys FS, name string, atime time.Time, mtime time.Time) (err error)
 	}
 	return &PathError{Op: "chtimes", Path: name, Err: ErrUnsupported}
 }
+
+// LchtimesFS is a file system with an Lchtimes method.
+type LchtimesFS interface {
+	FS
+
+	// Lchtimes changes the access and modification times of the named file.
+	// If the file is a symbolic link, it changes the times of the link itself.
+	Lchtimes(name string, atime time.Time, mtime time.Time) error
+}
+
+// Lchtimes changes the access and modification times of the named file.
+// If the file is a symbolic link, it changes the times of the link itself.
+//
+// If fsys does not implement LchtimesFS, Lchtimes calls Chtimes for files other than symbolic links, and fails
+// with ErrUnsupported for symbolic links.
+func Lchtimes(fsys FS, name string, atime time.Time, mtime time.Time) error {
+	if fsys, ok := fsys.(LchtimesFS); ok {
+		return fsys.Lchtimes(name, atime, mtime)
+	}
+	return lchtimes(fsys, name, atime, mtime)
+}
+
+func lchtimes(fsys FS, name string, atime time.Time, mtime time.Time) error {
+	fi, err := Lstat(fsys, name)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&ModeSymlink == 0 {
+		return Chtimes(fsys, name, atime, mtime)
+	}
+	return &PathError{Op: "lchtimes", Path: name, Err: ErrUnsupported}
+}
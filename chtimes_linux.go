@@ -0,0 +1,33 @@
+package wrfs
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	atSymlinkNofollow = 0x100
+	utimeOmit         = 1<<30 - 2 // leaves the time unchanged
+)
+
+func (hostFS) Lchtimes(name string, atime time.Time, mtime time.Time) error {
+	p, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return &PathError{Op: "lchtimes", Path: name, Err: err}
+	}
+	timespec := func(t time.Time) syscall.Timespec {
+		if t.IsZero() {
+			return syscall.Timespec{Nsec: utimeOmit}
+		}
+		return syscall.NsecToTimespec(t.UnixNano())
+	}
+	ts := [2]syscall.Timespec{timespec(atime), timespec(mtime)}
+	dirfd := atFDCWD
+	_, _, errno := syscall.Syscall6(syscall.SYS_UTIMENSAT, uintptr(dirfd), uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(&ts)), atSymlinkNofollow, 0, 0)
+	if errno != 0 {
+		return &PathError{Op: "lchtimes", Path: name, Err: errno}
+	}
+	return nil
+}
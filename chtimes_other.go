@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package wrfs
+
+import "time"
+
+// Without utimensat in the syscall package, the times of symbolic links cannot be changed.
+func (fsys hostFS) Lchtimes(name string, atime time.Time, mtime time.Time) error {
+	return lchtimes(fsys, name, atime, mtime)
+}
@@ -0,0 +1,36 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wrfs_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestLchtimes(t *testing.T) {
+	fsys := getFS(t)
+	newFile(t, fsys, "target")
+	check(t, Symlink(fsys, "target", "link"))
+	target, err := Stat(fsys, "target")
+	check(t, err)
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	err = Lchtimes(fsys, "link", time.Time{}, mtime)
+	if errors.Is(err, ErrUnsupported) {
+		t.Skip(err)
+	}
+	check(t, err)
+	fi, err := Lstat(fsys, "link")
+	check(t, err)
+	if !fi.ModTime().Equal(mtime) {
+		t.Errorf("Lstat(link).ModTime() = %v, want %v", fi.ModTime(), mtime)
+	}
+	fi, err = Stat(fsys, "target")
+	check(t, err)
+	if !fi.ModTime().Equal(target.ModTime()) {
+		t.Errorf("Lchtimes(link) changed the modification time of the target to %v", fi.ModTime())
+	}
+}
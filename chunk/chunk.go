@@ -0,0 +1,205 @@
+// Package chunk implements content-defined chunking of files in a wrfs file system.
+//
+// Chunk boundaries are found with a rolling gear hash, such that boundaries depend only on the
+// content near them. Inserting or removing bytes in a file therefore only changes the chunks
+// around the edit, which makes the chunks suitable for deduplication and delta transfer.
+package chunk
+
+import (
+	"errors"
+	"io"
+
+	"github.com/relab/wrfs"
+)
+
+// Default chunk sizes used when the corresponding Options field is zero.
+const (
+	DefaultMinSize = 2 << 10
+	DefaultAvgSize = 8 << 10
+	DefaultMaxSize = 64 << 10
+)
+
+// Options configures the chunk sizes. AvgSize is rounded down to a power of two.
+// Chunks are at least MinSize and at most MaxSize bytes, except for the last chunk,
+// which may be shorter than MinSize.
+type Options struct {
+	MinSize int
+	AvgSize int
+	MaxSize int
+}
+
+func (o Options) withDefaults() (Options, error) {
+	if o.MinSize == 0 {
+		o.MinSize = DefaultMinSize
+	}
+	if o.AvgSize == 0 {
+		o.AvgSize = DefaultAvgSize
+	}
+	if o.MaxSize == 0 {
+		o.MaxSize = DefaultMaxSize
+	}
+	if o.MinSize < 0 || o.MinSize > o.AvgSize || o.AvgSize > o.MaxSize {
+		return o, errors.New("chunk: sizes must satisfy 0 < MinSize <= AvgSize <= MaxSize")
+	}
+	return o, nil
+}
+
+// A Chunk is a contiguous range of the input.
+type Chunk struct {
+	Offset int64
+	Length int
+	// Data holds the contents of the chunk. It is only valid until the next call to Next.
+	Data []byte
+}
+
+// A Chunker splits a stream into content-defined chunks.
+type Chunker struct {
+	r      io.Reader
+	opts   Options
+	maskS  uint64 // mask used before AvgSize bytes; harder to match
+	maskL  uint64 // mask used after AvgSize bytes; easier to match
+	buf    []byte
+	start  int // start of unconsumed data in buf
+	end    int // end of valid data in buf
+	offset int64
+	err    error
+}
+
+// New returns a Chunker that reads from r.
+func New(r io.Reader, opts Options) (*Chunker, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	bits := 0
+	for 1<<(bits+1) <= opts.AvgSize {
+		bits++
+	}
+	return &Chunker{
+		r:     r,
+		opts:  opts,
+		maskS: highBits(bits + 1),
+		maskL: highBits(bits - 1),
+		buf:   make([]byte, 2*opts.MaxSize),
+	}, nil
+}
+
+// highBits returns a mask of the n most significant bits.
+// The gear hash mixes the most recent bytes into the high bits last, so they are the best distributed.
+func highBits(n int) uint64 {
+	if n <= 0 {
+		return 0
+	}
+	return ^uint64(0) << (64 - n)
+}
+
+// Next returns the next chunk. It returns io.EOF when there are no more chunks.
+func (c *Chunker) Next() (Chunk, error) {
+	if err := c.fill(); err != nil {
+		return Chunk{}, err
+	}
+	data := c.buf[c.start:c.end]
+	n := c.cut(data)
+	chunk := Chunk{Offset: c.offset, Length: n, Data: data[:n]}
+	c.start += n
+	c.offset += int64(n)
+	return chunk, nil
+}
+
+// fill makes sure that at least MaxSize bytes are buffered, or that the input is exhausted.
+func (c *Chunker) fill() error {
+	if c.end-c.start >= c.opts.MaxSize {
+		return nil
+	}
+	if c.start > 0 {
+		c.end = copy(c.buf, c.buf[c.start:c.end])
+		c.start = 0
+	}
+	for c.err == nil && c.end < len(c.buf) {
+		var n int
+		n, c.err = c.r.Read(c.buf[c.end:])
+		c.end += n
+	}
+	if c.end > c.start {
+		return nil
+	}
+	if c.err == io.EOF {
+		return io.EOF
+	}
+	return c.err
+}
+
+// cut returns the length of the first chunk of data.
+func (c *Chunker) cut(data []byte) int {
+	if len(data) <= c.opts.MinSize {
+		return len(data)
+	}
+	if len(data) > c.opts.MaxSize {
+		data = data[:c.opts.MaxSize]
+	}
+	avg := c.opts.AvgSize
+	if avg > len(data) {
+		avg = len(data)
+	}
+	var h uint64
+	i := c.opts.MinSize
+	for ; i < avg; i++ {
+		h = h<<1 + gear[data[i]]
+		if h&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < len(data); i++ {
+		h = h<<1 + gear[data[i]]
+		if h&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return len(data)
+}
+
+// Split reads the named file from fsys and calls fn for each of its chunks.
+// The Data of each chunk is only valid during the call to fn.
+func Split(fsys wrfs.FS, name string, opts Options, fn func(Chunk) error) (err error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	c, err := New(file, opts)
+	if err != nil {
+		return err
+	}
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(chunk); err != nil {
+			return err
+		}
+	}
+}
+
+// gear is a table of pseudo-random values, one for each byte value.
+// It is generated with a fixed seed, so that chunk boundaries are stable across releases.
+var gear [256]uint64
+
+func init() {
+	// splitmix64
+	seed := uint64(0x6a09e667f3bcc908)
+	for i := range gear {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+		z = (z ^ z>>27) * 0x94d049bb133111eb
+		gear[i] = z ^ z>>31
+	}
+}
@@ -0,0 +1,74 @@
+package chunk_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/relab/wrfs/chunk"
+)
+
+func chunks(t *testing.T, data []byte, opts chunk.Options) []int {
+	c, err := chunk.New(bytes.NewReader(data), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lengths []int
+	var total int
+	for {
+		ch, err := c.Next()
+		if err != nil {
+			break
+		}
+		if !bytes.Equal(ch.Data, data[ch.Offset:ch.Offset+int64(ch.Length)]) {
+			t.Fatalf("chunk at %d does not match input", ch.Offset)
+		}
+		lengths = append(lengths, ch.Length)
+		total += ch.Length
+	}
+	if total != len(data) {
+		t.Fatalf("chunks cover %d bytes, want %d", total, len(data))
+	}
+	return lengths
+}
+
+func TestChunkSizes(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	opts := chunk.Options{MinSize: 1 << 10, AvgSize: 4 << 10, MaxSize: 16 << 10}
+
+	lengths := chunks(t, data, opts)
+	for i, n := range lengths {
+		if n > opts.MaxSize || (n < opts.MinSize && i != len(lengths)-1) {
+			t.Errorf("chunk %d has length %d, outside [%d, %d]", i, n, opts.MinSize, opts.MaxSize)
+		}
+	}
+	if avg := len(data) / len(lengths); avg < opts.MinSize || avg > opts.MaxSize/2 {
+		t.Errorf("average chunk size %d is far from %d", avg, opts.AvgSize)
+	}
+}
+
+func TestChunkShift(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(2)).Read(data)
+	shifted := append([]byte("inserted"), data...)
+
+	seen := make(map[int64]bool)
+	var off int64
+	for _, n := range chunks(t, data, chunk.Options{}) {
+		off += int64(n)
+		seen[off] = true
+	}
+	var shared int
+	off = -8
+	lengths := chunks(t, shifted, chunk.Options{})
+	for _, n := range lengths {
+		off += int64(n)
+		if seen[off] {
+			shared++
+		}
+	}
+	if shared < len(lengths)-2 {
+		t.Errorf("only %d of %d boundaries survived an insertion", shared, len(lengths))
+	}
+}
@@ -0,0 +1,33 @@
+package wrfs
+
+// CloneFile is a file that can take a copy of the contents of another file without them passing through the
+// program, such as by sharing the storage of the file on a copy-on-write file system, or by having a server copy
+// them.
+type CloneFile interface {
+	File
+
+	// CloneFrom replaces the contents of the file with those of src, which must be open for reading. If it cannot
+	// copy from src, such as a file of another kind or on another server, CloneFrom returns an error matching
+	// ErrUnsupported without changing the file.
+	CloneFrom(src File) error
+}
+
+// Clone replaces the contents of dst, which must be open for writing, with those of src, which must be open for
+// reading, without the contents passing through the program. If that is not possible, Clone returns an error
+// matching ErrUnsupported, and the contents must be copied instead, such as with io.Copy.
+//
+// If dst implements CloneFile, Clone calls its CloneFrom method. Files of the host file system are cloned with the
+// FICLONE ioctl on Linux, which copy-on-write file systems such as Btrfs and XFS support within a file system.
+//
+// CopyFS and CopyFile clone files where possible.
+func Clone(dst, src File) error {
+	if dst, ok := dst.(CloneFile); ok {
+		return dst.CloneFrom(src)
+	}
+	if d, ok := OSFile(dst); ok {
+		if s, ok := OSFile(src); ok {
+			return clone(d, s)
+		}
+	}
+	return fileErr("clone", dst, ErrUnsupported)
+}
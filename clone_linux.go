@@ -0,0 +1,41 @@
+package wrfs
+
+import (
+	"os"
+	"syscall"
+)
+
+const ficlone = 0x40049409
+
+func clone(dst, src *os.File) (err error) {
+	dconn, err := dst.SyscallConn()
+	if err != nil {
+		return err
+	}
+	sconn, err := src.SyscallConn()
+	if err != nil {
+		return err
+	}
+	cerr := dconn.Control(func(dfd uintptr) {
+		cerr := sconn.Control(func(sfd uintptr) {
+			_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dfd, ficlone, sfd)
+			if errno != 0 {
+				err = errno
+			}
+		})
+		if err == nil {
+			err = cerr
+		}
+	})
+	if cerr != nil {
+		return cerr
+	}
+	switch err {
+	case nil:
+		return nil
+	case syscall.EXDEV, syscall.EINVAL, syscall.ENOTTY:
+		// The files are on different file systems, or the file system cannot share storage between files.
+		err = ErrUnsupported
+	}
+	return &PathError{Op: "clone", Path: dst.Name(), Err: err}
+}
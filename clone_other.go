@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package wrfs
+
+import "os"
+
+func clone(dst, src *os.File) error {
+	return &PathError{Op: "clone", Path: dst.Name(), Err: ErrUnsupported}
+}
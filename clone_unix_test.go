@@ -0,0 +1,29 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wrfs_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestClone(t *testing.T) {
+	fsys := getFS(t)
+	writeFile(t, fsys, "src", []byte("contents"))
+	writeFile(t, fsys, "dst", []byte("old contents"))
+	src, err := fsys.Open("src")
+	check(t, err)
+	defer src.Close()
+	dst, err := OpenFile(fsys, "dst", O_WRONLY, 0)
+	check(t, err)
+	err = Clone(dst, src)
+	check(t, dst.Close())
+	if errors.Is(err, ErrUnsupported) {
+		t.Skip(err)
+	}
+	check(t, err)
+	checkContents(t, fsys, "dst", "contents")
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+	"github.com/relab/wrfs/s3fs"
+	"github.com/relab/wrfs/sftpfs"
+	"github.com/relab/wrfs/tarfs"
+)
+
+// A backend opens the file system named by a URL and returns it along with the path within it.
+type backend func(u *url.URL) (fsys wrfs.FS, name string, err error)
+
+var backends = map[string]backend{
+	"dir":  dirBackend,
+	"mem":  memBackend,
+	"s3":   s3Backend,
+	"sftp": sftpBackend,
+	"tar":  tarBackend,
+}
+
+func backendSchemes() string {
+	var schemes []string
+	for scheme := range backends {
+		schemes = append(schemes, scheme+"://")
+	}
+	sort.Strings(schemes)
+	return strings.Join(schemes, ", ")
+}
+
+// open returns the file system and path named by location.
+func open(location string) (wrfs.FS, string, error) {
+	if !strings.Contains(location, "://") {
+		return dirBackend(&url.URL{Scheme: "dir", Path: location})
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, "", err
+	}
+	b, ok := backends[u.Scheme]
+	if !ok {
+		return nil, "", errors.New("unsupported backend " + u.Scheme + "://; supported backends: " + backendSchemes())
+	}
+	return b(u)
+}
+
+// openSub returns the file system rooted at the directory named by location.
+func openSub(location string) (wrfs.FS, error) {
+	fsys, name, err := open(location)
+	if err != nil {
+		return nil, err
+	}
+	return wrfs.Sub(fsys, name)
+}
+
+// dirBackend serves dir:// URLs from the host file system.
+func dirBackend(u *url.URL) (wrfs.FS, string, error) {
+	abs, err := filepath.Abs(filepath.FromSlash(u.Host + u.Path))
+	if err != nil {
+		return nil, "", err
+	}
+	vol := filepath.VolumeName(abs)
+	name := strings.TrimPrefix(filepath.ToSlash(abs[len(vol):]), "/")
+	if name == "" {
+		name = "."
+	}
+	return wrfs.DirFS(vol + "/"), name, nil
+}
+
+// urlName returns the name within a file system of the path of a URL.
+func urlName(p string) string {
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return "."
+	}
+	return p[1:]
+}
+
+// memFS is the file system of mem:// URLs, which lasts as long as the process.
+var memFS = memfs.New()
+
+// memBackend serves mem:// URLs from a file system in memory, which starts out empty.
+func memBackend(u *url.URL) (wrfs.FS, string, error) {
+	return memFS, urlName(u.Host + u.Path), nil
+}
+
+// s3Backend serves s3://bucket/key URLs from the S3 endpoint in $AWS_ENDPOINT_URL, or AWS if it is not set,
+// with the region and credentials of the usual AWS environment variables.
+func s3Backend(u *url.URL) (wrfs.FS, string, error) {
+	endpoint := os.Getenv("AWS_ENDPOINT_URL")
+	if endpoint == "" {
+		endpoint = "https://s3.amazonaws.com"
+	}
+	var opts []s3fs.Option
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		opts = append(opts, s3fs.Region(region))
+	}
+	if key := os.Getenv("AWS_ACCESS_KEY_ID"); key != "" {
+		opts = append(opts, s3fs.Credentials(key, os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")))
+	}
+	fsys, err := s3fs.New(endpoint, u.Host, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+	return fsys, urlName(u.Path), nil
+}
+
+// sftpDial starts an SFTP session with the server named by u, returning the connection to it.
+var sftpDial = func(u *url.URL) (io.ReadWriteCloser, error) {
+	args := []string{"-s"}
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	host := u.Hostname()
+	if u.User != nil {
+		host = u.User.Username() + "@" + host
+	}
+	cmd := exec.Command("ssh", append(args, host, "sftp")...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &sshConn{Reader: stdout, WriteCloser: stdin, cmd: cmd}, nil
+}
+
+// sshConn is the connection to the SFTP subsystem of an ssh command.
+type sshConn struct {
+	io.Reader
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func (c *sshConn) Close() error {
+	c.WriteCloser.Close()
+	return c.cmd.Wait()
+}
+
+// sftpBackend serves sftp://[user@]host[:port]/path URLs over the SFTP subsystem of ssh, so that the user's
+// configuration and keys of ssh apply. Paths are absolute on the server.
+func sftpBackend(u *url.URL) (wrfs.FS, string, error) {
+	conn, err := sftpDial(u)
+	if err != nil {
+		return nil, "", err
+	}
+	fsys, err := sftpfs.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, "", err
+	}
+	return fsys, urlName(u.Path), nil
+}
+
+// tarBackend serves tar:// URLs, such as tar:///tmp/archive.tar.gz/dir/file, from the files of a tar archive of the
+// host file system, optionally compressed with gzip. The archive is the longest prefix of the path that is a regular
+// file. It is extracted into memory, and its files are read-only.
+func tarBackend(u *url.URL) (wrfs.FS, string, error) {
+	host, name, err := dirBackend(u)
+	if err != nil {
+		return nil, "", err
+	}
+	for archive := name; archive != "."; archive = path.Dir(archive) {
+		if fi, err := wrfs.Stat(host, archive); err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		fsys, err := extractTar(host, archive)
+		if err != nil {
+			return nil, "", err
+		}
+		return wrfs.ReadOnly(fsys), urlName(name[len(archive):]), nil
+	}
+	return nil, "", &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrNotExist}
+}
+
+// extractTar extracts the named tar archive into memory.
+func extractTar(fsys wrfs.FS, name string) (wrfs.FS, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var r io.Reader = bufio.NewReader(file)
+	if magic, _ := r.(*bufio.Reader).Peek(2); string(magic) == "\x1f\x8b" {
+		if r, err = gzip.NewReader(r); err != nil {
+			return nil, err
+		}
+	}
+	mem := memfs.New()
+	if err := tarfs.Extract(mem, tar.NewReader(r)); err != nil {
+		return nil, err
+	}
+	return mem, nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/tarfs"
+)
+
+// stdout is where the commands write their output.
+var stdout io.Writer = os.Stdout
+
+func ls(args []string) error {
+	flags := newFlagSet("ls")
+	long := flags.Bool("l", false, "show mode, size and modification time")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	fsys, name, err := open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	entries, err := wrfs.ReadDir(fsys, name)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		if !*long {
+			fmt.Fprintln(stdout, entryName)
+			continue
+		}
+		fi, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%v %10d %s %s\n", fi.Mode(), fi.Size(), fi.ModTime().Format("2006-01-02 15:04"), entryName)
+	}
+	return nil
+}
+
+func cat(args []string) error {
+	flags := newFlagSet("cat")
+	flags.Parse(args)
+	for _, location := range flags.Args() {
+		fsys, name, err := open(location)
+		if err != nil {
+			return err
+		}
+		if err := copyTo(stdout, fsys, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyTo(w io.Writer, fsys wrfs.FS, name string) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+func cp(args []string) error {
+	flags := newFlagSet("cp")
+	recursive := flags.Bool("r", false, "copy directories recursively")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	src, srcName, err := open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	dst, dstName, err := open(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	fi, err := wrfs.Stat(src, srcName)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		// Copying into an existing directory keeps the file name.
+		if dfi, err := wrfs.Stat(dst, dstName); err == nil && dfi.IsDir() {
+			dstName = path.Join(dstName, path.Base(srcName))
+		}
+		return wrfs.CopyFile(dst, dstName, src, srcName, wrfs.CopySparse())
+	}
+	if !*recursive {
+		return errors.New(srcName + " is a directory (not copied)")
+	}
+	if err := wrfs.MkdirAll(dst, dstName, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	dst, err = wrfs.Sub(dst, dstName)
+	if err != nil {
+		return err
+	}
+	return wrfs.CopyFS(dst, src, srcName, wrfs.CopyOverwrite(), wrfs.CopySymlinks(), wrfs.CopySparse())
+}
+
+func syncCmd(args []string) error {
+	flags := newFlagSet("sync")
+	del := flags.Bool("delete", false, "delete files in dst that are not in src")
+	verbose := flags.Bool("v", false, "print the changes made to dst")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	src, err := openSub(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	dst, err := openSub(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	opts := []wrfs.MirrorOption{wrfs.MirrorDelta(0)}
+	if *del {
+		opts = append(opts, wrfs.MirrorDelete())
+	}
+	if *verbose {
+		opts = append(opts, wrfs.MirrorProgress(func(op, name string) { fmt.Fprintln(stdout, op, name) }))
+	}
+	_, err = wrfs.Mirror(dst, src, opts...)
+	return err
+}
+
+func rm(args []string) error {
+	flags := newFlagSet("rm")
+	recursive := flags.Bool("r", false, "remove directories and their contents")
+	flags.Parse(args)
+	for _, location := range flags.Args() {
+		fsys, name, err := open(location)
+		if err != nil {
+			return err
+		}
+		if *recursive {
+			err = wrfs.RemoveAll(fsys, name)
+		} else {
+			err = wrfs.Remove(fsys, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mkdir(args []string) error {
+	flags := newFlagSet("mkdir")
+	parents := flags.Bool("p", false, "create parent directories as needed")
+	flags.Parse(args)
+	for _, location := range flags.Args() {
+		fsys, name, err := open(location)
+		if err != nil {
+			return err
+		}
+		if *parents {
+			err = wrfs.MkdirAll(fsys, name, 0777)
+		} else {
+			err = wrfs.Mkdir(fsys, name, 0777)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tarCmd(args []string) error {
+	flags := newFlagSet("tar")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	fsys, name, err := open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return tarfs.Create(stdout, fsys, name)
+}
+
+func serve(args []string) error {
+	flags := newFlagSet("serve")
+	addr := flags.String("addr", "localhost:8080", "address to listen on")
+	writable := flags.Bool("w", false, "accept PUT, DELETE and MKCOL requests modifying the files")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	fsys, err := openSub(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "serving "+flags.Arg(0)+" on http://"+*addr)
+	handler := http.FileServer(wrfs.HTTPFS(fsys))
+	if *writable {
+		handler = wrfs.FileServer(fsys)
+	}
+	return http.ListenAndServe(*addr, handler)
+}
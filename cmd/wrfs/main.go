@@ -0,0 +1,97 @@
+// Command wrfs manipulates files in any of the file systems supported by the wrfs package.
+//
+// Usage:
+//
+//	wrfs <command> [flags] <location>...
+//
+// Locations are URLs naming a backend and a path within it, such as dir:///tmp/data/file.txt.
+// Plain paths are interpreted as dir:// locations relative to the working directory.
+//
+// The backends are:
+//
+//	dir://path                      the host file system
+//	mem://path                      a file system in memory, which lasts as long as the command
+//	s3://bucket/key                 an S3 bucket at $AWS_ENDPOINT_URL, or AWS, with the credentials of
+//	                                $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY and $AWS_SESSION_TOKEN
+//	sftp://[user@]host[:port]/path  an SFTP server, reached with ssh
+//	tar://path/archive.tar/path     the files of a tar archive of the host file system, read-only
+//
+// The commands are:
+//
+//	ls     list a directory
+//	cat    print the contents of files
+//	cp     copy files and (with -r) directories
+//	sync   make a destination directory tree match a source
+//	rm     remove files and (with -r) directories
+//	mkdir  create directories
+//	tar    write a tar archive of a directory tree to stdout
+//	serve  serve a directory tree over HTTP, and (with -w) accept changes to it
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	// commands is initialized in init, since the commands refer to it for their usage.
+	commands = map[string]command{
+		"ls":    {"ls [-l] <location>", ls},
+		"cat":   {"cat <location>...", cat},
+		"cp":    {"cp [-r] <src> <dst>", cp},
+		"sync":  {"sync [-delete] [-v] <src> <dst>", syncCmd},
+		"rm":    {"rm [-r] <location>...", rm},
+		"mkdir": {"mkdir [-p] <location>...", mkdir},
+		"tar":   {"tar <location>", tarCmd},
+		"serve": {"serve [-addr host:port] [-w] <location>", serve},
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: wrfs <command> [flags] <location>...")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "\twrfs "+commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nsupported backends: "+backendSchemes())
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "wrfs "+os.Args[1]+":", err)
+		os.Exit(1)
+	}
+}
+
+// newFlagSet returns a flag set for the named command that prints the command's usage on error.
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: wrfs "+commands[name].usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
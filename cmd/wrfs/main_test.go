@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+	"github.com/relab/wrfs/s3fs"
+	"github.com/relab/wrfs/sftpfs"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// run runs the command given by args, returning what it printed.
+func run(t *testing.T, args ...string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	if err := commands[args[0]].run(args[1:]); err != nil {
+		t.Fatalf("wrfs %v: %v", args, err)
+	}
+	return buf.String()
+}
+
+// expect runs the command given by args and checks what it printed.
+func expect(t *testing.T, want string, args ...string) {
+	t.Helper()
+	if got := run(t, args...); got != want {
+		t.Errorf("wrfs %v printed %q, want %q", args, got, want)
+	}
+}
+
+// newSrc creates a tree of files in a temporary directory, returning the directory.
+func newSrc(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	check(t, os.MkdirAll(filepath.Join(dir, "src", "sub"), 0755))
+	check(t, os.WriteFile(filepath.Join(dir, "src", "x"), []byte("hello"), 0644))
+	check(t, os.WriteFile(filepath.Join(dir, "src", "sub", "y"), []byte("world"), 0644))
+	return dir
+}
+
+func TestCommands(t *testing.T) {
+	memFS = memfs.New()
+	dir := newSrc(t)
+	src := filepath.Join(dir, "src")
+
+	run(t, "mkdir", "-p", "mem://copy/of")
+	run(t, "cp", "-r", src, "mem://copy/of/src")
+	expect(t, "sub/\nx\n", "ls", "mem://copy/of/src")
+	expect(t, "helloworld", "cat", "mem://copy/of/src/x", "dir://"+filepath.ToSlash(src)+"/sub/y")
+	run(t, "cp", "mem://copy/of/src/x", "mem://copy")
+	expect(t, "hello", "cat", "mem://copy/x")
+
+	run(t, "mkdir", "mem://mirror")
+	check(t, wrfs.WriteFile(memFS, "mirror/extra", nil, 0644))
+	expect(t, "update .\ncreate sub\ncreate sub/y\ncreate x\ndelete extra\n", "sync", "-delete", "-v", src, "mem://mirror")
+	expect(t, "", "sync", "-v", src, "mem://mirror")
+	expect(t, "world", "cat", "mem://mirror/sub/y")
+	check(t, os.WriteFile(filepath.Join(src, "x"), []byte("HELLO"), 0644))
+	check(t, os.Chtimes(filepath.Join(src, "x"), time.Now(), time.Now().Add(time.Hour)))
+	expect(t, "update x\n", "sync", "-v", src, "mem://mirror")
+	expect(t, "HELLO", "cat", "mem://mirror/x")
+
+	run(t, "rm", "mem://copy/x")
+	run(t, "rm", "-r", "mem://copy/of")
+	expect(t, "copy/\nmirror/\n", "ls", "mem://")
+	expect(t, "", "ls", "mem://copy")
+
+	archive := run(t, "tar", src)
+	check(t, os.WriteFile(filepath.Join(dir, "src.tar"), []byte(archive), 0644))
+	location := "tar://" + filepath.ToSlash(dir) + "/src.tar"
+	expect(t, "sub/\nx\n", "ls", location)
+	expect(t, "world", "cat", location+"/sub/y")
+	if err := commands["rm"].run([]string{location + "/x"}); err == nil {
+		t.Error("removing a file of a tar archive succeeded")
+	}
+}
+
+func TestSFTP(t *testing.T) {
+	fsys := memfs.New()
+	defer func(dial func(*url.URL) (io.ReadWriteCloser, error)) { sftpDial = dial }(sftpDial)
+	sftpDial = func(u *url.URL) (io.ReadWriteCloser, error) {
+		if u.Host != "user@example.com:2222" && u.Host != "example.com:2222" {
+			t.Errorf("dialing %s", u.Host)
+		}
+		server, conn := net.Pipe()
+		go sftpfs.Serve(server, fsys)
+		return conn, nil
+	}
+	src := filepath.Join(newSrc(t), "src")
+
+	run(t, "mkdir", "sftp://user@example.com:2222/home")
+	run(t, "cp", "-r", src, "sftp://example.com:2222/home/src")
+	expect(t, "sub/\nx\n", "ls", "sftp://example.com:2222/home/src")
+	expect(t, "world", "cat", "sftp://example.com:2222/home/src/sub/y")
+	data, err := wrfs.ReadFile(fsys, "home/src/x")
+	check(t, err)
+	if string(data) != "hello" {
+		t.Errorf("home/src/x contains %q on the server, want %q", data, "hello")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	t.Setenv("AWS_ENDPOINT_URL", "http://localhost:9000")
+	fsys, name, err := open("s3://bucket/dir/key")
+	check(t, err)
+	if _, ok := fsys.(*s3fs.FS); !ok || name != "dir/key" {
+		t.Errorf("s3://bucket/dir/key opened %T and %q", fsys, name)
+	}
+	if _, _, err := open("nfs://host/dir"); err == nil {
+		t.Error("opening nfs://host/dir succeeded")
+	}
+	if _, _, err := open("tar://" + filepath.ToSlash(t.TempDir()) + "/missing.tar/x"); err == nil {
+		t.Error("opening a missing archive succeeded")
+	}
+}
+
+func TestServe(t *testing.T) {
+	src := filepath.Join(newSrc(t), "src")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	check(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+	go commands["serve"].run([]string{"-addr", addr, src})
+
+	var resp *http.Response
+	for i := 0; i < 100; i++ {
+		if resp, err = http.Get("http://" + addr + "/sub/y"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	check(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	check(t, err)
+	if resp.StatusCode != http.StatusOK || string(data) != "world" {
+		t.Errorf("GET /sub/y: %s %q, want %q", resp.Status, data, "world")
+	}
+}
@@ -0,0 +1,423 @@
+package wrfs
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// A Codec is a compression format used by Compress.
+//
+// Other formats, such as zstd, can be used by implementing Codec on top of a third-party package.
+type Codec interface {
+	// ID identifies the format in the headers of compressed files. IDs below 128 are reserved for this package.
+	ID() byte
+
+	// NewReader returns a reader that decompresses the data read from r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+
+	// NewWriter returns a writer that compresses the data written to it and writes it to w.
+	// Closing the writer must flush any buffered data to w, but not close w.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+}
+
+// Gzip is the gzip Codec, using the default compression level.
+var Gzip Codec = GzipLevel(gzip.DefaultCompression)
+
+// GzipLevel returns a gzip Codec that compresses at the given level, as defined by compress/gzip.
+func GzipLevel(level int) Codec {
+	return gzipCodec(level)
+}
+
+type gzipCodec int
+
+func (gzipCodec) ID() byte { return 1 }
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) }
+
+func (c gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, int(c))
+}
+
+// A compressed file starts with a header holding a magic number, the ID of the codec and the size of the
+// uncompressed data, followed by the compressed data.
+const (
+	compressMagic      = "wrfsz\x00\x00"
+	compressHeaderSize = len(compressMagic) + 1 + 8
+)
+
+// Compress returns a file system that compresses the files written to fsys with the first codec, or with Gzip
+// if no codec is given, and decompresses the files read from fsys with whichever of the codecs they were
+// written with. Compressed files are marked with a header, which also records their uncompressed size
+// for Stat, Lstat and ReadDir to report. Files without the header, such as files written to fsys directly,
+// are read and reported as they are.
+//
+// Compressed files are written and read as streams: files opened for writing must be empty or be truncated
+// by O_TRUNC, and can only be written sequentially, while files opened for reading only support seeking
+// forwards cheaply. Truncate only supports truncating compressed files to zero. Detecting compressed files
+// requires the files of fsys to implement io.ReaderAt, and writing them requires io.WriterAt.
+func Compress(fsys FS, codecs ...Codec) FS {
+	if len(codecs) == 0 {
+		codecs = []Codec{Gzip}
+	}
+	return &compressFS{fsWrapper{fsys}, codecs}
+}
+
+type compressFS struct {
+	fsWrapper
+	codecs []Codec
+}
+
+// readHeader returns the codec and the uncompressed size of a file, or a nil codec if it is not compressed.
+func (c *compressFS) readHeader(file File) (Codec, int64, error) {
+	r, ok := file.(io.ReaderAt)
+	if !ok {
+		return nil, 0, nil
+	}
+	fi, err := file.Stat()
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() < int64(compressHeaderSize) {
+		return nil, 0, err
+	}
+	var hdr [compressHeaderSize]byte
+	if _, err := r.ReadAt(hdr[:], 0); err != nil {
+		return nil, 0, err
+	}
+	if string(hdr[:len(compressMagic)]) != compressMagic {
+		return nil, 0, nil
+	}
+	id := hdr[len(compressMagic)]
+	for _, codec := range c.codecs {
+		if codec.ID() == id {
+			return codec, int64(binary.BigEndian.Uint64(hdr[len(compressMagic)+1:])), nil
+		}
+	}
+	return nil, 0, errors.New("unknown compression codec " + strconv.Itoa(int(id)))
+}
+
+// sizeOf returns fi, with the uncompressed size if the named file is compressed.
+func (c *compressFS) sizeOf(name string, fi FileInfo) (FileInfo, error) {
+	if !fi.Mode().IsRegular() || fi.Size() < int64(compressHeaderSize) {
+		return fi, nil
+	}
+	file, err := c.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	codec, size, err := c.readHeader(file)
+	if err != nil {
+		return nil, &PathError{Op: "stat", Path: name, Err: err}
+	}
+	if codec == nil {
+		return fi, nil
+	}
+	return &sizedInfo{fi, size}, nil
+}
+
+// sizedInfo is a FileInfo with a different size.
+type sizedInfo struct {
+	FileInfo
+	size int64
+}
+
+func (fi *sizedInfo) Size() int64 { return fi.size }
+
+func (c *compressFS) Open(name string) (File, error) {
+	file, err := c.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.decompress(file, name)
+}
+
+// OpenLock opens the named file for locking, decompressing it if it is compressed.
+func (c *compressFS) OpenLock(name string) (LockFile, error) {
+	file, err := OpenLock(c.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := c.decompress(file, name)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := f.(*decompressFile); ok {
+		return &lockingFile{f, file}, nil
+	}
+	return file, nil
+}
+
+// decompress returns file, or a file reading its uncompressed data if it is compressed.
+// It closes file if it fails.
+func (c *compressFS) decompress(file File, name string) (File, error) {
+	codec, size, err := c.readHeader(file)
+	if err == nil && codec != nil {
+		var f *decompressFile
+		if f, err = newDecompressFile(file, name, codec, size); err == nil {
+			return f, nil
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, &PathError{Op: "open", Path: name, Err: err}
+	}
+	return file, nil
+}
+
+func (c *compressFS) OpenFile(name string, flag int, perm FileMode) (File, error) {
+	if flag&(O_WRONLY|O_RDWR) == 0 {
+		if flag&O_CREATE != 0 {
+			// Create the file if needed, but read it through Open.
+			file, err := OpenFile(c.fsys, name, flag, perm)
+			if err != nil {
+				return nil, err
+			}
+			file.Close()
+		}
+		return c.Open(name)
+	}
+	// The data is written sequentially, and the header is updated when the file is closed.
+	file, err := OpenFile(c.fsys, name, flag&^O_APPEND, perm)
+	if err != nil {
+		return nil, err
+	}
+	f, err := newCompressFile(file, name, c.codecs[0])
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (c *compressFS) Stat(name string) (FileInfo, error) {
+	fi, err := Stat(c.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return c.sizeOf(name, fi)
+}
+
+func (c *compressFS) Lstat(name string) (FileInfo, error) {
+	fi, err := Lstat(c.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return c.sizeOf(name, fi)
+}
+
+func (c *compressFS) ReadDir(name string) ([]DirEntry, error) {
+	entries, err := ReadDir(c.fsys, name)
+	for i, e := range entries {
+		entries[i] = &compressEntry{e, path.Join(name, e.Name()), c}
+	}
+	return entries, err
+}
+
+// compressEntry is a directory entry whose Info reports the uncompressed size.
+type compressEntry struct {
+	DirEntry
+	path string
+	c    *compressFS
+}
+
+func (e *compressEntry) Info() (FileInfo, error) {
+	fi, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return e.c.sizeOf(e.path, fi)
+}
+
+// Truncate truncates files that are not compressed, and compressed files to zero or their current size.
+func (c *compressFS) Truncate(name string, size int64) error {
+	file, err := c.fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	codec, current, err := c.readHeader(file)
+	file.Close()
+	switch {
+	case err != nil:
+		return &PathError{Op: "truncate", Path: name, Err: err}
+	case codec == nil || size == 0:
+		return Truncate(c.fsys, name, size)
+	case size == current:
+		return nil
+	}
+	return &PathError{Op: "truncate", Path: name, Err: ErrUnsupported}
+}
+
+// compressFile is a file opened for writing through a compressFS.
+type compressFile struct {
+	file File
+	name string
+	w    io.WriteCloser
+	size int64 // the number of uncompressed bytes written
+	err  error // the first error of w, after which the data is incomplete
+}
+
+func newCompressFile(file File, name string, codec Codec) (*compressFile, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() != 0 {
+		return nil, &PathError{Op: "open", Path: name, Err: ErrUnsupported}
+	}
+	if _, ok := file.(io.WriterAt); !ok {
+		return nil, &PathError{Op: "open", Path: name, Err: ErrUnsupported}
+	}
+	var hdr [compressHeaderSize]byte
+	copy(hdr[:], compressMagic)
+	hdr[len(compressMagic)] = codec.ID()
+	if _, err := Write(file, hdr[:]); err != nil {
+		return nil, err
+	}
+	f := &compressFile{file: file, name: name}
+	if f.w, err = codec.NewWriter(writerFunc(func(p []byte) (int, error) { return Write(file, p) })); err != nil {
+		return nil, &PathError{Op: "open", Path: name, Err: err}
+	}
+	return f, nil
+}
+
+// writerFunc is an adapter to allow the use of ordinary functions as io.Writers.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func (f *compressFile) Write(p []byte) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	n, err := f.w.Write(p)
+	f.size += int64(n)
+	if err != nil {
+		f.err = err
+	}
+	return n, err
+}
+
+// Close flushes the compressed data and records the uncompressed size in the header.
+func (f *compressFile) Close() error {
+	err := f.err
+	if err == nil {
+		err = f.w.Close()
+	}
+	if err == nil {
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(f.size))
+		_, err = f.file.(io.WriterAt).WriteAt(size[:], int64(len(compressMagic)+1))
+	}
+	if cerr := f.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (f *compressFile) Stat() (FileInfo, error) {
+	fi, err := f.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &sizedInfo{fi, f.size}, nil
+}
+
+func (f *compressFile) Read(p []byte) (int, error) {
+	return 0, &PathError{Op: "read", Path: f.name, Err: errno.EBADF}
+}
+
+// Seek only reports the current offset, as compressed files are written sequentially.
+func (f *compressFile) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekCurrent {
+		return f.size, nil
+	}
+	return 0, &PathError{Op: "seek", Path: f.name, Err: ErrUnsupported}
+}
+
+func (f *compressFile) Sync() error {
+	if file, ok := f.file.(SyncFile); ok {
+		return file.Sync()
+	}
+	return &PathError{Op: "sync", Path: f.name, Err: ErrUnsupported}
+}
+
+// decompressFile is a compressed file opened for reading through a compressFS.
+type decompressFile struct {
+	file  File
+	name  string
+	codec Codec
+	r     io.ReadCloser
+	size  int64 // the uncompressed size
+	off   int64
+}
+
+func newDecompressFile(file File, name string, codec Codec, size int64) (*decompressFile, error) {
+	f := &decompressFile{file: file, name: name, codec: codec, size: size}
+	if err := f.rewind(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// rewind restarts decompression at the beginning of the file.
+func (f *decompressFile) rewind() error {
+	if f.r != nil {
+		f.r.Close()
+	}
+	r, err := f.codec.NewReader(io.NewSectionReader(f.file.(io.ReaderAt), int64(compressHeaderSize), 1<<63-1))
+	if err != nil {
+		return err
+	}
+	f.r, f.off = r, 0
+	return nil
+}
+
+func (f *decompressFile) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	f.off += int64(n)
+	return n, err
+}
+
+// Seek seeks by decompressing up to the new offset, from the beginning of the file if it is behind the current one.
+func (f *decompressFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += f.size
+	case io.SeekStart:
+	default:
+		return 0, &PathError{Op: "seek", Path: f.name, Err: ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &PathError{Op: "seek", Path: f.name, Err: ErrInvalid}
+	}
+	if offset < f.off {
+		if err := f.rewind(); err != nil {
+			return 0, &PathError{Op: "seek", Path: f.name, Err: err}
+		}
+	}
+	if _, err := io.CopyN(io.Discard, f, offset-f.off); err != nil && err != io.EOF {
+		return 0, &PathError{Op: "seek", Path: f.name, Err: err}
+	}
+	// Seeking beyond the end is allowed, and subsequent reads return io.EOF.
+	f.off = offset
+	return offset, nil
+}
+
+func (f *decompressFile) Stat() (FileInfo, error) {
+	fi, err := f.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &sizedInfo{fi, f.size}, nil
+}
+
+func (f *decompressFile) Close() error {
+	f.r.Close()
+	return f.file.Close()
+}
@@ -0,0 +1,80 @@
+package wrfs_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+	"github.com/relab/wrfs/wrfstest"
+)
+
+func TestCompress(t *testing.T) {
+	lower := memfs.New()
+	fsys := Compress(lower)
+
+	data := bytes.Repeat([]byte("compressible log line\n"), 1000)
+	check(t, WriteFile(fsys, "log", data, 0644))
+	check(t, WriteFile(lower, "plain", []byte("plain"), 0644))
+
+	fi, err := Stat(lower, "log")
+	check(t, err)
+	if fi.Size() >= int64(len(data))/10 {
+		t.Errorf("stored size is %d, want it well below %d", fi.Size(), len(data))
+	}
+	fi, err = Stat(fsys, "log")
+	check(t, err)
+	if fi.Size() != int64(len(data)) {
+		t.Errorf("Size() = %d, want %d", fi.Size(), len(data))
+	}
+	checkContents(t, fsys, "log", string(data))
+	checkContents(t, fsys, "plain", "plain")
+
+	entries, err := ReadDir(fsys, ".")
+	check(t, err)
+	for _, e := range entries {
+		fi, err := e.Info()
+		check(t, err)
+		if e.Name() == "log" && fi.Size() != int64(len(data)) {
+			t.Errorf("ReadDir reports size %d for log, want %d", fi.Size(), len(data))
+		}
+	}
+
+	file, err := fsys.Open("log")
+	check(t, err)
+	buf := make([]byte, 4)
+	for _, off := range []int64{100, 10} {
+		_, err = Seek(file, off, io.SeekStart)
+		check(t, err)
+		_, err = io.ReadFull(file, buf)
+		check(t, err)
+		if string(buf) != string(data[off:off+4]) {
+			t.Errorf("read %q at %d, want %q", buf, off, data[off:off+4])
+		}
+	}
+	check(t, file.Close())
+
+	if err := Truncate(fsys, "log", 10); !IsNotSupported(err) {
+		t.Errorf("Truncate of compressed file: got %v, want ErrUnsupported", err)
+	}
+	if _, err := OpenFile(fsys, "log", O_WRONLY|O_APPEND, 0); !IsNotSupported(err) {
+		t.Errorf("appending to compressed file: got %v, want ErrUnsupported", err)
+	}
+}
+
+func TestCompressOpenLock(t *testing.T) {
+	fsys := Compress(wrfstest.MapFS{})
+	data := bytes.Repeat([]byte("compressible log line\n"), 1000)
+	check(t, WriteFile(fsys, "log", data, 0644))
+
+	file, err := Lock(fsys, "log")
+	check(t, err)
+	got, err := io.ReadAll(file)
+	check(t, err)
+	if !bytes.Equal(got, data) {
+		t.Errorf("reading a compressed file opened with OpenLock: got %d bytes, want %d", len(got), len(data))
+	}
+	check(t, file.Unlock())
+	check(t, file.Close())
+}
@@ -0,0 +1,148 @@
+package wrfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+)
+
+// OpenContextFS is a file system with an Open method that can be canceled.
+type OpenContextFS interface {
+	FS
+
+	// OpenContext opens the named file, like Open, but aborts if ctx is canceled.
+	OpenContext(ctx context.Context, name string) (File, error)
+}
+
+// OpenFileContextFS is a file system with an OpenFile method that can be canceled.
+type OpenFileContextFS interface {
+	FS
+
+	// OpenFileContext opens the named file, like OpenFile, but aborts if ctx is canceled.
+	OpenFileContext(ctx context.Context, name string, flag int, perm FileMode) (File, error)
+}
+
+// RemoveContextFS is a file system with a Remove method that can be canceled.
+type RemoveContextFS interface {
+	FS
+
+	// RemoveContext removes the named file or (empty) directory, like Remove, but aborts if ctx is canceled.
+	RemoveContext(ctx context.Context, name string) error
+}
+
+// RemoveAllContextFS is a file system with a RemoveAll method that can be canceled.
+type RemoveAllContextFS interface {
+	FS
+
+	// RemoveAllContext removes path and any children it contains, like RemoveAll, but aborts if ctx is canceled.
+	RemoveAllContext(ctx context.Context, path string) error
+}
+
+// OpenContext opens the named file, aborting if ctx is canceled.
+//
+// If fsys implements OpenContextFS, OpenContext calls fsys.OpenContext.
+// Otherwise OpenContext returns ctx.Err() if ctx is already done, and calls fsys.Open if not.
+func OpenContext(ctx context.Context, fsys FS, name string) (File, error) {
+	if fsys, ok := fsys.(OpenContextFS); ok {
+		return fsys.OpenContext(ctx, name)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, &PathError{Op: "open", Path: name, Err: err}
+	}
+	return fsys.Open(name)
+}
+
+// OpenFileContext opens the named file with the given flag and permissions, aborting if ctx is canceled.
+//
+// If fsys implements OpenFileContextFS, OpenFileContext calls fsys.OpenFileContext.
+// Otherwise OpenFileContext returns ctx.Err() if ctx is already done, and calls OpenFile if not.
+func OpenFileContext(ctx context.Context, fsys FS, name string, flag int, perm FileMode) (File, error) {
+	if fsys, ok := fsys.(OpenFileContextFS); ok {
+		return fsys.OpenFileContext(ctx, name, flag, perm)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, &PathError{Op: "open", Path: name, Err: err}
+	}
+	return OpenFile(fsys, name, flag, perm)
+}
+
+// RemoveContext removes the named file or (empty) directory, aborting if ctx is canceled.
+//
+// If fsys implements RemoveContextFS, RemoveContext calls fsys.RemoveContext.
+// Otherwise RemoveContext returns ctx.Err() if ctx is already done, and calls Remove if not.
+func RemoveContext(ctx context.Context, fsys FS, name string) error {
+	if fsys, ok := fsys.(RemoveContextFS); ok {
+		return fsys.RemoveContext(ctx, name)
+	}
+	if err := ctx.Err(); err != nil {
+		return &PathError{Op: "remove", Path: name, Err: err}
+	}
+	return Remove(fsys, name)
+}
+
+// RemoveAllContext removes path and any children it contains, aborting if ctx is canceled.
+// If the path does not exist, RemoveAllContext returns nil (no error).
+//
+// If fsys implements RemoveAllContextFS, RemoveAllContext calls fsys.RemoveAllContext.
+// If fsys implements RemoveAllFS, RemoveAllContext returns ctx.Err() if ctx is already done,
+// and calls fsys.RemoveAll if not. Otherwise RemoveAllContext removes the children one by one
+// using RemoveContext, checking ctx between each.
+func RemoveAllContext(ctx context.Context, fsys FS, removePath string) error {
+	if fsys, ok := fsys.(RemoveAllContextFS); ok {
+		return fsys.RemoveAllContext(ctx, removePath)
+	}
+	if fsys, ok := fsys.(RemoveAllFS); ok {
+		if err := ctx.Err(); err != nil {
+			return &PathError{Op: "removeall", Path: removePath, Err: err}
+		}
+		return fsys.RemoveAll(removePath)
+	}
+	return removeAll(ctx, fsys, removePath)
+}
+
+// removeAll implements RemoveAll for file systems that only support Remove.
+func removeAll(ctx context.Context, fsys FS, removePath string) error {
+	fi, err := lstatOrStat(fsys, removePath)
+	if errors.Is(err, ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Check if we are removing a file or a directory.
+	if !fi.IsDir() {
+		return RemoveContext(ctx, fsys, removePath)
+	}
+
+	files, err := ReadDir(fsys, removePath)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range files {
+		if fi.IsDir() {
+			if err = removeAll(ctx, fsys, path.Join(removePath, fi.Name())); err != nil {
+				return err
+			}
+		} else if err = RemoveContext(ctx, fsys, path.Join(removePath, fi.Name())); err != nil {
+			return err
+		}
+	}
+
+	return RemoveContext(ctx, fsys, removePath)
+}
+
+// contextReader is a reader that fails once its context is canceled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
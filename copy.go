@@ -0,0 +1,206 @@
+package wrfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// A CopyOption configures CopyFS and CopyFile.
+type CopyOption func(*copyConfig)
+
+type copyConfig struct {
+	symlinks  bool
+	overwrite bool
+	times     bool
+	sparse    bool
+}
+
+// CopySymlinks makes CopyFS recreate symbolic links in the destination, instead of failing on them.
+func CopySymlinks() CopyOption {
+	return func(c *copyConfig) { c.symlinks = true }
+}
+
+// CopyOverwrite makes CopyFS overwrite existing files in the destination, instead of failing with ErrExist.
+func CopyOverwrite() CopyOption {
+	return func(c *copyConfig) { c.overwrite = true }
+}
+
+// CopyTimes makes CopyFS preserve the modification times of files and directories, if dst supports Chtimes, and
+// of symbolic links, if dst supports Lchtimes.
+func CopyTimes() CopyOption {
+	return func(c *copyConfig) { c.times = true }
+}
+
+// CopySparse makes CopyFS and CopyFile skip the holes of sparse files, as reported by SeekData and SeekHole,
+// leaving holes in the destination too, if it supports seeking and truncating open files.
+func CopySparse() CopyOption {
+	return func(c *copyConfig) { c.sparse = true }
+}
+
+// CopyFS copies the file tree rooted at root in src into dst, such that src's root/name is copied to dst's name.
+// Directories are created with MkdirAll, and regular files are created with OpenFile, both preserving the
+// permission bits of the source. Existing directories in dst are merged with the copied ones, while existing
+// files cause CopyFS to fail with an error matching ErrExist, unless the CopyOverwrite option is given. The
+// contents of files are cloned with Clone where possible, such as by a server or a copy-on-write file system, and
+// copied through the program otherwise.
+//
+// Symbolic links are recreated using Symlink if the CopySymlinks option is given; otherwise, like other
+// irregular files, they cause CopyFS to fail with an error matching ErrInvalid.
+func CopyFS(dst FS, src FS, root string, opts ...CopyOption) error {
+	return CopyFSContext(context.Background(), dst, src, root, opts...)
+}
+
+// CopyFSContext is like CopyFS, but aborts the copy if ctx is canceled. The context is checked before each file
+// is copied and while copying file contents, and is passed to OpenContext and OpenFileContext.
+func CopyFSContext(ctx context.Context, dst FS, src FS, root string, opts ...CopyOption) error {
+	var c copyConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	return WalkDir(src, root, func(name string, d DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		target := pathRel(root, name)
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch mode := fi.Mode(); {
+		case mode.IsDir():
+			if err := MkdirAll(dst, target, mode.Perm()); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			flag := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+			if c.overwrite {
+				flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			}
+			if err := copyFile(ctx, dst, target, src, name, flag, mode.Perm(), c.sparse); err != nil {
+				return err
+			}
+		case mode&ModeSymlink != 0 && c.symlinks:
+			link, err := Readlink(src, name)
+			if err != nil {
+				return err
+			}
+			if c.overwrite {
+				if err := Remove(dst, target); err != nil && !errors.Is(err, ErrNotExist) {
+					return err
+				}
+			}
+			if err := Symlink(dst, link, target); err != nil {
+				return err
+			}
+			if c.times {
+				err := Lchtimes(dst, target, time.Time{}, fi.ModTime())
+				if err != nil && !errors.Is(err, ErrUnsupported) {
+					return err
+				}
+			}
+			return nil
+		default:
+			return &PathError{Op: "copyfs", Path: name, Err: ErrInvalid}
+		}
+
+		if c.times {
+			err := Chtimes(dst, target, time.Time{}, fi.ModTime())
+			if err != nil && !errors.Is(err, ErrUnsupported) {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CopyFile copies the contents of the named file in src to the named file in dst. If the destination
+// exists, it is truncated; otherwise it is created with the permission bits of the source file.
+// Of the options, only CopySparse applies to CopyFile.
+func CopyFile(dst FS, dstName string, src FS, srcName string, opts ...CopyOption) error {
+	var c copyConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	fi, err := Stat(src, srcName)
+	if err != nil {
+		return err
+	}
+	return copyFile(context.Background(), dst, dstName, src, srcName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm(), c.sparse)
+}
+
+func copyFile(ctx context.Context, dst FS, dstName string, src FS, srcName string, flag int, perm FileMode, sparse bool) (err error) {
+	out, err := OpenFileContext(ctx, dst, dstName, flag, perm)
+	if err != nil {
+		return err
+	}
+	defer safeClose(out, &err)
+	if sparse {
+		return copySparse(ctx, out, src, srcName)
+	}
+	return copyContents(ctx, out, src, srcName)
+}
+
+// copySparse copies the contents of the named file in src to dst, which is empty, cloning them if possible, and
+// otherwise writing only the ranges of data and truncating dst to the size of the file. If dst cannot seek or be
+// truncated, it copies all contents.
+func copySparse(ctx context.Context, dst File, src FS, name string) (err error) {
+	w, ok := dst.(io.WriteSeeker)
+	t, ok2 := dst.(TruncateFile)
+	if !ok || !ok2 {
+		return copyContents(ctx, dst, src, name)
+	}
+	in, err := OpenContext(ctx, src, name)
+	if err != nil {
+		return err
+	}
+	defer safeClose(in, &err)
+	if err := Clone(dst, in); !errors.Is(err, ErrUnsupported) {
+		return err
+	}
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	for off := int64(0); off < fi.Size(); {
+		data, err := SeekData(in, off)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		hole, err := SeekHole(in, data)
+		if err != nil {
+			return err
+		}
+		if _, err := Seek(in, data, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := w.Seek(data, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(w, contextReader{ctx, in}, hole-data); err != nil {
+			return err
+		}
+		off = hole
+	}
+	return t.Truncate(fi.Size())
+}
+
+// pathRel returns name relative to root, where name is root or a path inside it.
+func pathRel(root, name string) string {
+	if root == "." {
+		return name
+	}
+	if name == root {
+		return "."
+	}
+	return name[len(root)+1:]
+}
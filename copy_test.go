@@ -0,0 +1,47 @@
+package wrfs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+)
+
+func TestCopyFS(t *testing.T) {
+	src := newLowerFS(t)
+	check(t, Symlink(src, "file", "dir/link"))
+	dst := memfs.New()
+
+	err := CopyFS(dst, src, "dir")
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("copying a symlink: got error %v, want %v", err, ErrInvalid)
+	}
+
+	dst = memfs.New()
+	check(t, CopyFS(dst, src, "dir", CopySymlinks()))
+	checkContents(t, dst, "file", "lower")
+	checkContents(t, dst, "sub/file", "lower")
+	if link, err := Readlink(dst, "link"); err != nil || link != "file" {
+		t.Errorf("Readlink(link) = %q, %v; want %q", link, err, "file")
+	}
+
+	err = CopyFS(dst, src, "dir", CopySymlinks())
+	if !errors.Is(err, ErrExist) {
+		t.Errorf("copying over existing files: got error %v, want %v", err, ErrExist)
+	}
+	check(t, CopyFS(dst, src, "dir", CopySymlinks(), CopyOverwrite()))
+}
+
+func TestCopyFSContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dst := memfs.New()
+	if err := CopyFSContext(ctx, dst, newLowerFS(t), "dir"); !errors.Is(err, context.Canceled) {
+		t.Errorf("CopyFSContext with canceled context: got %v, want context.Canceled", err)
+	}
+	if err := RemoveAllContext(ctx, newLowerFS(t), "dir"); !errors.Is(err, context.Canceled) {
+		t.Errorf("RemoveAllContext with canceled context: got %v, want context.Canceled", err)
+	}
+}
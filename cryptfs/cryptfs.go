@@ -0,0 +1,498 @@
+// Package cryptfs encrypts the files of a wrfs file system.
+//
+// File contents are encrypted with AES-GCM in chunks of 64 KiB, each sealed with a fresh random nonce and
+// bound to its file and position, so that files can be read and written at random offsets and chunks cannot
+// be reordered or moved between files without detection. Each file starts with a header holding the ID of
+// the key it was encrypted with, so that keys can be rotated: new files are encrypted with the current key
+// of the KeyProvider, while existing files are decrypted with the key they were written with.
+//
+// Names can optionally be encrypted too, element by element, with a deterministic scheme so that files can be
+// looked up by name. Metadata, such as modes, times and the directory structure, is not encrypted. Truncating
+// a file at a chunk boundary, or replacing it with an older version, is not detected.
+package cryptfs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/relab/wrfs"
+)
+
+// ErrCorrupt is returned when a file or name cannot be decrypted, because it is not encrypted, is damaged,
+// or was encrypted with a different key.
+var ErrCorrupt = errors.New("cryptfs: corrupt or not encrypted")
+
+// A KeyProvider provides the keys used to encrypt and decrypt files. Keys must be 16, 24 or 32 bytes long,
+// to select AES-128, AES-192 or AES-256.
+type KeyProvider interface {
+	// CurrentKey returns the key used to encrypt new files, and its ID.
+	CurrentKey() (id uint32, key []byte, err error)
+
+	// Key returns the key with the given ID, used to decrypt existing files.
+	Key(id uint32) ([]byte, error)
+}
+
+// StaticKey returns a KeyProvider with the single key, with ID 0.
+func StaticKey(key []byte) KeyProvider {
+	return staticKey(key)
+}
+
+type staticKey []byte
+
+func (k staticKey) CurrentKey() (uint32, []byte, error) { return 0, k, nil }
+
+func (k staticKey) Key(id uint32) ([]byte, error) {
+	if id != 0 {
+		return nil, errors.New("cryptfs: unknown key ID " + strconv.FormatUint(uint64(id), 10))
+	}
+	return k, nil
+}
+
+// An Option configures New.
+type Option func(*config)
+
+type config struct {
+	encryptNames bool
+	nameKey      uint32
+}
+
+// EncryptNames makes New encrypt the names of files and directories, and the targets of symbolic links,
+// with the key with the given ID. Since names are looked up by their encrypted form, this key cannot be
+// rotated. Encrypted names are about 4/3 as long as the original names plus 38 bytes.
+func EncryptNames(keyID uint32) Option {
+	return func(c *config) { c.encryptNames, c.nameKey = true, keyID }
+}
+
+// New returns a file system that encrypts the contents of the files in fsys with keys from keys.
+// Files are decrypted when read through the returned file system, and Stat reports their decrypted size.
+// Opening a file for writing requires the files of fsys to implement io.ReaderAt, io.WriterAt and,
+// to truncate, wrfs.TruncateFile.
+func New(fsys wrfs.FS, keys KeyProvider, opts ...Option) wrfs.FS {
+	var c config
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return &cryptFS{fsys: fsys, keys: keys, config: c, aeads: make(map[uint32]cipher.AEAD)}
+}
+
+type cryptFS struct {
+	fsys wrfs.FS
+	keys KeyProvider
+	config
+
+	mu    sync.Mutex
+	aeads map[uint32]cipher.AEAD
+	names *nameCipher
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// aead returns the cipher for the key with the given ID.
+func (c *cryptFS) aead(id uint32) (cipher.AEAD, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if aead, ok := c.aeads[id]; ok {
+		return aead, nil
+	}
+	key, err := c.keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	c.aeads[id] = aead
+	return aead, nil
+}
+
+// currentAEAD returns the cipher for the current key, and its ID.
+func (c *cryptFS) currentAEAD() (uint32, cipher.AEAD, error) {
+	id, key, err := c.keys.CurrentKey()
+	if err != nil {
+		return 0, nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if aead, ok := c.aeads[id]; ok {
+		return id, aead, nil
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return 0, nil, err
+	}
+	c.aeads[id] = aead
+	return id, aead, nil
+}
+
+// A nameCipher encrypts names deterministically: the nonce is a MAC of the name, which is checked on decryption.
+type nameCipher struct {
+	aead cipher.AEAD
+	mac  []byte // key of the MAC deriving nonces
+}
+
+func (c *cryptFS) nameCipher() (*nameCipher, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.names != nil {
+		return c.names, nil
+	}
+	key, err := c.keys.Key(c.nameKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(derive(key, "wrfs/cryptfs name key"))
+	if err != nil {
+		return nil, err
+	}
+	c.names = &nameCipher{aead: aead, mac: derive(key, "wrfs/cryptfs name nonce")}
+	return c.names, nil
+}
+
+// derive derives a 32 byte subkey of key for the given purpose.
+func derive(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+func (n *nameCipher) nonce(name string) []byte {
+	mac := hmac.New(sha256.New, n.mac)
+	mac.Write([]byte(name))
+	return mac.Sum(nil)[:n.aead.NonceSize()]
+}
+
+func (n *nameCipher) encrypt(name string) string {
+	nonce := n.nonce(name)
+	return base64.RawURLEncoding.EncodeToString(n.aead.Seal(nonce, nonce, []byte(name), nil))
+}
+
+func (n *nameCipher) decrypt(name string) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(name)
+	if err != nil || len(data) < n.aead.NonceSize()+n.aead.Overhead() {
+		return "", ErrCorrupt
+	}
+	nonce := data[:n.aead.NonceSize()]
+	plain, err := n.aead.Open(nil, nonce, data[len(nonce):], nil)
+	if err != nil || !hmac.Equal(nonce, n.nonce(string(plain))) {
+		return "", ErrCorrupt
+	}
+	return string(plain), nil
+}
+
+// mapPath applies fn to the elements of name other than ".", ".." and the empty elements of absolute paths.
+func mapPath(name string, fn func(string) (string, error)) (string, error) {
+	elems := strings.Split(name, "/")
+	for i, elem := range elems {
+		if elem == "" || elem == "." || elem == ".." {
+			continue
+		}
+		var err error
+		if elems[i], err = fn(elem); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(elems, "/"), nil
+}
+
+// path returns the name under which the named file is stored in c.fsys.
+func (c *cryptFS) path(op, name string) (string, error) {
+	if !c.encryptNames || !wrfs.ValidPath(name) {
+		return name, nil
+	}
+	n, err := c.nameCipher()
+	if err != nil {
+		return "", &wrfs.PathError{Op: op, Path: name, Err: err}
+	}
+	return mapPath(name, func(elem string) (string, error) { return n.encrypt(elem), nil })
+}
+
+// paths is like path for operations on two paths.
+func (c *cryptFS) paths(op, oldname, newname string) (string, string, error) {
+	oldpath, err := c.path(op, oldname)
+	if err != nil {
+		return "", "", err
+	}
+	newpath, err := c.path(op, newname)
+	if err != nil {
+		return "", "", err
+	}
+	return oldpath, newpath, nil
+}
+
+// pathErr replaces the encrypted names in err, returned by an operation on c.fsys, with the given names.
+func (c *cryptFS) pathErr(err error, name string) error {
+	if pe, ok := err.(*wrfs.PathError); ok && c.encryptNames {
+		return &wrfs.PathError{Op: pe.Op, Path: name, Err: pe.Err}
+	}
+	return err
+}
+
+func (c *cryptFS) linkErr(err error, oldname, newname string) error {
+	if le, ok := err.(*wrfs.LinkError); ok && c.encryptNames {
+		return &wrfs.LinkError{Op: le.Op, Old: oldname, New: newname, Err: le.Err}
+	}
+	return c.pathErr(err, oldname)
+}
+
+// decryptName returns the original of an encrypted name element.
+func (c *cryptFS) decryptName(name string) (string, error) {
+	if !c.encryptNames {
+		return name, nil
+	}
+	n, err := c.nameCipher()
+	if err != nil {
+		return "", err
+	}
+	return n.decrypt(name)
+}
+
+func (c *cryptFS) Open(name string) (wrfs.File, error) {
+	return c.OpenFile(name, wrfs.O_RDONLY, 0)
+}
+
+func (c *cryptFS) OpenFile(name string, flag int, perm wrfs.FileMode) (wrfs.File, error) {
+	p, err := c.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	writable := flag&(wrfs.O_WRONLY|wrfs.O_RDWR) != 0
+	innerFlag := flag
+	if writable {
+		// Writes read and rewrite whole chunks at explicit offsets.
+		innerFlag = flag&^(wrfs.O_WRONLY|wrfs.O_APPEND) | wrfs.O_RDWR
+	}
+	var file wrfs.File
+	if innerFlag == wrfs.O_RDONLY {
+		file, err = c.fsys.Open(p)
+	} else {
+		file, err = wrfs.OpenFile(c.fsys, p, innerFlag, perm)
+	}
+	if err != nil {
+		return nil, c.pathErr(err, name)
+	}
+	f, err := c.newFile(file, name, flag)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (c *cryptFS) Stat(name string) (wrfs.FileInfo, error) {
+	p, err := c.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := wrfs.Stat(c.fsys, p)
+	if err != nil {
+		return nil, c.pathErr(err, name)
+	}
+	return c.fileInfo(fi, path.Base(name)), nil
+}
+
+func (c *cryptFS) Lstat(name string) (wrfs.FileInfo, error) {
+	p, err := c.path("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := wrfs.Lstat(c.fsys, p)
+	if err != nil {
+		return nil, c.pathErr(err, name)
+	}
+	return c.fileInfo(fi, path.Base(name)), nil
+}
+
+func (c *cryptFS) ReadDir(name string) ([]wrfs.DirEntry, error) {
+	p, err := c.path("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := wrfs.ReadDir(c.fsys, p)
+	if err != nil {
+		return nil, c.pathErr(err, name)
+	}
+	if entries, err = c.dirEntries(entries); err != nil {
+		return nil, &wrfs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if c.encryptNames {
+		// Restore the order by name, which the encrypted names do not preserve.
+		sortEntries(entries)
+	}
+	return entries, nil
+}
+
+func (c *cryptFS) Chmod(name string, mode wrfs.FileMode) error {
+	p, err := c.path("chmod", name)
+	if err != nil {
+		return err
+	}
+	return c.pathErr(wrfs.Chmod(c.fsys, p, mode), name)
+}
+
+func (c *cryptFS) Chown(name string, uid, gid int) error {
+	p, err := c.path("chown", name)
+	if err != nil {
+		return err
+	}
+	return c.pathErr(wrfs.Chown(c.fsys, p, uid, gid), name)
+}
+
+func (c *cryptFS) Lchown(name string, uid, gid int) error {
+	p, err := c.path("lchown", name)
+	if err != nil {
+		return err
+	}
+	return c.pathErr(wrfs.Lchown(c.fsys, p, uid, gid), name)
+}
+
+func (c *cryptFS) Chtimes(name string, atime, mtime time.Time) error {
+	p, err := c.path("chtimes", name)
+	if err != nil {
+		return err
+	}
+	return c.pathErr(wrfs.Chtimes(c.fsys, p, atime, mtime), name)
+}
+
+func (c *cryptFS) Mkdir(name string, perm wrfs.FileMode) error {
+	p, err := c.path("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return c.pathErr(wrfs.Mkdir(c.fsys, p, perm), name)
+}
+
+func (c *cryptFS) MkdirAll(name string, perm wrfs.FileMode) error {
+	p, err := c.path("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return c.pathErr(wrfs.MkdirAll(c.fsys, p, perm), name)
+}
+
+func (c *cryptFS) Remove(name string) error {
+	p, err := c.path("remove", name)
+	if err != nil {
+		return err
+	}
+	return c.pathErr(wrfs.Remove(c.fsys, p), name)
+}
+
+func (c *cryptFS) RemoveAll(name string) error {
+	p, err := c.path("removeall", name)
+	if err != nil {
+		return err
+	}
+	return c.pathErr(wrfs.RemoveAll(c.fsys, p), name)
+}
+
+func (c *cryptFS) Rename(oldname, newname string) error {
+	oldpath, newpath, err := c.paths("rename", oldname, newname)
+	if err != nil {
+		return err
+	}
+	return c.linkErr(wrfs.Rename(c.fsys, oldpath, newpath), oldname, newname)
+}
+
+func (c *cryptFS) Link(oldname, newname string) error {
+	oldpath, newpath, err := c.paths("link", oldname, newname)
+	if err != nil {
+		return err
+	}
+	return c.linkErr(wrfs.Link(c.fsys, oldpath, newpath), oldname, newname)
+}
+
+// Symlink creates newname as a symbolic link to oldname. If names are encrypted, the elements of oldname are
+// encrypted too, so that the link resolves in the underlying file system.
+func (c *cryptFS) Symlink(oldname, newname string) error {
+	newpath, err := c.path("symlink", newname)
+	if err != nil {
+		return err
+	}
+	target := oldname
+	if c.encryptNames {
+		n, err := c.nameCipher()
+		if err != nil {
+			return &wrfs.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+		}
+		target, _ = mapPath(oldname, func(elem string) (string, error) { return n.encrypt(elem), nil })
+	}
+	return c.linkErr(wrfs.Symlink(c.fsys, target, newpath), oldname, newname)
+}
+
+func (c *cryptFS) Readlink(name string) (string, error) {
+	p, err := c.path("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	target, err := wrfs.Readlink(c.fsys, p)
+	if err != nil {
+		return "", c.pathErr(err, name)
+	}
+	if target, err = mapPath(target, c.decryptName); err != nil {
+		return "", &wrfs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return target, nil
+}
+
+func (c *cryptFS) SameFile(fi1, fi2 wrfs.FileInfo) bool {
+	if fi, ok := fi1.(*fileInfo); ok {
+		fi1 = fi.FileInfo
+	}
+	if fi, ok := fi2.(*fileInfo); ok {
+		fi2 = fi.FileInfo
+	}
+	return wrfs.SameFile(c.fsys, fi1, fi2)
+}
+
+func (c *cryptFS) Sync(name string) error {
+	p, err := c.path("sync", name)
+	if err != nil {
+		return err
+	}
+	return c.pathErr(wrfs.Sync(c.fsys, p), name)
+}
+
+func (c *cryptFS) Statfs(name string) (wrfs.FSInfo, error) {
+	p, err := c.path("statfs", name)
+	if err != nil {
+		return wrfs.FSInfo{}, err
+	}
+	info, err := wrfs.Statfs(c.fsys, p)
+	return info, c.pathErr(err, name)
+}
+
+// Truncate truncates the named file through an open file, so that its last chunk is re-encrypted.
+func (c *cryptFS) Truncate(name string, size int64) (err error) {
+	f, err := c.OpenFile(name, wrfs.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	return f.(*file).Truncate(size)
+}
+
+// Capabilities returns the capabilities of the underlying file system, except locking and watching,
+// which are not supported.
+func (c *cryptFS) Capabilities() wrfs.CapSet {
+	return wrfs.Capabilities(c.fsys) &^ (wrfs.CapLock | wrfs.CapWatch | wrfs.CapMkfifo | wrfs.CapMknod | wrfs.CapLchtimes | wrfs.CapSyncDir)
+}
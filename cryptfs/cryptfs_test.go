@@ -0,0 +1,169 @@
+package cryptfs_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/cryptfs"
+	"github.com/relab/wrfs/memfs"
+	"github.com/relab/wrfs/wrfstest"
+)
+
+var key = bytes.Repeat([]byte{1}, 32)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteFS(t *testing.T) {
+	if err := wrfstest.TestWriteFS(cryptfs.New(memfs.New(), cryptfs.StaticKey(key))); err != nil {
+		t.Fatal(err)
+	}
+	if err := wrfstest.TestWriteFS(cryptfs.New(memfs.New(), cryptfs.StaticKey(key), cryptfs.EncryptNames(0))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDifferential(t *testing.T) {
+	for seed := int64(0); seed < 10; seed++ {
+		fsys := cryptfs.New(memfs.New(), cryptfs.StaticKey(key), cryptfs.EncryptNames(0))
+		if err := wrfstest.TestDifferential(fsys, seed, 200); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestContents(t *testing.T) {
+	lower := memfs.New()
+	fsys := cryptfs.New(lower, cryptfs.StaticKey(key))
+
+	data := make([]byte, 200<<10)
+	rand.New(rand.NewSource(1)).Read(data)
+	check(t, wrfs.WriteFile(fsys, "file", data, 0644))
+
+	raw, err := wrfs.ReadFile(lower, "file")
+	check(t, err)
+	if bytes.Contains(raw, data[:64]) {
+		t.Error("file is stored in plain text")
+	}
+	got, err := wrfs.ReadFile(fsys, "file")
+	check(t, err)
+	if !bytes.Equal(got, data) {
+		t.Fatal("ReadFile returned different data")
+	}
+	fi, err := wrfs.Stat(fsys, "file")
+	check(t, err)
+	if fi.Size() != int64(len(data)) {
+		t.Errorf("Size() = %d, want %d", fi.Size(), len(data))
+	}
+
+	// Overwrite across a chunk boundary, write beyond the end and truncate.
+	f, err := wrfs.OpenFile(fsys, "file", wrfs.O_RDWR, 0)
+	check(t, err)
+	w := f.(io.WriterAt)
+	_, err = w.WriteAt([]byte("boundary"), 64<<10-4)
+	check(t, err)
+	copy(data[64<<10-4:], "boundary")
+	_, err = w.WriteAt([]byte("end"), 300<<10)
+	check(t, err)
+	data = append(data, make([]byte, 100<<10)...)
+	data = append(data, "end"...)
+	check(t, f.(wrfs.TruncateFile).Truncate(100<<10+1))
+	data = data[:100<<10+1]
+	check(t, f.Close())
+
+	got, err = wrfs.ReadFile(fsys, "file")
+	check(t, err)
+	if !bytes.Equal(got, data) {
+		t.Fatal("ReadFile returned different data after modifications")
+	}
+
+	// Modifying the stored file is detected.
+	raw, err = wrfs.ReadFile(lower, "file")
+	check(t, err)
+	raw[len(raw)-1] ^= 1
+	check(t, wrfs.WriteFile(lower, "file", raw, 0644))
+	if _, err := wrfs.ReadFile(fsys, "file"); !errors.Is(err, cryptfs.ErrCorrupt) {
+		t.Errorf("ReadFile of modified file: got %v, want ErrCorrupt", err)
+	}
+}
+
+func TestNames(t *testing.T) {
+	lower := memfs.New()
+	fsys := cryptfs.New(lower, cryptfs.StaticKey(key), cryptfs.EncryptNames(0))
+
+	check(t, wrfs.MkdirAll(fsys, "dir/sub", 0755))
+	check(t, wrfs.WriteFile(fsys, "dir/sub/file", []byte("data"), 0644))
+	check(t, wrfs.Symlink(fsys, "sub/file", "dir/link"))
+
+	var stored []string
+	check(t, wrfs.WalkDir(lower, ".", func(name string, d wrfs.DirEntry, err error) error {
+		stored = append(stored, name)
+		return err
+	}))
+	if s := strings.Join(stored, " "); strings.Contains(s, "dir") || strings.Contains(s, "file") {
+		t.Errorf("names are stored in plain text: %s", s)
+	}
+
+	entries, err := wrfs.ReadDir(fsys, "dir")
+	check(t, err)
+	if len(entries) != 2 || entries[0].Name() != "link" || entries[1].Name() != "sub" {
+		t.Errorf("ReadDir(dir) = %v, want [link sub]", entries)
+	}
+	target, err := wrfs.Readlink(fsys, "dir/link")
+	check(t, err)
+	if target != "sub/file" {
+		t.Errorf("Readlink = %q, want %q", target, "sub/file")
+	}
+	data, err := wrfs.ReadFile(fsys, "dir/link")
+	check(t, err)
+	if string(data) != "data" {
+		t.Errorf("ReadFile through link = %q, want %q", data, "data")
+	}
+	var pe *wrfs.PathError
+	if _, err := wrfs.Stat(fsys, "dir/missing"); !errors.As(err, &pe) || pe.Path != "dir/missing" {
+		t.Errorf("Stat of missing file: got %v, want error for dir/missing", err)
+	}
+}
+
+// rotatingKeys is a KeyProvider whose current key is the last one.
+type rotatingKeys [][]byte
+
+func (k rotatingKeys) CurrentKey() (uint32, []byte, error) {
+	return uint32(len(k) - 1), k[len(k)-1], nil
+}
+
+func (k rotatingKeys) Key(id uint32) ([]byte, error) {
+	if int(id) >= len(k) {
+		return nil, errors.New("unknown key")
+	}
+	return k[id], nil
+}
+
+func TestKeyRotation(t *testing.T) {
+	lower := memfs.New()
+	keys := rotatingKeys{key}
+	check(t, wrfs.WriteFile(cryptfs.New(lower, keys), "old", []byte("old"), 0644))
+
+	keys = append(keys, bytes.Repeat([]byte{2}, 16))
+	fsys := cryptfs.New(lower, keys)
+	check(t, wrfs.WriteFile(fsys, "new", []byte("new"), 0644))
+	for _, name := range []string{"old", "new"} {
+		data, err := wrfs.ReadFile(fsys, name)
+		check(t, err)
+		if string(data) != name {
+			t.Errorf("ReadFile(%s) = %q", name, data)
+		}
+	}
+	if _, err := wrfs.ReadFile(cryptfs.New(lower, cryptfs.StaticKey(key)), "new"); err == nil {
+		t.Error("ReadFile with the old key succeeded")
+	}
+}
@@ -0,0 +1,442 @@
+package cryptfs
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// An encrypted file consists of a header followed by chunks. The header holds a magic number, the ID of the
+// key and a random file ID. Each chunk holds a random nonce followed by up to chunkSize bytes of sealed data,
+// authenticated together with the file ID and the index of the chunk. Empty files have no header.
+const (
+	magic      = "wrfsenc1"
+	headerSize = len(magic) + 4 + 16
+	chunkSize  = 64 << 10
+	nonceSize  = 12
+	tagSize    = 16
+	overhead   = nonceSize + tagSize
+	sealedSize = chunkSize + overhead
+)
+
+// plainSize returns the size of the contents of an encrypted file of the given size.
+func plainSize(size int64) int64 {
+	if size <= int64(headerSize) {
+		return 0
+	}
+	size -= int64(headerSize)
+	n := size / sealedSize * chunkSize
+	if rem := size % sealedSize; rem > overhead {
+		n += rem - overhead
+	}
+	return n
+}
+
+// fileInfo reports the name and the decrypted size of a file.
+type fileInfo struct {
+	wrfs.FileInfo
+	name string
+}
+
+func (fi *fileInfo) Name() string { return fi.name }
+
+func (fi *fileInfo) Size() int64 {
+	if !fi.Mode().IsRegular() {
+		return fi.FileInfo.Size()
+	}
+	return plainSize(fi.FileInfo.Size())
+}
+
+func (c *cryptFS) fileInfo(fi wrfs.FileInfo, name string) wrfs.FileInfo {
+	if !c.encryptNames || name == "." {
+		name = fi.Name()
+	}
+	return &fileInfo{fi, name}
+}
+
+// dirEntry reports the decrypted name and size of a directory entry.
+type dirEntry struct {
+	wrfs.DirEntry
+	name string
+	fs   *cryptFS
+}
+
+func (d *dirEntry) Name() string { return d.name }
+
+func (d *dirEntry) Info() (wrfs.FileInfo, error) {
+	fi, err := d.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return d.fs.fileInfo(fi, d.name), nil
+}
+
+func (c *cryptFS) dirEntries(entries []wrfs.DirEntry) ([]wrfs.DirEntry, error) {
+	for i, e := range entries {
+		name, err := c.decryptName(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = &dirEntry{e, name, c}
+	}
+	return entries, nil
+}
+
+func sortEntries(entries []wrfs.DirEntry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+}
+
+// file is a file opened through a cryptFS. Directories are passed through, with their entries decrypted.
+type file struct {
+	fs   *cryptFS
+	file wrfs.File
+	name string
+	flag int
+
+	mu   sync.Mutex
+	aead cipher.AEAD // nil until the header has been read or written
+	id   [16]byte
+	size int64
+	off  int64
+}
+
+func (c *cryptFS) newFile(inner wrfs.File, name string, flag int) (*file, error) {
+	f := &file{fs: c, file: inner, name: name, flag: flag}
+	fi, err := inner.Stat()
+	if err != nil {
+		return nil, c.pathErr(err, name)
+	}
+	if fi.IsDir() {
+		return f, nil
+	}
+	r, ok := inner.(io.ReaderAt)
+	if !ok {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrUnsupported}
+	}
+	if _, ok := inner.(io.WriterAt); !ok && f.writable() {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrUnsupported}
+	}
+	if fi.Size() == 0 {
+		return f, nil
+	}
+	var hdr [headerSize]byte
+	if _, err := r.ReadAt(hdr[:], 0); err != nil {
+		if err == io.EOF {
+			err = ErrCorrupt
+		}
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if string(hdr[:len(magic)]) != magic {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: ErrCorrupt}
+	}
+	if f.aead, err = c.aead(binary.BigEndian.Uint32(hdr[len(magic):])); err != nil {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: err}
+	}
+	copy(f.id[:], hdr[len(magic)+4:])
+	f.size = plainSize(fi.Size())
+	return f, nil
+}
+
+func (f *file) readable() bool {
+	return f.flag&(wrfs.O_WRONLY|wrfs.O_RDWR) != wrfs.O_WRONLY
+}
+
+func (f *file) writable() bool {
+	return f.flag&(wrfs.O_WRONLY|wrfs.O_RDWR) != 0
+}
+
+// header writes the header of an empty file, encrypting it with the current key.
+func (f *file) header(op string) error {
+	if f.aead != nil {
+		return nil
+	}
+	id, aead, err := f.fs.currentAEAD()
+	if err != nil {
+		return &wrfs.PathError{Op: op, Path: f.name, Err: err}
+	}
+	var hdr [headerSize]byte
+	copy(hdr[:], magic)
+	binary.BigEndian.PutUint32(hdr[len(magic):], id)
+	if _, err := rand.Read(hdr[len(magic)+4:]); err != nil {
+		return &wrfs.PathError{Op: op, Path: f.name, Err: err}
+	}
+	if _, err := f.file.(io.WriterAt).WriteAt(hdr[:], 0); err != nil {
+		return f.fs.pathErr(err, f.name)
+	}
+	f.aead = aead
+	copy(f.id[:], hdr[len(magic)+4:])
+	return nil
+}
+
+// additionalData returns the data authenticated with chunk i.
+func (f *file) additionalData(i int64) []byte {
+	ad := make([]byte, len(f.id)+8)
+	copy(ad, f.id[:])
+	binary.BigEndian.PutUint64(ad[len(f.id):], uint64(i))
+	return ad
+}
+
+// readChunk returns the decrypted contents of chunk i, which must exist.
+func (f *file) readChunk(op string, i int64) ([]byte, error) {
+	buf := make([]byte, sealedSize)
+	n, err := f.file.(io.ReaderAt).ReadAt(buf, int64(headerSize)+i*sealedSize)
+	if err != nil && err != io.EOF {
+		return nil, f.fs.pathErr(err, f.name)
+	}
+	if n < overhead {
+		return nil, &wrfs.PathError{Op: op, Path: f.name, Err: ErrCorrupt}
+	}
+	plain, err := f.aead.Open(buf[nonceSize:nonceSize], buf[:nonceSize], buf[nonceSize:n], f.additionalData(i))
+	if err != nil {
+		return nil, &wrfs.PathError{Op: op, Path: f.name, Err: ErrCorrupt}
+	}
+	return plain, nil
+}
+
+// writeChunk encrypts plain with a fresh nonce and stores it as chunk i.
+func (f *file) writeChunk(op string, i int64, plain []byte) error {
+	buf := make([]byte, nonceSize, nonceSize+len(plain)+tagSize)
+	if _, err := rand.Read(buf); err != nil {
+		return &wrfs.PathError{Op: op, Path: f.name, Err: err}
+	}
+	buf = f.aead.Seal(buf, buf, plain, f.additionalData(i))
+	if _, err := f.file.(io.WriterAt).WriteAt(buf, int64(headerSize)+i*sealedSize); err != nil {
+		return f.fs.pathErr(err, f.name)
+	}
+	return nil
+}
+
+func (f *file) Stat() (wrfs.FileInfo, error) {
+	fi, err := f.file.Stat()
+	if err != nil {
+		return nil, f.fs.pathErr(err, f.name)
+	}
+	return f.fs.fileInfo(fi, path.Base(f.name)), nil
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.readAt("read", p, f.off)
+	f.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &wrfs.PathError{Op: "readat", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.readAt("readat", p, off)
+}
+
+func (f *file) readAt(op string, p []byte, off int64) (int, error) {
+	if !f.readable() {
+		return 0, &wrfs.PathError{Op: op, Path: f.name, Err: errno.EBADF}
+	}
+	n := 0
+	for n < len(p) && off < f.size {
+		plain, err := f.readChunk(op, off/chunkSize)
+		if err != nil {
+			return n, err
+		}
+		m := copy(p[n:], plain[off%chunkSize:])
+		n += m
+		off += int64(m)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *file) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.flag&wrfs.O_APPEND != 0 {
+		f.off = f.size
+	}
+	n, err := f.writeAt("write", p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *file) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || f.flag&wrfs.O_APPEND != 0 {
+		return 0, &wrfs.PathError{Op: "writeat", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writeAt("writeat", p, off)
+}
+
+func (f *file) writeAt(op string, p []byte, off int64) (int, error) {
+	if !f.writable() {
+		return 0, &wrfs.PathError{Op: op, Path: f.name, Err: errno.EBADF}
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := f.header(op); err != nil {
+		return 0, err
+	}
+	// Fill the gap between the end of the file and off with zeros, one chunk at a time.
+	for f.size < off {
+		zeros := make([]byte, min(off-f.size, chunkSize-f.size%chunkSize))
+		if _, err := f.writeChunks(op, zeros, f.size); err != nil {
+			return 0, err
+		}
+	}
+	return f.writeChunks(op, p, off)
+}
+
+// writeChunks writes p at off, which must not be beyond the end of the file, by rewriting the chunks it covers.
+func (f *file) writeChunks(op string, p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		i, start := off/chunkSize, int(off%chunkSize)
+		var plain []byte
+		if i*chunkSize < f.size {
+			var err error
+			if plain, err = f.readChunk(op, i); err != nil {
+				return n, err
+			}
+		}
+		m := min(len(p)-n, chunkSize-start)
+		if len(plain) < start+m {
+			plain = append(plain, make([]byte, start+m-len(plain))...)
+		}
+		copy(plain[start:], p[n:n+m])
+		if err := f.writeChunk(op, i, plain); err != nil {
+			return n, err
+		}
+		n += m
+		off += int64(m)
+		if off > f.size {
+			f.size = off
+		}
+	}
+	return n, nil
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += f.size
+	case io.SeekStart:
+	default:
+		return 0, &wrfs.PathError{Op: "seek", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &wrfs.PathError{Op: "seek", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+// Truncate changes the size of the file, re-encrypting its new last chunk if it is cut in the middle.
+func (f *file) Truncate(size int64) error {
+	if size < 0 {
+		return &wrfs.PathError{Op: "truncate", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	t, ok := f.file.(wrfs.TruncateFile)
+	if !ok {
+		return &wrfs.PathError{Op: "truncate", Path: f.name, Err: wrfs.ErrUnsupported}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.writable() {
+		return &wrfs.PathError{Op: "truncate", Path: f.name, Err: errno.EBADF}
+	}
+	switch {
+	case size > f.size:
+		if err := f.header("truncate"); err != nil {
+			return err
+		}
+		for f.size < size {
+			zeros := make([]byte, min(size-f.size, chunkSize-f.size%chunkSize))
+			if _, err := f.writeChunks("truncate", zeros, f.size); err != nil {
+				return err
+			}
+		}
+		return nil
+	case size == f.size:
+		return nil
+	case size == 0:
+		f.aead, f.size = nil, 0
+		return f.fs.pathErr(t.Truncate(0), f.name)
+	}
+	last := (size - 1) / chunkSize
+	if rem := int(size - last*chunkSize); rem < chunkSize {
+		plain, err := f.readChunk("truncate", last)
+		if err != nil {
+			return err
+		}
+		if err := f.writeChunk("truncate", last, plain[:rem]); err != nil {
+			return err
+		}
+	}
+	f.size = size
+	return f.fs.pathErr(t.Truncate(int64(headerSize)+last*sealedSize+(size-last*chunkSize)+overhead), f.name)
+}
+
+func (f *file) ReadDir(n int) ([]wrfs.DirEntry, error) {
+	dir, ok := f.file.(wrfs.ReadDirFile)
+	if !ok {
+		return nil, &wrfs.PathError{Op: "readdir", Path: f.name, Err: wrfs.ErrUnsupported}
+	}
+	entries, err := dir.ReadDir(n)
+	if err != nil {
+		return entries, f.fs.pathErr(err, f.name)
+	}
+	if entries, err = f.fs.dirEntries(entries); err != nil {
+		return nil, &wrfs.PathError{Op: "readdir", Path: f.name, Err: err}
+	}
+	return entries, nil
+}
+
+func (f *file) Close() error { return f.fs.pathErr(f.file.Close(), f.name) }
+
+func (f *file) Chmod(mode wrfs.FileMode) error {
+	if file, ok := f.file.(wrfs.ChmodFile); ok {
+		return f.fs.pathErr(file.Chmod(mode), f.name)
+	}
+	return &wrfs.PathError{Op: "chmod", Path: f.name, Err: wrfs.ErrUnsupported}
+}
+
+func (f *file) Chown(uid, gid int) error {
+	if file, ok := f.file.(wrfs.ChownFile); ok {
+		return f.fs.pathErr(file.Chown(uid, gid), f.name)
+	}
+	return &wrfs.PathError{Op: "chown", Path: f.name, Err: wrfs.ErrUnsupported}
+}
+
+func (f *file) Chtimes(atime, mtime time.Time) error {
+	if file, ok := f.file.(wrfs.ChtimesFile); ok {
+		return f.fs.pathErr(file.Chtimes(atime, mtime), f.name)
+	}
+	return &wrfs.PathError{Op: "chtimes", Path: f.name, Err: wrfs.ErrUnsupported}
+}
+
+func (f *file) Sync() error {
+	if file, ok := f.file.(wrfs.SyncFile); ok {
+		return f.fs.pathErr(file.Sync(), f.name)
+	}
+	return &wrfs.PathError{Op: "sync", Path: f.name, Err: wrfs.ErrUnsupported}
+}
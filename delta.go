@@ -0,0 +1,104 @@
+package wrfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+)
+
+// DefaultDeltaBlockSize is the block size used by DeltaCopy when blockSize is not positive.
+const DefaultDeltaBlockSize = 128 << 10
+
+// DeltaCopy updates the named file in dst to match the named file in src, writing only the blocks that differ.
+// It first computes a signature of each blockSize block of the destination file, then reads the source file
+// and writes each block whose signature does not match at the same offset in the destination,
+// and finally truncates the destination if it is longer than the source. If the destination does not exist, it is
+// created and the whole source is copied. DeltaCopy returns the number of bytes written to dst.
+//
+// DeltaCopy uses WriteAt on the destination file if it is supported, and otherwise Seek and Write.
+// This greatly reduces the number of bytes written for large files with small changes on slow backends.
+func DeltaCopy(dst, src FS, name string, blockSize int) (written int64, err error) {
+	if blockSize <= 0 {
+		blockSize = DefaultDeltaBlockSize
+	}
+
+	sigs, err := blockSignatures(dst, name, blockSize)
+	if err != nil {
+		return 0, err
+	}
+
+	in, err := src.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer safeClose(in, &err)
+
+	out, err := OpenFile(dst, name, O_WRONLY|O_CREATE, 0666)
+	if err != nil {
+		return 0, err
+	}
+	defer safeClose(out, &err)
+	fi, err := out.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	block := make([]byte, blockSize)
+	var off int64
+	for i := 0; ; i++ {
+		n, err := io.ReadFull(in, block)
+		if n > 0 {
+			sum := sha256.Sum256(block[:n])
+			if i >= len(sigs) || !bytes.Equal(sigs[i], sum[:]) {
+				if _, err := WriteAt(out, block[:n], off); err != nil {
+					return written, err
+				}
+				written += int64(n)
+			}
+			off += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+
+	if fi.Size() <= off {
+		return written, nil
+	}
+	if file, ok := out.(TruncateFile); ok {
+		return written, file.Truncate(off)
+	}
+	return written, Truncate(dst, name, off)
+}
+
+// blockSignatures returns the SHA-256 hash of each blockSize block of the named file,
+// or no hashes if the file does not exist.
+func blockSignatures(fsys FS, name string, blockSize int) (sigs [][]byte, err error) {
+	file, err := fsys.Open(name)
+	if errors.Is(err, ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer safeClose(file, &err)
+
+	block := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(file, block)
+		if n > 0 {
+			sum := sha256.Sum256(block[:n])
+			sigs = append(sigs, sum[:])
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sigs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,40 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wrfs_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestDeltaCopy(t *testing.T) {
+	src, dst := getFS(t), getFS(t)
+	fileName := "TestDeltaCopy"
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64)
+
+	writeFile(t, src, fileName, data)
+	n, err := DeltaCopy(dst, src, fileName, 256)
+	check(t, err)
+	if n != int64(len(data)) {
+		t.Errorf("initial copy wrote %d bytes, want %d", n, len(data))
+	}
+
+	data[300] = 'X'
+	data = data[:900]
+	writeFile(t, src, fileName, data)
+	n, err = DeltaCopy(dst, src, fileName, 256)
+	check(t, err)
+	// the modified block and the shortened last block
+	if n != 256+132 {
+		t.Errorf("delta copy wrote %d bytes, want %d", n, 256+132)
+	}
+
+	got, err := ReadFile(dst, fileName)
+	check(t, err)
+	if !bytes.Equal(got, data) {
+		t.Error("destination does not match source")
+	}
+}
@@ -2,6 +2,9 @@ package wrfs
 
 import (
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -12,7 +15,7 @@ import (
 // same as os.Open("/prefix/file"). So if /prefix/file is a symbolic link pointing outside
 // the /prefix tree, then using DirFS does not stop the access any more than using
 // os.Open does. DirFS is therefore not a general substitute for a chroot-style security
-// mechanism when the directory tree contains arbitrary content.
+// mechanism when the directory tree contains arbitrary content; use SecureDirFS for that.
 func DirFS(dir string) FS {
 	return &subFS{fsys: hostFS{}, dir: dir}
 }
@@ -51,6 +54,58 @@ func (hostFS) OpenFile(name string, flag int, perm FileMode) (File, error) {
 	return file, nil
 }
 
+func (hostFS) ReadDir(name string) ([]DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (hostFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+// Glob returns the names matching pattern, using the syntax of path.Match, with filepath.Glob.
+func (hostFS) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(hostPattern(pattern))
+	for i, match := range matches {
+		matches[i] = filepath.ToSlash(match)
+	}
+	return matches, err
+}
+
+// hostPattern translates a pattern in the syntax of path.Match to that of filepath.Match. They only differ on
+// Windows, where "\" separates path elements instead of escaping characters, so that escaped characters are
+// translated to character classes.
+func hostPattern(pattern string) string {
+	if filepath.Separator == '/' {
+		return pattern
+	}
+	var b strings.Builder
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			if c = pattern[i]; !inClass && strings.IndexByte("*?[", c) >= 0 {
+				b.WriteString("[" + string(c) + "]")
+			} else {
+				b.WriteByte(c)
+			}
+		case c == '/':
+			b.WriteByte(filepath.Separator)
+		default:
+			if c == '[' {
+				inClass = true
+			} else if c == ']' {
+				inClass = false
+			}
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
 func (hostFS) Stat(name string) (FileInfo, error) {
 	fi, err := os.Stat(name)
 	if err != nil {
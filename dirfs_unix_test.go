@@ -0,0 +1,34 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wrfs_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestDirFSReadDirGlob(t *testing.T) {
+	fsys := getFS(t)
+	check(t, MkdirAll(fsys, "dir/sub", 0755))
+	writeFile(t, fsys, "dir/a.txt", []byte("a"))
+	writeFile(t, fsys, "dir/sub/b.txt", []byte("b"))
+	writeFile(t, fsys, "dir/*.txt", []byte("star"))
+
+	matches, err := Glob(fsys, "dir/*/*.txt")
+	check(t, err)
+	if len(matches) != 1 || matches[0] != "dir/sub/b.txt" {
+		t.Errorf("Glob(dir/*/*.txt) = %v, want [dir/sub/b.txt]", matches)
+	}
+	matches, err = Glob(fsys, `dir/\*.txt`)
+	check(t, err)
+	if len(matches) != 1 || matches[0] != "dir/*.txt" {
+		t.Errorf("Glob(dir/\\*.txt) = %v, want [dir/*.txt]", matches)
+	}
+	if _, err := Glob(fsys, "dir/["); err == nil {
+		t.Error("Glob with malformed pattern succeeded")
+	}
+	check(t, fstest.TestFS(fsys, "dir/a.txt", "dir/sub/b.txt"))
+}
@@ -0,0 +1,82 @@
+package wrfs
+
+import "path"
+
+// DirUsage is the space taken up by the files and directories in a directory, as computed by DiskUsage.
+type DirUsage struct {
+	Bytes int64 // the total size of the files, or of their allocated blocks with DiskUsageBlocks
+	Files int   // the number of files other than directories
+	Dirs  int   // the number of directories
+}
+
+// Usage is the space taken up by the files and directories in a tree, as computed by DiskUsage.
+type Usage struct {
+	DirUsage                     // the usage of the tree as a whole
+	ByDir    map[string]DirUsage // the usage of each directory of the tree, including its root, by path
+}
+
+// A DiskUsageOption configures DiskUsage.
+type DiskUsageOption func(*diskUsageConfig)
+
+type diskUsageConfig struct {
+	blocks bool
+}
+
+// DiskUsageBlocks makes DiskUsage count the space allocated to files on disk, as reported by the system-specific
+// Sys data of their FileInfos, rather than their sizes. Files without such data, such as those of file systems
+// other than the host's, are counted with their sizes.
+func DiskUsageBlocks() DiskUsageOption {
+	return func(c *diskUsageConfig) { c.blocks = true }
+}
+
+// DiskUsage walks the tree rooted at root and returns the space taken up by it and each directory in it, like
+// du(1) does. The usage of a directory includes the files and directories inside it, recursively, but not the
+// directory itself, whose size is not counted. Symbolic links are counted as files and not followed, and files
+// with several hard links are counted once per link.
+//
+// If walking the tree fails, DiskUsage returns the usage computed so far along with the error.
+func DiskUsage(fsys FS, root string, opts ...DiskUsageOption) (Usage, error) {
+	var c diskUsageConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	root = path.Clean(root)
+	usage := Usage{ByDir: make(map[string]DirUsage)}
+	err := WalkDir(fsys, root, func(name string, d DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == root {
+			usage.ByDir[root] = DirUsage{}
+			return nil
+		}
+		var u DirUsage
+		if d.IsDir() {
+			u.Dirs = 1
+			usage.ByDir[name] = DirUsage{}
+		} else {
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			u.Files, u.Bytes = 1, fi.Size()
+			if blocks, ok := allocated(fi); ok && c.blocks {
+				u.Bytes = blocks
+			}
+		}
+		usage.DirUsage = usage.DirUsage.add(u)
+		for dir := path.Dir(name); ; dir = path.Dir(dir) {
+			usage.ByDir[dir] = usage.ByDir[dir].add(u)
+			if dir == root || dir == "." {
+				break
+			}
+		}
+		return nil
+	})
+	return usage, err
+}
+
+// add returns the sum of both usages.
+func (u DirUsage) add(v DirUsage) DirUsage {
+	return DirUsage{Bytes: u.Bytes + v.Bytes, Files: u.Files + v.Files, Dirs: u.Dirs + v.Dirs}
+}
@@ -0,0 +1,9 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package wrfs
+
+// allocated reports that the number of bytes allocated to files is not known on this system.
+func allocated(fi FileInfo) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,36 @@
+package wrfs_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestDiskUsage(t *testing.T) {
+	fsys := newLowerFS(t)
+	check(t, MkdirAll(fsys, "dir/sub/empty", 0755))
+	check(t, WriteFile(fsys, "dir/sub/big", make([]byte, 100), 0644))
+	for _, opts := range [][]DiskUsageOption{nil, {DiskUsageBlocks()}} {
+		usage, err := DiskUsage(fsys, "dir/", opts...)
+		check(t, err)
+		if want := (DirUsage{Bytes: 110, Files: 3, Dirs: 2}); usage.DirUsage != want {
+			t.Errorf("DiskUsage(dir) = %+v, want %+v", usage.DirUsage, want)
+		}
+		for dir, want := range map[string]DirUsage{
+			"dir":           {Bytes: 110, Files: 3, Dirs: 2},
+			"dir/sub":       {Bytes: 105, Files: 2, Dirs: 1},
+			"dir/sub/empty": {},
+		} {
+			if got := usage.ByDir[dir]; got != want {
+				t.Errorf("DiskUsage(dir).ByDir[%s] = %+v, want %+v", dir, got, want)
+			}
+		}
+		if len(usage.ByDir) != 3 {
+			t.Errorf("DiskUsage(dir).ByDir has %d directories, want 3", len(usage.ByDir))
+		}
+	}
+	if _, err := DiskUsage(fsys, "missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("DiskUsage(missing): got %v, want ErrNotExist", err)
+	}
+}
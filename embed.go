@@ -0,0 +1,95 @@
+package wrfs
+
+import (
+	"embed"
+)
+
+// WritableEmbed returns a file system that presents the files of e, such as default configuration and assets
+// shipped with an application, with any modifications persisted in upper. It is an Overlay with upper as the upper
+// layer and e as the lower one, so that e is never modified and files are copied up into upper before they are
+// modified. Files removed from e are recorded as whiteouts in upper.
+//
+// Since the files of an embed.FS are read-only, they are presented as writable by their owner, with permission
+// bits 0644 for files and 0755 for directories, so that their copies in upper can be modified in turn.
+func WritableEmbed(e embed.FS, upper FS) FS {
+	return Overlay(upper, writableFS{e})
+}
+
+// writableFS presents the files of a read-only file system as writable by their owner.
+type writableFS struct {
+	fsys FS
+}
+
+func (w writableFS) Open(name string) (File, error) {
+	file, err := w.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &writableFile{FileWrapper{file}, name}, nil
+}
+
+func (w writableFS) Stat(name string) (FileInfo, error) {
+	fi, err := Stat(w.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return writableInfo{fi}, nil
+}
+
+func (w writableFS) ReadDir(name string) ([]DirEntry, error) {
+	entries, err := ReadDir(w.fsys, name)
+	for i, e := range entries {
+		entries[i] = writableEntry{e}
+	}
+	return entries, err
+}
+
+func (w writableFS) ReadFile(name string) ([]byte, error) {
+	return ReadFile(w.fsys, name)
+}
+
+// writableInfo is a FileInfo with the permission bit for writing by the owner set.
+type writableInfo struct {
+	FileInfo
+}
+
+func (fi writableInfo) Mode() FileMode { return fi.FileInfo.Mode() | 0200 }
+
+// writableEntry is a directory entry whose Info reports the permission bit for writing by the owner set.
+type writableEntry struct {
+	DirEntry
+}
+
+func (e writableEntry) Info() (FileInfo, error) {
+	fi, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return writableInfo{fi}, nil
+}
+
+// writableFile is an open file of a writableFS.
+type writableFile struct {
+	FileWrapper
+	name string
+}
+
+func (f *writableFile) Stat() (FileInfo, error) {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return writableInfo{fi}, nil
+}
+
+func (f *writableFile) ReadDir(n int) ([]DirEntry, error) {
+	dir, ok := f.File.(ReadDirFile)
+	if !ok {
+		return nil, &PathError{Op: "readdir", Path: f.name, Err: ErrUnsupported}
+	}
+	entries, err := dir.ReadDir(n)
+	for i, e := range entries {
+		entries[i] = writableEntry{e}
+	}
+	return entries, err
+}
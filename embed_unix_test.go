@@ -0,0 +1,37 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wrfs_test
+
+import (
+	"embed"
+	"errors"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+//go:embed testdata/embed
+var embedded embed.FS
+
+func TestWritableEmbed(t *testing.T) {
+	fsys := WritableEmbed(embedded, getFS(t))
+	checkContents(t, fsys, "testdata/embed/conf/app.conf", "default\n")
+
+	// Files copied up from embed.FS must remain writable in the upper layer.
+	check(t, WriteFile(fsys, "testdata/embed/conf/app.conf", []byte("custom\n"), 0644))
+	check(t, WriteFile(fsys, "testdata/embed/conf/app.conf", []byte("changed\n"), 0644))
+	check(t, WriteFile(fsys, "testdata/embed/conf/new.conf", []byte("new\n"), 0644))
+	checkContents(t, fsys, "testdata/embed/conf/app.conf", "changed\n")
+	checkContents(t, embedded, "testdata/embed/conf/app.conf", "default\n")
+
+	check(t, Remove(fsys, "testdata/embed/logo.txt"))
+	if _, err := Stat(fsys, "testdata/embed/logo.txt"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("removed file is still visible: %v", err)
+	}
+	entries, err := ReadDir(fsys, "testdata/embed/conf")
+	check(t, err)
+	if len(entries) != 2 {
+		t.Errorf("ReadDir returned %v, want app.conf and new.conf", entries)
+	}
+}
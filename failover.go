@@ -0,0 +1,307 @@
+package wrfs
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// A FailoverOption configures Failover.
+type FailoverOption func(*failoverConfig)
+
+type failoverConfig struct {
+	check      func(fsys FS) error
+	retryAfter time.Duration
+	isFailure  func(err error) bool
+	notify     func(from, to int, err error)
+}
+
+// FailoverHealthCheck sets a function that checks whether a replica is healthy, such as by statting a file on it.
+// A replica that failed is only used again once its retry delay has passed and check returns nil for it.
+// Without a health check, such replicas are simply tried again.
+func FailoverHealthCheck(check func(fsys FS) error) FailoverOption {
+	return func(c *failoverConfig) { c.check = check }
+}
+
+// FailoverRetryAfter sets how long a replica that failed is skipped before it is considered again.
+// The default is 30 seconds.
+func FailoverRetryAfter(d time.Duration) FailoverOption {
+	return func(c *failoverConfig) { c.retryAfter = d }
+}
+
+// FailoverIsFailure sets the function that decides whether an error returned by a replica means that the replica
+// has failed, rather than that the operation was invalid. By default, errors matching ErrNotExist, ErrExist,
+// ErrPermission, ErrInvalid, ErrClosed or io.EOF, errors reported by IsNotSupported, and the errors ENOTDIR,
+// EISDIR and ENOTEMPTY are not failures, while all other errors are.
+func FailoverIsFailure(isFailure func(err error) bool) FailoverOption {
+	return func(c *failoverConfig) { c.isFailure = isFailure }
+}
+
+// FailoverNotify sets a function that is called when operations fail over from the replica with index from
+// to the replica with index to, because of the error err, and when they fail back with a nil error.
+func FailoverNotify(notify func(from, to int, err error)) FailoverOption {
+	return func(c *failoverConfig) { c.notify = notify }
+}
+
+// isFailure is the default for FailoverIsFailure.
+func isFailure(err error) bool {
+	for _, target := range []error{ErrNotExist, ErrExist, ErrPermission, ErrInvalid, ErrClosed, io.EOF,
+		syscall.ENOTDIR, syscall.EISDIR, errno.ENOTEMPTY} {
+		if errors.Is(err, target) {
+			return false
+		}
+	}
+	return !IsNotSupported(err)
+}
+
+// Failover returns a file system that serves every operation from the first healthy replica, such as copies of
+// the same tree on several network mounts. There must be at least one replica. When an operation fails on a
+// replica with an error that FailoverIsFailure considers a failure, the replica is marked as failed and the
+// operation is retried on the next healthy replica, until it succeeds or all replicas have failed. Failed replicas
+// are considered again after the delay set by FailoverRetryAfter, so that operations fail back to the first
+// replica once it has recovered.
+//
+// The replicas must hold equivalent trees, and must be kept in sync by other means, since modifications are
+// only made on the replica that serves them. Operations on open files are not failed over. The Capabilities of
+// the returned file system are those common to all replicas.
+func Failover(replicas []FS, opts ...FailoverOption) FS {
+	c := failoverConfig{retryAfter: 30 * time.Second, isFailure: isFailure}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return &failoverFS{replicas: replicas, config: c, down: make([]time.Time, len(replicas))}
+}
+
+type failoverFS struct {
+	replicas []FS
+	config   failoverConfig
+
+	mu      sync.Mutex
+	current int         // the replica that served the last operation
+	down    []time.Time // when each failed replica may be tried again, or zero if it is healthy
+}
+
+// healthy reports whether replica i may be used, checking its health if its retry delay has passed.
+func (f *failoverFS) healthy(i int) bool {
+	f.mu.Lock()
+	down := f.down[i]
+	f.mu.Unlock()
+	if down.IsZero() {
+		return true
+	}
+	if time.Now().Before(down) {
+		return false
+	}
+	if f.config.check != nil {
+		if err := f.config.check(f.replicas[i]); err != nil {
+			f.markDown(i)
+			return false
+		}
+	}
+	f.mu.Lock()
+	f.down[i] = time.Time{}
+	f.mu.Unlock()
+	return true
+}
+
+func (f *failoverFS) markDown(i int) {
+	f.mu.Lock()
+	f.down[i] = time.Now().Add(f.config.retryAfter)
+	f.mu.Unlock()
+}
+
+// use records that replica i serves operations, notifying about the switch if it was another one.
+func (f *failoverFS) use(i int, err error) {
+	f.mu.Lock()
+	from := f.current
+	f.current = i
+	f.mu.Unlock()
+	if from != i && f.config.notify != nil {
+		f.config.notify(from, i, err)
+	}
+}
+
+// do performs fn on the first healthy replica, failing over to the next ones as long as fn fails.
+func (f *failoverFS) do(fn func(fsys FS) error) error {
+	var lastErr error
+	for i, fsys := range f.replicas {
+		if !f.healthy(i) {
+			continue
+		}
+		f.use(i, lastErr)
+		err := fn(fsys)
+		if err == nil || !f.config.isFailure(err) {
+			return err
+		}
+		f.markDown(i)
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = &PathError{Op: "failover", Path: ".", Err: syscall.EIO}
+	}
+	return lastErr
+}
+
+func (f *failoverFS) Capabilities() CapSet {
+	caps := ^CapSet(0)
+	for _, fsys := range f.replicas {
+		caps &= Capabilities(fsys)
+	}
+	return caps &^ (CapMkfifo | CapMknod | CapLchtimes | CapSyncDir)
+}
+
+func (f *failoverFS) Open(name string) (file File, err error) {
+	err = f.do(func(fsys FS) (err error) {
+		file, err = fsys.Open(name)
+		return err
+	})
+	return file, err
+}
+
+func (f *failoverFS) Stat(name string) (fi FileInfo, err error) {
+	err = f.do(func(fsys FS) (err error) {
+		fi, err = Stat(fsys, name)
+		return err
+	})
+	return fi, err
+}
+
+func (f *failoverFS) Lstat(name string) (fi FileInfo, err error) {
+	err = f.do(func(fsys FS) (err error) {
+		fi, err = Lstat(fsys, name)
+		return err
+	})
+	return fi, err
+}
+
+func (f *failoverFS) ReadDir(name string) (entries []DirEntry, err error) {
+	err = f.do(func(fsys FS) (err error) {
+		entries, err = ReadDir(fsys, name)
+		return err
+	})
+	return entries, err
+}
+
+func (f *failoverFS) ReadFile(name string) (data []byte, err error) {
+	err = f.do(func(fsys FS) (err error) {
+		data, err = ReadFile(fsys, name)
+		return err
+	})
+	return data, err
+}
+
+func (f *failoverFS) Glob(pattern string) (matches []string, err error) {
+	err = f.do(func(fsys FS) (err error) {
+		matches, err = Glob(fsys, pattern)
+		return err
+	})
+	return matches, err
+}
+
+func (f *failoverFS) Readlink(name string) (target string, err error) {
+	err = f.do(func(fsys FS) (err error) {
+		target, err = Readlink(fsys, name)
+		return err
+	})
+	return target, err
+}
+
+func (f *failoverFS) OpenFile(name string, flag int, perm FileMode) (file File, err error) {
+	err = f.do(func(fsys FS) (err error) {
+		file, err = OpenFile(fsys, name, flag, perm)
+		return err
+	})
+	return file, err
+}
+
+func (f *failoverFS) WriteFile(name string, data []byte, perm FileMode) error {
+	return f.do(func(fsys FS) error { return WriteFile(fsys, name, data, perm) })
+}
+
+func (f *failoverFS) Chmod(name string, mode FileMode) error {
+	return f.do(func(fsys FS) error { return Chmod(fsys, name, mode) })
+}
+
+func (f *failoverFS) Chown(name string, uid, gid int) error {
+	return f.do(func(fsys FS) error { return Chown(fsys, name, uid, gid) })
+}
+
+func (f *failoverFS) Lchown(name string, uid, gid int) error {
+	return f.do(func(fsys FS) error { return Lchown(fsys, name, uid, gid) })
+}
+
+func (f *failoverFS) Chtimes(name string, atime, mtime time.Time) error {
+	return f.do(func(fsys FS) error { return Chtimes(fsys, name, atime, mtime) })
+}
+
+func (f *failoverFS) Mkdir(name string, perm FileMode) error {
+	return f.do(func(fsys FS) error { return Mkdir(fsys, name, perm) })
+}
+
+func (f *failoverFS) MkdirAll(path string, perm FileMode) error {
+	return f.do(func(fsys FS) error { return MkdirAll(fsys, path, perm) })
+}
+
+func (f *failoverFS) Remove(name string) error {
+	return f.do(func(fsys FS) error { return Remove(fsys, name) })
+}
+
+func (f *failoverFS) RemoveAll(path string) error {
+	return f.do(func(fsys FS) error { return RemoveAll(fsys, path) })
+}
+
+func (f *failoverFS) Rename(oldpath, newpath string) error {
+	return f.do(func(fsys FS) error { return Rename(fsys, oldpath, newpath) })
+}
+
+func (f *failoverFS) Symlink(oldname, newname string) error {
+	return f.do(func(fsys FS) error { return Symlink(fsys, oldname, newname) })
+}
+
+func (f *failoverFS) Link(oldname, newname string) error {
+	return f.do(func(fsys FS) error { return Link(fsys, oldname, newname) })
+}
+
+func (f *failoverFS) Truncate(name string, size int64) error {
+	return f.do(func(fsys FS) error { return Truncate(fsys, name, size) })
+}
+
+func (f *failoverFS) Sync(name string) error {
+	return f.do(func(fsys FS) error { return Sync(fsys, name) })
+}
+
+func (f *failoverFS) Statfs(name string) (info FSInfo, err error) {
+	err = f.do(func(fsys FS) (err error) {
+		info, err = Statfs(fsys, name)
+		return err
+	})
+	return info, err
+}
+
+func (f *failoverFS) OpenLock(name string) (file LockFile, err error) {
+	err = f.do(func(fsys FS) (err error) {
+		file, err = OpenLock(fsys, name)
+		return err
+	})
+	return file, err
+}
+
+func (f *failoverFS) Watch(name string, opts ...WatchOption) (events <-chan Event, stop func(), err error) {
+	err = f.do(func(fsys FS) (err error) {
+		events, stop, err = Watch(fsys, name, opts...)
+		return err
+	})
+	return events, stop, err
+}
+
+// SameFile compares the files using the replica that serves operations.
+func (f *failoverFS) SameFile(fi1, fi2 FileInfo) bool {
+	f.mu.Lock()
+	fsys := f.replicas[f.current]
+	f.mu.Unlock()
+	return SameFile(fsys, fi1, fi2)
+}
@@ -0,0 +1,40 @@
+package wrfs_test
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestFailover(t *testing.T) {
+	primary, secondary := newLowerFS(t), newLowerFS(t)
+	check(t, WriteFile(secondary, "dir/file", []byte("secondary"), 0644))
+	broken := false
+	flaky := Wrap(primary, InterceptorFunc(func(inv *Invocation, next func() error) error {
+		if broken {
+			return &PathError{Op: inv.Op, Path: inv.Path, Err: syscall.EIO}
+		}
+		return next()
+	}))
+	var switches []int
+	fsys := Failover([]FS{flaky, secondary}, FailoverRetryAfter(0),
+		FailoverHealthCheck(func(fsys FS) error {
+			_, err := Stat(fsys, ".")
+			return err
+		}),
+		FailoverNotify(func(from, to int, err error) { switches = append(switches, to) }))
+
+	checkContents(t, fsys, "dir/file", "lower")
+	if _, err := Stat(fsys, "missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat(missing): got %v, want ErrNotExist", err)
+	}
+	broken = true
+	checkContents(t, fsys, "dir/file", "secondary")
+	broken = false
+	checkContents(t, fsys, "dir/file", "lower")
+	if len(switches) != 2 || switches[0] != 1 || switches[1] != 0 {
+		t.Errorf("switched to replicas %v, want 1 and back to 0", switches)
+	}
+}
@@ -0,0 +1,274 @@
+package wrfs
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"time"
+)
+
+// Filter returns a file system that presents the part of fsys for which keep returns true, such as for exposing
+// a partial view of a tree. A file is visible if keep returns true for its path and for the path of each of its
+// parent directories, given the DirEntry of the file or directory. Other files do not exist as far as Open, Stat,
+// Lstat, ReadDir, Glob and WalkDir are concerned, and operations that would modify or create them fail with
+// ErrPermission. For files that do not exist yet, keep is called with a nil DirEntry.
+//
+// RemoveAll only removes the visible files, and so fails to remove directories that contain hidden files.
+// Rename moves directories along with their hidden contents, and Watch reports events for hidden files.
+func Filter(fsys FS, keep func(path string, d DirEntry) bool) FS {
+	return &filterFS{fsWrapper{fsys}, keep}
+}
+
+type filterFS struct {
+	fsWrapper
+	keep func(path string, d DirEntry) bool
+}
+
+// visible reports whether name and its parent directories are kept.
+func (f *filterFS) visible(name string) bool {
+	if !ValidPath(name) {
+		return true // let fsys report the error
+	}
+	for p := name; p != "."; p = path.Dir(p) {
+		var d DirEntry
+		if fi, err := Lstat(f.fsys, p); err == nil {
+			d = fs.FileInfoToDirEntry(fi)
+		}
+		if !f.keep(p, d) {
+			return false
+		}
+	}
+	return true
+}
+
+// check returns an error matching ErrNotExist if name is hidden.
+func (f *filterFS) check(op, name string) error {
+	if !f.visible(name) {
+		return &PathError{Op: op, Path: name, Err: ErrNotExist}
+	}
+	return nil
+}
+
+// checkWrite returns an error matching ErrPermission if name is hidden.
+func (f *filterFS) checkWrite(op, name string) error {
+	if !f.visible(name) {
+		return &PathError{Op: op, Path: name, Err: ErrPermission}
+	}
+	return nil
+}
+
+// checkWrite2 is like checkWrite, for operations on two paths.
+func (f *filterFS) checkWrite2(op, oldname, newname string) error {
+	if !f.visible(oldname) || !f.visible(newname) {
+		return &LinkError{Op: op, Old: oldname, New: newname, Err: ErrPermission}
+	}
+	return nil
+}
+
+// filter removes the hidden entries of the directory dir, whose parents are visible.
+func (f *filterFS) filter(dir string, entries []DirEntry) []DirEntry {
+	filtered := entries[:0]
+	for _, entry := range entries {
+		if f.keep(path.Join(dir, entry.Name()), entry) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+
+func (f *filterFS) Open(name string) (File, error) {
+	if err := f.check("open", name); err != nil {
+		return nil, err
+	}
+	file, err := f.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := file.Stat(); err == nil && fi.IsDir() {
+		return &filterDir{file, f, name}, nil
+	}
+	return file, nil
+}
+
+func (f *filterFS) Stat(name string) (FileInfo, error) {
+	if err := f.check("stat", name); err != nil {
+		return nil, err
+	}
+	return Stat(f.fsys, name)
+}
+
+func (f *filterFS) Lstat(name string) (FileInfo, error) {
+	if err := f.check("lstat", name); err != nil {
+		return nil, err
+	}
+	return Lstat(f.fsys, name)
+}
+
+func (f *filterFS) ReadDir(name string) ([]DirEntry, error) {
+	if err := f.check("readdir", name); err != nil {
+		return nil, err
+	}
+	entries, err := ReadDir(f.fsys, name)
+	return f.filter(name, entries), err
+}
+
+func (f *filterFS) Readlink(name string) (string, error) {
+	if err := f.check("readlink", name); err != nil {
+		return "", err
+	}
+	return Readlink(f.fsys, name)
+}
+
+func (f *filterFS) Glob(pattern string) ([]string, error) {
+	matches, err := Glob(f.fsys, pattern)
+	filtered := matches[:0]
+	for _, match := range matches {
+		if f.visible(match) {
+			filtered = append(filtered, match)
+		}
+	}
+	return filtered, err
+}
+
+func (f *filterFS) OpenFile(name string, flag int, perm FileMode) (File, error) {
+	if flag&(O_WRONLY|O_RDWR|O_APPEND|O_CREATE|O_TRUNC) == 0 {
+		return f.Open(name)
+	}
+	if err := f.checkWrite("open", name); err != nil {
+		return nil, err
+	}
+	return OpenFile(f.fsys, name, flag, perm)
+}
+
+func (f *filterFS) Chmod(name string, mode FileMode) error {
+	if err := f.checkWrite("chmod", name); err != nil {
+		return err
+	}
+	return Chmod(f.fsys, name, mode)
+}
+
+func (f *filterFS) Chown(name string, uid, gid int) error {
+	if err := f.checkWrite("chown", name); err != nil {
+		return err
+	}
+	return Chown(f.fsys, name, uid, gid)
+}
+
+func (f *filterFS) Lchown(name string, uid, gid int) error {
+	if err := f.checkWrite("lchown", name); err != nil {
+		return err
+	}
+	return Lchown(f.fsys, name, uid, gid)
+}
+
+func (f *filterFS) Chtimes(name string, atime, mtime time.Time) error {
+	if err := f.checkWrite("chtimes", name); err != nil {
+		return err
+	}
+	return Chtimes(f.fsys, name, atime, mtime)
+}
+
+func (f *filterFS) Mkdir(name string, perm FileMode) error {
+	if err := f.checkWrite("mkdir", name); err != nil {
+		return err
+	}
+	return Mkdir(f.fsys, name, perm)
+}
+
+func (f *filterFS) MkdirAll(path string, perm FileMode) error {
+	if err := f.checkWrite("mkdir", path); err != nil {
+		return err
+	}
+	return MkdirAll(f.fsys, path, perm)
+}
+
+func (f *filterFS) Remove(name string) error {
+	if err := f.checkWrite("remove", name); err != nil {
+		return err
+	}
+	return Remove(f.fsys, name)
+}
+
+func (f *filterFS) RemoveAll(path string) error {
+	if err := f.checkWrite("removeall", path); err != nil {
+		return err
+	}
+	return removeAll(context.Background(), f, path)
+}
+
+func (f *filterFS) Rename(oldpath, newpath string) error {
+	if err := f.checkWrite2("rename", oldpath, newpath); err != nil {
+		return err
+	}
+	return Rename(f.fsys, oldpath, newpath)
+}
+
+func (f *filterFS) Symlink(oldname, newname string) error {
+	if err := f.checkWrite("symlink", newname); err != nil {
+		return err
+	}
+	return Symlink(f.fsys, oldname, newname)
+}
+
+func (f *filterFS) Link(oldname, newname string) error {
+	if err := f.checkWrite2("link", oldname, newname); err != nil {
+		return err
+	}
+	return Link(f.fsys, oldname, newname)
+}
+
+func (f *filterFS) Truncate(name string, size int64) error {
+	if err := f.checkWrite("truncate", name); err != nil {
+		return err
+	}
+	return Truncate(f.fsys, name, size)
+}
+
+func (f *filterFS) Sync(name string) error {
+	if err := f.check("sync", name); err != nil {
+		return err
+	}
+	return Sync(f.fsys, name)
+}
+
+func (f *filterFS) SyncDir(dir string) error {
+	if err := f.check("syncdir", dir); err != nil {
+		return err
+	}
+	return SyncDir(f.fsys, dir)
+}
+
+func (f *filterFS) OpenLock(name string) (LockFile, error) {
+	if err := f.checkWrite("lock", name); err != nil {
+		return nil, err
+	}
+	return OpenLock(f.fsys, name)
+}
+
+func (f *filterFS) Watch(name string, opts ...WatchOption) (<-chan Event, func(), error) {
+	if err := f.check("watch", name); err != nil {
+		return nil, nil, err
+	}
+	return Watch(f.fsys, name, opts...)
+}
+
+// filterDir is an open directory of a filterFS, whose hidden entries are left out.
+type filterDir struct {
+	File
+	fsys *filterFS
+	name string
+}
+
+func (d *filterDir) ReadDir(n int) ([]DirEntry, error) {
+	dir, ok := d.File.(ReadDirFile)
+	if !ok {
+		return nil, &PathError{Op: "readdir", Path: d.name, Err: ErrUnsupported}
+	}
+	for {
+		entries, err := dir.ReadDir(n)
+		entries = d.fsys.filter(d.name, entries)
+		if len(entries) > 0 || err != nil || n <= 0 {
+			return entries, err
+		}
+	}
+}
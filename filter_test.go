@@ -0,0 +1,45 @@
+package wrfs_test
+
+import (
+	"errors"
+	"path"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/errno"
+)
+
+func TestFilter(t *testing.T) {
+	lower := newLowerFS(t)
+	check(t, WriteFile(lower, "dir/secret.key", []byte("key"), 0600))
+	fsys := Filter(lower, func(name string, d DirEntry) bool {
+		return path.Ext(name) != ".key" && name != "dir/sub"
+	})
+
+	checkContents(t, fsys, "dir/file", "lower")
+	for _, name := range []string{"dir/secret.key", "dir/sub", "dir/sub/file"} {
+		if _, err := Stat(fsys, name); !errors.Is(err, ErrNotExist) {
+			t.Errorf("Stat(%s): got %v, want ErrNotExist", name, err)
+		}
+	}
+	if err := WriteFile(fsys, "dir/new.key", nil, 0600); !errors.Is(err, ErrPermission) {
+		t.Errorf("WriteFile of hidden file: got %v, want ErrPermission", err)
+	}
+	if err := Rename(fsys, "dir/file", "dir/sub/file"); !errors.Is(err, ErrPermission) {
+		t.Errorf("Rename into hidden directory: got %v, want ErrPermission", err)
+	}
+	if err := fstest.TestFS(fsys, "dir/file"); err != nil {
+		t.Error(err)
+	}
+	matches, err := Glob(fsys, "dir/*")
+	check(t, err)
+	if len(matches) != 1 || matches[0] != "dir/file" {
+		t.Errorf("Glob(dir/*) = %v, want dir/file", matches)
+	}
+
+	if err := RemoveAll(fsys, "dir"); !errors.Is(err, errno.ENOTEMPTY) {
+		t.Errorf("RemoveAll of directory with hidden files: got %v, want ENOTEMPTY", err)
+	}
+	checkContents(t, lower, "dir/secret.key", "key")
+}
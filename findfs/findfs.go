@@ -0,0 +1,178 @@
+// Package findfs finds the files in a wrfs file system that match composable predicates, like find(1).
+//
+// For example, to find the Go files larger than 1 MiB modified in the last day, outside of testdata directories:
+//
+//	matches, err := findfs.Find(fsys, ".", findfs.And(
+//		findfs.Name("*.go"),
+//		findfs.Size(1<<20, -1),
+//		findfs.ModifiedAfter(time.Now().Add(-24*time.Hour)),
+//		findfs.Not(findfs.Path("**/testdata/**")),
+//	))
+package findfs
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/relab/wrfs"
+)
+
+// A Predicate reports whether the file with the given path and directory entry matches.
+type Predicate func(name string, d wrfs.DirEntry) bool
+
+// Find returns the paths of the files and directories in the tree rooted at root that match, in the order WalkDir
+// visits them. Errors reading directories stop the search and are returned along with the matches found so far.
+func Find(fsys wrfs.FS, root string, match Predicate) ([]string, error) {
+	var matches []string
+	err := Stream(fsys, root, match, func(name string, d wrfs.DirEntry) error {
+		matches = append(matches, name)
+		return nil
+	})
+	return matches, err
+}
+
+// Stream calls fn for each file and directory in the tree rooted at root that matches, as WalkDir visits them.
+// If fn returns wrfs.SkipDir for a directory, its contents are skipped, and if it returns another error, Stream
+// stops and returns it, unless the error is wrfs.SkipAll.
+func Stream(fsys wrfs.FS, root string, match Predicate, fn func(name string, d wrfs.DirEntry) error) error {
+	return wrfs.WalkDir(fsys, root, func(name string, d wrfs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !match(name, d) {
+			return nil
+		}
+		return fn(name, d)
+	})
+}
+
+// All matches all files.
+func All() Predicate {
+	return func(string, wrfs.DirEntry) bool { return true }
+}
+
+// And matches the files that all of preds match.
+func And(preds ...Predicate) Predicate {
+	return func(name string, d wrfs.DirEntry) bool {
+		for _, pred := range preds {
+			if !pred(name, d) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or matches the files that any of preds matches.
+func Or(preds ...Predicate) Predicate {
+	return func(name string, d wrfs.DirEntry) bool {
+		for _, pred := range preds {
+			if pred(name, d) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not matches the files that pred does not match.
+func Not(pred Predicate) Predicate {
+	return func(name string, d wrfs.DirEntry) bool { return !pred(name, d) }
+}
+
+// Name matches the files whose base name matches the pattern, in the syntax of path.Match.
+// Malformed patterns match nothing.
+func Name(pattern string) Predicate {
+	return func(name string, d wrfs.DirEntry) bool {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+}
+
+// Path matches the files whose path matches the pattern, in the syntax of path.Match, where a "**" element
+// additionally matches any number of path elements. Malformed patterns match nothing.
+func Path(pattern string) Predicate {
+	segments := strings.Split(pattern, "/")
+	return func(name string, d wrfs.DirEntry) bool {
+		return matchSegments(segments, strings.Split(name, "/"))
+	}
+}
+
+// matchSegments reports whether the path elements match the pattern elements.
+func matchSegments(segments, elems []string) bool {
+	if len(segments) == 0 {
+		return len(elems) == 0
+	}
+	if segments[0] == "**" {
+		for i := 0; i <= len(elems); i++ {
+			if matchSegments(segments[1:], elems[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(elems) == 0 {
+		return false
+	}
+	ok, _ := path.Match(segments[0], elems[0])
+	return ok && matchSegments(segments[1:], elems[1:])
+}
+
+// Type matches the files of the given type, such as wrfs.ModeDir or wrfs.ModeSymlink, where 0 stands for regular
+// files.
+func Type(typ wrfs.FileMode) Predicate {
+	return func(name string, d wrfs.DirEntry) bool { return d.Type() == typ&wrfs.ModeType }
+}
+
+// Regular matches regular files.
+func Regular() Predicate {
+	return Type(0)
+}
+
+// Dir matches directories.
+func Dir() Predicate {
+	return Type(wrfs.ModeDir)
+}
+
+// info returns the FileInfo of a file, or nil if it cannot be had.
+func info(d wrfs.DirEntry) wrfs.FileInfo {
+	fi, err := d.Info()
+	if err != nil {
+		return nil
+	}
+	return fi
+}
+
+// Size matches the files whose size is at least min and, unless max is negative, at most max bytes.
+func Size(min, max int64) Predicate {
+	return func(name string, d wrfs.DirEntry) bool {
+		fi := info(d)
+		return fi != nil && fi.Size() >= min && (max < 0 || fi.Size() <= max)
+	}
+}
+
+// ModifiedAfter matches the files last modified after t.
+func ModifiedAfter(t time.Time) Predicate {
+	return func(name string, d wrfs.DirEntry) bool {
+		fi := info(d)
+		return fi != nil && fi.ModTime().After(t)
+	}
+}
+
+// ModifiedBefore matches the files last modified before t.
+func ModifiedBefore(t time.Time) Predicate {
+	return func(name string, d wrfs.DirEntry) bool {
+		fi := info(d)
+		return fi != nil && fi.ModTime().Before(t)
+	}
+}
+
+// Perm matches the files whose mode has all of the given permission bits set, such as 0111 for files executable
+// by everyone, or wrfs.ModeSetuid.
+func Perm(bits wrfs.FileMode) Predicate {
+	return func(name string, d wrfs.DirEntry) bool {
+		fi := info(d)
+		return fi != nil && fi.Mode()&bits == bits
+	}
+}
@@ -0,0 +1,61 @@
+package findfs_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/findfs"
+	"github.com/relab/wrfs/memfs"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFind(t *testing.T) {
+	fsys := memfs.New()
+	check(t, wrfs.MkdirAll(fsys, "src/testdata", 0755))
+	check(t, wrfs.WriteFile(fsys, "src/main.go", []byte("package main"), 0644))
+	check(t, wrfs.WriteFile(fsys, "src/big.go", make([]byte, 1000), 0755))
+	check(t, wrfs.WriteFile(fsys, "src/testdata/data.go", nil, 0644))
+	check(t, wrfs.WriteFile(fsys, "README", nil, 0644))
+	old := time.Now().Add(-time.Hour)
+	check(t, wrfs.Chtimes(fsys, "src/main.go", old, old))
+
+	for _, test := range []struct {
+		pred findfs.Predicate
+		want string
+	}{
+		{findfs.Name("*.go"), "src/big.go src/main.go src/testdata/data.go"},
+		{findfs.And(findfs.Name("*.go"), findfs.Not(findfs.Path("**/testdata/**"))), "src/big.go src/main.go"},
+		{findfs.Dir(), ". src src/testdata"},
+		{findfs.Size(100, -1), "src/big.go"},
+		{findfs.And(findfs.Regular(), findfs.Size(0, 0)), "README src/testdata/data.go"},
+		{findfs.And(findfs.Regular(), findfs.ModifiedBefore(time.Now().Add(-time.Minute))), "src/main.go"},
+		{findfs.And(findfs.Regular(), findfs.Perm(0100)), "src/big.go"},
+		{findfs.Or(findfs.Name("README"), findfs.Path("src/*")), "README src/big.go src/main.go src/testdata"},
+	} {
+		matches, err := findfs.Find(fsys, ".", test.pred)
+		check(t, err)
+		if got := strings.Join(matches, " "); got != test.want {
+			t.Errorf("Find = %q, want %q", got, test.want)
+		}
+	}
+
+	var streamed []string
+	check(t, findfs.Stream(fsys, ".", findfs.Dir(), func(name string, d wrfs.DirEntry) error {
+		streamed = append(streamed, name)
+		if name == "src" {
+			return wrfs.SkipDir
+		}
+		return nil
+	}))
+	if got := strings.Join(streamed, " "); got != ". src" {
+		t.Errorf("Stream with SkipDir = %q, want %q", got, ". src")
+	}
+}
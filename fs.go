@@ -158,6 +158,11 @@ type SubFS = fs.SubFS
 // as an error by any function.
 var SkipDir = fs.SkipDir
 
+// SkipAll is used as a return value from WalkDirFuncs to indicate that
+// all remaining files and directories are to be skipped. It is not returned
+// as an error by any function.
+var SkipAll = fs.SkipAll
+
 // WalkDirFunc is the type of the function called by WalkDir to visit
 // each file or directory.
 //
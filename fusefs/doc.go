@@ -0,0 +1,3 @@
+// Package fusefs mounts wrfs file systems as local file systems with FUSE, so that any program can access them.
+// It implements the FUSE protocol directly, and is only supported on Linux.
+package fusefs
@@ -0,0 +1,33 @@
+//go:build !linux
+// +build !linux
+
+package fusefs
+
+import (
+	"io"
+
+	"github.com/relab/wrfs"
+)
+
+// Serve serves fsys over the FUSE protocol on dev. It is only supported on Linux.
+func Serve(dev io.ReadWriter, fsys wrfs.FS) error {
+	return &wrfs.PathError{Op: "serve", Path: "/dev/fuse", Err: wrfs.ErrUnsupported}
+}
+
+// Mount mounts fsys at the directory dir. It is only supported on Linux.
+func Mount(dir string, fsys wrfs.FS, allowOther bool) (*Server, error) {
+	return nil, &wrfs.PathError{Op: "mount", Path: dir, Err: wrfs.ErrUnsupported}
+}
+
+// A Server serves a file system mounted by Mount.
+type Server struct{}
+
+// Unmount unmounts the file system.
+func (s *Server) Unmount() error {
+	return wrfs.ErrUnsupported
+}
+
+// Wait waits until the file system is unmounted.
+func (s *Server) Wait() error {
+	return wrfs.ErrUnsupported
+}
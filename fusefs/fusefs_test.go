@@ -0,0 +1,235 @@
+//go:build linux
+// +build linux
+
+package fusefs_test
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/fusefs"
+	"github.com/relab/wrfs/memfs"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// kernel sends FUSE requests and returns the replies, with just enough of the protocol for testing.
+type kernel struct {
+	t      *testing.T
+	conn   net.Conn
+	unique uint64
+}
+
+// send sends a request. Its fields are uint32s, uint64s, strings, which are NUL-terminated, and []bytes.
+func (k *kernel) send(opcode uint32, nodeid uint64, fields ...any) {
+	k.t.Helper()
+	k.unique++
+	e := binary.NativeEndian
+	buf := make([]byte, 40)
+	e.PutUint32(buf[4:], opcode)
+	e.PutUint64(buf[8:], k.unique)
+	e.PutUint64(buf[16:], nodeid)
+	for _, f := range fields {
+		switch f := f.(type) {
+		case uint32:
+			buf = e.AppendUint32(buf, f)
+		case uint64:
+			buf = e.AppendUint64(buf, f)
+		case string:
+			buf = append(append(buf, f...), 0)
+		case []byte:
+			buf = append(buf, f...)
+		}
+	}
+	e.PutUint32(buf, uint32(len(buf)))
+	_, err := k.conn.Write(buf)
+	check(k.t, err)
+}
+
+// call sends a request and returns the error number and body of the reply.
+func (k *kernel) call(opcode uint32, nodeid uint64, fields ...any) (syscall.Errno, []byte) {
+	k.t.Helper()
+	k.send(opcode, nodeid, fields...)
+	buf := make([]byte, 1<<20)
+	n, err := k.conn.Read(buf)
+	check(k.t, err)
+	e := binary.NativeEndian
+	if int(e.Uint32(buf)) != n || e.Uint64(buf[8:]) != k.unique {
+		k.t.Fatalf("malformed reply to request %d", opcode)
+	}
+	return syscall.Errno(-int32(e.Uint32(buf[4:]))), buf[16:n]
+}
+
+// ok sends a request that must succeed and returns the body of its reply.
+func (k *kernel) ok(opcode uint32, nodeid uint64, fields ...any) []byte {
+	k.t.Helper()
+	errno, body := k.call(opcode, nodeid, fields...)
+	if errno != 0 {
+		k.t.Fatalf("request %d failed: %v", opcode, errno)
+	}
+	return body
+}
+
+func TestServe(t *testing.T) {
+	fsys := memfs.New()
+	check(t, wrfs.MkdirAll(fsys, "dir/sub", 0755))
+	check(t, wrfs.WriteFile(fsys, "dir/file", []byte("hello"), 0644))
+	dev, conn := net.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- fusefs.Serve(dev, fsys) }()
+	k := &kernel{t: t, conn: conn}
+	e := binary.NativeEndian
+
+	if body := k.ok(26, 0, uint32(7), uint32(31), uint32(1<<16), uint32(1<<5)); e.Uint32(body) != 7 ||
+		e.Uint32(body[4:]) != 26 || e.Uint32(body[12:]) != 1<<5 {
+		t.Fatalf("init: got version %d.%d and flags %#x", e.Uint32(body), e.Uint32(body[4:]), e.Uint32(body[12:]))
+	}
+
+	// Look up dir/file and read it.
+	dir := e.Uint64(k.ok(1, 1, "dir"))
+	entry := k.ok(1, dir, "file")
+	file := e.Uint64(entry)
+	if size, mode := e.Uint64(entry[48:]), e.Uint32(entry[40+60:]); size != 5 || mode != syscall.S_IFREG|0644 {
+		t.Errorf("lookup: got size %d and mode %o", size, mode)
+	}
+	if errno, _ := k.call(1, dir, "missing"); errno != syscall.ENOENT {
+		t.Errorf("lookup of a missing file: got %v", errno)
+	}
+	fh := e.Uint64(k.ok(14, file, uint32(syscall.O_RDONLY), uint32(0)))
+	if data := k.ok(15, file, fh, uint64(1), uint32(100), uint32(0), uint64(0), uint32(0), uint32(0)); string(data) != "ello" {
+		t.Errorf("read: got %q", data)
+	}
+	k.ok(18, file, fh, uint32(0), uint32(0), uint64(0))
+
+	// Create a file, write to it, and truncate it.
+	body := k.ok(35, dir, uint32(syscall.O_WRONLY|syscall.O_CREAT|syscall.O_EXCL), uint32(0600), uint32(0), uint32(0), "new")
+	created, fh := e.Uint64(body), e.Uint64(body[128:])
+	if body := k.ok(16, created, fh, uint64(0), uint32(12), uint32(0), uint64(0), uint32(0), uint32(0),
+		[]byte("new contents")); e.Uint32(body) != 12 {
+		t.Errorf("write: wrote %d bytes", e.Uint32(body))
+	}
+	k.ok(18, created, fh, uint32(0), uint32(0), uint64(0))
+	setattr := []any{uint32(1 << 3), uint32(0), uint64(0), uint64(3)} // valid, padding, fh, size
+	for i := 0; i < 9; i++ {
+		setattr = append(setattr, uint64(0))
+	}
+	if body := k.ok(4, created, setattr...); e.Uint64(body[16+8:]) != 3 {
+		t.Errorf("setattr: got size %d", e.Uint64(body[16+8:]))
+	}
+	data, err := wrfs.ReadFile(fsys, "dir/new")
+	check(t, err)
+	if string(data) != "new" {
+		t.Errorf("dir/new contains %q", data)
+	}
+
+	// List the directory.
+	fh = e.Uint64(k.ok(27, dir, uint32(0), uint32(0)))
+	var names []string
+	for off := uint64(0); ; {
+		body := k.ok(28, dir, fh, off, uint32(4096), uint32(0), uint64(0), uint32(0), uint32(0))
+		if len(body) == 0 {
+			break
+		}
+		for len(body) > 0 {
+			off = e.Uint64(body[8:])
+			n := e.Uint32(body[16:])
+			names = append(names, string(body[24:24+n]))
+			body = body[(24+n+7)&^7:]
+		}
+	}
+	k.ok(29, dir, fh, uint32(0), uint32(0), uint64(0))
+	sort.Strings(names)
+	if got := strings.Join(names, " "); got != ". .. file new sub" {
+		t.Errorf("readdir returned %q", got)
+	}
+
+	// Rename, remove, and forget.
+	if errno, _ := k.call(45, dir, dir, uint32(1), uint32(0), "new", "file"); errno != syscall.EEXIST {
+		t.Errorf("rename2 with RENAME_NOREPLACE over existing file: got %v", errno)
+	}
+	k.ok(12, dir, uint64(1), "new", "moved")
+	if body := k.ok(3, created, uint32(0), uint32(0), uint64(0)); e.Uint64(body[16+8:]) != 3 {
+		t.Errorf("getattr of renamed file: got size %d", e.Uint64(body[16+8:]))
+	}
+	if errno, _ := k.call(10, 1, "dir"); errno != syscall.EISDIR {
+		t.Errorf("unlink of a directory: got %v", errno)
+	}
+	if errno, _ := k.call(11, dir, "sub"); errno != 0 {
+		t.Errorf("rmdir: got %v", errno)
+	}
+	k.send(2, created, uint64(1))
+	if errno, _ := k.call(3, created, uint32(0), uint32(0), uint64(0)); errno != syscall.ESTALE {
+		t.Errorf("getattr of forgotten node: got %v", errno)
+	}
+	if _, err := wrfs.Stat(fsys, "moved"); err != nil {
+		t.Errorf("rename did not create moved: %v", err)
+	}
+
+	conn.Close()
+	check(t, <-done)
+}
+
+func TestMount(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("mounting requires root")
+	}
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		t.Skip("no FUSE device")
+	}
+	fsys := memfs.New()
+	check(t, wrfs.MkdirAll(fsys, "dir/sub", 0755))
+	check(t, wrfs.WriteFile(fsys, "dir/file", []byte("hello"), 0644))
+	dir := t.TempDir()
+	s, err := fusefs.Mount(dir, fsys, false)
+	if err != nil {
+		t.Skipf("cannot mount: %v", err)
+	}
+	defer func() { check(t, s.Unmount()) }()
+
+	data, err := os.ReadFile(filepath.Join(dir, "dir/file"))
+	check(t, err)
+	if string(data) != "hello" {
+		t.Errorf("dir/file contains %q", data)
+	}
+	check(t, os.WriteFile(filepath.Join(dir, "dir/new"), []byte("new contents"), 0600))
+	f, err := os.OpenFile(filepath.Join(dir, "dir/new"), os.O_WRONLY|os.O_APPEND, 0)
+	check(t, err)
+	_, err = io.WriteString(f, "!")
+	check(t, err)
+	check(t, f.Close())
+	check(t, os.Rename(filepath.Join(dir, "dir/new"), filepath.Join(dir, "moved")))
+	check(t, os.Symlink("moved", filepath.Join(dir, "link")))
+	check(t, os.Chmod(filepath.Join(dir, "moved"), 0640))
+	check(t, os.Remove(filepath.Join(dir, "dir/sub")))
+
+	entries, err := os.ReadDir(dir)
+	check(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if got := strings.Join(names, " "); got != "dir link moved" {
+		t.Errorf("ReadDir returned %q", got)
+	}
+	data, err = wrfs.ReadFile(fsys, "link")
+	check(t, err)
+	if string(data) != "new contents!" {
+		t.Errorf("link contains %q", data)
+	}
+	if fi, err := wrfs.Stat(fsys, "moved"); err != nil || fi.Mode().Perm() != 0640 {
+		t.Errorf("Chmod did not change the mode of moved: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package fusefs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"unsafe"
+
+	"github.com/relab/wrfs"
+)
+
+// Mount mounts fsys at the directory dir and serves it in the background, until the Server is unmounted. The file
+// system is mounted with mount(2) if the process runs as root, and with fusermount3 or fusermount otherwise. The
+// kernel checks the permission bits of files before passing requests on, so that other users can access them only
+// as fsys reports they may, and only if allowOther is true, which also requires "user_allow_other" in
+// /etc/fuse.conf for users other than root.
+func Mount(dir string, fsys wrfs.FS, allowOther bool) (*Server, error) {
+	opts := "default_permissions"
+	if allowOther {
+		opts += ",allow_other"
+	}
+	var dev *os.File
+	var err error
+	var fusermount bool
+	if os.Geteuid() == 0 {
+		dev, err = mount(dir, opts)
+	} else {
+		dev, err = mountFusermount(dir, opts)
+		fusermount = true
+	}
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "mount", Path: dir, Err: err}
+	}
+	s := &Server{dir: dir, fusermount: fusermount, done: make(chan struct{})}
+	go func() {
+		s.err = Serve(dev, fsys)
+		dev.Close()
+		close(s.done)
+	}()
+	if err := disablePoll(dir); err != nil {
+		s.Unmount()
+		return nil, &wrfs.PathError{Op: "mount", Path: dir, Err: err}
+	}
+	return s, nil
+}
+
+// disablePoll polls the hidden file of the file system mounted at dir, so that the kernel learns that the file system does not support polling, and
+// does not ask when the process opens files in it later.
+func disablePoll(dir string) error {
+	fd, err := syscall.Open(filepath.Join(dir, pollName), syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(epfd)
+	// syscall.EpollCtl makes a raw system call, which keeps the runtime from scheduling the server.
+	ev := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(fd)}
+	_, _, errno := syscall.Syscall6(syscall.SYS_EPOLL_CTL, uintptr(epfd), syscall.EPOLL_CTL_ADD, uintptr(fd),
+		uintptr(unsafe.Pointer(&ev)), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// mount mounts a FUSE file system at dir with mount(2), returning the device serving it.
+func mount(dir, opts string) (*os.File, error) {
+	fd, err := syscall.Open("/dev/fuse", syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat(dir, &st); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	data := fmt.Sprintf("fd=%d,rootmode=%o,user_id=%d,group_id=%d,%s", fd, st.Mode&syscall.S_IFMT, os.Getuid(),
+		os.Getgid(), opts)
+	if err := syscall.Mount("wrfs", dir, "fuse.wrfs", syscall.MS_NOSUID|syscall.MS_NODEV, data); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), "/dev/fuse"), nil
+}
+
+// mountFusermount mounts a FUSE file system at dir with the setuid fusermount helper, which passes the device back
+// over a socket.
+func mountFusermount(dir, opts string) (*os.File, error) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	local, remote := os.NewFile(uintptr(fds[0]), "fusermount"), os.NewFile(uintptr(fds[1]), "fusermount")
+	defer local.Close()
+	defer remote.Close()
+	cmd := exec.Command(fusermountPath(), "-o", opts+",fsname=wrfs,subtype=wrfs", "--", dir)
+	cmd.Env = append(os.Environ(), "_FUSE_COMMFD=3")
+	cmd.ExtraFiles = []*os.File{remote}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	buf, oob := make([]byte, 1), make([]byte, syscall.CmsgSpace(4))
+	_, oobn, _, _, err := syscall.Recvmsg(fds[0], buf, oob, 0)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) == 0 {
+		return nil, errors.New("fusefs: fusermount did not pass the device")
+	}
+	devFds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(devFds) == 0 {
+		return nil, errors.New("fusefs: fusermount did not pass the device")
+	}
+	syscall.CloseOnExec(devFds[0])
+	return os.NewFile(uintptr(devFds[0]), "/dev/fuse"), nil
+}
+
+// fusermountPath returns the name of the fusermount helper, preferring that of FUSE 3.
+func fusermountPath() string {
+	if path, err := exec.LookPath("fusermount3"); err == nil {
+		return path
+	}
+	return "fusermount"
+}
+
+// A Server serves a file system mounted by Mount.
+type Server struct {
+	dir        string
+	fusermount bool
+	done       chan struct{}
+	err        error
+}
+
+// Unmount unmounts the file system, and waits for the Server to stop serving it. It fails if the file system is
+// busy, such as when a process has its working directory in it.
+func (s *Server) Unmount() error {
+	var err error
+	if s.fusermount {
+		out, runErr := exec.Command(fusermountPath(), "-u", "--", s.dir).CombinedOutput()
+		if runErr != nil {
+			err = errors.New("fusefs: fusermount: " + strconv.Quote(string(out)))
+		}
+	} else {
+		err = syscall.Unmount(s.dir, 0)
+	}
+	if err != nil {
+		return &wrfs.PathError{Op: "unmount", Path: s.dir, Err: err}
+	}
+	return s.Wait()
+}
+
+// Wait waits until the file system is unmounted, such as by Unmount or with umount(8), and returns the error
+// that made the Server stop serving it, if any.
+func (s *Server) Wait() error {
+	<-s.done
+	return s.err
+}
@@ -0,0 +1,243 @@
+package fusefs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"syscall"
+	"time"
+
+	"github.com/relab/wrfs"
+)
+
+// The protocol version that Serve implements.
+const (
+	kernelVersion = 7
+	kernelMinor   = 26
+)
+
+// Opcodes of requests.
+const (
+	opLookup      = 1
+	opForget      = 2
+	opGetattr     = 3
+	opSetattr     = 4
+	opReadlink    = 5
+	opSymlink     = 6
+	opMknod       = 8
+	opMkdir       = 9
+	opUnlink      = 10
+	opRmdir       = 11
+	opRename      = 12
+	opLink        = 13
+	opOpen        = 14
+	opRead        = 15
+	opWrite       = 16
+	opStatfs      = 17
+	opRelease     = 18
+	opFsync       = 20
+	opFlush       = 25
+	opInit        = 26
+	opOpendir     = 27
+	opReaddir     = 28
+	opReleasedir  = 29
+	opFsyncdir    = 30
+	opCreate      = 35
+	opInterrupt   = 36
+	opDestroy     = 38
+	opBatchForget = 42
+	opRename2     = 45
+)
+
+// Flags of the init request and reply.
+const (
+	initAsyncRead    = 1 << 0
+	initAtomicOTrunc = 1 << 3
+	initBigWrites    = 1 << 5
+)
+
+// Bits of the valid field of setattr requests.
+const (
+	fattrMode     = 1 << 0
+	fattrUID      = 1 << 1
+	fattrGID      = 1 << 2
+	fattrSize     = 1 << 3
+	fattrAtime    = 1 << 4
+	fattrMtime    = 1 << 5
+	fattrFh       = 1 << 6
+	fattrAtimeNow = 1 << 7
+	fattrMtimeNow = 1 << 8
+)
+
+// renameNoreplace is the flag of rename2 requests that fails if the new name exists.
+const renameNoreplace = 1 << 0
+
+// maxWrite is the largest write request Serve accepts, and bufSize the size of the buffer for reading requests.
+const (
+	maxWrite = 128 << 10
+	bufSize  = maxWrite + 4096
+)
+
+// inHeaderSize and outHeaderSize are the sizes of the headers of requests and replies.
+const (
+	inHeaderSize  = 40
+	outHeaderSize = 16
+)
+
+// inHeader is the header of a request.
+type inHeader struct {
+	len      uint32
+	opcode   uint32
+	unique   uint64
+	nodeid   uint64
+	uid, gid uint32
+	pid      uint32
+}
+
+func parseHeader(buf []byte) (inHeader, bool) {
+	if len(buf) < inHeaderSize {
+		return inHeader{}, false
+	}
+	e := binary.NativeEndian
+	h := inHeader{len: e.Uint32(buf), opcode: e.Uint32(buf[4:]), unique: e.Uint64(buf[8:]), nodeid: e.Uint64(buf[16:]),
+		uid: e.Uint32(buf[24:]), gid: e.Uint32(buf[28:]), pid: e.Uint32(buf[32:])}
+	return h, int(h.len) == len(buf)
+}
+
+// decoder decodes the fields of the body of a request. Decoding past its end sets err.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if len(d.buf) < n {
+		d.buf, d.err = nil, syscall.EINVAL
+		return make([]byte, n)
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) uint32() uint32 { return binary.NativeEndian.Uint32(d.take(4)) }
+func (d *decoder) uint64() uint64 { return binary.NativeEndian.Uint64(d.take(8)) }
+
+// name decodes a NUL-terminated string.
+func (d *decoder) name() string {
+	i := bytes.IndexByte(d.buf, 0)
+	if i < 0 {
+		d.buf, d.err = nil, syscall.EINVAL
+		return ""
+	}
+	s := string(d.buf[:i])
+	d.buf = d.buf[i+1:]
+	return s
+}
+
+// encoder encodes the fields of a reply, after room for its header.
+type encoder []byte
+
+func newEncoder() encoder { return make(encoder, outHeaderSize, 256) }
+
+func (e encoder) uint16(v uint16) encoder { return binary.NativeEndian.AppendUint16(e, v) }
+func (e encoder) uint32(v uint32) encoder { return binary.NativeEndian.AppendUint32(e, v) }
+func (e encoder) uint64(v uint64) encoder { return binary.NativeEndian.AppendUint64(e, v) }
+
+// attr holds the attributes of a file, in the form of struct fuse_attr.
+type attr struct {
+	ino, size, blocks   uint64
+	atime, mtime, ctime time.Time
+	mode, nlink         uint32
+	uid, gid, rdev      uint32
+}
+
+func (e encoder) attr(a *attr) encoder {
+	e = e.uint64(a.ino).uint64(a.size).uint64(a.blocks)
+	e = e.uint64(uint64(a.atime.Unix())).uint64(uint64(a.mtime.Unix())).uint64(uint64(a.ctime.Unix()))
+	e = e.uint32(uint32(a.atime.Nanosecond())).uint32(uint32(a.mtime.Nanosecond())).uint32(uint32(a.ctime.Nanosecond()))
+	e = e.uint32(a.mode).uint32(a.nlink).uint32(a.uid).uint32(a.gid).uint32(a.rdev)
+	return e.uint32(4096).uint32(0) // blksize and flags
+}
+
+// entry encodes struct fuse_entry_out for the node with the given ID.
+func (e encoder) entry(nodeid uint64, a *attr) encoder {
+	e = e.uint64(nodeid).uint64(0) // generation
+	e = e.uint64(uint64(attrValid / time.Second)).uint64(uint64(attrValid / time.Second))
+	e = e.uint32(uint32(attrValid % time.Second)).uint32(uint32(attrValid % time.Second))
+	return e.attr(a)
+}
+
+// attrOut encodes struct fuse_attr_out.
+func (e encoder) attrOut(a *attr) encoder {
+	e = e.uint64(uint64(attrValid / time.Second)).uint32(uint32(attrValid % time.Second)).uint32(0)
+	return e.attr(a)
+}
+
+// dirent appends struct fuse_dirent, padded to 8 bytes.
+func (e encoder) dirent(ino, off uint64, typ uint32, name string) encoder {
+	e = e.uint64(ino).uint64(off).uint32(uint32(len(name))).uint32(typ)
+	e = append(e, name...)
+	for len(e)%8 != 0 {
+		e = append(e, 0)
+	}
+	return e
+}
+
+// direntSize returns the size of a fuse_dirent for name.
+func direntSize(name string) int {
+	return (24 + len(name) + 7) &^ 7
+}
+
+// finish sets the header of the reply to the request with the given ID, and returns it.
+func (e encoder) finish(unique uint64, errno syscall.Errno) []byte {
+	binary.NativeEndian.PutUint32(e, uint32(len(e)))
+	binary.NativeEndian.PutUint32(e[4:], uint32(-int32(errno)))
+	binary.NativeEndian.PutUint64(e[8:], unique)
+	return e
+}
+
+// fromFileMode returns the Unix mode of a FileMode.
+func fromFileMode(mode wrfs.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	switch {
+	case mode.IsDir():
+		m |= syscall.S_IFDIR
+	case mode&wrfs.ModeSymlink != 0:
+		m |= syscall.S_IFLNK
+	case mode&wrfs.ModeNamedPipe != 0:
+		m |= syscall.S_IFIFO
+	case mode&wrfs.ModeSocket != 0:
+		m |= syscall.S_IFSOCK
+	case mode&wrfs.ModeCharDevice != 0:
+		m |= syscall.S_IFCHR
+	case mode&wrfs.ModeDevice != 0:
+		m |= syscall.S_IFBLK
+	default:
+		m |= syscall.S_IFREG
+	}
+	if mode&wrfs.ModeSetuid != 0 {
+		m |= syscall.S_ISUID
+	}
+	if mode&wrfs.ModeSetgid != 0 {
+		m |= syscall.S_ISGID
+	}
+	if mode&wrfs.ModeSticky != 0 {
+		m |= syscall.S_ISVTX
+	}
+	return m
+}
+
+// toFileMode returns the permission bits and special bits of a Unix mode as a FileMode.
+func toFileMode(m uint32) wrfs.FileMode {
+	mode := wrfs.FileMode(m & 0777)
+	if m&syscall.S_ISUID != 0 {
+		mode |= wrfs.ModeSetuid
+	}
+	if m&syscall.S_ISGID != 0 {
+		mode |= wrfs.ModeSetgid
+	}
+	if m&syscall.S_ISVTX != 0 {
+		mode |= wrfs.ModeSticky
+	}
+	return mode
+}
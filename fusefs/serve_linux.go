@@ -0,0 +1,723 @@
+package fusefs
+
+import (
+	"errors"
+	"hash/fnv"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/relab/wrfs"
+)
+
+// attrValid is how long the kernel caches the attributes and names of files.
+const attrValid = time.Second
+
+// errNoReply is returned for requests that take no reply.
+var errNoReply = errors.New("no reply")
+
+// pollName is the name of a hidden, empty file in the root directory, which Mount opens and polls so that the
+// kernel learns that the file system does not support polling. Otherwise, the kernel asks the server whenever the
+// process serving the file system opens a file in it, since the Go runtime registers the file with epoll, and the
+// runtime cannot schedule the server while it waits for the reply.
+const pollName = ".wrfs-poll"
+
+// pollID is the ID of the node of pollName.
+const pollID = 2
+
+// errBadRequest is returned by Serve for malformed requests.
+var errBadRequest = errors.New("fusefs: malformed request")
+
+// Serve serves fsys over the FUSE protocol on dev, which is an open /dev/fuse device of a mounted file system, until
+// the file system is unmounted. Requests are handled in order, one at a time, and the files left open by the kernel
+// are closed on return. Mount mounts a file system and serves it; Serve is for programs that mount the device
+// themselves or receive it from another process.
+//
+// Requests are translated to the operations of the wrfs package on the paths of the files: lookups and getattr
+// requests to Lstat, falling back to Stat, and the rest to OpenFile, ReadDir, Mkdir, Remove, Rename, Symlink,
+// Readlink, Link, Chmod, Chown, Chtimes, Truncate and Statfs. Operations that fsys does not support fail with
+// ENOTSUP, and files that report no owner through their Sys method are owned by the user running Serve. Reads and
+// writes use ReadAt and WriteAt if the files support them, and seek otherwise.
+//
+// The root directory also has a hidden, empty file named .wrfs-poll, which is not listed and shadows any file of
+// that name in fsys; Mount needs it to disable polling.
+//
+// Serve returns nil once the file system is unmounted, and otherwise the error that made it stop, such as a
+// malformed request or a failed read from dev.
+func Serve(dev io.ReadWriter, fsys wrfs.FS) error {
+	s := &server{
+		fsys:    fsys,
+		nodes:   map[uint64]*node{1: {name: ".", nlookup: 1}},
+		ids:     map[string]uint64{".": 1},
+		nextID:  pollID,
+		handles: make(map[uint64]*handle),
+		uid:     uint32(os.Getuid()),
+		gid:     uint32(os.Getgid()),
+	}
+	defer s.closeAll()
+	buf := make([]byte, bufSize)
+	for {
+		n, err := dev.Read(buf)
+		switch {
+		case errors.Is(err, syscall.EINTR), errors.Is(err, syscall.EAGAIN), errors.Is(err, syscall.ENOENT):
+			continue // the request was interrupted
+		case err == io.EOF, errors.Is(err, syscall.ENODEV):
+			return nil
+		case err != nil:
+			return err
+		}
+		h, ok := parseHeader(buf[:n])
+		if !ok {
+			return errBadRequest
+		}
+		d := &decoder{buf: buf[inHeaderSize:n]}
+		reply, err := s.dispatch(h, d)
+		if err == errNoReply {
+			continue
+		}
+		if reply == nil || err != nil {
+			reply = newEncoder()
+		}
+		if _, err := dev.Write(reply.finish(h.unique, errno(err))); err != nil && !errors.Is(err, syscall.ENOENT) {
+			return err
+		}
+		if h.opcode == opDestroy {
+			return nil
+		}
+	}
+}
+
+// errno returns the error number reporting err to the kernel, which is 0 if err is nil.
+func errno(err error) syscall.Errno {
+	var e syscall.Errno
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &e):
+		return e
+	case errors.Is(err, wrfs.ErrNotExist):
+		return syscall.ENOENT
+	case errors.Is(err, wrfs.ErrExist):
+		return syscall.EEXIST
+	case errors.Is(err, wrfs.ErrPermission):
+		return syscall.EACCES
+	case errors.Is(err, wrfs.ErrInvalid):
+		return syscall.EINVAL
+	case errors.Is(err, wrfs.ErrUnsupported):
+		return syscall.ENOTSUP
+	case errors.Is(err, wrfs.ErrClosed):
+		return syscall.EBADF
+	}
+	return syscall.EIO
+}
+
+// server is the state of Serve.
+type server struct {
+	fsys     wrfs.FS
+	nodes    map[uint64]*node
+	ids      map[string]uint64 // the IDs of the nodes by name
+	nextID   uint64
+	handles  map[uint64]*handle
+	nextFh   uint64
+	uid, gid uint32
+}
+
+// node is a file that the kernel has looked up, and refers to by its ID.
+type node struct {
+	name    string // empty once removed or replaced
+	nlookup uint64
+}
+
+// handle is a file or directory opened by the kernel.
+type handle struct {
+	name    string
+	file    wrfs.File       // nil for directories
+	entries []wrfs.DirEntry // the entries of directories
+	append  bool
+}
+
+// dispatch handles a request, returning the reply, or nil and an error to report.
+func (s *server) dispatch(h inHeader, d *decoder) (encoder, error) {
+	switch h.opcode {
+	case opInit:
+		return s.init(d)
+	case opDestroy:
+		return nil, nil
+	case opForget:
+		s.forget(h.nodeid, d.uint64())
+		return nil, errNoReply
+	case opBatchForget:
+		count := d.uint32()
+		d.uint32()
+		for ; count > 0 && d.err == nil; count-- {
+			nodeid, nlookup := d.uint64(), d.uint64()
+			s.forget(nodeid, nlookup)
+		}
+		return nil, errNoReply
+	case opInterrupt:
+		return nil, errNoReply
+	}
+	if h.nodeid == pollID {
+		return s.poll(h, d)
+	}
+
+	name, err := s.name(h.nodeid)
+	if err != nil {
+		return nil, err
+	}
+	switch h.opcode {
+	case opLookup:
+		name, err := s.child(name, d)
+		if err != nil {
+			return nil, err
+		}
+		if name == pollName {
+			return newEncoder().entry(pollID, s.pollAttr()), nil
+		}
+		return s.entry(name)
+	case opGetattr:
+		flags, _, fh := d.uint32(), d.uint32(), d.uint64()
+		var fi wrfs.FileInfo
+		if hd := s.handles[fh]; flags&1 != 0 && hd != nil && hd.file != nil {
+			fi, err = hd.file.Stat()
+		} else {
+			fi, err = s.lstat(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return newEncoder().attrOut(s.attr(name, fi)), nil
+	case opSetattr:
+		if err := s.setattr(name, d); err != nil {
+			return nil, err
+		}
+		fi, err := s.lstat(name)
+		if err != nil {
+			return nil, err
+		}
+		return newEncoder().attrOut(s.attr(name, fi)), nil
+	case opReadlink:
+		target, err := wrfs.Readlink(s.fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		return append(newEncoder(), target...), nil
+	case opSymlink:
+		newname, err := s.child(name, d)
+		target := d.name()
+		if err == nil {
+			err = d.err
+		}
+		if err == nil {
+			err = wrfs.Symlink(s.fsys, target, newname)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return s.entry(newname)
+	case opMknod:
+		mode, _, _, _ := d.uint32(), d.uint32(), d.uint32(), d.uint32()
+		name, err := s.child(name, d)
+		if err != nil {
+			return nil, err
+		}
+		if mode&syscall.S_IFMT != syscall.S_IFREG {
+			return nil, &wrfs.PathError{Op: "mknod", Path: name, Err: wrfs.ErrUnsupported}
+		}
+		file, err := wrfs.OpenFile(s.fsys, name, wrfs.O_WRONLY|wrfs.O_CREATE|wrfs.O_EXCL, toFileMode(mode))
+		if err != nil {
+			return nil, err
+		}
+		if err := file.Close(); err != nil {
+			return nil, err
+		}
+		return s.entry(name)
+	case opMkdir:
+		mode, _ := d.uint32(), d.uint32()
+		name, err := s.child(name, d)
+		if err == nil {
+			err = wrfs.Mkdir(s.fsys, name, toFileMode(mode))
+		}
+		if err != nil {
+			return nil, err
+		}
+		return s.entry(name)
+	case opUnlink, opRmdir:
+		name, err := s.child(name, d)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.remove(name, h.opcode == opRmdir)
+	case opRename, opRename2:
+		newdir := d.uint64()
+		var flags uint32
+		if h.opcode == opRename2 {
+			flags, _ = d.uint32(), d.uint32()
+		}
+		return nil, s.rename(name, newdir, flags, d)
+	case opLink:
+		oldname, err := s.name(d.uint64())
+		if err != nil {
+			return nil, err
+		}
+		newname, err := s.child(name, d)
+		if err == nil {
+			err = wrfs.Link(s.fsys, oldname, newname)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return s.entry(newname)
+	case opOpen:
+		flags, _ := d.uint32(), d.uint32()
+		file, err := wrfs.OpenFile(s.fsys, name, openFlag(flags), 0)
+		if err != nil {
+			return nil, err
+		}
+		return s.open(&handle{name: name, file: file, append: flags&syscall.O_APPEND != 0}), nil
+	case opCreate:
+		flags, mode, _, _ := d.uint32(), d.uint32(), d.uint32(), d.uint32()
+		name, err := s.child(name, d)
+		if err != nil {
+			return nil, err
+		}
+		file, err := wrfs.OpenFile(s.fsys, name, openFlag(flags)|wrfs.O_CREATE, toFileMode(mode))
+		if err != nil {
+			return nil, err
+		}
+		entry, err := s.entry(name)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		open := s.open(&handle{name: name, file: file, append: flags&syscall.O_APPEND != 0})
+		return append(entry, open[outHeaderSize:]...), nil
+	case opRead:
+		fh, off, size := d.uint64(), d.uint64(), d.uint32()
+		return s.read(fh, int64(off), size)
+	case opWrite:
+		fh, off, size, _, _, _, _ := d.uint64(), d.uint64(), d.uint32(), d.uint32(), d.uint64(), d.uint32(), d.uint32()
+		data := d.take(int(size))
+		if d.err != nil {
+			return nil, d.err
+		}
+		if err := s.write(fh, int64(off), data); err != nil {
+			return nil, err
+		}
+		return newEncoder().uint32(size).uint32(0), nil
+	case opStatfs:
+		return s.statfs(name)
+	case opRelease, opReleasedir:
+		fh := d.uint64()
+		hd, ok := s.handles[fh]
+		if !ok {
+			return nil, syscall.EBADF
+		}
+		delete(s.handles, fh)
+		if hd.file != nil {
+			return nil, hd.file.Close()
+		}
+		return nil, nil
+	case opFsync:
+		hd, ok := s.handles[d.uint64()]
+		if !ok {
+			return nil, syscall.EBADF
+		}
+		if f, ok := hd.file.(interface{ Sync() error }); ok {
+			return nil, f.Sync()
+		}
+		return nil, nil
+	case opFlush, opFsyncdir:
+		return nil, nil
+	case opOpendir:
+		entries, err := wrfs.ReadDir(s.fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		return s.open(&handle{name: name, entries: entries}), nil
+	case opReaddir:
+		fh, off, size := d.uint64(), d.uint64(), d.uint32()
+		return s.readDir(fh, off, size)
+	}
+	return nil, syscall.ENOSYS
+}
+
+// init handles the init request, which negotiates the version of the protocol.
+func (s *server) init(d *decoder) (encoder, error) {
+	major, minor, readahead, flags := d.uint32(), d.uint32(), d.uint32(), d.uint32()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if major > kernelVersion {
+		// The kernel sends another init request with our version.
+		return newEncoder().uint32(kernelVersion), nil
+	}
+	if major < kernelVersion || minor < 12 {
+		return nil, syscall.EPROTO
+	}
+	e := newEncoder().uint32(kernelVersion).uint32(min(minor, kernelMinor)).uint32(readahead)
+	e = e.uint32(flags & (initAsyncRead | initAtomicOTrunc | initBigWrites))
+	e = e.uint16(12).uint16(9).uint32(maxWrite).uint32(1) // max_background, congestion_threshold, time_gran
+	return append(e, make([]byte, 36)...), nil
+}
+
+// poll handles the requests on the node of pollName, which can only be opened and closed.
+func (s *server) poll(h inHeader, d *decoder) (encoder, error) {
+	switch h.opcode {
+	case opGetattr:
+		return newEncoder().attrOut(s.pollAttr()), nil
+	case opOpen:
+		return s.open(&handle{name: pollName}), nil
+	case opRelease:
+		delete(s.handles, d.uint64())
+		return nil, nil
+	case opFlush:
+		return nil, nil
+	}
+	return nil, syscall.ENOSYS
+}
+
+// pollAttr returns the attributes of the node of pollName.
+func (s *server) pollAttr() *attr {
+	epoch := time.Unix(0, 0)
+	return &attr{ino: pollID, atime: epoch, mtime: epoch, ctime: epoch, mode: syscall.S_IFREG | 0444, nlink: 1, uid: s.uid, gid: s.gid}
+}
+
+// name returns the name of the node with the given ID.
+func (s *server) name(nodeid uint64) (string, error) {
+	n, ok := s.nodes[nodeid]
+	if !ok || n.name == "" {
+		return "", syscall.ESTALE
+	}
+	return n.name, nil
+}
+
+// child decodes the name of an entry of the directory dir, returning its path.
+func (s *server) child(dir string, d *decoder) (string, error) {
+	elem := d.name()
+	switch {
+	case d.err != nil:
+		return "", d.err
+	case elem == "" || elem == "." || elem == ".." || strings.Contains(elem, "/"):
+		return "", syscall.EINVAL
+	case dir == ".":
+		return elem, nil
+	}
+	return dir + "/" + elem, nil
+}
+
+// entry returns the reply to a lookup of name, counting the lookup.
+func (s *server) entry(name string) (encoder, error) {
+	fi, err := s.lstat(name)
+	if err != nil {
+		return nil, err
+	}
+	id, ok := s.ids[name]
+	if !ok {
+		s.nextID++
+		id = s.nextID
+		s.nodes[id] = &node{name: name}
+		s.ids[name] = id
+	}
+	s.nodes[id].nlookup++
+	return newEncoder().entry(id, s.attr(name, fi)), nil
+}
+
+// forget forgets nlookup lookups of the node with the given ID, and the node once all are forgotten.
+func (s *server) forget(nodeid, nlookup uint64) {
+	n, ok := s.nodes[nodeid]
+	if !ok || nodeid == 1 {
+		return
+	}
+	if n.nlookup > nlookup {
+		n.nlookup -= nlookup
+		return
+	}
+	delete(s.nodes, nodeid)
+	if n.name != "" && s.ids[n.name] == nodeid {
+		delete(s.ids, n.name)
+	}
+}
+
+// detach marks the node of name as removed.
+func (s *server) detach(name string) {
+	if id, ok := s.ids[name]; ok {
+		s.nodes[id].name = ""
+		delete(s.ids, name)
+	}
+}
+
+// lstat returns the information on name, describing a symbolic link itself if the file system supports Lstat.
+func (s *server) lstat(name string) (wrfs.FileInfo, error) {
+	fi, err := wrfs.Lstat(s.fsys, name)
+	if errors.Is(err, wrfs.ErrUnsupported) {
+		return wrfs.Stat(s.fsys, name)
+	}
+	return fi, err
+}
+
+// attr returns the attributes of the named file, taking those the FileInfo does not report from its Sys method
+// if it returns a *syscall.Stat_t.
+func (s *server) attr(name string, fi wrfs.FileInfo) *attr {
+	mtime := fi.ModTime()
+	a := &attr{ino: ino(name), size: uint64(fi.Size()), atime: mtime, mtime: mtime, ctime: mtime,
+		mode: fromFileMode(fi.Mode()), nlink: 1, uid: s.uid, gid: s.gid}
+	if fi.IsDir() {
+		a.nlink = 2
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		a.ino, a.nlink, a.uid, a.gid, a.rdev = st.Ino, uint32(st.Nlink), st.Uid, st.Gid, uint32(st.Rdev)
+		a.atime = time.Unix(int64(st.Atim.Sec), int64(st.Atim.Nsec))
+		a.ctime = time.Unix(int64(st.Ctim.Sec), int64(st.Ctim.Nsec))
+	}
+	a.blocks = (a.size + 511) / 512
+	return a
+}
+
+// ino returns the inode number of the named file, for file systems that do not report them.
+func ino(name string) uint64 {
+	if name == "." {
+		return 1
+	}
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return h.Sum64() | 2
+}
+
+// setattr decodes and applies a setattr request to the named file.
+func (s *server) setattr(name string, d *decoder) error {
+	valid, _, fh, size := d.uint32(), d.uint32(), d.uint64(), d.uint64()
+	d.uint64() // lock_owner
+	atime, mtime := d.uint64(), d.uint64()
+	d.uint64() // ctime
+	atimensec, mtimensec := d.uint32(), d.uint32()
+	d.uint32() // ctimensec
+	mode := d.uint32()
+	d.uint32()
+	uid, gid := d.uint32(), d.uint32()
+	if d.err != nil {
+		return d.err
+	}
+	if valid&fattrSize != 0 {
+		var err error
+		hd := s.handles[fh]
+		if t, ok := fileOf(hd).(interface{ Truncate(int64) error }); valid&fattrFh != 0 && ok {
+			err = t.Truncate(int64(size))
+		} else {
+			err = wrfs.Truncate(s.fsys, name, int64(size))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if valid&fattrMode != 0 {
+		if err := wrfs.Chmod(s.fsys, name, toFileMode(mode)); err != nil {
+			return err
+		}
+	}
+	if valid&(fattrUID|fattrGID) != 0 {
+		u, g := -1, -1
+		if valid&fattrUID != 0 {
+			u = int(uid)
+		}
+		if valid&fattrGID != 0 {
+			g = int(gid)
+		}
+		if err := wrfs.Chown(s.fsys, name, u, g); err != nil {
+			return err
+		}
+	}
+	if valid&(fattrAtime|fattrMtime) != 0 {
+		fi, err := s.lstat(name)
+		if err != nil {
+			return err
+		}
+		a := s.attr(name, fi)
+		now := time.Now()
+		switch {
+		case valid&fattrAtimeNow != 0:
+			a.atime = now
+		case valid&fattrAtime != 0:
+			a.atime = time.Unix(int64(atime), int64(atimensec))
+		}
+		switch {
+		case valid&fattrMtimeNow != 0:
+			a.mtime = now
+		case valid&fattrMtime != 0:
+			a.mtime = time.Unix(int64(mtime), int64(mtimensec))
+		}
+		if err := wrfs.Chtimes(s.fsys, name, a.atime, a.mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileOf returns the open file of hd, or nil if there is none.
+func fileOf(hd *handle) wrfs.File {
+	if hd == nil {
+		return nil
+	}
+	return hd.file
+}
+
+// remove removes the named file, which must be a directory if dir is true and must not otherwise.
+func (s *server) remove(name string, dir bool) error {
+	fi, err := s.lstat(name)
+	switch {
+	case err != nil:
+		return err
+	case dir && !fi.IsDir():
+		return syscall.ENOTDIR
+	case !dir && fi.IsDir():
+		return syscall.EISDIR
+	}
+	if err := wrfs.Remove(s.fsys, name); err != nil {
+		return err
+	}
+	s.detach(name)
+	return nil
+}
+
+// rename decodes and applies a rename request for an entry of the directory dir.
+func (s *server) rename(dir string, newdir uint64, flags uint32, d *decoder) error {
+	oldname, err := s.child(dir, d)
+	if err != nil {
+		return err
+	}
+	newdirName, err := s.name(newdir)
+	if err != nil {
+		return err
+	}
+	newname, err := s.child(newdirName, d)
+	if err != nil {
+		return err
+	}
+	if flags&^renameNoreplace != 0 {
+		return syscall.EINVAL
+	}
+	if flags&renameNoreplace != 0 {
+		if _, err := s.lstat(newname); err == nil {
+			return syscall.EEXIST
+		}
+	}
+	if err := wrfs.Rename(s.fsys, oldname, newname); err != nil {
+		return err
+	}
+	if oldname == newname {
+		return nil
+	}
+	s.detach(newname)
+	for id, n := range s.nodes {
+		if n.name == oldname || strings.HasPrefix(n.name, oldname+"/") {
+			if s.ids[n.name] == id {
+				delete(s.ids, n.name)
+			}
+			n.name = newname + n.name[len(oldname):]
+			s.ids[n.name] = id
+		}
+	}
+	return nil
+}
+
+// openFlag returns the flags for OpenFile of the flags of an open request.
+func openFlag(flags uint32) int {
+	return int(flags) & (syscall.O_ACCMODE | syscall.O_APPEND | syscall.O_TRUNC | syscall.O_CREAT | syscall.O_EXCL |
+		syscall.O_SYNC)
+}
+
+// open registers hd, returning the reply reporting it.
+func (s *server) open(hd *handle) encoder {
+	s.nextFh++
+	s.handles[s.nextFh] = hd
+	return newEncoder().uint64(s.nextFh).uint32(0).uint32(0)
+}
+
+// closeAll closes the files left open by the kernel.
+func (s *server) closeAll() {
+	for _, hd := range s.handles {
+		if hd.file != nil {
+			hd.file.Close()
+		}
+	}
+}
+
+// read reads up to n bytes at offset off of the file of the handle fh.
+func (s *server) read(fh uint64, off int64, n uint32) (encoder, error) {
+	hd, ok := s.handles[fh]
+	if !ok || hd.file == nil {
+		return nil, syscall.EBADF
+	}
+	buf := make([]byte, min(n, maxWrite))
+	var m int
+	var err error
+	if r, ok := hd.file.(io.ReaderAt); ok {
+		m, err = r.ReadAt(buf, off)
+	} else if _, err = wrfs.Seek(hd.file, off, io.SeekStart); err == nil {
+		m, err = io.ReadFull(hd.file, buf)
+	}
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return append(newEncoder(), buf[:m]...), nil
+}
+
+// write writes data at offset off of the file of the handle fh, or at its end if it was opened for appending.
+func (s *server) write(fh uint64, off int64, data []byte) error {
+	hd, ok := s.handles[fh]
+	if !ok || hd.file == nil {
+		return syscall.EBADF
+	}
+	if w, ok := hd.file.(io.WriterAt); ok && !hd.append {
+		_, err := w.WriteAt(data, off)
+		return err
+	}
+	if !hd.append {
+		if _, err := wrfs.Seek(hd.file, off, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	_, err := wrfs.Write(hd.file, data)
+	return err
+}
+
+// readDir returns the entries of the directory of the handle fh from the offset off, as many as fit in size bytes.
+// The offsets 0 and 1 are those of "." and "..".
+func (s *server) readDir(fh, off uint64, size uint32) (encoder, error) {
+	hd, ok := s.handles[fh]
+	if !ok || hd.file != nil {
+		return nil, syscall.EBADF
+	}
+	e := newEncoder()
+	for i := off; i < uint64(len(hd.entries))+2; i++ {
+		name, typ, n := ".", uint32(syscall.S_IFDIR), ino(hd.name)
+		switch {
+		case i == 1:
+			name, n = "..", ino(path.Dir(hd.name))
+		case i > 1:
+			entry := hd.entries[i-2]
+			name, typ, n = entry.Name(), fromFileMode(entry.Type()), ino(path.Join(hd.name, entry.Name()))
+		}
+		if len(e)-outHeaderSize+direntSize(name) > int(size) {
+			break
+		}
+		e = e.dirent(n, i+1, typ>>12, name)
+	}
+	return e, nil
+}
+
+// statfs returns the reply to a statfs request, reporting the capacity of the file system in 4 KiB blocks.
+func (s *server) statfs(name string) (encoder, error) {
+	info, err := wrfs.Statfs(s.fsys, name)
+	if err != nil && !errors.Is(err, wrfs.ErrUnsupported) {
+		return nil, err
+	}
+	const bsize = 4096
+	e := newEncoder().uint64(info.Total / bsize).uint64(info.Free / bsize).uint64(info.Available / bsize)
+	e = e.uint64(info.Files).uint64(info.FreeFiles)
+	e = e.uint32(bsize).uint32(255).uint32(bsize).uint32(0) // bsize, namelen, frsize, padding
+	return append(e, make([]byte, 24)...), nil
+}
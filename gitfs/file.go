@@ -0,0 +1,221 @@
+package gitfs
+
+import (
+	"io"
+	"path"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// sortEntries sorts directory entries by name.
+func sortEntries(entries []wrfs.DirEntry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+}
+
+// dir is an open directory, whose entries are read when it is opened.
+type dir struct {
+	name    string
+	info    *fileInfo
+	entries []wrfs.DirEntry
+}
+
+func (d *dir) Stat() (wrfs.FileInfo, error) { return d.info, nil }
+func (d *dir) Close() error                 { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &wrfs.PathError{Op: "read", Path: d.name, Err: syscall.EISDIR}
+}
+
+func (d *dir) ReadDir(n int) ([]wrfs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// file is an open file. It holds the contents of the file as they were when it was opened, and, if it is open for
+// writing, stages them with the changes made through it when synced or closed.
+type file struct {
+	fsys   *FS
+	name   string
+	node   *node
+	flag   int
+	data   []byte // shared with the node, or others files, unless owned
+	owned  bool
+	dirty  bool // whether data has changes not yet staged
+	off    int64
+	closed bool
+}
+
+var (
+	_ wrfs.WriterFile   = (*file)(nil)
+	_ wrfs.TruncateFile = (*file)(nil)
+	_ wrfs.SyncFile     = (*file)(nil)
+	_ io.ReaderAt       = (*file)(nil)
+	_ io.WriterAt       = (*file)(nil)
+	_ io.Seeker         = (*file)(nil)
+)
+
+// check returns an error if the file is closed, or if it was not opened for reading or writing as needed.
+func (f *file) check(op string, write bool) error {
+	if f.closed {
+		return &wrfs.PathError{Op: op, Path: f.name, Err: wrfs.ErrClosed}
+	}
+	access := f.flag & (wrfs.O_RDONLY | wrfs.O_WRONLY | wrfs.O_RDWR)
+	if write && access == wrfs.O_RDONLY || !write && access == wrfs.O_WRONLY {
+		return &wrfs.PathError{Op: op, Path: f.name, Err: errno.EBADF}
+	}
+	return nil
+}
+
+func (f *file) Stat() (wrfs.FileInfo, error) {
+	if f.closed {
+		return nil, &wrfs.PathError{Op: "stat", Path: f.name, Err: wrfs.ErrClosed}
+	}
+	f.fsys.mu.Lock()
+	fi, err := f.fsys.info(path.Base(f.name), f.node)
+	f.fsys.mu.Unlock()
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "stat", Path: f.name, Err: err}
+	}
+	if f.dirty {
+		fi.size, fi.modTime = int64(len(f.data)), time.Now()
+	}
+	return fi, nil
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	n, err := f.readAt("read", p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &wrfs.PathError{Op: "readat", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	n, err := f.readAt("readat", p, off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *file) readAt(op string, p []byte, off int64) (int, error) {
+	if err := f.check(op, false); err != nil {
+		return 0, err
+	}
+	if off >= int64(len(f.data)) {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	return copy(p, f.data[off:]), nil
+}
+
+func (f *file) Write(p []byte) (int, error) {
+	if f.flag&wrfs.O_APPEND != 0 {
+		f.off = int64(len(f.data))
+	}
+	n, err := f.writeAt("write", p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *file) WriteAt(p []byte, off int64) (int, error) {
+	if f.flag&wrfs.O_APPEND != 0 || off < 0 {
+		return 0, &wrfs.PathError{Op: "writeat", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	return f.writeAt("writeat", p, off)
+}
+
+func (f *file) writeAt(op string, p []byte, off int64) (int, error) {
+	if err := f.check(op, true); err != nil {
+		return 0, err
+	}
+	f.resize(max(int64(len(f.data)), off+int64(len(p))))
+	copy(f.data[off:], p)
+	return len(p), nil
+}
+
+// resize changes the size of the contents, copying them first unless they are owned by the file.
+func (f *file) resize(size int64) {
+	if !f.owned {
+		f.data = append(make([]byte, 0, size), f.data[:min(size, int64(len(f.data)))]...)
+		f.owned = true
+	}
+	if size <= int64(len(f.data)) {
+		f.data = f.data[:size]
+	} else {
+		f.data = append(f.data, make([]byte, size-int64(len(f.data)))...)
+	}
+	f.dirty = true
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &wrfs.PathError{Op: "seek", Path: f.name, Err: wrfs.ErrClosed}
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += int64(len(f.data))
+	default:
+		return 0, &wrfs.PathError{Op: "seek", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &wrfs.PathError{Op: "seek", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *file) Truncate(size int64) error {
+	if err := f.check("truncate", true); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &wrfs.PathError{Op: "truncate", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	f.resize(size)
+	return nil
+}
+
+// Sync stages the contents of the file, to be committed with the next commit.
+func (f *file) Sync() error {
+	if f.closed {
+		return &wrfs.PathError{Op: "sync", Path: f.name, Err: wrfs.ErrClosed}
+	}
+	if !f.dirty {
+		return nil
+	}
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+	f.node.stage(f.data)
+	f.owned, f.dirty = false, false
+	return f.fsys.done("sync", f.name, "Write "+f.name)
+}
+
+func (f *file) Close() error {
+	if f.closed {
+		return &wrfs.PathError{Op: "close", Path: f.name, Err: wrfs.ErrClosed}
+	}
+	err := f.Sync()
+	f.closed = true
+	return err
+}
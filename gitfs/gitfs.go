@@ -0,0 +1,748 @@
+// Package gitfs provides a file system backed by a branch of a git repository, for versioned stores such as of
+// configuration, in which every change is recorded as a commit with an author and a message.
+//
+// Files are read from the tree of the last commit of the branch. Changes are staged in memory, and turned into a
+// commit on the branch by Flush, or after each operation with the CommitEach option. The repository is accessed
+// through a wrfs.FS holding its git directory, such as the .git directory of a working tree or a bare repository,
+// whose objects are read and written directly: no git executable is needed. Working trees and indexes are left
+// untouched, so a non-bare repository shows the commits as changes to undo in its working tree unless its branch is
+// another one.
+//
+// Git records only files, so empty directories exist until the file system is discarded, but are not committed,
+// and git only records whether files are executable, so their permission bits are 0644 or 0755. Files have no
+// owners, and take the time of the last commit as their modification time until they are changed.
+package gitfs
+
+import (
+	"errors"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// ErrConflict is returned by Flush, and by the operations committing their changes with the CommitEach option, when
+// the branch has been updated since the file system last read or committed to it, by git or by another file system.
+// The changes stay staged, and the branch is left as it is.
+var ErrConflict = errors.New("gitfs: branch was updated concurrently")
+
+// An Option configures a file system returned by New.
+type Option func(*FS)
+
+// Author sets the author and committer of the commits, instead of "gitfs <gitfs@localhost>".
+func Author(name, email string) Option {
+	return func(fsys *FS) { fsys.author = signature{name: name, email: email} }
+}
+
+// Message sets the function returning the message of a commit from the changes it records, in the order they were
+// made, each described by a line such as "Write dir/file" or "Rename old to new". By default, a commit of a single
+// change has the change as its message, and a commit of several changes lists them after a summary line.
+func Message(fn func(changes []string) string) Option {
+	return func(fsys *FS) { fsys.message = fn }
+}
+
+// CommitEach makes the file system commit each change once made, instead of when Flush is called: creating or
+// removing a file or directory, renaming it, changing its mode, and closing a file that was written to.
+func CommitEach() Option {
+	return func(fsys *FS) { fsys.each = true }
+}
+
+// defaultMessage is the default function of the Message option.
+func defaultMessage(changes []string) string {
+	if len(changes) == 1 {
+		return changes[0]
+	}
+	return "Apply " + strconv.Itoa(len(changes)) + " changes\n\n" + strings.Join(changes, "\n")
+}
+
+// FS is a file system backed by a branch of a git repository.
+type FS struct {
+	repo    wrfs.FS
+	db      *odb
+	ref     string
+	author  signature
+	message func([]string) string
+	each    bool
+
+	mu      sync.Mutex
+	head    *hash     // the last commit of the branch, or nil if it has none yet
+	tree    hash      // the tree of head
+	time    time.Time // the time of head
+	root    *node
+	changes []string // the changes since head
+}
+
+// A node is a file or directory of the file system.
+type node struct {
+	mode     uint32           // the mode of the entry of the node in its tree
+	hash     hash             // the object of the node, as last read or written
+	children map[string]*node // the entries of a directory, or nil until read
+	data     []byte           // the staged contents of a file, or target of a symbolic link
+	staged   bool             // whether data holds contents not yet written as an object
+	size     int64            // the size of the object, or -1 until known
+	modTime  time.Time        // the time of the last change, or zero if unchanged since the last commit
+}
+
+func (n *node) isDir() bool     { return n.mode == modeDir }
+func (n *node) isSymlink() bool { return n.mode == modeSymlink }
+
+// stage replaces the contents of the file n.
+func (n *node) stage(data []byte) {
+	n.data, n.staged, n.size, n.modTime = data, true, int64(len(data)), time.Now()
+}
+
+// New returns a file system backed by the branch ref of the git repository whose git directory is repo. The
+// branch is a full reference name such as "refs/heads/main", or "HEAD" for the branch checked out, and need not
+// exist yet: its first commit then has no parent. Only repositories using SHA-1 names are supported.
+func New(repo wrfs.FS, ref string, opts ...Option) (*FS, error) {
+	fsys := &FS{
+		repo:    repo,
+		db:      &odb{fsys: repo},
+		ref:     ref,
+		author:  signature{name: "gitfs", email: "gitfs@localhost"},
+		message: defaultMessage,
+		root:    &node{mode: modeDir, children: make(map[string]*node)},
+	}
+	for _, opt := range opts {
+		opt(fsys)
+	}
+	if fi, err := wrfs.Stat(repo, "objects"); err != nil || !fi.IsDir() {
+		return nil, errors.New("gitfs: not a git repository")
+	}
+	for i := 0; ; i++ {
+		target, err := symref(repo, fsys.ref)
+		if err != nil {
+			return nil, err
+		}
+		if target == "" {
+			break
+		}
+		if i == maxSymrefs {
+			return nil, errors.New("gitfs: too many levels of symbolic references: " + ref)
+		}
+		fsys.ref = target
+	}
+	h, ok, err := resolve(repo, fsys.ref)
+	if err != nil || !ok {
+		return fsys, err
+	}
+	typ, data, err := fsys.db.read(h)
+	if err != nil {
+		return nil, err
+	}
+	if typ != objCommit {
+		return nil, errors.New("gitfs: " + fsys.ref + " does not point to a commit")
+	}
+	c, err := parseCommit(h, data)
+	if err != nil {
+		return nil, err
+	}
+	fsys.head, fsys.tree, fsys.time = &h, c.tree, c.time
+	fsys.root = &node{mode: modeDir, hash: c.tree, size: -1}
+	return fsys, nil
+}
+
+// Init creates an empty bare repository in repo, whose HEAD is the given branch, such as "main".
+func Init(repo wrfs.FS, branch string) error {
+	if _, err := wrfs.Stat(repo, "HEAD"); err == nil {
+		return &wrfs.PathError{Op: "init", Path: "HEAD", Err: wrfs.ErrExist}
+	}
+	for _, dir := range []string{"objects/info", "objects/pack", "refs/heads", "refs/tags"} {
+		if err := wrfs.MkdirAll(repo, dir, 0755); err != nil {
+			return err
+		}
+	}
+	config := "[core]\n\trepositoryformatversion = 0\n\tfilemode = true\n\tbare = true\n"
+	if err := wrfs.WriteFile(repo, "config", []byte(config), 0644); err != nil {
+		return err
+	}
+	return wrfs.WriteFile(repo, "HEAD", []byte("ref: refs/heads/"+branch+"\n"), 0644)
+}
+
+// Head returns the name of the last commit of the branch, or "" if it has none.
+func (fsys *FS) Head() string {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	if fsys.head == nil {
+		return ""
+	}
+	return fsys.head.String()
+}
+
+// Flush commits the changes made since the last commit to the branch. It does nothing if there are none, or if
+// they leave the tree as it was.
+func (fsys *FS) Flush() error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	return fsys.commit()
+}
+
+// record adds a change, and commits it with the CommitEach option. The caller must hold fsys.mu.
+func (fsys *FS) record(change string) error {
+	if n := len(fsys.changes); n == 0 || fsys.changes[n-1] != change {
+		fsys.changes = append(fsys.changes, change)
+	}
+	if fsys.each {
+		return fsys.commit()
+	}
+	return nil
+}
+
+// commit writes the staged changes as a commit, and updates the branch to it. The caller must hold fsys.mu.
+func (fsys *FS) commit() error {
+	if len(fsys.changes) == 0 {
+		return nil
+	}
+	tree, empty, err := fsys.writeTree(fsys.root)
+	if err != nil {
+		return err
+	}
+	if fsys.head != nil && tree == fsys.tree || fsys.head == nil && empty {
+		fsys.changes = nil
+		return nil
+	}
+	if empty {
+		if tree, err = fsys.db.write(objTree, nil); err != nil {
+			return err
+		}
+	}
+	now := time.Now().Truncate(time.Second)
+	h, err := fsys.db.write(objCommit, encodeCommit(tree, fsys.head, fsys.author, now, fsys.message(fsys.changes)))
+	if err != nil {
+		return err
+	}
+	if err := updateRef(fsys.repo, fsys.ref, fsys.head, h); err != nil {
+		return err
+	}
+	fsys.head, fsys.tree, fsys.time, fsys.changes = &h, tree, now, nil
+	return nil
+}
+
+// writeTree writes the objects of the staged files in the directory n and its subdirectories, and the trees of
+// the directories that were read, and returns the name of the tree of n. Empty trees are not written, since git
+// does not record empty directories, and writeTree reports whether the tree of n is one.
+func (fsys *FS) writeTree(n *node) (hash, bool, error) {
+	if n.children == nil {
+		return n.hash, false, nil
+	}
+	var entries []treeEntry
+	for name, c := range n.children {
+		switch {
+		case c.isDir():
+			h, empty, err := fsys.writeTree(c)
+			if err != nil {
+				return hash{}, false, err
+			}
+			if !empty {
+				entries = append(entries, treeEntry{mode: c.mode, name: name, hash: h})
+			}
+			continue
+		case c.staged:
+			h, err := fsys.db.write(objBlob, c.data)
+			if err != nil {
+				return hash{}, false, err
+			}
+			c.hash, c.data, c.staged = h, nil, false
+		}
+		entries = append(entries, treeEntry{mode: c.mode, name: name, hash: c.hash})
+	}
+	if len(entries) == 0 {
+		return hash{}, true, nil
+	}
+	h, err := fsys.db.write(objTree, encodeTree(entries))
+	if err != nil {
+		return hash{}, false, err
+	}
+	n.hash = h
+	return h, false, nil
+}
+
+// entries returns the entries of the directory n, reading its tree if needed. The caller must hold fsys.mu.
+func (fsys *FS) entries(n *node) (map[string]*node, error) {
+	if n.children != nil {
+		return n.children, nil
+	}
+	typ, data, err := fsys.db.read(n.hash)
+	if err != nil {
+		return nil, err
+	}
+	if typ != objTree {
+		return nil, corrupt(n.hash, "not a tree")
+	}
+	entries, err := parseTree(n.hash, data)
+	if err != nil {
+		return nil, err
+	}
+	n.children = make(map[string]*node, len(entries))
+	for _, e := range entries {
+		n.children[e.name] = &node{mode: e.mode, hash: e.hash, size: -1}
+	}
+	return n.children, nil
+}
+
+// contents returns the contents of the file or symbolic link n. The caller must hold fsys.mu, and must not modify
+// the contents.
+func (fsys *FS) contents(n *node) ([]byte, error) {
+	if n.staged {
+		return n.data, nil
+	}
+	typ, data, err := fsys.db.read(n.hash)
+	if err != nil {
+		return nil, err
+	}
+	if typ != objBlob {
+		return nil, corrupt(n.hash, "not a blob")
+	}
+	return data, nil
+}
+
+// info returns the information on the node n named name. The caller must hold fsys.mu.
+func (fsys *FS) info(name string, n *node) (*fileInfo, error) {
+	fi := &fileInfo{name: name, modTime: n.modTime}
+	if fi.modTime.IsZero() {
+		fi.modTime = fsys.time
+	}
+	switch n.mode {
+	case modeDir:
+		fi.mode = wrfs.ModeDir | 0755
+		return fi, nil
+	case modeExec:
+		fi.mode = 0755
+	case modeSymlink:
+		fi.mode = wrfs.ModeSymlink | 0777
+	case modeGitlink:
+		fi.mode = wrfs.ModeIrregular
+		return fi, nil
+	default:
+		fi.mode = 0644
+	}
+	if n.size < 0 {
+		size, err := fsys.db.size(n.hash)
+		if err != nil {
+			return nil, err
+		}
+		n.size = size
+	}
+	fi.size = n.size
+	return fi, nil
+}
+
+// maxSymlinks is the maximum number of symbolic links followed while resolving a path.
+const maxSymlinks = 40
+
+// walk returns the node for name, following symbolic links in all but the last element, and in the last element
+// if follow is true. The caller must hold fsys.mu.
+func (fsys *FS) walk(name string, follow bool) (*node, error) {
+	return fsys.walkDepth(name, follow, 0)
+}
+
+func (fsys *FS) walkDepth(name string, follow bool, depth int) (*node, error) {
+	n := fsys.root
+	if name == "." {
+		return n, nil
+	}
+	dirPath := "."
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		if !n.isDir() {
+			return nil, syscall.ENOTDIR
+		}
+		entries, err := fsys.entries(n)
+		if err != nil {
+			return nil, err
+		}
+		child, ok := entries[part]
+		if !ok {
+			return nil, wrfs.ErrNotExist
+		}
+		childPath := path.Join(dirPath, part)
+		if child.isSymlink() && (follow || i < len(parts)-1) {
+			if depth >= maxSymlinks {
+				return nil, errno.ELOOP
+			}
+			target, err := fsys.contents(child)
+			if err != nil {
+				return nil, err
+			}
+			childPath = linkTarget(dirPath, string(target))
+			if child, err = fsys.walkDepth(childPath, true, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		n, dirPath = child, childPath
+	}
+	return n, nil
+}
+
+// linkTarget returns the path named by a symbolic link in dir with the given target. Absolute targets are
+// relative to the root, and the root's parent is the root itself.
+func linkTarget(dir, target string) string {
+	if strings.HasPrefix(target, "/") {
+		dir = "."
+	}
+	p := path.Join(dir, target)
+	for p == ".." || strings.HasPrefix(p, "../") {
+		p = strings.TrimPrefix(strings.TrimPrefix(p, ".."), "/")
+	}
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+// lookup is like walk, but validates name and returns errors as *PathErrors.
+func (fsys *FS) lookup(op, name string, follow bool) (*node, error) {
+	if !wrfs.ValidPath(name) {
+		return nil, &wrfs.PathError{Op: op, Path: name, Err: wrfs.ErrInvalid}
+	}
+	n, err := fsys.walk(name, follow)
+	if err != nil {
+		return nil, &wrfs.PathError{Op: op, Path: name, Err: err}
+	}
+	return n, nil
+}
+
+// parent returns the entries of the directory containing name and the last element of name. The caller must hold
+// fsys.mu.
+func (fsys *FS) parent(op, name string) (map[string]*node, string, error) {
+	if !wrfs.ValidPath(name) || name == "." {
+		return nil, "", &wrfs.PathError{Op: op, Path: name, Err: wrfs.ErrInvalid}
+	}
+	dir, err := fsys.walk(path.Dir(name), true)
+	if err == nil && !dir.isDir() {
+		err = syscall.ENOTDIR
+	}
+	var entries map[string]*node
+	if err == nil {
+		entries, err = fsys.entries(dir)
+	}
+	if err != nil {
+		return nil, "", &wrfs.PathError{Op: op, Path: name, Err: err}
+	}
+	return entries, path.Base(name), nil
+}
+
+// Open opens the named file for reading.
+func (fsys *FS) Open(name string) (wrfs.File, error) {
+	return fsys.OpenFile(name, wrfs.O_RDONLY, 0)
+}
+
+// OpenFile opens the named file with the specified flag (O_RDONLY etc.). If the file does not exist, and the
+// O_CREATE flag is passed, it is created, executable if perm has any execute bit set. The contents written to a
+// file are staged when it is closed or synced.
+func (fsys *FS) OpenFile(name string, flag int, perm wrfs.FileMode) (wrfs.File, error) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	n, err := fsys.lookup("open", name, true)
+	created := false
+	switch {
+	case err == nil && flag&(wrfs.O_CREATE|wrfs.O_EXCL) == wrfs.O_CREATE|wrfs.O_EXCL:
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrExist}
+	case errors.Is(err, wrfs.ErrNotExist) && flag&wrfs.O_CREATE != 0:
+		entries, base, err := fsys.parent("open", name)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := entries[base]; ok {
+			// A symbolic link to a missing file.
+			return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrNotExist}
+		}
+		n = &node{mode: modeFile}
+		if perm&0111 != 0 {
+			n.mode = modeExec
+		}
+		n.stage(nil)
+		entries[base] = n
+		created = true
+	case err != nil:
+		return nil, err
+	}
+
+	writable := flag&(wrfs.O_WRONLY|wrfs.O_RDWR) != 0
+	switch {
+	case n.isDir():
+		if writable {
+			return nil, &wrfs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+		}
+		return fsys.openDir(name, n)
+	case n.mode == modeGitlink:
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrUnsupported}
+	}
+	f := &file{fsys: fsys, name: name, node: n, flag: flag, dirty: created}
+	if writable && flag&wrfs.O_TRUNC != 0 {
+		n.stage(nil)
+		f.dirty = true
+	} else if f.data, err = fsys.contents(n); err != nil {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return f, nil
+}
+
+// openDir opens the directory n, reading its entries. The caller must hold fsys.mu.
+func (fsys *FS) openDir(name string, n *node) (wrfs.File, error) {
+	entries, err := fsys.readDir(n)
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: err}
+	}
+	info, err := fsys.info(path.Base(name), n)
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &dir{name: name, info: info, entries: entries}, nil
+}
+
+// readDir returns the entries of the directory n, sorted by name. The caller must hold fsys.mu.
+func (fsys *FS) readDir(n *node) ([]wrfs.DirEntry, error) {
+	children, err := fsys.entries(n)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]wrfs.DirEntry, 0, len(children))
+	for name, c := range children {
+		fi, err := fsys.info(name, c)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fi)
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// Stat returns a FileInfo describing the named file.
+func (fsys *FS) Stat(name string) (wrfs.FileInfo, error) {
+	return fsys.stat("stat", name, true)
+}
+
+// Lstat returns a FileInfo describing the named file, without following a symbolic link.
+func (fsys *FS) Lstat(name string) (wrfs.FileInfo, error) {
+	return fsys.stat("lstat", name, false)
+}
+
+func (fsys *FS) stat(op, name string, follow bool) (wrfs.FileInfo, error) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	n, err := fsys.lookup(op, name, follow)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := fsys.info(path.Base(name), n)
+	if err != nil {
+		return nil, &wrfs.PathError{Op: op, Path: name, Err: err}
+	}
+	return fi, nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by name.
+func (fsys *FS) ReadDir(name string) ([]wrfs.DirEntry, error) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	n, err := fsys.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !n.isDir() {
+		return nil, &wrfs.PathError{Op: "readdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	entries, err := fsys.readDir(n)
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+// Readlink returns the destination of the named symbolic link.
+func (fsys *FS) Readlink(name string) (string, error) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	n, err := fsys.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if !n.isSymlink() {
+		return "", &wrfs.PathError{Op: "readlink", Path: name, Err: wrfs.ErrInvalid}
+	}
+	target, err := fsys.contents(n)
+	if err != nil {
+		return "", &wrfs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return string(target), nil
+}
+
+// Mkdir creates a new directory with the specified name. The permission bits are ignored.
+func (fsys *FS) Mkdir(name string, perm wrfs.FileMode) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	entries, base, err := fsys.parent("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if _, ok := entries[base]; ok {
+		return &wrfs.PathError{Op: "mkdir", Path: name, Err: wrfs.ErrExist}
+	}
+	entries[base] = &node{mode: modeDir, children: make(map[string]*node), modTime: time.Now()}
+	return fsys.done("mkdir", name, "Create directory "+name)
+}
+
+// done records a change made by the operation op on the named file, returning the error of committing it as a
+// *PathError. The caller must hold fsys.mu.
+func (fsys *FS) done(op, name, change string) error {
+	if err := fsys.record(change); err != nil {
+		return &wrfs.PathError{Op: op, Path: name, Err: err}
+	}
+	return nil
+}
+
+// Symlink creates newname as a symbolic link to oldname.
+func (fsys *FS) Symlink(oldname, newname string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	entries, base, err := fsys.parent("symlink", newname)
+	if err != nil {
+		return &wrfs.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err.(*wrfs.PathError).Err}
+	}
+	if _, ok := entries[base]; ok {
+		return &wrfs.LinkError{Op: "symlink", Old: oldname, New: newname, Err: wrfs.ErrExist}
+	}
+	n := &node{mode: modeSymlink}
+	n.stage([]byte(oldname))
+	entries[base] = n
+	if err := fsys.record("Create symbolic link " + newname + " to " + oldname); err != nil {
+		return &wrfs.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+// Remove removes the named file or empty directory.
+func (fsys *FS) Remove(name string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	entries, base, err := fsys.parent("remove", name)
+	if err != nil {
+		return err
+	}
+	n, ok := entries[base]
+	if !ok {
+		return &wrfs.PathError{Op: "remove", Path: name, Err: wrfs.ErrNotExist}
+	}
+	if n.isDir() {
+		children, err := fsys.entries(n)
+		if err != nil {
+			return &wrfs.PathError{Op: "remove", Path: name, Err: err}
+		}
+		if len(children) > 0 {
+			return &wrfs.PathError{Op: "remove", Path: name, Err: errno.ENOTEMPTY}
+		}
+	}
+	delete(entries, base)
+	return fsys.done("remove", name, "Remove "+name)
+}
+
+// RemoveAll removes name and any children it contains, as a single change. It returns nil if name does not exist.
+func (fsys *FS) RemoveAll(name string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	entries, base, err := fsys.parent("removeall", name)
+	if errors.Is(err, wrfs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, ok := entries[base]; !ok {
+		return nil
+	}
+	delete(entries, base)
+	return fsys.done("removeall", name, "Remove "+name)
+}
+
+// Rename renames (moves) oldpath to newpath. An existing file at newpath is replaced, but, like os.Rename, an
+// existing directory never is.
+func (fsys *FS) Rename(oldpath, newpath string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	linkErr := func(err error) error {
+		if pathErr, ok := err.(*wrfs.PathError); ok {
+			err = pathErr.Err
+		}
+		return &wrfs.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	oldEntries, oldBase, err := fsys.parent("rename", oldpath)
+	if err != nil {
+		return linkErr(err)
+	}
+	newEntries, newBase, err := fsys.parent("rename", newpath)
+	if err != nil {
+		return linkErr(err)
+	}
+	n, ok := oldEntries[oldBase]
+	switch {
+	case !ok:
+		return linkErr(wrfs.ErrNotExist)
+	case oldpath == newpath:
+		return nil
+	case n.isDir() && strings.HasPrefix(newpath, oldpath+"/"):
+		return linkErr(wrfs.ErrInvalid)
+	}
+	if existing, ok := newEntries[newBase]; ok {
+		switch {
+		case existing.isDir():
+			return linkErr(wrfs.ErrExist)
+		case n.isDir():
+			return linkErr(syscall.ENOTDIR)
+		}
+	}
+	delete(oldEntries, oldBase)
+	newEntries[newBase] = n
+	if err := fsys.record("Rename " + oldpath + " to " + newpath); err != nil {
+		return linkErr(err)
+	}
+	return nil
+}
+
+// Chmod makes the named file executable if mode has any execute bit set, and not executable otherwise, which is
+// all that git records. It does nothing on directories and symbolic links.
+func (fsys *FS) Chmod(name string, mode wrfs.FileMode) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	n, err := fsys.lookup("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	if n.mode != modeFile && n.mode != modeExec {
+		return nil
+	}
+	newMode := uint32(modeFile)
+	if mode&0111 != 0 {
+		newMode = modeExec
+	}
+	if n.mode == newMode {
+		return nil
+	}
+	n.mode = newMode
+	if newMode == modeExec {
+		return fsys.done("chmod", name, "Make "+name+" executable")
+	}
+	return fsys.done("chmod", name, "Make "+name+" not executable")
+}
+
+// fileInfo describes a file or directory, and doubles as its directory entry.
+type fileInfo struct {
+	name    string
+	mode    wrfs.FileMode
+	size    int64
+	modTime time.Time
+}
+
+func (fi *fileInfo) Name() string                 { return fi.name }
+func (fi *fileInfo) Size() int64                  { return fi.size }
+func (fi *fileInfo) Mode() wrfs.FileMode          { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time           { return fi.modTime }
+func (fi *fileInfo) IsDir() bool                  { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() any                     { return nil }
+func (fi *fileInfo) Type() wrfs.FileMode          { return fi.mode.Type() }
+func (fi *fileInfo) Info() (wrfs.FileInfo, error) { return fi, nil }
@@ -0,0 +1,123 @@
+package gitfs_test
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/gitfs"
+	"github.com/relab/wrfs/memfs"
+	"github.com/relab/wrfs/wrfstest"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkContents(t *testing.T, fsys wrfs.FS, name, want string) {
+	t.Helper()
+	data, err := wrfs.ReadFile(fsys, name)
+	check(t, err)
+	if string(data) != want {
+		t.Errorf("%s contains %q, want %q", name, data, want)
+	}
+}
+
+func TestFS(t *testing.T) {
+	repo := memfs.New()
+	check(t, gitfs.Init(repo, "main"))
+	fsys, err := gitfs.New(repo, "HEAD", gitfs.CommitEach())
+	check(t, err)
+	if err := wrfstest.TestWriteFS(fsys, wrfstest.SkipChmod()); err != nil {
+		t.Fatal(err)
+	}
+
+	check(t, wrfs.MkdirAll(fsys, "etc/app", 0755))
+	check(t, wrfs.WriteFile(fsys, "etc/app/config", []byte("debug = true\n"), 0644))
+	head := fsys.Head()
+
+	// Another file system on the branch sees the commits, and records its changes in a single commit on Flush.
+	fsys, err = gitfs.New(repo, "refs/heads/main", gitfs.Author("Admin", "admin@example.com"))
+	check(t, err)
+	if fsys.Head() != head {
+		t.Errorf("Head() = %s, want %s", fsys.Head(), head)
+	}
+	checkContents(t, fsys, "etc/app/config", "debug = true\n")
+	check(t, wrfs.WriteFile(fsys, "etc/app/config", []byte("debug = false\n"), 0644))
+	check(t, wrfs.Rename(fsys, "etc/app/config", "etc/app/config.old"))
+	check(t, fsys.Flush())
+	if fsys.Head() == head {
+		t.Error("Flush did not commit")
+	}
+
+	// A file system that has not seen that commit cannot commit on top of the one before.
+	stale, err := gitfs.New(repo, "refs/heads/main")
+	check(t, err)
+	stale.Flush()
+	check(t, wrfs.WriteFile(fsys, "new", nil, 0644))
+	check(t, fsys.Flush())
+	check(t, wrfs.WriteFile(stale, "other", nil, 0644))
+	if err := stale.Flush(); !errors.Is(err, gitfs.ErrConflict) {
+		t.Errorf("Flush of a stale file system: got %v, want ErrConflict", err)
+	}
+
+	git, err := exec.LookPath("git")
+	if err != nil {
+		return
+	}
+	// Git reads the commits, and the file system reads objects packed by git.
+	dir := t.TempDir()
+	check(t, wrfs.CopyFS(wrfs.DirFS(dir), repo, "."))
+	run := func(args ...string) string {
+		t.Helper()
+		out, err := exec.Command(git, append([]string{"--git-dir", dir}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return string(out)
+	}
+	run("fsck", "--strict")
+	log := run("log", "--format=%an: %s", "-3")
+	if want := "Admin: Write new\nAdmin: Apply 2 changes\ngitfs: Write etc/app/config\n"; log != want {
+		t.Errorf("git log printed\n%s\nwant\n%s", log, want)
+	}
+	if out := run("show", "main:etc/app/config.old"); out != "debug = false\n" {
+		t.Errorf("git show printed %q", out)
+	}
+
+	fsys, err = gitfs.New(wrfs.DirFS(dir), "HEAD", gitfs.CommitEach())
+	check(t, err)
+	data := bytes.Repeat([]byte("0123456789abcdef\n"), 1000)
+	check(t, wrfs.WriteFile(fsys, "big", data, 0644))
+	// The new version is smaller, so that git packs it as a delta of the old one.
+	data = append(data[:8000:8000], "changed"...)
+	check(t, wrfs.WriteFile(fsys, "big", data, 0755))
+	check(t, wrfs.Chmod(fsys, "big", 0755))
+	run("gc", "--quiet", "--prune=now")
+	if matches, _ := filepath.Glob(filepath.Join(dir, "objects", "??")); len(matches) > 0 {
+		t.Errorf("git gc left loose objects: %v", matches)
+	}
+	fsys, err = gitfs.New(wrfs.DirFS(dir), "HEAD")
+	check(t, err)
+	got, err := wrfs.ReadFile(fsys, "big")
+	check(t, err)
+	if !bytes.Equal(got, data) {
+		t.Error("big differs from what was written after git gc")
+	}
+	fi, err := wrfs.Stat(fsys, "big")
+	check(t, err)
+	if fi.Size() != int64(len(data)) || fi.Mode() != 0755 {
+		t.Errorf("Stat(big) = size %d, mode %v", fi.Size(), fi.Mode())
+	}
+	checkContents(t, fsys, "etc/app/config.old", "debug = false\n")
+	check(t, wrfs.Remove(fsys, "new"))
+	check(t, fsys.Flush())
+	run("fsck", "--strict")
+}
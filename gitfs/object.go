@@ -0,0 +1,501 @@
+package gitfs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/relab/wrfs"
+)
+
+// A hash is the SHA-1 name of an object.
+type hash [sha1.Size]byte
+
+func (h hash) String() string { return hex.EncodeToString(h[:]) }
+
+// parseHash parses the hexadecimal name of an object.
+func parseHash(s string) (hash, bool) {
+	var h hash
+	if len(s) != 2*len(h) {
+		return h, false
+	}
+	_, err := hex.Decode(h[:], []byte(s))
+	return h, err == nil
+}
+
+// The types of objects, as numbered in packs.
+const (
+	objCommit   = 1
+	objTree     = 2
+	objBlob     = 3
+	objTag      = 4
+	objOfsDelta = 6
+	objRefDelta = 7
+)
+
+var typeNames = map[int]string{objCommit: "commit", objTree: "tree", objBlob: "blob", objTag: "tag"}
+
+// corrupt returns the error reported for an object that is missing or cannot be decoded.
+func corrupt(h hash, what string) error {
+	return errors.New("gitfs: object " + h.String() + ": " + what)
+}
+
+// An odb is the object database of a repository: the loose objects in the objects directory, one zlib-compressed
+// file per object, and the packs in objects/pack, written by git gc and git fetch.
+type odb struct {
+	fsys wrfs.FS // the git directory
+
+	mu      sync.Mutex
+	packs   []*pack
+	scanned bool // whether packs has been loaded
+}
+
+// looseName returns the name of the file of a loose object.
+func looseName(h hash) string {
+	s := h.String()
+	return "objects/" + s[:2] + "/" + s[2:]
+}
+
+// read returns the type and contents of an object.
+func (db *odb) read(h hash) (int, []byte, error) {
+	data, err := wrfs.ReadFile(db.fsys, looseName(h))
+	switch {
+	case err == nil:
+		return parseLoose(h, data)
+	case !errors.Is(err, wrfs.ErrNotExist):
+		return 0, nil, err
+	}
+	p, off, err := db.find(h)
+	if err != nil {
+		return 0, nil, err
+	}
+	return db.readPacked(p, off)
+}
+
+// parseLoose decompresses a loose object, which consists of a header with its type and size, and its contents.
+func parseLoose(h hash, data []byte) (int, []byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return 0, nil, corrupt(h, err.Error())
+	}
+	data, err = io.ReadAll(zr)
+	if err != nil {
+		return 0, nil, corrupt(h, err.Error())
+	}
+	header, data, ok := bytes.Cut(data, []byte{0})
+	typ, size, ok2 := parseHeader(string(header))
+	if !ok || !ok2 || size != int64(len(data)) {
+		return 0, nil, corrupt(h, "invalid header")
+	}
+	return typ, data, nil
+}
+
+// parseHeader parses the header of a loose object, such as "blob 42".
+func parseHeader(header string) (typ int, size int64, ok bool) {
+	name, sizeStr, _ := strings.Cut(header, " ")
+	for t, n := range typeNames {
+		if n == name {
+			typ = t
+		}
+	}
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	return typ, size, typ != 0 && err == nil && size >= 0
+}
+
+// size returns the size of the contents of an object, decompressing only as much of it as needed.
+func (db *odb) size(h hash) (int64, error) {
+	file, err := db.fsys.Open(looseName(h))
+	switch {
+	case err == nil:
+		defer file.Close()
+		zr, err := zlib.NewReader(bufio.NewReader(file))
+		if err != nil {
+			return 0, corrupt(h, err.Error())
+		}
+		header, err := bufio.NewReader(zr).ReadString(0)
+		if err != nil {
+			return 0, corrupt(h, "invalid header")
+		}
+		_, size, ok := parseHeader(strings.TrimSuffix(header, "\x00"))
+		if !ok {
+			return 0, corrupt(h, "invalid header")
+		}
+		return size, nil
+	case !errors.Is(err, wrfs.ErrNotExist):
+		return 0, err
+	}
+	p, off, err := db.find(h)
+	if err != nil {
+		return 0, err
+	}
+	file, err = db.fsys.Open(p.name)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	ra, err := readerAt(file)
+	if err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(io.NewSectionReader(ra, off, 1<<62))
+	typ, size, err := readPackHeader(r)
+	if err != nil || (typ != objOfsDelta && typ != objRefDelta) {
+		return size, err
+	}
+	// The size of a delta object is that of the delta, which starts with the sizes of its base and result.
+	if typ == objOfsDelta {
+		_, err = readOffset(r)
+	} else {
+		_, err = io.ReadFull(r, make([]byte, len(h)))
+	}
+	if err != nil {
+		return 0, err
+	}
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	br := bufio.NewReader(zr)
+	if _, err := binary.ReadUvarint(br); err != nil {
+		return 0, err
+	}
+	n, err := binary.ReadUvarint(br)
+	return int64(n), err
+}
+
+// has reports whether the object exists.
+func (db *odb) has(h hash) (bool, error) {
+	_, err := wrfs.Stat(db.fsys, looseName(h))
+	switch {
+	case err == nil:
+		return true, nil
+	case !errors.Is(err, wrfs.ErrNotExist):
+		return false, err
+	}
+	_, _, err = db.find(h)
+	if errors.Is(err, wrfs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// write stores an object as a loose object, unless it already exists, and returns its name.
+func (db *odb) write(typ int, data []byte) (hash, error) {
+	header := typeNames[typ] + " " + strconv.Itoa(len(data)) + "\x00"
+	sum := sha1.New()
+	sum.Write([]byte(header))
+	sum.Write(data)
+	var h hash
+	sum.Sum(h[:0])
+	if ok, err := db.has(h); ok || err != nil {
+		return h, err
+	}
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte(header))
+	zw.Write(data)
+	zw.Close()
+	name := looseName(h)
+	if err := wrfs.MkdirAll(db.fsys, path.Dir(name), 0755); err != nil {
+		return h, err
+	}
+	return h, wrfs.WriteFileAtomic(db.fsys, name, buf.Bytes(), 0444)
+}
+
+// find returns the pack containing an object and its offset in the pack. If the object is in none of the packs, it
+// loads the packs again, in case the repository has been repacked since they were loaded.
+func (db *odb) find(h hash) (*pack, int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for rescan := !db.scanned; ; rescan = true {
+		if rescan {
+			if err := db.scan(); err != nil {
+				return nil, 0, err
+			}
+		}
+		for _, p := range db.packs {
+			if off, ok := p.find(h); ok {
+				return p, off, nil
+			}
+		}
+		if rescan {
+			return nil, 0, &wrfs.PathError{Op: "read", Path: looseName(h), Err: wrfs.ErrNotExist}
+		}
+	}
+}
+
+// scan loads the indexes of the packs. The caller must hold db.mu.
+func (db *odb) scan() error {
+	entries, err := wrfs.ReadDir(db.fsys, "objects/pack")
+	if err != nil && !errors.Is(err, wrfs.ErrNotExist) {
+		return err
+	}
+	db.packs = db.packs[:0]
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".idx")
+		if !ok {
+			continue
+		}
+		idx, err := wrfs.ReadFile(db.fsys, "objects/pack/"+entry.Name())
+		if err != nil {
+			return err
+		}
+		p, err := parseIndex("objects/pack/"+name+".pack", idx)
+		if err != nil {
+			return err
+		}
+		db.packs = append(db.packs, p)
+	}
+	db.scanned = true
+	return nil
+}
+
+// A pack is the index of a pack, in version 2 of the format: a table of the number of objects whose names start
+// with each byte or less, the sorted names of the objects, their CRCs, and their offsets in the pack. Offsets of
+// 2 GiB and more are stored in a separate table of 64-bit offsets.
+type pack struct {
+	name    string // the name of the pack file
+	fanout  []byte
+	names   []byte
+	offsets []byte
+	large   []byte
+}
+
+// parseIndex parses the index of the named pack.
+func parseIndex(name string, idx []byte) (*pack, error) {
+	const headerSize = 8 + 256*4
+	if len(idx) < headerSize || string(idx[:8]) != "\xfftOc\x00\x00\x00\x02" {
+		return nil, errors.New("gitfs: " + name + ": unsupported index version")
+	}
+	p := &pack{name: name, fanout: idx[8:headerSize]}
+	n := int(binary.BigEndian.Uint32(p.fanout[255*4:]))
+	rest := idx[headerSize:]
+	if len(rest) < n*(sha1.Size+8) {
+		return nil, errors.New("gitfs: " + name + ": truncated index")
+	}
+	p.names = rest[:n*sha1.Size]
+	rest = rest[n*sha1.Size+n*4:] // skip the CRCs
+	p.offsets, p.large = rest[:n*4], rest[n*4:]
+	return p, nil
+}
+
+// find returns the offset of an object in the pack, and reports whether the pack contains it.
+func (p *pack) find(h hash) (int64, bool) {
+	lo := 0
+	if h[0] > 0 {
+		lo = int(binary.BigEndian.Uint32(p.fanout[(int(h[0])-1)*4:]))
+	}
+	hi := int(binary.BigEndian.Uint32(p.fanout[int(h[0])*4:]))
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.names[(lo+i)*sha1.Size:(lo+i+1)*sha1.Size], h[:]) >= 0
+	})
+	if i >= hi || !bytes.Equal(p.names[i*sha1.Size:(i+1)*sha1.Size], h[:]) {
+		return 0, false
+	}
+	off := binary.BigEndian.Uint32(p.offsets[i*4:])
+	if off&(1<<31) == 0 {
+		return int64(off), true
+	}
+	i = int(off &^ (1 << 31))
+	if (i+1)*8 > len(p.large) {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(p.large[i*8:])), true
+}
+
+// readPacked returns the type and contents of the object at offset off in the pack p.
+func (db *odb) readPacked(p *pack, off int64) (int, []byte, error) {
+	file, err := db.fsys.Open(p.name)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+	ra, err := readerAt(file)
+	if err != nil {
+		return 0, nil, err
+	}
+	return db.unpack(p, ra, off)
+}
+
+// unpack reads the object at offset off in the pack p, which can be read through ra. An object is stored with a
+// header holding its type and size, followed by its zlib-compressed contents, or by the name or offset of a base
+// object and a compressed delta that turns the base into the object.
+func (db *odb) unpack(p *pack, ra io.ReaderAt, off int64) (int, []byte, error) {
+	r := bufio.NewReader(io.NewSectionReader(ra, off, 1<<62))
+	typ, size, err := readPackHeader(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	var baseType int
+	var base []byte
+	switch typ {
+	case objOfsDelta:
+		d, err := readOffset(r)
+		if err != nil {
+			return 0, nil, err
+		}
+		if d <= 0 || d > off {
+			return 0, nil, errors.New("gitfs: " + p.name + ": invalid delta offset")
+		}
+		baseType, base, err = db.unpack(p, ra, off-d)
+		if err != nil {
+			return 0, nil, err
+		}
+	case objRefDelta:
+		var h hash
+		if _, err := io.ReadFull(r, h[:]); err != nil {
+			return 0, nil, err
+		}
+		baseType, base, err = db.read(h)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(zr, data); err != nil {
+		return 0, nil, err
+	}
+	if base == nil {
+		return typ, data, nil
+	}
+	data, err = applyDelta(base, data)
+	if err != nil {
+		return 0, nil, errors.New("gitfs: " + p.name + ": " + err.Error())
+	}
+	return baseType, data, nil
+}
+
+// readPackHeader reads the type and size of an object in a pack: the type is in bits 4 to 6 of the first byte, and
+// the size is a varint whose first byte holds only 4 bits.
+func readPackHeader(r io.ByteReader) (typ int, size int64, err error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	typ, size = int(c>>4&7), int64(c&15)
+	for shift := 4; c&0x80 != 0; shift += 7 {
+		if c, err = r.ReadByte(); err != nil {
+			return 0, 0, err
+		}
+		size |= int64(c&0x7f) << shift
+	}
+	return typ, size, nil
+}
+
+// readOffset reads the distance back to the base of an offset delta, a big-endian varint in which one is added to
+// all but the last group of 7 bits.
+func readOffset(r io.ByteReader) (int64, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	off := int64(c & 0x7f)
+	for c&0x80 != 0 {
+		if c, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+		off = (off+1)<<7 | int64(c&0x7f)
+	}
+	return off, nil
+}
+
+// applyDelta applies a delta to base. A delta consists of the sizes of the base and of the result, followed by
+// instructions that either copy a range of the base, or insert the bytes following the instruction.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	r := bytes.NewReader(delta)
+	baseSize, err := binary.ReadUvarint(r)
+	if err != nil || baseSize != uint64(len(base)) {
+		return nil, errors.New("delta does not match its base")
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errors.New("invalid delta")
+	}
+	out := make([]byte, 0, size)
+	for {
+		op, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		switch {
+		case op&0x80 != 0:
+			// The bits 0 to 3 tell which bytes of the offset follow, and the bits 4 to 6 which bytes of the size.
+			var off, n uint64
+			for i := 0; i < 7; i++ {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				c, err := r.ReadByte()
+				if err != nil {
+					return nil, errors.New("invalid delta")
+				}
+				if i < 4 {
+					off |= uint64(c) << (8 * i)
+				} else {
+					n |= uint64(c) << (8 * (i - 4))
+				}
+			}
+			if n == 0 {
+				n = 0x10000
+			}
+			if off+n > uint64(len(base)) {
+				return nil, errors.New("invalid delta")
+			}
+			out = append(out, base[off:off+n]...)
+		case op != 0:
+			start := len(out)
+			out = append(out, make([]byte, op)...)
+			if _, err := io.ReadFull(r, out[start:]); err != nil {
+				return nil, errors.New("invalid delta")
+			}
+		default:
+			return nil, errors.New("invalid delta")
+		}
+	}
+	if uint64(len(out)) != size {
+		return nil, errors.New("delta does not match its result")
+	}
+	return out, nil
+}
+
+// readerAt returns an io.ReaderAt reading file.
+func readerAt(file wrfs.File) (io.ReaderAt, error) {
+	switch f := file.(type) {
+	case io.ReaderAt:
+		return f, nil
+	case io.ReadSeeker:
+		return &seekReaderAt{r: f}, nil
+	}
+	return nil, wrfs.ErrUnsupported
+}
+
+// seekReaderAt implements io.ReaderAt for files that can only seek, which is all that packs are read with.
+type seekReaderAt struct {
+	r io.ReadSeeker
+}
+
+func (s *seekReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if _, err := s.r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(s.r, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,225 @@
+package gitfs
+
+import (
+	"bytes"
+	"errors"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/relab/wrfs"
+)
+
+// The modes of the entries of trees.
+const (
+	modeDir     = 0o40000
+	modeFile    = 0o100644
+	modeExec    = 0o100755
+	modeSymlink = 0o120000
+	modeGitlink = 0o160000 // a commit of a submodule
+)
+
+// A treeEntry is an entry of a tree object.
+type treeEntry struct {
+	mode uint32
+	name string
+	hash hash
+}
+
+// parseTree parses a tree object, a sequence of entries each consisting of the octal mode, a space, the name, a NUL
+// byte and the binary name of the object.
+func parseTree(h hash, data []byte) ([]treeEntry, error) {
+	var entries []treeEntry
+	for len(data) > 0 {
+		modeStr, rest, ok := bytes.Cut(data, []byte{' '})
+		name, rest, ok2 := bytes.Cut(rest, []byte{0})
+		mode, err := strconv.ParseUint(string(modeStr), 8, 32)
+		if !ok || !ok2 || err != nil || len(rest) < len(hash{}) {
+			return nil, corrupt(h, "invalid tree")
+		}
+		e := treeEntry{mode: uint32(mode), name: string(name)}
+		copy(e.hash[:], rest)
+		entries = append(entries, e)
+		data = rest[len(e.hash):]
+	}
+	return entries, nil
+}
+
+// encodeTree encodes a tree object. Git sorts the entries of trees by name, but as if the names of subtrees
+// ended with a slash.
+func encodeTree(entries []treeEntry) []byte {
+	key := func(e treeEntry) string {
+		if e.mode == modeDir {
+			return e.name + "/"
+		}
+		return e.name
+	}
+	sort.Slice(entries, func(i, j int) bool { return key(entries[i]) < key(entries[j]) })
+	var buf bytes.Buffer
+	for _, e := range entries {
+		buf.WriteString(strconv.FormatUint(uint64(e.mode), 8) + " " + e.name + "\x00")
+		buf.Write(e.hash[:])
+	}
+	return buf.Bytes()
+}
+
+// A signature identifies the author or committer of a commit.
+type signature struct {
+	name, email string
+}
+
+// encode returns the signature with a time, as in "Name <email> 1700000000 +0100".
+func (s signature) encode(t time.Time) string {
+	_, offset := t.Zone()
+	sign := "+"
+	if offset < 0 {
+		sign, offset = "-", -offset
+	}
+	tz := strconv.Itoa(100 + offset/3600)[1:] + strconv.Itoa(100 + offset/60%60)[1:]
+	return s.name + " <" + s.email + "> " + strconv.FormatInt(t.Unix(), 10) + " " + sign + tz
+}
+
+// A commit holds the fields of a commit object used by the file system.
+type commit struct {
+	tree hash
+	time time.Time // the time of the commit, in the time zone of the committer
+}
+
+// parseCommit parses the header of a commit object, which consists of lines such as "tree <hash>" and
+// "committer <signature>", ended by an empty line before the message.
+func parseCommit(h hash, data []byte) (commit, error) {
+	var c commit
+	header, _, _ := bytes.Cut(data, []byte("\n\n"))
+	hasTree := false
+	for _, line := range strings.Split(string(header), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree":
+			c.tree, hasTree = parseHash(value)
+		case "committer":
+			// The signature ends with the time in seconds and the time zone, as in "+0100".
+			fields := strings.Fields(value)
+			if len(fields) < 2 {
+				break
+			}
+			sec, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+			tz, err2 := strconv.Atoi(fields[len(fields)-1])
+			if err != nil || err2 != nil {
+				break
+			}
+			offset := (tz/100*60 + tz%100) * 60
+			c.time = time.Unix(sec, 0).In(time.FixedZone("", offset))
+		}
+	}
+	if !hasTree {
+		return c, corrupt(h, "invalid commit")
+	}
+	return c, nil
+}
+
+// encodeCommit encodes a commit object.
+func encodeCommit(tree hash, parent *hash, author signature, t time.Time, message string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("tree " + tree.String() + "\n")
+	if parent != nil {
+		buf.WriteString("parent " + parent.String() + "\n")
+	}
+	buf.WriteString("author " + author.encode(t) + "\n")
+	buf.WriteString("committer " + author.encode(t) + "\n\n")
+	buf.WriteString(message)
+	if !strings.HasSuffix(message, "\n") {
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// maxSymrefs is the maximum number of symbolic references followed while resolving a reference.
+const maxSymrefs = 5
+
+// symref returns the target of a symbolic reference, such as HEAD, which contains "ref: refs/heads/main", or ""
+// if name is not a symbolic reference.
+func symref(repo wrfs.FS, name string) (string, error) {
+	data, err := wrfs.ReadFile(repo, name)
+	if err != nil {
+		if errors.Is(err, wrfs.ErrNotExist) {
+			err = nil
+		}
+		return "", err
+	}
+	target, _ := strings.CutPrefix(strings.TrimSpace(string(data)), "ref: ")
+	if target == strings.TrimSpace(string(data)) {
+		return "", nil
+	}
+	return target, nil
+}
+
+// resolve returns the commit a reference points to, looking for it as a loose reference, a file holding the name of
+// the commit, and in the packed-refs file, which holds one reference per line. It reports whether the reference
+// exists, which it does not on a new branch.
+func resolve(repo wrfs.FS, name string) (hash, bool, error) {
+	data, err := wrfs.ReadFile(repo, name)
+	switch {
+	case err == nil:
+		s := strings.TrimSpace(string(data))
+		if h, ok := parseHash(s); ok {
+			return h, true, nil
+		}
+		return hash{}, false, errors.New("gitfs: invalid reference " + name + ": " + strconv.Quote(s))
+	case !errors.Is(err, wrfs.ErrNotExist):
+		return hash{}, false, err
+	}
+	data, err = wrfs.ReadFile(repo, "packed-refs")
+	if err != nil {
+		if errors.Is(err, wrfs.ErrNotExist) {
+			err = nil
+		}
+		return hash{}, false, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if h, ref, _ := strings.Cut(line, " "); ref == name {
+			if h, ok := parseHash(h); ok {
+				return h, true, nil
+			}
+		}
+	}
+	return hash{}, false, nil
+}
+
+// updateRef changes the reference name from old, or from not existing if old is nil, to h. Like git, it locks the
+// reference by creating name.lock, writes h to the lock file and renames it over the reference. The reference is
+// checked once locked, so that a concurrent update by git or another file system results in ErrConflict rather
+// than being lost.
+func updateRef(repo wrfs.FS, name string, old *hash, h hash) (err error) {
+	lock := name + ".lock"
+	if err := wrfs.MkdirAll(repo, path.Dir(name), 0755); err != nil {
+		return err
+	}
+	file, err := wrfs.OpenFile(repo, lock, wrfs.O_WRONLY|wrfs.O_CREATE|wrfs.O_EXCL, 0644)
+	if errors.Is(err, wrfs.ErrExist) {
+		return ErrConflict
+	} else if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			wrfs.Remove(repo, lock)
+		}
+	}()
+	_, err = wrfs.Write(file, []byte(h.String()+"\n"))
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	current, ok, err := resolve(repo, name)
+	switch {
+	case err != nil:
+		return err
+	case ok != (old != nil) || ok && current != *old:
+		return ErrConflict
+	}
+	return wrfs.Rename(repo, lock, name)
+}
@@ -1,3 +1,3 @@
 module github.com/relab/wrfs
 
-go 1.16
+go 1.21
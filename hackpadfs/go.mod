@@ -0,0 +1,10 @@
+module github.com/relab/wrfs/hackpadfs
+
+go 1.21
+
+require (
+	github.com/hack-pad/hackpadfs v0.2.4
+	github.com/relab/wrfs v0.0.0
+)
+
+replace github.com/relab/wrfs => ../
@@ -0,0 +1,199 @@
+// Package hackpadfs adapts file systems between wrfs and hackpadfs, so that the backends written for either are
+// usable through the other.
+//
+// Both projects extend io/fs with interfaces for writing, mostly with the same method names, but they differ in
+// which methods they expect of file systems and files, in the fallbacks of their helper functions, and in the
+// error reporting unsupported operations: wrfs.ErrUnsupported and hackpadfs.ErrNotImplemented. FromHackpad and
+// ToHackpad return file systems implementing all the extension interfaces of one project with the helper functions
+// of the other, translating the errors of unsupported operations, so that either side can rely on its own
+// interfaces and errors.
+//
+// The package is a separate module, so that the wrfs module does not depend on hackpadfs.
+package hackpadfs
+
+import (
+	"errors"
+	"time"
+
+	hackpad "github.com/hack-pad/hackpadfs"
+	"github.com/relab/wrfs"
+)
+
+// translate replaces the error from in err with to, keeping the operation and paths of *PathErrors and
+// *LinkErrors.
+func translate(err, from, to error) error {
+	if !errors.Is(err, from) {
+		return err
+	}
+	var pathErr *wrfs.PathError
+	if errors.As(err, &pathErr) {
+		return &wrfs.PathError{Op: pathErr.Op, Path: pathErr.Path, Err: to}
+	}
+	var linkErr *wrfs.LinkError
+	if errors.As(err, &linkErr) {
+		return &wrfs.LinkError{Op: linkErr.Op, Old: linkErr.Old, New: linkErr.New, Err: to}
+	}
+	return to
+}
+
+// fromErr translates an error of hackpadfs to one of wrfs.
+func fromErr(err error) error {
+	return translate(err, hackpad.ErrNotImplemented, wrfs.ErrUnsupported)
+}
+
+// FromHackpad returns a file system accessing the hackpadfs file system fsys through the helper functions of
+// hackpadfs, such as hackpadfs.OpenFile and hackpadfs.Chmod.
+func FromHackpad(fsys hackpad.FS) wrfs.FS {
+	return &fromFS{fsys: fsys}
+}
+
+type fromFS struct {
+	fsys hackpad.FS
+}
+
+func (f *fromFS) file(file hackpad.File, err error) (wrfs.File, error) {
+	if err != nil {
+		return nil, fromErr(err)
+	}
+	return &fromFile{file: file}, nil
+}
+
+func (f *fromFS) Open(name string) (wrfs.File, error) {
+	file, err := f.fsys.Open(name)
+	return f.file(file, err)
+}
+
+// OpenFile checks O_EXCL itself, since some backends, such as the mem package of hackpadfs, ignore it.
+func (f *fromFS) OpenFile(name string, flag int, perm wrfs.FileMode) (wrfs.File, error) {
+	if flag&(wrfs.O_CREATE|wrfs.O_EXCL) == wrfs.O_CREATE|wrfs.O_EXCL {
+		_, err := hackpad.Lstat(f.fsys, name)
+		if errors.Is(err, hackpad.ErrNotImplemented) {
+			_, err = hackpad.Stat(f.fsys, name)
+		}
+		if err == nil {
+			return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrExist}
+		}
+	}
+	file, err := hackpad.OpenFile(f.fsys, name, flag, perm)
+	return f.file(file, err)
+}
+
+func (f *fromFS) Stat(name string) (wrfs.FileInfo, error) {
+	fi, err := hackpad.Stat(f.fsys, name)
+	return fi, fromErr(err)
+}
+
+func (f *fromFS) Lstat(name string) (wrfs.FileInfo, error) {
+	fi, err := hackpad.Lstat(f.fsys, name)
+	return fi, fromErr(err)
+}
+
+func (f *fromFS) ReadDir(name string) ([]wrfs.DirEntry, error) {
+	entries, err := hackpad.ReadDir(f.fsys, name)
+	return entries, fromErr(err)
+}
+
+func (f *fromFS) ReadFile(name string) ([]byte, error) {
+	data, err := hackpad.ReadFile(f.fsys, name)
+	return data, fromErr(err)
+}
+
+func (f *fromFS) Mkdir(name string, perm wrfs.FileMode) error {
+	return fromErr(hackpad.Mkdir(f.fsys, name, perm))
+}
+
+func (f *fromFS) MkdirAll(name string, perm wrfs.FileMode) error {
+	return fromErr(hackpad.MkdirAll(f.fsys, name, perm))
+}
+
+func (f *fromFS) Remove(name string) error {
+	return fromErr(hackpad.Remove(f.fsys, name))
+}
+
+func (f *fromFS) RemoveAll(name string) error {
+	return fromErr(hackpad.RemoveAll(f.fsys, name))
+}
+
+func (f *fromFS) Rename(oldname, newname string) error {
+	return fromErr(hackpad.Rename(f.fsys, oldname, newname))
+}
+
+func (f *fromFS) Chmod(name string, mode wrfs.FileMode) error {
+	return fromErr(hackpad.Chmod(f.fsys, name, mode))
+}
+
+func (f *fromFS) Chown(name string, uid, gid int) error {
+	return fromErr(hackpad.Chown(f.fsys, name, uid, gid))
+}
+
+func (f *fromFS) Chtimes(name string, atime, mtime time.Time) error {
+	return fromErr(hackpad.Chtimes(f.fsys, name, atime, mtime))
+}
+
+func (f *fromFS) Symlink(oldname, newname string) error {
+	return fromErr(hackpad.Symlink(f.fsys, oldname, newname))
+}
+
+// fromFile is a hackpadfs file implementing the file interfaces of wrfs.
+type fromFile struct {
+	file hackpad.File
+}
+
+func (f *fromFile) Stat() (wrfs.FileInfo, error) {
+	fi, err := f.file.Stat()
+	return fi, fromErr(err)
+}
+
+func (f *fromFile) Read(p []byte) (int, error) {
+	n, err := f.file.Read(p)
+	return n, fromErr(err)
+}
+
+func (f *fromFile) Close() error {
+	return fromErr(f.file.Close())
+}
+
+func (f *fromFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := hackpad.ReadAtFile(f.file, p, off)
+	return n, fromErr(err)
+}
+
+func (f *fromFile) Write(p []byte) (int, error) {
+	n, err := hackpad.WriteFile(f.file, p)
+	return n, fromErr(err)
+}
+
+func (f *fromFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := hackpad.WriteAtFile(f.file, p, off)
+	return n, fromErr(err)
+}
+
+func (f *fromFile) Seek(offset int64, whence int) (int64, error) {
+	off, err := hackpad.SeekFile(f.file, offset, whence)
+	return off, fromErr(err)
+}
+
+func (f *fromFile) ReadDir(n int) ([]wrfs.DirEntry, error) {
+	entries, err := hackpad.ReadDirFile(f.file, n)
+	return entries, fromErr(err)
+}
+
+func (f *fromFile) Sync() error {
+	return fromErr(hackpad.SyncFile(f.file))
+}
+
+func (f *fromFile) Truncate(size int64) error {
+	return fromErr(hackpad.TruncateFile(f.file, size))
+}
+
+func (f *fromFile) Chmod(mode wrfs.FileMode) error {
+	return fromErr(hackpad.ChmodFile(f.file, mode))
+}
+
+func (f *fromFile) Chown(uid, gid int) error {
+	return fromErr(hackpad.ChownFile(f.file, uid, gid))
+}
+
+func (f *fromFile) Chtimes(atime, mtime time.Time) error {
+	return fromErr(hackpad.ChtimesFile(f.file, atime, mtime))
+}
@@ -0,0 +1,67 @@
+package hackpadfs_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	hackpad "github.com/hack-pad/hackpadfs"
+	"github.com/hack-pad/hackpadfs/mem"
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/hackpadfs"
+	"github.com/relab/wrfs/memfs"
+	"github.com/relab/wrfs/wrfstest"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFromHackpad(t *testing.T) {
+	memFS, err := mem.NewFS()
+	check(t, err)
+	fsys := hackpadfs.FromHackpad(memFS)
+	if err := wrfstest.TestWriteFS(fsys, wrfstest.SkipChown()); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys = hackpadfs.FromHackpad(fstest.MapFS{"file": {Data: []byte("hello")}})
+	if err := wrfs.Mkdir(fsys, "dir", 0755); !errors.Is(err, wrfs.ErrUnsupported) {
+		t.Errorf("Mkdir on a MapFS: got %v, want ErrUnsupported", err)
+	}
+}
+
+func TestToHackpad(t *testing.T) {
+	fsys := memfs.New()
+	hfs := hackpadfs.ToHackpad(fsys)
+	check(t, hackpad.MkdirAll(hfs, "dir/sub", 0755))
+	file, err := hackpad.Create(hfs, "dir/file")
+	check(t, err)
+	_, err = hackpad.WriteFile(file, []byte("hello"))
+	check(t, err)
+	check(t, hackpad.TruncateFile(file, 4))
+	check(t, file.Close())
+	data, err := wrfs.ReadFile(fsys, "dir/file")
+	check(t, err)
+	if string(data) != "hell" {
+		t.Errorf("dir/file contains %q", data)
+	}
+	check(t, hackpad.Rename(hfs, "dir/file", "moved"))
+	check(t, hackpad.RemoveAll(hfs, "dir"))
+	if _, err := wrfs.Stat(fsys, "dir"); !errors.Is(err, wrfs.ErrNotExist) {
+		t.Errorf("RemoveAll did not remove dir: %v", err)
+	}
+
+	hfs = hackpadfs.ToHackpad(fstest.MapFS{"file": {Data: []byte("hello")}})
+	if err := hackpad.Mkdir(hfs, "dir", 0755); !errors.Is(err, hackpad.ErrNotImplemented) {
+		t.Errorf("Mkdir on a MapFS: got %v, want ErrNotImplemented", err)
+	}
+
+	// Round trip through both adapters.
+	if err := wrfstest.TestWriteFS(hackpadfs.FromHackpad(hackpadfs.ToHackpad(memfs.New()))); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,195 @@
+package hackpadfs
+
+import (
+	"io"
+	"os"
+	"time"
+
+	hackpad "github.com/hack-pad/hackpadfs"
+	"github.com/relab/wrfs"
+)
+
+// toErr translates an error of wrfs to one of hackpadfs.
+func toErr(err error) error {
+	return translate(err, wrfs.ErrUnsupported, hackpad.ErrNotImplemented)
+}
+
+// ToHackpad returns a hackpadfs file system accessing fsys through the helper functions of wrfs, such as
+// wrfs.OpenFile and wrfs.Chmod.
+func ToHackpad(fsys wrfs.FS) hackpad.FS {
+	return &toFS{fsys: fsys}
+}
+
+type toFS struct {
+	fsys wrfs.FS
+}
+
+func (t *toFS) file(name string, file wrfs.File, err error) (hackpad.File, error) {
+	if err != nil {
+		return nil, toErr(err)
+	}
+	return &toFile{file: file, name: name}, nil
+}
+
+func (t *toFS) Open(name string) (hackpad.File, error) {
+	file, err := t.fsys.Open(name)
+	return t.file(name, file, err)
+}
+
+func (t *toFS) OpenFile(name string, flag int, perm hackpad.FileMode) (hackpad.File, error) {
+	file, err := wrfs.OpenFile(t.fsys, name, flag, perm)
+	return t.file(name, file, err)
+}
+
+func (t *toFS) Create(name string) (hackpad.File, error) {
+	return t.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (t *toFS) Stat(name string) (hackpad.FileInfo, error) {
+	fi, err := wrfs.Stat(t.fsys, name)
+	return fi, toErr(err)
+}
+
+func (t *toFS) Lstat(name string) (hackpad.FileInfo, error) {
+	fi, err := wrfs.Lstat(t.fsys, name)
+	return fi, toErr(err)
+}
+
+func (t *toFS) ReadDir(name string) ([]hackpad.DirEntry, error) {
+	entries, err := wrfs.ReadDir(t.fsys, name)
+	return entries, toErr(err)
+}
+
+func (t *toFS) ReadFile(name string) ([]byte, error) {
+	data, err := wrfs.ReadFile(t.fsys, name)
+	return data, toErr(err)
+}
+
+func (t *toFS) Mkdir(name string, perm hackpad.FileMode) error {
+	return toErr(wrfs.Mkdir(t.fsys, name, perm))
+}
+
+func (t *toFS) MkdirAll(name string, perm hackpad.FileMode) error {
+	return toErr(wrfs.MkdirAll(t.fsys, name, perm))
+}
+
+func (t *toFS) Remove(name string) error {
+	return toErr(wrfs.Remove(t.fsys, name))
+}
+
+func (t *toFS) RemoveAll(name string) error {
+	return toErr(wrfs.RemoveAll(t.fsys, name))
+}
+
+func (t *toFS) Rename(oldname, newname string) error {
+	return toErr(wrfs.Rename(t.fsys, oldname, newname))
+}
+
+func (t *toFS) Chmod(name string, mode hackpad.FileMode) error {
+	return toErr(wrfs.Chmod(t.fsys, name, mode))
+}
+
+func (t *toFS) Chown(name string, uid, gid int) error {
+	return toErr(wrfs.Chown(t.fsys, name, uid, gid))
+}
+
+func (t *toFS) Chtimes(name string, atime, mtime time.Time) error {
+	return toErr(wrfs.Chtimes(t.fsys, name, atime, mtime))
+}
+
+func (t *toFS) Symlink(oldname, newname string) error {
+	return toErr(wrfs.Symlink(t.fsys, oldname, newname))
+}
+
+// toFile is a wrfs file implementing the file interfaces of hackpadfs.
+type toFile struct {
+	file wrfs.File
+	name string
+}
+
+func (f *toFile) unsupported(op string) error {
+	return &wrfs.PathError{Op: op, Path: f.name, Err: hackpad.ErrNotImplemented}
+}
+
+func (f *toFile) Stat() (hackpad.FileInfo, error) {
+	fi, err := f.file.Stat()
+	return fi, toErr(err)
+}
+
+func (f *toFile) Read(p []byte) (int, error) {
+	n, err := f.file.Read(p)
+	return n, toErr(err)
+}
+
+func (f *toFile) Close() error {
+	return toErr(f.file.Close())
+}
+
+func (f *toFile) ReadAt(p []byte, off int64) (int, error) {
+	if file, ok := f.file.(io.ReaderAt); ok {
+		n, err := file.ReadAt(p, off)
+		return n, toErr(err)
+	}
+	return 0, f.unsupported("readat")
+}
+
+func (f *toFile) Write(p []byte) (int, error) {
+	n, err := wrfs.Write(f.file, p)
+	return n, toErr(err)
+}
+
+func (f *toFile) WriteAt(p []byte, off int64) (int, error) {
+	if file, ok := f.file.(io.WriterAt); ok {
+		n, err := file.WriteAt(p, off)
+		return n, toErr(err)
+	}
+	return 0, f.unsupported("writeat")
+}
+
+func (f *toFile) Seek(offset int64, whence int) (int64, error) {
+	off, err := wrfs.Seek(f.file, offset, whence)
+	return off, toErr(err)
+}
+
+func (f *toFile) ReadDir(n int) ([]hackpad.DirEntry, error) {
+	if dir, ok := f.file.(wrfs.ReadDirFile); ok {
+		entries, err := dir.ReadDir(n)
+		return entries, toErr(err)
+	}
+	return nil, f.unsupported("readdir")
+}
+
+func (f *toFile) Sync() error {
+	if file, ok := f.file.(wrfs.SyncFile); ok {
+		return toErr(file.Sync())
+	}
+	return f.unsupported("sync")
+}
+
+func (f *toFile) Truncate(size int64) error {
+	if file, ok := f.file.(wrfs.TruncateFile); ok {
+		return toErr(file.Truncate(size))
+	}
+	return f.unsupported("truncate")
+}
+
+func (f *toFile) Chmod(mode hackpad.FileMode) error {
+	if file, ok := f.file.(wrfs.ChmodFile); ok {
+		return toErr(file.Chmod(mode))
+	}
+	return f.unsupported("chmod")
+}
+
+func (f *toFile) Chown(uid, gid int) error {
+	if file, ok := f.file.(wrfs.ChownFile); ok {
+		return toErr(file.Chown(uid, gid))
+	}
+	return f.unsupported("chown")
+}
+
+func (f *toFile) Chtimes(atime, mtime time.Time) error {
+	if file, ok := f.file.(wrfs.ChtimesFile); ok {
+		return toErr(file.Chtimes(atime, mtime))
+	}
+	return f.unsupported("chtimes")
+}
@@ -0,0 +1,91 @@
+package wrfs
+
+import (
+	"encoding/binary"
+	"hash"
+	"io"
+	"path"
+)
+
+// HashTree returns a digest of the tree rooted at root, computed with the hash functions returned by h, such as
+// sha256.New, that changes whenever the name, type, permission bits or contents of any file or directory in the
+// tree change, but not when only their modification times or other metadata do. Equal trees on different file
+// systems have equal digests. The digest of root itself covers its type and contents, but not its name or
+// permission bits.
+//
+// The digest of a regular file is that of its contents, and the digest of a symbolic link is that of its target.
+// The digest of a directory is that of the names, modes and digests of its entries, sorted by name, forming a
+// Merkle tree. Other files have empty contents as far as HashTree is concerned.
+func HashTree(fsys FS, root string, h func() hash.Hash) ([]byte, error) {
+	sums, err := HashTreeDirs(fsys, root, h)
+	if err != nil {
+		return nil, err
+	}
+	return sums[path.Clean(root)], nil
+}
+
+// HashTreeDirs is like HashTree, but returns the digests of all directories in the tree, including root, by path,
+// so that two trees can be compared incrementally, by only descending into the directories whose digests differ.
+// If root is not a directory, the result only holds its digest.
+func HashTreeDirs(fsys FS, root string, h func() hash.Hash) (map[string][]byte, error) {
+	root = path.Clean(root)
+	fi, err := Stat(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[string][]byte)
+	sum, err := hashTree(fsys, root, fi.Mode(), h, sums)
+	if err != nil {
+		return nil, err
+	}
+	sums[root] = sum
+	return sums, nil
+}
+
+// hashTree returns the digest of the named file, which has the given mode, adding those of directories to sums.
+func hashTree(fsys FS, name string, mode FileMode, h func() hash.Hash, sums map[string][]byte) (sum []byte, err error) {
+	d := h()
+	switch {
+	case mode.IsDir():
+		entries, err := ReadDir(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		var buf [4]byte
+		for _, entry := range entries {
+			child := path.Join(name, entry.Name())
+			fi, err := entry.Info()
+			if err != nil {
+				return nil, err
+			}
+			sum, err := hashTree(fsys, child, fi.Mode(), h, sums)
+			if err != nil {
+				return nil, err
+			}
+			if fi.IsDir() {
+				sums[child] = sum
+			}
+			io.WriteString(d, entry.Name())
+			d.Write([]byte{0})
+			binary.BigEndian.PutUint32(buf[:], uint32(fi.Mode()&(ModeType|ModePerm)))
+			d.Write(buf[:])
+			d.Write(sum)
+		}
+	case mode.IsRegular():
+		var file File
+		if file, err = fsys.Open(name); err != nil {
+			return nil, err
+		}
+		defer safeClose(file, &err)
+		if _, err = io.Copy(d, file); err != nil {
+			return nil, err
+		}
+	case mode&ModeSymlink != 0:
+		target, err := Readlink(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		io.WriteString(d, target)
+	}
+	return d.Sum(nil), nil
+}
@@ -0,0 +1,50 @@
+package wrfs_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestHashTree(t *testing.T) {
+	fsys1, fsys2 := newLowerFS(t), newLowerFS(t)
+	mtime := time.Now().Add(-time.Hour)
+	check(t, Chtimes(fsys2, "dir/file", mtime, mtime))
+	sum1, err := HashTree(fsys1, ".", sha256.New)
+	check(t, err)
+	sum2, err := HashTree(fsys2, ".", sha256.New)
+	check(t, err)
+	if !bytes.Equal(sum1, sum2) {
+		t.Error("HashTree differs for equal trees")
+	}
+
+	check(t, WriteFile(fsys2, "dir/sub/file", []byte("upper"), 0644))
+	dirs1, err := HashTreeDirs(fsys1, "dir", sha256.New)
+	check(t, err)
+	dirs2, err := HashTreeDirs(fsys2, "dir", sha256.New)
+	check(t, err)
+	if len(dirs1) != 2 || len(dirs2) != 2 {
+		t.Errorf("HashTreeDirs returned %d and %d digests, want 2", len(dirs1), len(dirs2))
+	}
+	for _, dir := range []string{"dir", "dir/sub"} {
+		if bytes.Equal(dirs1[dir], dirs2[dir]) {
+			t.Errorf("HashTreeDirs digest of %s unchanged by changed contents", dir)
+		}
+	}
+	for _, change := range []func(FS) error{
+		func(fsys FS) error { return Rename(fsys, "dir/file", "dir/renamed") },
+		func(fsys FS) error { return Chmod(fsys, "dir/renamed", 0600) },
+		func(fsys FS) error { return Symlink(fsys, "renamed", "dir/link") },
+	} {
+		check(t, change(fsys1))
+		sum, err := HashTree(fsys1, ".", sha256.New)
+		check(t, err)
+		if bytes.Equal(sum, sum1) {
+			t.Error("HashTree unchanged by change of tree")
+		}
+		sum1 = sum
+	}
+}
@@ -0,0 +1,22 @@
+package wrfs_test
+
+import (
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func checkContents(t *testing.T, fsys FS, name, want string) {
+	t.Helper()
+	data, err := ReadFile(fsys, name)
+	check(t, err)
+	if string(data) != want {
+		t.Errorf("%s: got: %q, want: %q", name, data, want)
+	}
+}
+
+func check(t *testing.T, err error) {
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,178 @@
+package wrfs
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"syscall"
+)
+
+// HTTPFS returns an http.FileSystem for serving the files of fsys with http.FileServer. Unlike http.FS, it supports
+// files that cannot seek, which http.ServeContent needs for determining their sizes and serving ranges of them: such
+// files are read up to the offsets sought, and reopened to seek backwards.
+func HTTPFS(fsys FS) http.FileSystem {
+	return httpFS{fsys}
+}
+
+type httpFS struct {
+	fsys FS
+}
+
+func (h httpFS) Open(name string) (http.File, error) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		name = "."
+	}
+	file, err := h.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &httpFile{File: file, fsys: h.fsys, name: name}, nil
+}
+
+// httpFile is an open file of an httpFS.
+type httpFile struct {
+	File
+	fsys FS
+	name string
+	off  int64 // the offset sought, for files that cannot seek
+	read int64 // the offset of File, for files that cannot seek
+}
+
+func (f *httpFile) Read(p []byte) (int, error) {
+	if _, ok := f.File.(io.Seeker); ok {
+		return f.File.Read(p)
+	}
+	if f.read > f.off {
+		file, err := f.fsys.Open(f.name)
+		if err != nil {
+			return 0, err
+		}
+		f.File.Close()
+		f.File, f.read = file, 0
+	}
+	if f.read < f.off {
+		n, err := io.CopyN(io.Discard, f.File, f.off-f.read)
+		f.read += n
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.File.Read(p)
+	f.off += int64(n)
+	f.read += int64(n)
+	return n, err
+}
+
+func (f *httpFile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.File.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		fi, err := f.File.Stat()
+		if err != nil {
+			return 0, err
+		}
+		offset += fi.Size()
+	}
+	if offset < 0 {
+		return 0, &PathError{Op: "seek", Path: f.name, Err: ErrInvalid}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *httpFile) Readdir(count int) ([]FileInfo, error) {
+	dir, ok := f.File.(ReadDirFile)
+	if !ok {
+		return nil, &PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+	}
+	entries, err := dir.ReadDir(count)
+	infos := make([]FileInfo, 0, len(entries))
+	for _, e := range entries {
+		fi, err := e.Info()
+		if errors.Is(err, ErrNotExist) {
+			continue // removed since it was listed
+		}
+		if err != nil {
+			return infos, err
+		}
+		infos = append(infos, fi)
+	}
+	return infos, err
+}
+
+// FileServer returns a handler that serves the files of fsys like http.FileServer with HTTPFS, and also modifies
+// them: PUT requests write the request body to a file with OpenFile, creating or truncating it, DELETE requests
+// remove a file or empty directory with Remove, and MKCOL requests create a directory with Mkdir. It provides simple
+// read-write access over HTTP for clients that do not need WebDAV.
+//
+// Any client can modify any file fsys lets them, so fsys should be wrapped, such as with ReadOnly, and the handler
+// with authentication, to restrict what they can do.
+func FileServer(fsys FS) http.Handler {
+	return &fileServer{fsys, http.FileServer(HTTPFS(fsys))}
+}
+
+type fileServer struct {
+	fsys FS
+	http.Handler
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		s.Handler.ServeHTTP(w, r)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	var status int
+	var err error
+	switch {
+	case r.Method != http.MethodPut && r.Method != http.MethodDelete && r.Method != "MKCOL":
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE, MKCOL")
+		status = http.StatusMethodNotAllowed
+	case name == "":
+		status = http.StatusForbidden
+	case r.Method == http.MethodPut:
+		status, err = s.put(r, name)
+	case r.Method == http.MethodDelete:
+		status, err = http.StatusNoContent, Remove(s.fsys, name)
+	default:
+		status, err = http.StatusCreated, Mkdir(s.fsys, name, 0777)
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNotExist):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrPermission):
+		status = http.StatusForbidden
+	case errors.Is(err, ErrExist):
+		status = http.StatusConflict
+	default:
+		status = http.StatusInternalServerError
+	}
+	w.WriteHeader(status)
+}
+
+// put writes the body of r to the named file, returning whether it was created or replaced.
+func (s *fileServer) put(r *http.Request, name string) (status int, err error) {
+	status = http.StatusNoContent
+	if _, err := Stat(s.fsys, name); errors.Is(err, ErrNotExist) {
+		status = http.StatusCreated
+	}
+	file, err := OpenFile(s.fsys, name, O_WRONLY|O_CREATE|O_TRUNC, 0666)
+	if err != nil {
+		return 0, err
+	}
+	defer safeClose(file, &err)
+	w, ok := file.(io.Writer)
+	if !ok {
+		return 0, &PathError{Op: "write", Path: name, Err: ErrUnsupported}
+	}
+	_, err = io.Copy(w, r.Body)
+	return status, err
+}
@@ -0,0 +1,85 @@
+package wrfs_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+// noSeekFS hides the Seek methods of the regular files of an FS.
+type noSeekFS struct{ FS }
+
+func (n noSeekFS) Open(name string) (File, error) {
+	file, err := n.FS.Open(name)
+	if _, ok := file.(ReadDirFile); err != nil || ok {
+		return file, err
+	}
+	return struct{ File }{file}, nil
+}
+
+func TestHTTPFS(t *testing.T) {
+	fsys := newLowerFS(t)
+	check(t, WriteFile(fsys, "dir/long", []byte("hello, world"), 0644))
+	srv := httptest.NewServer(http.FileServer(HTTPFS(noSeekFS{fsys})))
+	defer srv.Close()
+
+	get := func(path string, header ...string) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		check(t, err)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		check(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		check(t, err)
+		return resp.StatusCode, string(data)
+	}
+	if status, body := get("/dir/long", "Range", "bytes=7-"); status != http.StatusPartialContent || body != "world" {
+		t.Errorf("GET with range: got status %d and %q", status, body)
+	}
+	if status, body := get("/dir/long", "Range", "bytes=7-9,0-4"); status != http.StatusPartialContent ||
+		!strings.Contains(body, "wor") || !strings.Contains(body, "hello") {
+		t.Errorf("GET with ranges: got status %d and %q", status, body)
+	}
+	if status, body := get("/dir/"); status != http.StatusOK || !strings.Contains(body, `href="sub/"`) {
+		t.Errorf("GET of directory: got status %d and %q", status, body)
+	}
+
+	srv.Config.Handler = FileServer(fsys)
+	for _, req := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodPut, "/dir/new", "new", http.StatusCreated},
+		{http.MethodPut, "/dir/new", "newer", http.StatusNoContent},
+		{http.MethodPut, "/missing/new", "", http.StatusNotFound},
+		{"MKCOL", "/made", "", http.StatusCreated},
+		{"MKCOL", "/made", "", http.StatusConflict},
+		{http.MethodDelete, "/dir/file", "", http.StatusNoContent},
+		{http.MethodDelete, "/", "", http.StatusForbidden},
+		{http.MethodPost, "/dir/new", "", http.StatusMethodNotAllowed},
+	} {
+		r, err := http.NewRequest(req.method, srv.URL+req.path, strings.NewReader(req.body))
+		check(t, err)
+		resp, err := http.DefaultClient.Do(r)
+		check(t, err)
+		resp.Body.Close()
+		if resp.StatusCode != req.status {
+			t.Errorf("%s %s: got status %d, want %d", req.method, req.path, resp.StatusCode, req.status)
+		}
+	}
+	if status, body := get("/dir/new"); status != http.StatusOK || body != "newer" {
+		t.Errorf("GET after PUT: got status %d and %q", status, body)
+	}
+	if _, err := Stat(fsys, "dir/file"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("DELETE did not remove dir/file: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package wrfs
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"strings"
+)
+
+// IgnorePatterns is a list of patterns in the format of .gitignore files, parsed by ParseIgnore.
+type IgnorePatterns struct {
+	patterns []ignorePattern
+}
+
+type ignorePattern struct {
+	segments []string // the path elements to match, where "**" matches any number of elements
+	negate   bool     // whether the pattern starts with "!", re-including what earlier patterns excluded
+	dirOnly  bool     // whether the pattern ends with "/", only matching directories
+}
+
+// ParseIgnore parses the patterns of a .gitignore file, one per line. As in .gitignore files, blank lines and lines
+// starting with "#" are skipped, a leading "!" negates a pattern, a trailing "/" makes a pattern only match
+// directories, and "**" matches any number of directories. Patterns containing a "/" other than a trailing one
+// match paths relative to the root, while other patterns match files with that name in any directory.
+// Trailing spaces are ignored, and "\" escapes the special characters.
+func ParseIgnore(data []byte) *IgnorePatterns {
+	var ip IgnorePatterns
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+			line = line[:len(line)-1]
+		}
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		var p ignorePattern
+		if line[0] == '!' {
+			p.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		if !strings.Contains(line, "/") {
+			line = "**/" + line
+		}
+		line = strings.ReplaceAll(strings.TrimPrefix(line, "/"), "[!", "[^")
+		p.segments = strings.Split(line, "/")
+		ip.patterns = append(ip.patterns, p)
+	}
+	return &ip
+}
+
+// Match reports whether the file or directory name, a slash-separated path relative to the root of the patterns,
+// is ignored: whether the last pattern that matches it is not negated. It does not consider whether the parent
+// directories of name are ignored.
+func (ip *IgnorePatterns) Match(name string, isDir bool) bool {
+	elems := strings.Split(name, "/")
+	ignored := false
+	for _, p := range ip.patterns {
+		if (!p.dirOnly || isDir) && matchSegments(p.segments, elems) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// matchSegments reports whether the path elements match the pattern elements.
+func matchSegments(segments, elems []string) bool {
+	if len(segments) == 0 {
+		return len(elems) == 0
+	}
+	if segments[0] == "**" {
+		for i := 0; i <= len(elems); i++ {
+			if matchSegments(segments[1:], elems[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(elems) == 0 {
+		return false
+	}
+	ok, _ := path.Match(segments[0], elems[0])
+	return ok && matchSegments(segments[1:], elems[1:])
+}
+
+// Ignore returns a file system that presents the files of fsys that are not ignored by the patterns, as Filter
+// does. As with git, the contents of an ignored directory are ignored as well, even if a negated pattern matches
+// them. Ignored files cannot be created, modified or removed through the returned file system.
+//
+// To honor the .gitignore file at the root of a tree:
+//
+//	data, err := wrfs.ReadFile(fsys, ".gitignore")
+//	if err != nil && !errors.Is(err, wrfs.ErrNotExist) {
+//		return err
+//	}
+//	fsys = wrfs.Ignore(fsys, wrfs.ParseIgnore(data))
+func Ignore(fsys FS, patterns *IgnorePatterns) FS {
+	return Filter(fsys, func(name string, d DirEntry) bool {
+		return !patterns.Match(name, d != nil && d.IsDir())
+	})
+}
@@ -0,0 +1,51 @@
+package wrfs_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestIgnore(t *testing.T) {
+	patterns := ParseIgnore([]byte(`# build output
+*.log
+!keep.log
+/build/
+docs/**/*.tmp
+\#literal
+`))
+	for _, tt := range []struct {
+		name  string
+		isDir bool
+		want  bool
+	}{
+		{"app.log", false, true},
+		{"dir/app.log", false, true},
+		{"dir/keep.log", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"dir/build", true, false},
+		{"docs/a/b/x.tmp", false, true},
+		{"docs/x.tmp", false, true},
+		{"x.tmp", false, false},
+		{"#literal", false, true},
+	} {
+		if got := patterns.Match(tt.name, tt.isDir); got != tt.want {
+			t.Errorf("Match(%q, %v) = %v, want %v", tt.name, tt.isDir, got, tt.want)
+		}
+	}
+
+	lower := newLowerFS(t)
+	check(t, WriteFile(lower, "dir/app.log", nil, 0644))
+	check(t, WriteFile(lower, "dir/keep.log", nil, 0644))
+	fsys := Ignore(lower, ParseIgnore([]byte("*.log\n!keep.log\nsub/\n")))
+	var names []string
+	check(t, WalkDir(fsys, ".", func(name string, d DirEntry, err error) error {
+		names = append(names, name)
+		return err
+	}))
+	if got, want := strings.Join(names, " "), ". dir dir/file dir/keep.log"; got != want {
+		t.Errorf("walked %q, want %q", got, want)
+	}
+}
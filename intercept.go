@@ -0,0 +1,261 @@
+package wrfs
+
+import (
+	"context"
+	"time"
+)
+
+// An Invocation describes an operation passed to an Interceptor.
+type Invocation struct {
+	// Ctx is the context of the operation: the context given to OpenContext, OpenFileContext, RemoveContext
+	// and RemoveAllContext, and context.Background() for the other operations.
+	Ctx context.Context
+
+	// Op is the name of the operation, as reported by WithStats, such as "open", "stat" or "rename".
+	Op string
+
+	// Path is the name of the file operated on, or the pattern for glob. For operations on two paths,
+	// Path and NewPath are the old and new names, as in a *LinkError.
+	Path    string
+	NewPath string
+
+	// Flag holds the flags given to OpenFile and OpenFileContext.
+	Flag int
+}
+
+// An Interceptor intercepts the operations of a file system wrapped with Wrap.
+type Interceptor interface {
+	// Intercept is called for each operation with a description of it, and a function that performs it
+	// and returns its error. It must either call next once and return its error, possibly wrapped,
+	// or fail the operation by returning an error without calling next.
+	Intercept(inv *Invocation, next func() error) error
+}
+
+// InterceptorFunc is an adapter to allow the use of ordinary functions as interceptors.
+type InterceptorFunc func(inv *Invocation, next func() error) error
+
+// Intercept returns f(inv, next).
+func (f InterceptorFunc) Intercept(inv *Invocation, next func() error) error {
+	return f(inv, next)
+}
+
+// Wrap returns a file system that passes every operation on fsys through the interceptors, with the first
+// interceptor being the outermost. The returned file system implements every extension interface, forwarding
+// to fsys where it implements them and falling back to the package helpers otherwise, and its Capabilities
+// are those of fsys. Operations on open files are not intercepted.
+//
+// Wrap makes it possible to write wrappers for logging, metrics or access policies as a single method,
+// instead of implementing each extension interface.
+func Wrap(fsys FS, ics ...Interceptor) FS {
+	return &interceptFS{fsWrapper{fsys}, ics}
+}
+
+type interceptFS struct {
+	fsWrapper
+	ics []Interceptor
+}
+
+// invoke performs fn through the interceptors.
+func (w *interceptFS) invoke(inv *Invocation, fn func() error) error {
+	var next func(i int) error
+	next = func(i int) error {
+		if i == len(w.ics) {
+			return fn()
+		}
+		return w.ics[i].Intercept(inv, func() error { return next(i + 1) })
+	}
+	return next(0)
+}
+
+func (w *interceptFS) call(ctx context.Context, op, name, newName string, fn func() error) error {
+	return w.invoke(&Invocation{Ctx: ctx, Op: op, Path: name, NewPath: newName}, fn)
+}
+
+func (w *interceptFS) do(op, name string, fn func() error) error {
+	return w.call(context.Background(), op, name, "", fn)
+}
+
+func (w *interceptFS) Open(name string) (file File, err error) {
+	err = w.do("open", name, func() (err error) {
+		file, err = w.fsys.Open(name)
+		return err
+	})
+	return file, err
+}
+
+func (w *interceptFS) OpenContext(ctx context.Context, name string) (file File, err error) {
+	err = w.call(ctx, "open", name, "", func() (err error) {
+		file, err = OpenContext(ctx, w.fsys, name)
+		return err
+	})
+	return file, err
+}
+
+func (w *interceptFS) Stat(name string) (fi FileInfo, err error) {
+	err = w.do("stat", name, func() (err error) {
+		fi, err = Stat(w.fsys, name)
+		return err
+	})
+	return fi, err
+}
+
+func (w *interceptFS) Lstat(name string) (fi FileInfo, err error) {
+	err = w.do("lstat", name, func() (err error) {
+		fi, err = Lstat(w.fsys, name)
+		return err
+	})
+	return fi, err
+}
+
+func (w *interceptFS) ReadDir(name string) (entries []DirEntry, err error) {
+	err = w.do("readdir", name, func() (err error) {
+		entries, err = ReadDir(w.fsys, name)
+		return err
+	})
+	return entries, err
+}
+
+func (w *interceptFS) ReadFile(name string) (data []byte, err error) {
+	err = w.do("readfile", name, func() (err error) {
+		data, err = ReadFile(w.fsys, name)
+		return err
+	})
+	return data, err
+}
+
+func (w *interceptFS) Glob(pattern string) (matches []string, err error) {
+	err = w.do("glob", pattern, func() (err error) {
+		matches, err = Glob(w.fsys, pattern)
+		return err
+	})
+	return matches, err
+}
+
+func (w *interceptFS) OpenFile(name string, flag int, perm FileMode) (file File, err error) {
+	return w.OpenFileContext(context.Background(), name, flag, perm)
+}
+
+func (w *interceptFS) OpenFileContext(ctx context.Context, name string, flag int, perm FileMode) (file File, err error) {
+	inv := &Invocation{Ctx: ctx, Op: "openfile", Path: name, Flag: flag}
+	err = w.invoke(inv, func() (err error) {
+		file, err = OpenFileContext(ctx, w.fsys, name, flag, perm)
+		return err
+	})
+	return file, err
+}
+
+func (w *interceptFS) WriteFile(name string, data []byte, perm FileMode) error {
+	return w.do("writefile", name, func() error { return WriteFile(w.fsys, name, data, perm) })
+}
+
+func (w *interceptFS) Chmod(name string, mode FileMode) error {
+	return w.do("chmod", name, func() error { return Chmod(w.fsys, name, mode) })
+}
+
+func (w *interceptFS) Chown(name string, uid, gid int) error {
+	return w.do("chown", name, func() error { return Chown(w.fsys, name, uid, gid) })
+}
+
+func (w *interceptFS) Lchown(name string, uid, gid int) error {
+	return w.do("lchown", name, func() error { return Lchown(w.fsys, name, uid, gid) })
+}
+
+func (w *interceptFS) Chtimes(name string, atime, mtime time.Time) error {
+	return w.do("chtimes", name, func() error { return Chtimes(w.fsys, name, atime, mtime) })
+}
+
+// Capabilities reports the capabilities of the wrapped file system, including Lchtimes, which is intercepted
+// unlike Mkfifo and Mknod.
+func (w *interceptFS) Capabilities() CapSet {
+	return Capabilities(w.fsys) &^ (CapMkfifo | CapMknod)
+}
+
+func (w *interceptFS) Lchtimes(name string, atime, mtime time.Time) error {
+	return w.do("lchtimes", name, func() error { return Lchtimes(w.fsys, name, atime, mtime) })
+}
+
+func (w *interceptFS) Mkdir(name string, perm FileMode) error {
+	return w.do("mkdir", name, func() error { return Mkdir(w.fsys, name, perm) })
+}
+
+func (w *interceptFS) MkdirAll(path string, perm FileMode) error {
+	return w.do("mkdirall", path, func() error { return MkdirAll(w.fsys, path, perm) })
+}
+
+func (w *interceptFS) Readlink(name string) (link string, err error) {
+	err = w.do("readlink", name, func() (err error) {
+		link, err = Readlink(w.fsys, name)
+		return err
+	})
+	return link, err
+}
+
+func (w *interceptFS) Remove(name string) error {
+	return w.do("remove", name, func() error { return Remove(w.fsys, name) })
+}
+
+func (w *interceptFS) RemoveContext(ctx context.Context, name string) error {
+	return w.call(ctx, "remove", name, "", func() error { return RemoveContext(ctx, w.fsys, name) })
+}
+
+func (w *interceptFS) RemoveAll(path string) error {
+	return w.do("removeall", path, func() error { return RemoveAll(w.fsys, path) })
+}
+
+func (w *interceptFS) RemoveAllContext(ctx context.Context, path string) error {
+	return w.call(ctx, "removeall", path, "", func() error { return RemoveAllContext(ctx, w.fsys, path) })
+}
+
+func (w *interceptFS) Rename(oldpath, newpath string) error {
+	return w.call(context.Background(), "rename", oldpath, newpath, func() error {
+		return Rename(w.fsys, oldpath, newpath)
+	})
+}
+
+func (w *interceptFS) Symlink(oldname, newname string) error {
+	return w.call(context.Background(), "symlink", oldname, newname, func() error {
+		return Symlink(w.fsys, oldname, newname)
+	})
+}
+
+func (w *interceptFS) Link(oldname, newname string) error {
+	return w.call(context.Background(), "link", oldname, newname, func() error {
+		return Link(w.fsys, oldname, newname)
+	})
+}
+
+func (w *interceptFS) Sync(name string) error {
+	return w.do("sync", name, func() error { return Sync(w.fsys, name) })
+}
+
+func (w *interceptFS) SyncDir(dir string) error {
+	return w.do("syncdir", dir, func() error { return SyncDir(w.fsys, dir) })
+}
+
+func (w *interceptFS) Statfs(name string) (info FSInfo, err error) {
+	err = w.do("statfs", name, func() (err error) {
+		info, err = Statfs(w.fsys, name)
+		return err
+	})
+	return info, err
+}
+
+func (w *interceptFS) OpenLock(name string) (file LockFile, err error) {
+	err = w.do("openlock", name, func() (err error) {
+		file, err = OpenLock(w.fsys, name)
+		return err
+	})
+	return file, err
+}
+
+func (w *interceptFS) Watch(name string, opts ...WatchOption) (events <-chan Event, stop func(), err error) {
+	err = w.do("watch", name, func() (err error) {
+		events, stop, err = Watch(w.fsys, name, opts...)
+		return err
+	})
+	return events, stop, err
+}
+
+func (w *interceptFS) Truncate(name string, size int64) error {
+	return w.do("truncate", name, func() error { return Truncate(w.fsys, name, size) })
+}
@@ -0,0 +1,45 @@
+package wrfs_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+)
+
+func TestWrap(t *testing.T) {
+	var calls []string
+	trace := func(prefix string) Interceptor {
+		return InterceptorFunc(func(inv *Invocation, next func() error) error {
+			calls = append(calls, prefix+" "+inv.Op+" "+inv.Path+" "+inv.NewPath)
+			return next()
+		})
+	}
+	deny := InterceptorFunc(func(inv *Invocation, next func() error) error {
+		if inv.Op == "remove" {
+			return &PathError{Op: inv.Op, Path: inv.Path, Err: ErrPermission}
+		}
+		return next()
+	})
+	fsys := Wrap(newLowerFS(t), trace("outer"), deny, trace("inner"))
+
+	checkContents(t, fsys, "dir/file", "lower")
+	check(t, Rename(fsys, "dir/file", "dir/renamed"))
+	if err := Remove(fsys, "dir/renamed"); !errors.Is(err, ErrPermission) {
+		t.Errorf("Remove: got %v, want ErrPermission", err)
+	}
+	if caps := Capabilities(fsys); caps != Capabilities(memfs.New()) {
+		t.Errorf("Capabilities = %v, want those of memfs", caps)
+	}
+
+	want := []string{
+		"outer readfile dir/file ", "inner readfile dir/file ",
+		"outer rename dir/file dir/renamed", "inner rename dir/file dir/renamed",
+		"outer remove dir/renamed ",
+	}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+}
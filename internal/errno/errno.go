@@ -0,0 +1,18 @@
+//go:build !plan9
+// +build !plan9
+
+// Package errno defines the system errors that the file systems of wrfs report, portably. On systems with
+// errnos, they are the errnos of package syscall, so that errors.Is matches them against those; plan9, which
+// reports errors as strings, lacks some of them, and errno defines them with the messages of the others.
+package errno
+
+import "syscall"
+
+const (
+	ELOOP     = syscall.ELOOP
+	ENOTEMPTY = syscall.ENOTEMPTY
+	EBADF     = syscall.EBADF
+	ENOSPC    = syscall.ENOSPC
+	EXDEV     = syscall.EXDEV
+	ENXIO     = syscall.ENXIO
+)
@@ -0,0 +1,12 @@
+package errno
+
+import "syscall"
+
+var (
+	ELOOP     = syscall.NewError("too many levels of symbolic links")
+	ENOTEMPTY = syscall.NewError("directory not empty")
+	EBADF     = syscall.NewError("bad file descriptor")
+	ENOSPC    = syscall.NewError("no space left on device")
+	EXDEV     = syscall.NewError("cross-device link")
+	ENXIO     = syscall.NewError("no such device or address")
+)
@@ -0,0 +1,68 @@
+// Package extract holds the checks and steps that the archive extractors of tarfs and zipfs share.
+package extract
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/relab/wrfs"
+)
+
+// SafeName returns the cleaned name of a file in an archive, or an error matching wrfs.ErrPermission if it is
+// outside of dst or inside a symbolic link.
+func SafeName(dst wrfs.FS, name string) (string, error) {
+	clean := path.Clean(strings.TrimPrefix(name, "./"))
+	if !wrfs.ValidPath(clean) {
+		return "", &wrfs.PathError{Op: "extract", Path: name, Err: wrfs.ErrPermission}
+	}
+	for dir := path.Dir(clean); dir != "."; dir = path.Dir(dir) {
+		if err := NotSymlink(dst, dir); err != nil {
+			return "", &wrfs.PathError{Op: "extract", Path: name, Err: wrfs.ErrPermission}
+		}
+	}
+	return clean, nil
+}
+
+// NotSymlink returns an error matching wrfs.ErrPermission if name is a symbolic link in dst, which MkdirAll, Chmod
+// and Chtimes would follow, possibly outside of dst.
+func NotSymlink(dst wrfs.FS, name string) error {
+	if fi, err := wrfs.Lstat(dst, name); err == nil && fi.Mode()&wrfs.ModeSymlink != 0 {
+		return &wrfs.PathError{Op: "extract", Path: name, Err: wrfs.ErrPermission}
+	}
+	return nil
+}
+
+// Inside reports whether the target of the symbolic link name is a relative path inside the file system.
+func Inside(name, target string) bool {
+	return !path.IsAbs(target) && wrfs.ValidPath(path.Join(path.Dir(name), target))
+}
+
+// Replace removes name if it exists and is not a directory, so that it can be replaced.
+func Replace(dst wrfs.FS, name string) error {
+	fi, err := wrfs.Lstat(dst, name)
+	if err != nil || fi.IsDir() {
+		return nil
+	}
+	return wrfs.Remove(dst, name)
+}
+
+// SetMetadata sets the permission bits and modification time of name, where dst supports them. It leaves symbolic
+// links alone, since their permission bits and times cannot be set without following them, and fails if name has
+// been replaced by one.
+func SetMetadata(dst wrfs.FS, name string, mode wrfs.FileMode, mtime time.Time) error {
+	if mode&wrfs.ModeSymlink != 0 {
+		return nil
+	}
+	if err := NotSymlink(dst, name); err != nil {
+		return err
+	}
+	if err := wrfs.Chmod(dst, name, mode&(wrfs.ModePerm|wrfs.ModeSetuid|wrfs.ModeSetgid|wrfs.ModeSticky)); err != nil && !errors.Is(err, wrfs.ErrUnsupported) {
+		return err
+	}
+	if err := wrfs.Chtimes(dst, name, time.Time{}, mtime); err != nil && !errors.Is(err, wrfs.ErrUnsupported) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+//go:build go1.23
+// +build go1.23
+
+package wrfs
+
+import (
+	"io"
+	"iter"
+)
+
+// entriesBatch is the number of entries that Entries reads from a directory at a time.
+const entriesBatch = 128
+
+// All returns an iterator over the files and directories in the tree rooted at root, including root, in the order
+// WalkDir visits them, yielding the path and DirEntry of each. Stopping the iteration stops the walk.
+//
+// Errors are skipped: a root that does not exist yields nothing, and directories that cannot be read are yielded
+// without their contents. Use WalkDir to handle errors.
+func All(fsys FS, root string) iter.Seq2[string, DirEntry] {
+	return func(yield func(string, DirEntry) bool) {
+		WalkDir(fsys, root, func(path string, d DirEntry, err error) error {
+			if err != nil {
+				return nil // d is nil for a root that cannot be statted, and was yielded already otherwise
+			}
+			if !yield(path, d) {
+				return SkipAll
+			}
+			return nil
+		})
+	}
+}
+
+// Entries returns an iterator over the entries of the named directory, reading them incrementally, in the order
+// the directory returns them rather than sorted by name. If reading the directory fails, the error is yielded
+// with a nil DirEntry, after which the iteration ends.
+func Entries(fsys FS, dir string) iter.Seq2[DirEntry, error] {
+	return func(yield func(DirEntry, error) bool) {
+		pager, err := ReadDirPages(fsys, dir, entriesBatch, ReadDirUnsorted())
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer pager.Close()
+		for {
+			entries, err := pager.Next()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, entry := range entries {
+				if !yield(entry, nil) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+//go:build go1.23
+// +build go1.23
+
+package wrfs_test
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestAll(t *testing.T) {
+	fsys := newLowerFS(t)
+	var visited []string
+	for name := range All(fsys, ".") {
+		visited = append(visited, name)
+		if name == "dir/sub" {
+			break
+		}
+	}
+	if got, want := strings.Join(visited, " "), ". dir dir/file dir/sub"; got != want {
+		t.Errorf("All visited %q, want %q", got, want)
+	}
+	for name := range All(fsys, "missing") {
+		t.Errorf("All(missing) yielded %s", name)
+	}
+}
+
+func TestEntries(t *testing.T) {
+	fsys := newLowerFS(t)
+	for i := 0; i < 300; i++ {
+		check(t, WriteFile(fsys, "dir/sub/"+strings.Repeat("x", i+1), nil, 0644))
+	}
+	var names []string
+	for entry, err := range Entries(fsys, "dir/sub") {
+		check(t, err)
+		names = append(names, entry.Name())
+	}
+	if len(names) != 301 {
+		t.Errorf("Entries(dir/sub) yielded %d entries, want 301", len(names))
+	}
+	for _, err := range Entries(fsys, "missing") {
+		if !errors.Is(err, ErrNotExist) {
+			t.Errorf("Entries(missing): got %v, want ErrNotExist", err)
+		}
+	}
+}
+
+func TestSearchContent(t *testing.T) {
+	fsys := newLowerFS(t)
+	check(t, WriteFile(fsys, "dir/notes", []byte("first\r\nTODO: second\nthird TODO"), 0644))
+	check(t, WriteFile(fsys, "dir/sub/binary", []byte("TODO\x00"), 0644))
+	check(t, WriteFile(fsys, "dir/sub/large", bytes.Repeat([]byte("TODO\n"), 100), 0644))
+	var got []string
+	for m := range SearchContent(fsys, ".", regexp.MustCompile("TODO").Match, SearchMaxSize(100)) {
+		check(t, m.Err)
+		got = append(got, m.Path+":"+strconv.Itoa(m.Line)+":"+m.Text)
+	}
+	if want := "dir/notes:2:TODO: second dir/notes:3:third TODO"; strings.Join(got, " ") != want {
+		t.Errorf("SearchContent = %q, want %q", got, want)
+	}
+	n := 0
+	todo := func(line []byte) bool { return bytes.Contains(line, []byte("TODO")) }
+	for m := range SearchContent(fsys, "dir/sub", todo, SearchBinary()) {
+		check(t, m.Err)
+		if n++; n == 50 {
+			break
+		}
+	}
+	if n != 50 {
+		t.Errorf("SearchContent with SearchBinary stopped after %d matches, want 50", n)
+	}
+	for m := range SearchContent(fsys, "missing", todo) {
+		if !errors.Is(m.Err, ErrNotExist) {
+			t.Errorf("SearchContent(missing) yielded %+v, want ErrNotExist", m)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package wrfs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A JournalFS is a file system that records the multi-step operations made through it in a journal, so that
+// operations interrupted by a crash can be completed or undone by Recover. Use Journaled to create one.
+//
+// Each operation is recorded in the journal, and the journal synced to stable storage if possible, before the
+// operation starts, and marked as done when it ends. The journal is removed when no operations are in progress.
+// It is hidden from ReadDir and Glob, and the directories containing it cannot be removed.
+type JournalFS struct {
+	fsWrapper
+	journal string
+
+	mu      sync.Mutex
+	next    uint64 // the ID of the next operation
+	pending int    // the number of operations in progress
+}
+
+// Journaled recovers the operations left incomplete in the named journal of fsys, as Recover does,
+// and returns a JournalFS that records its operations in the journal.
+func Journaled(fsys FS, journal string) (*JournalFS, error) {
+	if err := Recover(fsys, journal); err != nil {
+		return nil, err
+	}
+	return &JournalFS{fsWrapper: fsWrapper{fsys}, journal: journal}, nil
+}
+
+// Journal operations, and how Recover handles them when they are incomplete.
+const (
+	journalRemoveAll = "removeall" // completed, as a partially removed tree cannot be restored
+	journalCopy      = "copy"      // undone, by removing the destination
+)
+
+// Recover completes or undoes the operations recorded in the named journal of fsys that were not marked as
+// done, and removes the journal. Interrupted removals are completed, and interrupted copies are undone by
+// removing the partial copy. A missing journal means there is nothing to recover.
+//
+// Recover must not be called while a JournalFS is using the journal.
+func Recover(fsys FS, journal string) error {
+	data, err := ReadFile(fsys, journal)
+	if errors.Is(err, ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ops, err := parseJournal(data)
+	if err != nil {
+		return &PathError{Op: "recover", Path: journal, Err: err}
+	}
+	for _, op := range ops {
+		switch op[0] {
+		case journalRemoveAll:
+			err = RemoveAll(fsys, op[1])
+		case journalCopy:
+			err = RemoveAll(fsys, op[2])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := Remove(fsys, journal); err != nil && !errors.Is(err, ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// parseJournal returns the operations in the journal that were not marked as done, in the order they were
+// started, each as its name followed by its arguments.
+func parseJournal(data []byte) ([][]string, error) {
+	var ids []string
+	ops := make(map[string][]string)
+	// A torn final record belongs to an operation that never started.
+	data = data[:bytes.LastIndexByte(data, '\n')+1]
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields, err := parseJournalLine(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		switch kind, id := fields[0], fields[1]; {
+		case kind == "end" && len(fields) == 2:
+			delete(ops, id)
+		case kind == "begin" && len(fields) == 4 && fields[2] == journalRemoveAll,
+			kind == "begin" && len(fields) == 5 && fields[2] == journalCopy:
+			ids = append(ids, id)
+			ops[id] = fields[2:]
+		default:
+			return nil, ErrInvalid
+		}
+	}
+	var pending [][]string
+	for _, id := range ids {
+		if op, ok := ops[id]; ok {
+			pending = append(pending, op)
+		}
+	}
+	return pending, scanner.Err()
+}
+
+// parseJournalLine splits a journal record into its kind, its operation ID and, for the start of an operation,
+// the operation and its quoted arguments.
+func parseJournalLine(line string) ([]string, error) {
+	kind, rest, _ := strings.Cut(line, " ")
+	id, rest, _ := strings.Cut(rest, " ")
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return nil, ErrInvalid
+	}
+	fields := []string{kind, id}
+	if rest != "" {
+		var op string
+		op, rest, _ = strings.Cut(rest, " ")
+		fields = append(fields, op)
+	}
+	for rest != "" {
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return nil, ErrInvalid
+		}
+		arg, _ := strconv.Unquote(quoted)
+		fields = append(fields, arg)
+		rest = strings.TrimPrefix(rest[len(quoted):], " ")
+	}
+	return fields, nil
+}
+
+// record appends a record to the journal and syncs it.
+func (j *JournalFS) record(line string) (err error) {
+	file, err := OpenFile(j.fsys, j.journal, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer safeClose(file, &err)
+	if _, err := Write(file, []byte(line+"\n")); err != nil {
+		return err
+	}
+	return syncFile(file)
+}
+
+// begin records the start of an operation, and returns its ID.
+func (j *JournalFS) begin(op string, args ...string) (string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	id := strconv.FormatUint(j.next, 10)
+	line := "begin " + id + " " + op
+	for _, arg := range args {
+		line += " " + strconv.Quote(arg)
+	}
+	if err := j.record(line); err != nil {
+		return "", err
+	}
+	if j.pending == 0 {
+		// The journal was created, and must not be lost with its directory entry.
+		if err := syncDir(j.fsys, path.Dir(j.journal)); err != nil {
+			return "", err
+		}
+	}
+	j.next++
+	j.pending++
+	return id, nil
+}
+
+// end records the end of the operation with the given ID, and removes the journal if no operations are left.
+func (j *JournalFS) end(id string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.pending--
+	if j.pending == 0 {
+		return Remove(j.fsys, j.journal)
+	}
+	return j.record("end " + id)
+}
+
+// containsJournal reports whether name is the journal or one of the directories containing it.
+func (j *JournalFS) containsJournal(name string) bool {
+	return name == "." || name == j.journal || strings.HasPrefix(j.journal, name+"/")
+}
+
+// RemoveAll removes the tree rooted at name. If it is interrupted, Recover completes the removal.
+func (j *JournalFS) RemoveAll(name string) error {
+	if j.containsJournal(name) {
+		return &PathError{Op: "removeall", Path: name, Err: ErrPermission}
+	}
+	id, err := j.begin(journalRemoveAll, name)
+	if err != nil {
+		return err
+	}
+	if err := RemoveAll(j.fsys, name); err != nil {
+		return err // left in the journal, for Recover to retry
+	}
+	return j.end(id)
+}
+
+// Copy copies the file or directory tree src to dst, which must not exist, as CopyFS does with the given options.
+// If it fails or is interrupted, the partial copy is removed, by Copy itself or by Recover.
+func (j *JournalFS) Copy(src, dst string, opts ...CopyOption) error {
+	fi, err := Stat(j.fsys, src)
+	if err != nil {
+		return err
+	}
+	if _, err := lstatOrStat(j.fsys, dst); err == nil {
+		return &PathError{Op: "copy", Path: dst, Err: ErrExist}
+	}
+	if strings.HasPrefix(dst, src+"/") || src == "." {
+		return &PathError{Op: "copy", Path: dst, Err: ErrInvalid}
+	}
+	id, err := j.begin(journalCopy, src, dst)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		err = j.copyDir(src, dst, fi.Mode().Perm(), opts)
+	} else {
+		err = CopyFile(j.fsys, dst, j.fsys, src)
+	}
+	if err != nil {
+		if rerr := RemoveAll(j.fsys, dst); rerr != nil {
+			return err // left in the journal, for Recover to undo
+		}
+	}
+	if eerr := j.end(id); err == nil {
+		err = eerr
+	}
+	return err
+}
+
+func (j *JournalFS) copyDir(src, dst string, perm FileMode, opts []CopyOption) error {
+	if err := Mkdir(j.fsys, dst, perm); err != nil {
+		return err
+	}
+	dstFS, err := Sub(j.fsys, dst)
+	if err != nil {
+		return err
+	}
+	return CopyFS(dstFS, j.fsys, src, opts...)
+}
+
+// hide reports whether name, in the directory of the journal, is the journal.
+func (j *JournalFS) hide(name string) bool {
+	return name == path.Base(j.journal)
+}
+
+func (j *JournalFS) Open(name string) (File, error) {
+	file, err := j.fsys.Open(name)
+	if err != nil || name != path.Dir(j.journal) {
+		return file, err
+	}
+	if fi, err := file.Stat(); err == nil && fi.IsDir() {
+		return hidingDir{file, j.hide}, nil
+	}
+	return file, nil
+}
+
+func (j *JournalFS) ReadDir(name string) ([]DirEntry, error) {
+	entries, err := ReadDir(j.fsys, name)
+	if name == path.Dir(j.journal) {
+		entries = filterEntries(entries, j.hide)
+	}
+	return entries, err
+}
+
+func (j *JournalFS) Glob(pattern string) ([]string, error) {
+	matches, err := Glob(j.fsys, pattern)
+	filtered := matches[:0]
+	for _, match := range matches {
+		if match != j.journal {
+			filtered = append(filtered, match)
+		}
+	}
+	return filtered, err
+}
@@ -0,0 +1,39 @@
+package wrfs_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestJournaled(t *testing.T) {
+	lower := newLowerFS(t)
+	fsys, err := Journaled(lower, "journal")
+	check(t, err)
+	check(t, fsys.Copy("dir", "copy"))
+	checkContents(t, fsys, "copy/sub/file", "lower")
+	check(t, RemoveAll(fsys, "copy/sub"))
+	if _, err := Stat(lower, "journal"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("journal left after completed operations: %v", err)
+	}
+	if err := RemoveAll(fsys, "."); !errors.Is(err, ErrPermission) {
+		t.Errorf("RemoveAll(.): got %v, want ErrPermission", err)
+	}
+
+	// Simulate a crash in the middle of a removal and a copy, with a torn record at the end.
+	check(t, Remove(lower, "dir/sub/file"))
+	check(t, MkdirAll(lower, "partial/sub", 0755))
+	journal := `begin 0 removeall "dir/sub"` + "\n" +
+		`begin 1 copy "dir" "partial"` + "\n" +
+		`begin 2 removeall "dir/file"` + "\n" + "end 2\n" + `begin 3 remo`
+	check(t, WriteFile(lower, "journal", []byte(journal), 0600))
+	fsys, err = Journaled(lower, "journal")
+	check(t, err)
+	for _, name := range []string{"dir/sub", "partial", "journal"} {
+		if _, err := Stat(lower, name); !errors.Is(err, ErrNotExist) {
+			t.Errorf("Stat(%s) after recovery: got %v, want ErrNotExist", name, err)
+		}
+	}
+	checkContents(t, fsys, "dir/file", "lower")
+}
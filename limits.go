@@ -0,0 +1,211 @@
+package wrfs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// Limits configures the limits enforced by WithLimits. A zero value disables the corresponding limit.
+type Limits struct {
+	// MaxFiles is the maximum number of files, directories and links in the file system.
+	// Creating more fails with an error matching syscall.ENOSPC.
+	MaxFiles int
+
+	// MaxDepth is the maximum number of elements in a path, so that a MaxDepth of 1 only allows files
+	// in the root directory. Creating deeper files fails with an error matching syscall.ENAMETOOLONG.
+	MaxDepth int
+
+	// MaxNameLen is the maximum length in bytes of a path element. Creating files with longer names fails
+	// with an error matching syscall.ENAMETOOLONG.
+	MaxNameLen int
+}
+
+// WithLimits returns a file system that enforces limits on the files created in fsys, such as when
+// extracting untrusted archives. The limits are checked by every operation that creates a name: OpenFile
+// with O_CREATE, Mkdir, MkdirAll, Symlink, Link and Rename. Existing files are not affected by MaxDepth
+// and MaxNameLen, but count towards MaxFiles.
+//
+// If MaxFiles is set, the number of files is counted by walking fsys before the first file is created,
+// and then kept up to date by tracking the files created and removed through the returned file system.
+func WithLimits(fsys FS, limits Limits) FS {
+	return &limitFS{fsWrapper: fsWrapper{fsys}, limits: limits}
+}
+
+type limitFS struct {
+	fsWrapper
+	limits Limits
+
+	mu      sync.Mutex
+	files   int
+	counted bool
+}
+
+// checkName checks name against MaxDepth and MaxNameLen, given that it is the root of a tree of the given height.
+func (l *limitFS) checkName(op, name string, height int) error {
+	if name == "." {
+		return nil
+	}
+	elems := strings.Split(name, "/")
+	if l.limits.MaxDepth > 0 && len(elems)+height > l.limits.MaxDepth {
+		return &PathError{Op: op, Path: name, Err: syscall.ENAMETOOLONG}
+	}
+	if l.limits.MaxNameLen > 0 {
+		for _, elem := range elems {
+			if len(elem) > l.limits.MaxNameLen {
+				return &PathError{Op: op, Path: name, Err: syscall.ENAMETOOLONG}
+			}
+		}
+	}
+	return nil
+}
+
+// add adds n to the number of files, failing if that would exceed MaxFiles.
+func (l *limitFS) add(op, name string, n int) error {
+	if l.limits.MaxFiles <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.counted {
+		files := -1 // the root is not counted
+		err := WalkDir(l.fsys, ".", func(name string, d DirEntry, err error) error {
+			if err == nil {
+				files++
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		l.files, l.counted = files, true
+	}
+	if n > 0 && l.files+n > l.limits.MaxFiles {
+		return &PathError{Op: op, Path: name, Err: errno.ENOSPC}
+	}
+	l.files += n
+	return nil
+}
+
+// create checks the limits for creating name, and performs the creation with fn.
+func (l *limitFS) create(op, name string, fn func() error) error {
+	if err := l.checkName(op, name, 0); err != nil {
+		return err
+	}
+	if err := l.add(op, name, 1); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		l.add(op, name, -1)
+		return err
+	}
+	return nil
+}
+
+func (l *limitFS) OpenFile(name string, flag int, perm FileMode) (file File, err error) {
+	if flag&O_CREATE == 0 || exists(l.fsys, name) {
+		return OpenFile(l.fsys, name, flag, perm)
+	}
+	err = l.create("open", name, func() (err error) {
+		file, err = OpenFile(l.fsys, name, flag, perm)
+		return err
+	})
+	return file, err
+}
+
+func (l *limitFS) Mkdir(name string, perm FileMode) error {
+	return l.create("mkdir", name, func() error { return Mkdir(l.fsys, name, perm) })
+}
+
+// MkdirAll creates the missing directories one at a time through Mkdir, so that each is checked and counted.
+func (l *limitFS) MkdirAll(path string, perm FileMode) error {
+	if err := l.checkName("mkdir", path, 0); err != nil {
+		return err
+	}
+	return mkdirAll(l, path, perm)
+}
+
+func (l *limitFS) Symlink(oldname, newname string) error {
+	if err := l.checkName("symlink", newname, 0); err != nil {
+		return &LinkError{Op: "symlink", Old: oldname, New: newname, Err: err.(*PathError).Err}
+	}
+	return l.create("symlink", newname, func() error { return Symlink(l.fsys, oldname, newname) })
+}
+
+func (l *limitFS) Link(oldname, newname string) error {
+	if err := l.checkName("link", newname, 0); err != nil {
+		return &LinkError{Op: "link", Old: oldname, New: newname, Err: err.(*PathError).Err}
+	}
+	return l.create("link", newname, func() error { return Link(l.fsys, oldname, newname) })
+}
+
+func (l *limitFS) Remove(name string) error {
+	// Make sure the files are counted before one is removed.
+	if err := l.add("remove", name, 0); err != nil {
+		return err
+	}
+	if err := Remove(l.fsys, name); err != nil {
+		return err
+	}
+	return l.add("remove", name, -1)
+}
+
+// RemoveAll removes the files one at a time through Remove, so that the count is kept up to date.
+func (l *limitFS) RemoveAll(path string) error {
+	return removeAll(context.Background(), l, path)
+}
+
+func (l *limitFS) Rename(oldpath, newpath string) error {
+	linkErr := func(err error) error {
+		var pe *PathError
+		if errors.As(err, &pe) {
+			err = pe.Err
+		}
+		return &LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	height, err := l.height(oldpath)
+	if err != nil {
+		return linkErr(err)
+	}
+	if err := l.checkName("rename", newpath, height); err != nil {
+		return linkErr(err)
+	}
+	if err := l.add("rename", newpath, 0); err != nil {
+		return linkErr(err)
+	}
+	replaced := false
+	if fi, err := lstatOrStat(l.fsys, newpath); err == nil {
+		ofi, err := lstatOrStat(l.fsys, oldpath)
+		replaced = err == nil && !SameFile(l.fsys, fi, ofi)
+	}
+	if err := Rename(l.fsys, oldpath, newpath); err != nil {
+		return err
+	}
+	if replaced {
+		return l.add("rename", newpath, -1)
+	}
+	return nil
+}
+
+// height returns the number of path elements below name in the deepest file of the tree rooted at name.
+func (l *limitFS) height(name string) (int, error) {
+	if l.limits.MaxDepth <= 0 {
+		return 0, nil
+	}
+	depth := strings.Count(name, "/")
+	height := 0
+	err := WalkDir(l.fsys, name, func(p string, d DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if h := strings.Count(p, "/") - depth; h > height {
+			height = h
+		}
+		return nil
+	})
+	return height, err
+}
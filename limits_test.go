@@ -0,0 +1,34 @@
+package wrfs_test
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/errno"
+)
+
+func TestWithLimits(t *testing.T) {
+	// newLowerFS has 4 files: dir, dir/file, dir/sub and dir/sub/file.
+	fsys := WithLimits(newLowerFS(t), Limits{MaxFiles: 7, MaxDepth: 3, MaxNameLen: 8})
+
+	check(t, MkdirAll(fsys, "a/b/c", 0755))
+	if err := WriteFile(fsys, "a/x", nil, 0644); !errors.Is(err, errno.ENOSPC) {
+		t.Errorf("creating too many files: got %v, want ENOSPC", err)
+	}
+	check(t, WriteFile(fsys, "dir/file", []byte("existing"), 0644))
+	check(t, RemoveAll(fsys, "a/b"))
+	if err := Mkdir(fsys, "a/b/c/d", 0755); !errors.Is(err, syscall.ENAMETOOLONG) {
+		t.Errorf("creating too deep a file: got %v, want ENAMETOOLONG", err)
+	}
+	if err := Mkdir(fsys, "a/verylongname", 0755); !errors.Is(err, syscall.ENAMETOOLONG) {
+		t.Errorf("creating too long a name: got %v, want ENAMETOOLONG", err)
+	}
+	if err := Rename(fsys, "dir", "a/dir"); !errors.Is(err, syscall.ENAMETOOLONG) {
+		t.Errorf("moving a tree too deep: got %v, want ENAMETOOLONG", err)
+	}
+	check(t, WriteFile(fsys, "a/x", nil, 0644))
+	check(t, Rename(fsys, "a/x", "dir/file"))
+	check(t, WriteFile(fsys, "a/y", nil, 0644))
+}
@@ -0,0 +1,139 @@
+package wrfs
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrLocked is returned by TryLock when the file is locked by someone else.
+var ErrLocked = errors.New("file is locked")
+
+// LockFile is a file that supports advisory locking.
+// Locks are associated with the open file, and are released when the file is closed.
+type LockFile interface {
+	File
+
+	// Lock acquires an exclusive lock on the file, blocking until the lock is available.
+	// If the file is already locked through this File, the lock is converted.
+	Lock() error
+
+	// RLock acquires a shared lock on the file, blocking until the lock is available.
+	// If the file is already locked through this File, the lock is converted.
+	RLock() error
+
+	// TryLock attempts to acquire an exclusive lock on the file without blocking,
+	// and reports whether it succeeded.
+	TryLock() (bool, error)
+
+	// Unlock releases the lock held through this File.
+	Unlock() error
+}
+
+// LockFS is a file system that can open files for locking.
+type LockFS interface {
+	FS
+
+	// OpenLock opens the named file such that it can be locked.
+	// If the file does not exist, it is created with mode 0666 (before umask).
+	OpenLock(name string) (LockFile, error)
+}
+
+// OpenLock opens the named file such that it can be locked.
+// If the file does not exist, it is created with mode 0666 (before umask).
+//
+// If fsys implements LockFS, OpenLock calls fsys.OpenLock.
+// Otherwise OpenLock opens the file with OpenFile and checks that it implements LockFile.
+func OpenLock(fsys FS, name string) (LockFile, error) {
+	if fsys, ok := fsys.(LockFS); ok {
+		return fsys.OpenLock(name)
+	}
+	file, err := OpenFile(fsys, name, os.O_RDONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if file, ok := file.(LockFile); ok {
+		return file, nil
+	}
+	file.Close()
+	return nil, &PathError{Op: "lock", Path: name, Err: ErrUnsupported}
+}
+
+// Lock opens the named file and acquires an exclusive lock on it, blocking until the lock is available.
+// Closing the returned file releases the lock.
+func Lock(fsys FS, name string) (LockFile, error) {
+	return lockWith(fsys, name, LockFile.Lock)
+}
+
+// RLock opens the named file and acquires a shared lock on it, blocking until the lock is available.
+// Closing the returned file releases the lock.
+func RLock(fsys FS, name string) (LockFile, error) {
+	return lockWith(fsys, name, LockFile.RLock)
+}
+
+// TryLock opens the named file and attempts to acquire an exclusive lock on it without blocking.
+// If the file is locked by someone else, TryLock returns an error matching ErrLocked.
+// Closing the returned file releases the lock.
+func TryLock(fsys FS, name string) (LockFile, error) {
+	return lockWith(fsys, name, func(file LockFile) error {
+		ok, err := file.TryLock()
+		if err == nil && !ok {
+			err = &PathError{Op: "lock", Path: name, Err: ErrLocked}
+		}
+		return err
+	})
+}
+
+func lockWith(fsys FS, name string, lock func(LockFile) error) (LockFile, error) {
+	file, err := OpenLock(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := lock(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// hostFS implements LockFS, since the files it returns from Open and OpenFile are plain *os.Files.
+func (hostFS) OpenLock(name string) (LockFile, error) {
+	file, err := os.OpenFile(name, os.O_RDONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &lockFile{file}, nil
+}
+
+// lockFile is an *os.File that can be locked.
+type lockFile struct {
+	*os.File
+}
+
+func (f *lockFile) SysFile() *os.File { return f.File }
+
+// lockingFile is a file that forwards its lock methods to the file it reads from, for wrappers that change the
+// contents of the files they open with OpenLock. Only the read methods of the wrapped file are exposed.
+type lockingFile struct {
+	File
+	lock LockFile
+}
+
+func (f *lockingFile) ReadAt(p []byte, off int64) (int, error) {
+	if r, ok := f.File.(io.ReaderAt); ok {
+		return r.ReadAt(p, off)
+	}
+	return 0, fileErr("readat", f.File, ErrUnsupported)
+}
+
+func (f *lockingFile) Seek(offset int64, whence int) (int64, error) {
+	return Seek(f.File, offset, whence)
+}
+
+func (f *lockingFile) Lock() error { return f.lock.Lock() }
+
+func (f *lockingFile) RLock() error { return f.lock.RLock() }
+
+func (f *lockingFile) TryLock() (bool, error) { return f.lock.TryLock() }
+
+func (f *lockingFile) Unlock() error { return f.lock.Unlock() }
@@ -0,0 +1,16 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package wrfs
+
+func (f *lockFile) unsupported() error {
+	return &PathError{Op: "lock", Path: f.Name(), Err: ErrUnsupported}
+}
+
+func (f *lockFile) Lock() error { return f.unsupported() }
+
+func (f *lockFile) RLock() error { return f.unsupported() }
+
+func (f *lockFile) TryLock() (bool, error) { return false, f.unsupported() }
+
+func (f *lockFile) Unlock() error { return f.unsupported() }
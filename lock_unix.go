@@ -0,0 +1,48 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package wrfs
+
+import "syscall"
+
+func (f *lockFile) flock(how int) (err error) {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	cerr := conn.Control(func(fd uintptr) {
+		for {
+			err = syscall.Flock(int(fd), how)
+			if err != syscall.EINTR {
+				return
+			}
+		}
+	})
+	if cerr != nil {
+		return cerr
+	}
+	if err != nil {
+		return &PathError{Op: "flock", Path: f.Name(), Err: err}
+	}
+	return nil
+}
+
+func (f *lockFile) Lock() error {
+	return f.flock(syscall.LOCK_EX)
+}
+
+func (f *lockFile) RLock() error {
+	return f.flock(syscall.LOCK_SH)
+}
+
+func (f *lockFile) TryLock() (bool, error) {
+	err := f.flock(syscall.LOCK_EX | syscall.LOCK_NB)
+	if pe, ok := err.(*PathError); ok && pe.Err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (f *lockFile) Unlock() error {
+	return f.flock(syscall.LOCK_UN)
+}
@@ -0,0 +1,41 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wrfs_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestLock(t *testing.T) {
+	fsys := getFS(t)
+	fileName := "TestLock"
+
+	held, err := Lock(fsys, fileName)
+	if errors.Is(err, ErrUnsupported) {
+		t.Skip(err)
+	}
+	check(t, err)
+	if _, err := TryLock(fsys, fileName); !errors.Is(err, ErrLocked) {
+		t.Errorf("TryLock of locked file: got %v, want ErrLocked", err)
+	}
+	check(t, held.Unlock())
+
+	shared, err := RLock(fsys, fileName)
+	check(t, err)
+	other, err := RLock(fsys, fileName)
+	check(t, err)
+	if ok, err := other.TryLock(); ok || err != nil {
+		t.Errorf("TryLock with shared lock held elsewhere: got %v, %v, want false, nil", ok, err)
+	}
+	check(t, shared.Close())
+	check(t, other.Close())
+	check(t, held.Close())
+
+	file, err := TryLock(fsys, fileName)
+	check(t, err)
+	check(t, file.Close())
+}
@@ -0,0 +1,55 @@
+package wrfs
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+	errorLockViolation      = syscall.Errno(33)
+)
+
+func (f *lockFile) lockFileEx(flags uint32) error {
+	var ol syscall.Overlapped
+	r, _, err := procLockFileEx.Call(f.Fd(), uintptr(flags), 0, ^uintptr(0), ^uintptr(0), uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return &PathError{Op: "lock", Path: f.Name(), Err: err}
+	}
+	return nil
+}
+
+func (f *lockFile) Lock() error {
+	f.Unlock()
+	return f.lockFileEx(lockfileExclusiveLock)
+}
+
+func (f *lockFile) RLock() error {
+	f.Unlock()
+	return f.lockFileEx(0)
+}
+
+func (f *lockFile) TryLock() (bool, error) {
+	f.Unlock()
+	err := f.lockFileEx(lockfileExclusiveLock | lockfileFailImmediately)
+	if pe, ok := err.(*PathError); ok && pe.Err == errorLockViolation {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (f *lockFile) Unlock() error {
+	var ol syscall.Overlapped
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, ^uintptr(0), ^uintptr(0), uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return &PathError{Op: "unlock", Path: f.Name(), Err: err}
+	}
+	return nil
+}
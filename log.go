@@ -0,0 +1,246 @@
+package wrfs
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// A LogOption configures Logged.
+type LogOption func(*logConfig)
+
+type logConfig struct {
+	level    slog.Level
+	errLevel slog.Level
+}
+
+// LogLevel sets the level at which Logged logs successful operations. The default is slog.LevelInfo.
+func LogLevel(level slog.Level) LogOption {
+	return func(c *logConfig) { c.level = level }
+}
+
+// LogErrorLevel sets the level at which Logged logs failed operations. The default is slog.LevelWarn.
+func LogErrorLevel(level slog.Level) LogOption {
+	return func(c *logConfig) { c.errLevel = level }
+}
+
+// Logged returns a file system that logs every operation on fsys to logger, or to slog.Default() if logger is nil.
+// Each record has the message "wrfs" and the attributes op, path, duration and, for failed operations, error.
+// Some operations add further attributes, such as newpath for Rename, and flag and perm for OpenFile.
+//
+// Operations implemented by the wrapped file system through an extension interface are forwarded to it,
+// while the others use the same fallbacks as the package helpers. The context variants of Open, OpenFile,
+// Remove and RemoveAll pass their context to the logger.
+func Logged(fsys FS, logger *slog.Logger, opts ...LogOption) FS {
+	c := logConfig{level: slog.LevelInfo, errLevel: slog.LevelWarn}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &loggedFS{fsWrapper{fsys}, logger, c}
+}
+
+type loggedFS struct {
+	fsWrapper
+	logger *slog.Logger
+	c      logConfig
+}
+
+func (l *loggedFS) log(ctx context.Context, op, name string, start time.Time, err error, attrs ...slog.Attr) {
+	level := l.c.level
+	if err != nil {
+		level = l.c.errLevel
+	}
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+	attrs = append(attrs, slog.String("op", op), slog.String("path", name), slog.Duration("duration", time.Since(start)))
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	l.logger.LogAttrs(ctx, level, "wrfs", attrs...)
+}
+
+// record logs an operation that does not take a context. It is meant to be deferred.
+func (l *loggedFS) record(op, name string, start time.Time, errPtr *error, attrs ...slog.Attr) {
+	l.log(context.Background(), op, name, start, *errPtr, attrs...)
+}
+
+// formatFlag returns a textual representation of OpenFile flags, such as "O_WRONLY|O_CREATE|O_TRUNC".
+func formatFlag(flag int) string {
+	var b strings.Builder
+	switch flag & (O_RDONLY | O_WRONLY | O_RDWR) {
+	case O_WRONLY:
+		b.WriteString("O_WRONLY")
+	case O_RDWR:
+		b.WriteString("O_RDWR")
+	default:
+		b.WriteString("O_RDONLY")
+	}
+	for _, f := range []struct {
+		flag int
+		name string
+	}{{O_APPEND, "O_APPEND"}, {O_CREATE, "O_CREATE"}, {O_EXCL, "O_EXCL"}, {O_SYNC, "O_SYNC"}, {O_TRUNC, "O_TRUNC"}} {
+		if flag&f.flag != 0 {
+			b.WriteString("|" + f.name)
+		}
+	}
+	return b.String()
+}
+
+func openFileAttrs(flag int, perm FileMode) []slog.Attr {
+	return []slog.Attr{slog.String("flag", formatFlag(flag)), slog.String("perm", perm.String())}
+}
+
+func (l *loggedFS) Open(name string) (file File, err error) {
+	defer l.record("open", name, time.Now(), &err)
+	return l.fsys.Open(name)
+}
+
+func (l *loggedFS) OpenContext(ctx context.Context, name string) (file File, err error) {
+	defer func(start time.Time) { l.log(ctx, "open", name, start, err) }(time.Now())
+	return OpenContext(ctx, l.fsys, name)
+}
+
+func (l *loggedFS) Stat(name string) (fi FileInfo, err error) {
+	defer l.record("stat", name, time.Now(), &err)
+	return Stat(l.fsys, name)
+}
+
+func (l *loggedFS) Lstat(name string) (fi FileInfo, err error) {
+	defer l.record("lstat", name, time.Now(), &err)
+	return Lstat(l.fsys, name)
+}
+
+func (l *loggedFS) ReadDir(name string) (entries []DirEntry, err error) {
+	defer l.record("readdir", name, time.Now(), &err)
+	return ReadDir(l.fsys, name)
+}
+
+func (l *loggedFS) ReadFile(name string) (data []byte, err error) {
+	defer l.record("readfile", name, time.Now(), &err)
+	return ReadFile(l.fsys, name)
+}
+
+func (l *loggedFS) Glob(pattern string) (matches []string, err error) {
+	defer l.record("glob", pattern, time.Now(), &err)
+	return Glob(l.fsys, pattern)
+}
+
+func (l *loggedFS) OpenFile(name string, flag int, perm FileMode) (file File, err error) {
+	defer l.record("openfile", name, time.Now(), &err, openFileAttrs(flag, perm)...)
+	return OpenFile(l.fsys, name, flag, perm)
+}
+
+func (l *loggedFS) OpenFileContext(ctx context.Context, name string, flag int, perm FileMode) (file File, err error) {
+	defer func(start time.Time) { l.log(ctx, "openfile", name, start, err, openFileAttrs(flag, perm)...) }(time.Now())
+	return OpenFileContext(ctx, l.fsys, name, flag, perm)
+}
+
+func (l *loggedFS) WriteFile(name string, data []byte, perm FileMode) (err error) {
+	defer l.record("writefile", name, time.Now(), &err, slog.Int("size", len(data)))
+	return WriteFile(l.fsys, name, data, perm)
+}
+
+func (l *loggedFS) Chmod(name string, mode FileMode) (err error) {
+	defer l.record("chmod", name, time.Now(), &err, slog.String("mode", mode.String()))
+	return Chmod(l.fsys, name, mode)
+}
+
+func (l *loggedFS) Chown(name string, uid, gid int) (err error) {
+	defer l.record("chown", name, time.Now(), &err, slog.Int("uid", uid), slog.Int("gid", gid))
+	return Chown(l.fsys, name, uid, gid)
+}
+
+func (l *loggedFS) Lchown(name string, uid, gid int) (err error) {
+	defer l.record("lchown", name, time.Now(), &err, slog.Int("uid", uid), slog.Int("gid", gid))
+	return Lchown(l.fsys, name, uid, gid)
+}
+
+func (l *loggedFS) Chtimes(name string, atime, mtime time.Time) (err error) {
+	defer l.record("chtimes", name, time.Now(), &err)
+	return Chtimes(l.fsys, name, atime, mtime)
+}
+
+func (l *loggedFS) Mkdir(name string, perm FileMode) (err error) {
+	defer l.record("mkdir", name, time.Now(), &err)
+	return Mkdir(l.fsys, name, perm)
+}
+
+func (l *loggedFS) MkdirAll(path string, perm FileMode) (err error) {
+	defer l.record("mkdirall", path, time.Now(), &err)
+	return MkdirAll(l.fsys, path, perm)
+}
+
+func (l *loggedFS) Readlink(name string) (link string, err error) {
+	defer l.record("readlink", name, time.Now(), &err)
+	return Readlink(l.fsys, name)
+}
+
+func (l *loggedFS) Remove(name string) (err error) {
+	defer l.record("remove", name, time.Now(), &err)
+	return Remove(l.fsys, name)
+}
+
+func (l *loggedFS) RemoveContext(ctx context.Context, name string) (err error) {
+	defer func(start time.Time) { l.log(ctx, "remove", name, start, err) }(time.Now())
+	return RemoveContext(ctx, l.fsys, name)
+}
+
+func (l *loggedFS) RemoveAll(path string) (err error) {
+	defer l.record("removeall", path, time.Now(), &err)
+	return RemoveAll(l.fsys, path)
+}
+
+func (l *loggedFS) RemoveAllContext(ctx context.Context, path string) (err error) {
+	defer func(start time.Time) { l.log(ctx, "removeall", path, start, err) }(time.Now())
+	return RemoveAllContext(ctx, l.fsys, path)
+}
+
+func (l *loggedFS) Rename(oldpath, newpath string) (err error) {
+	defer l.record("rename", oldpath, time.Now(), &err, slog.String("newpath", newpath))
+	return Rename(l.fsys, oldpath, newpath)
+}
+
+func (l *loggedFS) Symlink(oldname, newname string) (err error) {
+	defer l.record("symlink", newname, time.Now(), &err, slog.String("target", oldname))
+	return Symlink(l.fsys, oldname, newname)
+}
+
+func (l *loggedFS) Link(oldname, newname string) (err error) {
+	defer l.record("link", oldname, time.Now(), &err, slog.String("newpath", newname))
+	return Link(l.fsys, oldname, newname)
+}
+
+func (l *loggedFS) Sync(name string) (err error) {
+	defer l.record("sync", name, time.Now(), &err)
+	return Sync(l.fsys, name)
+}
+
+func (l *loggedFS) SyncDir(dir string) (err error) {
+	defer l.record("syncdir", dir, time.Now(), &err)
+	return SyncDir(l.fsys, dir)
+}
+
+func (l *loggedFS) Statfs(name string) (info FSInfo, err error) {
+	defer l.record("statfs", name, time.Now(), &err)
+	return Statfs(l.fsys, name)
+}
+
+func (l *loggedFS) OpenLock(name string) (file LockFile, err error) {
+	defer l.record("openlock", name, time.Now(), &err)
+	return OpenLock(l.fsys, name)
+}
+
+func (l *loggedFS) Watch(name string, opts ...WatchOption) (events <-chan Event, stop func(), err error) {
+	defer l.record("watch", name, time.Now(), &err)
+	return Watch(l.fsys, name, opts...)
+}
+
+func (l *loggedFS) Truncate(name string, size int64) (err error) {
+	defer l.record("truncate", name, time.Now(), &err, slog.Int64("size", size))
+	return Truncate(l.fsys, name, size)
+}
@@ -0,0 +1,51 @@
+package wrfs_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestLogged(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	fsys := Logged(newLowerFS(t), logger, LogLevel(slog.LevelDebug), LogErrorLevel(slog.LevelError))
+
+	file, err := OpenFile(fsys, "dir/new", O_WRONLY|O_CREATE|O_EXCL, 0644)
+	check(t, err)
+	check(t, file.Close())
+	if err := Rename(fsys, "missing", "dir/other"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Rename: got %v, want ErrNotExist", err)
+	}
+
+	var records []map[string]interface{}
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var r map[string]interface{}
+		check(t, json.Unmarshal(line, &r))
+		records = append(records, r)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2: %s", len(records), buf.Bytes())
+	}
+	want := []map[string]interface{}{
+		{"level": "DEBUG", "msg": "wrfs", "op": "openfile", "path": "dir/new", "flag": "O_WRONLY|O_CREATE|O_EXCL", "perm": "-rw-r--r--"},
+		{"level": "ERROR", "msg": "wrfs", "op": "rename", "path": "missing", "newpath": "dir/other"},
+	}
+	for i, r := range records {
+		for k, v := range want[i] {
+			if r[k] != v {
+				t.Errorf("record %d: %s = %v, want %v", i, k, r[k], v)
+			}
+		}
+		if _, ok := r["duration"]; !ok {
+			t.Errorf("record %d has no duration", i)
+		}
+		if _, ok := r["error"]; ok != (i == 1) {
+			t.Errorf("record %d: error attribute present = %v, want %v", i, ok, i == 1)
+		}
+	}
+}
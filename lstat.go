@@ -1,5 +1,7 @@
 package wrfs
 
+import "errors"
+
 // LstatFS is a file system that supports the Lstat operation.
 type LstatFS interface {
 	// Lstat returns a FileInfo describing the named file.
@@ -17,3 +19,12 @@ func Lstat(fsys FS, name string) (info FileInfo, err error) {
 	}
 	return nil, &PathError{Op: "lstat", Path: name, Err: ErrUnsupported}
 }
+
+// lstatOrStat returns a FileInfo for name, describing a symbolic link itself if fsys supports Lstat.
+func lstatOrStat(fsys FS, name string) (FileInfo, error) {
+	fi, err := Lstat(fsys, name)
+	if errors.Is(err, ErrUnsupported) {
+		return Stat(fsys, name)
+	}
+	return fi, err
+}
@@ -0,0 +1,288 @@
+package wrfs
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrIntegrity is returned when opening a file whose contents do not match its hash in the manifest,
+// or that is missing from the manifest.
+var ErrIntegrity = errors.New("integrity check failed")
+
+// Verified returns a file system that verifies the files of fsys against the SHA-256 hashes in the named
+// manifest file. Opening a regular file, including through ReadFile, reads it in full and fails with an error
+// matching ErrIntegrity if its contents do not match the manifest, or if it is not listed in the manifest.
+// This guards against files being modified, added or damaged without going through the returned file system,
+// but not against modifications made while a file is open.
+//
+// Files written, truncated, linked, renamed or removed through the returned file system have their entries
+// in the manifest updated, and the manifest is rewritten atomically after each change. The manifest is in
+// the format of sha256sum, and is hidden from ReadDir and Glob. Use WriteManifest to create the manifest
+// of an existing tree.
+func Verified(fsys FS, manifest string) FS {
+	return &manifestFS{fsWrapper: fsWrapper{fsys}, manifest: manifest}
+}
+
+type manifestFS struct {
+	fsWrapper
+	manifest string
+
+	mu   sync.Mutex
+	sums map[string]string // hex-encoded hashes by path, or nil until the manifest has been read
+}
+
+// WriteManifest writes the named manifest file for the regular files in fsys, and the symbolic links to them.
+func WriteManifest(fsys FS, manifest string) error {
+	sums := make(map[string]string)
+	err := WalkDir(fsys, ".", func(name string, d DirEntry, err error) error {
+		if err != nil || d.IsDir() || name == manifest {
+			return err
+		}
+		sum, ok, err := hashFile(fsys, name)
+		if ok {
+			sums[name] = sum
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return writeManifest(fsys, manifest, sums)
+}
+
+// hashFile returns the hex-encoded SHA-256 hash of the named file, and whether it is a regular file.
+func hashFile(fsys FS, name string) (sum string, regular bool, err error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return "", false, err
+	}
+	defer safeClose(file, &err)
+	sum, regular, err = hashOpenFile(file)
+	return sum, regular, err
+}
+
+func hashOpenFile(file File) (string, bool, error) {
+	fi, err := file.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return "", false, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", false, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), true, nil
+}
+
+func writeManifest(fsys FS, manifest string, sums map[string]string) error {
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		buf.WriteString(sums[name] + "  " + name + "\n")
+	}
+	return WriteFileAtomic(fsys, manifest, buf.Bytes(), 0666)
+}
+
+// load reads the manifest if it has not been read yet. A missing manifest is treated as empty.
+// The caller must hold m.mu.
+func (m *manifestFS) load() error {
+	if m.sums != nil {
+		return nil
+	}
+	data, err := ReadFile(m.fsys, m.manifest)
+	if err != nil && !errors.Is(err, ErrNotExist) {
+		return err
+	}
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		sum, name, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok || len(sum) != 2*sha256.Size {
+			return &PathError{Op: "read", Path: m.manifest, Err: ErrIntegrity}
+		}
+		sums[name] = sum
+	}
+	m.sums = sums
+	return nil
+}
+
+// modify applies fn to the entries of the manifest and saves it.
+func (m *manifestFS) modify(fn func(sums map[string]string)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.load(); err != nil {
+		return err
+	}
+	fn(m.sums)
+	return writeManifest(m.fsys, m.manifest, m.sums)
+}
+
+// update records the hash of the named file, or removes its entry if it is not a regular file.
+func (m *manifestFS) update(name string) error {
+	sum, ok, err := hashFile(m.fsys, name)
+	if err != nil {
+		return err
+	}
+	return m.modify(func(sums map[string]string) {
+		if ok {
+			sums[name] = sum
+		} else {
+			delete(sums, name)
+		}
+	})
+}
+
+// hide reports whether name, in the directory of the manifest, is the manifest.
+func (m *manifestFS) hide(name string) bool {
+	return name == path.Base(m.manifest)
+}
+
+func (m *manifestFS) Open(name string) (File, error) {
+	file, err := m.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return m.verify(name, file)
+}
+
+func (m *manifestFS) OpenFile(name string, flag int, perm FileMode) (File, error) {
+	writable := flag&(O_WRONLY|O_RDWR|O_APPEND|O_TRUNC) != 0
+	if writable && name == m.manifest {
+		return nil, &PathError{Op: "open", Path: name, Err: ErrPermission}
+	}
+	file, err := OpenFile(m.fsys, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if !writable {
+		return m.verify(name, file)
+	}
+	return &updateWriter{File: file, name: name, update: m.update}, nil
+}
+
+// verify checks the contents of file against the manifest, and returns it rewound to the beginning.
+func (m *manifestFS) verify(name string, file File) (File, error) {
+	sum, ok, err := hashOpenFile(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if !ok {
+		if name == path.Dir(m.manifest) {
+			return hidingDir{file, m.hide}, nil
+		}
+		return file, nil
+	}
+	m.mu.Lock()
+	err = m.load()
+	want, listed := m.sums[name]
+	m.mu.Unlock()
+	if err == nil && (!listed || sum != want) {
+		err = &PathError{Op: "open", Path: name, Err: ErrIntegrity}
+	}
+	if err == nil {
+		_, err = Seek(file, 0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+func (m *manifestFS) ReadDir(name string) ([]DirEntry, error) {
+	entries, err := ReadDir(m.fsys, name)
+	if name == path.Dir(m.manifest) {
+		entries = filterEntries(entries, m.hide)
+	}
+	return entries, err
+}
+
+func (m *manifestFS) Glob(pattern string) ([]string, error) {
+	matches, err := Glob(m.fsys, pattern)
+	filtered := matches[:0]
+	for _, match := range matches {
+		if match != m.manifest {
+			filtered = append(filtered, match)
+		}
+	}
+	return filtered, err
+}
+
+// forget removes the entries for the tree rooted at name from the manifest.
+func forget(sums map[string]string, name string) {
+	for p := range sums {
+		if p == name || name == "." || strings.HasPrefix(p, name+"/") {
+			delete(sums, p)
+		}
+	}
+}
+
+func (m *manifestFS) Remove(name string) error {
+	if err := Remove(m.fsys, name); err != nil {
+		return err
+	}
+	return m.modify(func(sums map[string]string) { delete(sums, name) })
+}
+
+func (m *manifestFS) RemoveAll(name string) error {
+	if err := RemoveAll(m.fsys, name); err != nil {
+		return err
+	}
+	return m.modify(func(sums map[string]string) { forget(sums, name) })
+}
+
+func (m *manifestFS) Rename(oldpath, newpath string) error {
+	if err := Rename(m.fsys, oldpath, newpath); err != nil {
+		return err
+	}
+	return m.modify(func(sums map[string]string) {
+		moved := make(map[string]string)
+		for p, sum := range sums {
+			if p == oldpath || strings.HasPrefix(p, oldpath+"/") {
+				moved[newpath+strings.TrimPrefix(p, oldpath)] = sum
+			}
+		}
+		forget(sums, oldpath)
+		forget(sums, newpath)
+		for p, sum := range moved {
+			sums[p] = sum
+		}
+	})
+}
+
+func (m *manifestFS) Link(oldname, newname string) error {
+	if err := Link(m.fsys, oldname, newname); err != nil {
+		return err
+	}
+	return m.update(newname)
+}
+
+// Symlink creates a symbolic link, and records the hash of its target if that is a regular file.
+func (m *manifestFS) Symlink(oldname, newname string) error {
+	if err := Symlink(m.fsys, oldname, newname); err != nil {
+		return err
+	}
+	if _, err := Stat(m.fsys, newname); err != nil {
+		return nil // dangling links have nothing to verify
+	}
+	return m.update(newname)
+}
+
+func (m *manifestFS) Truncate(name string, size int64) error {
+	if err := Truncate(m.fsys, name, size); err != nil {
+		return err
+	}
+	return m.update(name)
+}
@@ -0,0 +1,42 @@
+package wrfs_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestVerified(t *testing.T) {
+	lower := newLowerFS(t)
+	check(t, WriteManifest(lower, "SHA256SUMS"))
+	fsys := Verified(lower, "SHA256SUMS")
+
+	checkContents(t, fsys, "dir/file", "lower")
+	check(t, WriteFile(fsys, "dir/new", []byte("new"), 0644))
+	checkContents(t, fsys, "dir/new", "new")
+	check(t, Rename(fsys, "dir/sub", "dir/moved"))
+	checkContents(t, fsys, "dir/moved/file", "lower")
+
+	entries, err := ReadDir(fsys, ".")
+	check(t, err)
+	if len(entries) != 1 || entries[0].Name() != "dir" {
+		t.Errorf("ReadDir(.) = %v, want only dir", entries)
+	}
+
+	check(t, WriteFile(lower, "dir/file", []byte("tampered"), 0644))
+	if _, err := ReadFile(fsys, "dir/file"); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("ReadFile of modified file: got %v, want ErrIntegrity", err)
+	}
+	check(t, WriteFile(lower, "dir/added", []byte("added"), 0644))
+	if _, err := fsys.Open("dir/added"); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("Open of unlisted file: got %v, want ErrIntegrity", err)
+	}
+
+	manifest, err := ReadFile(lower, "SHA256SUMS")
+	check(t, err)
+	if strings.Contains(string(manifest), "dir/sub/") || !strings.Contains(string(manifest), "  dir/new\n") {
+		t.Errorf("manifest not updated:\n%s", manifest)
+	}
+}
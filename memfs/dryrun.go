@@ -0,0 +1,92 @@
+package memfs
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/relab/wrfs"
+)
+
+// A Change is a modification recorded by DryRun.
+type Change struct {
+	// Op is the kind of change: "create" or "write" for files opened for writing, depending on whether
+	// they existed, or the name of the operation, such as "mkdir", "remove", "rename" or "chmod".
+	Op string
+
+	Path    string // the file changed; the old name for rename and link
+	NewPath string // the new name for rename and link, and the link for symlink
+}
+
+// String returns the change in the form "op path" or "op path newpath".
+func (c Change) String() string {
+	if c.NewPath != "" {
+		return c.Op + " " + c.Path + " " + c.NewPath
+	}
+	return c.Op + " " + c.Path
+}
+
+// A ChangeSet records the changes made to a file system returned by DryRun.
+// It is safe for concurrent use.
+type ChangeSet struct {
+	mu      sync.Mutex
+	changes []Change
+}
+
+// Changes returns the changes recorded so far, in the order they were made.
+func (s *ChangeSet) Changes() []Change {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Change(nil), s.changes...)
+}
+
+// String returns the recorded changes, one per line.
+func (s *ChangeSet) String() string {
+	var b strings.Builder
+	for _, c := range s.Changes() {
+		b.WriteString(c.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func (s *ChangeSet) add(c Change) {
+	s.mu.Lock()
+	s.changes = append(s.changes, c)
+	s.mu.Unlock()
+}
+
+// mutatingOps are the operations recorded by DryRun, other than opening files for writing.
+var mutatingOps = map[string]bool{
+	"mkdir": true, "mkdirall": true, "remove": true, "removeall": true, "rename": true,
+	"symlink": true, "link": true, "chmod": true, "chown": true, "lchown": true, "chtimes": true, "truncate": true,
+}
+
+// DryRun returns a file system that simulates modifications of fsys without touching it, and the ChangeSet
+// in which the modifications are recorded. The returned file system is an overlay of an in-memory file
+// system on fsys, so modifications succeed or fail as they would on fsys, and are visible to later reads.
+// Successful modifications are recorded in the ChangeSet; opening a file for writing is recorded as a
+// create or a write, and the writes made to it are not recorded individually.
+func DryRun(fsys wrfs.FS) (wrfs.FS, *ChangeSet) {
+	changes := &ChangeSet{}
+	shadow := wrfs.Overlay(New(), fsys)
+	record := wrfs.InterceptorFunc(func(inv *wrfs.Invocation, next func() error) error {
+		op := inv.Op
+		writable := inv.Flag&(wrfs.O_WRONLY|wrfs.O_RDWR|wrfs.O_APPEND|wrfs.O_CREATE|wrfs.O_TRUNC) != 0
+		switch {
+		case op == "writefile" || op == "openfile" && writable:
+			op = "write"
+			if _, err := wrfs.Stat(shadow, inv.Path); errors.Is(err, wrfs.ErrNotExist) {
+				op = "create"
+			}
+		case !mutatingOps[op]:
+			return next()
+		}
+		if err := next(); err != nil {
+			return err
+		}
+		changes.add(Change{Op: op, Path: inv.Path, NewPath: inv.NewPath})
+		return nil
+	})
+	return wrfs.Wrap(shadow, record), changes
+}
@@ -0,0 +1,1002 @@
+// Package memfs implements a read-write in-memory file system.
+//
+// The file system is made of inode-like nodes, so that hard links share their contents and metadata,
+// and it supports symbolic links, permission bits, ownership and timestamps. It is safe for concurrent
+// use by multiple goroutines. Permission bits are recorded but not enforced.
+package memfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// maxSymlinks is the maximum number of symbolic links followed while resolving a path.
+const maxSymlinks = 40
+
+// FS is an in-memory file system. The zero value is not usable; use New to create an FS.
+type FS struct {
+	mu      sync.RWMutex
+	root    *node
+	nextIno uint64
+
+	lockMu   sync.Mutex // guards the lock state of nodes and files
+	lockCond *sync.Cond // signaled when a lock is released
+}
+
+// New returns an empty file system containing only the root directory.
+func New() *FS {
+	fsys := &FS{}
+	fsys.lockCond = sync.NewCond(&fsys.lockMu)
+	fsys.root = fsys.newNode(wrfs.ModeDir | 0777)
+	return fsys
+}
+
+type node struct {
+	ino     uint64
+	mode    wrfs.FileMode
+	data    []byte           // contents of regular files
+	target  string           // target of symbolic links
+	entries map[string]*node // entries of directories
+	nlink   int
+	uid     int
+	gid     int
+	atime   time.Time
+	mtime   time.Time
+	ctime   time.Time
+	btime   time.Time
+	shared  bool // whether data is shared with a snapshot, and must be copied before it is modified
+	readers int  // number of shared locks; guarded by FS.lockMu
+	writer  bool // whether the node is locked exclusively; guarded by FS.lockMu
+}
+
+// newNode returns a new node with the given mode. The caller must hold fsys.mu for writing.
+func (fsys *FS) newNode(mode wrfs.FileMode) *node {
+	fsys.nextIno++
+	now := time.Now()
+	n := &node{ino: fsys.nextIno, mode: mode, nlink: 1, atime: now, mtime: now, ctime: now, btime: now}
+	if mode.IsDir() {
+		n.entries = make(map[string]*node)
+	}
+	return n
+}
+
+func (n *node) isDir() bool     { return n.mode&wrfs.ModeDir != 0 }
+func (n *node) isSymlink() bool { return n.mode&wrfs.ModeSymlink != 0 }
+
+// own makes sure that the contents of n are not shared with a snapshot, copying them if needed.
+func (n *node) own() {
+	if n.shared {
+		n.data = append([]byte(nil), n.data...)
+		n.shared = false
+	}
+}
+
+// resize sets the size of the contents of n, growing with zeros.
+func (n *node) resize(size int64) {
+	n.own()
+	if size <= int64(len(n.data)) {
+		n.data = n.data[:size]
+		return
+	}
+	if size <= int64(cap(n.data)) {
+		tail := n.data[len(n.data):size]
+		for i := range tail {
+			tail[i] = 0
+		}
+		n.data = n.data[:size]
+		return
+	}
+	data := make([]byte, size, size+size/4)
+	copy(data, n.data)
+	n.data = data
+}
+
+func (n *node) touch() {
+	n.mtime = time.Now()
+	n.ctime = n.mtime
+}
+
+// changed records a change of the metadata of n.
+func (n *node) changed() {
+	n.ctime = time.Now()
+}
+
+// walk returns the node for name, following symbolic links in all but the last element,
+// and in the last element if follow is true. The caller must hold fsys.mu.
+func (fsys *FS) walk(name string, follow bool) (*node, error) {
+	return fsys.walkDepth(name, follow, 0)
+}
+
+func (fsys *FS) walkDepth(name string, follow bool, depth int) (*node, error) {
+	n := fsys.root
+	if name == "." {
+		return n, nil
+	}
+	dirPath := "."
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		if !n.isDir() {
+			return nil, syscall.ENOTDIR
+		}
+		child, ok := n.entries[part]
+		if !ok {
+			return nil, wrfs.ErrNotExist
+		}
+		childPath := path.Join(dirPath, part)
+		if child.isSymlink() && (follow || i < len(parts)-1) {
+			if depth >= maxSymlinks {
+				return nil, errno.ELOOP
+			}
+			childPath = linkTarget(dirPath, child.target)
+			var err error
+			if child, err = fsys.walkDepth(childPath, true, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		n, dirPath = child, childPath
+	}
+	return n, nil
+}
+
+// linkTarget returns the path named by a symbolic link in dir with the given target.
+// Absolute targets are relative to the root, and the root's parent is the root itself.
+func linkTarget(dir, target string) string {
+	if strings.HasPrefix(target, "/") {
+		dir = "."
+	}
+	p := path.Join(dir, target)
+	for p == ".." || strings.HasPrefix(p, "../") {
+		p = strings.TrimPrefix(strings.TrimPrefix(p, ".."), "/")
+	}
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+// lookup is like walk, but validates name and returns errors as *PathErrors.
+func (fsys *FS) lookup(op, name string, follow bool) (*node, error) {
+	if !wrfs.ValidPath(name) {
+		return nil, &wrfs.PathError{Op: op, Path: name, Err: wrfs.ErrInvalid}
+	}
+	n, err := fsys.walk(name, follow)
+	if err != nil {
+		return nil, &wrfs.PathError{Op: op, Path: name, Err: err}
+	}
+	return n, nil
+}
+
+// parent returns the directory containing name and the last element of name.
+// The caller must hold fsys.mu.
+func (fsys *FS) parent(op, name string) (dir *node, base string, err error) {
+	if !wrfs.ValidPath(name) {
+		return nil, "", &wrfs.PathError{Op: op, Path: name, Err: wrfs.ErrInvalid}
+	}
+	if name == "." {
+		return nil, "", &wrfs.PathError{Op: op, Path: name, Err: wrfs.ErrInvalid}
+	}
+	dirName, base := path.Split(name)
+	dirName = strings.TrimSuffix(dirName, "/")
+	if dirName == "" {
+		dirName = "."
+	}
+	dir, err = fsys.walk(dirName, true)
+	if err == nil && !dir.isDir() {
+		err = syscall.ENOTDIR
+	}
+	if err != nil {
+		return nil, "", &wrfs.PathError{Op: op, Path: name, Err: err}
+	}
+	return dir, base, nil
+}
+
+// Open opens the named file for reading.
+func (fsys *FS) Open(name string) (wrfs.File, error) {
+	return fsys.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens the named file with the specified flag (O_RDONLY etc.).
+// If the file does not exist, and the O_CREATE flag is passed, it is created with mode perm.
+func (fsys *FS) OpenFile(name string, flag int, perm wrfs.FileMode) (wrfs.File, error) {
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if flag&os.O_CREATE == 0 && !writable {
+		fsys.mu.RLock()
+		defer fsys.mu.RUnlock()
+		n, err := fsys.lookup("open", name, true)
+		if err != nil {
+			return nil, err
+		}
+		return newFile(fsys, n, name, flag), nil
+	}
+
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	dir, base, err := fsys.parent("open", name)
+	if err != nil {
+		if name == "." && !writable {
+			return newFile(fsys, fsys.root, name, flag), nil
+		}
+		if name == "." {
+			err.(*wrfs.PathError).Err = syscall.EISDIR
+		}
+		return nil, err
+	}
+	n, ok := dir.entries[base]
+	switch {
+	case ok && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrExist}
+	case ok && n.isSymlink():
+		if n, err = fsys.lookup("open", name, true); err != nil {
+			return nil, err
+		}
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrNotExist}
+	case !ok:
+		n = fsys.newNode(perm & wrfs.ModePerm)
+		dir.entries[base] = n
+		dir.touch()
+	}
+	if n.isDir() && writable {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+	if flag&os.O_TRUNC != 0 && writable && len(n.data) > 0 {
+		n.data = nil
+		n.touch()
+	}
+	return newFile(fsys, n, name, flag), nil
+}
+
+// Stat returns a FileInfo describing the named file.
+func (fsys *FS) Stat(name string) (wrfs.FileInfo, error) {
+	fsys.mu.RLock()
+	defer fsys.mu.RUnlock()
+	n, err := fsys.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.stat(n, path.Base(name)), nil
+}
+
+// Lstat returns a FileInfo describing the named file, without following a symbolic link in the last element.
+func (fsys *FS) Lstat(name string) (wrfs.FileInfo, error) {
+	fsys.mu.RLock()
+	defer fsys.mu.RUnlock()
+	n, err := fsys.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.stat(n, path.Base(name)), nil
+}
+
+// StatTimes returns the times of the named file, including the time it was created and the time its contents or
+// metadata were last changed.
+func (fsys *FS) StatTimes(name string) (wrfs.FileTimes, error) {
+	fsys.mu.RLock()
+	defer fsys.mu.RUnlock()
+	n, err := fsys.lookup("stat", name, true)
+	if err != nil {
+		return wrfs.FileTimes{}, err
+	}
+	return wrfs.FileTimes{ModTime: n.mtime, AccessTime: n.atime, ChangeTime: n.ctime, BirthTime: n.btime}, nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by filename.
+func (fsys *FS) ReadDir(name string) ([]wrfs.DirEntry, error) {
+	fsys.mu.RLock()
+	defer fsys.mu.RUnlock()
+	n, err := fsys.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !n.isDir() {
+		return nil, &wrfs.PathError{Op: "readdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	return fsys.readDir(n), nil
+}
+
+// readDir returns the entries of the directory n sorted by filename. The caller must hold fsys.mu.
+func (fsys *FS) readDir(n *node) []wrfs.DirEntry {
+	entries := make([]wrfs.DirEntry, 0, len(n.entries))
+	for name, child := range n.entries {
+		entries = append(entries, dirEntry{fsys.stat(child, name)})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries
+}
+
+// ReadFile reads the named file and returns its contents.
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	fsys.mu.RLock()
+	defer fsys.mu.RUnlock()
+	n, err := fsys.lookup("readfile", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if n.isDir() {
+		return nil, &wrfs.PathError{Op: "read", Path: name, Err: syscall.EISDIR}
+	}
+	return append([]byte(nil), n.data...), nil
+}
+
+// Mkdir creates a new directory with the specified name and permission bits.
+func (fsys *FS) Mkdir(name string, perm wrfs.FileMode) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	if name == "." {
+		return &wrfs.PathError{Op: "mkdir", Path: name, Err: wrfs.ErrExist}
+	}
+	dir, base, err := fsys.parent("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if _, ok := dir.entries[base]; ok {
+		return &wrfs.PathError{Op: "mkdir", Path: name, Err: wrfs.ErrExist}
+	}
+	dir.entries[base] = fsys.newNode(wrfs.ModeDir | perm&wrfs.ModePerm)
+	dir.touch()
+	return nil
+}
+
+// Remove removes the named file or empty directory.
+func (fsys *FS) Remove(name string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	dir, base, err := fsys.parent("remove", name)
+	if err != nil {
+		return err
+	}
+	n, ok := dir.entries[base]
+	if !ok {
+		return &wrfs.PathError{Op: "remove", Path: name, Err: wrfs.ErrNotExist}
+	}
+	if n.isDir() && len(n.entries) > 0 {
+		return &wrfs.PathError{Op: "remove", Path: name, Err: errno.ENOTEMPTY}
+	}
+	delete(dir.entries, base)
+	n.nlink--
+	n.changed()
+	dir.touch()
+	return nil
+}
+
+// RemoveAll removes name and any children it contains.
+// It returns nil if name does not exist.
+func (fsys *FS) RemoveAll(name string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	dir, base, err := fsys.parent("removeall", name)
+	if err != nil {
+		if pe, ok := err.(*wrfs.PathError); ok && pe.Err == wrfs.ErrNotExist {
+			return nil
+		}
+		return err
+	}
+	n, ok := dir.entries[base]
+	if !ok {
+		return nil
+	}
+	delete(dir.entries, base)
+	n.nlink--
+	n.changed()
+	dir.touch()
+	return nil
+}
+
+// Rename renames (moves) oldpath to newpath.
+// If newpath already exists and is not a directory, Rename replaces it.
+// A directory may only replace an empty directory.
+func (fsys *FS) Rename(oldpath, newpath string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	linkErr := func(err error) error {
+		if pe, ok := err.(*wrfs.PathError); ok {
+			err = pe.Err
+		}
+		return &wrfs.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	oldDir, oldBase, err := fsys.parent("rename", oldpath)
+	if err != nil {
+		return linkErr(err)
+	}
+	newDir, newBase, err := fsys.parent("rename", newpath)
+	if err != nil {
+		return linkErr(err)
+	}
+	n, ok := oldDir.entries[oldBase]
+	if !ok {
+		return linkErr(wrfs.ErrNotExist)
+	}
+	existing, ok := newDir.entries[newBase]
+	if ok && existing.isDir() && (existing == n || !n.isDir() || len(existing.entries) > 0 ||
+		strings.HasPrefix(newpath, oldpath+"/")) {
+		// Like rename(2), only replace an empty directory, and only with another directory outside of it.
+		// Like os.Rename, report the other cases as the existing directory.
+		return linkErr(wrfs.ErrExist)
+	}
+	if n.isDir() && strings.HasPrefix(newpath, oldpath+"/") {
+		return linkErr(wrfs.ErrInvalid)
+	}
+	switch {
+	case !ok:
+	case existing == n:
+		return nil
+	case n.isDir() && !existing.isDir():
+		return linkErr(syscall.ENOTDIR)
+	}
+	if ok {
+		existing.nlink--
+		existing.changed()
+	}
+	delete(oldDir.entries, oldBase)
+	newDir.entries[newBase] = n
+	n.changed()
+	oldDir.touch()
+	newDir.touch()
+	return nil
+}
+
+// Symlink creates newname as a symbolic link to oldname.
+func (fsys *FS) Symlink(oldname, newname string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	dir, base, err := fsys.parent("symlink", newname)
+	if err != nil {
+		return &wrfs.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err.(*wrfs.PathError).Err}
+	}
+	if _, ok := dir.entries[base]; ok {
+		return &wrfs.LinkError{Op: "symlink", Old: oldname, New: newname, Err: wrfs.ErrExist}
+	}
+	n := fsys.newNode(wrfs.ModeSymlink | 0777)
+	n.target = oldname
+	dir.entries[base] = n
+	dir.touch()
+	return nil
+}
+
+// Readlink returns the destination of the named symbolic link.
+func (fsys *FS) Readlink(name string) (string, error) {
+	fsys.mu.RLock()
+	defer fsys.mu.RUnlock()
+	n, err := fsys.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if !n.isSymlink() {
+		return "", &wrfs.PathError{Op: "readlink", Path: name, Err: wrfs.ErrInvalid}
+	}
+	return n.target, nil
+}
+
+// Link creates newname as a hard link to the oldname file.
+func (fsys *FS) Link(oldname, newname string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	n, err := fsys.lookup("link", oldname, false)
+	if err != nil {
+		return &wrfs.LinkError{Op: "link", Old: oldname, New: newname, Err: err.(*wrfs.PathError).Err}
+	}
+	if n.isDir() {
+		return &wrfs.LinkError{Op: "link", Old: oldname, New: newname, Err: wrfs.ErrPermission}
+	}
+	dir, base, err := fsys.parent("link", newname)
+	if err != nil {
+		return &wrfs.LinkError{Op: "link", Old: oldname, New: newname, Err: err.(*wrfs.PathError).Err}
+	}
+	if _, ok := dir.entries[base]; ok {
+		return &wrfs.LinkError{Op: "link", Old: oldname, New: newname, Err: wrfs.ErrExist}
+	}
+	dir.entries[base] = n
+	n.nlink++
+	n.changed()
+	dir.touch()
+	return nil
+}
+
+// SameFile reports whether fi1 and fi2 describe the same node of this file system.
+func (fsys *FS) SameFile(fi1, fi2 wrfs.FileInfo) bool {
+	i1, ok1 := fi1.Sys().(*Inode)
+	i2, ok2 := fi2.Sys().(*Inode)
+	return ok1 && ok2 && i1.fsys == fsys && i2.fsys == fsys && i1.Ino == i2.Ino
+}
+
+// modify looks up the named file and calls fn on it while holding the write lock.
+func (fsys *FS) modify(op, name string, follow bool, fn func(n *node) error) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	n, err := fsys.lookup(op, name, follow)
+	if err != nil {
+		return err
+	}
+	if err := fn(n); err != nil {
+		return &wrfs.PathError{Op: op, Path: name, Err: err}
+	}
+	return nil
+}
+
+// Chmod changes the mode of the named file to mode.
+func (fsys *FS) Chmod(name string, mode wrfs.FileMode) error {
+	return fsys.modify("chmod", name, true, func(n *node) error {
+		n.chmod(mode)
+		return nil
+	})
+}
+
+// Chown changes the numeric uid and gid of the named file.
+func (fsys *FS) Chown(name string, uid, gid int) error {
+	return fsys.modify("chown", name, true, func(n *node) error {
+		n.chown(uid, gid)
+		return nil
+	})
+}
+
+// Lchown changes the numeric uid and gid of the named file, without following symbolic links.
+func (fsys *FS) Lchown(name string, uid, gid int) error {
+	return fsys.modify("lchown", name, false, func(n *node) error {
+		n.chown(uid, gid)
+		return nil
+	})
+}
+
+// Chtimes changes the access and modification times of the named file.
+// A zero time.Time value leaves the corresponding file time unchanged.
+func (fsys *FS) Chtimes(name string, atime, mtime time.Time) error {
+	return fsys.modify("chtimes", name, true, func(n *node) error {
+		n.chtimes(atime, mtime)
+		return nil
+	})
+}
+
+// Lchtimes changes the access and modification times of the named file, without following symbolic links.
+// A zero time.Time value leaves the corresponding file time unchanged.
+func (fsys *FS) Lchtimes(name string, atime, mtime time.Time) error {
+	return fsys.modify("lchtimes", name, false, func(n *node) error {
+		n.chtimes(atime, mtime)
+		return nil
+	})
+}
+
+// Truncate changes the size of the named file.
+func (fsys *FS) Truncate(name string, size int64) error {
+	return fsys.modify("truncate", name, true, func(n *node) error {
+		return n.truncate(size)
+	})
+}
+
+func (n *node) chmod(mode wrfs.FileMode) {
+	n.mode = n.mode&wrfs.ModeType | mode&(wrfs.ModePerm|wrfs.ModeSetuid|wrfs.ModeSetgid|wrfs.ModeSticky)
+	n.changed()
+}
+
+func (n *node) chown(uid, gid int) {
+	if uid != -1 {
+		n.uid = uid
+	}
+	if gid != -1 {
+		n.gid = gid
+	}
+	n.changed()
+}
+
+func (n *node) chtimes(atime, mtime time.Time) {
+	if !atime.IsZero() {
+		n.atime = atime
+	}
+	if !mtime.IsZero() {
+		n.mtime = mtime
+	}
+	n.changed()
+}
+
+func (n *node) truncate(size int64) error {
+	if n.isDir() {
+		return syscall.EISDIR
+	}
+	if size < 0 {
+		return wrfs.ErrInvalid
+	}
+	n.resize(size)
+	n.touch()
+	return nil
+}
+
+func (n *node) allocate(off, length int64, mode wrfs.AllocMode) error {
+	if n.isDir() {
+		return syscall.EISDIR
+	}
+	if off < 0 || length <= 0 {
+		return wrfs.ErrInvalid
+	}
+	size, end := int64(len(n.data)), off+length
+	switch {
+	case mode&wrfs.AllocPunchHole != 0:
+		if off < size {
+			n.own()
+			clear(n.data[off:min(end, size)])
+			n.touch()
+		}
+	case mode&wrfs.AllocKeepSize == 0 && end > size:
+		n.resize(end)
+		n.touch()
+	}
+	return nil
+}
+
+// Inode holds the system-specific metadata of a file, and is returned by the Sys method of FileInfos.
+type Inode struct {
+	Ino   uint64
+	Nlink int
+	Uid   int
+	Gid   int
+	Atime time.Time
+
+	fsys *FS
+}
+
+type fileInfo struct {
+	name  string
+	size  int64
+	mode  wrfs.FileMode
+	mtime time.Time
+	inode Inode
+}
+
+// stat returns a FileInfo describing n. The caller must hold fsys.mu.
+func (fsys *FS) stat(n *node, name string) *fileInfo {
+	size := int64(len(n.data))
+	if n.isSymlink() {
+		size = int64(len(n.target))
+	}
+	return &fileInfo{
+		name:  name,
+		size:  size,
+		mode:  n.mode,
+		mtime: n.mtime,
+		inode: Inode{Ino: n.ino, Nlink: n.nlink, Uid: n.uid, Gid: n.gid, Atime: n.atime, fsys: fsys},
+	}
+}
+
+func (fi *fileInfo) Name() string        { return fi.name }
+func (fi *fileInfo) Size() int64         { return fi.size }
+func (fi *fileInfo) Mode() wrfs.FileMode { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time  { return fi.mtime }
+func (fi *fileInfo) IsDir() bool         { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}    { return &fi.inode }
+func (fi *fileInfo) String() string      { return fi.mode.String() + " " + fi.name }
+
+type dirEntry struct {
+	info *fileInfo
+}
+
+func (d dirEntry) Name() string                 { return d.info.name }
+func (d dirEntry) IsDir() bool                  { return d.info.IsDir() }
+func (d dirEntry) Type() wrfs.FileMode          { return d.info.mode.Type() }
+func (d dirEntry) Info() (wrfs.FileInfo, error) { return d.info, nil }
+func (d dirEntry) String() string               { return d.info.String() }
+
+// file is an open file or directory.
+type file struct {
+	fsys    *FS
+	node    *node
+	name    string
+	flag    int
+	off     int64
+	closed  bool
+	entries []wrfs.DirEntry // remaining directory entries; nil until the first call to ReadDir
+	lock    lockMode        // lock held through this file; guarded by FS.lockMu
+}
+
+func newFile(fsys *FS, n *node, name string, flag int) *file {
+	return &file{fsys: fsys, node: n, name: name, flag: flag}
+}
+
+func (f *file) readable() bool {
+	return f.flag&(os.O_WRONLY|os.O_RDWR) != os.O_WRONLY
+}
+
+func (f *file) writable() bool {
+	return f.flag&(os.O_WRONLY|os.O_RDWR) != 0
+}
+
+func (f *file) checkClosed(op string) error {
+	if f.closed {
+		return &wrfs.PathError{Op: op, Path: f.name, Err: wrfs.ErrClosed}
+	}
+	return nil
+}
+
+func (f *file) Stat() (wrfs.FileInfo, error) {
+	if err := f.checkClosed("stat"); err != nil {
+		return nil, err
+	}
+	f.fsys.mu.RLock()
+	defer f.fsys.mu.RUnlock()
+	return f.fsys.stat(f.node, path.Base(f.name)), nil
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	n, err := f.readAt("read", p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &wrfs.PathError{Op: "readat", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	n, err := f.readAt("readat", p, off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *file) readAt(op string, p []byte, off int64) (int, error) {
+	if err := f.checkClosed(op); err != nil {
+		return 0, err
+	}
+	if !f.readable() {
+		return 0, &wrfs.PathError{Op: op, Path: f.name, Err: errno.EBADF}
+	}
+	f.fsys.mu.RLock()
+	defer f.fsys.mu.RUnlock()
+	if f.node.isDir() {
+		return 0, &wrfs.PathError{Op: op, Path: f.name, Err: syscall.EISDIR}
+	}
+	if off >= int64(len(f.node.data)) {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	return copy(p, f.node.data[off:]), nil
+}
+
+func (f *file) Write(p []byte) (int, error) {
+	if err := f.checkClosed("write"); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.fsys.mu.RLock()
+		f.off = int64(len(f.node.data))
+		f.fsys.mu.RUnlock()
+	}
+	n, err := f.writeAt("write", p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *file) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.checkClosed("writeat"); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		return 0, &wrfs.PathError{Op: "writeat", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	if off < 0 {
+		return 0, &wrfs.PathError{Op: "writeat", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	return f.writeAt("writeat", p, off)
+}
+
+func (f *file) writeAt(op string, p []byte, off int64) (int, error) {
+	if !f.writable() {
+		return 0, &wrfs.PathError{Op: op, Path: f.name, Err: errno.EBADF}
+	}
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+	if f.flag&os.O_APPEND != 0 {
+		off = int64(len(f.node.data))
+	}
+	if end := off + int64(len(p)); end > int64(len(f.node.data)) {
+		f.node.resize(end)
+	}
+	f.node.own()
+	copy(f.node.data[off:], p)
+	f.node.touch()
+	return len(p), nil
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	if err := f.checkClosed("seek"); err != nil {
+		return 0, err
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		f.fsys.mu.RLock()
+		offset += int64(len(f.node.data))
+		f.fsys.mu.RUnlock()
+	default:
+		return 0, &wrfs.PathError{Op: "seek", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &wrfs.PathError{Op: "seek", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	f.off = offset
+	f.entries = nil
+	return offset, nil
+}
+
+func (f *file) ReadDir(count int) ([]wrfs.DirEntry, error) {
+	if err := f.checkClosed("readdir"); err != nil {
+		return nil, err
+	}
+	if !f.node.isDir() {
+		return nil, &wrfs.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+	}
+	if f.entries == nil {
+		f.fsys.mu.RLock()
+		f.entries = f.fsys.readDir(f.node)
+		f.fsys.mu.RUnlock()
+	}
+	if count <= 0 {
+		entries := f.entries
+		f.entries = f.entries[len(f.entries):]
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(f.entries) {
+		count = len(f.entries)
+	}
+	entries := f.entries[:count]
+	f.entries = f.entries[count:]
+	return entries, nil
+}
+
+func (f *file) modify(op string, fn func(n *node) error) error {
+	if err := f.checkClosed(op); err != nil {
+		return err
+	}
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+	if err := fn(f.node); err != nil {
+		return &wrfs.PathError{Op: op, Path: f.name, Err: err}
+	}
+	return nil
+}
+
+func (f *file) Truncate(size int64) error {
+	if !f.writable() {
+		return &wrfs.PathError{Op: "truncate", Path: f.name, Err: errno.EBADF}
+	}
+	return f.modify("truncate", func(n *node) error { return n.truncate(size) })
+}
+
+// Allocate extends the file to cover the range unless mode has AllocKeepSize, and zeroes the range if mode has
+// AllocPunchHole. The contents of files are held in memory, so there is no space to reserve otherwise.
+func (f *file) Allocate(off, length int64, mode wrfs.AllocMode) error {
+	if !f.writable() {
+		return &wrfs.PathError{Op: "allocate", Path: f.name, Err: errno.EBADF}
+	}
+	return f.modify("allocate", func(n *node) error { return n.allocate(off, length, mode) })
+}
+
+func (f *file) Chmod(mode wrfs.FileMode) error {
+	return f.modify("chmod", func(n *node) error {
+		n.chmod(mode)
+		return nil
+	})
+}
+
+func (f *file) Chown(uid, gid int) error {
+	return f.modify("chown", func(n *node) error {
+		n.chown(uid, gid)
+		return nil
+	})
+}
+
+func (f *file) Chtimes(atime, mtime time.Time) error {
+	return f.modify("chtimes", func(n *node) error {
+		n.chtimes(atime, mtime)
+		return nil
+	})
+}
+
+// Sync does nothing, since the file system is not backed by stable storage.
+func (f *file) Sync() error {
+	return f.checkClosed("sync")
+}
+
+func (f *file) Close() error {
+	if err := f.checkClosed("close"); err != nil {
+		return err
+	}
+	f.closed = true
+	f.fsys.lockMu.Lock()
+	f.unlock()
+	f.fsys.lockMu.Unlock()
+	return nil
+}
+
+type lockMode int
+
+const (
+	unlocked lockMode = iota
+	sharedLock
+	exclusiveLock
+)
+
+// Lock acquires an exclusive lock on the file, blocking until no other file holds a lock on the same node.
+// Locks are advisory and only exclude other locks in the same FS.
+func (f *file) Lock() error {
+	return f.acquire(exclusiveLock, true)
+}
+
+// RLock acquires a shared lock on the file, blocking until no other file holds an exclusive lock on the same node.
+func (f *file) RLock() error {
+	return f.acquire(sharedLock, true)
+}
+
+// TryLock attempts to acquire an exclusive lock on the file without blocking, and reports whether it succeeded.
+func (f *file) TryLock() (bool, error) {
+	err := f.acquire(exclusiveLock, false)
+	if err == errWouldBlock {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Unlock releases the lock held through the file.
+func (f *file) Unlock() error {
+	if err := f.checkClosed("unlock"); err != nil {
+		return err
+	}
+	f.fsys.lockMu.Lock()
+	defer f.fsys.lockMu.Unlock()
+	f.unlock()
+	return nil
+}
+
+var errWouldBlock = errors.New("lock would block")
+
+func (f *file) acquire(mode lockMode, wait bool) error {
+	if err := f.checkClosed("lock"); err != nil {
+		return err
+	}
+	f.fsys.lockMu.Lock()
+	defer f.fsys.lockMu.Unlock()
+	// Like flock, converting a lock releases it before acquiring the new one.
+	f.unlock()
+	n := f.node
+	for n.writer || (mode == exclusiveLock && n.readers > 0) {
+		if !wait {
+			return errWouldBlock
+		}
+		f.fsys.lockCond.Wait()
+	}
+	if mode == exclusiveLock {
+		n.writer = true
+	} else {
+		n.readers++
+	}
+	f.lock = mode
+	return nil
+}
+
+// unlock releases the lock held through f. The caller must hold f.fsys.lockMu.
+func (f *file) unlock() {
+	switch f.lock {
+	case unlocked:
+		return
+	case sharedLock:
+		f.node.readers--
+	case exclusiveLock:
+		f.node.writer = false
+	}
+	f.lock = unlocked
+	f.fsys.lockCond.Broadcast()
+}
@@ -0,0 +1,257 @@
+package memfs_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+)
+
+func TestFS(t *testing.T) {
+	fsys := memfs.New()
+	check(t, wrfs.MkdirAll(fsys, "a/b", 0755))
+	check(t, wrfs.WriteFile(fsys, "a/b/c.txt", []byte("hello"), 0644))
+	check(t, wrfs.WriteFile(fsys, "d.txt", []byte("world"), 0644))
+	check(t, wrfs.Symlink(fsys, "a/b", "link"))
+
+	if err := fstest.TestFS(fsys, "a/b/c.txt", "d.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenFileFlags(t *testing.T) {
+	fsys := memfs.New()
+
+	_, err := fsys.OpenFile("file", os.O_RDONLY, 0)
+	if !errors.Is(err, wrfs.ErrNotExist) {
+		t.Errorf("open without O_CREATE: got: %v, want: %v", err, wrfs.ErrNotExist)
+	}
+
+	check(t, wrfs.WriteFile(fsys, "file", []byte("hello"), 0644))
+	_, err = fsys.OpenFile("file", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if !errors.Is(err, wrfs.ErrExist) {
+		t.Errorf("open with O_EXCL: got: %v, want: %v", err, wrfs.ErrExist)
+	}
+
+	f, err := fsys.OpenFile("file", os.O_WRONLY|os.O_APPEND, 0)
+	check(t, err)
+	_, err = wrfs.Write(f, []byte(", world"))
+	check(t, err)
+	if _, err := f.Read(make([]byte, 1)); err == nil {
+		t.Error("read from a write-only file succeeded")
+	}
+	check(t, f.Close())
+	checkContents(t, fsys, "file", "hello, world")
+
+	f, err = fsys.OpenFile("file", os.O_RDONLY, 0)
+	check(t, err)
+	if _, err := wrfs.Write(f, []byte("x")); err == nil {
+		t.Error("write to a read-only file succeeded")
+	}
+	check(t, f.Close())
+
+	f, err = fsys.OpenFile("file", os.O_RDWR|os.O_TRUNC, 0)
+	check(t, err)
+	_, err = wrfs.Write(f, []byte("new"))
+	check(t, err)
+	_, err = wrfs.Seek(f, 0, io.SeekStart)
+	check(t, err)
+	data, err := io.ReadAll(f)
+	check(t, err)
+	if string(data) != "new" {
+		t.Errorf("got: %q, want: %q", data, "new")
+	}
+	check(t, f.Close())
+}
+
+func TestRename(t *testing.T) {
+	fsys := memfs.New()
+	check(t, wrfs.MkdirAll(fsys, "dir/sub", 0755))
+	check(t, wrfs.WriteFile(fsys, "dir/sub/file", []byte("data"), 0644))
+	check(t, wrfs.Mkdir(fsys, "full", 0755))
+	check(t, wrfs.WriteFile(fsys, "full/file", nil, 0644))
+
+	if err := fsys.Rename("dir", "dir/sub/x"); err == nil {
+		t.Error("moving a directory into itself succeeded")
+	}
+	if err := fsys.Rename("dir", "full"); err == nil {
+		t.Error("replacing a non-empty directory succeeded")
+	}
+	check(t, wrfs.Mkdir(fsys, "moved", 0755))
+	check(t, fsys.Rename("dir", "moved"))
+	checkContents(t, fsys, "moved/sub/file", "data")
+	if _, err := fsys.Stat("dir"); !errors.Is(err, wrfs.ErrNotExist) {
+		t.Errorf("old name still exists: %v", err)
+	}
+}
+
+func TestLink(t *testing.T) {
+	fsys := memfs.New()
+	check(t, wrfs.WriteFile(fsys, "file", []byte("data"), 0644))
+	check(t, fsys.Link("file", "link"))
+	check(t, wrfs.WriteFile(fsys, "link", []byte("changed"), 0644))
+	checkContents(t, fsys, "file", "changed")
+
+	fi1, err := fsys.Stat("file")
+	check(t, err)
+	fi2, err := fsys.Stat("link")
+	check(t, err)
+	if !fsys.SameFile(fi1, fi2) {
+		t.Error("SameFile returned false for hard links")
+	}
+	if fi1.Sys().(*memfs.Inode).Nlink != 2 {
+		t.Errorf("wrong link count: got: %d, want: %d", fi1.Sys().(*memfs.Inode).Nlink, 2)
+	}
+}
+
+func TestSymlinkLoop(t *testing.T) {
+	fsys := memfs.New()
+	check(t, fsys.Symlink("b", "a"))
+	check(t, fsys.Symlink("a", "b"))
+	if _, err := fsys.Stat("a"); err == nil {
+		t.Error("resolving a symlink loop succeeded")
+	}
+	if _, err := fsys.Lstat("a"); err != nil {
+		t.Errorf("Lstat followed a symlink: %v", err)
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	fsys := memfs.New()
+	f, err := fsys.OpenFile("file", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	check(t, err)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g, err := fsys.OpenFile("file", os.O_WRONLY|os.O_APPEND, 0)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for j := 0; j < 100; j++ {
+				wrfs.Write(g, []byte("x"))
+			}
+			g.Close()
+		}()
+	}
+	wg.Wait()
+	check(t, f.Close())
+	fi, err := fsys.Stat("file")
+	check(t, err)
+	if fi.Size() != 800 {
+		t.Errorf("wrong size: got: %d, want: %d", fi.Size(), 800)
+	}
+}
+
+func checkContents(t *testing.T, fsys wrfs.FS, name, want string) {
+	t.Helper()
+	data, err := wrfs.ReadFile(fsys, name)
+	check(t, err)
+	if string(data) != want {
+		t.Errorf("%s: got: %q, want: %q", name, data, want)
+	}
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	fsys := memfs.New()
+	held, err := wrfs.Lock(fsys, "lock")
+	check(t, err)
+
+	acquired := make(chan struct{})
+	go func() {
+		file, err := wrfs.RLock(fsys, "lock")
+		if err == nil {
+			close(acquired)
+			file.Close()
+		}
+	}()
+	if _, err := wrfs.TryLock(fsys, "lock"); !errors.Is(err, wrfs.ErrLocked) {
+		t.Errorf("TryLock of locked file: got %v, want ErrLocked", err)
+	}
+	select {
+	case <-acquired:
+		t.Fatal("RLock succeeded while the file was locked exclusively")
+	default:
+	}
+	check(t, held.Close())
+	<-acquired
+}
+
+func TestDryRun(t *testing.T) {
+	lower := memfs.New()
+	check(t, wrfs.WriteFile(lower, "old", []byte("old"), 0644))
+	check(t, wrfs.WriteFile(lower, "keep", []byte("keep"), 0644))
+
+	fsys, changes := memfs.DryRun(lower)
+	check(t, wrfs.WriteFile(fsys, "new", []byte("new"), 0644))
+	check(t, wrfs.WriteFile(fsys, "keep", []byte("changed"), 0644))
+	check(t, wrfs.Mkdir(fsys, "dir", 0755))
+	check(t, wrfs.Rename(fsys, "old", "dir/old"))
+	check(t, wrfs.Remove(fsys, "new"))
+	if err := wrfs.Remove(fsys, "missing"); !errors.Is(err, wrfs.ErrNotExist) {
+		t.Errorf("Remove: got %v, want ErrNotExist", err)
+	}
+	if _, err := wrfs.ReadFile(fsys, "keep"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "create new\nwrite keep\nmkdir dir\nrename old dir/old\nremove new\n"
+	if got := changes.String(); got != want {
+		t.Errorf("changes:\n%s\nwant:\n%s", got, want)
+	}
+	if data, err := wrfs.ReadFile(fsys, "dir/old"); err != nil || string(data) != "old" {
+		t.Errorf("dry run: read %q, %v; want %q", data, err, "old")
+	}
+	if err := fstest.TestFS(lower, "old", "keep"); err != nil {
+		t.Errorf("underlying file system was modified: %v", err)
+	}
+	if data, _ := wrfs.ReadFile(lower, "keep"); string(data) != "keep" {
+		t.Errorf("underlying file contains %q, want %q", data, "keep")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	fsys := memfs.New()
+	check(t, wrfs.Mkdir(fsys, "dir", 0755))
+	check(t, wrfs.WriteFile(fsys, "dir/file", []byte("before"), 0644))
+	check(t, wrfs.Link(fsys, "dir/file", "link"))
+
+	snap, err := wrfs.Snapshot(fsys)
+	check(t, err)
+
+	file, err := wrfs.OpenFile(fsys, "dir/file", wrfs.O_WRONLY, 0)
+	check(t, err)
+	_, err = wrfs.Write(file, []byte("AFTER"))
+	check(t, err)
+	check(t, file.Close())
+	check(t, wrfs.Truncate(fsys, "link", 2))
+	check(t, wrfs.Rename(fsys, "dir", "moved"))
+
+	checkContents(t, fsys, "moved/file", "AF")
+	checkContents(t, snap, "dir/file", "before")
+	checkContents(t, snap, "link", "before")
+	fi1, err := wrfs.Stat(snap, "dir/file")
+	check(t, err)
+	fi2, err := wrfs.Stat(snap, "link")
+	check(t, err)
+	if !wrfs.SameFile(snap, fi1, fi2) {
+		t.Error("hard links are not preserved in the snapshot")
+	}
+	if err := wrfs.Remove(snap, "link"); !errors.Is(err, wrfs.ErrPermission) {
+		t.Errorf("Remove from snapshot: got %v, want ErrPermission", err)
+	}
+}
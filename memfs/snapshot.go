@@ -0,0 +1,46 @@
+package memfs
+
+import "github.com/relab/wrfs"
+
+// Snapshot returns a read-only copy of fsys as it is at the time of the call. The copy shares the contents
+// of files with fsys until they are modified, so taking a snapshot only copies the directory structure.
+func (fsys *FS) Snapshot() (wrfs.FS, error) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	snap := New()
+	snap.nextIno = fsys.nextIno
+	snap.root = cloneNode(fsys.root, make(map[*node]*node))
+	return wrfs.ReadOnly(snap), nil
+}
+
+// cloneNode returns a copy of the tree rooted at n, sharing the contents of files. Nodes with several links
+// are copied once, using clones. The caller must hold the lock of the file system of n for writing.
+func cloneNode(n *node, clones map[*node]*node) *node {
+	if c, ok := clones[n]; ok {
+		return c
+	}
+	c := &node{
+		ino:    n.ino,
+		mode:   n.mode,
+		data:   n.data,
+		target: n.target,
+		nlink:  n.nlink,
+		uid:    n.uid,
+		gid:    n.gid,
+		atime:  n.atime,
+		mtime:  n.mtime,
+		ctime:  n.ctime,
+		btime:  n.btime,
+	}
+	if n.data != nil {
+		n.shared, c.shared = true, true
+	}
+	clones[n] = c
+	if n.isDir() {
+		c.entries = make(map[string]*node, len(n.entries))
+		for name, e := range n.entries {
+			c.entries[name] = cloneNode(e, clones)
+		}
+	}
+	return c
+}
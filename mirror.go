@@ -0,0 +1,270 @@
+package wrfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// A MirrorOption configures Mirror.
+type MirrorOption func(*mirrorConfig)
+
+type mirrorConfig struct {
+	delete   bool
+	dryRun   bool
+	checksum bool
+	delta    bool
+	block    int
+	progress func(op, name string)
+}
+
+// MirrorDelete makes Mirror remove the files and directories of dst that do not exist in src.
+func MirrorDelete() MirrorOption {
+	return func(c *mirrorConfig) { c.delete = true }
+}
+
+// MirrorDryRun makes Mirror report the changes it would make to dst without making them.
+func MirrorDryRun() MirrorOption {
+	return func(c *mirrorConfig) { c.dryRun = true }
+}
+
+// MirrorChecksum makes Mirror compare the contents of regular files of the same size to decide whether to update
+// them, instead of their modification times.
+func MirrorChecksum() MirrorOption {
+	return func(c *mirrorConfig) { c.checksum = true }
+}
+
+// MirrorDelta makes Mirror update the changed regular files of dst with DeltaCopy, writing only the blocks of
+// blockSize bytes that differ, instead of rewriting them. A blockSize that is not positive selects
+// DefaultDeltaBlockSize.
+func MirrorDelta(blockSize int) MirrorOption {
+	return func(c *mirrorConfig) { c.delta, c.block = true, blockSize }
+}
+
+// MirrorProgress makes Mirror call fn before each change it makes to dst, with the op "create", "update" or
+// "delete" and the path of the file or directory changed.
+func MirrorProgress(fn func(op, name string)) MirrorOption {
+	return func(c *mirrorConfig) { c.progress = fn }
+}
+
+// A MirrorReport lists the changes made by Mirror.
+type MirrorReport struct {
+	Created []string // the files and directories created in dst
+	Updated []string // the files and directories whose contents or metadata were updated in dst
+	Deleted []string // the files and directories removed from dst, without their contents
+}
+
+// Mirror makes dst match src, like a one-way rsync: it creates the files and directories of src missing from dst,
+// updates the files of dst that differ from those of src, and, with MirrorDelete, removes the files and directories
+// of dst that are not in src. A file that has a different type in dst, such as a directory where src has a
+// regular file, is replaced.
+//
+// Regular files are updated if their sizes or modification times differ, or with MirrorChecksum, if their sizes
+// or contents differ. Their contents, permission bits and modification times are copied, the latter two where dst
+// supports Chmod and Chtimes. Directories have their permission bits copied, and symbolic links are recreated if
+// their targets differ. Other irregular files cause Mirror to fail with an error matching ErrInvalid.
+//
+// Mirror returns the changes made so far along with any error.
+func Mirror(dst, src FS, opts ...MirrorOption) (MirrorReport, error) {
+	m := &mirror{dst: dst, src: src}
+	for _, opt := range opts {
+		opt(&m.mirrorConfig)
+	}
+	err := WalkDir(src, ".", func(name string, d DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return m.mirror(name, fi)
+	})
+	if err == nil && m.delete {
+		err = WalkDir(dst, ".", func(name string, d DirEntry, err error) error {
+			if err != nil || name == "." {
+				return err
+			}
+			if _, err := lstatOrStat(src, name); !errors.Is(err, ErrNotExist) {
+				return err
+			}
+			if err := m.change("delete", name, &m.report.Deleted, func() error { return RemoveAll(dst, name) }); err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return SkipDir
+			}
+			return nil
+		})
+	}
+	return m.report, err
+}
+
+// mirror is the state of Mirror.
+type mirror struct {
+	mirrorConfig
+	dst, src FS
+	report   MirrorReport
+}
+
+// change reports the change of name, and makes it with fn unless on a dry run.
+func (m *mirror) change(op, name string, list *[]string, fn func() error) error {
+	if m.progress != nil {
+		m.progress(op, name)
+	}
+	*list = append(*list, name)
+	if m.dryRun {
+		return nil
+	}
+	return fn()
+}
+
+// mirror makes the named file or directory of dst match that of src, which is described by fi.
+func (m *mirror) mirror(name string, fi FileInfo) error {
+	mode := fi.Mode()
+	if !mode.IsDir() && !mode.IsRegular() && mode&ModeSymlink == 0 {
+		return &PathError{Op: "mirror", Path: name, Err: ErrInvalid}
+	}
+	dfi, err := lstatOrStat(m.dst, name)
+	if errors.Is(err, ErrNotExist) {
+		return m.change("create", name, &m.report.Created, func() error { return m.create(name, fi) })
+	}
+	if err != nil {
+		return err
+	}
+	if dfi.Mode().Type() != mode.Type() {
+		return m.change("update", name, &m.report.Updated, func() error {
+			if err := RemoveAll(m.dst, name); err != nil {
+				return err
+			}
+			return m.create(name, fi)
+		})
+	}
+	switch {
+	case mode&ModeSymlink != 0:
+		target, err := Readlink(m.src, name)
+		if err != nil {
+			return err
+		}
+		if dtarget, err := Readlink(m.dst, name); err != nil || dtarget != target {
+			return m.change("update", name, &m.report.Updated, func() error {
+				if err := Remove(m.dst, name); err != nil {
+					return err
+				}
+				return Symlink(m.dst, target, name)
+			})
+		}
+		return nil
+	case mode.IsRegular():
+		changed, err := m.changed(name, fi, dfi)
+		if err != nil {
+			return err
+		}
+		if changed {
+			return m.change("update", name, &m.report.Updated, func() error { return m.copy(name, fi, true) })
+		}
+	}
+	if dfi.Mode().Perm() != mode.Perm() {
+		return m.change("update", name, &m.report.Updated, func() error { return m.chmod(name, mode) })
+	}
+	return nil
+}
+
+// changed reports whether the contents of the named regular file differ between dst and src.
+func (m *mirror) changed(name string, fi, dfi FileInfo) (bool, error) {
+	if fi.Size() != dfi.Size() {
+		return true, nil
+	}
+	if !m.checksum {
+		return !fi.ModTime().Equal(dfi.ModTime()), nil
+	}
+	return filesDiffer(m.dst, m.src, name)
+}
+
+// create creates name in dst as a copy of src's, which is described by fi.
+func (m *mirror) create(name string, fi FileInfo) error {
+	mode := fi.Mode()
+	switch {
+	case mode.IsDir():
+		if err := Mkdir(m.dst, name, mode.Perm()); err != nil {
+			return err
+		}
+		return m.chmod(name, mode)
+	case mode.IsRegular():
+		return m.copy(name, fi, false)
+	}
+	target, err := Readlink(m.src, name)
+	if err != nil {
+		return err
+	}
+	return Symlink(m.dst, target, name)
+}
+
+// copy copies the named regular file from src to dst, creating it unless update is set, in which case the
+// existing file is overwritten, or updated with DeltaCopy under MirrorDelta.
+func (m *mirror) copy(name string, fi FileInfo, update bool) error {
+	mode := fi.Mode()
+	var err error
+	switch {
+	case update && m.delta:
+		_, err = DeltaCopy(m.dst, m.src, name, m.block)
+	case update:
+		err = copyFile(context.Background(), m.dst, name, m.src, name, O_WRONLY|O_CREATE|O_TRUNC, mode.Perm(), false)
+	default:
+		err = copyFile(context.Background(), m.dst, name, m.src, name, O_WRONLY|O_CREATE|O_EXCL, mode.Perm(), false)
+	}
+	if err != nil {
+		return err
+	}
+	if err := m.chmod(name, mode); err != nil {
+		return err
+	}
+	if err := Chtimes(m.dst, name, time.Time{}, fi.ModTime()); err != nil && !errors.Is(err, ErrUnsupported) {
+		return err
+	}
+	return nil
+}
+
+// chmod sets the permission bits of name in dst, which are also affected by the umask on creation, if supported.
+func (m *mirror) chmod(name string, mode FileMode) error {
+	if err := Chmod(m.dst, name, mode.Perm()); err != nil && !errors.Is(err, ErrUnsupported) {
+		return err
+	}
+	return nil
+}
+
+// filesDiffer reports whether the contents of the named files of both file systems differ.
+func filesDiffer(fsys1, fsys2 FS, name string) (differ bool, err error) {
+	f1, err := fsys1.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer safeClose(f1, &err)
+	f2, err := fsys2.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer safeClose(f2, &err)
+	buf1, buf2 := make([]byte, 32*1024), make([]byte, 32*1024)
+	for {
+		n1, err1 := io.ReadFull(f1, buf1)
+		n2, err2 := io.ReadFull(f2, buf2)
+		if !bytes.Equal(buf1[:n1], buf2[:n2]) {
+			return true, nil
+		}
+		if err1 == io.EOF || err1 == io.ErrUnexpectedEOF {
+			return err2 != io.EOF && err2 != io.ErrUnexpectedEOF, nil
+		}
+		if err1 != nil {
+			return false, err1
+		}
+		if err2 == io.EOF || err2 == io.ErrUnexpectedEOF {
+			return true, nil
+		}
+		if err2 != nil {
+			return false, err2
+		}
+	}
+}
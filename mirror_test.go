@@ -0,0 +1,99 @@
+package wrfs_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+)
+
+func TestMirror(t *testing.T) {
+	src := newLowerFS(t)
+	check(t, Symlink(src, "file", "dir/link"))
+	dst := memfs.New()
+	check(t, WriteFile(dst, "extra", []byte("extra"), 0644))
+	check(t, Mkdir(dst, "dir", 0700))
+	check(t, Mkdir(dst, "dir/file", 0755))
+
+	var ops []string
+	progress := MirrorProgress(func(op, name string) { ops = append(ops, op+" "+name) })
+	want, _ := json.Marshal(MirrorReport{
+		Created: []string{"dir/link", "dir/sub", "dir/sub/file"},
+		Updated: []string{"dir", "dir/file"},
+		Deleted: []string{"extra"},
+	})
+	for _, dryRun := range []bool{true, false} {
+		opts := []MirrorOption{MirrorDelete(), progress}
+		if dryRun {
+			opts = append(opts, MirrorDryRun())
+		}
+		report, err := Mirror(dst, src, opts...)
+		check(t, err)
+		if got, _ := json.Marshal(report); string(got) != string(want) {
+			t.Errorf("Mirror (dry run %v) = %s, want %s", dryRun, got, want)
+		}
+		if _, err := Stat(dst, "extra"); dryRun && err != nil {
+			t.Errorf("Mirror with MirrorDryRun removed extra: %v", err)
+		}
+	}
+	if len(ops) != 12 {
+		t.Errorf("Mirror reported progress %q, want 6 changes twice", ops)
+	}
+	checkContents(t, dst, "dir/file", "lower")
+	checkContents(t, dst, "dir/sub/file", "lower")
+	if target, err := Readlink(dst, "dir/link"); err != nil || target != "file" {
+		t.Errorf("Readlink(dir/link) = %q, %v, want file", target, err)
+	}
+	if _, err := Stat(dst, "extra"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Mirror with MirrorDelete left extra: %v", err)
+	}
+
+	report, err := Mirror(dst, src)
+	check(t, err)
+	if len(report.Created)+len(report.Updated)+len(report.Deleted) != 0 {
+		t.Errorf("Mirror of mirrored tree = %+v, want no changes", report)
+	}
+	mtime := time.Now().Add(-time.Hour)
+	check(t, WriteFile(src, "dir/file", []byte("upper"), 0644))
+	check(t, Chtimes(src, "dir/file", mtime, mtime))
+	check(t, Chtimes(dst, "dir/file", mtime, mtime))
+	if report, err = Mirror(dst, src); err != nil || len(report.Updated) != 0 {
+		t.Errorf("Mirror of file with same size and time = %+v, %v, want no changes", report, err)
+	}
+	report, err = Mirror(dst, src, MirrorChecksum())
+	check(t, err)
+	if len(report.Updated) != 1 || report.Updated[0] != "dir/file" {
+		t.Errorf("Mirror with MirrorChecksum updated %v, want [dir/file]", report.Updated)
+	}
+	checkContents(t, dst, "dir/file", "upper")
+}
+
+func TestMirrorDelta(t *testing.T) {
+	src, dst := newLowerFS(t), memfs.New()
+	check(t, WriteFile(src, "big", []byte("0123456789abcdef"), 0644))
+	_, err := Mirror(dst, src)
+	check(t, err)
+
+	var truncated []string
+	wrapped := Wrap(dst, InterceptorFunc(func(inv *Invocation, next func() error) error {
+		if inv.Op == "openfile" && inv.Flag&O_TRUNC != 0 {
+			truncated = append(truncated, inv.Path)
+		}
+		return next()
+	}))
+	check(t, WriteFile(src, "big", []byte("0123xxxx89abcdef"), 0644))
+	check(t, WriteFile(src, "dir/file", []byte("low"), 0644))
+	report, err := Mirror(wrapped, src, MirrorDelta(4))
+	check(t, err)
+	if len(report.Updated) != 2 {
+		t.Errorf("Mirror with MirrorDelta updated %v, want [big dir/file]", report.Updated)
+	}
+	if len(truncated) != 0 {
+		t.Errorf("Mirror with MirrorDelta opened %v with O_TRUNC", truncated)
+	}
+	checkContents(t, dst, "big", "0123xxxx89abcdef")
+	checkContents(t, dst, "dir/file", "low")
+}
@@ -40,11 +40,15 @@ func MkdirAll(fsys FS, path string, perm FileMode) error {
 		return fsys.MkdirAll(path, perm)
 	}
 
-	fsys, ok := fsys.(MkdirFS)
+	mfs, ok := fsys.(MkdirFS)
 	if !ok {
 		return &PathError{Op: "mkdir", Path: path, Err: ErrUnsupported}
 	}
+	return mkdirAll(mfs, path, perm)
+}
 
+// mkdirAll implements MkdirAll using only the Mkdir method of fsys.
+func mkdirAll(fsys MkdirFS, path string, perm FileMode) error {
 	// Based on os.MkdirAll
 
 	// Fast path: if we can tell whether path is a directory or file, stop with success or error.
@@ -69,7 +73,7 @@ func MkdirAll(fsys FS, path string, perm FileMode) error {
 
 	if j > 1 {
 		// Create parent.
-		err = MkdirAll(fsys, path[:j-1], perm)
+		err = mkdirAll(fsys, path[:j-1], perm)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,51 @@
+package wrfs
+
+// MkfifoFS is a file system with a Mkfifo method.
+type MkfifoFS interface {
+	FS
+
+	// Mkfifo creates a named pipe (FIFO) with the specified name and permission bits.
+	Mkfifo(name string, perm FileMode) error
+}
+
+// MknodFS is a file system with a Mknod method.
+type MknodFS interface {
+	FS
+
+	// Mknod creates a special file with the specified name. The type bits of mode select a named pipe
+	// (ModeNamedPipe), a block device (ModeDevice), a character device (ModeDevice|ModeCharDevice), a
+	// Unix domain socket (ModeSocket) or an empty regular file (no type bits), and its permission bits,
+	// including ModeSetuid, ModeSetgid and ModeSticky, are those of the file. dev is the device number
+	// of device files, as reported by the host in the Rdev field of its stat structure, and is ignored
+	// for other types.
+	Mknod(name string, mode FileMode, dev uint64) error
+}
+
+// Mkfifo creates a named pipe (FIFO) with the specified name and permission bits (before umask).
+//
+// If fsys implements MkfifoFS, Mkfifo calls fsys.Mkfifo. Otherwise, if fsys implements MknodFS,
+// Mkfifo calls fsys.Mknod with ModeNamedPipe.
+func Mkfifo(fsys FS, name string, perm FileMode) error {
+	if fsys, ok := fsys.(MkfifoFS); ok {
+		return fsys.Mkfifo(name, perm)
+	}
+	if fsys, ok := fsys.(MknodFS); ok {
+		return fsys.Mknod(name, ModeNamedPipe|perm.Perm(), 0)
+	}
+	return &PathError{Op: "mkfifo", Path: name, Err: ErrUnsupported}
+}
+
+// Mknod creates a special file with the specified name, of the type and permission bits of mode
+// (before umask), as described by MknodFS. Creating device files usually requires privileges.
+//
+// If fsys implements MknodFS, Mknod calls fsys.Mknod. Otherwise, named pipes are created with
+// fsys.Mkfifo if fsys implements MkfifoFS.
+func Mknod(fsys FS, name string, mode FileMode, dev uint64) error {
+	if fsys, ok := fsys.(MknodFS); ok {
+		return fsys.Mknod(name, mode, dev)
+	}
+	if fsys, ok := fsys.(MkfifoFS); ok && mode.Type() == ModeNamedPipe {
+		return fsys.Mkfifo(name, mode.Perm())
+	}
+	return &PathError{Op: "mknod", Path: name, Err: ErrUnsupported}
+}
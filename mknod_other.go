@@ -0,0 +1,12 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package wrfs
+
+func (hostFS) Mkfifo(name string, perm FileMode) error {
+	return &PathError{Op: "mkfifo", Path: name, Err: ErrUnsupported}
+}
+
+func (hostFS) Mknod(name string, mode FileMode, dev uint64) error {
+	return &PathError{Op: "mknod", Path: name, Err: ErrUnsupported}
+}
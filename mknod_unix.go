@@ -0,0 +1,57 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package wrfs
+
+import "syscall"
+
+func (hostFS) Mkfifo(name string, perm FileMode) error {
+	if err := syscall.Mkfifo(name, syscallMode(perm)); err != nil {
+		return &PathError{Op: "mkfifo", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (hostFS) Mknod(name string, mode FileMode, dev uint64) error {
+	var typ uint32
+	switch mode.Type() {
+	case 0:
+		typ = syscall.S_IFREG
+	case ModeNamedPipe:
+		typ = syscall.S_IFIFO
+	case ModeDevice:
+		typ = syscall.S_IFBLK
+	case ModeDevice | ModeCharDevice:
+		typ = syscall.S_IFCHR
+	case ModeSocket:
+		typ = syscall.S_IFSOCK
+	default:
+		return &PathError{Op: "mknod", Path: name, Err: ErrInvalid}
+	}
+	if err := mknod(syscall.Mknod, name, typ|syscallMode(mode), dev); err != nil {
+		return &PathError{Op: "mknod", Path: name, Err: err}
+	}
+	return nil
+}
+
+// mknod calls the Mknod function of the syscall package, whose device number is an int on most
+// systems but a uint64 on FreeBSD.
+func mknod[Dev int | uint64](fn func(string, uint32, Dev) error, name string, mode uint32, dev uint64) error {
+	return fn(name, mode, Dev(dev))
+}
+
+// syscallMode returns the permission bits of mode, including the setuid, setgid and sticky bits,
+// as used by system calls.
+func syscallMode(mode FileMode) uint32 {
+	m := uint32(mode.Perm())
+	if mode&ModeSetuid != 0 {
+		m |= syscall.S_ISUID
+	}
+	if mode&ModeSetgid != 0 {
+		m |= syscall.S_ISGID
+	}
+	if mode&ModeSticky != 0 {
+		m |= syscall.S_ISVTX
+	}
+	return m
+}
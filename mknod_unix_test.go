@@ -0,0 +1,37 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wrfs_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestMknod(t *testing.T) {
+	fsys := getFS(t)
+	err := Mkfifo(fsys, "fifo", 0600)
+	if errors.Is(err, ErrUnsupported) {
+		t.Skip(err)
+	}
+	check(t, err)
+	check(t, Mknod(fsys, "pipe", ModeNamedPipe|0644, 0))
+	for _, name := range []string{"fifo", "pipe"} {
+		fi, err := Lstat(fsys, name)
+		check(t, err)
+		if fi.Mode().Type() != ModeNamedPipe {
+			t.Errorf("Lstat(%s): mode %v is not a named pipe", name, fi.Mode())
+		}
+	}
+	if err := Mknod(fsys, "dir", ModeDir|0755, 0); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Mknod with ModeDir: got %v, want ErrInvalid", err)
+	}
+	if err := Mkfifo(fsys, "fifo", 0600); !errors.Is(err, ErrExist) {
+		t.Errorf("Mkfifo on existing file: got %v, want ErrExist", err)
+	}
+	if caps := Capabilities(fsys); !caps.Has(CapMkfifo | CapMknod) {
+		t.Errorf("Capabilities(DirFS) = %v, want mkfifo and mknod", caps)
+	}
+}
@@ -0,0 +1,448 @@
+package wrfs
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// A MountFS is a namespace composed of file systems mounted on directories of a root file system,
+// in the style of Plan 9. Every operation is routed to the file system mounted on the longest prefix
+// of its path, or to the root file system if no mount point is a prefix of the path. Create one
+// with NewMountFS. A MountFS is safe for concurrent use, including while mounting and unmounting.
+//
+// Mount points are listed in the directories that contain them, and directories leading to mount
+// points that do not exist in the file system below are presented as empty read-only directories.
+// Mount points cannot be removed or renamed, and renaming or linking files across mount points fails
+// with EXDEV. Symbolic links are resolved within the file system that contains them. The Capabilities
+// of a MountFS are those common to the root and all mounted file systems.
+type MountFS struct {
+	root FS
+
+	mu     sync.RWMutex
+	mounts map[string]FS
+}
+
+// NewMountFS returns a MountFS with the given root file system and nothing mounted.
+func NewMountFS(root FS) *MountFS {
+	return &MountFS{root: root, mounts: make(map[string]FS)}
+}
+
+// Mount mounts fsys on the directory dir of the namespace, hiding the contents of dir. It fails with an error
+// matching ErrExist if something is already mounted on dir.
+func (m *MountFS) Mount(dir string, fsys FS) error {
+	if !ValidPath(dir) || dir == "." {
+		return &PathError{Op: "mount", Path: dir, Err: ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.mounts[dir]; ok {
+		return &PathError{Op: "mount", Path: dir, Err: ErrExist}
+	}
+	m.mounts[dir] = fsys
+	return nil
+}
+
+// Bind makes the directory target of the namespace also appear at dir, like Mount(dir, Sub(m, target)).
+// Later changes below target, including mounts, are visible at dir. The target cannot be in dir.
+func (m *MountFS) Bind(dir, target string) error {
+	if !ValidPath(target) || target == dir || strings.HasPrefix(target, dir+"/") {
+		return &LinkError{Op: "bind", Old: target, New: dir, Err: ErrInvalid}
+	}
+	return m.Mount(dir, &subFS{m, target})
+}
+
+// Unmount removes the file system mounted on dir.
+func (m *MountFS) Unmount(dir string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.mounts[dir]; !ok {
+		return &PathError{Op: "unmount", Path: dir, Err: ErrInvalid}
+	}
+	delete(m.mounts, dir)
+	return nil
+}
+
+// resolve returns the file system that holds name, the mount point of that file system,
+// and the name of the file within it.
+func (m *MountFS) resolve(name string) (fsys FS, mountPoint, rel string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for p := name; p != "."; p = path.Dir(p) {
+		if fsys, ok := m.mounts[p]; ok {
+			return fsys, p, pathRel(p, name)
+		}
+	}
+	return m.root, ".", name
+}
+
+// children returns the names of the mount points in dir, and of the directories in dir that lead to
+// mount points.
+func (m *MountFS) children(dir string) map[string]bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make(map[string]bool)
+	for p := range m.mounts {
+		if dir != "." {
+			if !strings.HasPrefix(p, dir+"/") {
+				continue
+			}
+			p = p[len(dir)+1:]
+		}
+		first, _, _ := strings.Cut(p, "/")
+		names[first] = true
+	}
+	return names
+}
+
+// isMountPoint reports whether something is mounted on name.
+func (m *MountFS) isMountPoint(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.mounts[name]
+	return ok
+}
+
+// fixMountErr reports the names in errors from a file system mounted on mountPoint as names in the namespace.
+func fixMountErr(err error, mountPoint string) error {
+	if mountPoint == "." {
+		return err
+	}
+	var pathErr *PathError
+	var linkErr *LinkError
+	switch {
+	case errors.As(err, &pathErr):
+		pathErr.Path = path.Join(mountPoint, pathErr.Path)
+	case errors.As(err, &linkErr):
+		linkErr.Old = path.Join(mountPoint, linkErr.Old)
+		linkErr.New = path.Join(mountPoint, linkErr.New)
+	}
+	return err
+}
+
+// action performs fn on the file system that holds name.
+func (m *MountFS) action(op, name string, fn func(fsys FS, name string) error) error {
+	if !ValidPath(name) {
+		return &PathError{Op: op, Path: name, Err: ErrInvalid}
+	}
+	fsys, mountPoint, rel := m.resolve(name)
+	return fixMountErr(fn(fsys, rel), mountPoint)
+}
+
+// Capabilities returns the capabilities common to the root and all mounted file systems.
+func (m *MountFS) Capabilities() CapSet {
+	caps := Capabilities(m.root)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, fsys := range m.mounts {
+		caps &= Capabilities(fsys)
+	}
+	return caps
+}
+
+// synthesize returns the information of a directory leading to mount points if name is one and does not
+// exist below, and err otherwise.
+func (m *MountFS) synthesize(name string, err error) (FileInfo, error) {
+	if errors.Is(err, ErrNotExist) && len(m.children(name)) > 0 {
+		return mountDirInfo(path.Base(name)), nil
+	}
+	return nil, err
+}
+
+func (m *MountFS) stat(op, name string, stat func(fsys FS, name string) (FileInfo, error)) (fi FileInfo, err error) {
+	err = m.action(op, name, func(fsys FS, rel string) (err error) {
+		fi, err = stat(fsys, rel)
+		return err
+	})
+	if err != nil {
+		return m.synthesize(name, err)
+	}
+	if rel := path.Base(name); m.isMountPoint(name) && fi.Name() != rel {
+		fi = &namedInfo{fi, rel}
+	}
+	return fi, nil
+}
+
+func (m *MountFS) Stat(name string) (FileInfo, error) {
+	return m.stat("stat", name, Stat)
+}
+
+func (m *MountFS) Lstat(name string) (FileInfo, error) {
+	return m.stat("lstat", name, Lstat)
+}
+
+// ReadDir returns the entries of the named directory, including the mount points in it, sorted by filename.
+func (m *MountFS) ReadDir(name string) ([]DirEntry, error) {
+	var entries []DirEntry
+	err := m.action("readdir", name, func(fsys FS, rel string) (err error) {
+		entries, err = ReadDir(fsys, rel)
+		return err
+	})
+	if _, err := m.synthesize(name, err); err != nil {
+		return nil, err
+	}
+	children := m.children(name)
+	if len(children) == 0 {
+		return entries, nil
+	}
+	merged := make(map[string]DirEntry)
+	for _, entry := range entries {
+		merged[entry.Name()] = entry
+	}
+	for child := range children {
+		fi, err := m.Lstat(path.Join(name, child))
+		if err != nil {
+			return nil, err
+		}
+		merged[child] = fs.FileInfoToDirEntry(fi)
+	}
+	return sortedEntries(merged), nil
+}
+
+func (m *MountFS) Open(name string) (File, error) {
+	var file File
+	err := m.action("open", name, func(fsys FS, rel string) (err error) {
+		file, err = fsys.Open(rel)
+		return err
+	})
+	if err != nil {
+		fi, err := m.synthesize(name, err)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := m.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &mountDir{overlayDir{nil, entries}, fi}, nil
+	}
+	if m.isMountPoint(name) {
+		file = &namedFile{FileWrapper{file}, path.Base(name)}
+	}
+	if len(m.children(name)) == 0 {
+		return file, nil
+	}
+	entries, err := m.ReadDir(name)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &overlayDir{File: file, entries: entries}, nil
+}
+
+func (m *MountFS) OpenFile(name string, flag int, perm FileMode) (file File, err error) {
+	if flag&(O_WRONLY|O_RDWR|O_APPEND|O_CREATE|O_TRUNC) == 0 {
+		return m.Open(name)
+	}
+	err = m.action("open", name, func(fsys FS, rel string) (err error) {
+		file, err = OpenFile(fsys, rel, flag, perm)
+		return err
+	})
+	return file, err
+}
+
+func (m *MountFS) Readlink(name string) (target string, err error) {
+	err = m.action("readlink", name, func(fsys FS, rel string) (err error) {
+		target, err = Readlink(fsys, rel)
+		return err
+	})
+	return target, err
+}
+
+func (m *MountFS) Chmod(name string, mode FileMode) error {
+	return m.action("chmod", name, func(fsys FS, rel string) error { return Chmod(fsys, rel, mode) })
+}
+
+func (m *MountFS) Chown(name string, uid, gid int) error {
+	return m.action("chown", name, func(fsys FS, rel string) error { return Chown(fsys, rel, uid, gid) })
+}
+
+func (m *MountFS) Lchown(name string, uid, gid int) error {
+	return m.action("lchown", name, func(fsys FS, rel string) error { return Lchown(fsys, rel, uid, gid) })
+}
+
+func (m *MountFS) Chtimes(name string, atime, mtime time.Time) error {
+	return m.action("chtimes", name, func(fsys FS, rel string) error { return Chtimes(fsys, rel, atime, mtime) })
+}
+
+func (m *MountFS) Lchtimes(name string, atime, mtime time.Time) error {
+	return m.action("lchtimes", name, func(fsys FS, rel string) error { return Lchtimes(fsys, rel, atime, mtime) })
+}
+
+func (m *MountFS) Mkdir(name string, perm FileMode) error {
+	if m.isMountPoint(name) {
+		return &PathError{Op: "mkdir", Path: name, Err: ErrExist}
+	}
+	return m.action("mkdir", name, func(fsys FS, rel string) error { return Mkdir(fsys, rel, perm) })
+}
+
+func (m *MountFS) Truncate(name string, size int64) error {
+	return m.action("truncate", name, func(fsys FS, rel string) error { return Truncate(fsys, rel, size) })
+}
+
+func (m *MountFS) Sync(name string) error {
+	return m.action("sync", name, Sync)
+}
+
+func (m *MountFS) SyncDir(dir string) error {
+	return m.action("sync", dir, SyncDir)
+}
+
+func (m *MountFS) Statfs(name string) (info FSInfo, err error) {
+	err = m.action("statfs", name, func(fsys FS, rel string) (err error) {
+		info, err = Statfs(fsys, rel)
+		return err
+	})
+	return info, err
+}
+
+func (m *MountFS) OpenLock(name string) (file LockFile, err error) {
+	err = m.action("lock", name, func(fsys FS, rel string) (err error) {
+		file, err = OpenLock(fsys, rel)
+		return err
+	})
+	return file, err
+}
+
+func (m *MountFS) Watch(name string, opts ...WatchOption) (events <-chan Event, stop func(), err error) {
+	err = m.action("watch", name, func(fsys FS, rel string) (err error) {
+		events, stop, err = Watch(fsys, rel, opts...)
+		return err
+	})
+	return events, stop, err
+}
+
+func (m *MountFS) Remove(name string) error {
+	if m.isMountPoint(name) {
+		return &PathError{Op: "remove", Path: name, Err: syscall.EBUSY}
+	}
+	return m.action("remove", name, Remove)
+}
+
+// RemoveAll removes the tree rooted at name from the file system that holds it. Mount points in the tree
+// stay mounted.
+func (m *MountFS) RemoveAll(name string) error {
+	if m.isMountPoint(name) {
+		return &PathError{Op: "removeall", Path: name, Err: syscall.EBUSY}
+	}
+	return m.action("removeall", name, RemoveAll)
+}
+
+// resolvePair resolves two names that must be in the same file system.
+func (m *MountFS) resolvePair(op, oldname, newname string) (fsys FS, mountPoint, oldRel, newRel string, err error) {
+	if !ValidPath(oldname) || !ValidPath(newname) {
+		return nil, "", "", "", &LinkError{Op: op, Old: oldname, New: newname, Err: ErrInvalid}
+	}
+	if m.isMountPoint(oldname) || m.isMountPoint(newname) {
+		return nil, "", "", "", &LinkError{Op: op, Old: oldname, New: newname, Err: syscall.EBUSY}
+	}
+	fsys, mountPoint, oldRel = m.resolve(oldname)
+	_, newMountPoint, newRel := m.resolve(newname)
+	if mountPoint != newMountPoint {
+		return nil, "", "", "", &LinkError{Op: op, Old: oldname, New: newname, Err: errno.EXDEV}
+	}
+	return fsys, mountPoint, oldRel, newRel, nil
+}
+
+func (m *MountFS) Rename(oldpath, newpath string) error {
+	fsys, mountPoint, oldRel, newRel, err := m.resolvePair("rename", oldpath, newpath)
+	if err != nil {
+		return err
+	}
+	return fixMountErr(Rename(fsys, oldRel, newRel), mountPoint)
+}
+
+func (m *MountFS) Link(oldname, newname string) error {
+	fsys, mountPoint, oldRel, newRel, err := m.resolvePair("link", oldname, newname)
+	if err != nil {
+		return err
+	}
+	return fixMountErr(Link(fsys, oldRel, newRel), mountPoint)
+}
+
+func (m *MountFS) Mkfifo(name string, perm FileMode) error {
+	return m.action("mkfifo", name, func(fsys FS, rel string) error { return Mkfifo(fsys, rel, perm) })
+}
+
+func (m *MountFS) Mknod(name string, mode FileMode, dev uint64) error {
+	return m.action("mknod", name, func(fsys FS, rel string) error { return Mknod(fsys, rel, mode, dev) })
+}
+
+// Symlink creates newname as a symbolic link to oldname, which is resolved within the file system that holds
+// newname.
+func (m *MountFS) Symlink(oldname, newname string) error {
+	return m.action("symlink", newname, func(fsys FS, rel string) error { return Symlink(fsys, oldname, rel) })
+}
+
+func (m *MountFS) SameFile(fi1, fi2 FileInfo) bool {
+	if SameFile(m.root, fi1, fi2) {
+		return true
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, fsys := range m.mounts {
+		if SameFile(fsys, fi1, fi2) {
+			return true
+		}
+	}
+	return false
+}
+
+// namedInfo is a FileInfo with a different name, for the roots of mounted file systems.
+type namedInfo struct {
+	FileInfo
+	name string
+}
+
+func (fi *namedInfo) Name() string { return fi.name }
+
+// namedFile is an open file with a different name, such as the root directory of a mounted file system.
+type namedFile struct {
+	FileWrapper
+	name string
+}
+
+func (d *namedFile) Stat() (FileInfo, error) {
+	fi, err := d.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &namedInfo{fi, d.name}, nil
+}
+
+func (d *namedFile) ReadDir(n int) ([]DirEntry, error) {
+	if dir, ok := d.File.(ReadDirFile); ok {
+		return dir.ReadDir(n)
+	}
+	return nil, &PathError{Op: "readdir", Path: d.name, Err: syscall.ENOTDIR}
+}
+
+// mountDirInfo describes a directory leading to mount points that does not exist below them.
+type mountDirInfo string
+
+func (fi mountDirInfo) Name() string       { return string(fi) }
+func (fi mountDirInfo) Size() int64        { return 0 }
+func (fi mountDirInfo) Mode() FileMode     { return ModeDir | 0555 }
+func (fi mountDirInfo) ModTime() time.Time { return time.Time{} }
+func (fi mountDirInfo) IsDir() bool        { return true }
+func (fi mountDirInfo) Sys() any           { return nil }
+
+// mountDir is an open directory leading to mount points that does not exist below them.
+type mountDir struct {
+	overlayDir
+	info FileInfo
+}
+
+func (d *mountDir) Stat() (FileInfo, error) { return d.info, nil }
+
+func (d *mountDir) Read([]byte) (int, error) {
+	return 0, &PathError{Op: "read", Path: d.info.Name(), Err: syscall.EISDIR}
+}
+
+func (d *mountDir) Close() error { return nil }
@@ -0,0 +1,58 @@
+package wrfs_test
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/errno"
+	"github.com/relab/wrfs/memfs"
+)
+
+func TestMountFS(t *testing.T) {
+	root, logs := newLowerFS(t), memfs.New()
+	check(t, WriteFile(logs, "app.log", []byte("log"), 0644))
+	fsys := NewMountFS(root)
+	check(t, fsys.Mount("var/logs", logs))
+	check(t, fsys.Bind("cfg", "dir/sub"))
+	if err := fsys.Bind("dir", "dir/sub"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Bind into itself: got %v, want ErrInvalid", err)
+	}
+
+	checkContents(t, fsys, "var/logs/app.log", "log")
+	checkContents(t, fsys, "cfg/file", "lower")
+	check(t, WriteFile(fsys, "var/logs/new.log", []byte("new"), 0644))
+	checkContents(t, logs, "new.log", "new")
+	check(t, WriteFile(fsys, "cfg/new", []byte("bound"), 0644))
+	checkContents(t, root, "dir/sub/new", "bound")
+
+	entries, err := ReadDir(fsys, ".")
+	check(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if strings.Join(names, " ") != "cfg dir var" {
+		t.Errorf("ReadDir(.) = %v, want cfg, dir and var", names)
+	}
+	if err := fstest.TestFS(fsys, "var/logs/app.log", "cfg/file", "dir/file"); err != nil {
+		t.Error(err)
+	}
+
+	if err := Rename(fsys, "var/logs/app.log", "dir/app.log"); !errors.Is(err, errno.EXDEV) {
+		t.Errorf("Rename across mounts: got %v, want EXDEV", err)
+	}
+	if err := Remove(fsys, "cfg"); !errors.Is(err, syscall.EBUSY) {
+		t.Errorf("Remove of mount point: got %v, want EBUSY", err)
+	}
+	if _, err := Stat(fsys, "var/logs/missing"); err == nil || !strings.Contains(err.Error(), "var/logs/missing") {
+		t.Errorf("Stat(var/logs/missing): got %v, want error naming the full path", err)
+	}
+	check(t, fsys.Unmount("var/logs"))
+	if _, err := Stat(fsys, "var"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat(var) after Unmount: got %v, want ErrNotExist", err)
+	}
+}
@@ -0,0 +1,83 @@
+package wrfs
+
+import (
+	"errors"
+	"syscall"
+	"time"
+
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// Move renames (moves) oldpath to newpath like Rename, but if fsys does not support Rename,
+// Move copies oldpath to newpath and then removes oldpath. Directories are copied recursively,
+// and symbolic links are recreated. As with Rename, a file replaces an existing file at newpath,
+// and a directory may only replace an empty directory.
+//
+// Unlike Rename, the fallback is not atomic: if it fails, oldpath and a partial copy at newpath
+// may both exist.
+func Move(fsys FS, oldpath, newpath string) error {
+	err := Rename(fsys, oldpath, newpath)
+	if !errors.Is(err, ErrUnsupported) {
+		return err
+	}
+
+	linkErr := func(err error) error {
+		return &LinkError{Op: "move", Old: oldpath, New: newpath, Err: err}
+	}
+	fi, err := lstatOrStat(fsys, oldpath)
+	if err != nil {
+		return err
+	}
+	if oldpath == newpath {
+		return nil
+	}
+	if newFi, err := lstatOrStat(fsys, newpath); err == nil {
+		switch {
+		case newFi.IsDir() && !fi.IsDir():
+			return linkErr(syscall.EISDIR)
+		case !newFi.IsDir() && fi.IsDir():
+			return linkErr(syscall.ENOTDIR)
+		case newFi.IsDir():
+			entries, err := ReadDir(fsys, newpath)
+			if err != nil {
+				return err
+			}
+			if len(entries) > 0 {
+				return linkErr(errno.ENOTEMPTY)
+			}
+		default:
+			// Replace the file rather than copying over it, which would write through a symbolic link.
+			if err := Remove(fsys, newpath); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch mode := fi.Mode(); {
+	case mode.IsDir():
+		dst, err := Sub(fsys, newpath)
+		if err != nil {
+			return err
+		}
+		if err := CopyFS(dst, fsys, oldpath, CopySymlinks(), CopyTimes()); err != nil {
+			return err
+		}
+	case mode&ModeSymlink != 0:
+		link, err := Readlink(fsys, oldpath)
+		if err != nil {
+			return err
+		}
+		if err := Symlink(fsys, link, newpath); err != nil {
+			return err
+		}
+	default:
+		if err := CopyFile(fsys, newpath, fsys, oldpath, CopySparse()); err != nil {
+			return err
+		}
+		err := Chtimes(fsys, newpath, time.Time{}, fi.ModTime())
+		if err != nil && !errors.Is(err, ErrUnsupported) {
+			return err
+		}
+	}
+	return RemoveAll(fsys, oldpath)
+}
@@ -0,0 +1,39 @@
+package wrfs_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+)
+
+// noRename hides the Rename method of a memfs.FS.
+type noRename struct {
+	*memfs.FS
+	Rename struct{}
+}
+
+func TestMove(t *testing.T) {
+	fsys := noRename{FS: newLowerFS(t).(*memfs.FS)}
+	if _, ok := FS(fsys).(RenameFS); ok {
+		t.Fatal("noRename implements RenameFS")
+	}
+	check(t, Move(fsys, "dir/file", "moved"))
+	checkContents(t, fsys, "moved", "lower")
+
+	check(t, Move(fsys, "dir", "newdir"))
+	checkContents(t, fsys, "newdir/sub/file", "lower")
+	if _, err := Stat(fsys, "dir"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("source directory still exists: %v", err)
+	}
+
+	check(t, WriteFile(fsys, "new", []byte("new"), 0644))
+	check(t, Symlink(fsys, "newdir/sub/file", "link"))
+	check(t, Move(fsys, "new", "link"))
+	checkContents(t, fsys, "link", "new")
+	checkContents(t, fsys, "newdir/sub/file", "lower")
+	if fi, err := Lstat(fsys, "link"); err != nil || !fi.Mode().IsRegular() {
+		t.Errorf("Lstat(link) = %v, %v, want a regular file", fi, err)
+	}
+}
@@ -1,12 +1,13 @@
 package wrfs
 
 import (
+	"errors"
 	"io"
 	"os"
 )
 
-// WriteFile is a file that can be written to.
-type WriteFile interface {
+// WriterFile is a file that can be written to.
+type WriterFile interface {
 	File
 	io.Writer
 }
@@ -18,7 +19,7 @@ func Write(file File, p []byte) (n int, err error) {
 	if file, ok := file.(io.Writer); ok {
 		return file.Write(p)
 	}
-	return 0, ErrUnsupported
+	return 0, fileErr("write", file, ErrUnsupported)
 }
 
 // Seek sets the offset for the next Read or Write on file to offset,
@@ -29,9 +30,97 @@ func Seek(file File, offset int64, whence int) (int64, error) {
 	if file, ok := file.(io.Seeker); ok {
 		return file.Seek(offset, whence)
 	}
-	return 0, ErrUnsupported
+	return 0, fileErr("seek", file, ErrUnsupported)
 }
 
+// WriterAtFile is a file that can be written to at any offset.
+type WriterAtFile interface {
+	File
+	io.WriterAt
+}
+
+// ReadAt reads len(p) bytes from file starting at byte offset off, as io.ReaderAt does.
+//
+// If file does not implement io.ReaderAt, or its ReadAt fails with an error matching ErrUnsupported, as that of
+// a FileWrapper around a file without one does, ReadAt seeks to off, reads, and seeks back to the previous offset,
+// so it must then not be used concurrently with other operations on the offset of the file.
+func ReadAt(file File, p []byte, off int64) (n int, err error) {
+	if r, ok := file.(io.ReaderAt); ok {
+		if n, err := r.ReadAt(p, off); !errors.Is(err, ErrUnsupported) {
+			return n, err
+		}
+	}
+	err = atOffset(file, "readat", off, func() (err error) {
+		n, err = io.ReadFull(file, p)
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return err
+	})
+	return n, err
+}
+
+// WriteAt writes len(p) bytes from p to file starting at byte offset off, as io.WriterAt does.
+//
+// If file does not implement io.WriterAt, or its WriteAt fails with an error matching ErrUnsupported, WriteAt
+// seeks to off, writes, and seeks back to the previous offset, so it must then not be used concurrently with other
+// operations on the offset of the file, and writes to the end of a file opened with O_APPEND regardless of off.
+func WriteAt(file File, p []byte, off int64) (n int, err error) {
+	if w, ok := file.(io.WriterAt); ok {
+		if n, err := w.WriteAt(p, off); !errors.Is(err, ErrUnsupported) {
+			return n, err
+		}
+	}
+	err = atOffset(file, "writeat", off, func() (err error) {
+		n, err = Write(file, p)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+		return err
+	})
+	return n, err
+}
+
+// atOffset calls fn with the offset of file set to off, and restores the offset afterwards.
+func atOffset(file File, op string, off int64, fn func() error) error {
+	if off < 0 {
+		return fileErr(op, file, ErrInvalid)
+	}
+	s, ok := file.(io.Seeker)
+	if !ok {
+		return fileErr(op, file, ErrUnsupported)
+	}
+	pos, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Seek(off, io.SeekStart); err != nil {
+		return err
+	}
+	err = fn()
+	if _, serr := s.Seek(pos, io.SeekStart); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// Flags to OpenFile. They have the values of the corresponding flags of package os, so they can be passed
+// to os.OpenFile unchanged. File systems implementing OpenFileFS must honor the access mode, O_APPEND,
+// O_CREATE, O_EXCL and O_TRUNC, and return an error matching ErrInvalid or ErrUnsupported for
+// combinations they cannot honor. O_SYNC may be ignored by file systems that are not backed by stable storage.
+const (
+	// Exactly one of O_RDONLY, O_WRONLY, or O_RDWR must be specified.
+	O_RDONLY int = os.O_RDONLY // open the file read-only.
+	O_WRONLY int = os.O_WRONLY // open the file write-only.
+	O_RDWR   int = os.O_RDWR   // open the file read-write.
+	// The remaining values may be or'ed in to control behavior.
+	O_APPEND int = os.O_APPEND // append data to the file when writing.
+	O_CREATE int = os.O_CREATE // create a new file if none exists.
+	O_EXCL   int = os.O_EXCL   // used with O_CREATE, file must not exist.
+	O_SYNC   int = os.O_SYNC   // open for synchronous I/O.
+	O_TRUNC  int = os.O_TRUNC  // truncate regular writable file when opened.
+)
+
 // OpenFileFS is a file system that supports the OpenFile function.
 type OpenFileFS interface {
 	FS
@@ -59,10 +148,10 @@ func OpenFile(fsys FS, name string, flag int, perm FileMode) (File, error) {
 // it is truncated. If the file does not exist, it is created with mode 0666
 // (before umask). If successful, methods on the returned File can
 // be used for I/O; the associated file descriptor has mode O_RDWR.
-func Create(fsys FS, name string) (WriteFile, error) {
+func Create(fsys FS, name string) (WriterFile, error) {
 	file, err := OpenFile(fsys, name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return nil, err
 	}
-	return file.(WriteFile), err
+	return file.(WriterFile), err
 }
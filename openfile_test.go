@@ -0,0 +1,53 @@
+package wrfs_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+)
+
+func TestReadAtWriteAt(t *testing.T) {
+	fsys := memfs.New()
+	check(t, WriteFile(fsys, "file", []byte("hello, world"), 0644))
+	f, err := OpenFile(fsys, "file", O_RDWR, 0)
+	check(t, err)
+	defer f.Close()
+	// Hide ReadAt and WriteAt, so that they are emulated with Seek.
+	file := struct {
+		File
+		io.Seeker
+		io.Writer
+	}{f, f.(io.Seeker), f.(io.Writer)}
+	_, err = Seek(file, 2, io.SeekStart)
+	check(t, err)
+
+	if n, err := WriteAt(file, []byte("there"), 7); err != nil || n != 5 {
+		t.Errorf("WriteAt: got %d, %v", n, err)
+	}
+	p := make([]byte, 8)
+	if n, err := ReadAt(file, p, 7); err != io.EOF || string(p[:n]) != "there" {
+		t.Errorf("ReadAt at the end: got %q, %v, want %q, EOF", p[:n], err, "there")
+	}
+	if pos, err := Seek(file, 0, io.SeekCurrent); err != nil || pos != 2 {
+		t.Errorf("offset after ReadAt and WriteAt: got %d, %v, want 2", pos, err)
+	}
+	if _, err := ReadAt(struct{ File }{f}, p, 0); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("ReadAt of a file without Seek: got %v, want ErrUnsupported", err)
+	}
+
+	// FileWrapper has ReadAt even if the file it wraps has not, so its ErrUnsupported must also be emulated.
+	wrapped := FileWrapper{file}
+	if n, err := WriteAt(wrapped, []byte("HE"), 0); err != nil || n != 2 {
+		t.Errorf("WriteAt of a wrapped file: got %d, %v", n, err)
+	}
+	if n, err := ReadAt(wrapped, p[:4], 1); err != nil || string(p[:n]) != "Ello" {
+		t.Errorf("ReadAt of a wrapped file: got %q, %v, want %q", p[:n], err, "Ello")
+	}
+	if pos, err := Seek(wrapped, 0, io.SeekCurrent); err != nil || pos != 2 {
+		t.Errorf("offset after ReadAt and WriteAt of a wrapped file: got %d, %v, want 2", pos, err)
+	}
+	checkContents(t, fsys, "file", "HEllo, there")
+}
@@ -0,0 +1,30 @@
+package wrfs
+
+import "os"
+
+// SysFile is a file that may be backed by a file of the host operating system.
+type SysFile interface {
+	File
+
+	// SysFile returns the file of the operating system that the file is backed by, or nil if it is not.
+	// The returned file belongs to the file, so it must not be closed, and must not be used after the file is closed.
+	SysFile() *os.File
+}
+
+// OSFile returns the file of the operating system that file is backed by, such as for using its descriptor with
+// sendfile(2) or flock(2), or for passing it to a child process in os/exec.Cmd.ExtraFiles. It reports false if
+// file is not backed by one.
+//
+// The files that a file system from DirFS opens are *os.Files. If file is not one, OSFile calls its SysFile method
+// if it implements SysFile, which wrappers that leave the contents of the file they wrap alone implement.
+// The returned file must not be closed, and must not be used after file is closed.
+func OSFile(file File) (*os.File, bool) {
+	switch file := file.(type) {
+	case *os.File:
+		return file, true
+	case SysFile:
+		f := file.SysFile()
+		return f, f != nil
+	}
+	return nil, false
+}
@@ -0,0 +1,32 @@
+package wrfs_test
+
+import (
+	"testing"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+)
+
+func TestOSFile(t *testing.T) {
+	fsys := DirFS(t.TempDir())
+	check(t, WriteFile(fsys, "file", []byte("hello"), 0644))
+	file, err := Rewrite(fsys, RewriteRule{From: "current", To: "file"}).Open("current")
+	check(t, err)
+	defer file.Close()
+	f, ok := OSFile(file)
+	if !ok {
+		t.Fatal("OSFile of a renamed file of DirFS reported false")
+	}
+	if fi, err := f.Stat(); err != nil || fi.Size() != 5 {
+		t.Errorf("Stat of the *os.File: got %v, %v", fi, err)
+	}
+
+	mem := memfs.New()
+	check(t, WriteFile(mem, "file", nil, 0644))
+	file, err = mem.Open("file")
+	check(t, err)
+	defer file.Close()
+	if _, ok := OSFile(FileWrapper{file}); ok {
+		t.Error("OSFile of a memfs file reported true")
+	}
+}
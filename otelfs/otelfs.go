@@ -0,0 +1,366 @@
+// Package otelfs traces the operations on a wrfs file system with OpenTelemetry.
+//
+// Every file system operation, and every operation on the files it opens, is recorded as a span with the
+// path of the file as an attribute, and reads and writes record the number of bytes transferred. Spans are
+// started from the context given to the context-aware operations, such as wrfs.OpenContext and
+// wrfs.RemoveAllContext, so that file access is traced as part of the surrounding request; other
+// operations start new root spans. Operations on a file opened with a context use that context.
+//
+// The package is a separate module, so that the wrfs module does not depend on OpenTelemetry.
+package otelfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/relab/wrfs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies this package as the instrumentation library of its spans.
+const instrumentationName = "github.com/relab/wrfs/otelfs"
+
+// Attribute keys recorded on spans.
+const (
+	PathKey    = attribute.Key("file.path")     // path of the file operated on
+	NewPathKey = attribute.Key("wrfs.new_path") // second path of Rename, Link and Symlink
+	BytesKey   = attribute.Key("wrfs.bytes")    // number of bytes read or written
+	FlagKey    = attribute.Key("wrfs.flag")     // flags given to OpenFile
+)
+
+// An Option configures New.
+type Option func(*config)
+
+type config struct {
+	provider trace.TracerProvider
+}
+
+// WithTracerProvider sets the TracerProvider used to create the tracer.
+// By default, the global provider returned by otel.GetTracerProvider is used.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) { c.provider = provider }
+}
+
+// New returns a file system that traces the operations on fsys.
+func New(fsys wrfs.FS, opts ...Option) wrfs.FS {
+	c := config{provider: otel.GetTracerProvider()}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return &tracedFS{fsys: fsys, tracer: c.provider.Tracer(instrumentationName)}
+}
+
+type tracedFS struct {
+	fsys   wrfs.FS
+	tracer trace.Tracer
+}
+
+func (t *tracedFS) start(ctx context.Context, op, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, PathKey.String(name))
+	return t.tracer.Start(ctx, "wrfs."+op, trace.WithAttributes(attrs...))
+}
+
+// end ends span, recording the error pointed to by errPtr. It is meant to be deferred.
+func end(span trace.Span, errPtr *error) {
+	if err := *errPtr; err != nil && !errors.Is(err, io.EOF) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t *tracedFS) file(ctx context.Context, name string, file wrfs.File, err error) (wrfs.File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &tracedFile{file: file, name: name, ctx: ctx, fs: t}, nil
+}
+
+func (t *tracedFS) Open(name string) (wrfs.File, error) {
+	return t.OpenContext(context.Background(), name)
+}
+
+func (t *tracedFS) OpenContext(ctx context.Context, name string) (file wrfs.File, err error) {
+	_, span := t.start(ctx, "Open", name)
+	defer end(span, &err)
+	file, err = wrfs.OpenContext(ctx, t.fsys, name)
+	return t.file(ctx, name, file, err)
+}
+
+func (t *tracedFS) OpenFile(name string, flag int, perm wrfs.FileMode) (wrfs.File, error) {
+	return t.OpenFileContext(context.Background(), name, flag, perm)
+}
+
+func (t *tracedFS) OpenFileContext(ctx context.Context, name string, flag int, perm wrfs.FileMode) (file wrfs.File, err error) {
+	_, span := t.start(ctx, "OpenFile", name, FlagKey.Int(flag))
+	defer end(span, &err)
+	file, err = wrfs.OpenFileContext(ctx, t.fsys, name, flag, perm)
+	return t.file(ctx, name, file, err)
+}
+
+func (t *tracedFS) Stat(name string) (fi wrfs.FileInfo, err error) {
+	_, span := t.start(context.Background(), "Stat", name)
+	defer end(span, &err)
+	return wrfs.Stat(t.fsys, name)
+}
+
+func (t *tracedFS) Lstat(name string) (fi wrfs.FileInfo, err error) {
+	_, span := t.start(context.Background(), "Lstat", name)
+	defer end(span, &err)
+	return wrfs.Lstat(t.fsys, name)
+}
+
+func (t *tracedFS) ReadDir(name string) (entries []wrfs.DirEntry, err error) {
+	_, span := t.start(context.Background(), "ReadDir", name)
+	defer end(span, &err)
+	return wrfs.ReadDir(t.fsys, name)
+}
+
+func (t *tracedFS) ReadFile(name string) (data []byte, err error) {
+	_, span := t.start(context.Background(), "ReadFile", name)
+	defer end(span, &err)
+	data, err = wrfs.ReadFile(t.fsys, name)
+	span.SetAttributes(BytesKey.Int(len(data)))
+	return data, err
+}
+
+func (t *tracedFS) WriteFile(name string, data []byte, perm wrfs.FileMode) (err error) {
+	_, span := t.start(context.Background(), "WriteFile", name, BytesKey.Int(len(data)))
+	defer end(span, &err)
+	return wrfs.WriteFile(t.fsys, name, data, perm)
+}
+
+func (t *tracedFS) Chmod(name string, mode wrfs.FileMode) (err error) {
+	_, span := t.start(context.Background(), "Chmod", name)
+	defer end(span, &err)
+	return wrfs.Chmod(t.fsys, name, mode)
+}
+
+func (t *tracedFS) Chown(name string, uid, gid int) (err error) {
+	_, span := t.start(context.Background(), "Chown", name)
+	defer end(span, &err)
+	return wrfs.Chown(t.fsys, name, uid, gid)
+}
+
+func (t *tracedFS) Lchown(name string, uid, gid int) (err error) {
+	_, span := t.start(context.Background(), "Lchown", name)
+	defer end(span, &err)
+	return wrfs.Lchown(t.fsys, name, uid, gid)
+}
+
+func (t *tracedFS) Chtimes(name string, atime, mtime time.Time) (err error) {
+	_, span := t.start(context.Background(), "Chtimes", name)
+	defer end(span, &err)
+	return wrfs.Chtimes(t.fsys, name, atime, mtime)
+}
+
+func (t *tracedFS) Mkdir(name string, perm wrfs.FileMode) (err error) {
+	_, span := t.start(context.Background(), "Mkdir", name)
+	defer end(span, &err)
+	return wrfs.Mkdir(t.fsys, name, perm)
+}
+
+func (t *tracedFS) MkdirAll(path string, perm wrfs.FileMode) (err error) {
+	_, span := t.start(context.Background(), "MkdirAll", path)
+	defer end(span, &err)
+	return wrfs.MkdirAll(t.fsys, path, perm)
+}
+
+func (t *tracedFS) Readlink(name string) (link string, err error) {
+	_, span := t.start(context.Background(), "Readlink", name)
+	defer end(span, &err)
+	return wrfs.Readlink(t.fsys, name)
+}
+
+func (t *tracedFS) Remove(name string) error {
+	return t.RemoveContext(context.Background(), name)
+}
+
+func (t *tracedFS) RemoveContext(ctx context.Context, name string) (err error) {
+	ctx, span := t.start(ctx, "Remove", name)
+	defer end(span, &err)
+	return wrfs.RemoveContext(ctx, t.fsys, name)
+}
+
+func (t *tracedFS) RemoveAll(path string) error {
+	return t.RemoveAllContext(context.Background(), path)
+}
+
+func (t *tracedFS) RemoveAllContext(ctx context.Context, path string) (err error) {
+	ctx, span := t.start(ctx, "RemoveAll", path)
+	defer end(span, &err)
+	return wrfs.RemoveAllContext(ctx, t.fsys, path)
+}
+
+func (t *tracedFS) Rename(oldpath, newpath string) (err error) {
+	_, span := t.start(context.Background(), "Rename", oldpath, NewPathKey.String(newpath))
+	defer end(span, &err)
+	return wrfs.Rename(t.fsys, oldpath, newpath)
+}
+
+func (t *tracedFS) Symlink(oldname, newname string) (err error) {
+	_, span := t.start(context.Background(), "Symlink", oldname, NewPathKey.String(newname))
+	defer end(span, &err)
+	return wrfs.Symlink(t.fsys, oldname, newname)
+}
+
+func (t *tracedFS) Link(oldname, newname string) (err error) {
+	_, span := t.start(context.Background(), "Link", oldname, NewPathKey.String(newname))
+	defer end(span, &err)
+	return wrfs.Link(t.fsys, oldname, newname)
+}
+
+func (t *tracedFS) SameFile(fi1, fi2 wrfs.FileInfo) bool {
+	return wrfs.SameFile(t.fsys, fi1, fi2)
+}
+
+func (t *tracedFS) Sync(name string) (err error) {
+	_, span := t.start(context.Background(), "Sync", name)
+	defer end(span, &err)
+	return wrfs.Sync(t.fsys, name)
+}
+
+func (t *tracedFS) SyncDir(dir string) (err error) {
+	_, span := t.start(context.Background(), "SyncDir", dir)
+	defer end(span, &err)
+	return wrfs.SyncDir(t.fsys, dir)
+}
+
+func (t *tracedFS) Statfs(name string) (info wrfs.FSInfo, err error) {
+	_, span := t.start(context.Background(), "Statfs", name)
+	defer end(span, &err)
+	return wrfs.Statfs(t.fsys, name)
+}
+
+func (t *tracedFS) Truncate(name string, size int64) (err error) {
+	_, span := t.start(context.Background(), "Truncate", name)
+	defer end(span, &err)
+	return wrfs.Truncate(t.fsys, name, size)
+}
+
+func (t *tracedFS) Capabilities() wrfs.CapSet {
+	return wrfs.Capabilities(t.fsys)
+}
+
+// tracedFile is a file opened through a tracedFS. Its operations are traced as children of the context it
+// was opened with. It forwards the optional file interfaces of the wrfs package to the underlying file,
+// returning ErrUnsupported if the underlying file does not implement them.
+type tracedFile struct {
+	file wrfs.File
+	name string
+	ctx  context.Context
+	fs   *tracedFS
+}
+
+func (f *tracedFile) start(op string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := f.fs.start(f.ctx, "File."+op, f.name, attrs...)
+	return span
+}
+
+func (f *tracedFile) unsupported(op string) error {
+	return &wrfs.PathError{Op: op, Path: f.name, Err: wrfs.ErrUnsupported}
+}
+
+func (f *tracedFile) Stat() (wrfs.FileInfo, error) { return f.file.Stat() }
+
+func (f *tracedFile) Close() (err error) {
+	defer end(f.start("Close"), &err)
+	return f.file.Close()
+}
+
+func (f *tracedFile) Read(p []byte) (n int, err error) {
+	span := f.start("Read")
+	defer end(span, &err)
+	n, err = f.file.Read(p)
+	span.SetAttributes(BytesKey.Int(n))
+	return n, err
+}
+
+func (f *tracedFile) ReadAt(p []byte, off int64) (n int, err error) {
+	span := f.start("ReadAt")
+	defer end(span, &err)
+	r, ok := f.file.(io.ReaderAt)
+	if !ok {
+		return 0, f.unsupported("readat")
+	}
+	n, err = r.ReadAt(p, off)
+	span.SetAttributes(BytesKey.Int(n))
+	return n, err
+}
+
+func (f *tracedFile) Write(p []byte) (n int, err error) {
+	span := f.start("Write")
+	defer end(span, &err)
+	n, err = wrfs.Write(f.file, p)
+	span.SetAttributes(BytesKey.Int(n))
+	return n, err
+}
+
+func (f *tracedFile) WriteAt(p []byte, off int64) (n int, err error) {
+	span := f.start("WriteAt")
+	defer end(span, &err)
+	w, ok := f.file.(io.WriterAt)
+	if !ok {
+		return 0, f.unsupported("writeat")
+	}
+	n, err = w.WriteAt(p, off)
+	span.SetAttributes(BytesKey.Int(n))
+	return n, err
+}
+
+func (f *tracedFile) Seek(offset int64, whence int) (int64, error) {
+	return wrfs.Seek(f.file, offset, whence)
+}
+
+func (f *tracedFile) ReadDir(n int) (entries []wrfs.DirEntry, err error) {
+	defer end(f.start("ReadDir"), &err)
+	if dir, ok := f.file.(wrfs.ReadDirFile); ok {
+		return dir.ReadDir(n)
+	}
+	return nil, f.unsupported("readdir")
+}
+
+func (f *tracedFile) Chmod(mode wrfs.FileMode) (err error) {
+	defer end(f.start("Chmod"), &err)
+	if file, ok := f.file.(wrfs.ChmodFile); ok {
+		return file.Chmod(mode)
+	}
+	return f.unsupported("chmod")
+}
+
+func (f *tracedFile) Chown(uid, gid int) (err error) {
+	defer end(f.start("Chown"), &err)
+	if file, ok := f.file.(wrfs.ChownFile); ok {
+		return file.Chown(uid, gid)
+	}
+	return f.unsupported("chown")
+}
+
+func (f *tracedFile) Chtimes(atime, mtime time.Time) (err error) {
+	defer end(f.start("Chtimes"), &err)
+	if file, ok := f.file.(wrfs.ChtimesFile); ok {
+		return file.Chtimes(atime, mtime)
+	}
+	return f.unsupported("chtimes")
+}
+
+func (f *tracedFile) Truncate(size int64) (err error) {
+	defer end(f.start("Truncate"), &err)
+	if file, ok := f.file.(wrfs.TruncateFile); ok {
+		return file.Truncate(size)
+	}
+	return f.unsupported("truncate")
+}
+
+func (f *tracedFile) Sync() (err error) {
+	defer end(f.start("Sync"), &err)
+	if file, ok := f.file.(wrfs.SyncFile); ok {
+		return file.Sync()
+	}
+	return f.unsupported("sync")
+}
@@ -0,0 +1,90 @@
+package otelfs_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+	"github.com/relab/wrfs/otelfs"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	fsys := otelfs.New(memfs.New(), otelfs.WithTracerProvider(provider))
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	file, err := wrfs.OpenFileContext(ctx, fsys, "file", wrfs.O_WRONLY|wrfs.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrfs.Write(file, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrfs.Stat(fsys, "missing"); !errors.Is(err, wrfs.ErrNotExist) {
+		t.Errorf("Stat: got %v, want ErrNotExist", err)
+	}
+	if data, err := io.ReadAll(mustOpen(t, fsys, "file")); err != nil || string(data) != "hello" {
+		t.Errorf("read %q, %v; want %q", data, err, "hello")
+	}
+	parent.End()
+
+	type span struct {
+		name   string
+		parent bool // whether the span is a child of the request
+		bytes  int64
+		failed bool
+	}
+	var got []span
+	for _, s := range recorder.Ended() {
+		if s.Name() == "request" {
+			continue
+		}
+		sp := span{name: s.Name(), parent: s.Parent().SpanID() == parent.SpanContext().SpanID(), failed: s.Status().Code == codes.Error}
+		for _, attr := range s.Attributes() {
+			if attr.Key == otelfs.BytesKey {
+				sp.bytes = attr.Value.AsInt64()
+			}
+			if attr.Key == otelfs.PathKey && attr.Value.AsString() == "" {
+				t.Errorf("%s has an empty path", s.Name())
+			}
+		}
+		got = append(got, sp)
+	}
+	want := []span{
+		{name: "wrfs.OpenFile", parent: true},
+		{name: "wrfs.File.Write", parent: true, bytes: 5},
+		{name: "wrfs.File.Close", parent: true},
+		{name: "wrfs.Stat", failed: true},
+		{name: "wrfs.Open"},
+		{name: "wrfs.File.Read", bytes: 5},
+		{name: "wrfs.File.Read"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got spans %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("span %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func mustOpen(t *testing.T, fsys wrfs.FS, name string) wrfs.File {
+	t.Helper()
+	file, err := fsys.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return file
+}
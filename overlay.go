@@ -0,0 +1,567 @@
+package wrfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// Whiteout markers used by Overlay, following the conventions of OCI image layers.
+const (
+	// WhiteoutPrefix is the prefix of the marker file that hides the lower layer's file of the same name.
+	WhiteoutPrefix = ".wh."
+	// WhiteoutOpaque is the name of the marker file that hides the lower layer's contents of a directory.
+	WhiteoutOpaque = ".wh..wh..opq"
+)
+
+// Overlay returns a file system that presents the union of upper and lower, similar to Linux overlayfs.
+// Files in upper take precedence over files of the same name in lower, and directories that exist in
+// both layers are merged.
+//
+// All modifications are made in upper, and lower is never modified. Before a file from lower is
+// modified, it is copied up into upper along with its parent directories. Removing a file that
+// exists in lower records a whiteout in upper: an empty marker file named by prefixing the file's
+// name with WhiteoutPrefix. A directory that replaces a removed directory is marked opaque with a
+// WhiteoutOpaque marker, hiding the lower directory's contents. Marker files are hidden from the
+// overlay's directory listings.
+//
+// Symbolic links are resolved within a single layer, so a link in upper that points to a file that
+// only exists in lower cannot be followed.
+func Overlay(upper, lower FS) FS {
+	return &overlayFS{upper: upper, lower: lower}
+}
+
+type overlayFS struct {
+	upper FS
+	lower FS
+}
+
+func whiteoutName(name string) string {
+	dir, base := path.Split(name)
+	return dir + WhiteoutPrefix + base
+}
+
+func opaqueName(dir string) string {
+	return path.Join(dir, WhiteoutOpaque)
+}
+
+func exists(fsys FS, name string) bool {
+	_, err := lstatOrStat(fsys, name)
+	return err == nil
+}
+
+// lowerVisible reports whether lower's file of the given name is not hidden by a whiteout or opaque directory.
+func (o *overlayFS) lowerVisible(name string) bool {
+	if name == "." {
+		return true
+	}
+	dir := "."
+	for _, elem := range strings.Split(name, "/") {
+		if exists(o.upper, opaqueName(dir)) {
+			return false
+		}
+		p := path.Join(dir, elem)
+		if exists(o.upper, whiteoutName(p)) {
+			return false
+		}
+		dir = p
+	}
+	return true
+}
+
+// inLower reports whether name exists and is visible in the lower layer.
+func (o *overlayFS) inLower(name string) bool {
+	return o.lowerVisible(name) && exists(o.lower, name)
+}
+
+// layer returns the layer that provides the visible file name, and a FileInfo describing it.
+func (o *overlayFS) layer(op, name string) (FS, FileInfo, error) {
+	if !ValidPath(name) {
+		return nil, nil, &PathError{Op: op, Path: name, Err: ErrInvalid}
+	}
+	fi, err := lstatOrStat(o.upper, name)
+	if err == nil {
+		return o.upper, fi, nil
+	}
+	if !errors.Is(err, ErrNotExist) {
+		return nil, nil, err
+	}
+	if !o.lowerVisible(name) {
+		return nil, nil, &PathError{Op: op, Path: name, Err: ErrNotExist}
+	}
+	fi, err = lstatOrStat(o.lower, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return o.lower, fi, nil
+}
+
+// Capabilities reports the read capabilities common to both layers, and the modifications supported by
+// the upper layer, provided it supports OpenFile and Mkdir, which are needed for copy-up and whiteouts.
+func (o *overlayFS) Capabilities() CapSet {
+	upper := Capabilities(o.upper)
+	caps := upper & Capabilities(o.lower) & (CapLstat | CapReadlink | CapSameFile)
+	if upper.Has(CapOpenFile | CapMkdir) {
+		caps |= upper & (CapOpenFile | CapMkdir | CapRemove | CapRename | CapSymlink | CapLink |
+			CapChmod | CapChown | CapLchown | CapChtimes | CapTruncate)
+	}
+	return caps
+}
+
+func (o *overlayFS) Open(name string) (File, error) {
+	layer, _, err := o.layer("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := layer.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil || !fi.IsDir() {
+		return file, err
+	}
+	entries, err := o.ReadDir(name)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &overlayDir{File: file, entries: entries}, nil
+}
+
+func (o *overlayFS) Stat(name string) (FileInfo, error) {
+	layer, _, err := o.layer("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return Stat(layer, name)
+}
+
+func (o *overlayFS) Lstat(name string) (FileInfo, error) {
+	_, fi, err := o.layer("lstat", name)
+	return fi, err
+}
+
+func (o *overlayFS) Readlink(name string) (string, error) {
+	layer, _, err := o.layer("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	return Readlink(layer, name)
+}
+
+func (o *overlayFS) SameFile(fi1, fi2 FileInfo) bool {
+	return SameFile(o.upper, fi1, fi2) || SameFile(o.lower, fi1, fi2)
+}
+
+// ReadDir returns the merged entries of the named directory, sorted by filename.
+func (o *overlayFS) ReadDir(name string) ([]DirEntry, error) {
+	layer, _, err := o.layer("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ReadDir(layer, name)
+	if err != nil {
+		return nil, err
+	}
+	if layer == o.lower {
+		return entries, nil
+	}
+
+	merged := make(map[string]DirEntry)
+	hidden := make(map[string]bool)
+	for _, entry := range entries {
+		switch entryName := entry.Name(); {
+		case entryName == WhiteoutOpaque:
+		case strings.HasPrefix(entryName, WhiteoutPrefix):
+			hidden[strings.TrimPrefix(entryName, WhiteoutPrefix)] = true
+		default:
+			merged[entryName] = entry
+		}
+	}
+	if fi, err := Stat(o.upper, name); err != nil || !fi.IsDir() {
+		// A symbolic link to a directory in the upper layer shadows the lower layer.
+		return sortedEntries(merged), nil
+	}
+	if o.inLower(name) && !exists(o.upper, opaqueName(name)) {
+		lowerEntries, err := ReadDir(o.lower, name)
+		if err != nil && !errors.Is(err, syscall.ENOTDIR) {
+			return nil, err
+		}
+		for _, entry := range lowerEntries {
+			if _, ok := merged[entry.Name()]; !ok && !hidden[entry.Name()] {
+				merged[entry.Name()] = entry
+			}
+		}
+	}
+	return sortedEntries(merged), nil
+}
+
+func sortedEntries(m map[string]DirEntry) []DirEntry {
+	entries := make([]DirEntry, 0, len(m))
+	for _, entry := range m {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries
+}
+
+// overlayDir is a directory whose entries are merged from both layers.
+type overlayDir struct {
+	File
+	entries []DirEntry
+}
+
+func (d *overlayDir) ReadDir(n int) ([]DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// copyUpDir makes sure that the directory dir exists in the upper layer.
+func (o *overlayFS) copyUpDir(dir string) error {
+	if dir == "." {
+		return nil
+	}
+	if fi, err := Stat(o.upper, dir); err == nil {
+		if !fi.IsDir() {
+			return &PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+		}
+		return nil
+	}
+	if err := o.copyUpDir(path.Dir(dir)); err != nil {
+		return err
+	}
+	layer, fi, err := o.layer("mkdir", dir)
+	if err != nil {
+		return err
+	}
+	if layer == o.lower && fi.Mode()&ModeSymlink != 0 {
+		return o.copyUp(dir, false)
+	}
+	if !fi.IsDir() {
+		return &PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+	}
+	return Mkdir(o.upper, dir, fi.Mode().Perm())
+}
+
+// copyUp copies name from the lower layer into the upper layer, unless it is already there.
+// Regular files are copied along with their contents, unless truncate is true.
+// Directories are created empty; their contents remain visible through the merged view.
+func (o *overlayFS) copyUp(name string, truncate bool) (err error) {
+	layer, fi, err := o.layer("open", name)
+	if err != nil || layer == o.upper {
+		return err
+	}
+	if err := o.copyUpDir(path.Dir(name)); err != nil {
+		return err
+	}
+	mode := fi.Mode()
+	switch {
+	case mode.IsDir():
+		return Mkdir(o.upper, name, mode.Perm())
+	case mode&ModeSymlink != 0:
+		target, err := Readlink(o.lower, name)
+		if err != nil {
+			return err
+		}
+		return Symlink(o.upper, target, name)
+	}
+
+	dst, err := OpenFile(o.upper, name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm())
+	if err != nil {
+		return err
+	}
+	defer safeClose(dst, &err)
+	if !truncate {
+		if err := copyContents(context.Background(), dst, o.lower, name); err != nil {
+			return err
+		}
+	}
+	if err := Chtimes(o.upper, name, time.Time{}, fi.ModTime()); err != nil && !errors.Is(err, ErrUnsupported) {
+		return err
+	}
+	return nil
+}
+
+// copyContents copies the contents of the named file in src to dst, cloning them if possible.
+func copyContents(ctx context.Context, dst File, src FS, name string) (err error) {
+	w, ok := dst.(io.Writer)
+	if !ok {
+		return &PathError{Op: "write", Path: name, Err: ErrUnsupported}
+	}
+	in, err := OpenContext(ctx, src, name)
+	if err != nil {
+		return err
+	}
+	defer safeClose(in, &err)
+	if err := Clone(dst, in); !errors.Is(err, ErrUnsupported) {
+		return err
+	}
+	return copyChunks(ctx, w, in)
+}
+
+// copyChunk is the size of the chunks copied by copyChunks.
+const copyChunk = 8 << 20
+
+// copyChunks copies r to w, checking ctx before each chunk. Unlike copying from a contextReader, it lets w read
+// from r with its ReadFrom method, such as an *os.File copying another in the kernel with copy_file_range(2).
+func copyChunks(ctx context.Context, w io.Writer, r io.Reader) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := io.Copy(w, io.LimitReader(r, copyChunk))
+		if err != nil || n < copyChunk {
+			return err
+		}
+	}
+}
+
+// copyUpTree copies name and, if it is a directory, all of its visible contents into the upper layer.
+func (o *overlayFS) copyUpTree(name string) error {
+	if err := o.copyUp(name, false); err != nil {
+		return err
+	}
+	fi, err := Lstat(o, name)
+	if err != nil || !fi.IsDir() {
+		return err
+	}
+	entries, err := o.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := o.copyUpTree(path.Join(name, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareCreate prepares the upper layer for creating name: it copies up the parent directory and
+// removes any whiteout for name. It reports whether the new file replaces a file in the lower layer.
+func (o *overlayFS) prepareCreate(op, name string) (replacesLower bool, err error) {
+	if !ValidPath(name) || name == "." {
+		return false, &PathError{Op: op, Path: name, Err: ErrInvalid}
+	}
+	if err := o.copyUpDir(path.Dir(name)); err != nil {
+		return false, err
+	}
+	err = Remove(o.upper, whiteoutName(name))
+	if err == nil {
+		return exists(o.lower, name), nil
+	}
+	if errors.Is(err, ErrNotExist) {
+		return false, nil
+	}
+	return false, err
+}
+
+// whiteout hides the lower layer's file name.
+func (o *overlayFS) whiteout(name string) error {
+	if err := o.copyUpDir(path.Dir(name)); err != nil {
+		return err
+	}
+	return WriteFile(o.upper, whiteoutName(name), nil, 0600)
+}
+
+func (o *overlayFS) OpenFile(name string, flag int, perm FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return o.Open(name)
+	}
+	_, _, err := o.layer("open", name)
+	switch {
+	case err == nil && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &PathError{Op: "open", Path: name, Err: ErrExist}
+	case err == nil:
+		if err := o.copyUp(name, flag&os.O_TRUNC != 0); err != nil {
+			return nil, err
+		}
+	case errors.Is(err, ErrNotExist) && flag&os.O_CREATE != 0:
+		if _, err := o.prepareCreate("open", name); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	return OpenFile(o.upper, name, flag, perm)
+}
+
+func (o *overlayFS) Mkdir(name string, perm FileMode) error {
+	if _, _, err := o.layer("mkdir", name); err == nil {
+		return &PathError{Op: "mkdir", Path: name, Err: ErrExist}
+	}
+	replacesLower, err := o.prepareCreate("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if err := Mkdir(o.upper, name, perm); err != nil {
+		return err
+	}
+	if replacesLower {
+		return WriteFile(o.upper, opaqueName(name), nil, 0600)
+	}
+	return nil
+}
+
+func (o *overlayFS) Remove(name string) error {
+	layer, fi, err := o.layer("remove", name)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		entries, err := o.ReadDir(name)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return &PathError{Op: "remove", Path: name, Err: errno.ENOTEMPTY}
+		}
+	}
+	inLower := o.inLower(name)
+	if layer == o.upper {
+		if fi.IsDir() {
+			// The directory may still contain whiteouts.
+			err = RemoveAll(o.upper, name)
+		} else {
+			err = Remove(o.upper, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if inLower {
+		return o.whiteout(name)
+	}
+	return nil
+}
+
+func (o *overlayFS) Rename(oldpath, newpath string) error {
+	linkErr := func(err error) error {
+		var pathErr *PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		return &LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	_, fi, err := o.layer("rename", oldpath)
+	if err != nil {
+		return linkErr(err)
+	}
+	if !ValidPath(newpath) || newpath == "." || (fi.IsDir() && strings.HasPrefix(newpath, oldpath+"/")) {
+		return linkErr(ErrInvalid)
+	}
+	if oldpath == newpath {
+		return nil
+	}
+	if _, newFi, err := o.layer("rename", newpath); err == nil && newFi.IsDir() {
+		entries, err := o.ReadDir(newpath)
+		if err != nil {
+			return linkErr(err)
+		}
+		if len(entries) > 0 {
+			return linkErr(errno.ENOTEMPTY)
+		}
+	}
+
+	oldInLower := o.inLower(oldpath)
+	newInLower := o.inLower(newpath)
+	if err := o.copyUpTree(oldpath); err != nil {
+		return linkErr(err)
+	}
+	if _, err := o.prepareCreate("rename", newpath); err != nil {
+		return linkErr(err)
+	}
+	if fi.IsDir() && exists(o.upper, newpath) {
+		// Remove whiteouts in an empty directory that is being replaced.
+		if err := RemoveAll(o.upper, newpath); err != nil {
+			return linkErr(err)
+		}
+	}
+	if err := Rename(o.upper, oldpath, newpath); err != nil {
+		return err
+	}
+	if oldInLower {
+		if err := o.whiteout(oldpath); err != nil {
+			return err
+		}
+	}
+	if fi.IsDir() && newInLower {
+		return WriteFile(o.upper, opaqueName(newpath), nil, 0600)
+	}
+	return nil
+}
+
+func (o *overlayFS) Symlink(oldname, newname string) error {
+	if _, _, err := o.layer("symlink", newname); err == nil {
+		return &LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrExist}
+	}
+	if _, err := o.prepareCreate("symlink", newname); err != nil {
+		return err
+	}
+	return Symlink(o.upper, oldname, newname)
+}
+
+func (o *overlayFS) Link(oldname, newname string) error {
+	if _, _, err := o.layer("link", newname); err == nil {
+		return &LinkError{Op: "link", Old: oldname, New: newname, Err: ErrExist}
+	}
+	if err := o.copyUp(oldname, false); err != nil {
+		return err
+	}
+	if _, err := o.prepareCreate("link", newname); err != nil {
+		return err
+	}
+	return Link(o.upper, oldname, newname)
+}
+
+// modify copies name up into the upper layer and applies action to it there.
+func (o *overlayFS) modify(name string, action func(fsys FS) error) error {
+	if err := o.copyUp(name, false); err != nil {
+		return err
+	}
+	return action(o.upper)
+}
+
+func (o *overlayFS) Chmod(name string, mode FileMode) error {
+	return o.modify(name, func(fsys FS) error { return Chmod(fsys, name, mode) })
+}
+
+func (o *overlayFS) Chown(name string, uid, gid int) error {
+	return o.modify(name, func(fsys FS) error { return Chown(fsys, name, uid, gid) })
+}
+
+func (o *overlayFS) Lchown(name string, uid, gid int) error {
+	return o.modify(name, func(fsys FS) error { return Lchown(fsys, name, uid, gid) })
+}
+
+func (o *overlayFS) Chtimes(name string, atime, mtime time.Time) error {
+	return o.modify(name, func(fsys FS) error { return Chtimes(fsys, name, atime, mtime) })
+}
+
+func (o *overlayFS) Truncate(name string, size int64) error {
+	if err := o.copyUp(name, size == 0); err != nil {
+		return err
+	}
+	return Truncate(o.upper, name, size)
+}
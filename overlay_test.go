@@ -0,0 +1,59 @@
+package wrfs_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+	"github.com/relab/wrfs/wrfstest"
+)
+
+func newLowerFS(t *testing.T) FS {
+	lower := memfs.New()
+	check(t, MkdirAll(lower, "dir/sub", 0755))
+	check(t, WriteFile(lower, "dir/file", []byte("lower"), 0644))
+	check(t, WriteFile(lower, "dir/sub/file", []byte("lower"), 0644))
+	return lower
+}
+
+func TestOverlay(t *testing.T) {
+	lower := newLowerFS(t)
+	upper := memfs.New()
+	fsys := Overlay(upper, lower)
+
+	if err := wrfstest.TestWriteFS(fsys, wrfstest.Dir("dir")); err != nil {
+		t.Fatal(err)
+	}
+
+	check(t, WriteFile(fsys, "dir/file", []byte("upper"), 0644))
+	checkContents(t, fsys, "dir/file", "upper")
+	checkContents(t, lower, "dir/file", "lower")
+
+	check(t, RemoveAll(fsys, "dir/sub"))
+	if _, err := Stat(fsys, "dir/sub/file"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("removed file is still visible: %v", err)
+	}
+	if _, err := Stat(upper, "dir/"+WhiteoutPrefix+"sub"); err != nil {
+		t.Errorf("no whiteout recorded: %v", err)
+	}
+	checkContents(t, lower, "dir/sub/file", "lower")
+
+	// A recreated directory must not expose the lower directory's contents.
+	check(t, Mkdir(fsys, "dir/sub", 0755))
+	entries, err := ReadDir(fsys, "dir/sub")
+	check(t, err)
+	if len(entries) != 0 {
+		t.Errorf("recreated directory is not empty: %v", entries)
+	}
+
+	entries, err = ReadDir(fsys, "dir")
+	check(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if got, want := len(names), 2; got != want {
+		t.Errorf("wrong entries in merged directory: %v", names)
+	}
+}
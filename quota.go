@@ -0,0 +1,323 @@
+package wrfs
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// Quota returns a file system that limits the total size of the regular files in fsys to maxBytes.
+// Writes and truncations that would make the total exceed the limit fail with an error matching
+// syscall.ENOSPC, without modifying the file. Statfs reports the limit as the total size of the file system.
+//
+// The current total is computed by walking fsys before the first modifying operation, and is then kept
+// up to date by tracking writes, truncations, removals and renames made through the returned file system.
+// Changes made to fsys by other means are not accounted for, and files with several hard links are counted
+// once per link.
+func Quota(fsys FS, maxBytes int64) FS {
+	return &quotaFS{fsWrapper: fsWrapper{fsys}, max: maxBytes}
+}
+
+type quotaFS struct {
+	fsWrapper
+	max int64
+
+	mu      sync.Mutex
+	used    int64
+	scanned bool
+}
+
+func quotaErr(op, name string) error {
+	return &PathError{Op: op, Path: name, Err: errno.ENOSPC}
+}
+
+// scan computes the total size of fsys if it has not been computed yet. The caller must hold q.mu.
+func (q *quotaFS) scan() error {
+	if q.scanned {
+		return nil
+	}
+	used, err := q.size(".")
+	if err != nil {
+		return err
+	}
+	q.used, q.scanned = used, true
+	return nil
+}
+
+// size returns the total size of the regular files in the named tree.
+func (q *quotaFS) size(root string) (int64, error) {
+	var total int64
+	err := WalkDir(q.fsys, root, func(name string, d DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		total += fi.Size()
+		return nil
+	})
+	return total, err
+}
+
+// fileSize returns the size of the named file if it is a regular file, and 0 otherwise.
+func (q *quotaFS) fileSize(name string) int64 {
+	fi, err := lstatOrStat(q.fsys, name)
+	if err != nil || !fi.Mode().IsRegular() {
+		return 0
+	}
+	return fi.Size()
+}
+
+// reserve adds delta to the total, failing if the result would exceed the limit.
+func (q *quotaFS) reserve(op, name string, delta int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.scan(); err != nil {
+		return err
+	}
+	if delta > 0 && q.used+delta > q.max {
+		return quotaErr(op, name)
+	}
+	q.used += delta
+	return nil
+}
+
+// release subtracts n from the total.
+func (q *quotaFS) release(n int64) {
+	q.mu.Lock()
+	q.used -= n
+	q.mu.Unlock()
+}
+
+func (q *quotaFS) OpenFile(name string, flag int, perm FileMode) (File, error) {
+	if flag&(O_WRONLY|O_RDWR|O_APPEND|O_CREATE|O_TRUNC) == 0 {
+		return OpenFile(q.fsys, name, flag, perm)
+	}
+	// Make sure the total is known before the file is modified.
+	if err := q.reserve("open", name, 0); err != nil {
+		return nil, err
+	}
+	var truncated int64
+	if flag&O_TRUNC != 0 && flag&(O_WRONLY|O_RDWR) != 0 {
+		truncated = q.fileSize(name)
+	}
+	file, err := OpenFile(q.fsys, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	q.release(truncated)
+	return &quotaFile{file: file, name: name, append: flag&O_APPEND != 0, q: q}, nil
+}
+
+func (q *quotaFS) Truncate(name string, size int64) error {
+	fi, err := Stat(q.fsys, name)
+	if err != nil {
+		return err
+	}
+	if err := q.reserve("truncate", name, size-fi.Size()); err != nil {
+		return err
+	}
+	if err := Truncate(q.fsys, name, size); err != nil {
+		q.release(size - fi.Size())
+		return err
+	}
+	return nil
+}
+
+func (q *quotaFS) Remove(name string) error {
+	if err := q.reserve("remove", name, 0); err != nil {
+		return err
+	}
+	size := q.fileSize(name)
+	if err := Remove(q.fsys, name); err != nil {
+		return err
+	}
+	q.release(size)
+	return nil
+}
+
+// RemoveAll removes the files one at a time through Remove, so that the total is kept up to date.
+func (q *quotaFS) RemoveAll(path string) error {
+	return removeAll(context.Background(), q, path)
+}
+
+func (q *quotaFS) Rename(oldpath, newpath string) error {
+	if err := q.reserve("rename", oldpath, 0); err != nil {
+		return err
+	}
+	var replaced int64
+	if fi, err := lstatOrStat(q.fsys, newpath); err == nil && fi.Mode().IsRegular() {
+		if ofi, err := lstatOrStat(q.fsys, oldpath); err != nil || !SameFile(q.fsys, fi, ofi) {
+			replaced = fi.Size()
+		}
+	}
+	if err := Rename(q.fsys, oldpath, newpath); err != nil {
+		return err
+	}
+	q.release(replaced)
+	return nil
+}
+
+func (q *quotaFS) Statfs(name string) (FSInfo, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.scan(); err != nil {
+		return FSInfo{}, err
+	}
+	var free uint64
+	if q.used < q.max {
+		free = uint64(q.max - q.used)
+	}
+	return FSInfo{Total: uint64(q.max), Free: free, Available: free}, nil
+}
+
+// quotaFile is a file opened for writing through a quotaFS.
+type quotaFile struct {
+	file   File
+	name   string
+	append bool
+	q      *quotaFS
+}
+
+// grow reserves the space needed to write n bytes at off, or at the end of the file if off is negative,
+// and returns the reserved amount along with the size of the file before the write.
+func (f *quotaFile) grow(op string, off int64, n int) (reserved, size int64, err error) {
+	fi, err := f.file.Stat()
+	if err != nil {
+		return 0, 0, &PathError{Op: op, Path: f.name, Err: err}
+	}
+	size = fi.Size()
+	if off < 0 {
+		off = size
+	}
+	if end := off + int64(n); end > size {
+		reserved = end - size
+	}
+	return reserved, size, f.q.reserve(op, f.name, reserved)
+}
+
+// settle corrects the reservation made by grow once n bytes have been written at off.
+func (f *quotaFile) settle(reserved, size, off int64, n int) {
+	if off < 0 {
+		off = size
+	}
+	var grown int64
+	if end := off + int64(n); end > size {
+		grown = end - size
+	}
+	f.q.release(reserved - grown)
+}
+
+// offset returns the offset of the next Write, or -1 if it is at the end of the file.
+func (f *quotaFile) offset() int64 {
+	if f.append {
+		return -1
+	}
+	off, err := Seek(f.file, 0, io.SeekCurrent)
+	if err != nil {
+		// Assume the worst case, that the write extends the file by its full length.
+		return -1
+	}
+	return off
+}
+
+func (f *quotaFile) Write(p []byte) (int, error) {
+	off := f.offset()
+	reserved, size, err := f.grow("write", off, len(p))
+	if err != nil {
+		return 0, err
+	}
+	n, err := Write(f.file, p)
+	f.settle(reserved, size, off, n)
+	return n, err
+}
+
+func (f *quotaFile) WriteAt(p []byte, off int64) (int, error) {
+	w, ok := f.file.(io.WriterAt)
+	if !ok {
+		return 0, &PathError{Op: "writeat", Path: f.name, Err: ErrUnsupported}
+	}
+	reserved, size, err := f.grow("writeat", off, len(p))
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.WriteAt(p, off)
+	f.settle(reserved, size, off, n)
+	return n, err
+}
+
+func (f *quotaFile) Truncate(size int64) error {
+	t, ok := f.file.(TruncateFile)
+	if !ok {
+		return &PathError{Op: "truncate", Path: f.name, Err: ErrUnsupported}
+	}
+	fi, err := f.file.Stat()
+	if err != nil {
+		return &PathError{Op: "truncate", Path: f.name, Err: err}
+	}
+	if err := f.q.reserve("truncate", f.name, size-fi.Size()); err != nil {
+		return err
+	}
+	if err := t.Truncate(size); err != nil {
+		f.q.release(size - fi.Size())
+		return err
+	}
+	return nil
+}
+
+func (f *quotaFile) Stat() (FileInfo, error) { return f.file.Stat() }
+
+func (f *quotaFile) Read(p []byte) (int, error) { return f.file.Read(p) }
+
+func (f *quotaFile) Close() error { return f.file.Close() }
+
+func (f *quotaFile) Seek(offset int64, whence int) (int64, error) {
+	return Seek(f.file, offset, whence)
+}
+
+func (f *quotaFile) ReadAt(p []byte, off int64) (int, error) {
+	if r, ok := f.file.(io.ReaderAt); ok {
+		return r.ReadAt(p, off)
+	}
+	return 0, &PathError{Op: "readat", Path: f.name, Err: ErrUnsupported}
+}
+
+func (f *quotaFile) ReadDir(n int) ([]DirEntry, error) {
+	if dir, ok := f.file.(ReadDirFile); ok {
+		return dir.ReadDir(n)
+	}
+	return nil, &PathError{Op: "readdir", Path: f.name, Err: ErrUnsupported}
+}
+
+func (f *quotaFile) Chmod(mode FileMode) error {
+	if file, ok := f.file.(ChmodFile); ok {
+		return file.Chmod(mode)
+	}
+	return &PathError{Op: "chmod", Path: f.name, Err: ErrUnsupported}
+}
+
+func (f *quotaFile) Chown(uid, gid int) error {
+	if file, ok := f.file.(ChownFile); ok {
+		return file.Chown(uid, gid)
+	}
+	return &PathError{Op: "chown", Path: f.name, Err: ErrUnsupported}
+}
+
+func (f *quotaFile) Chtimes(atime, mtime time.Time) error {
+	if file, ok := f.file.(ChtimesFile); ok {
+		return file.Chtimes(atime, mtime)
+	}
+	return &PathError{Op: "chtimes", Path: f.name, Err: ErrUnsupported}
+}
+
+func (f *quotaFile) Sync() error {
+	if file, ok := f.file.(SyncFile); ok {
+		return file.Sync()
+	}
+	return &PathError{Op: "sync", Path: f.name, Err: ErrUnsupported}
+}
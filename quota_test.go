@@ -0,0 +1,37 @@
+package wrfs_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/errno"
+)
+
+func TestQuota(t *testing.T) {
+	fsys := Quota(newLowerFS(t), 20) // 10 bytes are used by newLowerFS
+
+	check(t, WriteFile(fsys, "dir/a", []byte("0123456789"), 0644))
+	if err := WriteFile(fsys, "dir/b", []byte("x"), 0644); !errors.Is(err, errno.ENOSPC) {
+		t.Errorf("WriteFile over quota: got %v, want ENOSPC", err)
+	}
+	check(t, Remove(fsys, "dir/b"))
+	if info, err := Statfs(fsys, "."); err != nil || info.Total != 20 || info.Free != 0 {
+		t.Errorf("Statfs = %+v, %v; want 20 bytes total and none free", info, err)
+	}
+
+	check(t, Truncate(fsys, "dir/a", 5))
+	file, err := OpenFile(fsys, "dir/a", O_WRONLY|O_APPEND, 0)
+	check(t, err)
+	if n, err := Write(file, []byte("0123456")); n != 0 || !errors.Is(err, errno.ENOSPC) {
+		t.Errorf("Write over quota: got %d, %v; want 0, ENOSPC", n, err)
+	}
+	_, err = Write(file, []byte("01234"))
+	check(t, err)
+	check(t, file.Close())
+
+	check(t, RemoveAll(fsys, "dir/sub"))
+	check(t, Rename(fsys, "dir/a", "dir/file"))
+	check(t, WriteFile(fsys, "dir/c", []byte("0123456789"), 0644))
+	checkContents(t, fsys, "dir/file", "0123401234")
+}
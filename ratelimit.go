@@ -0,0 +1,25 @@
+package wrfs
+
+// RateLimit returns a file system that limits the rate of operations on fsys to opsPerSec operations per
+// second, allowing bursts of up to burst operations; a burst of less than one is treated as one. Operations
+// that exceed the rate wait for their turn, or until the context of OpenContext, OpenFileContext,
+// RemoveContext or RemoveAllContext is done.
+//
+// Every file system operation counts as one, regardless of how many calls it makes to fsys, while reads and
+// writes of open files are not limited; see Throttle for limiting bandwidth. This protects backends with
+// request quotas, such as SFTP servers or object stores, from bursts of calls made by WalkDir or CopyFS.
+func RateLimit(fsys FS, opsPerSec float64, burst int) FS {
+	if burst < 1 {
+		burst = 1
+	}
+	b := newTokenBucket(opsPerSec, int64(burst))
+	return Wrap(fsys, InterceptorFunc(func(inv *Invocation, next func() error) error {
+		if err := b.takeContext(inv.Ctx, 1); err != nil {
+			if inv.NewPath != "" {
+				return &LinkError{Op: inv.Op, Old: inv.Path, New: inv.NewPath, Err: err}
+			}
+			return &PathError{Op: inv.Op, Path: inv.Path, Err: err}
+		}
+		return next()
+	}))
+}
@@ -0,0 +1,29 @@
+package wrfs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestRateLimit(t *testing.T) {
+	fsys := RateLimit(newLowerFS(t), 50, 2)
+
+	start := time.Now()
+	for i := 0; i < 7; i++ {
+		_, err := Stat(fsys, "dir/file")
+		check(t, err)
+	}
+	if d := time.Since(start); d < 80*time.Millisecond {
+		t.Errorf("7 operations at 50/s with a burst of 2 took %v, want at least 100ms", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := OpenContext(ctx, fsys, "dir/file"); !errors.Is(err, context.Canceled) {
+		t.Errorf("OpenContext with canceled context: got %v, want context.Canceled", err)
+	}
+}
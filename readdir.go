@@ -0,0 +1,103 @@
+package wrfs
+
+import "io"
+
+// A ReadDirPager reads the entries of a directory a page at a time, as returned by ReadDirPages.
+type ReadDirPager interface {
+	// Next returns the next page of entries, or io.EOF once all entries have been returned.
+	// The last page may be shorter than the others.
+	Next() ([]DirEntry, error)
+
+	// Close releases the directory.
+	Close() error
+}
+
+// A ReadDirOption configures ReadDirPages.
+type ReadDirOption func(*readDirConfig)
+
+type readDirConfig struct {
+	unsorted bool
+}
+
+// ReadDirUnsorted makes ReadDirPages return the entries in the order the directory returns them, reading each page
+// from the directory as it is requested, instead of reading and sorting all entries up front.
+func ReadDirUnsorted() ReadDirOption {
+	return func(c *readDirConfig) { c.unsorted = true }
+}
+
+// ReadDirPages returns a ReadDirPager for the named directory, whose pages hold n entries each, or 100 if n is not
+// positive. By default the entries are sorted by filename, as with ReadDir, which requires reading all of them
+// before returning the first page; with ReadDirUnsorted, they are read incrementally with the ReadDir method of
+// the open directory, so that listing a directory with millions of entries only ever holds one page of them.
+func ReadDirPages(fsys FS, name string, n int, opts ...ReadDirOption) (ReadDirPager, error) {
+	var c readDirConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if n <= 0 {
+		n = 100
+	}
+	if !c.unsorted {
+		entries, err := ReadDir(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		return &slicePager{entries, n}, nil
+	}
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	dir, ok := file.(ReadDirFile)
+	if !ok {
+		file.Close()
+		return nil, &PathError{Op: "readdir", Path: name, Err: ErrUnsupported}
+	}
+	return &filePager{dir: dir, n: n}, nil
+}
+
+// slicePager pages through entries that have been read already.
+type slicePager struct {
+	entries []DirEntry
+	n       int
+}
+
+func (p *slicePager) Next() ([]DirEntry, error) {
+	if len(p.entries) == 0 {
+		return nil, io.EOF
+	}
+	page := p.entries[:min(p.n, len(p.entries))]
+	p.entries = p.entries[len(page):]
+	return page, nil
+}
+
+func (p *slicePager) Close() error {
+	p.entries = nil
+	return nil
+}
+
+// filePager pages through the entries of an open directory.
+type filePager struct {
+	dir ReadDirFile
+	n   int
+	err error // the error to return once the entries read with it have been returned
+}
+
+func (p *filePager) Next() ([]DirEntry, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	entries, err := p.dir.ReadDir(p.n)
+	if err == nil && len(entries) == 0 {
+		err = io.EOF
+	}
+	if len(entries) > 0 {
+		p.err = err
+		return entries, nil
+	}
+	return nil, err
+}
+
+func (p *filePager) Close() error {
+	return p.dir.Close()
+}
@@ -0,0 +1,51 @@
+package wrfs_test
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestReadDirPages(t *testing.T) {
+	fsys := newLowerFS(t)
+	for _, name := range []string{"e", "d", "c", "b", "a"} {
+		check(t, WriteFile(fsys, "dir/sub/"+name, nil, 0644))
+	}
+	for _, unsorted := range []bool{false, true} {
+		var opts []ReadDirOption
+		if unsorted {
+			opts = append(opts, ReadDirUnsorted())
+		}
+		pager, err := ReadDirPages(fsys, "dir/sub", 4, opts...)
+		check(t, err)
+		var names []string
+		for {
+			page, err := pager.Next()
+			if err == io.EOF {
+				break
+			}
+			check(t, err)
+			if len(page) > 4 {
+				t.Errorf("page of %d entries, want at most 4", len(page))
+			}
+			for _, entry := range page {
+				names = append(names, entry.Name())
+			}
+		}
+		check(t, pager.Close())
+		if !unsorted && !sort.StringsAreSorted(names) {
+			t.Errorf("ReadDirPages returned unsorted entries %v", names)
+		}
+		sort.Strings(names)
+		if got, want := strings.Join(names, " "), "a b c d e file"; got != want {
+			t.Errorf("ReadDirPages (unsorted %v) returned %q, want %q", unsorted, got, want)
+		}
+	}
+	if _, err := ReadDirPages(fsys, "missing", 4); !errors.Is(err, ErrNotExist) {
+		t.Errorf("ReadDirPages(missing): got %v, want ErrNotExist", err)
+	}
+}
@@ -1,5 +1,12 @@
 package wrfs
 
+import (
+	"path"
+	"strings"
+
+	"github.com/relab/wrfs/internal/errno"
+)
+
 // ReadlinkFS is a file system that supports the Readlink function.
 type ReadlinkFS interface {
 	// Readlink returns the destination of the named symbolic link.
@@ -13,3 +20,60 @@ func Readlink(fsys FS, name string) (string, error) {
 	}
 	return "", &PathError{Op: "readlink", Path: name, Err: ErrUnsupported}
 }
+
+// maxSymlinks is the number of symbolic links that EvalSymlinks follows before failing with ELOOP.
+const maxSymlinks = 255
+
+// EvalSymlinks returns name with the symbolic links in it resolved, as a clean path relative to the root of fsys,
+// like filepath.EvalSymlinks does for the host file system. Links are detected with Lstat and read with Readlink,
+// and relative link targets are resolved against the directory of the link. If fsys does not implement LstatFS,
+// name is only checked to exist.
+//
+// Links to absolute paths and links leading outside of fsys, through "..", fail with an error matching
+// ErrInvalid. After following 255 links, as happens with a loop of links, EvalSymlinks fails with an error
+// matching syscall.ELOOP.
+func EvalSymlinks(fsys FS, name string) (string, error) {
+	if !ValidPath(name) {
+		return "", &PathError{Op: "evalsymlinks", Path: name, Err: ErrInvalid}
+	}
+	resolved := "."
+	var rest []string
+	if name != "." {
+		rest = strings.Split(name, "/")
+	}
+	for links := 0; len(rest) > 0; {
+		elem := rest[0]
+		rest = rest[1:]
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if resolved == "." {
+				return "", &PathError{Op: "evalsymlinks", Path: name, Err: ErrInvalid}
+			}
+			resolved = path.Dir(resolved)
+			continue
+		}
+		next := path.Join(resolved, elem)
+		fi, err := lstatOrStat(fsys, next)
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return "", &PathError{Op: "evalsymlinks", Path: name, Err: errno.ELOOP}
+		}
+		target, err := Readlink(fsys, next)
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(target) {
+			return "", &PathError{Op: "evalsymlinks", Path: name, Err: ErrInvalid}
+		}
+		rest = append(strings.Split(target, "/"), rest...)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,35 @@
+package wrfs_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/errno"
+)
+
+func TestEvalSymlinks(t *testing.T) {
+	fsys := newLowerFS(t)
+	check(t, Symlink(fsys, "sub", "dir/link"))
+	check(t, Symlink(fsys, "dir/link/../link/file", "file"))
+	check(t, Symlink(fsys, "../..", "dir/up"))
+	check(t, Symlink(fsys, "/dir", "abs"))
+	check(t, Symlink(fsys, "loop", "loop"))
+	for name, want := range map[string]string{".": ".", "dir/file": "dir/file", "dir/link": "dir/sub", "file": "dir/sub/file"} {
+		got, err := EvalSymlinks(fsys, name)
+		if err != nil || got != want {
+			t.Errorf("EvalSymlinks(%s) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"dir/up/dir", "abs/file"} {
+		if _, err := EvalSymlinks(fsys, name); !errors.Is(err, ErrInvalid) {
+			t.Errorf("EvalSymlinks(%s): got %v, want ErrInvalid", name, err)
+		}
+	}
+	if _, err := EvalSymlinks(fsys, "loop"); !errors.Is(err, errno.ELOOP) {
+		t.Errorf("EvalSymlinks(loop): got %v, want ELOOP", err)
+	}
+	if _, err := EvalSymlinks(fsys, "dir/missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("EvalSymlinks(dir/missing): got %v, want ErrNotExist", err)
+	}
+}
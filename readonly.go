@@ -0,0 +1,150 @@
+package wrfs
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// ReadOnly returns a file system that provides read access to fsys, but rejects every operation that
+// would modify it with ErrPermission. Files opened through it do not expose write methods, even if the
+// files of fsys do.
+func ReadOnly(fsys FS) FS {
+	return &readOnlyFS{fsWrapper{fsys}}
+}
+
+type readOnlyFS struct {
+	fsWrapper
+}
+
+func permErr(op, name string) error {
+	return &PathError{Op: op, Path: name, Err: ErrPermission}
+}
+
+func linkPermErr(op, oldname, newname string) error {
+	return &LinkError{Op: op, Old: oldname, New: newname, Err: ErrPermission}
+}
+
+func (r *readOnlyFS) Open(name string) (File, error) {
+	file, err := r.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyFile{file, name}, nil
+}
+
+func (r *readOnlyFS) OpenFile(name string, flag int, perm FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, permErr("open", name)
+	}
+	return r.Open(name)
+}
+
+// OpenLock opens an existing file for locking. Locks are advisory, so they do not modify the file system,
+// but OpenLock does not create missing files.
+func (r *readOnlyFS) OpenLock(name string) (LockFile, error) {
+	if _, err := Stat(r.fsys, name); err != nil {
+		return nil, err
+	}
+	file, err := OpenLock(r.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyLockFile{readOnlyFile{file, name}, file}, nil
+}
+
+func (r *readOnlyFS) Capabilities() CapSet {
+	return Capabilities(r.fsys) & (CapReadlink | CapLstat | CapSameFile | CapSync | CapSyncDir | CapStatfs | CapLock | CapWatch)
+}
+
+func (r *readOnlyFS) Chmod(name string, mode FileMode) error {
+	return permErr("chmod", name)
+}
+
+func (r *readOnlyFS) Chown(name string, uid, gid int) error {
+	return permErr("chown", name)
+}
+
+func (r *readOnlyFS) Lchown(name string, uid, gid int) error {
+	return permErr("lchown", name)
+}
+
+func (r *readOnlyFS) Chtimes(name string, atime, mtime time.Time) error {
+	return permErr("chtimes", name)
+}
+
+func (r *readOnlyFS) Mkdir(name string, perm FileMode) error {
+	return permErr("mkdir", name)
+}
+
+func (r *readOnlyFS) MkdirAll(path string, perm FileMode) error {
+	return permErr("mkdir", path)
+}
+
+func (r *readOnlyFS) Remove(name string) error {
+	return permErr("remove", name)
+}
+
+func (r *readOnlyFS) RemoveAll(path string) error {
+	return permErr("remove", path)
+}
+
+func (r *readOnlyFS) Rename(oldpath, newpath string) error {
+	return linkPermErr("rename", oldpath, newpath)
+}
+
+func (r *readOnlyFS) Symlink(oldname, newname string) error {
+	return linkPermErr("symlink", oldname, newname)
+}
+
+func (r *readOnlyFS) Link(oldname, newname string) error {
+	return linkPermErr("link", oldname, newname)
+}
+
+func (r *readOnlyFS) Truncate(name string, size int64) error {
+	return permErr("truncate", name)
+}
+
+// readOnlyFile exposes only the read methods of a file.
+type readOnlyFile struct {
+	file File
+	name string
+}
+
+func (f *readOnlyFile) Stat() (FileInfo, error) { return f.file.Stat() }
+
+func (f *readOnlyFile) Read(p []byte) (int, error) { return f.file.Read(p) }
+
+func (f *readOnlyFile) Close() error { return f.file.Close() }
+
+func (f *readOnlyFile) ReadDir(n int) ([]DirEntry, error) {
+	if dir, ok := f.file.(ReadDirFile); ok {
+		return dir.ReadDir(n)
+	}
+	return nil, &PathError{Op: "readdir", Path: f.name, Err: ErrUnsupported}
+}
+
+func (f *readOnlyFile) ReadAt(p []byte, off int64) (int, error) {
+	if r, ok := f.file.(io.ReaderAt); ok {
+		return r.ReadAt(p, off)
+	}
+	return 0, &PathError{Op: "readat", Path: f.name, Err: ErrUnsupported}
+}
+
+func (f *readOnlyFile) Seek(offset int64, whence int) (int64, error) {
+	return Seek(f.file, offset, whence)
+}
+
+// readOnlyLockFile exposes only the read and lock methods of a file.
+type readOnlyLockFile struct {
+	readOnlyFile
+	lock LockFile
+}
+
+func (f *readOnlyLockFile) Lock() error { return f.lock.Lock() }
+
+func (f *readOnlyLockFile) RLock() error { return f.lock.RLock() }
+
+func (f *readOnlyLockFile) TryLock() (bool, error) { return f.lock.TryLock() }
+
+func (f *readOnlyLockFile) Unlock() error { return f.lock.Unlock() }
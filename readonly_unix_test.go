@@ -0,0 +1,57 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wrfs_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestReadOnly(t *testing.T) {
+	inner := getFS(t)
+	fileName := "TestReadOnly"
+	writeFile(t, inner, fileName, []byte("data"))
+	fsys := ReadOnly(inner)
+
+	if _, err := ReadFile(fsys, fileName); err != nil {
+		t.Errorf("ReadFile failed: %v", err)
+	}
+	for op, err := range map[string]error{
+		"WriteFile": WriteFile(fsys, fileName, nil, 0644),
+		"Chmod":     Chmod(fsys, fileName, 0600),
+		"Mkdir":     Mkdir(fsys, "dir", 0755),
+		"Remove":    Remove(fsys, fileName),
+		"RemoveAll": RemoveAll(fsys, fileName),
+		"Rename":    Rename(fsys, fileName, "new"),
+		"Truncate":  Truncate(fsys, fileName, 0),
+	} {
+		if !errors.Is(err, ErrPermission) {
+			t.Errorf("%s: got error %v, want %v", op, err, ErrPermission)
+		}
+	}
+
+	file, err := fsys.Open(fileName)
+	check(t, err)
+	if _, ok := file.(io.Writer); ok {
+		t.Error("file opened through ReadOnly can be written")
+	}
+	check(t, file.Close())
+
+	lockFile, err := OpenLock(fsys, fileName)
+	check(t, err)
+	check(t, lockFile.Lock())
+	if chmod, ok := lockFile.(ChmodFile); ok {
+		if err := chmod.Chmod(0600); !errors.Is(err, ErrPermission) {
+			t.Errorf("Chmod of a file opened with OpenLock: got error %v, want %v", err, ErrPermission)
+		}
+	}
+	if _, ok := OSFile(lockFile); ok {
+		t.Error("file opened with OpenLock through ReadOnly exposes its *os.File")
+	}
+	check(t, lockFile.Unlock())
+	check(t, lockFile.Close())
+}
@@ -0,0 +1,241 @@
+package wrfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path"
+)
+
+// A Redaction transforms the contents of the files matching a pattern when they are read through Redact.
+type Redaction struct {
+	// Pattern selects the files to transform, in the syntax of a line of a .gitignore file as parsed by
+	// ParseIgnore, such as "*.env" or "config/**/secrets.yaml".
+	Pattern string
+
+	// Transform returns the contents to present for a file, given its actual contents.
+	Transform func(data []byte) []byte
+}
+
+// Redact returns a file system that presents the contents of the files of fsys matching the redactions as
+// transformed by them, such as for masking secrets in a view of a tree handed to support tooling. When several
+// redactions match a file, their transforms are applied in order. Matching files are read in full when opened or
+// statted, and report the size of their transformed contents.
+//
+// Files matching a redaction cannot be written, truncated, renamed or linked through the returned file system,
+// since that could write redacted contents back or expose the actual contents under another name. Other files are
+// left untouched. Symbolic links are resolved before matching, so that links to matching files are redacted too.
+func Redact(fsys FS, redactions ...Redaction) FS {
+	r := &redactFS{fsWrapper: fsWrapper{fsys}}
+	for _, redaction := range redactions {
+		r.patterns = append(r.patterns, ParseIgnore([]byte(redaction.Pattern)))
+		r.transforms = append(r.transforms, redaction.Transform)
+	}
+	return r
+}
+
+type redactFS struct {
+	fsWrapper
+	patterns   []*IgnorePatterns
+	transforms []func(data []byte) []byte
+}
+
+// matches returns the transforms of the redactions matching the named regular file, after resolving symbolic links.
+func (r *redactFS) matches(name string) []func(data []byte) []byte {
+	resolved, err := EvalSymlinks(r.fsys, name)
+	if err != nil {
+		resolved = name
+	}
+	var transforms []func(data []byte) []byte
+	for i, patterns := range r.patterns {
+		if patterns.Match(name, false) || patterns.Match(resolved, false) {
+			transforms = append(transforms, r.transforms[i])
+		}
+	}
+	return transforms
+}
+
+// redacted returns the transformed contents of the named file, or nil if it is not redacted.
+func (r *redactFS) redacted(file File, name string) (data []byte, info FileInfo, err error) {
+	fi, err := file.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return nil, fi, err
+	}
+	transforms := r.matches(name)
+	if len(transforms) == 0 {
+		return nil, fi, nil
+	}
+	data, err = io.ReadAll(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, transform := range transforms {
+		data = transform(data)
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return data, &sizedInfo{fi, int64(len(data))}, nil
+}
+
+// blocked returns an error matching ErrPermission if the named file is redacted.
+func (r *redactFS) blocked(op, name string) error {
+	if len(r.matches(name)) > 0 {
+		return &PathError{Op: op, Path: name, Err: ErrPermission}
+	}
+	return nil
+}
+
+func (r *redactFS) Open(name string) (File, error) {
+	file, err := r.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	data, fi, err := r.redacted(file, name)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if data != nil {
+		file.Close()
+		return &redactedFile{bytes.NewReader(data), fi, nil}, nil
+	}
+	if fi.IsDir() {
+		return &redactDir{file, r, name}, nil
+	}
+	return file, nil
+}
+
+// OpenLock opens the named file for locking. Redacted files present their transformed contents, and cannot be
+// created by it.
+func (r *redactFS) OpenLock(name string) (LockFile, error) {
+	if _, err := Stat(r.fsys, name); errors.Is(err, ErrNotExist) {
+		if err := r.blocked("open", name); err != nil {
+			return nil, err
+		}
+	}
+	file, err := OpenLock(r.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	data, fi, err := r.redacted(file, name)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if data != nil {
+		return &lockingFile{&redactedFile{bytes.NewReader(data), fi, file}, file}, nil
+	}
+	return file, nil
+}
+
+func (r *redactFS) Stat(name string) (FileInfo, error) {
+	fi, err := Stat(r.fsys, name)
+	if err != nil || !fi.Mode().IsRegular() || len(r.matches(name)) == 0 {
+		return fi, err
+	}
+	file, err := r.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return file.Stat()
+}
+
+func (r *redactFS) Lstat(name string) (FileInfo, error) {
+	fi, err := Lstat(r.fsys, name)
+	if err != nil || !fi.Mode().IsRegular() {
+		return fi, err
+	}
+	return r.Stat(name)
+}
+
+func (r *redactFS) ReadDir(name string) ([]DirEntry, error) {
+	entries, err := ReadDir(r.fsys, name)
+	for i, e := range entries {
+		entries[i] = &redactEntry{e, path.Join(name, e.Name()), r}
+	}
+	return entries, err
+}
+
+func (r *redactFS) OpenFile(name string, flag int, perm FileMode) (File, error) {
+	if flag&(O_WRONLY|O_RDWR|O_APPEND|O_CREATE|O_TRUNC) == 0 {
+		return r.Open(name)
+	}
+	if err := r.blocked("open", name); err != nil {
+		return nil, err
+	}
+	return OpenFile(r.fsys, name, flag, perm)
+}
+
+func (r *redactFS) Truncate(name string, size int64) error {
+	if err := r.blocked("truncate", name); err != nil {
+		return err
+	}
+	return Truncate(r.fsys, name, size)
+}
+
+func (r *redactFS) Rename(oldpath, newpath string) error {
+	if len(r.matches(oldpath)) > 0 || len(r.matches(newpath)) > 0 {
+		return &LinkError{Op: "rename", Old: oldpath, New: newpath, Err: ErrPermission}
+	}
+	return Rename(r.fsys, oldpath, newpath)
+}
+
+func (r *redactFS) Link(oldname, newname string) error {
+	if len(r.matches(oldname)) > 0 {
+		return &LinkError{Op: "link", Old: oldname, New: newname, Err: ErrPermission}
+	}
+	return Link(r.fsys, oldname, newname)
+}
+
+// redactedFile is an open redacted file, holding its transformed contents, and the file they were read from
+// if it is kept open for locking.
+type redactedFile struct {
+	*bytes.Reader
+	info FileInfo
+	file File
+}
+
+func (f *redactedFile) Stat() (FileInfo, error) { return f.info, nil }
+
+func (f *redactedFile) Close() error {
+	if f.file != nil {
+		return f.file.Close()
+	}
+	return nil
+}
+
+// redactDir is an open directory of a redactFS, whose entries report the sizes of redacted files.
+type redactDir struct {
+	File
+	r    *redactFS
+	name string
+}
+
+func (d *redactDir) ReadDir(n int) ([]DirEntry, error) {
+	dir, ok := d.File.(ReadDirFile)
+	if !ok {
+		return nil, &PathError{Op: "readdir", Path: d.name, Err: ErrUnsupported}
+	}
+	entries, err := dir.ReadDir(n)
+	for i, e := range entries {
+		entries[i] = &redactEntry{e, path.Join(d.name, e.Name()), d.r}
+	}
+	return entries, err
+}
+
+// redactEntry is a directory entry whose Info reports the size of the transformed contents.
+type redactEntry struct {
+	DirEntry
+	path string
+	r    *redactFS
+}
+
+func (e *redactEntry) Info() (FileInfo, error) {
+	fi, err := e.DirEntry.Info()
+	if err != nil || !fi.Mode().IsRegular() {
+		return fi, err
+	}
+	return e.r.Stat(e.path)
+}
@@ -0,0 +1,60 @@
+package wrfs_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/wrfstest"
+)
+
+func TestRedact(t *testing.T) {
+	lower := newLowerFS(t)
+	check(t, WriteFile(lower, "dir/app.env", []byte("TOKEN=secret\n"), 0644))
+	check(t, Symlink(lower, "app.env", "dir/link"))
+	fsys := Redact(lower, Redaction{
+		Pattern:   "*.env",
+		Transform: func(data []byte) []byte { return bytes.ReplaceAll(data, []byte("secret"), []byte("***")) },
+	})
+	checkContents(t, fsys, "dir/app.env", "TOKEN=***\n")
+	checkContents(t, fsys, "dir/link", "TOKEN=***\n")
+	checkContents(t, fsys, "dir/file", "lower")
+	if fi, err := Stat(fsys, "dir/app.env"); err != nil || fi.Size() != int64(len("TOKEN=***\n")) {
+		t.Errorf("Stat(dir/app.env) = %v, %v, want transformed size", fi, err)
+	}
+	if err := WriteFile(fsys, "dir/app.env", []byte("TOKEN=***\n"), 0644); !errors.Is(err, ErrPermission) {
+		t.Errorf("WriteFile of redacted file: got %v, want ErrPermission", err)
+	}
+	if err := Rename(fsys, "dir/app.env", "dir/app.txt"); !errors.Is(err, ErrPermission) {
+		t.Errorf("Rename of redacted file: got %v, want ErrPermission", err)
+	}
+	check(t, WriteFile(fsys, "dir/file", []byte("upper"), 0644))
+	checkContents(t, lower, "dir/file", "upper")
+	check(t, Remove(lower, "dir/link"))
+	check(t, fstest.TestFS(fsys, "dir/app.env", "dir/file", "dir/sub/file"))
+}
+
+func TestRedactOpenLock(t *testing.T) {
+	fsys := Redact(wrfstest.MapFS{"app.env": &wrfstest.MapFile{Data: []byte("SECRET=hunter2")}}, Redaction{
+		Pattern:   "*.env",
+		Transform: func(data []byte) []byte { return []byte("xxx") },
+	})
+	file, err := Lock(fsys, "app.env")
+	check(t, err)
+	data, err := io.ReadAll(file)
+	check(t, err)
+	if string(data) != "xxx" {
+		t.Errorf("reading a redacted file opened with OpenLock: got %q, want %q", data, "xxx")
+	}
+	if _, ok := file.(io.Writer); ok {
+		t.Error("redacted file opened with OpenLock can be written")
+	}
+	check(t, file.Unlock())
+	check(t, file.Close())
+	if _, err := OpenLock(fsys, "new.env"); !errors.Is(err, ErrPermission) {
+		t.Errorf("OpenLock of a missing redacted file: got %v, want ErrPermission", err)
+	}
+}
@@ -1,8 +1,6 @@
 package wrfs
 
-import (
-	"path"
-)
+import "context"
 
 // RemoveFS is a file system that supports the Remove function.
 type RemoveFS interface {
@@ -25,39 +23,16 @@ type RemoveAllFS interface {
 	FS
 
 	// RemoveAll removes path and any children it contains.
+	// If the path does not exist, RemoveAll returns nil (no error).
 	RemoveAll(path string) error
 }
 
 // RemoveAll removes path and any children it contains.
+// If the path does not exist, RemoveAll returns nil (no error).
 func RemoveAll(fsys FS, removePath string) error {
 	if fsys, ok := fsys.(RemoveAllFS); ok {
 		return fsys.RemoveAll(removePath)
 	}
 
-	fi, err := Stat(fsys, removePath)
-	if err != nil {
-		return err
-	}
-
-	// Check if we are removing a file or a directory.
-	if !fi.IsDir() {
-		return Remove(fsys, removePath)
-	}
-
-	files, err := ReadDir(fsys, removePath)
-	if err != nil {
-		return err
-	}
-
-	for _, fi := range files {
-		if fi.IsDir() {
-			if err = RemoveAll(fsys, path.Join(removePath, fi.Name())); err != nil {
-				return err
-			}
-		} else if err = Remove(fsys, path.Join(removePath, fi.Name())); err != nil {
-			return err
-		}
-	}
-
-	return Remove(fsys, removePath)
+	return removeAll(context.Background(), fsys, removePath)
 }
@@ -1,7 +1,5 @@
 package wrfs
 
-import "os"
-
 type RenameFS interface {
 	FS
 
@@ -16,5 +14,5 @@ func Rename(fsys FS, oldpath, newpath string) error {
 	if fsys, ok := fsys.(RenameFS); ok {
 		return fsys.Rename(oldpath, newpath)
 	}
-	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: ErrUnsupported}
+	return &LinkError{Op: "rename", Old: oldpath, New: newpath, Err: ErrUnsupported}
 }
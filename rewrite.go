@@ -0,0 +1,362 @@
+package wrfs
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A RewriteRule maps the path From of a file system returned by Rewrite, and the paths inside it, to the path To
+// of the underlying file system and the same paths inside it.
+type RewriteRule struct {
+	From string
+	To   string
+}
+
+// Rewrite returns a file system that rewrites paths with the first of the rules that applies to them before passing
+// them to fsys, such as for mapping "current" to "releases/v42" to present stable paths over a changing layout.
+// Paths that no rule applies to are passed unchanged. The names in results, such as the entries of directories
+// and the names in errors, events and relative symbolic link targets, are mapped back accordingly: a directory
+// lists the paths that rules map into it, and does not list the paths that rules map elsewhere.
+//
+// When several rules map to the same path, results name it by the path of the first rule. Rules whose From or To
+// is not a valid path are ignored.
+func Rewrite(fsys FS, rules ...RewriteRule) FS {
+	valid := make([]RewriteRule, 0, len(rules))
+	for _, rule := range rules {
+		if ValidPath(rule.From) && ValidPath(rule.To) {
+			valid = append(valid, rule)
+		}
+	}
+	return &rewriteFS{fsys, valid}
+}
+
+type rewriteFS struct {
+	fsys  FS
+	rules []RewriteRule
+}
+
+// cutDir returns the path of name relative to dir, if name is dir or inside it.
+func cutDir(name, dir string) (string, bool) {
+	switch {
+	case dir == ".":
+		return name, true
+	case name == dir:
+		return ".", true
+	case strings.HasPrefix(name, dir+"/"):
+		return name[len(dir)+1:], true
+	}
+	return "", false
+}
+
+// relPath returns the relative path from the directory dir to name, both relative to the root.
+func relPath(dir, name string) string {
+	var from, to []string
+	if dir != "." {
+		from = strings.Split(dir, "/")
+	}
+	if name != "." {
+		to = strings.Split(name, "/")
+	}
+	for len(from) > 0 && len(to) > 0 && from[0] == to[0] {
+		from, to = from[1:], to[1:]
+	}
+	elems := make([]string, 0, len(from)+len(to))
+	for range from {
+		elems = append(elems, "..")
+	}
+	return path.Join(append(elems, to...)...)
+}
+
+// forward maps a path of the rewriteFS to the path in the underlying file system.
+func (r *rewriteFS) forward(name string) string {
+	for _, rule := range r.rules {
+		if rest, ok := cutDir(name, rule.From); ok {
+			return path.Join(rule.To, rest)
+		}
+	}
+	return name
+}
+
+// reverse maps a path of the underlying file system back to the path of the rewriteFS.
+func (r *rewriteFS) reverse(name string) string {
+	for _, rule := range r.rules {
+		if rest, ok := cutDir(name, rule.To); ok {
+			if logical := path.Join(rule.From, rest); r.forward(logical) == name {
+				return logical
+			}
+		}
+	}
+	return name
+}
+
+// fixErr maps the names in errors back to paths of the rewriteFS.
+func (r *rewriteFS) fixErr(err error) error {
+	var pathErr *PathError
+	var linkErr *LinkError
+	switch {
+	case errors.As(err, &pathErr):
+		pathErr.Path = r.reverse(pathErr.Path)
+	case errors.As(err, &linkErr):
+		linkErr.Old = r.reverse(linkErr.Old)
+		linkErr.New = r.reverse(linkErr.New)
+	}
+	return err
+}
+
+// action performs fn with the rewritten name.
+func (r *rewriteFS) action(op, name string, fn func(fsys FS, name string) error) error {
+	if !ValidPath(name) {
+		return &PathError{Op: op, Path: name, Err: ErrInvalid}
+	}
+	return r.fixErr(fn(r.fsys, r.forward(name)))
+}
+
+func (r *rewriteFS) Capabilities() CapSet {
+	return Capabilities(r.fsys)
+}
+
+// rename gives fi the base name of name, if it differs.
+func rename(fi FileInfo, name string) FileInfo {
+	if base := path.Base(name); fi.Name() != base {
+		return &namedInfo{fi, base}
+	}
+	return fi
+}
+
+func (r *rewriteFS) Open(name string) (File, error) {
+	var file File
+	err := r.action("open", name, func(fsys FS, name string) (err error) {
+		file, err = fsys.Open(name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if path.Base(name) != path.Base(r.forward(name)) {
+		file = &namedFile{FileWrapper{file}, path.Base(name)}
+	}
+	if fi, err := file.Stat(); err != nil || !fi.IsDir() {
+		return file, nil
+	}
+	entries, err := r.ReadDir(name)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &overlayDir{File: file, entries: entries}, nil
+}
+
+func (r *rewriteFS) Stat(name string) (fi FileInfo, err error) {
+	err = r.action("stat", name, func(fsys FS, name string) (err error) {
+		fi, err = Stat(fsys, name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rename(fi, name), nil
+}
+
+func (r *rewriteFS) Lstat(name string) (fi FileInfo, err error) {
+	err = r.action("lstat", name, func(fsys FS, name string) (err error) {
+		fi, err = Lstat(fsys, name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rename(fi, name), nil
+}
+
+// ReadDir returns the entries of the named directory, sorted by filename, including the paths that rules map into
+// it and excluding those that rules map elsewhere.
+func (r *rewriteFS) ReadDir(name string) ([]DirEntry, error) {
+	var entries []DirEntry
+	err := r.action("readdir", name, func(fsys FS, name string) (err error) {
+		entries, err = ReadDir(fsys, name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	dir := r.forward(name)
+	merged := make(map[string]DirEntry)
+	for _, entry := range entries {
+		if r.forward(path.Join(name, entry.Name())) == path.Join(dir, entry.Name()) {
+			merged[entry.Name()] = entry
+		}
+	}
+	for _, rule := range r.rules {
+		if rule.From == "." || path.Dir(rule.From) != name {
+			continue
+		}
+		if fi, err := r.Lstat(rule.From); err == nil {
+			merged[fi.Name()] = fs.FileInfoToDirEntry(fi)
+		}
+	}
+	return sortedEntries(merged), nil
+}
+
+func (r *rewriteFS) OpenFile(name string, flag int, perm FileMode) (file File, err error) {
+	if flag&(O_WRONLY|O_RDWR|O_APPEND|O_CREATE|O_TRUNC) == 0 {
+		return r.Open(name)
+	}
+	err = r.action("open", name, func(fsys FS, name string) (err error) {
+		file, err = OpenFile(fsys, name, flag, perm)
+		return err
+	})
+	return file, err
+}
+
+// Readlink returns the target of the named link, with relative targets inside the file system rewritten to paths of
+// the rewriteFS.
+func (r *rewriteFS) Readlink(name string) (target string, err error) {
+	err = r.action("readlink", name, func(fsys FS, name string) (err error) {
+		target, err = Readlink(fsys, name)
+		return err
+	})
+	if err != nil || path.IsAbs(target) {
+		return target, err
+	}
+	resolved := path.Join(path.Dir(r.forward(name)), target)
+	if !ValidPath(resolved) {
+		return target, nil
+	}
+	return relPath(path.Dir(name), r.reverse(resolved)), nil
+}
+
+// Symlink creates newname as a symbolic link to oldname, with a relative oldname inside the file system rewritten
+// to the path in the underlying file system.
+func (r *rewriteFS) Symlink(oldname, newname string) error {
+	if !ValidPath(newname) {
+		return &LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrInvalid}
+	}
+	link := r.forward(newname)
+	if resolved := path.Join(path.Dir(newname), oldname); !path.IsAbs(oldname) && ValidPath(resolved) {
+		oldname = relPath(path.Dir(link), r.forward(resolved))
+	}
+	return r.fixErr(Symlink(r.fsys, oldname, link))
+}
+
+func (r *rewriteFS) Chmod(name string, mode FileMode) error {
+	return r.action("chmod", name, func(fsys FS, name string) error { return Chmod(fsys, name, mode) })
+}
+
+func (r *rewriteFS) Chown(name string, uid, gid int) error {
+	return r.action("chown", name, func(fsys FS, name string) error { return Chown(fsys, name, uid, gid) })
+}
+
+func (r *rewriteFS) Lchown(name string, uid, gid int) error {
+	return r.action("lchown", name, func(fsys FS, name string) error { return Lchown(fsys, name, uid, gid) })
+}
+
+func (r *rewriteFS) Chtimes(name string, atime, mtime time.Time) error {
+	return r.action("chtimes", name, func(fsys FS, name string) error { return Chtimes(fsys, name, atime, mtime) })
+}
+
+func (r *rewriteFS) Lchtimes(name string, atime, mtime time.Time) error {
+	return r.action("lchtimes", name, func(fsys FS, name string) error { return Lchtimes(fsys, name, atime, mtime) })
+}
+
+func (r *rewriteFS) Mkdir(name string, perm FileMode) error {
+	return r.action("mkdir", name, func(fsys FS, name string) error { return Mkdir(fsys, name, perm) })
+}
+
+func (r *rewriteFS) Mkfifo(name string, perm FileMode) error {
+	return r.action("mkfifo", name, func(fsys FS, name string) error { return Mkfifo(fsys, name, perm) })
+}
+
+func (r *rewriteFS) Mknod(name string, mode FileMode, dev uint64) error {
+	return r.action("mknod", name, func(fsys FS, name string) error { return Mknod(fsys, name, mode, dev) })
+}
+
+func (r *rewriteFS) Remove(name string) error {
+	return r.action("remove", name, Remove)
+}
+
+func (r *rewriteFS) RemoveAll(name string) error {
+	return r.action("removeall", name, RemoveAll)
+}
+
+func (r *rewriteFS) Truncate(name string, size int64) error {
+	return r.action("truncate", name, func(fsys FS, name string) error { return Truncate(fsys, name, size) })
+}
+
+func (r *rewriteFS) Sync(name string) error {
+	return r.action("sync", name, Sync)
+}
+
+func (r *rewriteFS) SyncDir(dir string) error {
+	return r.action("sync", dir, SyncDir)
+}
+
+func (r *rewriteFS) Statfs(name string) (info FSInfo, err error) {
+	err = r.action("statfs", name, func(fsys FS, name string) (err error) {
+		info, err = Statfs(fsys, name)
+		return err
+	})
+	return info, err
+}
+
+func (r *rewriteFS) OpenLock(name string) (file LockFile, err error) {
+	err = r.action("lock", name, func(fsys FS, name string) (err error) {
+		file, err = OpenLock(fsys, name)
+		return err
+	})
+	return file, err
+}
+
+func (r *rewriteFS) Rename(oldpath, newpath string) error {
+	if !ValidPath(oldpath) || !ValidPath(newpath) {
+		return &LinkError{Op: "rename", Old: oldpath, New: newpath, Err: ErrInvalid}
+	}
+	return r.fixErr(Rename(r.fsys, r.forward(oldpath), r.forward(newpath)))
+}
+
+func (r *rewriteFS) Link(oldname, newname string) error {
+	if !ValidPath(oldname) || !ValidPath(newname) {
+		return &LinkError{Op: "link", Old: oldname, New: newname, Err: ErrInvalid}
+	}
+	return r.fixErr(Link(r.fsys, r.forward(oldname), r.forward(newname)))
+}
+
+func (r *rewriteFS) SameFile(fi1, fi2 FileInfo) bool {
+	return SameFile(r.fsys, fi1, fi2)
+}
+
+// Watch watches the named file, reporting the names in events as paths of the rewriteFS.
+func (r *rewriteFS) Watch(name string, opts ...WatchOption) (<-chan Event, func(), error) {
+	var events <-chan Event
+	var stop func()
+	err := r.action("watch", name, func(fsys FS, name string) (err error) {
+		events, stop, err = Watch(fsys, name, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	out := make(chan Event)
+	done := make(chan struct{})
+	go func() {
+		defer close(out)
+		for event := range events {
+			event.Name = r.reverse(event.Name)
+			select {
+			case out <- event:
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return out, func() {
+		once.Do(func() {
+			stop()
+			close(done)
+		})
+	}, nil
+}
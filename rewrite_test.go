@@ -0,0 +1,50 @@
+package wrfs_test
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+)
+
+func TestRewrite(t *testing.T) {
+	lower := memfs.New()
+	check(t, MkdirAll(lower, "releases/v41", 0755))
+	check(t, MkdirAll(lower, "releases/v42/bin", 0755))
+	check(t, WriteFile(lower, "releases/v42/bin/app", []byte("v42"), 0755))
+	check(t, Symlink(lower, "bin/app", "releases/v42/app"))
+	fsys := Rewrite(lower, RewriteRule{From: "current", To: "releases/v42"})
+
+	checkContents(t, fsys, "current/bin/app", "v42")
+	fi, err := Stat(fsys, "current")
+	check(t, err)
+	if fi.Name() != "current" || !fi.IsDir() {
+		t.Errorf("Stat(current) = %v %v, want directory current", fi.Name(), fi.Mode())
+	}
+	entries, err := ReadDir(fsys, ".")
+	check(t, err)
+	if len(entries) != 2 || entries[0].Name() != "current" || entries[1].Name() != "releases" {
+		t.Errorf("ReadDir(.) = %v, want current and releases", entries)
+	}
+	entries, err = ReadDir(fsys, "releases")
+	check(t, err)
+	if len(entries) != 2 {
+		t.Errorf("ReadDir(releases) = %v, want v41 and v42", entries)
+	}
+	target, err := Readlink(fsys, "current/app")
+	check(t, err)
+	if target != "bin/app" {
+		t.Errorf("Readlink(current/app) = %q, want bin/app", target)
+	}
+	check(t, Remove(fsys, "current/app"))
+	check(t, WriteFile(fsys, "current/new", []byte("new"), 0644))
+	checkContents(t, lower, "releases/v42/new", "new")
+	if _, err := Stat(fsys, "current/missing"); err == nil || !strings.Contains(err.Error(), "current/missing") {
+		t.Errorf("Stat(current/missing): got %v, want error naming current/missing", err)
+	}
+	if err := fstest.TestFS(fsys, "current/bin/app", "current/new", "releases/v41"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,190 @@
+//go:build go1.25
+// +build go1.25
+
+package wrfs
+
+import (
+	"os"
+	"time"
+)
+
+// RootFS returns a file system for the tree of files of root, which all operations are confined to, as with the
+// methods of os.Root: paths, including the targets of symbolic links, that would resolve outside of root fail with
+// an error. Names must be valid paths as reported by ValidPath. The caller remains responsible for closing root
+// once the file system is no longer used.
+//
+// Unlike SecureDirFS, RootFS keeps referring to the same directory if it is renamed or replaced. RootFS requires
+// Go 1.25, which added the methods of os.Root for modifying files other than creating and removing them.
+func RootFS(root *os.Root) FS {
+	return &rootFS{root}
+}
+
+type rootFS struct {
+	root *os.Root
+}
+
+func (r *rootFS) Open(name string) (File, error) {
+	if !ValidPath(name) {
+		return nil, &PathError{Op: "open", Path: name, Err: ErrInvalid}
+	}
+	file, err := r.root.Open(name)
+	if err != nil {
+		return nil, err // nil fs.File
+	}
+	return file, nil
+}
+
+func (r *rootFS) OpenFile(name string, flag int, perm FileMode) (File, error) {
+	if !ValidPath(name) {
+		return nil, &PathError{Op: "open", Path: name, Err: ErrInvalid}
+	}
+	file, err := r.root.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (r *rootFS) Stat(name string) (FileInfo, error) {
+	if !ValidPath(name) {
+		return nil, &PathError{Op: "stat", Path: name, Err: ErrInvalid}
+	}
+	return r.root.Stat(name)
+}
+
+func (r *rootFS) Lstat(name string) (FileInfo, error) {
+	if !ValidPath(name) {
+		return nil, &PathError{Op: "lstat", Path: name, Err: ErrInvalid}
+	}
+	return r.root.Lstat(name)
+}
+
+func (r *rootFS) ReadFile(name string) ([]byte, error) {
+	if !ValidPath(name) {
+		return nil, &PathError{Op: "readfile", Path: name, Err: ErrInvalid}
+	}
+	return r.root.ReadFile(name)
+}
+
+func (r *rootFS) WriteFile(name string, data []byte, perm FileMode) error {
+	if !ValidPath(name) {
+		return &PathError{Op: "writefile", Path: name, Err: ErrInvalid}
+	}
+	return r.root.WriteFile(name, data, perm)
+}
+
+func (r *rootFS) Readlink(name string) (string, error) {
+	if !ValidPath(name) {
+		return "", &PathError{Op: "readlink", Path: name, Err: ErrInvalid}
+	}
+	return r.root.Readlink(name)
+}
+
+func (r *rootFS) Chmod(name string, mode FileMode) error {
+	if !ValidPath(name) {
+		return &PathError{Op: "chmod", Path: name, Err: ErrInvalid}
+	}
+	return r.root.Chmod(name, mode)
+}
+
+func (r *rootFS) Chown(name string, uid, gid int) error {
+	if !ValidPath(name) {
+		return &PathError{Op: "chown", Path: name, Err: ErrInvalid}
+	}
+	return r.root.Chown(name, uid, gid)
+}
+
+func (r *rootFS) Lchown(name string, uid, gid int) error {
+	if !ValidPath(name) {
+		return &PathError{Op: "lchown", Path: name, Err: ErrInvalid}
+	}
+	return r.root.Lchown(name, uid, gid)
+}
+
+func (r *rootFS) Chtimes(name string, atime, mtime time.Time) error {
+	if !ValidPath(name) {
+		return &PathError{Op: "chtimes", Path: name, Err: ErrInvalid}
+	}
+	return r.root.Chtimes(name, atime, mtime)
+}
+
+func (r *rootFS) Mkdir(name string, perm FileMode) error {
+	if !ValidPath(name) {
+		return &PathError{Op: "mkdir", Path: name, Err: ErrInvalid}
+	}
+	return r.root.Mkdir(name, perm)
+}
+
+func (r *rootFS) MkdirAll(path string, perm FileMode) error {
+	if !ValidPath(path) {
+		return &PathError{Op: "mkdir", Path: path, Err: ErrInvalid}
+	}
+	return r.root.MkdirAll(path, perm)
+}
+
+func (r *rootFS) Remove(name string) error {
+	if !ValidPath(name) {
+		return &PathError{Op: "remove", Path: name, Err: ErrInvalid}
+	}
+	return r.root.Remove(name)
+}
+
+func (r *rootFS) RemoveAll(path string) error {
+	if !ValidPath(path) {
+		return &PathError{Op: "removeall", Path: path, Err: ErrInvalid}
+	}
+	return r.root.RemoveAll(path)
+}
+
+func (r *rootFS) Rename(oldpath, newpath string) error {
+	if !ValidPath(oldpath) || !ValidPath(newpath) {
+		return &LinkError{Op: "rename", Old: oldpath, New: newpath, Err: ErrInvalid}
+	}
+	return r.root.Rename(oldpath, newpath)
+}
+
+func (r *rootFS) Symlink(oldname, newname string) error {
+	if !ValidPath(newname) {
+		return &LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrInvalid}
+	}
+	return r.root.Symlink(oldname, newname)
+}
+
+func (r *rootFS) Link(oldname, newname string) error {
+	if !ValidPath(oldname) || !ValidPath(newname) {
+		return &LinkError{Op: "link", Old: oldname, New: newname, Err: ErrInvalid}
+	}
+	return r.root.Link(oldname, newname)
+}
+
+func (r *rootFS) SameFile(fi1, fi2 FileInfo) bool {
+	return os.SameFile(fi1, fi2)
+}
+
+// Truncate changes the size of the named file, which os.Root has no method for, through an open file.
+func (r *rootFS) Truncate(name string, size int64) error {
+	if !ValidPath(name) {
+		return &PathError{Op: "truncate", Path: name, Err: ErrInvalid}
+	}
+	file, err := r.root.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// rootFS implements LockFS, since the files it returns from Open and OpenFile are plain *os.Files.
+func (r *rootFS) OpenLock(name string) (LockFile, error) {
+	if !ValidPath(name) {
+		return nil, &PathError{Op: "lock", Path: name, Err: ErrInvalid}
+	}
+	file, err := r.root.OpenFile(name, os.O_RDONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &lockFile{file}, nil
+}
@@ -0,0 +1,39 @@
+//go:build go1.25
+// +build go1.25
+
+package wrfs_test
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestRootFS(t *testing.T) {
+	outside := t.TempDir()
+	root, err := os.OpenRoot(t.TempDir())
+	check(t, err)
+	defer root.Close()
+	fsys := RootFS(root)
+
+	check(t, MkdirAll(fsys, "dir/sub", 0755))
+	check(t, WriteFile(fsys, "dir/sub/file", []byte("data"), 0644))
+	check(t, Truncate(fsys, "dir/sub/file", 2))
+	check(t, Rename(fsys, "dir/sub/file", "dir/file"))
+	check(t, Symlink(fsys, "file", "dir/link"))
+	data, err := ReadFile(fsys, "dir/link")
+	check(t, err)
+	if string(data) != "da" {
+		t.Errorf("ReadFile(dir/link) = %q, want %q", data, "da")
+	}
+	check(t, Remove(fsys, "dir/link"))
+	check(t, fstest.TestFS(fsys, "dir/file", "dir/sub"))
+
+	check(t, Symlink(fsys, outside, "escape"))
+	if err := WriteFile(fsys, "escape/file", nil, 0644); err == nil {
+		t.Error("WriteFile through link outside the root succeeded")
+	}
+	check(t, RemoveAll(fsys, "dir"))
+}
@@ -0,0 +1,47 @@
+package wrfs
+
+import "strings"
+
+// Route returns a file system that dispatches every operation to the file system of the longest path prefix in
+// routes that matches the operation's path, such as for serving "static" from an embed.FS and "uploads" from a
+// writable DirFS as one file system. The route "." serves the paths that match no other route; without it, such
+// paths do not exist, except for the directories leading to the routes. Trailing slashes in prefixes are ignored.
+//
+// A route is made read-only by routing to ReadOnly of its file system:
+//
+//	fsys, err := wrfs.Route(map[string]wrfs.FS{
+//		"static":  wrfs.ReadOnly(staticFS),
+//		"uploads": wrfs.DirFS("/srv/uploads"),
+//	})
+//
+// The returned file system is a MountFS with the routes mounted on their prefixes, and thus behaves as described
+// for MountFS. Route fails with an error matching ErrInvalid if a prefix is not a valid path.
+func Route(routes map[string]FS) (*MountFS, error) {
+	root, ok := routes["."]
+	if !ok {
+		root, ok = routes[""]
+	}
+	if !ok {
+		root = emptyFS{}
+	}
+	m := NewMountFS(root)
+	for prefix, fsys := range routes {
+		if prefix == "." || prefix == "" {
+			continue
+		}
+		if err := m.Mount(strings.TrimRight(prefix, "/"), fsys); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// emptyFS is a file system with nothing but an empty root directory.
+type emptyFS struct{}
+
+func (emptyFS) Open(name string) (File, error) {
+	if name != "." {
+		return nil, &PathError{Op: "open", Path: name, Err: ErrNotExist}
+	}
+	return &mountDir{info: mountDirInfo(".")}, nil
+}
@@ -0,0 +1,28 @@
+package wrfs_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+)
+
+func TestRoute(t *testing.T) {
+	static, uploads := newLowerFS(t), memfs.New()
+	fsys, err := Route(map[string]FS{"static/": ReadOnly(static), "uploads": uploads})
+	check(t, err)
+	checkContents(t, fsys, "static/dir/file", "lower")
+	check(t, WriteFile(fsys, "uploads/file", []byte("upload"), 0644))
+	checkContents(t, uploads, "file", "upload")
+	if err := WriteFile(fsys, "static/dir/file", nil, 0644); !errors.Is(err, ErrPermission) {
+		t.Errorf("WriteFile in read-only route: got %v, want ErrPermission", err)
+	}
+	if _, err := Stat(fsys, "other"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat of unrouted path: got %v, want ErrNotExist", err)
+	}
+	if err := fstest.TestFS(fsys, "static/dir/file", "uploads/file"); err != nil {
+		t.Error(err)
+	}
+}
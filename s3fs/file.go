@@ -0,0 +1,352 @@
+package s3fs
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/relab/wrfs"
+)
+
+// dir is an open directory, listed when first read.
+type dir struct {
+	fsys    *FS
+	name    string
+	info    *fileInfo
+	entries []wrfs.DirEntry
+	listed  bool
+}
+
+func (d *dir) Stat() (wrfs.FileInfo, error) { return d.info, nil }
+func (d *dir) Close() error                 { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &wrfs.PathError{Op: "read", Path: d.name, Err: syscall.EISDIR}
+}
+
+func (d *dir) ReadDir(n int) ([]wrfs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.listed = entries, true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// reader is an object opened for reading, which is downloaded as it is read.
+type reader struct {
+	fsys *FS
+	name string
+	info *fileInfo
+	off  int64
+	body io.ReadCloser // the contents from off, or nil if not requested yet
+}
+
+func (r *reader) Stat() (wrfs.FileInfo, error) { return r.info, nil }
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.body == nil {
+		if r.off >= r.info.size {
+			return 0, io.EOF
+		}
+		body, err := r.get(r.off, r.info.size-1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.off += int64(n)
+	return n, err
+}
+
+// get requests the contents of the object from off up to end, inclusive.
+func (r *reader) get(off, end int64) (io.ReadCloser, error) {
+	header := http.Header{"Range": {"bytes=" + strconv.FormatInt(off, 10) + "-" + strconv.FormatInt(end, 10)}}
+	resp, err := r.fsys.do(http.MethodGet, key(r.name), nil, header, nil, http.StatusPartialContent, http.StatusOK)
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "read", Path: r.name, Err: err}
+	}
+	if resp.StatusCode == http.StatusOK && off > 0 {
+		// The server ignored the range.
+		if _, err := io.CopyN(io.Discard, resp.Body, off); err != nil {
+			resp.Body.Close()
+			return nil, &wrfs.PathError{Op: "read", Path: r.name, Err: err}
+		}
+	}
+	return resp.Body, nil
+}
+
+func (r *reader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.info.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	body, err := r.get(off, min(off+int64(len(p)), r.info.size)-1)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	n, err := io.ReadFull(body, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r *reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.info.size
+	}
+	if offset < 0 {
+		return 0, &wrfs.PathError{Op: "seek", Path: r.name, Err: wrfs.ErrInvalid}
+	}
+	if offset != r.off && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.off = offset
+	return offset, nil
+}
+
+func (r *reader) Close() error {
+	if r.body != nil {
+		return r.body.Close()
+	}
+	return nil
+}
+
+// writer is an object opened for writing. Its contents are buffered, and uploaded with PUT when it is closed, or in
+// parts of a multipart upload once they exceed the part size.
+type writer struct {
+	fsys     *FS
+	name     string
+	buf      []byte
+	size     int64
+	uploadID string   // the ID of the multipart upload, if started
+	etags    []string // the ETags of the uploaded parts
+	copied   bool     // whether the object was copied by the server, and must not be uploaded
+	closed   bool
+	err      error // the error that aborted the multipart upload
+}
+
+func (w *writer) Stat() (wrfs.FileInfo, error) {
+	return &fileInfo{name: path.Base(w.name), size: w.size, modTime: time.Now()}, nil
+}
+
+func (w *writer) Read([]byte) (int, error) {
+	return 0, &wrfs.PathError{Op: "read", Path: w.name, Err: wrfs.ErrPermission}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, &wrfs.PathError{Op: "write", Path: w.name, Err: wrfs.ErrClosed}
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.copied {
+		// The object cannot be appended to once copied.
+		return 0, &wrfs.PathError{Op: "write", Path: w.name, Err: wrfs.ErrUnsupported}
+	}
+	n := len(p)
+	for len(w.buf)+len(p) >= w.fsys.partSize {
+		k := w.fsys.partSize - len(w.buf)
+		w.buf = append(w.buf, p[:k]...)
+		p = p[k:]
+		if err := w.uploadPart(); err != nil {
+			w.err = &wrfs.PathError{Op: "write", Path: w.name, Err: err}
+			return 0, w.err
+		}
+	}
+	w.buf = append(w.buf, p...)
+	w.size += int64(n)
+	return n, nil
+}
+
+// startUpload starts the multipart upload, unless it is started.
+func (w *writer) startUpload() error {
+	if w.uploadID != "" {
+		return nil
+	}
+	resp, err := w.fsys.do(http.MethodPost, w.name, url.Values{"uploads": {""}}, nil, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := decode(resp, &result); err != nil {
+		return err
+	}
+	w.uploadID = result.UploadID
+	return nil
+}
+
+// uploadPart uploads the buffer as the next part of the multipart upload, starting it if needed.
+func (w *writer) uploadPart() error {
+	if err := w.startUpload(); err != nil {
+		return err
+	}
+	query := url.Values{"partNumber": {strconv.Itoa(len(w.etags) + 1)}, "uploadId": {w.uploadID}}
+	resp, err := w.fsys.do(http.MethodPut, w.name, query, nil, w.buf, http.StatusOK)
+	if err != nil {
+		w.abort()
+		return err
+	}
+	resp.Body.Close()
+	w.etags = append(w.etags, resp.Header.Get("ETag"))
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// complete uploads the rest of the buffer as the last part and completes the multipart upload.
+func (w *writer) complete() error {
+	if len(w.buf) > 0 {
+		if err := w.uploadPart(); err != nil {
+			return err
+		}
+	}
+	type part struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	req := struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}{}
+	for i, etag := range w.etags {
+		req.Parts = append(req.Parts, part{i + 1, etag})
+	}
+	body, err := xml.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := w.fsys.do(http.MethodPost, w.name, url.Values{"uploadId": {w.uploadID}},
+		http.Header{"Content-Type": {"application/xml"}}, body, http.StatusOK)
+	if err == nil {
+		err = decode(resp, &struct{}{})
+	}
+	if err != nil {
+		w.abort()
+	}
+	return err
+}
+
+// abort aborts the multipart upload, discarding the uploaded parts.
+func (w *writer) abort() {
+	resp, err := w.fsys.do(http.MethodDelete, w.name, url.Values{"uploadId": {w.uploadID}}, nil, nil,
+		http.StatusNoContent, http.StatusOK)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+// maxCopySize is the largest object that S3 copies with a single request. Larger objects are copied in parts of
+// copyPartSize bytes.
+const (
+	maxCopySize  = 5 << 30
+	copyPartSize = 1 << 30
+)
+
+// CloneFrom makes the server copy the object src was opened from, which must be in a bucket of the same endpoint,
+// as the object of the file, without downloading it. The file must not have been written to.
+func (w *writer) CloneFrom(src wrfs.File) error {
+	if w.closed {
+		return &wrfs.PathError{Op: "clone", Path: w.name, Err: wrfs.ErrClosed}
+	}
+	r, ok := src.(*reader)
+	if !ok || *r.fsys.endpoint != *w.fsys.endpoint || w.size > 0 || w.copied || w.err != nil {
+		return &wrfs.PathError{Op: "clone", Path: w.name, Err: wrfs.ErrUnsupported}
+	}
+	source := escape("/"+r.fsys.bucket+"/"+key(r.name), true)
+	if err := w.copy(source, r.info.size); err != nil {
+		w.err = &wrfs.PathError{Op: "clone", Path: w.name, Err: err}
+		return w.err
+	}
+	w.size, w.copied = r.info.size, true
+	return nil
+}
+
+// copy copies the object at source, of the given size, with CopyObject, or in parts of a multipart upload with
+// UploadPartCopy if it is too large.
+func (w *writer) copy(source string, size int64) error {
+	if size <= maxCopySize {
+		resp, err := w.fsys.do(http.MethodPut, w.name, nil, http.Header{"X-Amz-Copy-Source": {source}}, nil,
+			http.StatusOK)
+		if err != nil {
+			return err
+		}
+		return decode(resp, &struct{}{})
+	}
+	if err := w.startUpload(); err != nil {
+		return err
+	}
+	for off := int64(0); off < size; off += copyPartSize {
+		query := url.Values{"partNumber": {strconv.Itoa(len(w.etags) + 1)}, "uploadId": {w.uploadID}}
+		end := min(off+copyPartSize, size) - 1
+		header := http.Header{
+			"X-Amz-Copy-Source":       {source},
+			"X-Amz-Copy-Source-Range": {"bytes=" + strconv.FormatInt(off, 10) + "-" + strconv.FormatInt(end, 10)},
+		}
+		resp, err := w.fsys.do(http.MethodPut, w.name, query, header, nil, http.StatusOK)
+		if err != nil {
+			w.abort()
+			return err
+		}
+		var result struct {
+			ETag string `xml:"ETag"`
+		}
+		if err := decode(resp, &result); err != nil {
+			w.abort()
+			return err
+		}
+		w.etags = append(w.etags, result.ETag)
+	}
+	return nil
+}
+
+// Close uploads the contents of the file, replacing the object.
+func (w *writer) Close() error {
+	if w.closed {
+		return &wrfs.PathError{Op: "close", Path: w.name, Err: wrfs.ErrClosed}
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	var err error
+	switch {
+	case w.uploadID != "":
+		err = w.complete()
+	case !w.copied:
+		err = w.fsys.put(w.name, w.buf)
+	}
+	if err != nil {
+		return &wrfs.PathError{Op: "close", Path: w.name, Err: err}
+	}
+	return nil
+}
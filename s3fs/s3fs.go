@@ -0,0 +1,547 @@
+// Package s3fs accesses buckets of S3-compatible object stores, such as Amazon S3, MinIO and Ceph, as wrfs file
+// systems.
+package s3fs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// An Option configures a file system returned by New.
+type Option func(*FS)
+
+// Client sets the HTTP client used to send requests, instead of http.DefaultClient.
+func Client(c *http.Client) Option {
+	return func(fsys *FS) { fsys.client = c }
+}
+
+// Credentials makes the file system sign its requests with the given access key, instead of sending them
+// anonymously. The session token is needed for temporary credentials, and is empty otherwise.
+func Credentials(accessKey, secretKey, sessionToken string) Option {
+	return func(fsys *FS) { fsys.accessKey, fsys.secretKey, fsys.token = accessKey, secretKey, sessionToken }
+}
+
+// Region sets the region that requests are signed for, instead of "us-east-1".
+func Region(region string) Option {
+	return func(fsys *FS) { fsys.region = region }
+}
+
+// VirtualHosted makes the file system address the bucket as a subdomain of the endpoint, as in
+// "https://bucket.s3.amazonaws.com/key", instead of as the first element of the path, as in
+// "https://s3.amazonaws.com/bucket/key".
+func VirtualHosted() Option {
+	return func(fsys *FS) { fsys.virtualHosted = true }
+}
+
+// PartSize sets the size of the parts of multipart uploads, instead of 16 MiB. Sizes below the 5 MiB minimum of S3
+// are raised to it.
+func PartSize(size int) Option {
+	return func(fsys *FS) { fsys.partSize = max(size, minPartSize) }
+}
+
+const minPartSize = 5 << 20
+
+// FS is a file system accessing a bucket of an S3-compatible object store.
+type FS struct {
+	endpoint                    *url.URL
+	bucket                      string
+	client                      *http.Client
+	accessKey, secretKey, token string
+	region                      string
+	virtualHosted               bool
+	partSize                    int
+}
+
+// New returns a file system for the bucket at the endpoint, such as "https://s3.amazonaws.com" or
+// "http://localhost:9000". The names of files are the keys of objects, and directories are synthesized from the
+// prefixes of keys up to a slash: a directory exists if any key starts with its name and a slash. Mkdir creates an
+// empty object with such a key as a marker, so that empty directories can exist, as the S3 console does.
+//
+// Files are statted with HEAD and read with ranged GET requests, and directories are listed with ListObjectsV2.
+// Objects cannot be modified, only replaced, so files can only be opened for writing if they are truncated, and are
+// written sequentially: they are buffered and uploaded with PUT when closed, or with a multipart upload once they
+// reach the part size. Files opened for writing implement wrfs.CloneFile, so that wrfs.CopyFile and wrfs.CopyFS
+// copy objects within an endpoint with CopyObject, without downloading them. Remove and RemoveAll delete objects
+// with DeleteObjects, in batches of up to 1000 keys.
+//
+// Objects have no permission bits, so directories are reported with mode 0755, files with mode 0644, and the
+// permission bits passed to OpenFile and Mkdir are ignored.
+func New(endpoint, bucket string, opts ...Option) (*FS, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("s3fs: URL scheme must be http or https: " + endpoint)
+	}
+	if bucket == "" || strings.Contains(bucket, "/") {
+		return nil, errors.New("s3fs: invalid bucket name: " + bucket)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath, u.RawQuery = "", ""
+	fsys := &FS{endpoint: u, bucket: bucket, client: http.DefaultClient, region: "us-east-1", partSize: 16 << 20}
+	for _, opt := range opts {
+		opt(fsys)
+	}
+	return fsys, nil
+}
+
+// key returns the key of the object for name.
+func key(name string) string {
+	if name == "." {
+		return ""
+	}
+	return name
+}
+
+// dirKey returns the prefix of the keys of the objects in the named directory.
+func dirKey(name string) string {
+	if name == "." {
+		return ""
+	}
+	return name + "/"
+}
+
+// do sends a request for the object with the given key, returning the response if its status is one of the given
+// ones, and otherwise an error describing the status.
+func (fsys *FS) do(method, key string, query url.Values, header http.Header, body []byte, statuses ...int) (*http.Response, error) {
+	u := *fsys.endpoint
+	if fsys.virtualHosted {
+		u.Host = fsys.bucket + "." + u.Host
+		u.Path += "/" + key
+	} else {
+		u.Path += "/" + fsys.bucket + "/" + key
+	}
+	u.RawPath = escape(u.Path, true)
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if fsys.accessKey != "" {
+		fsys.sign(req, hashHex(body), time.Now())
+	}
+	resp, err := fsys.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range statuses {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+	return nil, statusErr(resp)
+}
+
+// errorResponse is the body of a response reporting an error.
+type errorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func (e *errorResponse) Error() string {
+	return "s3fs: " + e.Code + ": " + e.Message
+}
+
+// statusErr returns an error for the unexpected status of resp.
+func statusErr(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return wrfs.ErrNotExist
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return wrfs.ErrPermission
+	case http.StatusPreconditionFailed:
+		return wrfs.ErrExist
+	case http.StatusNotImplemented:
+		return wrfs.ErrUnsupported
+	}
+	var e errorResponse
+	if xml.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&e) == nil && e.Code != "" {
+		return &e
+	}
+	return errors.New("s3fs: unexpected status " + resp.Status)
+}
+
+// decode decodes the XML body of resp into v, and closes it. S3 reports some errors with the status 200 OK, so
+// decode returns those instead.
+func decode(resp *http.Response, v any) error {
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var e errorResponse
+	if xml.Unmarshal(data, &e) == nil {
+		return &e
+	}
+	return xml.Unmarshal(data, v)
+}
+
+// listResult is the body of a response to ListObjectsV2.
+type listResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// list lists the keys starting with prefix, calling fn with each page of results. With a delimiter, keys containing
+// it after the prefix are grouped into common prefixes. At most maxKeys keys are listed if it is positive.
+func (fsys *FS) list(prefix, delimiter string, maxKeys int, fn func(*listResult) error) error {
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	if delimiter != "" {
+		query.Set("delimiter", delimiter)
+	}
+	if maxKeys > 0 {
+		query.Set("max-keys", strconv.Itoa(maxKeys))
+	}
+	for {
+		resp, err := fsys.do(http.MethodGet, "", query, nil, nil, http.StatusOK)
+		if err != nil {
+			return err
+		}
+		var result listResult
+		if err := decode(resp, &result); err != nil {
+			return err
+		}
+		if err := fn(&result); err != nil {
+			return err
+		}
+		if !result.IsTruncated || maxKeys > 0 {
+			return nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+// head returns the information on the object for name, which is a file.
+func (fsys *FS) head(name string) (*fileInfo, error) {
+	resp, err := fsys.do(http.MethodHead, key(name), nil, nil, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &fileInfo{name: path.Base(name), size: resp.ContentLength, modTime: modTime}, nil
+}
+
+// stat returns the information on name, which is a directory if there is no object with its key but some with
+// its name as a prefix. Directories have no modification time, as listings do not report those of their markers.
+func (fsys *FS) stat(name string) (*fileInfo, error) {
+	if name == "." {
+		return &fileInfo{name: ".", dir: true}, nil
+	}
+	fi, err := fsys.head(name)
+	if !errors.Is(err, wrfs.ErrNotExist) {
+		return fi, err
+	}
+	err = fsys.list(dirKey(name), "", 1, func(r *listResult) error {
+		if len(r.Contents) == 0 {
+			return wrfs.ErrNotExist
+		}
+		fi = &fileInfo{name: path.Base(name), dir: true}
+		return nil
+	})
+	return fi, err
+}
+
+func (fsys *FS) Stat(name string) (wrfs.FileInfo, error) {
+	if !wrfs.ValidPath(name) {
+		return nil, &wrfs.PathError{Op: "stat", Path: name, Err: wrfs.ErrInvalid}
+	}
+	fi, err := fsys.stat(name)
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return fi, nil
+}
+
+func (fsys *FS) ReadDir(name string) ([]wrfs.DirEntry, error) {
+	if !wrfs.ValidPath(name) {
+		return nil, &wrfs.PathError{Op: "readdir", Path: name, Err: wrfs.ErrInvalid}
+	}
+	entries, err := fsys.readDir(name)
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+func (fsys *FS) readDir(name string) ([]wrfs.DirEntry, error) {
+	prefix := dirKey(name)
+	var entries []wrfs.DirEntry
+	found := name == "."
+	err := fsys.list(prefix, "/", 0, func(r *listResult) error {
+		for _, p := range r.CommonPrefixes {
+			found = true
+			if elem := strings.TrimSuffix(p.Prefix[len(prefix):], "/"); validElem(elem) {
+				entries = append(entries, &fileInfo{name: elem, dir: true})
+			}
+		}
+		for _, c := range r.Contents {
+			found = true
+			if elem := c.Key[len(prefix):]; validElem(elem) {
+				entries = append(entries, &fileInfo{name: elem, size: c.Size, modTime: c.LastModified})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		if _, err := fsys.head(name); err != nil {
+			return nil, err
+		}
+		return nil, syscall.ENOTDIR
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// validElem reports whether elem can be the name of a file in a directory. Keys with empty, "." or ".." elements
+// cannot be accessed as files, and are left out of listings.
+func validElem(elem string) bool {
+	return elem != "" && elem != "." && elem != ".." && !strings.Contains(elem, "/")
+}
+
+func (fsys *FS) Open(name string) (wrfs.File, error) {
+	if !wrfs.ValidPath(name) {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrInvalid}
+	}
+	fi, err := fsys.stat(name)
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if fi.dir {
+		return &dir{fsys: fsys, name: name, info: fi}, nil
+	}
+	return &reader{fsys: fsys, name: name, info: fi}, nil
+}
+
+// OpenFile opens the named file. Files can only be opened for writing write-only with O_TRUNC, or if they are
+// empty or being created, as objects can only be replaced; other write flags fail with ErrUnsupported. The object
+// is created or replaced when the file is closed.
+func (fsys *FS) OpenFile(name string, flag int, perm wrfs.FileMode) (wrfs.File, error) {
+	write := flag&(wrfs.O_WRONLY|wrfs.O_RDWR) != 0
+	if !write && flag&wrfs.O_CREATE == 0 {
+		return fsys.Open(name)
+	}
+	if !wrfs.ValidPath(name) || name == "." {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrInvalid}
+	}
+	if flag&(wrfs.O_RDWR|wrfs.O_APPEND) != 0 {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrUnsupported}
+	}
+	fi, err := fsys.stat(name)
+	switch {
+	case err == nil && flag&(wrfs.O_CREATE|wrfs.O_EXCL) == wrfs.O_CREATE|wrfs.O_EXCL:
+		err = wrfs.ErrExist
+	case err == nil && fi.dir && write:
+		err = syscall.EISDIR
+	case err == nil && write && flag&wrfs.O_TRUNC == 0 && fi.size > 0:
+		err = wrfs.ErrUnsupported
+	case errors.Is(err, wrfs.ErrNotExist) && flag&wrfs.O_CREATE != 0:
+		err = fsys.checkParent(name)
+		if err == nil && !write {
+			err = fsys.put(name, nil)
+		}
+	}
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if !write {
+		return fsys.Open(name)
+	}
+	return &writer{fsys: fsys, name: name, buf: make([]byte, 0, min(fsys.partSize, 64<<10))}, nil
+}
+
+// checkParent returns an error unless the parent directory of name exists, as S3 creates objects regardless.
+func (fsys *FS) checkParent(name string) error {
+	fi, err := fsys.stat(path.Dir(name))
+	if err == nil && !fi.dir {
+		err = syscall.ENOTDIR
+	}
+	return err
+}
+
+// put uploads data as the object with the given key.
+func (fsys *FS) put(key string, data []byte) error {
+	resp, err := fsys.do(http.MethodPut, key, nil, nil, data, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (fsys *FS) Mkdir(name string, perm wrfs.FileMode) error {
+	if !wrfs.ValidPath(name) {
+		return &wrfs.PathError{Op: "mkdir", Path: name, Err: wrfs.ErrInvalid}
+	}
+	_, err := fsys.stat(name)
+	switch {
+	case err == nil:
+		err = wrfs.ErrExist
+	case errors.Is(err, wrfs.ErrNotExist):
+		if err = fsys.checkParent(name); err == nil {
+			err = fsys.put(dirKey(name), nil)
+		}
+	}
+	if err != nil {
+		return &wrfs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (fsys *FS) Remove(name string) error {
+	if !wrfs.ValidPath(name) || name == "." {
+		return &wrfs.PathError{Op: "remove", Path: name, Err: wrfs.ErrInvalid}
+	}
+	if err := fsys.remove(name); err != nil {
+		return &wrfs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (fsys *FS) remove(name string) error {
+	key := name
+	if _, err := fsys.head(name); errors.Is(err, wrfs.ErrNotExist) {
+		key = dirKey(name)
+		err = fsys.list(key, "", 2, func(r *listResult) error {
+			switch {
+			case len(r.Contents) == 0:
+				return wrfs.ErrNotExist
+			case len(r.Contents) > 1 || r.Contents[0].Key != key:
+				return errno.ENOTEMPTY
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	resp, err := fsys.do(http.MethodDelete, key, nil, nil, nil, http.StatusNoContent, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// RemoveAll removes the object for name and all objects with its name as a prefix, up to a slash.
+func (fsys *FS) RemoveAll(name string) error {
+	if !wrfs.ValidPath(name) {
+		return &wrfs.PathError{Op: "removeall", Path: name, Err: wrfs.ErrInvalid}
+	}
+	var keys []string
+	if name != "." {
+		keys = append(keys, name)
+	}
+	err := fsys.list(dirKey(name), "", 0, func(r *listResult) error {
+		for _, c := range r.Contents {
+			keys = append(keys, c.Key)
+		}
+		return nil
+	})
+	for len(keys) > 0 && err == nil {
+		n := min(len(keys), 1000)
+		err = fsys.deleteObjects(keys[:n])
+		keys = keys[n:]
+	}
+	if err != nil {
+		return &wrfs.PathError{Op: "removeall", Path: name, Err: err}
+	}
+	return nil
+}
+
+// deleteObjects deletes the objects with the given keys with a single DeleteObjects request. Keys without objects
+// are ignored.
+func (fsys *FS) deleteObjects(keys []string) error {
+	type object struct {
+		Key string `xml:"Key"`
+	}
+	req := struct {
+		XMLName xml.Name `xml:"Delete"`
+		Quiet   bool     `xml:"Quiet"`
+		Objects []object `xml:"Object"`
+	}{Quiet: true}
+	for _, key := range keys {
+		req.Objects = append(req.Objects, object{key})
+	}
+	body, err := xml.Marshal(req)
+	if err != nil {
+		return err
+	}
+	sum := md5.Sum(body)
+	header := http.Header{"Content-Md5": {base64.StdEncoding.EncodeToString(sum[:])},
+		"Content-Type": {"application/xml"}}
+	resp, err := fsys.do(http.MethodPost, "", url.Values{"delete": {""}}, header, body, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Errors []struct {
+			Key     string `xml:"Key"`
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		} `xml:"Error"`
+	}
+	if err := decode(resp, &result); err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		e := result.Errors[0]
+		return errors.New("s3fs: deleting " + e.Key + ": " + e.Code + ": " + e.Message)
+	}
+	return nil
+}
+
+// fileInfo describes an object, or a directory synthesized from the prefixes of keys.
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (fi *fileInfo) Name() string                 { return fi.name }
+func (fi *fileInfo) Size() int64                  { return fi.size }
+func (fi *fileInfo) ModTime() time.Time           { return fi.modTime }
+func (fi *fileInfo) IsDir() bool                  { return fi.dir }
+func (fi *fileInfo) Sys() any                     { return nil }
+func (fi *fileInfo) Type() wrfs.FileMode          { return fi.Mode().Type() }
+func (fi *fileInfo) Info() (wrfs.FileInfo, error) { return fi, nil }
+
+func (fi *fileInfo) Mode() wrfs.FileMode {
+	if fi.dir {
+		return wrfs.ModeDir | 0755
+	}
+	return 0644
+}
@@ -0,0 +1,216 @@
+package s3fs_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/s3fs"
+	"github.com/relab/wrfs/wrfstest"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeS3 is an in-memory S3 server with one bucket, implementing just the requests that s3fs sends.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	parts   int // the number of parts uploaded
+	copies  int // the number of objects copied
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/bucket/")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	q := r.URL.Query()
+	switch {
+	case key == "" && q.Get("list-type") == "2":
+		s.list(w, q)
+	case key == "" && q.Has("delete"):
+		var req struct {
+			Objects []struct {
+				Key string `xml:"Key"`
+			} `xml:"Object"`
+		}
+		xml.Unmarshal(body, &req)
+		for _, o := range req.Objects {
+			delete(s.objects, o.Key)
+		}
+		io.WriteString(w, "<DeleteResult></DeleteResult>")
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		id := strconv.Itoa(len(s.uploads) + 1)
+		s.uploads[id] = make(map[int][]byte)
+		io.WriteString(w, "<InitiateMultipartUploadResult><UploadId>"+id+"</UploadId></InitiateMultipartUploadResult>")
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		s.uploads[q.Get("uploadId")][n] = body
+		s.parts++
+		w.Header().Set("ETag", `"`+strconv.Itoa(n)+`"`)
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		var req struct {
+			Parts []struct {
+				PartNumber int `xml:"PartNumber"`
+			} `xml:"Part"`
+		}
+		xml.Unmarshal(body, &req)
+		var data []byte
+		for _, p := range req.Parts {
+			data = append(data, s.uploads[q.Get("uploadId")][p.PartNumber]...)
+		}
+		s.objects[key] = data
+		io.WriteString(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		source, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		data, ok := s.objects[strings.TrimPrefix(source, "/bucket/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.objects[key] = data
+		s.copies++
+		io.WriteString(w, "<CopyObjectResult><ETag>\"1\"</ETag></CopyObjectResult>")
+	case r.Method == http.MethodPut:
+		s.objects[key] = body
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		data, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, key, time.Unix(1e9, 0), bytes.NewReader(data))
+	}
+}
+
+func (s *fakeS3) list(w http.ResponseWriter, q map[string][]string) {
+	prefix, delim := first(q["prefix"]), first(q["delimiter"])
+	maxKeys, err := strconv.Atoi(first(q["max-keys"]))
+	if err != nil {
+		maxKeys = 2 // small, to exercise pagination
+	}
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(`<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">`)
+	// group returns the common prefix that key is listed under, or key itself.
+	group := func(key string) (string, bool) {
+		if i := strings.Index(key[len(prefix):], delim); delim != "" && i >= 0 {
+			return key[:len(prefix)+i+1], true
+		}
+		return key, false
+	}
+	token := first(q["continuation-token"])
+	var last string
+	n := 0
+	var tokenGroup string
+	if token != "" {
+		tokenGroup, _ = group(token)
+	}
+	for _, key := range keys {
+		g, isPrefix := group(key)
+		if token != "" && (key <= token || g == tokenGroup) || g == last {
+			continue
+		}
+		if n == maxKeys {
+			b.WriteString("<IsTruncated>true</IsTruncated><NextContinuationToken>" + last + "</NextContinuationToken>")
+			break
+		}
+		if last = g; isPrefix {
+			b.WriteString("<CommonPrefixes><Prefix>" + last + "</Prefix></CommonPrefixes>")
+		} else {
+			b.WriteString("<Contents><Key>" + key + "</Key><Size>" + strconv.Itoa(len(s.objects[key])) +
+				"</Size><LastModified>2001-09-09T01:46:40.000Z</LastModified></Contents>")
+		}
+		n++
+	}
+	b.WriteString("</ListBucketResult>")
+	io.WriteString(w, b.String())
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func TestFS(t *testing.T) {
+	s3 := &fakeS3{objects: map[string][]byte{
+		"dir/file":        []byte("hello, world"),
+		"dir/sub/":        nil,
+		"implicit/a/file": []byte("x"),
+		"bad//key":        []byte("x"),
+	}, uploads: make(map[string]map[int][]byte)}
+	srv := httptest.NewServer(s3)
+	defer srv.Close()
+	fsys, err := s3fs.New(srv.URL, "bucket", s3fs.Credentials("key", "secret", ""), s3fs.PartSize(0))
+	check(t, err)
+
+	check(t, fstest.TestFS(fsys, "dir/file", "dir/sub", "implicit/a/file"))
+	if err := wrfstest.TestWriteFS(fsys, wrfstest.SkipChmod(), wrfstest.SkipChown(), wrfstest.SkipChtimes(),
+		wrfstest.SkipLinks()); err != nil {
+		t.Fatal(err)
+	}
+
+	big := bytes.Repeat([]byte("0123456789"), 1<<20+1)
+	check(t, wrfs.WriteFile(fsys, "dir/big", big, 0644))
+	if s3.parts != 3 || !bytes.Equal(s3.objects["dir/big"], big) {
+		t.Errorf("multipart upload of %d bytes: uploaded %d parts and %d bytes", len(big), s3.parts,
+			len(s3.objects["dir/big"]))
+	}
+	check(t, wrfs.CopyFile(fsys, "dir/copy", fsys, "dir/big"))
+	if s3.copies != 1 || !bytes.Equal(s3.objects["dir/copy"], big) {
+		t.Errorf("CopyFile within the bucket: copied %d objects on the server", s3.copies)
+	}
+	if _, err := wrfs.OpenFile(fsys, "dir/file", wrfs.O_WRONLY|wrfs.O_APPEND, 0); !errors.Is(err, wrfs.ErrUnsupported) {
+		t.Errorf("OpenFile with O_APPEND: got error %v, want ErrUnsupported", err)
+	}
+	if err := wrfs.Remove(fsys, "implicit"); err == nil {
+		t.Error("Remove of a non-empty directory succeeded")
+	}
+	check(t, wrfs.RemoveAll(fsys, "implicit"))
+	if _, err := wrfs.Stat(fsys, "implicit"); !errors.Is(err, wrfs.ErrNotExist) {
+		t.Errorf("RemoveAll did not remove implicit: %v", err)
+	}
+
+	anonymous, err := s3fs.New(srv.URL, "bucket")
+	check(t, err)
+	if _, err := wrfs.Stat(anonymous, "dir/file"); !errors.Is(err, wrfs.ErrPermission) {
+		t.Errorf("Stat without credentials: got error %v, want ErrPermission", err)
+	}
+}
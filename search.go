@@ -0,0 +1,109 @@
+//go:build go1.23
+// +build go1.23
+
+package wrfs
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"iter"
+)
+
+// A Match is a line found by SearchContent, or an error it encountered.
+type Match struct {
+	Path string // the path of the file
+	Line int    // the line number, starting at 1
+	Text string // the line, without its line ending
+	Err  error  // the error reading the file or directory at Path, if not nil
+}
+
+// A SearchOption configures SearchContent.
+type SearchOption func(*searchConfig)
+
+type searchConfig struct {
+	maxSize int64
+	binary  bool
+}
+
+// SearchMaxSize makes SearchContent skip files larger than n bytes.
+func SearchMaxSize(n int64) SearchOption {
+	return func(c *searchConfig) { c.maxSize = n }
+}
+
+// SearchBinary makes SearchContent search binary files too.
+func SearchBinary() SearchOption {
+	return func(c *searchConfig) { c.binary = true }
+}
+
+// binaryPeek is the number of bytes at the start of a file that are checked for a NUL byte, as git does to detect
+// binary files.
+const binaryPeek = 8000
+
+// SearchContent returns an iterator over the lines of the regular files in the tree rooted at root for which match
+// returns true, such as the Match method of a *regexp.Regexp, in the order WalkDir visits the files. Files are read
+// as they are searched, one line at a time. Binary files, detected by a NUL byte among their first 8000 bytes, are
+// skipped unless SearchBinary is given. Errors opening or reading files and directories are yielded as Matches
+// with Err set, after which the search continues with the next file.
+func SearchContent(fsys FS, root string, match func(line []byte) bool, opts ...SearchOption) iter.Seq[Match] {
+	var c searchConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return func(yield func(Match) bool) {
+		WalkDir(fsys, root, func(name string, d DirEntry, err error) error {
+			if err != nil {
+				if !yield(Match{Path: name, Err: err}) {
+					return SkipAll
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			if c.maxSize > 0 {
+				if fi, err := d.Info(); err == nil && fi.Size() > c.maxSize {
+					return nil
+				}
+			}
+			if !searchFile(fsys, name, match, &c, yield) {
+				return SkipAll
+			}
+			return nil
+		})
+	}
+}
+
+// searchFile yields the matching lines of the named file, returning false if yield did.
+func searchFile(fsys FS, name string, match func([]byte) bool, c *searchConfig, yield func(Match) bool) bool {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return yield(Match{Path: name, Err: err})
+	}
+	defer file.Close()
+	r := bufio.NewReaderSize(file, binaryPeek)
+	if !c.binary {
+		head, err := r.Peek(binaryPeek)
+		if err != nil && err != io.EOF {
+			return yield(Match{Path: name, Err: err})
+		}
+		if bytes.IndexByte(head, 0) >= 0 {
+			return true
+		}
+	}
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+			if match(line) && !yield(Match{Path: name, Line: n, Text: string(line)}) {
+				return false
+			}
+		}
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			return yield(Match{Path: name, Err: err})
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package wrfs
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// SecureDirFS returns a file system for the tree of files rooted at the directory dir, like DirFS, that never
+// accesses files outside of that tree. Symbolic links are followed as long as they resolve to paths inside the
+// tree; operations on paths that would resolve outside of it, such as through a link to an absolute path or to
+// "../..", fail with an error matching ErrPermission. Symbolic links pointing outside the tree can still be
+// created, read with Readlink and removed, since that does not access what they point to.
+//
+// On Linux 5.6 and later, paths are resolved by the kernel with openat2(2) and RESOLVE_BENEATH, which also
+// protects against concurrent renames of the directories of the tree. Elsewhere, the symbolic links along a path
+// are resolved one at a time before accessing it, so that a process renaming directories inside the tree at the
+// same time might still make an operation escape it.
+func SecureDirFS(dir string) FS {
+	return &secureFS{dir: dir, host: &subFS{fsys: hostFS{}, dir: dir}}
+}
+
+type secureFS struct {
+	dir  string
+	host FS // the tree without any checks, as returned by DirFS
+}
+
+// resolve returns the path in the tree that name refers to, with the symbolic links among its parent directories,
+// and among its last element if follow is set, resolved. Elements that do not exist are left as they are.
+func (s *secureFS) resolve(name string, follow bool) (string, error) {
+	resolved := "."
+	var rest []string
+	if name != "." {
+		rest = strings.Split(name, "/")
+	}
+	for links := 0; len(rest) > 0; {
+		elem := rest[0]
+		rest = rest[1:]
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if resolved == "." {
+				return "", ErrPermission
+			}
+			resolved = path.Dir(resolved)
+			continue
+		}
+		next := path.Join(resolved, elem)
+		fi, err := Lstat(s.host, next)
+		if err != nil || fi.Mode()&ModeSymlink == 0 || (len(rest) == 0 && !follow) {
+			resolved = next
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return "", errno.ELOOP
+		}
+		target, err := Readlink(s.host, next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) || filepath.VolumeName(target) != "" {
+			return "", ErrPermission
+		}
+		target = filepath.ToSlash(target)
+		if path.IsAbs(target) {
+			return "", ErrPermission
+		}
+		rest = append(strings.Split(target, "/"), rest...)
+	}
+	return resolved, nil
+}
+
+// hostPath returns a path of the host file system that refers to name, or to its parent directory joined with its
+// last element if follow is not set, along with a function to call when done with it.
+func (s *secureFS) hostPath(op, name string, follow bool) (string, func(), error) {
+	if !ValidPath(name) {
+		return "", nil, &PathError{Op: op, Path: name, Err: ErrInvalid}
+	}
+	host, done, err := s.fdPath(name, follow)
+	if errors.Is(err, ErrUnsupported) {
+		var resolved string
+		resolved, err = s.resolve(name, follow)
+		host, done = filepath.Join(s.dir, filepath.FromSlash(resolved)), func() {}
+	}
+	if err != nil {
+		return "", nil, &PathError{Op: op, Path: name, Err: err}
+	}
+	return host, done, nil
+}
+
+// do performs fn with the host path of name, reporting errors with name.
+func (s *secureFS) do(op, name string, follow bool, fn func(host string) error) error {
+	host, done, err := s.hostPath(op, name, follow)
+	if err != nil {
+		return err
+	}
+	defer done()
+	err = fn(host)
+	var pathErr *PathError
+	if errors.As(err, &pathErr) {
+		pathErr.Path = name
+	}
+	return err
+}
+
+// do2 is like do, for operations on two paths whose last elements are not followed.
+func (s *secureFS) do2(op, oldname, newname string, fn func(oldhost, newhost string) error) error {
+	oldhost, olddone, err := s.hostPath(op, oldname, false)
+	if err != nil {
+		return err
+	}
+	defer olddone()
+	newhost, newdone, err := s.hostPath(op, newname, false)
+	if err != nil {
+		return err
+	}
+	defer newdone()
+	err = fn(oldhost, newhost)
+	var linkErr *LinkError
+	if errors.As(err, &linkErr) {
+		linkErr.Old, linkErr.New = oldname, newname
+	}
+	return err
+}
+
+func (s *secureFS) Open(name string) (File, error) {
+	return s.OpenFile(name, O_RDONLY, 0)
+}
+
+func (s *secureFS) OpenFile(name string, flag int, perm FileMode) (File, error) {
+	if !ValidPath(name) {
+		return nil, &PathError{Op: "open", Path: name, Err: ErrInvalid}
+	}
+	file, err := openBeneath(s.dir, name, flag, perm)
+	if err == nil {
+		return file, nil
+	}
+	if !errors.Is(err, ErrUnsupported) {
+		return nil, &PathError{Op: "open", Path: name, Err: err}
+	}
+	// An exclusive create does not follow a symbolic link in the last element, but fails.
+	follow := flag&(O_CREATE|O_EXCL) != O_CREATE|O_EXCL
+	var f File
+	err = s.do("open", name, follow, func(host string) (err error) {
+		f, err = hostFS{}.OpenFile(host, flag, perm)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *secureFS) Stat(name string) (FileInfo, error) {
+	return s.stat("stat", name, true)
+}
+
+func (s *secureFS) Lstat(name string) (FileInfo, error) {
+	return s.stat("lstat", name, false)
+}
+
+func (s *secureFS) stat(op, name string, follow bool) (FileInfo, error) {
+	if !ValidPath(name) {
+		return nil, &PathError{Op: op, Path: name, Err: ErrInvalid}
+	}
+	flag := openPath
+	if !follow {
+		flag |= openNoFollow
+	}
+	file, err := openBeneath(s.dir, name, flag, 0)
+	if err == nil {
+		defer file.Close()
+		return file.Stat()
+	}
+	if !errors.Is(err, ErrUnsupported) {
+		return nil, &PathError{Op: op, Path: name, Err: err}
+	}
+	var fi FileInfo
+	err = s.do(op, name, follow, func(host string) (err error) {
+		if follow {
+			fi, err = os.Stat(host)
+		} else {
+			fi, err = os.Lstat(host)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rename(fi, name), nil
+}
+
+func (s *secureFS) Readlink(name string) (target string, err error) {
+	err = s.do("readlink", name, false, func(host string) (err error) {
+		target, err = os.Readlink(host)
+		return err
+	})
+	return target, err
+}
+
+func (s *secureFS) Chmod(name string, mode FileMode) error {
+	return s.do("chmod", name, true, func(host string) error { return os.Chmod(host, mode) })
+}
+
+func (s *secureFS) Chown(name string, uid, gid int) error {
+	return s.do("chown", name, true, func(host string) error { return os.Chown(host, uid, gid) })
+}
+
+func (s *secureFS) Lchown(name string, uid, gid int) error {
+	return s.do("lchown", name, false, func(host string) error { return os.Lchown(host, uid, gid) })
+}
+
+func (s *secureFS) Chtimes(name string, atime, mtime time.Time) error {
+	return s.do("chtimes", name, true, func(host string) error { return os.Chtimes(host, atime, mtime) })
+}
+
+func (s *secureFS) Mkdir(name string, perm FileMode) error {
+	return s.do("mkdir", name, false, func(host string) error { return os.Mkdir(host, perm) })
+}
+
+func (s *secureFS) Remove(name string) error {
+	return s.do("remove", name, false, os.Remove)
+}
+
+func (s *secureFS) RemoveAll(name string) error {
+	return s.do("removeall", name, false, os.RemoveAll)
+}
+
+func (s *secureFS) Truncate(name string, size int64) error {
+	return s.do("truncate", name, true, func(host string) error { return os.Truncate(host, size) })
+}
+
+func (s *secureFS) Statfs(name string) (info FSInfo, err error) {
+	err = s.do("statfs", name, true, func(host string) (err error) {
+		info, err = hostFS{}.Statfs(host)
+		return err
+	})
+	return info, err
+}
+
+func (s *secureFS) Rename(oldpath, newpath string) error {
+	return s.do2("rename", oldpath, newpath, os.Rename)
+}
+
+func (s *secureFS) Link(oldname, newname string) error {
+	return s.do2("link", oldname, newname, os.Link)
+}
+
+// Symlink creates newname as a symbolic link to oldname. The link is created even if oldname is outside the tree,
+// but is then not followed.
+func (s *secureFS) Symlink(oldname, newname string) error {
+	err := s.do("symlink", newname, false, func(host string) error { return os.Symlink(oldname, host) })
+	var linkErr *LinkError
+	if errors.As(err, &linkErr) {
+		linkErr.New = newname
+	}
+	return err
+}
+
+func (s *secureFS) SameFile(fi1, fi2 FileInfo) bool {
+	return os.SameFile(fi1, fi2)
+}
+
+func (s *secureFS) OpenLock(name string) (LockFile, error) {
+	file, err := s.OpenFile(name, O_RDONLY|O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := OSFile(file); ok {
+		return &lockFile{f}, nil
+	}
+	file.Close()
+	return nil, &PathError{Op: "lock", Path: name, Err: ErrUnsupported}
+}
@@ -0,0 +1,105 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package wrfs
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	sysOpenat2 = 437 // the same on all architectures but MIPS, which have their own numbering
+
+	resolveNoMagiclinks = 0x02
+	resolveBeneath      = 0x08
+
+	openPath     = 0x200000 // O_PATH, missing from package syscall
+	openNoFollow = syscall.O_NOFOLLOW
+)
+
+// openHow is struct open_how of openat2(2).
+type openHow struct {
+	flags   uint64
+	mode    uint64
+	resolve uint64
+}
+
+// noOpenat2 is set once openat2(2) turns out not to be supported by the kernel.
+var noOpenat2 atomic.Bool
+
+// openBeneath opens name in the directory dir with openat2(2), such that resolving it never leaves dir. It returns
+// an error matching ErrPermission if it would, and ErrUnsupported if openat2(2) is not supported.
+func openBeneath(dir, name string, flag int, perm FileMode) (*os.File, error) {
+	if noOpenat2.Load() {
+		return nil, ErrUnsupported
+	}
+	dirfd, err := syscall.Open(dir, openPath|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(dirfd)
+	p, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	how := openHow{
+		flags:   uint64(flag | syscall.O_CLOEXEC),
+		mode:    uint64(perm.Perm()),
+		resolve: resolveBeneath | resolveNoMagiclinks,
+	}
+	for {
+		fd, _, errno := syscall.Syscall6(sysOpenat2, uintptr(dirfd), uintptr(unsafe.Pointer(p)),
+			uintptr(unsafe.Pointer(&how)), unsafe.Sizeof(how), 0, 0)
+		switch errno {
+		case 0:
+			return os.NewFile(fd, filepath.Join(dir, name)), nil
+		case syscall.EINTR, syscall.EAGAIN:
+			continue // EAGAIN reports a concurrent rename, after which resolving is retried
+		case syscall.ENOSYS:
+			noOpenat2.Store(true)
+			return nil, ErrUnsupported
+		case syscall.EXDEV:
+			return nil, ErrPermission
+		default:
+			return nil, errno
+		}
+	}
+}
+
+var (
+	procFDOnce sync.Once
+	procFDOK   bool
+)
+
+// fdPath returns a path under /proc/self/fd that refers to name, or to its parent directory joined with its last
+// element if follow is not set, as resolved by openBeneath. Since the kernel resolves such paths through the
+// open file descriptor, they cannot be redirected outside the tree either.
+func (s *secureFS) fdPath(name string, follow bool) (string, func(), error) {
+	procFDOnce.Do(func() {
+		fi, err := os.Stat("/proc/self/fd")
+		procFDOK = err == nil && fi.IsDir()
+	})
+	if !procFDOK {
+		return "", nil, ErrUnsupported
+	}
+	dir, base, flag := name, "", openPath
+	if !follow && name != "." {
+		dir, base, flag = path.Dir(name), path.Base(name), openPath|syscall.O_DIRECTORY
+	}
+	file, err := openBeneath(s.dir, dir, flag, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	host := "/proc/self/fd/" + strconv.Itoa(int(file.Fd()))
+	if base != "" {
+		host += "/" + base
+	}
+	return host, func() { file.Close() }, nil
+}
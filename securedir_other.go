@@ -0,0 +1,21 @@
+//go:build !linux || mips || mipsle || mips64 || mips64le
+// +build !linux mips mipsle mips64 mips64le
+
+package wrfs
+
+import "os"
+
+const (
+	openPath     = 0
+	openNoFollow = 0
+)
+
+// openBeneath returns ErrUnsupported, as openat2(2) is only available on Linux.
+func openBeneath(dir, name string, flag int, perm FileMode) (*os.File, error) {
+	return nil, ErrUnsupported
+}
+
+// fdPath returns ErrUnsupported, as /proc/self/fd is only used on Linux.
+func (s *secureFS) fdPath(name string, follow bool) (string, func(), error) {
+	return "", nil, ErrUnsupported
+}
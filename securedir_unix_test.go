@@ -0,0 +1,66 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wrfs_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestSecureDirFS(t *testing.T) {
+	outside := t.TempDir()
+	writeFile(t, DirFS(outside), "secret", []byte("secret"))
+	dir := t.TempDir()
+	fsys := SecureDirFS(dir)
+	check(t, Mkdir(fsys, "sub", 0755))
+	writeFile(t, fsys, "sub/file", []byte("inside"))
+	check(t, Symlink(fsys, "sub/file", "inner"))
+	check(t, Symlink(fsys, "../sub", "sub/self"))
+	check(t, Symlink(fsys, outside+"/secret", "absolute"))
+	check(t, Symlink(fsys, "../../"+outside[1:], "sub/relative"))
+	check(t, Symlink(fsys, outside, "dir"))
+
+	data, err := ReadFile(fsys, "sub/self/self/file")
+	check(t, err)
+	if string(data) != "inside" {
+		t.Errorf("ReadFile through links inside: got %q, want %q", data, "inside")
+	}
+	check(t, Rename(fsys, "inner", "sub/self/renamed"))
+	if _, err := Lstat(fsys, "sub/renamed"); err != nil {
+		t.Errorf("Rename through link inside: %v", err)
+	}
+	check(t, Chmod(fsys, "sub/self/file", 0600))
+
+	for _, name := range []string{"absolute", "sub/relative/secret", "dir/secret", "../secret"} {
+		if _, err := ReadFile(fsys, name); !errors.Is(err, ErrPermission) && !errors.Is(err, ErrInvalid) {
+			t.Errorf("ReadFile(%s): got %v, want ErrPermission", name, err)
+		}
+		if _, err := Stat(fsys, name); err == nil {
+			t.Errorf("Stat(%s) succeeded", name)
+		}
+		if err := Chmod(fsys, name, 0777); err == nil {
+			t.Errorf("Chmod(%s) succeeded", name)
+		}
+	}
+	if err := WriteFile(fsys, "dir/new", nil, 0644); !errors.Is(err, ErrPermission) {
+		t.Errorf("WriteFile(dir/new): got %v, want ErrPermission", err)
+	}
+	if err := Mkdir(fsys, "dir/new", 0755); !errors.Is(err, ErrPermission) {
+		t.Errorf("Mkdir(dir/new): got %v, want ErrPermission", err)
+	}
+	fi, err := Lstat(fsys, "absolute")
+	check(t, err)
+	if fi.Mode()&ModeSymlink == 0 || fi.Name() != "absolute" {
+		t.Errorf("Lstat(absolute) = %v %v, want symlink named absolute", fi.Name(), fi.Mode())
+	}
+	check(t, Remove(fsys, "absolute"))
+	check(t, RemoveAll(fsys, "dir"))
+	entries, err := ReadDir(DirFS(outside), ".")
+	check(t, err)
+	if len(entries) != 1 {
+		t.Errorf("outside directory has %d entries, want 1", len(entries))
+	}
+}
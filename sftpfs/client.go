@@ -0,0 +1,556 @@
+package sftpfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// Client is a file system accessing an SFTP server, such as OpenSSH's sftp-server or one running Serve.
+type Client struct {
+	mu          sync.Mutex
+	rw          io.ReadWriteCloser
+	id          uint32
+	posixRename bool
+}
+
+// NewClient returns a file system for the files of the SFTP server at the other end of rw, such as the standard
+// input and output of "ssh -s host sftp", after negotiating version 3 of the protocol. The root of the file system
+// is the root of the server, so that names are sent to it with a leading slash; the home directory of the user is
+// not taken into account.
+//
+// Requests are sent one at a time, each waiting for its reply. Files are read and written at their offset with read
+// and write requests of up to the largest size servers must accept, and renamed over existing files with the
+// posix-rename@openssh.com extension when the server supports it. Close closes rw.
+func NewClient(rw io.ReadWriteCloser) (*Client, error) {
+	if _, err := rw.Write(newPacket(fxpInit).uint32(3).finish()); err != nil {
+		return nil, err
+	}
+	typ, payload, err := readPacket(rw)
+	if err != nil {
+		return nil, err
+	}
+	d := &decoder{buf: payload}
+	if typ != fxpVersion || d.uint32() != 3 || d.err != nil {
+		return nil, errors.New("sftpfs: server does not speak version 3 of the SFTP protocol")
+	}
+	c := &Client{rw: rw}
+	for len(d.buf) > 0 && d.err == nil {
+		if name, _ := d.string(), d.string(); name == "posix-rename@openssh.com" {
+			c.posixRename = true
+		}
+	}
+	return c, nil
+}
+
+// Close closes the connection to the server.
+func (c *Client) Close() error {
+	return c.rw.Close()
+}
+
+// call sends a request of type typ with the fields of p, which starts with room for the request ID, and returns
+// the type and fields of the reply. Status replies other than fxOK are returned as errors.
+func (c *Client) call(typ byte, p packet) (byte, *decoder, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.id++
+	p[4] = typ
+	binary.BigEndian.PutUint32(p[5:], c.id)
+	if _, err := c.rw.Write(p.finish()); err != nil {
+		return 0, nil, err
+	}
+	rtyp, payload, err := readPacket(c.rw)
+	if err != nil {
+		return 0, nil, err
+	}
+	d := &decoder{buf: payload}
+	if d.uint32() != c.id || d.err != nil {
+		return 0, nil, errBadMessage
+	}
+	if rtyp == fxpStatus {
+		code, msg := d.uint32(), d.string()
+		if d.err != nil {
+			return 0, nil, d.err
+		}
+		return rtyp, d, statusErr(code, msg)
+	}
+	return rtyp, d, nil
+}
+
+// request returns a packet for a request, with room for its type and ID, which call sets.
+func request() packet {
+	return newPacket(0).uint32(0)
+}
+
+// statusErr returns the error reported by a status reply, or nil for fxOK.
+func statusErr(code uint32, msg string) error {
+	switch code {
+	case fxOK:
+		return nil
+	case fxEOF:
+		return io.EOF
+	case fxNoSuchFile:
+		return wrfs.ErrNotExist
+	case fxPermissionDenied:
+		return wrfs.ErrPermission
+	case fxBadMessage:
+		return errBadMessage
+	case fxOpUnsupported:
+		return wrfs.ErrUnsupported
+	}
+	if msg == "" {
+		msg = "failure"
+	}
+	return errors.New("sftpfs: " + msg)
+}
+
+// expect calls call and checks that the reply has type want, returning its fields.
+func (c *Client) expect(op, name string, typ byte, p packet, want byte) (*decoder, error) {
+	rtyp, d, err := c.call(typ, p)
+	if err == nil && rtyp != want {
+		err = errBadMessage
+	}
+	if err != nil {
+		return nil, &wrfs.PathError{Op: op, Path: name, Err: err}
+	}
+	return d, nil
+}
+
+// do sends a request of type typ whose reply is a status.
+func (c *Client) do(op, name string, typ byte, p packet) error {
+	_, err := c.expect(op, name, typ, p, fxpStatus)
+	return err
+}
+
+// pathFor returns the path of name sent to the server, checking that name is valid.
+func pathFor(op, name string) (string, error) {
+	if !wrfs.ValidPath(name) {
+		return "", &wrfs.PathError{Op: op, Path: name, Err: wrfs.ErrInvalid}
+	}
+	return clientPath(name), nil
+}
+
+// stat requests the attributes of name with a request of type typ.
+func (c *Client) stat(op, name string, typ byte) (wrfs.FileInfo, error) {
+	p, err := pathFor(op, name)
+	if err != nil {
+		return nil, err
+	}
+	d, err := c.expect(op, name, typ, request().string(p), fxpAttrs)
+	if err != nil {
+		return nil, err
+	}
+	return newFileInfo(path.Base(name), d)
+}
+
+func (c *Client) Stat(name string) (wrfs.FileInfo, error) {
+	return c.stat("stat", name, fxpStat)
+}
+
+func (c *Client) Lstat(name string) (wrfs.FileInfo, error) {
+	return c.stat("lstat", name, fxpLstat)
+}
+
+func (c *Client) ReadDir(name string) ([]wrfs.DirEntry, error) {
+	p, err := pathFor("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	d, err := c.expect("readdir", name, fxpOpendir, request().string(p), fxpHandle)
+	if err != nil {
+		return nil, err
+	}
+	h := d.string()
+	defer c.do("close", name, fxpClose, request().string(h))
+	var entries []wrfs.DirEntry
+	for {
+		d, err := c.expect("readdir", name, fxpReaddir, request().string(h), fxpName)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for n := d.uint32(); n > 0 && d.err == nil; n-- {
+			entry := d.string()
+			d.string() // the long name
+			fi, err := newFileInfo(entry, d)
+			if err != nil {
+				return nil, &wrfs.PathError{Op: "readdir", Path: name, Err: err}
+			}
+			if entry != "." && entry != ".." {
+				entries = append(entries, fs.FileInfoToDirEntry(fi))
+			}
+		}
+		if d.err != nil {
+			return nil, &wrfs.PathError{Op: "readdir", Path: name, Err: d.err}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (c *Client) Open(name string) (wrfs.File, error) {
+	return c.OpenFile(name, wrfs.O_RDONLY, 0)
+}
+
+// OpenFile opens the named file. Directories can only be opened for reading, and are listed when first read.
+func (c *Client) OpenFile(name string, flag int, perm wrfs.FileMode) (wrfs.File, error) {
+	p, err := pathFor("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if flag&(wrfs.O_WRONLY|wrfs.O_RDWR|wrfs.O_CREATE) == 0 {
+		fi, err := c.Stat(name)
+		if err != nil {
+			return nil, &wrfs.PathError{Op: "open", Path: name, Err: errors.Unwrap(err)}
+		}
+		if fi.IsDir() {
+			return &dir{c: c, name: name, info: fi}, nil
+		}
+	}
+	var flags uint32
+	switch {
+	case flag&wrfs.O_RDWR != 0:
+		flags = fxfRead | fxfWrite
+	case flag&wrfs.O_WRONLY != 0:
+		flags = fxfWrite
+	default:
+		flags = fxfRead
+	}
+	if flag&wrfs.O_APPEND != 0 {
+		flags |= fxfAppend
+	}
+	if flag&wrfs.O_CREATE != 0 {
+		flags |= fxfCreat
+	}
+	if flag&wrfs.O_TRUNC != 0 {
+		flags |= fxfTrunc
+	}
+	if flag&wrfs.O_EXCL != 0 {
+		flags |= fxfExcl
+	}
+	req := request().string(p).uint32(flags).uint32(attrPermissions).uint32(fromFileMode(perm.Perm()))
+	d, err := c.expect("open", name, fxpOpen, req, fxpHandle)
+	if err != nil {
+		if flag&(wrfs.O_CREATE|wrfs.O_EXCL) == wrfs.O_CREATE|wrfs.O_EXCL {
+			return nil, c.existErr("open", name, err)
+		}
+		if fi, serr := c.Stat(name); serr == nil && fi.IsDir() {
+			return nil, &wrfs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+		}
+		return nil, err
+	}
+	f := &file{c: c, name: name, handle: d.string()}
+	if flag&wrfs.O_APPEND != 0 {
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (c *Client) Mkdir(name string, perm wrfs.FileMode) error {
+	p, err := pathFor("mkdir", name)
+	if err != nil {
+		return err
+	}
+	req := request().string(p).uint32(attrPermissions).uint32(fromFileMode(perm.Perm() | wrfs.ModeDir))
+	return c.existErr("mkdir", name, c.do("mkdir", name, fxpMkdir, req))
+}
+
+// existErr returns err, which reports the failure to create name, as ErrExist if name exists, since servers
+// report most failures alike.
+func (c *Client) existErr(op, name string, err error) error {
+	if err != nil {
+		if _, serr := c.Lstat(name); serr == nil {
+			return &wrfs.PathError{Op: op, Path: name, Err: wrfs.ErrExist}
+		}
+	}
+	return err
+}
+
+// Remove removes the named file or empty directory, with a remove or rmdir request depending on its type.
+func (c *Client) Remove(name string) error {
+	p, err := pathFor("remove", name)
+	if err != nil {
+		return err
+	}
+	fi, err := c.Lstat(name)
+	if err != nil {
+		return &wrfs.PathError{Op: "remove", Path: name, Err: errors.Unwrap(err)}
+	}
+	if !fi.IsDir() {
+		return c.do("remove", name, fxpRemove, request().string(p))
+	}
+	if entries, err := c.ReadDir(name); err == nil && len(entries) > 0 {
+		return &wrfs.PathError{Op: "remove", Path: name, Err: errno.ENOTEMPTY}
+	}
+	return c.do("remove", name, fxpRmdir, request().string(p))
+}
+
+// Rename renames oldpath to newpath, replacing it if it exists. Servers without the posix-rename@openssh.com
+// extension refuse to replace files, so newpath is removed first on those, which is not atomic.
+func (c *Client) Rename(oldpath, newpath string) error {
+	if !wrfs.ValidPath(oldpath) || !wrfs.ValidPath(newpath) {
+		return &wrfs.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: wrfs.ErrInvalid}
+	}
+	var err error
+	if c.posixRename {
+		req := request().string("posix-rename@openssh.com").string(clientPath(oldpath)).string(clientPath(newpath))
+		err = c.do("rename", oldpath, fxpExtended, req)
+	} else {
+		if fi, serr := c.Lstat(newpath); serr == nil && !fi.IsDir() {
+			c.Remove(newpath)
+		}
+		err = c.do("rename", oldpath, fxpRename, request().string(clientPath(oldpath)).string(clientPath(newpath)))
+	}
+	if err != nil {
+		return &wrfs.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errors.Unwrap(err)}
+	}
+	return nil
+}
+
+// Symlink creates newname as a symbolic link to oldname, sending the target first, as OpenSSH does.
+func (c *Client) Symlink(oldname, newname string) error {
+	p, err := pathFor("symlink", newname)
+	if err != nil {
+		return err
+	}
+	return c.existErr("symlink", newname, c.do("symlink", newname, fxpSymlink, request().string(oldname).string(p)))
+}
+
+func (c *Client) Readlink(name string) (string, error) {
+	p, err := pathFor("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	d, err := c.expect("readlink", name, fxpReadlink, request().string(p), fxpName)
+	if err != nil {
+		return "", err
+	}
+	if d.uint32() < 1 {
+		return "", &wrfs.PathError{Op: "readlink", Path: name, Err: errBadMessage}
+	}
+	target := d.string()
+	if d.err != nil {
+		return "", &wrfs.PathError{Op: "readlink", Path: name, Err: d.err}
+	}
+	return target, nil
+}
+
+// setstat sets attributes of name, given by the fields of a, which start with their flags.
+func (c *Client) setstat(op, name string, a packet) error {
+	p, err := pathFor(op, name)
+	if err != nil {
+		return err
+	}
+	return c.do(op, name, fxpSetstat, append(request().string(p), a...))
+}
+
+func (c *Client) Chmod(name string, mode wrfs.FileMode) error {
+	return c.setstat("chmod", name, packet{}.uint32(attrPermissions).uint32(fromFileMode(mode)&07777))
+}
+
+func (c *Client) Chown(name string, uid, gid int) error {
+	return c.setstat("chown", name, packet{}.uint32(attrUIDGID).uint32(uint32(uid)).uint32(uint32(gid)))
+}
+
+func (c *Client) Chtimes(name string, atime, mtime time.Time) error {
+	return c.setstat("chtimes", name, packet{}.uint32(attrACModTime).uint32(uint32(atime.Unix())).uint32(uint32(mtime.Unix())))
+}
+
+func (c *Client) Truncate(name string, size int64) error {
+	if size < 0 {
+		return &wrfs.PathError{Op: "truncate", Path: name, Err: wrfs.ErrInvalid}
+	}
+	return c.setstat("truncate", name, packet{}.uint32(attrSize).uint64(uint64(size)))
+}
+
+// fileInfo describes a file of an SFTP server.
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    wrfs.FileMode
+	modTime time.Time
+}
+
+// newFileInfo decodes the attributes of the file called name.
+func newFileInfo(name string, d *decoder) (*fileInfo, error) {
+	a := d.attrs()
+	if d.err != nil {
+		return nil, d.err
+	}
+	fi := &fileInfo{name: name, size: int64(a.size), modTime: a.mtime}
+	if a.flags&attrPermissions != 0 {
+		fi.mode = toFileMode(a.permissions)
+		switch a.permissions & 0170000 {
+		case sIFDIR:
+			fi.mode |= wrfs.ModeDir
+		case sIFLNK:
+			fi.mode |= wrfs.ModeSymlink
+		case sIFIFO:
+			fi.mode |= wrfs.ModeNamedPipe
+		case sIFSOCK:
+			fi.mode |= wrfs.ModeSocket
+		case sIFCHR:
+			fi.mode |= wrfs.ModeDevice | wrfs.ModeCharDevice
+		case sIFBLK:
+			fi.mode |= wrfs.ModeDevice
+		}
+	}
+	return fi, nil
+}
+
+func (fi *fileInfo) Name() string        { return fi.name }
+func (fi *fileInfo) Size() int64         { return fi.size }
+func (fi *fileInfo) Mode() wrfs.FileMode { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time  { return fi.modTime }
+func (fi *fileInfo) IsDir() bool         { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() any            { return nil }
+
+// dir is an open directory of an SFTP server, listed when first read.
+type dir struct {
+	c       *Client
+	name    string
+	info    wrfs.FileInfo
+	entries []wrfs.DirEntry
+	listed  bool
+}
+
+func (d *dir) Stat() (wrfs.FileInfo, error) { return d.info, nil }
+func (d *dir) Close() error                 { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &wrfs.PathError{Op: "read", Path: d.name, Err: syscall.EISDIR}
+}
+
+func (d *dir) ReadDir(n int) ([]wrfs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.c.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.listed = entries, true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// file is an open file of an SFTP server, read and written at its offset.
+type file struct {
+	c      *Client
+	name   string
+	handle string
+	off    int64
+	closed bool
+}
+
+func (f *file) Stat() (wrfs.FileInfo, error) {
+	d, err := f.c.expect("stat", f.name, fxpFstat, request().string(f.handle), fxpAttrs)
+	if err != nil {
+		return nil, err
+	}
+	return newFileInfo(path.Base(f.name), d)
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.off)
+	f.off += int64(n)
+	if n > 0 {
+		return n, nil
+	}
+	return n, err
+}
+
+// ReadAt reads len(p) bytes at offset off, with as many read requests as needed.
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &wrfs.PathError{Op: "read", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	var n int
+	for n < len(p) {
+		size := min(len(p)-n, maxData)
+		d, err := f.c.expect("read", f.name, fxpRead, request().string(f.handle).uint64(uint64(off)+uint64(n)).uint32(uint32(size)), fxpData)
+		if errors.Is(err, io.EOF) {
+			return n, io.EOF
+		}
+		if err != nil {
+			return n, err
+		}
+		data := d.bytes()
+		if d.err != nil || len(data) == 0 || len(data) > size {
+			return n, &wrfs.PathError{Op: "read", Path: f.name, Err: errBadMessage}
+		}
+		n += copy(p[n:], data)
+	}
+	return n, nil
+}
+
+func (f *file) Write(p []byte) (int, error) {
+	n, err := f.WriteAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+// WriteAt writes p at offset off, with as many write requests as needed.
+func (f *file) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &wrfs.PathError{Op: "write", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	var n int
+	for n < len(p) {
+		size := min(len(p)-n, maxData)
+		if err := f.c.do("write", f.name, fxpWrite, request().string(f.handle).uint64(uint64(off)+uint64(n)).bytes(p[n:n+size])); err != nil {
+			return n, err
+		}
+		n += size
+	}
+	return n, nil
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		fi, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		offset += fi.Size()
+	}
+	if offset < 0 {
+		return 0, &wrfs.PathError{Op: "seek", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *file) Close() error {
+	if f.closed {
+		return &wrfs.PathError{Op: "close", Path: f.name, Err: wrfs.ErrClosed}
+	}
+	f.closed = true
+	return f.c.do("close", f.name, fxpClose, request().string(f.handle))
+}
@@ -0,0 +1,256 @@
+package sftpfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/relab/wrfs"
+)
+
+// Packet types of SFTP version 3.
+const (
+	fxpInit          = 1
+	fxpVersion       = 2
+	fxpOpen          = 3
+	fxpClose         = 4
+	fxpRead          = 5
+	fxpWrite         = 6
+	fxpLstat         = 7
+	fxpFstat         = 8
+	fxpSetstat       = 9
+	fxpFsetstat      = 10
+	fxpOpendir       = 11
+	fxpReaddir       = 12
+	fxpRemove        = 13
+	fxpMkdir         = 14
+	fxpRmdir         = 15
+	fxpRealpath      = 16
+	fxpStat          = 17
+	fxpRename        = 18
+	fxpReadlink      = 19
+	fxpSymlink       = 20
+	fxpStatus        = 101
+	fxpHandle        = 102
+	fxpData          = 103
+	fxpName          = 104
+	fxpAttrs         = 105
+	fxpExtended      = 200
+	fxpExtendedReply = 201
+)
+
+// Status codes of SFTP version 3.
+const (
+	fxOK               = 0
+	fxEOF              = 1
+	fxNoSuchFile       = 2
+	fxPermissionDenied = 3
+	fxFailure          = 4
+	fxBadMessage       = 5
+	fxOpUnsupported    = 8
+)
+
+// Flags of the attributes of files.
+const (
+	attrSize        = 0x1
+	attrUIDGID      = 0x2
+	attrPermissions = 0x4
+	attrACModTime   = 0x8
+	attrExtended    = 0x80000000
+)
+
+// Flags of fxpOpen.
+const (
+	fxfRead   = 0x1
+	fxfWrite  = 0x2
+	fxfAppend = 0x4
+	fxfCreat  = 0x8
+	fxfTrunc  = 0x10
+	fxfExcl   = 0x20
+)
+
+// maxPacket is the largest packet accepted, and maxData the largest amount of data returned by a read.
+const (
+	maxPacket = 256 << 10
+	maxData   = maxPacket - 1024
+)
+
+// errBadMessage reports a malformed packet.
+var errBadMessage = errors.New("sftpfs: malformed packet")
+
+// readPacket reads a packet from r, returning its type and payload.
+func readPacket(r io.Reader) (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:4]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(hdr[:4])
+	if length < 1 || length > maxPacket {
+		return 0, nil, errBadMessage
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return buf[0], buf[1:], nil
+}
+
+// packet is a packet being encoded, starting with room for its length.
+type packet []byte
+
+func newPacket(typ byte) packet {
+	return packet{0, 0, 0, 0, typ}
+}
+
+func (p packet) uint32(v uint32) packet { return binary.BigEndian.AppendUint32(p, v) }
+func (p packet) uint64(v uint64) packet { return binary.BigEndian.AppendUint64(p, v) }
+func (p packet) string(s string) packet { return append(p.uint32(uint32(len(s))), s...) }
+func (p packet) bytes(b []byte) packet  { return append(p.uint32(uint32(len(b))), b...) }
+
+// attrs appends the attributes of a file described by fi.
+func (p packet) attrs(fi wrfs.FileInfo) packet {
+	p = p.uint32(attrSize | attrPermissions | attrACModTime).uint64(uint64(fi.Size())).uint32(fromFileMode(fi.Mode()))
+	mtime := uint32(fi.ModTime().Unix())
+	return p.uint32(mtime).uint32(mtime)
+}
+
+// finish sets the length of the packet and returns its encoding.
+func (p packet) finish() []byte {
+	binary.BigEndian.PutUint32(p, uint32(len(p)-4))
+	return p
+}
+
+// decoder decodes the fields of a packet, recording whether it was too short.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) uint32() uint32 {
+	if len(d.buf) < 4 {
+		d.err = errBadMessage
+		return 0
+	}
+	v := binary.BigEndian.Uint32(d.buf)
+	d.buf = d.buf[4:]
+	return v
+}
+
+func (d *decoder) uint64() uint64 {
+	if len(d.buf) < 8 {
+		d.err = errBadMessage
+		return 0
+	}
+	v := binary.BigEndian.Uint64(d.buf)
+	d.buf = d.buf[8:]
+	return v
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uint32()
+	if d.err != nil || uint32(len(d.buf)) < n {
+		d.err = errBadMessage
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) string() string { return string(d.bytes()) }
+
+// attrs are the attributes of a file sent by a client, with flags telling which are set.
+type attrs struct {
+	flags        uint32
+	size         uint64
+	uid, gid     uint32
+	permissions  uint32
+	atime, mtime time.Time
+}
+
+func (d *decoder) attrs() attrs {
+	a := attrs{flags: d.uint32()}
+	if a.flags&attrSize != 0 {
+		a.size = d.uint64()
+	}
+	if a.flags&attrUIDGID != 0 {
+		a.uid, a.gid = d.uint32(), d.uint32()
+	}
+	if a.flags&attrPermissions != 0 {
+		a.permissions = d.uint32()
+	}
+	if a.flags&attrACModTime != 0 {
+		a.atime, a.mtime = time.Unix(int64(d.uint32()), 0), time.Unix(int64(d.uint32()), 0)
+	}
+	if a.flags&attrExtended != 0 {
+		for n := d.uint32(); n > 0 && d.err == nil; n-- {
+			d.bytes()
+			d.bytes()
+		}
+	}
+	return a
+}
+
+// Type bits of Unix modes, as used in the permissions of attributes.
+const (
+	sIFSOCK = 0140000
+	sIFLNK  = 0120000
+	sIFREG  = 0100000
+	sIFBLK  = 0060000
+	sIFDIR  = 0040000
+	sIFCHR  = 0020000
+	sIFIFO  = 0010000
+	sISUID  = 04000
+	sISGID  = 02000
+	sISVTX  = 01000
+)
+
+// fromFileMode returns the Unix mode of a FileMode.
+func fromFileMode(mode wrfs.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	switch {
+	case mode.IsDir():
+		m |= sIFDIR
+	case mode&wrfs.ModeSymlink != 0:
+		m |= sIFLNK
+	case mode&wrfs.ModeNamedPipe != 0:
+		m |= sIFIFO
+	case mode&wrfs.ModeSocket != 0:
+		m |= sIFSOCK
+	case mode&wrfs.ModeCharDevice != 0:
+		m |= sIFCHR
+	case mode&wrfs.ModeDevice != 0:
+		m |= sIFBLK
+	default:
+		m |= sIFREG
+	}
+	if mode&wrfs.ModeSetuid != 0 {
+		m |= sISUID
+	}
+	if mode&wrfs.ModeSetgid != 0 {
+		m |= sISGID
+	}
+	if mode&wrfs.ModeSticky != 0 {
+		m |= sISVTX
+	}
+	return m
+}
+
+// toFileMode returns the permission bits and special bits of a Unix mode as a FileMode.
+func toFileMode(m uint32) wrfs.FileMode {
+	mode := wrfs.FileMode(m & 0777)
+	if m&sISUID != 0 {
+		mode |= wrfs.ModeSetuid
+	}
+	if m&sISGID != 0 {
+		mode |= wrfs.ModeSetgid
+	}
+	if m&sISVTX != 0 {
+		mode |= wrfs.ModeSticky
+	}
+	return mode
+}
@@ -0,0 +1,557 @@
+// Package sftpfs serves wrfs file systems over the SFTP protocol, and accesses SFTP servers as wrfs file systems.
+package sftpfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"syscall"
+
+	"github.com/relab/wrfs"
+)
+
+// readDirBatch is the number of directory entries returned by each SFTP readdir request.
+const readDirBatch = 100
+
+// Serve serves fsys over version 3 of the SFTP protocol on rw, which carries the packets of a single client, until
+// rw reports io.EOF. It can be used as the handler of the "sftp" subsystem of an SSH server, such as on a channel
+// of golang.org/x/crypto/ssh, or on the standard input and output of a program configured as the SFTP subsystem of
+// OpenSSH. Requests are handled in order, one at a time, and the files left open by the client are closed on return.
+//
+// The root of fsys is presented to clients as "/", which is also their working directory, and paths leading above it
+// refer to it. Clients can read and write any file of fsys that fsys lets them, so fsys should be wrapped, such as
+// with wrfs.ReadOnly, to restrict what they can do. The posix-rename@openssh.com extension is supported, renaming
+// files over existing ones, whereas plain renames fail if the new name exists, as specified by the protocol. So is the
+// copy-data extension, which copies files on the server, cloning them with wrfs.Clone where possible. Symbolic
+// links are created with the target first, as by OpenSSH, and their targets are stored as given.
+//
+// Serve returns nil once rw reports io.EOF, and otherwise the error that made it stop, such as a malformed packet
+// or a failed write to rw.
+func Serve(rw io.ReadWriter, fsys wrfs.FS) error {
+	s := &server{fsys: fsys, handles: make(map[string]*handle)}
+	defer s.closeAll()
+	typ, payload, err := readPacket(rw)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	d := &decoder{buf: payload}
+	if typ != fxpInit || d.uint32() < 3 || d.err != nil {
+		return errBadMessage
+	}
+	p := newPacket(fxpVersion).uint32(3).string("posix-rename@openssh.com").string("1").string("copy-data").string("1")
+	if _, err := rw.Write(p.finish()); err != nil {
+		return err
+	}
+	for {
+		typ, payload, err := readPacket(rw)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		d := &decoder{buf: payload}
+		id := d.uint32()
+		if d.err != nil {
+			return d.err
+		}
+		p, err := s.dispatch(typ, d)
+		if p == nil {
+			p = status(id, err)
+		} else {
+			binary.BigEndian.PutUint32(p[5:], id)
+		}
+		if _, err := rw.Write(p.finish()); err != nil {
+			return err
+		}
+	}
+}
+
+// reply returns a packet of the given type with room for the request ID, which Serve sets.
+func reply(typ byte) packet {
+	return newPacket(typ).uint32(0)
+}
+
+// status returns the status packet reporting err, which is nil on success.
+func status(id uint32, err error) packet {
+	code := uint32(fxFailure)
+	switch {
+	case err == nil:
+		code = fxOK
+	case errors.Is(err, io.EOF):
+		code = fxEOF
+	case errors.Is(err, wrfs.ErrNotExist):
+		code = fxNoSuchFile
+	case errors.Is(err, wrfs.ErrPermission):
+		code = fxPermissionDenied
+	case errors.Is(err, errBadMessage):
+		code = fxBadMessage
+	case errors.Is(err, wrfs.ErrUnsupported):
+		code = fxOpUnsupported
+	}
+	var msg string
+	if err != nil {
+		msg = err.Error()
+	}
+	return newPacket(fxpStatus).uint32(id).uint32(code).string(msg).string("")
+}
+
+// server is the state of Serve.
+type server struct {
+	fsys    wrfs.FS
+	handles map[string]*handle
+	next    uint64
+}
+
+// handle is a file or directory opened by a client.
+type handle struct {
+	name    string
+	file    wrfs.File       // nil for directories
+	entries []wrfs.DirEntry // the remaining entries of directories
+	append  bool
+}
+
+// dispatch handles a request of type typ, returning the reply, or nil and an error to report as a status.
+func (s *server) dispatch(typ byte, d *decoder) (packet, error) {
+	switch typ {
+	case fxpOpen:
+		name, err := s.path(d)
+		flags, a := d.uint32(), d.attrs()
+		if err == nil {
+			err = d.err
+		}
+		if err != nil {
+			return nil, err
+		}
+		return s.open(name, flags, a)
+	case fxpClose:
+		id := d.string()
+		h, err := s.handle(d, id)
+		if err != nil {
+			return nil, err
+		}
+		delete(s.handles, id)
+		if h.file != nil {
+			return nil, h.file.Close()
+		}
+		return nil, nil
+	case fxpRead:
+		id, off, n := d.string(), d.uint64(), d.uint32()
+		return s.read(d, id, int64(off), n)
+	case fxpWrite:
+		id, off, data := d.string(), d.uint64(), d.bytes()
+		return nil, s.write(d, id, int64(off), data)
+	case fxpLstat, fxpStat:
+		name, err := s.path(d)
+		if err != nil {
+			return nil, err
+		}
+		stat := wrfs.Stat
+		if typ == fxpLstat {
+			stat = wrfs.Lstat
+		}
+		fi, err := stat(s.fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		return reply(fxpAttrs).attrs(fi), nil
+	case fxpFstat:
+		h, err := s.handle(d, d.string())
+		if err != nil {
+			return nil, err
+		}
+		var fi wrfs.FileInfo
+		if h.file != nil {
+			fi, err = h.file.Stat()
+		} else {
+			fi, err = wrfs.Stat(s.fsys, h.name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return reply(fxpAttrs).attrs(fi), nil
+	case fxpSetstat:
+		name, err := s.path(d)
+		a := d.attrs()
+		if err == nil {
+			err = d.err
+		}
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.setstat(name, a)
+	case fxpFsetstat:
+		id, a := d.string(), d.attrs()
+		h, err := s.handle(d, id)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.setstat(h.name, a)
+	case fxpOpendir:
+		name, err := s.path(d)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := wrfs.ReadDir(s.fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		return s.newHandle(&handle{name: name, entries: entries}), nil
+	case fxpReaddir:
+		h, err := s.handle(d, d.string())
+		if err != nil {
+			return nil, err
+		}
+		return s.readDir(h)
+	case fxpRemove, fxpRmdir:
+		name, err := s.path(d)
+		if err != nil {
+			return nil, err
+		}
+		fi, err := wrfs.Lstat(s.fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		if typ == fxpRmdir && !fi.IsDir() {
+			return nil, &wrfs.PathError{Op: "rmdir", Path: name, Err: syscall.ENOTDIR}
+		}
+		if typ == fxpRemove && fi.IsDir() {
+			return nil, &wrfs.PathError{Op: "remove", Path: name, Err: syscall.EISDIR}
+		}
+		return nil, wrfs.Remove(s.fsys, name)
+	case fxpMkdir:
+		name, err := s.path(d)
+		a := d.attrs()
+		if err == nil {
+			err = d.err
+		}
+		if err != nil {
+			return nil, err
+		}
+		perm := wrfs.FileMode(0755)
+		if a.flags&attrPermissions != 0 {
+			perm = toFileMode(a.permissions)
+		}
+		return nil, wrfs.Mkdir(s.fsys, name, perm)
+	case fxpRealpath:
+		name, err := s.path(d)
+		if err != nil {
+			return nil, err
+		}
+		return reply(fxpName).uint32(1).string(clientPath(name)).string(clientPath(name)).uint32(0), nil
+	case fxpRename:
+		oldname, err := s.path(d)
+		if err != nil {
+			return nil, err
+		}
+		newname, err := s.path(d)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := wrfs.Lstat(s.fsys, newname); err == nil {
+			return nil, &wrfs.LinkError{Op: "rename", Old: oldname, New: newname, Err: wrfs.ErrExist}
+		}
+		return nil, wrfs.Rename(s.fsys, oldname, newname)
+	case fxpReadlink:
+		name, err := s.path(d)
+		if err != nil {
+			return nil, err
+		}
+		target, err := wrfs.Readlink(s.fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		return reply(fxpName).uint32(1).string(target).string(target).uint32(0), nil
+	case fxpSymlink:
+		target := d.string()
+		name, err := s.path(d)
+		if err != nil {
+			return nil, err
+		}
+		return nil, wrfs.Symlink(s.fsys, target, name)
+	case fxpExtended:
+		switch d.string() {
+		case "posix-rename@openssh.com":
+			oldname, err := s.path(d)
+			if err != nil {
+				return nil, err
+			}
+			newname, err := s.path(d)
+			if err != nil {
+				return nil, err
+			}
+			return nil, wrfs.Rename(s.fsys, oldname, newname)
+		case "copy-data":
+			rid, roff, n := d.string(), d.uint64(), d.uint64()
+			wid, woff := d.string(), d.uint64()
+			return nil, s.copyData(d, rid, int64(roff), int64(n), wid, int64(woff))
+		}
+	}
+	return nil, wrfs.ErrUnsupported
+}
+
+// path decodes a path sent by a client, returning the name it refers to in the file system.
+func (s *server) path(d *decoder) (string, error) {
+	p := d.string()
+	if d.err != nil {
+		return "", d.err
+	}
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return ".", nil
+	}
+	return p[1:], nil
+}
+
+// clientPath returns the path of name presented to clients.
+func clientPath(name string) string {
+	if name == "." {
+		return "/"
+	}
+	return "/" + name
+}
+
+// newHandle registers h, returning the handle packet reporting it.
+func (s *server) newHandle(h *handle) packet {
+	s.next++
+	id := strconv.FormatUint(s.next, 10)
+	s.handles[id] = h
+	return reply(fxpHandle).string(id)
+}
+
+// handle returns the handle of the given ID, decoded by d.
+func (s *server) handle(d *decoder, id string) (*handle, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	h, ok := s.handles[id]
+	if !ok {
+		return nil, wrfs.ErrInvalid
+	}
+	return h, nil
+}
+
+// closeAll closes the files left open by the client.
+func (s *server) closeAll() {
+	for _, h := range s.handles {
+		if h.file != nil {
+			h.file.Close()
+		}
+	}
+}
+
+// open opens the named file with the given SFTP flags.
+func (s *server) open(name string, flags uint32, a attrs) (packet, error) {
+	var flag int
+	switch {
+	case flags&(fxfRead|fxfWrite) == fxfRead|fxfWrite:
+		flag = wrfs.O_RDWR
+	case flags&fxfWrite != 0:
+		flag = wrfs.O_WRONLY
+	}
+	if flags&fxfAppend != 0 {
+		flag |= wrfs.O_APPEND
+	}
+	if flags&fxfCreat != 0 {
+		flag |= wrfs.O_CREATE
+	}
+	if flags&fxfTrunc != 0 {
+		flag |= wrfs.O_TRUNC
+	}
+	if flags&fxfExcl != 0 {
+		flag |= wrfs.O_EXCL
+	}
+	perm := wrfs.FileMode(0644)
+	if a.flags&attrPermissions != 0 {
+		perm = toFileMode(a.permissions)
+	}
+	file, err := wrfs.OpenFile(s.fsys, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return s.newHandle(&handle{name: name, file: file, append: flags&fxfAppend != 0}), nil
+}
+
+// read reads up to n bytes at offset off of the file of the given handle.
+func (s *server) read(d *decoder, id string, off int64, n uint32) (packet, error) {
+	h, err := s.handle(d, id)
+	if err != nil {
+		return nil, err
+	}
+	if h.file == nil {
+		return nil, &wrfs.PathError{Op: "read", Path: h.name, Err: syscall.EISDIR}
+	}
+	if n > maxData {
+		n = maxData
+	}
+	buf := make([]byte, n)
+	m, err := h.readAt(buf, off)
+	if m > 0 {
+		return reply(fxpData).bytes(buf[:m]), nil
+	}
+	return nil, err
+}
+
+// readAt reads up to len(p) bytes at offset off of the file of h, returning io.EOF if it reads none.
+func (h *handle) readAt(p []byte, off int64) (n int, err error) {
+	if r, ok := h.file.(io.ReaderAt); ok {
+		n, err = r.ReadAt(p, off)
+	} else if _, err = wrfs.Seek(h.file, off, io.SeekStart); err == nil {
+		n, err = io.ReadFull(h.file, p)
+	}
+	if n > 0 {
+		return n, nil
+	}
+	if err == nil || err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return 0, err
+}
+
+// write writes data at offset off of the file of the given handle, or at its end if it was opened for appending.
+func (s *server) write(d *decoder, id string, off int64, data []byte) error {
+	h, err := s.handle(d, id)
+	if err != nil {
+		return err
+	}
+	if h.file == nil {
+		return &wrfs.PathError{Op: "write", Path: h.name, Err: syscall.EISDIR}
+	}
+	return h.writeAt(data, off)
+}
+
+// writeAt writes p at offset off of the file of h, or at its end if it was opened for appending.
+func (h *handle) writeAt(p []byte, off int64) error {
+	if w, ok := h.file.(io.WriterAt); ok && !h.append {
+		_, err := w.WriteAt(p, off)
+		return err
+	}
+	if !h.append {
+		if _, err := wrfs.Seek(h.file, off, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	_, err := wrfs.Write(h.file, p)
+	return err
+}
+
+// copyData copies n bytes, or all bytes if n is 0, from offset roff of the file of the handle rid to offset woff of
+// the file of the handle wid, as requested with the copy-data extension. Whole files copied into empty ones are
+// cloned with wrfs.Clone where possible.
+func (s *server) copyData(d *decoder, rid string, roff, n int64, wid string, woff int64) error {
+	r, err := s.handle(d, rid)
+	if err != nil {
+		return err
+	}
+	w, err := s.handle(d, wid)
+	if err != nil {
+		return err
+	}
+	if r.file == nil || w.file == nil {
+		return &wrfs.PathError{Op: "copy-data", Path: w.name, Err: syscall.EISDIR}
+	}
+	if roff == 0 && n == 0 && woff == 0 {
+		if fi, err := w.file.Stat(); err == nil && fi.Size() == 0 {
+			if err := wrfs.Clone(w.file, r.file); !errors.Is(err, wrfs.ErrUnsupported) {
+				return err
+			}
+		}
+	}
+	buf := make([]byte, maxData)
+	for copied := int64(0); n == 0 || copied < n; {
+		p := buf
+		if n > 0 && n-copied < int64(len(p)) {
+			p = p[:n-copied]
+		}
+		m, err := r.readAt(p, roff+copied)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := w.writeAt(p[:m], woff+copied); err != nil {
+			return err
+		}
+		copied += int64(m)
+	}
+	return nil
+}
+
+// setstat sets the attributes of the named file.
+func (s *server) setstat(name string, a attrs) error {
+	if a.flags&attrSize != 0 {
+		if err := wrfs.Truncate(s.fsys, name, int64(a.size)); err != nil {
+			return err
+		}
+	}
+	if a.flags&attrPermissions != 0 {
+		if err := wrfs.Chmod(s.fsys, name, toFileMode(a.permissions)); err != nil {
+			return err
+		}
+	}
+	if a.flags&attrUIDGID != 0 {
+		if err := wrfs.Chown(s.fsys, name, int(a.uid), int(a.gid)); err != nil {
+			return err
+		}
+	}
+	if a.flags&attrACModTime != 0 {
+		if err := wrfs.Chtimes(s.fsys, name, a.atime, a.mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readDir returns the next batch of entries of the directory of handle h.
+func (s *server) readDir(h *handle) (packet, error) {
+	if h.file != nil {
+		return nil, &wrfs.PathError{Op: "readdir", Path: h.name, Err: syscall.ENOTDIR}
+	}
+	if len(h.entries) == 0 {
+		return nil, io.EOF
+	}
+	entries := h.entries
+	if len(entries) > readDirBatch {
+		entries = entries[:readDirBatch]
+	}
+	h.entries = h.entries[len(entries):]
+	p := reply(fxpName).uint32(0)
+	var count uint32
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil {
+			continue // removed since it was listed
+		}
+		p = p.string(e.Name()).string(longName(fi)).attrs(fi)
+		count++
+	}
+	binary.BigEndian.PutUint32(p[9:], count)
+	return p, nil
+}
+
+// longName returns the description of a file in the format of "ls -l", which clients may show to users.
+func longName(fi wrfs.FileInfo) string {
+	typ := "-"
+	switch mode := fi.Mode(); {
+	case mode.IsDir():
+		typ = "d"
+	case mode&wrfs.ModeSymlink != 0:
+		typ = "l"
+	case mode&wrfs.ModeNamedPipe != 0:
+		typ = "p"
+	case mode&wrfs.ModeSocket != 0:
+		typ = "s"
+	case mode&wrfs.ModeCharDevice != 0:
+		typ = "c"
+	case mode&wrfs.ModeDevice != 0:
+		typ = "b"
+	}
+	return fmt.Sprintf("%s%s    1 0        0        %8d %s %s", typ, fi.Mode().Perm().String()[1:], fi.Size(),
+		fi.ModTime().Format("Jan _2 15:04"), fi.Name())
+}
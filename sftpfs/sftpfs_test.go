@@ -0,0 +1,300 @@
+package sftpfs_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+	"github.com/relab/wrfs/sftpfs"
+	"github.com/relab/wrfs/wrfstest"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// client sends SFTP requests and decodes the replies, with just enough of the protocol for testing.
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	id   uint32
+}
+
+// field is a field of a packet: a uint32, uint64, or string.
+type field any
+
+func (c *client) send(typ byte, fields ...field) {
+	c.t.Helper()
+	buf := []byte{0, 0, 0, 0, typ}
+	for _, f := range fields {
+		switch f := f.(type) {
+		case uint32:
+			buf = binary.BigEndian.AppendUint32(buf, f)
+		case uint64:
+			buf = binary.BigEndian.AppendUint64(buf, f)
+		case string:
+			buf = binary.BigEndian.AppendUint32(buf, uint32(len(f)))
+			buf = append(buf, f...)
+		}
+	}
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+	_, err := c.conn.Write(buf)
+	check(c.t, err)
+}
+
+// call sends a request with the next ID and returns the type and payload of the reply, after its ID.
+func (c *client) call(typ byte, fields ...field) (byte, *reply) {
+	c.t.Helper()
+	c.id++
+	c.send(typ, append([]field{c.id}, fields...)...)
+	typ, r := c.recv()
+	if id := r.uint32(); id != c.id {
+		c.t.Fatalf("reply has ID %d, want %d", id, c.id)
+	}
+	return typ, r
+}
+
+func (c *client) recv() (byte, *reply) {
+	c.t.Helper()
+	var hdr [4]byte
+	_, err := io.ReadFull(c.conn, hdr[:])
+	check(c.t, err)
+	buf := make([]byte, binary.BigEndian.Uint32(hdr[:]))
+	_, err = io.ReadFull(c.conn, buf)
+	check(c.t, err)
+	return buf[0], &reply{buf[1:]}
+}
+
+// status sends a request and returns the status code of the reply.
+func (c *client) status(typ byte, fields ...field) uint32 {
+	c.t.Helper()
+	rtyp, r := c.call(typ, fields...)
+	if rtyp != 101 {
+		c.t.Fatalf("request %d: got reply %d, want status", typ, rtyp)
+	}
+	return r.uint32()
+}
+
+// handle sends a request and returns the handle of the reply.
+func (c *client) handle(typ byte, fields ...field) string {
+	c.t.Helper()
+	rtyp, r := c.call(typ, fields...)
+	if rtyp != 102 {
+		c.t.Fatalf("request %d: got reply %d with status %d (%s), want handle", typ, rtyp, r.uint32(), r.string())
+	}
+	return r.string()
+}
+
+type reply struct{ buf []byte }
+
+func (r *reply) uint32() uint32 {
+	v := binary.BigEndian.Uint32(r.buf)
+	r.buf = r.buf[4:]
+	return v
+}
+
+func (r *reply) uint64() uint64 {
+	v := binary.BigEndian.Uint64(r.buf)
+	r.buf = r.buf[8:]
+	return v
+}
+
+func (r *reply) string() string {
+	n := r.uint32()
+	s := string(r.buf[:n])
+	r.buf = r.buf[n:]
+	return s
+}
+
+// attrs skips the attributes of a file, returning its size and permissions.
+func (r *reply) attrs() (size uint64, perm uint32) {
+	flags := r.uint32()
+	if flags&0x1 != 0 {
+		size = r.uint64()
+	}
+	if flags&0x2 != 0 {
+		r.uint32()
+		r.uint32()
+	}
+	if flags&0x4 != 0 {
+		perm = r.uint32()
+	}
+	if flags&0x8 != 0 {
+		r.uint32()
+		r.uint32()
+	}
+	return size, perm
+}
+
+func TestServe(t *testing.T) {
+	fsys := memfs.New()
+	check(t, wrfs.MkdirAll(fsys, "dir/sub", 0755))
+	check(t, wrfs.WriteFile(fsys, "dir/file", []byte("hello"), 0644))
+	server, conn := net.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- sftpfs.Serve(server, fsys) }()
+	c := &client{t: t, conn: conn}
+
+	c.send(1, uint32(3))
+	if typ, r := c.recv(); typ != 2 || r.uint32() != 3 {
+		t.Fatalf("got reply %d to init, want version 3", typ)
+	}
+
+	// Write a new file and read it back.
+	h := c.handle(3, "/dir/new", uint32(0x2|0x8|0x20), uint32(0x4), uint32(0600))
+	if code := c.status(6, h, uint64(0), "new contents"); code != 0 {
+		t.Errorf("write: got status %d", code)
+	}
+	if code := c.status(4, h); code != 0 {
+		t.Errorf("close: got status %d", code)
+	}
+	data, err := wrfs.ReadFile(fsys, "dir/new")
+	check(t, err)
+	if string(data) != "new contents" {
+		t.Errorf("dir/new contains %q", data)
+	}
+	h = c.handle(3, "dir/../dir/file", uint32(0x1), uint32(0))
+	if typ, r := c.call(5, h, uint64(1), uint32(100)); typ != 103 || r.string() != "ello" {
+		t.Errorf("read: got reply %d", typ)
+	}
+	if code := c.status(5, h, uint64(5), uint32(100)); code != 1 {
+		t.Errorf("read at end: got status %d, want EOF", code)
+	}
+	c.status(4, h)
+
+	// Stat, list and resolve.
+	typ, r := c.call(17, "/dir/new")
+	if size, perm := r.attrs(); typ != 105 || size != 12 || perm != 0100600 {
+		t.Errorf("stat: got reply %d with size %d and mode %o", typ, size, perm)
+	}
+	h = c.handle(11, "/dir")
+	var names []string
+	for {
+		typ, r := c.call(12, h)
+		if typ == 101 {
+			if code := r.uint32(); code != 1 {
+				t.Errorf("readdir: got status %d, want EOF", code)
+			}
+			break
+		}
+		for n := r.uint32(); n > 0; n-- {
+			names = append(names, r.string())
+			if long := r.string(); !strings.HasSuffix(long, names[len(names)-1]) {
+				t.Errorf("readdir: long name %q", long)
+			}
+			r.attrs()
+		}
+	}
+	c.status(4, h)
+	sort.Strings(names)
+	if got := strings.Join(names, " "); got != "file new sub" {
+		t.Errorf("readdir returned %q", got)
+	}
+	if typ, r := c.call(16, "../dir/./sub/.."); typ != 104 || r.uint32() != 1 || r.string() != "/dir" {
+		t.Errorf("realpath: got reply %d", typ)
+	}
+
+	// Modify the tree.
+	if code := c.status(18, "/dir/new", "/dir/file"); code != 4 {
+		t.Errorf("rename over existing file: got status %d, want failure", code)
+	}
+	if code := c.status(200, "posix-rename@openssh.com", "/dir/new", "/dir/file"); code != 0 {
+		t.Errorf("posix-rename: got status %d", code)
+	}
+	if code := c.status(20, "file", "/dir/link"); code != 0 {
+		t.Errorf("symlink: got status %d", code)
+	}
+	if typ, r := c.call(19, "/dir/link"); typ != 104 || r.uint32() != 1 || r.string() != "file" {
+		t.Errorf("readlink: got reply %d", typ)
+	}
+	if code := c.status(9, "/dir/file", uint32(0x1), uint64(3)); code != 0 {
+		t.Errorf("setstat: got status %d", code)
+	}
+	if code := c.status(15, "/dir/file"); code != 4 {
+		t.Errorf("rmdir of a file: got status %d, want failure", code)
+	}
+	if code := c.status(15, "/dir/sub"); code != 0 {
+		t.Errorf("rmdir: got status %d", code)
+	}
+	if code := c.status(13, "/dir/missing"); code != 2 {
+		t.Errorf("remove of missing file: got status %d, want no such file", code)
+	}
+	if code := c.status(14, "/made", uint32(0)); code != 0 {
+		t.Errorf("mkdir: got status %d", code)
+	}
+	if code := c.status(200, "unknown@example.com"); code != 8 {
+		t.Errorf("unknown extension: got status %d, want unsupported", code)
+	}
+	data, err = wrfs.ReadFile(fsys, "dir/link")
+	check(t, err)
+	if string(data) != "new" {
+		t.Errorf("dir/link contains %q, want %q", data, "new")
+	}
+	if fi, err := wrfs.Stat(fsys, "made"); err != nil || !fi.IsDir() {
+		t.Errorf("made is not a directory: %v", err)
+	}
+
+	// Copy the end of a file into another on the server.
+	rh := c.handle(3, "/dir/file", uint32(0x1), uint32(0))
+	wh := c.handle(3, "/copy", uint32(0x2|0x8), uint32(0))
+	if code := c.status(200, "copy-data", rh, uint64(1), uint64(0), wh, uint64(2)); code != 0 {
+		t.Errorf("copy-data: got status %d", code)
+	}
+	c.status(4, rh)
+	c.status(4, wh)
+	data, err = wrfs.ReadFile(fsys, "copy")
+	check(t, err)
+	if string(data) != "\x00\x00ew" {
+		t.Errorf("copy contains %q, want %q", data, "\x00\x00ew")
+	}
+
+	conn.Close()
+	check(t, <-done)
+}
+
+func TestClient(t *testing.T) {
+	fsys := memfs.New()
+	server, conn := net.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- sftpfs.Serve(server, fsys) }()
+	c, err := sftpfs.NewClient(conn)
+	check(t, err)
+
+	if err := wrfstest.TestWriteFS(c, wrfstest.SkipChown()); err != nil {
+		t.Fatal(err)
+	}
+
+	big := bytes.Repeat([]byte("0123456789"), 100<<10)
+	check(t, wrfs.WriteFile(c, "big", big, 0644))
+	data, err := wrfs.ReadFile(fsys, "big")
+	check(t, err)
+	if !bytes.Equal(data, big) {
+		t.Errorf("big has %d bytes on the server, want %d", len(data), len(big))
+	}
+	data, err = wrfs.ReadFile(c, "big")
+	check(t, err)
+	if !bytes.Equal(data, big) {
+		t.Errorf("big reads back %d bytes, want %d", len(data), len(big))
+	}
+
+	file, err := wrfs.OpenFile(c, "big", wrfs.O_WRONLY|wrfs.O_APPEND, 0)
+	check(t, err)
+	_, err = wrfs.Write(file, []byte("!"))
+	check(t, err)
+	check(t, file.Close())
+	if fi, err := wrfs.Stat(fsys, "big"); err != nil || fi.Size() != int64(len(big))+1 {
+		t.Errorf("appending to big: %v", err)
+	}
+
+	check(t, c.Close())
+	check(t, <-done)
+}
@@ -0,0 +1,70 @@
+package wrfs
+
+import (
+	"os"
+	"path"
+)
+
+// SnapshotFS is a file system that can take snapshots of itself.
+type SnapshotFS interface {
+	FS
+
+	// Snapshot returns a read-only view of the file system as it is at the time of the call.
+	// The view is not affected by later modifications of the file system.
+	Snapshot() (FS, error)
+}
+
+// Snapshot returns a read-only view of fsys as it is at the time of the call, which stays unchanged while
+// fsys is modified, such as for taking consistent backups.
+//
+// If fsys implements SnapshotFS, Snapshot calls fsys.Snapshot. Otherwise, Snapshot copies the tree of fsys,
+// including symbolic links and modification times, into a temporary directory on the local disk. Such a copy
+// is only consistent if fsys is not modified while it is made, and the returned file system implements
+// io.Closer to remove the temporary directory. Callers should therefore close the snapshot when done with it
+// if it implements io.Closer.
+func Snapshot(fsys FS) (FS, error) {
+	if fsys, ok := fsys.(SnapshotFS); ok {
+		return fsys.Snapshot()
+	}
+	return copySnapshot(fsys)
+}
+
+// Snapshot snapshots the underlying file system if it supports snapshots, and copies the subtree otherwise.
+func (f *subFS) Snapshot() (FS, error) {
+	if inner, ok := f.fsys.(*subFS); ok {
+		// Snapshot the subtree of the innermost file system, rather than all of f.fsys.
+		return (&subFS{inner.fsys, path.Join(inner.dir, f.dir)}).Snapshot()
+	}
+	if fsys, ok := f.fsys.(SnapshotFS); ok {
+		snap, err := fsys.Snapshot()
+		if err != nil {
+			return nil, err
+		}
+		return Sub(snap, f.dir)
+	}
+	return copySnapshot(f)
+}
+
+// copySnapshot copies fsys into a temporary directory.
+func copySnapshot(fsys FS) (FS, error) {
+	dir, err := os.MkdirTemp("", "wrfs-snapshot")
+	if err != nil {
+		return nil, err
+	}
+	if err := CopyFS(DirFS(dir), fsys, ".", CopySymlinks(), CopyTimes()); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &tempSnapshot{ReadOnly(DirFS(dir)).(*readOnlyFS), dir}, nil
+}
+
+// tempSnapshot is a snapshot copied into a temporary directory.
+type tempSnapshot struct {
+	*readOnlyFS
+	dir string
+}
+
+// Close removes the temporary directory.
+func (s *tempSnapshot) Close() error {
+	return os.RemoveAll(s.dir)
+}
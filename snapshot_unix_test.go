@@ -0,0 +1,38 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wrfs_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestSnapshot(t *testing.T) {
+	fsys := getFS(t)
+	writeFile(t, fsys, "file", []byte("before"))
+	check(t, Symlink(fsys, "file", "link"))
+
+	snap, err := Snapshot(fsys)
+	check(t, err)
+	writeFile(t, fsys, "file", []byte("after"))
+	checkContents(t, snap, "file", "before")
+	if target, err := Readlink(snap, "link"); err != nil || target != "file" {
+		t.Errorf("Readlink(link) = %q, %v, want %q", target, err, "file")
+	}
+	if err := WriteFile(snap, "file", nil, 0644); !errors.Is(err, ErrPermission) {
+		t.Errorf("WriteFile to snapshot: got %v, want ErrPermission", err)
+	}
+
+	closer, ok := snap.(io.Closer)
+	if !ok {
+		t.Fatal("copied snapshot does not implement io.Closer")
+	}
+	check(t, closer.Close())
+	if _, err := Stat(snap, "file"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat after Close: got %v, want ErrNotExist", err)
+	}
+}
@@ -0,0 +1,77 @@
+package wrfs
+
+import (
+	"errors"
+	"io"
+	"syscall"
+
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// SparseFile is a file that reports the holes of sparse files, ranges of the file that have no space allocated
+// and read as zeros.
+type SparseFile interface {
+	File
+
+	// SeekData sets the offset for the next Read or Write to the start of the first range of data at or after
+	// off, and returns it. If there is no data at or after off, SeekData returns io.EOF.
+	SeekData(off int64) (int64, error)
+
+	// SeekHole sets the offset for the next Read or Write to the start of the first hole at or after off, and
+	// returns it. The end of the file counts as a hole. If off is at or beyond the end of the file, SeekHole
+	// returns io.EOF.
+	SeekHole(off int64) (int64, error)
+}
+
+// SeekData sets the offset for the next Read or Write on file to the start of the first range of data at or after
+// off, and returns it. If there is no data at or after off, SeekData returns io.EOF.
+//
+// If file implements SparseFile, SeekData calls its SeekData method. Files of the host file system use lseek(2)
+// with SEEK_DATA where it is supported. Other files are considered to have no holes.
+func SeekData(file File, off int64) (int64, error) {
+	return seekSparse(file, off, false)
+}
+
+// SeekHole sets the offset for the next Read or Write on file to the start of the first hole at or after off, and
+// returns it. The end of the file counts as a hole. If off is at or beyond the end of the file, SeekHole returns
+// io.EOF.
+//
+// If file implements SparseFile, SeekHole calls its SeekHole method. Files of the host file system use lseek(2)
+// with SEEK_HOLE where it is supported. Other files are considered to have no holes.
+func SeekHole(file File, off int64) (int64, error) {
+	return seekSparse(file, off, true)
+}
+
+func seekSparse(file File, off int64, hole bool) (int64, error) {
+	if file, ok := file.(SparseFile); ok {
+		if hole {
+			return file.SeekHole(off)
+		}
+		return file.SeekData(off)
+	}
+	if f, ok := OSFile(file); ok && seekData != 0 {
+		whence := seekData
+		if hole {
+			whence = seekHole
+		}
+		n, err := f.Seek(off, whence)
+		switch {
+		case errors.Is(err, errno.ENXIO):
+			return 0, io.EOF
+		case !errors.Is(err, syscall.EINVAL):
+			return n, err
+		}
+		// The file system does not support SEEK_DATA and SEEK_HOLE.
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if off >= fi.Size() {
+		return 0, io.EOF
+	}
+	if hole {
+		off = fi.Size()
+	}
+	return Seek(file, off, io.SeekStart)
+}
@@ -0,0 +1,7 @@
+package wrfs
+
+// The whence values of lseek(2) for sparse files, which are not defined by the syscall package.
+const (
+	seekHole = 3
+	seekData = 4
+)
@@ -0,0 +1,10 @@
+//go:build !darwin && !freebsd && !linux
+// +build !darwin,!freebsd,!linux
+
+package wrfs
+
+// Sparse files cannot be seeked on this platform.
+const (
+	seekData = 0
+	seekHole = 0
+)
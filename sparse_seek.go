@@ -0,0 +1,10 @@
+//go:build freebsd || linux
+// +build freebsd linux
+
+package wrfs
+
+// The whence values of lseek(2) for sparse files, which are not defined by the syscall package.
+const (
+	seekData = 3
+	seekHole = 4
+)
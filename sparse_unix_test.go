@@ -0,0 +1,55 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wrfs_test
+
+import (
+	"bytes"
+	"io"
+	"syscall"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestCopySparse(t *testing.T) {
+	fsys := getFS(t)
+	const size, off = 4 << 20, 1 << 20
+	file, err := Create(fsys, "sparse")
+	check(t, err)
+	check(t, file.(TruncateFile).Truncate(size))
+	_, err = file.(io.WriterAt).WriteAt([]byte("data"), off)
+	check(t, err)
+	check(t, file.Close())
+
+	in, err := fsys.Open("sparse")
+	check(t, err)
+	data, err := SeekData(in, 0)
+	check(t, err)
+	hole, err := SeekHole(in, data)
+	check(t, err)
+	if _, err := SeekData(in, size); err != io.EOF {
+		t.Errorf("SeekData at the end of the file: got %v, want io.EOF", err)
+	}
+	check(t, in.Close())
+	if data == 0 {
+		t.Skip("the file system does not report holes")
+	}
+	if data > off || hole <= off {
+		t.Errorf("SeekData = %d and SeekHole = %d, want data around %d", data, hole, off)
+	}
+
+	check(t, CopyFile(fsys, "copy", fsys, "sparse", CopySparse()))
+	want := make([]byte, size)
+	copy(want[off:], "data")
+	got, err := ReadFile(fsys, "copy")
+	check(t, err)
+	if !bytes.Equal(got, want) {
+		t.Error("the copy of the sparse file has different contents")
+	}
+	fi, err := Stat(fsys, "copy")
+	check(t, err)
+	if blocks := fi.Sys().(*syscall.Stat_t).Blocks; blocks*512 >= size {
+		t.Errorf("the copy of the sparse file has %d blocks allocated", blocks)
+	}
+}
@@ -0,0 +1,26 @@
+package wrfs
+
+// FSInfo describes the capacity of a file system.
+type FSInfo struct {
+	Total     uint64 // total size in bytes
+	Free      uint64 // free bytes
+	Available uint64 // free bytes available to unprivileged users
+	Files     uint64 // total number of file nodes (inodes), or 0 if unknown
+	FreeFiles uint64 // free file nodes, or 0 if unknown
+}
+
+// StatfsFS is a file system with a Statfs method.
+type StatfsFS interface {
+	FS
+
+	// Statfs returns information about the capacity of the file system containing the named file.
+	Statfs(name string) (FSInfo, error)
+}
+
+// Statfs returns information about the capacity of the file system containing the named file.
+func Statfs(fsys FS, name string) (FSInfo, error) {
+	if fsys, ok := fsys.(StatfsFS); ok {
+		return fsys.Statfs(name)
+	}
+	return FSInfo{}, &PathError{Op: "statfs", Path: name, Err: ErrUnsupported}
+}
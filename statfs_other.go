@@ -0,0 +1,8 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!windows
+
+package wrfs
+
+func (hostFS) Statfs(name string) (FSInfo, error) {
+	return FSInfo{}, &PathError{Op: "statfs", Path: name, Err: ErrUnsupported}
+}
@@ -0,0 +1,21 @@
+//go:build darwin || dragonfly || freebsd || linux
+// +build darwin dragonfly freebsd linux
+
+package wrfs
+
+import "syscall"
+
+func (hostFS) Statfs(name string) (FSInfo, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(name, &st); err != nil {
+		return FSInfo{}, &PathError{Op: "statfs", Path: name, Err: err}
+	}
+	bsize := uint64(st.Bsize)
+	return FSInfo{
+		Total:     uint64(st.Blocks) * bsize,
+		Free:      uint64(st.Bfree) * bsize,
+		Available: uint64(st.Bavail) * bsize,
+		Files:     uint64(st.Files),
+		FreeFiles: uint64(st.Ffree),
+	}, nil
+}
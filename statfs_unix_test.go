@@ -0,0 +1,19 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wrfs_test
+
+import (
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestStatfs(t *testing.T) {
+	fsys := getFS(t)
+	info, err := Statfs(fsys, ".")
+	check(t, err)
+	if info.Total == 0 || info.Available > info.Total {
+		t.Errorf("implausible file system info: %+v", info)
+	}
+}
@@ -0,0 +1,26 @@
+package wrfs
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procGetDiskFreeSpaceExW = modkernel32.NewProc("GetDiskFreeSpaceExW")
+
+func (hostFS) Statfs(name string) (FSInfo, error) {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return FSInfo{}, &PathError{Op: "statfs", Path: name, Err: err}
+	}
+	var available, total, free uint64
+	r, _, err := procGetDiskFreeSpaceExW.Call(
+		uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(&available)),
+		uintptr(unsafe.Pointer(&total)),
+		uintptr(unsafe.Pointer(&free)),
+	)
+	if r == 0 {
+		return FSInfo{}, &PathError{Op: "statfs", Path: name, Err: err}
+	}
+	return FSInfo{Total: total, Free: free, Available: available}, nil
+}
@@ -0,0 +1,321 @@
+package wrfs
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// statsSamples is the number of latency samples kept per operation for computing percentiles.
+const statsSamples = 1024
+
+// A StatsCollector collects statistics about the operations performed on file systems wrapped with WithStats.
+// It keeps per-operation counts, error counts and latency percentiles, and an approximate list of the most
+// frequently accessed paths. A StatsCollector is safe for concurrent use, and may be shared by several file systems.
+//
+// StatsCollector implements expvar.Var, so it can be published with expvar.Publish.
+type StatsCollector struct {
+	mu    sync.Mutex
+	ops   map[string]*opStats
+	paths map[string]int64
+	topN  int
+}
+
+type opStats struct {
+	count   int64
+	errors  int64
+	total   time.Duration
+	max     time.Duration
+	samples []time.Duration // ring buffer of the most recent latencies
+	next    int
+}
+
+// NewStatsCollector returns a StatsCollector that tracks the topN most frequently accessed paths.
+func NewStatsCollector(topN int) *StatsCollector {
+	return &StatsCollector{
+		ops:   make(map[string]*opStats),
+		paths: make(map[string]int64),
+		topN:  topN,
+	}
+}
+
+// WithStats returns a file system that records statistics about every operation on fsys in c.
+func WithStats(fsys FS, c *StatsCollector) FS {
+	return &statsFS{fsWrapper{fsys}, c}
+}
+
+func (c *StatsCollector) observe(op, name string, d time.Duration, failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.ops[op]
+	if !ok {
+		s = &opStats{}
+		c.ops[op] = s
+	}
+	s.count++
+	if failed {
+		s.errors++
+	}
+	s.total += d
+	if d > s.max {
+		s.max = d
+	}
+	if len(s.samples) < statsSamples {
+		s.samples = append(s.samples, d)
+	} else {
+		s.samples[s.next] = d
+		s.next = (s.next + 1) % statsSamples
+	}
+
+	if c.topN > 0 {
+		c.countPath(name)
+	}
+}
+
+// countPath counts an access to name using the space-saving algorithm,
+// which bounds the number of tracked paths while keeping the counts of frequent paths accurate.
+func (c *StatsCollector) countPath(name string) {
+	if _, ok := c.paths[name]; ok || len(c.paths) < 16*c.topN {
+		c.paths[name]++
+		return
+	}
+	var minName string
+	minCount := int64(-1)
+	for p, n := range c.paths {
+		if minCount < 0 || n < minCount {
+			minName, minCount = p, n
+		}
+	}
+	delete(c.paths, minName)
+	c.paths[name] = minCount + 1
+}
+
+// OpStats describes the statistics of a single operation.
+type OpStats struct {
+	Count  int64         `json:"count"`
+	Errors int64         `json:"errors"`
+	Mean   time.Duration `json:"mean"`
+	P50    time.Duration `json:"p50"`
+	P90    time.Duration `json:"p90"`
+	P99    time.Duration `json:"p99"`
+	Max    time.Duration `json:"max"`
+}
+
+// ErrorRate returns the fraction of operations that failed.
+func (s OpStats) ErrorRate() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Count)
+}
+
+// PathCount is the approximate number of operations performed on a path.
+type PathCount struct {
+	Path  string `json:"path"`
+	Count int64  `json:"count"`
+}
+
+// Stats is a snapshot of the statistics collected by a StatsCollector.
+// The percentiles are computed from the most recent operations.
+type Stats struct {
+	Ops      map[string]OpStats `json:"ops"`
+	HotPaths []PathCount        `json:"hot_paths"`
+}
+
+// Stats returns a snapshot of the collected statistics.
+func (c *StatsCollector) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := Stats{Ops: make(map[string]OpStats, len(c.ops))}
+	for op, s := range c.ops {
+		samples := append([]time.Duration(nil), s.samples...)
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		stats.Ops[op] = OpStats{
+			Count:  s.count,
+			Errors: s.errors,
+			Mean:   s.total / time.Duration(s.count),
+			P50:    percentile(samples, 50),
+			P90:    percentile(samples, 90),
+			P99:    percentile(samples, 99),
+			Max:    s.max,
+		}
+	}
+
+	for p, n := range c.paths {
+		stats.HotPaths = append(stats.HotPaths, PathCount{p, n})
+	}
+	sort.Slice(stats.HotPaths, func(i, j int) bool {
+		a, b := stats.HotPaths[i], stats.HotPaths[j]
+		return a.Count > b.Count || (a.Count == b.Count && a.Path < b.Path)
+	})
+	if len(stats.HotPaths) > c.topN {
+		stats.HotPaths = stats.HotPaths[:c.topN]
+	}
+	return stats
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[(len(sorted)-1)*p/100]
+}
+
+// Reset discards all collected statistics.
+func (c *StatsCollector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ops = make(map[string]*opStats)
+	c.paths = make(map[string]int64)
+}
+
+// String returns the collected statistics encoded as JSON.
+func (c *StatsCollector) String() string {
+	data, err := json.Marshal(c.Stats())
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+type statsFS struct {
+	fsWrapper
+	c *StatsCollector
+}
+
+func (s *statsFS) record(op, name string, start time.Time, errPtr *error) {
+	s.c.observe(op, name, time.Since(start), *errPtr != nil)
+}
+
+func (s *statsFS) Open(name string) (file File, err error) {
+	defer s.record("open", name, time.Now(), &err)
+	return s.fsys.Open(name)
+}
+
+func (s *statsFS) Stat(name string) (fi FileInfo, err error) {
+	defer s.record("stat", name, time.Now(), &err)
+	return Stat(s.fsys, name)
+}
+
+func (s *statsFS) Lstat(name string) (fi FileInfo, err error) {
+	defer s.record("lstat", name, time.Now(), &err)
+	return Lstat(s.fsys, name)
+}
+
+func (s *statsFS) ReadDir(name string) (entries []DirEntry, err error) {
+	defer s.record("readdir", name, time.Now(), &err)
+	return ReadDir(s.fsys, name)
+}
+
+func (s *statsFS) ReadFile(name string) (data []byte, err error) {
+	defer s.record("readfile", name, time.Now(), &err)
+	return ReadFile(s.fsys, name)
+}
+
+func (s *statsFS) Glob(pattern string) (matches []string, err error) {
+	defer s.record("glob", pattern, time.Now(), &err)
+	return Glob(s.fsys, pattern)
+}
+
+func (s *statsFS) OpenFile(name string, flag int, perm FileMode) (file File, err error) {
+	defer s.record("openfile", name, time.Now(), &err)
+	return OpenFile(s.fsys, name, flag, perm)
+}
+
+func (s *statsFS) WriteFile(name string, data []byte, perm FileMode) (err error) {
+	defer s.record("writefile", name, time.Now(), &err)
+	return WriteFile(s.fsys, name, data, perm)
+}
+
+func (s *statsFS) Chmod(name string, mode FileMode) (err error) {
+	defer s.record("chmod", name, time.Now(), &err)
+	return Chmod(s.fsys, name, mode)
+}
+
+func (s *statsFS) Chown(name string, uid, gid int) (err error) {
+	defer s.record("chown", name, time.Now(), &err)
+	return Chown(s.fsys, name, uid, gid)
+}
+
+func (s *statsFS) Lchown(name string, uid, gid int) (err error) {
+	defer s.record("lchown", name, time.Now(), &err)
+	return Lchown(s.fsys, name, uid, gid)
+}
+
+func (s *statsFS) Chtimes(name string, atime, mtime time.Time) (err error) {
+	defer s.record("chtimes", name, time.Now(), &err)
+	return Chtimes(s.fsys, name, atime, mtime)
+}
+
+func (s *statsFS) Mkdir(name string, perm FileMode) (err error) {
+	defer s.record("mkdir", name, time.Now(), &err)
+	return Mkdir(s.fsys, name, perm)
+}
+
+func (s *statsFS) MkdirAll(path string, perm FileMode) (err error) {
+	defer s.record("mkdirall", path, time.Now(), &err)
+	return MkdirAll(s.fsys, path, perm)
+}
+
+func (s *statsFS) Readlink(name string) (link string, err error) {
+	defer s.record("readlink", name, time.Now(), &err)
+	return Readlink(s.fsys, name)
+}
+
+func (s *statsFS) Remove(name string) (err error) {
+	defer s.record("remove", name, time.Now(), &err)
+	return Remove(s.fsys, name)
+}
+
+func (s *statsFS) RemoveAll(path string) (err error) {
+	defer s.record("removeall", path, time.Now(), &err)
+	return RemoveAll(s.fsys, path)
+}
+
+func (s *statsFS) Rename(oldpath, newpath string) (err error) {
+	defer s.record("rename", oldpath, time.Now(), &err)
+	return Rename(s.fsys, oldpath, newpath)
+}
+
+func (s *statsFS) Symlink(oldname, newname string) (err error) {
+	defer s.record("symlink", newname, time.Now(), &err)
+	return Symlink(s.fsys, oldname, newname)
+}
+
+func (s *statsFS) Link(oldname, newname string) (err error) {
+	defer s.record("link", newname, time.Now(), &err)
+	return Link(s.fsys, oldname, newname)
+}
+
+func (s *statsFS) Sync(name string) (err error) {
+	defer s.record("sync", name, time.Now(), &err)
+	return Sync(s.fsys, name)
+}
+
+func (s *statsFS) SyncDir(dir string) (err error) {
+	defer s.record("syncdir", dir, time.Now(), &err)
+	return SyncDir(s.fsys, dir)
+}
+
+func (s *statsFS) Statfs(name string) (info FSInfo, err error) {
+	defer s.record("statfs", name, time.Now(), &err)
+	return Statfs(s.fsys, name)
+}
+
+func (s *statsFS) OpenLock(name string) (file LockFile, err error) {
+	defer s.record("openlock", name, time.Now(), &err)
+	return OpenLock(s.fsys, name)
+}
+
+func (s *statsFS) Watch(name string, opts ...WatchOption) (events <-chan Event, stop func(), err error) {
+	defer s.record("watch", name, time.Now(), &err)
+	return Watch(s.fsys, name, opts...)
+}
+
+func (s *statsFS) Truncate(name string, size int64) (err error) {
+	defer s.record("truncate", name, time.Now(), &err)
+	return Truncate(s.fsys, name, size)
+}
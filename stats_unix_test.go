@@ -0,0 +1,36 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wrfs_test
+
+import (
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestWithStats(t *testing.T) {
+	c := NewStatsCollector(2)
+	fsys := WithStats(getFS(t), c)
+	fileName := "TestWithStats"
+
+	newFile(t, fsys, fileName)
+	for i := 0; i < 3; i++ {
+		_, err := Stat(fsys, fileName)
+		check(t, err)
+	}
+	if _, err := Stat(fsys, "missing"); err == nil {
+		t.Fatal("expected an error, but got nil")
+	}
+
+	stats := c.Stats()
+	if got := stats.Ops["stat"]; got.Count != 4 || got.Errors != 1 {
+		t.Errorf("wrong stat stats: got: %+v", got)
+	}
+	if got := stats.Ops["openfile"].Count; got != 1 {
+		t.Errorf("wrong openfile count: got: %d, want: %d", got, 1)
+	}
+	if len(stats.HotPaths) == 0 || stats.HotPaths[0].Path != fileName || stats.HotPaths[0].Count != 4 {
+		t.Errorf("wrong hot paths: %+v", stats.HotPaths)
+	}
+}
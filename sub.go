@@ -5,6 +5,7 @@
 package wrfs
 
 import (
+	"context"
 	"errors"
 	"path"
 	"time"
@@ -146,6 +147,141 @@ func (f *subFS) OpenFile(name string, flag int, perm FileMode) (File, error) {
 	return file, f.fixErr(err)
 }
 
+func (f *subFS) WriteFile(name string, data []byte, perm FileMode) error {
+	return f.pathAction(name, "open", func(fsys FS, path string) error {
+		return WriteFile(fsys, path, data, perm)
+	})
+}
+
+func (f *subFS) Sync(name string) error {
+	return f.pathAction(name, "sync", Sync)
+}
+
+func (f *subFS) SyncDir(dir string) error {
+	return f.pathAction(dir, "sync", SyncDir)
+}
+
+func (f *subFS) Statfs(name string) (FSInfo, error) {
+	full, err := f.fullName("statfs", name)
+	if err != nil {
+		return FSInfo{}, err
+	}
+	info, err := Statfs(f.fsys, full)
+	return info, f.fixErr(err)
+}
+
+func (f *subFS) StatTimes(name string) (FileTimes, error) {
+	full, err := f.fullName("stat", name)
+	if err != nil {
+		return FileTimes{}, err
+	}
+	t, err := StatTimes(f.fsys, full)
+	return t, f.fixErr(err)
+}
+
+func (f *subFS) OpenLock(name string) (LockFile, error) {
+	full, err := f.fullName("lock", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := OpenLock(f.fsys, full)
+	return file, f.fixErr(err)
+}
+
+func (f *subFS) MkdirTemp(dir, pattern string) (string, error) {
+	if dir == "" {
+		dir = "."
+	}
+	full, err := f.fullName("mkdirtemp", dir)
+	if err != nil {
+		return "", err
+	}
+	name, err := MkdirTemp(f.fsys, full, pattern)
+	if err != nil {
+		return "", f.fixErr(err)
+	}
+	return f.shortenTemp(name)
+}
+
+func (f *subFS) CreateTemp(dir, pattern string) (File, string, error) {
+	if dir == "" {
+		dir = "."
+	}
+	full, err := f.fullName("createtemp", dir)
+	if err != nil {
+		return nil, "", err
+	}
+	file, name, err := CreateTemp(f.fsys, full, pattern)
+	if err != nil {
+		return nil, "", f.fixErr(err)
+	}
+	name, err = f.shortenTemp(name)
+	if err != nil {
+		file.Close()
+		return nil, "", err
+	}
+	return file, name, nil
+}
+
+func (f *subFS) shortenTemp(name string) (string, error) {
+	short, ok := f.shorten(name)
+	if !ok {
+		return "", errors.New("invalid result from inner fsys temp: " + name + " not in " + f.dir)
+	}
+	return short, nil
+}
+
+func (f *subFS) Watch(name string, opts ...WatchOption) (<-chan Event, func(), error) {
+	full, err := f.fullName("watch", name)
+	if err != nil {
+		return nil, nil, err
+	}
+	events, stop, err := Watch(f.fsys, full, opts...)
+	if err != nil {
+		return nil, nil, f.fixErr(err)
+	}
+	events, stop = mapEvents(events, stop, NewWatchConfig(opts...).Buffer, f.shorten)
+	return events, stop, nil
+}
+
+func (f *subFS) OpenContext(ctx context.Context, name string) (File, error) {
+	full, err := f.fullName("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := OpenContext(ctx, f.fsys, full)
+	return file, f.fixErr(err)
+}
+
+func (f *subFS) OpenFileContext(ctx context.Context, name string, flag int, perm FileMode) (File, error) {
+	full, err := f.fullName("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := OpenFileContext(ctx, f.fsys, full, flag, perm)
+	return file, f.fixErr(err)
+}
+
+func (f *subFS) RemoveContext(ctx context.Context, name string) error {
+	full, err := f.fullName("remove", name)
+	if err != nil {
+		return err
+	}
+	return f.fixErr(RemoveContext(ctx, f.fsys, full))
+}
+
+func (f *subFS) RemoveAllContext(ctx context.Context, name string) error {
+	full, err := f.fullName("removeall", name)
+	if err != nil {
+		return err
+	}
+	return f.fixErr(RemoveAllContext(ctx, f.fsys, full))
+}
+
+func (f *subFS) Capabilities() CapSet {
+	return Capabilities(f.fsys)
+}
+
 func (f *subFS) Chmod(name string, mode FileMode) error {
 	return f.permAction(name, mode, "chmod", Chmod)
 }
@@ -162,6 +298,42 @@ func (f *subFS) Lchown(name string, uid, gid int) error {
 	})
 }
 
+func (f *subFS) Lchtimes(name string, atime, mtime time.Time) error {
+	return f.pathAction(name, "lchtimes", func(fsys FS, path string) error {
+		return Lchtimes(fsys, path, atime, mtime)
+	})
+}
+
+func (f *subFS) Attributes(name string) (FileAttributes, error) {
+	full, err := f.fullName("attributes", name)
+	if err != nil {
+		return 0, err
+	}
+	attrs, err := Attributes(f.fsys, full)
+	return attrs, f.fixErr(err)
+}
+
+func (f *subFS) SetAttributes(name string, attrs FileAttributes) error {
+	return f.pathAction(name, "setattributes", func(fsys FS, path string) error {
+		return SetAttributes(fsys, path, attrs)
+	})
+}
+
+func (f *subFS) SecurityDescriptor(name string) (string, error) {
+	full, err := f.fullName("getsecurity", name)
+	if err != nil {
+		return "", err
+	}
+	sddl, err := SecurityDescriptor(f.fsys, full)
+	return sddl, f.fixErr(err)
+}
+
+func (f *subFS) SetSecurityDescriptor(name, sddl string) error {
+	return f.pathAction(name, "setsecurity", func(fsys FS, path string) error {
+		return SetSecurityDescriptor(fsys, path, sddl)
+	})
+}
+
 func (f *subFS) Chtimes(name string, atime, mtime time.Time) error {
 	return f.pathAction(name, "chtimes", func(fsys FS, path string) error {
 		return Chtimes(fsys, path, atime, mtime)
@@ -176,6 +348,16 @@ func (f *subFS) MkdirAll(path string, perm FileMode) error {
 	return f.permAction(path, perm, "mkdir", MkdirAll)
 }
 
+func (f *subFS) Mkfifo(name string, perm FileMode) error {
+	return f.permAction(name, perm, "mkfifo", Mkfifo)
+}
+
+func (f *subFS) Mknod(name string, mode FileMode, dev uint64) error {
+	return f.pathAction(name, "mknod", func(fsys FS, path string) error {
+		return Mknod(fsys, path, mode, dev)
+	})
+}
+
 func (f *subFS) Readlink(name string) (string, error) {
 	full, err := f.fullName("readlink", name)
 	if err != nil {
@@ -207,8 +389,20 @@ func (f *subFS) SameFile(fi1, fi2 FileInfo) bool {
 	return SameFile(f.fsys, fi1, fi2)
 }
 
+// Symlink creates newname as a symbolic link to oldname.
+// The link target is stored as given, so relative targets are resolved relative to the link's directory.
 func (f *subFS) Symlink(oldname, newname string) error {
-	return f.linkAction(oldname, newname, "symlink", Symlink)
+	full, err := f.fullName("symlink", newname)
+	if err != nil {
+		return &LinkError{Op: "symlink", Old: oldname, New: newname, Err: err.(*PathError).Err}
+	}
+	err = Symlink(f.fsys, oldname, full)
+	if e, ok := err.(*LinkError); ok {
+		if short, ok := f.shorten(e.New); ok {
+			e.New = short
+		}
+	}
+	return err
 }
 
 func (f *subFS) Link(oldname, newname string) error {
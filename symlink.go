@@ -1,7 +1,5 @@
 package wrfs
 
-import "os"
-
 // SymlinkFS is a file system with a Symlink method.
 type SymlinkFS interface {
 	FS
@@ -15,5 +13,5 @@ func Symlink(fsys FS, oldname, newname string) error {
 	if fsys, ok := fsys.(SymlinkFS); ok {
 		return fsys.Symlink(oldname, newname)
 	}
-	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrUnsupported}
+	return &LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrUnsupported}
 }
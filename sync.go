@@ -0,0 +1,66 @@
+package wrfs
+
+// SyncFile is a file with a Sync method.
+type SyncFile interface {
+	File
+
+	// Sync commits the current contents of the file to stable storage.
+	Sync() error
+}
+
+// SyncFS is a file system with a Sync method.
+type SyncFS interface {
+	FS
+
+	// Sync commits the current contents of the named file to stable storage.
+	Sync(name string) error
+}
+
+// Sync commits the current contents of the named file to stable storage.
+//
+// If fsys implements SyncFS, Sync calls fsys.Sync.
+// Otherwise Sync opens the file and calls its Sync method.
+func Sync(fsys FS, name string) (err error) {
+	if fsys, ok := fsys.(SyncFS); ok {
+		return fsys.Sync(name)
+	}
+
+	file, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer safeClose(file, &err)
+
+	if file, ok := file.(SyncFile); ok {
+		return file.Sync()
+	}
+	return &PathError{Op: "sync", Path: name, Err: ErrUnsupported}
+}
+
+// SyncDirFS is a file system with a SyncDir method.
+type SyncDirFS interface {
+	FS
+
+	// SyncDir commits the entries of the named directory to stable storage.
+	SyncDir(dir string) error
+}
+
+// SyncDir commits the entries of the named directory to stable storage, such as the new name of a file renamed
+// into it. On Linux, a renamed or created file only survives a crash once its directory has been synced.
+//
+// If fsys implements SyncDirFS, SyncDir calls fsys.SyncDir.
+// Otherwise SyncDir opens the directory and calls its Sync method.
+func SyncDir(fsys FS, dir string) error {
+	if fsys, ok := fsys.(SyncDirFS); ok {
+		return fsys.SyncDir(dir)
+	}
+	return Sync(fsys, dir)
+}
+
+// syncDir commits the entries of the named directory to stable storage, if the file system supports it.
+func syncDir(fsys FS, dir string) error {
+	if err := SyncDir(fsys, dir); !IsNotSupported(err) {
+		return err
+	}
+	return nil
+}
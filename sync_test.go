@@ -0,0 +1,68 @@
+package wrfs_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+)
+
+func TestSyncDir(t *testing.T) {
+	testCase := func(fsys FS) {
+		check(t, Mkdir(fsys, "dir", 0755))
+		check(t, WriteFileAtomic(fsys, "dir/file", []byte("x"), 0644))
+		if err := SyncDir(fsys, "dir"); err != nil {
+			t.Errorf("SyncDir: %v", err)
+		}
+		if err := SyncDir(ReadOnly(fsys), "."); err != nil {
+			t.Errorf("SyncDir through ReadOnly: %v", err)
+		}
+		if err := SyncDir(fsys, "missing"); !errors.Is(err, ErrNotExist) {
+			t.Errorf("SyncDir of a missing directory: got %v, want ErrNotExist", err)
+		}
+	}
+
+	t.Run("memfs", func(t *testing.T) { testCase(memfs.New()) })
+	t.Run("DirFS", func(t *testing.T) { testCase(DirFS(t.TempDir())) })
+
+	// Wrappers see SyncDir like the other operations.
+	fsys := syncDirFS{memfs.New(), new([]string)}
+	check(t, Mkdir(fsys, "dir", 0755))
+	collector := NewStatsCollector(0)
+	var ops []string
+	wrapped := WithStats(Wrap(fsys, InterceptorFunc(func(inv *Invocation, next func() error) error {
+		if inv.Op == "syncdir" {
+			ops = append(ops, inv.Path)
+		}
+		return next()
+	})), collector)
+	if caps := Capabilities(wrapped); !caps.Has(CapSyncDir) {
+		t.Errorf("Capabilities(WithStats(Wrap(fsys))) = %v, want syncdir", caps)
+	}
+	if caps := Capabilities(Failover([]FS{fsys})); caps.Has(CapSyncDir) {
+		t.Errorf("Capabilities(Failover(fsys)) = %v, want no syncdir", caps)
+	}
+	check(t, SyncDir(CaseInsensitive(wrapped), "DIR"))
+	if len(ops) != 1 || ops[0] != "dir" || len(*fsys.synced) != 1 || (*fsys.synced)[0] != "dir" {
+		t.Errorf("intercepted SyncDir of %q and synced %q, want dir", ops, *fsys.synced)
+	}
+	if n := collector.Stats().Ops["syncdir"].Count; n != 1 {
+		t.Errorf("WithStats counted %d syncdir operations, want 1", n)
+	}
+	hidden := Filter(fsys, func(p string, d DirEntry) bool { return p != "dir" })
+	if err := SyncDir(hidden, "dir"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("SyncDir of a filtered directory: got %v, want ErrNotExist", err)
+	}
+}
+
+// syncDirFS is a memfs.FS that records the directories synced with SyncDir.
+type syncDirFS struct {
+	*memfs.FS
+	synced *[]string
+}
+
+func (f syncDirFS) SyncDir(dir string) error {
+	*f.synced = append(*f.synced, dir)
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wrfs_test
+
+import (
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestSync(t *testing.T) {
+	fsys := getFS(t)
+	fileName := "TestSync"
+	newFile(t, fsys, fileName)
+
+	testCase := func(fsys FS) {
+		check(t, Sync(fsys, fileName))
+	}
+	t.Run("", func(t *testing.T) { testCase(fsys) })
+	t.Run("OpenFileOnly", func(t *testing.T) { testCase(openFileOnly{fsys.(OpenFileFS)}) })
+}
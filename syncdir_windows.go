@@ -0,0 +1,19 @@
+package wrfs
+
+import (
+	"os"
+	"syscall"
+)
+
+// SyncDir only checks that dir is a directory, since Windows cannot flush directories, and NTFS journals
+// changes to their entries itself.
+func (hostFS) SyncDir(dir string) error {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return &PathError{Op: "sync", Path: dir, Err: syscall.ENOTDIR}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package tarfs
+
+import (
+	"archive/tar"
+	"io"
+	"path"
+	"time"
+
+	"github.com/relab/wrfs"
+)
+
+// A CreateOption configures Create.
+type CreateOption func(*createConfig)
+
+type createConfig struct {
+	owners bool
+}
+
+// CreateOwners makes Create record the user and group IDs and names of the owners of the files, where the file
+// system reports them, instead of leaving them zero and empty.
+func CreateOwners() CreateOption {
+	return func(c *createConfig) { c.owners = true }
+}
+
+// Create writes a tar archive of the tree rooted at root in src to w, naming the files by their paths relative to
+// root. The archive holds the directories, regular files and symbolic links of the tree with their permission bits
+// and modification times, in lexical order, such that archiving the same tree twice yields the same archive. Other
+// types of files cause Create to fail with an error matching wrfs.ErrInvalid. Files with several hard links are
+// archived as separate files.
+//
+// Create does not close w.
+func Create(w io.Writer, src wrfs.FS, root string, opts ...CreateOption) error {
+	var c createConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	root = path.Clean(root)
+	tw := tar.NewWriter(w)
+	err := wrfs.WalkDir(src, root, func(name string, d wrfs.DirEntry, err error) error {
+		if err != nil || name == root {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return writeFile(tw, src, name, relName(root, name), fi, &c)
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// writeFile writes the header and contents of the named file of src, which is described by fi, to tw under the
+// name hdrName.
+func writeFile(tw *tar.Writer, src wrfs.FS, name, hdrName string, fi wrfs.FileInfo, c *createConfig) error {
+	var link string
+	switch mode := fi.Mode(); {
+	case mode&wrfs.ModeSymlink != 0:
+		var err error
+		if link, err = wrfs.Readlink(src, name); err != nil {
+			return err
+		}
+	case !mode.IsDir() && !mode.IsRegular():
+		return &wrfs.PathError{Op: "create", Path: name, Err: wrfs.ErrInvalid}
+	}
+	hdr, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = hdrName
+	if fi.IsDir() {
+		hdr.Name += "/"
+	}
+	hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+	if !c.owners {
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+	return copyFile(tw, src, name)
+}
+
+// relName returns name relative to root, where name is inside root.
+func relName(root, name string) string {
+	if root == "." {
+		return name
+	}
+	return name[len(root)+1:]
+}
+
+// copyFile writes the contents of the named file to w.
+func copyFile(w io.Writer, fsys wrfs.FS, name string) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
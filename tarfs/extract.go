@@ -0,0 +1,155 @@
+// Package tarfs extracts tar archives into wrfs file systems, and creates them from wrfs file systems.
+package tarfs
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/extract"
+)
+
+// A SymlinkPolicy determines how Extract handles symbolic links.
+type SymlinkPolicy int
+
+const (
+	// SymlinksInside creates the symbolic links whose targets are relative paths inside the file system, and fails
+	// with an error matching wrfs.ErrPermission on others. It is the default.
+	SymlinksInside SymlinkPolicy = iota
+	// SymlinksSkip skips all symbolic links.
+	SymlinksSkip
+	// SymlinksAny creates all symbolic links, wherever they point.
+	SymlinksAny
+)
+
+// An ExtractOption configures Extract.
+type ExtractOption func(*extractConfig)
+
+type extractConfig struct {
+	symlinks SymlinkPolicy
+	owners   bool
+}
+
+// Symlinks sets the policy for the symbolic links in the archive.
+func Symlinks(policy SymlinkPolicy) ExtractOption {
+	return func(c *extractConfig) { c.symlinks = policy }
+}
+
+// Owners makes Extract set the owners of the files to the user and group IDs in the archive, with Lchown.
+func Owners() ExtractOption {
+	return func(c *extractConfig) { c.owners = true }
+}
+
+// Extract extracts the files of the archive read by r into dst. Directories are created with MkdirAll, regular
+// files with OpenFile, replacing existing files, and symbolic and hard links with Symlink and Link. The permission
+// bits and modification times of the archive are then set with Chmod and Chtimes, where dst supports them; those of
+// directories once all files have been extracted. Other types of files, such as devices, are skipped.
+//
+// Extract refuses to write outside of dst: names in the archive that are absolute or lead outside with "..", names
+// whose parent directories are symbolic links in dst, and directories whose names are symbolic links in dst cause it
+// to fail with an error matching wrfs.ErrPermission, as do symbolic links with targets outside of dst unless
+// SymlinksAny is given.
+func Extract(dst wrfs.FS, r *tar.Reader, opts ...ExtractOption) error {
+	var c extractConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	var dirs []*tar.Header
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name, err := extract.SafeName(dst, hdr.Name)
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if name != "." {
+				if err = extract.NotSymlink(dst, name); err == nil {
+					err = wrfs.MkdirAll(dst, name, 0755)
+				}
+			}
+			dirs = append(dirs, hdr)
+		case tar.TypeReg:
+			err = extractFile(dst, name, r)
+		case tar.TypeSymlink:
+			if c.symlinks == SymlinksSkip {
+				continue
+			}
+			if c.symlinks == SymlinksInside && !extract.Inside(name, hdr.Linkname) {
+				return &wrfs.LinkError{Op: "extract", Old: hdr.Linkname, New: hdr.Name, Err: wrfs.ErrPermission}
+			}
+			if err = extract.Replace(dst, name); err == nil {
+				err = wrfs.Symlink(dst, hdr.Linkname, name)
+			}
+		case tar.TypeLink:
+			var target string
+			if target, err = extract.SafeName(dst, hdr.Linkname); err != nil {
+				return err
+			}
+			if err = extract.Replace(dst, name); err == nil {
+				err = wrfs.Link(dst, target, name)
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		// Hard links share the metadata of their targets, which has been set already.
+		if hdr.Typeflag != tar.TypeDir && hdr.Typeflag != tar.TypeLink {
+			if err := setMetadata(dst, name, hdr, &c); err != nil {
+				return err
+			}
+		}
+	}
+	// Extracting the files of a directory changes its modification time, so it is set last.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		name, err := extract.SafeName(dst, dirs[i].Name)
+		if err != nil {
+			return err
+		}
+		if err := setMetadata(dst, name, dirs[i], &c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractFile writes the contents of the current file of r to name.
+func extractFile(dst wrfs.FS, name string, r io.Reader) (err error) {
+	if err := extract.Replace(dst, name); err != nil {
+		return err
+	}
+	file, err := wrfs.OpenFile(dst, name, wrfs.O_WRONLY|wrfs.O_CREATE|wrfs.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	w, ok := file.(io.Writer)
+	if !ok {
+		return &wrfs.PathError{Op: "write", Path: name, Err: wrfs.ErrUnsupported}
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// setMetadata sets the owner of name from hdr with Owners, and its permission bits and modification time.
+func setMetadata(dst wrfs.FS, name string, hdr *tar.Header, c *extractConfig) error {
+	if c.owners {
+		if err := wrfs.Lchown(dst, name, hdr.Uid, hdr.Gid); err != nil && !errors.Is(err, wrfs.ErrUnsupported) {
+			return err
+		}
+	}
+	return extract.SetMetadata(dst, name, hdr.FileInfo().Mode(), hdr.ModTime)
+}
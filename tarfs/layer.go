@@ -0,0 +1,148 @@
+package tarfs
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/relab/wrfs"
+)
+
+// CreateLayer writes to w a tar archive of the changes that turn the tree of old into that of new, in the format
+// of OCI image layers: the directories, regular files and symbolic links of new that are missing from old or differ
+// from it, along with their parent directories, and for each file of old missing from new, an empty whiteout file
+// named by prefixing its name with wrfs.WhiteoutPrefix. Files are written as by Create, in lexical order.
+//
+// Regular files are considered to differ if their types, permission bits, sizes or modification times do, symbolic
+// links if their targets do, and directories if their permission bits do. A file replaced by one of another type
+// is archived without a whiteout, since extracting it replaces the old one.
+//
+// The upper layer of a file system returned by wrfs.Overlay already records its changes in this format, and can be
+// archived as a layer with Create.
+//
+// CreateLayer does not close w.
+func CreateLayer(w io.Writer, old, new wrfs.FS, opts ...CreateOption) error {
+	var c createConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	changed := make(map[string]wrfs.FileInfo)
+	err := wrfs.WalkDir(new, ".", func(name string, d wrfs.DirEntry, err error) error {
+		if err != nil || name == "." {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		differ, err := differs(old, new, name, fi)
+		if err != nil {
+			return err
+		}
+		if differ {
+			changed[name] = fi
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var deleted []string
+	err = wrfs.WalkDir(old, ".", func(name string, d wrfs.DirEntry, err error) error {
+		if err != nil || name == "." {
+			return err
+		}
+		fi, err := wrfs.Lstat(new, name)
+		if errors.Is(err, wrfs.ErrNotExist) {
+			deleted = append(deleted, name)
+		} else if err != nil {
+			return err
+		}
+		if d.IsDir() && (err != nil || !fi.IsDir()) {
+			return wrfs.SkipDir // removed or replaced along with its contents
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for name := range changed {
+		names[name] = true
+	}
+	for _, name := range deleted {
+		dir, base := path.Split(name)
+		names[dir+wrfs.WhiteoutPrefix+base] = true
+	}
+	for name := range names {
+		for dir := path.Dir(name); dir != "." && changed[dir] == nil; dir = path.Dir(dir) {
+			fi, err := wrfs.Lstat(new, dir)
+			if err != nil {
+				return err
+			}
+			changed[dir] = fi
+			names[dir] = true
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return pathLess(sorted[i], sorted[j]) })
+
+	tw := tar.NewWriter(w)
+	for _, name := range sorted {
+		if fi, ok := changed[name]; ok {
+			err = writeFile(tw, new, name, name, fi, &c)
+		} else {
+			err = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, ModTime: time.Unix(0, 0)})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// differs reports whether the named file of new, which is described by fi, is missing from old or differs from it.
+func differs(old, new wrfs.FS, name string, fi wrfs.FileInfo) (bool, error) {
+	ofi, err := wrfs.Lstat(old, name)
+	if errors.Is(err, wrfs.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	mode, omode := fi.Mode(), ofi.Mode()
+	if mode.Type() != omode.Type() {
+		return true, nil
+	}
+	if mode&wrfs.ModeSymlink != 0 {
+		target, err := wrfs.Readlink(new, name)
+		if err != nil {
+			return false, err
+		}
+		otarget, err := wrfs.Readlink(old, name)
+		return target != otarget, err
+	}
+	if mode.Perm() != omode.Perm() {
+		return true, nil
+	}
+	return mode.IsRegular() && (fi.Size() != ofi.Size() || !fi.ModTime().Equal(ofi.ModTime())), nil
+}
+
+// pathLess reports whether the path a comes before b in the order WalkDir visits them.
+func pathLess(a, b string) bool {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	return len(as) < len(bs)
+}
@@ -0,0 +1,194 @@
+package tarfs_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+	"github.com/relab/wrfs/tarfs"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkContents(t *testing.T, fsys wrfs.FS, name, want string) {
+	t.Helper()
+	data, err := wrfs.ReadFile(fsys, name)
+	check(t, err)
+	if string(data) != want {
+		t.Errorf("%s contains %q, want %q", name, data, want)
+	}
+}
+
+// archive returns a tar archive of the given headers, with the contents of regular files taken from Linkname.
+func archive(t *testing.T, hdrs ...tar.Header) *tar.Reader {
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, hdr := range hdrs {
+		var data string
+		if hdr.Typeflag == tar.TypeReg {
+			data, hdr.Linkname, hdr.Size = hdr.Linkname, "", int64(len(hdr.Linkname))
+		}
+		check(t, w.WriteHeader(&hdr))
+		_, err := w.Write([]byte(data))
+		check(t, err)
+	}
+	check(t, w.Close())
+	return tar.NewReader(&buf)
+}
+
+func TestExtract(t *testing.T) {
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := memfs.New()
+	check(t, wrfs.Mkdir(fsys, "dir", 0755))
+	check(t, wrfs.WriteFile(fsys, "dir/link", []byte("replaced"), 0644))
+	check(t, tarfs.Extract(fsys, archive(t,
+		tar.Header{Typeflag: tar.TypeDir, Name: "dir/", Mode: 0750, ModTime: mtime},
+		tar.Header{Typeflag: tar.TypeReg, Name: "./dir/file", Linkname: "contents", Mode: 0600, ModTime: mtime},
+		tar.Header{Typeflag: tar.TypeSymlink, Name: "dir/link", Linkname: "file"},
+		tar.Header{Typeflag: tar.TypeLink, Name: "hard", Linkname: "dir/file"},
+		tar.Header{Typeflag: tar.TypeChar, Name: "dev"},
+	)))
+	checkContents(t, fsys, "dir/link", "contents")
+	checkContents(t, fsys, "hard", "contents")
+	for name, mode := range map[string]wrfs.FileMode{"dir": wrfs.ModeDir | 0750, "dir/file": 0600} {
+		fi, err := wrfs.Stat(fsys, name)
+		check(t, err)
+		if fi.Mode() != mode || !fi.ModTime().Equal(mtime) {
+			t.Errorf("%s has mode %v and time %v, want %v and %v", name, fi.Mode(), fi.ModTime(), mode, mtime)
+		}
+	}
+	if _, err := wrfs.Lstat(fsys, "dev"); !errors.Is(err, wrfs.ErrNotExist) {
+		t.Errorf("Extract created device: %v", err)
+	}
+
+	for _, hdrs := range [][]tar.Header{
+		{{Typeflag: tar.TypeReg, Name: "../escape"}},
+		{{Typeflag: tar.TypeReg, Name: "/etc/escape"}},
+		{{Typeflag: tar.TypeSymlink, Name: "up", Linkname: "../.."}},
+		{{Typeflag: tar.TypeSymlink, Name: "abs", Linkname: "/etc"}},
+		{{Typeflag: tar.TypeReg, Name: "dir/link/escape"}},
+		{{Typeflag: tar.TypeLink, Name: "hard2", Linkname: "../escape"}},
+	} {
+		if err := tarfs.Extract(fsys, archive(t, hdrs...)); !errors.Is(err, wrfs.ErrPermission) {
+			t.Errorf("Extract of %s: got %v, want ErrPermission", hdrs[0].Name, err)
+		}
+	}
+	check(t, tarfs.Extract(fsys, archive(t, tar.Header{Typeflag: tar.TypeSymlink, Name: "abs", Linkname: "/etc"}),
+		tarfs.Symlinks(tarfs.SymlinksAny)))
+	check(t, tarfs.Extract(fsys, archive(t, tar.Header{Typeflag: tar.TypeSymlink, Name: "skipped", Linkname: "/etc"}),
+		tarfs.Symlinks(tarfs.SymlinksSkip)))
+	if _, err := wrfs.Lstat(fsys, "skipped"); !errors.Is(err, wrfs.ErrNotExist) {
+		t.Errorf("Extract with SymlinksSkip created link: %v", err)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	src := memfs.New()
+	check(t, wrfs.MkdirAll(src, "root/dir/sub", 0750))
+	check(t, wrfs.WriteFile(src, "root/dir/file", []byte("contents"), 0600))
+	check(t, wrfs.WriteFile(src, "root/top", nil, 0644))
+	check(t, wrfs.Symlink(src, "dir/file", "root/link"))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	check(t, wrfs.Chtimes(src, "root/dir/file", mtime, mtime))
+
+	var buf1, buf2 bytes.Buffer
+	check(t, tarfs.Create(&buf1, src, "root/"))
+	check(t, tarfs.Create(&buf2, src, "root"))
+	if !bytes.Equal(buf1.Bytes(), buf2.Bytes()) {
+		t.Error("Create of the same tree yielded different archives")
+	}
+	var names []string
+	r := tar.NewReader(bytes.NewReader(buf1.Bytes()))
+	for hdr, err := r.Next(); err == nil; hdr, err = r.Next() {
+		names = append(names, hdr.Name)
+	}
+	if got, want := strings.Join(names, " "), "dir/ dir/file dir/sub/ link top"; got != want {
+		t.Errorf("Create archived %q, want %q", got, want)
+	}
+
+	dst := memfs.New()
+	check(t, tarfs.Extract(dst, tar.NewReader(&buf1)))
+	want, err := wrfs.HashTree(src, "root", sha256.New)
+	check(t, err)
+	got, err := wrfs.HashTree(dst, ".", sha256.New)
+	check(t, err)
+	if !bytes.Equal(got, want) {
+		t.Error("extracted tree differs from archived one")
+	}
+	fi, err := wrfs.Stat(dst, "dir/file")
+	check(t, err)
+	if !fi.ModTime().Equal(mtime) {
+		t.Errorf("extracted dir/file has time %v, want %v", fi.ModTime(), mtime)
+	}
+}
+
+func TestCreateLayer(t *testing.T) {
+	old := memfs.New()
+	check(t, wrfs.MkdirAll(old, "a/b", 0755))
+	check(t, wrfs.MkdirAll(old, "gone/sub", 0755))
+	check(t, wrfs.MkdirAll(old, "same", 0755))
+	check(t, wrfs.WriteFile(old, "a/b/file", []byte("old"), 0644))
+	check(t, wrfs.WriteFile(old, "a/removed", nil, 0644))
+	check(t, wrfs.WriteFile(old, "same/file", []byte("same"), 0644))
+	check(t, wrfs.WriteFile(old, "replaced", nil, 0644))
+	check(t, wrfs.WriteFile(old, "gone/sub/file", nil, 0644))
+
+	new := memfs.New()
+	check(t, wrfs.CopyFS(new, old, ".", wrfs.CopyTimes()))
+	check(t, wrfs.WriteFile(new, "a/b/file", []byte("new contents"), 0644))
+	check(t, wrfs.Remove(new, "a/removed"))
+	check(t, wrfs.RemoveAll(new, "gone"))
+	check(t, wrfs.Remove(new, "replaced"))
+	check(t, wrfs.Mkdir(new, "replaced", 0700))
+	check(t, wrfs.Symlink(new, "a/b/file", "link"))
+
+	var buf bytes.Buffer
+	check(t, tarfs.CreateLayer(&buf, old, new))
+	var names []string
+	r := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	for hdr, err := r.Next(); err == nil; hdr, err = r.Next() {
+		names = append(names, hdr.Name)
+	}
+	if got, want := strings.Join(names, " "), ".wh.gone a/ a/.wh.removed a/b/ a/b/file link replaced/"; got != want {
+		t.Errorf("CreateLayer archived %q, want %q", got, want)
+	}
+
+	// Extracting the layer into the upper layer of an overlay applies it.
+	upper := memfs.New()
+	check(t, tarfs.Extract(upper, tar.NewReader(&buf)))
+	want, err := wrfs.HashTree(new, ".", sha256.New)
+	check(t, err)
+	got, err := wrfs.HashTree(wrfs.Overlay(upper, old), ".", sha256.New)
+	check(t, err)
+	if !bytes.Equal(got, want) {
+		t.Error("overlay of extracted layer differs from new tree")
+	}
+}
+
+func TestExtractSymlinkDir(t *testing.T) {
+	root := t.TempDir()
+	fsys := wrfs.DirFS(root)
+	check(t, wrfs.Mkdir(fsys, "outside", 0700))
+	check(t, wrfs.Mkdir(fsys, "dst", 0755))
+	dst, err := wrfs.Sub(fsys, "dst")
+	check(t, err)
+	check(t, wrfs.Symlink(dst, "../outside", "d"))
+	err = tarfs.Extract(dst, archive(t, tar.Header{Typeflag: tar.TypeDir, Name: "d/", Mode: 0777}))
+	if !errors.Is(err, wrfs.ErrPermission) {
+		t.Errorf("Extract of a directory over a symbolic link: got %v, want ErrPermission", err)
+	}
+	if fi, err := wrfs.Stat(fsys, "outside"); err != nil || fi.Mode().Perm() != 0700 {
+		t.Errorf("the directory outside of dst has mode %v, %v, want 0700", fi.Mode(), err)
+	}
+}
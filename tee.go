@@ -0,0 +1,286 @@
+package wrfs
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Tee returns a file system that applies every modification to primary and then to each of the secondaries,
+// such as for migrating data between file systems while they are in use. Reads are served by primary alone.
+//
+// A modification that fails on primary is not applied to the secondaries. If it fails on a secondary, Tee
+// returns the secondary's error without applying it to the remaining secondaries, even though primary has been
+// modified; use TeeDivergent to carry on instead. Files opened for writing write to the files of every file
+// system, and their reads and seeks are served by the primary file. The Capabilities of the returned file
+// system are those of primary, without the modifications that any of the secondaries does not support.
+func Tee(primary FS, secondaries ...FS) FS {
+	return &teeFS{fsWrapper{primary}, secondaries, nil}
+}
+
+// TeeDivergent is like Tee, but modifications that fail on a secondary are recorded in the returned
+// Divergence and reported as successful, and later writes to a file that failed on a secondary are
+// not made to that secondary. The secondaries thus diverge from primary on the recorded files, which
+// must be repaired, such as by copying them from primary, before the secondaries can replace it.
+func TeeDivergent(primary FS, secondaries ...FS) (FS, *Divergence) {
+	d := &Divergence{}
+	return &teeFS{fsWrapper{primary}, secondaries, d}, d
+}
+
+// A DivergentOp describes a modification that failed on a secondary file system of a TeeDivergent.
+type DivergentOp struct {
+	Secondary int    // the index of the secondary among those given to TeeDivergent
+	Op        string // the operation, such as "write", "mkdir" or "rename"
+	Path      string // the file modified; the old name for rename and link
+	Err       error  // the error returned by the secondary
+}
+
+// A Divergence records the modifications that failed on the secondaries of a TeeDivergent.
+// It is safe for concurrent use.
+type Divergence struct {
+	mu  sync.Mutex
+	ops []DivergentOp
+}
+
+// Ops returns the failed modifications recorded so far, in the order they were made.
+func (d *Divergence) Ops() []DivergentOp {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]DivergentOp(nil), d.ops...)
+}
+
+func (d *Divergence) add(op DivergentOp) {
+	d.mu.Lock()
+	d.ops = append(d.ops, op)
+	d.mu.Unlock()
+}
+
+type teeFS struct {
+	fsWrapper
+	secondaries []FS
+	divergence  *Divergence // nil to fail on the first secondary error
+}
+
+// fail handles the error of secondary i, returning the error to fail the operation with, if any.
+func (t *teeFS) fail(i int, op, name string, err error) error {
+	if t.divergence == nil {
+		return err
+	}
+	t.divergence.add(DivergentOp{Secondary: i, Op: op, Path: name, Err: err})
+	return nil
+}
+
+// apply applies a modification to the primary and then to the secondaries.
+func (t *teeFS) apply(op, name string, fn func(fsys FS) error) error {
+	if err := fn(t.fsys); err != nil {
+		return err
+	}
+	for i, fsys := range t.secondaries {
+		if err := fn(fsys); err != nil {
+			if err := t.fail(i, op, name, err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// teeModifications are the capabilities that the secondaries must also have.
+const teeModifications = CapOpenFile | CapMkdir | CapRemove | CapRename | CapSymlink | CapLink |
+	CapChmod | CapChown | CapLchown | CapChtimes | CapTruncate | CapSync
+
+func (t *teeFS) Capabilities() CapSet {
+	caps := Capabilities(t.fsys) &^ (CapMkfifo | CapMknod | CapLchtimes)
+	for _, fsys := range t.secondaries {
+		caps &^= teeModifications &^ Capabilities(fsys)
+	}
+	return caps
+}
+
+func (t *teeFS) OpenFile(name string, flag int, perm FileMode) (File, error) {
+	file, err := OpenFile(t.fsys, name, flag, perm)
+	if err != nil || flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return file, err
+	}
+	f := &teeFile{File: file, name: name, tee: t, files: make([]File, len(t.secondaries))}
+	for i, fsys := range t.secondaries {
+		f.files[i], err = OpenFile(fsys, name, flag, perm)
+		if err != nil {
+			if err := t.fail(i, "open", name, err); err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+	}
+	return f, nil
+}
+
+func (t *teeFS) Chmod(name string, mode FileMode) error {
+	return t.apply("chmod", name, func(fsys FS) error { return Chmod(fsys, name, mode) })
+}
+
+func (t *teeFS) Chown(name string, uid, gid int) error {
+	return t.apply("chown", name, func(fsys FS) error { return Chown(fsys, name, uid, gid) })
+}
+
+func (t *teeFS) Lchown(name string, uid, gid int) error {
+	return t.apply("lchown", name, func(fsys FS) error { return Lchown(fsys, name, uid, gid) })
+}
+
+func (t *teeFS) Chtimes(name string, atime, mtime time.Time) error {
+	return t.apply("chtimes", name, func(fsys FS) error { return Chtimes(fsys, name, atime, mtime) })
+}
+
+func (t *teeFS) Mkdir(name string, perm FileMode) error {
+	return t.apply("mkdir", name, func(fsys FS) error { return Mkdir(fsys, name, perm) })
+}
+
+func (t *teeFS) MkdirAll(path string, perm FileMode) error {
+	return t.apply("mkdirall", path, func(fsys FS) error { return MkdirAll(fsys, path, perm) })
+}
+
+func (t *teeFS) Remove(name string) error {
+	return t.apply("remove", name, func(fsys FS) error { return Remove(fsys, name) })
+}
+
+func (t *teeFS) RemoveAll(path string) error {
+	return t.apply("removeall", path, func(fsys FS) error { return RemoveAll(fsys, path) })
+}
+
+func (t *teeFS) Rename(oldpath, newpath string) error {
+	return t.apply("rename", oldpath, func(fsys FS) error { return Rename(fsys, oldpath, newpath) })
+}
+
+func (t *teeFS) Symlink(oldname, newname string) error {
+	return t.apply("symlink", newname, func(fsys FS) error { return Symlink(fsys, oldname, newname) })
+}
+
+func (t *teeFS) Link(oldname, newname string) error {
+	return t.apply("link", oldname, func(fsys FS) error { return Link(fsys, oldname, newname) })
+}
+
+func (t *teeFS) Truncate(name string, size int64) error {
+	return t.apply("truncate", name, func(fsys FS) error { return Truncate(fsys, name, size) })
+}
+
+func (t *teeFS) Sync(name string) error {
+	return t.apply("sync", name, func(fsys FS) error { return Sync(fsys, name) })
+}
+
+func (t *teeFS) SyncDir(dir string) error {
+	return t.apply("syncdir", dir, func(fsys FS) error { return SyncDir(fsys, dir) })
+}
+
+// teeFile is a file opened for writing on the primary and the secondaries of a teeFS.
+type teeFile struct {
+	File
+	name  string
+	tee   *teeFS
+	files []File // the files of the secondaries, or nil for those that failed
+}
+
+// each applies fn to the files of the secondaries.
+func (f *teeFile) each(op string, fn func(file File) error) error {
+	for i, file := range f.files {
+		if file == nil {
+			continue
+		}
+		if err := fn(file); err != nil {
+			if err := f.tee.fail(i, op, f.name, err); err != nil {
+				return err
+			}
+			f.files[i] = nil
+			file.Close()
+		}
+	}
+	return nil
+}
+
+func (f *teeFile) Write(p []byte) (int, error) {
+	n, err := Write(f.File, p)
+	if eerr := f.each("write", func(file File) error {
+		m, err := Write(file, p[:n])
+		if err == nil && m < n {
+			err = io.ErrShortWrite
+		}
+		return err
+	}); err == nil {
+		err = eerr
+	}
+	return n, err
+}
+
+func (f *teeFile) WriteAt(p []byte, off int64) (int, error) {
+	w, ok := f.File.(io.WriterAt)
+	if !ok {
+		return 0, &PathError{Op: "writeat", Path: f.name, Err: ErrUnsupported}
+	}
+	n, err := w.WriteAt(p, off)
+	if eerr := f.each("writeat", func(file File) error {
+		w, ok := file.(io.WriterAt)
+		if !ok {
+			return &PathError{Op: "writeat", Path: f.name, Err: ErrUnsupported}
+		}
+		_, err := w.WriteAt(p[:n], off)
+		return err
+	}); err == nil {
+		err = eerr
+	}
+	return n, err
+}
+
+func (f *teeFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := Seek(f.File, offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	// Seek the secondaries to the same absolute position, in case their sizes differ.
+	return pos, f.each("seek", func(file File) error {
+		_, err := Seek(file, pos, io.SeekStart)
+		return err
+	})
+}
+
+func (f *teeFile) ReadAt(p []byte, off int64) (int, error) {
+	if r, ok := f.File.(io.ReaderAt); ok {
+		return r.ReadAt(p, off)
+	}
+	return 0, &PathError{Op: "readat", Path: f.name, Err: ErrUnsupported}
+}
+
+func (f *teeFile) Truncate(size int64) error {
+	truncate := func(file File) error {
+		if file, ok := file.(TruncateFile); ok {
+			return file.Truncate(size)
+		}
+		return &PathError{Op: "truncate", Path: f.name, Err: ErrUnsupported}
+	}
+	if err := truncate(f.File); err != nil {
+		return err
+	}
+	return f.each("truncate", truncate)
+}
+
+func (f *teeFile) Sync() error {
+	if err := syncFile(f.File); err != nil {
+		return err
+	}
+	return f.each("sync", syncFile)
+}
+
+// Close closes the files of the primary and of all secondaries, even if some fail.
+func (f *teeFile) Close() error {
+	err := f.File.Close()
+	for i, file := range f.files {
+		if file == nil {
+			continue
+		}
+		if cerr := file.Close(); cerr != nil {
+			if cerr := f.tee.fail(i, "close", f.name, cerr); err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+package wrfs_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+	"github.com/relab/wrfs/wrfstest"
+)
+
+func TestTee(t *testing.T) {
+	primary, secondary := memfs.New(), memfs.New()
+	fsys := Tee(primary, secondary)
+	if err := wrfstest.TestWriteFS(fsys); err != nil {
+		t.Fatal(err)
+	}
+	check(t, MkdirAll(fsys, "dir/sub", 0755))
+	check(t, WriteFile(fsys, "dir/file", []byte("tee"), 0644))
+	check(t, Rename(fsys, "dir/file", "dir/sub/file"))
+	checkContents(t, primary, "dir/sub/file", "tee")
+	checkContents(t, secondary, "dir/sub/file", "tee")
+
+	check(t, Mkdir(secondary, "only", 0755))
+	if err := Mkdir(fsys, "only", 0755); !errors.Is(err, ErrExist) {
+		t.Errorf("Mkdir failing on secondary: got %v, want ErrExist", err)
+	}
+
+	fsys, divergence := TeeDivergent(primary, ReadOnly(secondary))
+	check(t, WriteFile(fsys, "dir/new", []byte("new"), 0644))
+	check(t, Remove(fsys, "dir/sub/file"))
+	checkContents(t, primary, "dir/new", "new")
+	checkContents(t, secondary, "dir/sub/file", "tee")
+	if ops := divergence.Ops(); len(ops) != 2 || ops[0].Path != "dir/new" || ops[1].Op != "remove" {
+		t.Errorf("Ops() = %v, want the open of dir/new and the removal of dir/sub/file", ops)
+	}
+}
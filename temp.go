@@ -0,0 +1,119 @@
+package wrfs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+)
+
+// TempFS is a file system that can create temporary files and directories.
+type TempFS interface {
+	FS
+
+	// MkdirTemp creates a new directory in dir and returns its name.
+	// The semantics are those of the MkdirTemp function.
+	MkdirTemp(dir, pattern string) (string, error)
+
+	// CreateTemp creates a new file in dir, opens it for reading and writing, and returns the file and its name.
+	// The semantics are those of the CreateTemp function.
+	CreateTemp(dir, pattern string) (File, string, error)
+}
+
+var errPatternHasSeparator = errors.New("pattern contains path separator")
+
+// MkdirTemp creates a new directory in dir with permissions 0700 (before umask) and returns its name.
+// The directory name is generated by taking pattern and applying a random string to the end.
+// If pattern includes a "*", the random string replaces the last "*".
+// If dir is the empty string, MkdirTemp uses the root directory of fsys.
+// Multiple programs or goroutines calling MkdirTemp simultaneously will not choose the same directory.
+// It is the caller's responsibility to remove the directory when it is no longer needed.
+//
+// If fsys implements TempFS, MkdirTemp calls fsys.MkdirTemp.
+// Otherwise MkdirTemp calls Mkdir with random names until it succeeds.
+func MkdirTemp(fsys FS, dir, pattern string) (string, error) {
+	if fsys, ok := fsys.(TempFS); ok {
+		return fsys.MkdirTemp(dir, pattern)
+	}
+	prefix, suffix, err := splitPattern(dir, pattern, "mkdirtemp")
+	if err != nil {
+		return "", err
+	}
+	for try := 0; ; try++ {
+		name, err := tempName(prefix, suffix)
+		if err != nil {
+			return "", err
+		}
+		err = Mkdir(fsys, name, 0700)
+		if errors.Is(err, ErrExist) && try < 10000 {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return name, nil
+	}
+}
+
+// CreateTemp creates a new file in dir, opens it for reading and writing, and returns the file and its name.
+// The file is created with permissions 0600 (before umask). The file name is generated by taking pattern and
+// adding a random string to the end. If pattern includes a "*", the random string replaces the last "*".
+// If dir is the empty string, CreateTemp uses the root directory of fsys.
+// Multiple programs or goroutines calling CreateTemp simultaneously will not choose the same file.
+// It is the caller's responsibility to remove the file when it is no longer needed.
+//
+// If fsys implements TempFS, CreateTemp calls fsys.CreateTemp.
+// Otherwise CreateTemp calls OpenFile with O_CREATE|O_EXCL and random names until it succeeds.
+func CreateTemp(fsys FS, dir, pattern string) (File, string, error) {
+	if fsys, ok := fsys.(TempFS); ok {
+		return fsys.CreateTemp(dir, pattern)
+	}
+	return createTemp(fsys, dir, pattern, 0600)
+}
+
+// createTemp implements CreateTemp using OpenFile, creating the file with permissions perm.
+func createTemp(fsys FS, dir, pattern string, perm FileMode) (File, string, error) {
+	prefix, suffix, err := splitPattern(dir, pattern, "createtemp")
+	if err != nil {
+		return nil, "", err
+	}
+	for try := 0; ; try++ {
+		name, err := tempName(prefix, suffix)
+		if err != nil {
+			return nil, "", err
+		}
+		file, err := OpenFile(fsys, name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if errors.Is(err, ErrExist) && try < 10000 {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		return file, name, nil
+	}
+}
+
+// splitPattern splits pattern at its last "*" and prepends dir to the prefix.
+func splitPattern(dir, pattern, op string) (prefix, suffix string, err error) {
+	if strings.Contains(pattern, "/") {
+		return "", "", &PathError{Op: op, Path: pattern, Err: errPatternHasSeparator}
+	}
+	prefix = pattern
+	if pos := strings.LastIndexByte(pattern, '*'); pos != -1 {
+		prefix, suffix = pattern[:pos], pattern[pos+1:]
+	}
+	if dir != "" && dir != "." {
+		prefix = dir + "/" + prefix
+	}
+	return prefix, suffix, nil
+}
+
+// tempName returns prefix and suffix joined by a random string.
+func tempName(prefix, suffix string) (string, error) {
+	var rnd [8]byte
+	if _, err := rand.Read(rnd[:]); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(rnd[:]) + suffix, nil
+}
@@ -0,0 +1,33 @@
+package wrfs_test
+
+import (
+	"path"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestTemp(t *testing.T) {
+	fsys, err := Sub(newLowerFS(t), "dir")
+	check(t, err)
+
+	dir, err := MkdirTemp(fsys, "sub", "tmp-*.d")
+	check(t, err)
+	if ok, _ := path.Match("sub/tmp-*.d", dir); !ok {
+		t.Errorf("MkdirTemp: got name %q, want sub/tmp-*.d", dir)
+	}
+	file, name, err := CreateTemp(fsys, dir, "")
+	check(t, err)
+	check(t, file.Close())
+	if path.Dir(name) != dir {
+		t.Errorf("CreateTemp: got name %q, want a file in %q", name, dir)
+	}
+	fi, err := Stat(fsys, name)
+	check(t, err)
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("CreateTemp: got mode %v, want 0600", fi.Mode())
+	}
+	if _, _, err := CreateTemp(fsys, "", "a/b"); err == nil {
+		t.Error("CreateTemp with separator in pattern succeeded")
+	}
+}
@@ -0,0 +1,198 @@
+package wrfs
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// A tokenBucket limits the rate of events to rate per second, allowing bursts of up to burst events.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int64) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// take removes n tokens from the bucket, sleeping until they have been refilled if the bucket runs short.
+// Takes larger than the burst size are split, so that they are spread over time.
+func (b *tokenBucket) take(n int64) {
+	b.takeContext(context.Background(), n)
+}
+
+// takeContext is like take, but stops waiting and returns the context's error if ctx is done.
+func (b *tokenBucket) takeContext(ctx context.Context, n int64) error {
+	for n > 0 {
+		chunk := float64(n)
+		if chunk > b.burst {
+			chunk = b.burst
+		}
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+		b.tokens -= chunk
+		var wait time.Duration
+		if b.tokens < 0 {
+			wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+		}
+		b.mu.Unlock()
+
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				b.mu.Lock()
+				b.tokens += chunk
+				b.mu.Unlock()
+				return ctx.Err()
+			}
+		}
+		n -= int64(chunk)
+	}
+	return nil
+}
+
+// Throttle returns a file system that limits the rate at which the files opened from fsys are read and
+// written to readBps and writeBps bytes per second, respectively. A limit of zero or less disables it.
+// The limits apply to all the files together, and allow bursts of up to one second's worth of bytes.
+// Other operations, such as Stat and ReadDir, are not throttled.
+func Throttle(fsys FS, readBps, writeBps int64) FS {
+	t := &throttleFS{fsWrapper: fsWrapper{fsys}}
+	if readBps > 0 {
+		t.read = newTokenBucket(float64(readBps), readBps)
+	}
+	if writeBps > 0 {
+		t.write = newTokenBucket(float64(writeBps), writeBps)
+	}
+	return t
+}
+
+type throttleFS struct {
+	fsWrapper
+	read  *tokenBucket
+	write *tokenBucket
+}
+
+func (t *throttleFS) Open(name string) (File, error) {
+	file, err := t.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &throttledFile{file, name, t}, nil
+}
+
+func (t *throttleFS) OpenFile(name string, flag int, perm FileMode) (File, error) {
+	file, err := OpenFile(t.fsys, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &throttledFile{file, name, t}, nil
+}
+
+// throttledFile is a file opened through a throttleFS.
+type throttledFile struct {
+	file File
+	name string
+	t    *throttleFS
+}
+
+func (f *throttledFile) Read(p []byte) (int, error) {
+	n, err := f.file.Read(p)
+	if f.t.read != nil {
+		f.t.read.take(int64(n))
+	}
+	return n, err
+}
+
+func (f *throttledFile) ReadAt(p []byte, off int64) (int, error) {
+	r, ok := f.file.(io.ReaderAt)
+	if !ok {
+		return 0, &PathError{Op: "readat", Path: f.name, Err: ErrUnsupported}
+	}
+	n, err := r.ReadAt(p, off)
+	if f.t.read != nil {
+		f.t.read.take(int64(n))
+	}
+	return n, err
+}
+
+func (f *throttledFile) Write(p []byte) (int, error) {
+	if f.t.write != nil {
+		f.t.write.take(int64(len(p)))
+	}
+	return Write(f.file, p)
+}
+
+func (f *throttledFile) WriteAt(p []byte, off int64) (int, error) {
+	w, ok := f.file.(io.WriterAt)
+	if !ok {
+		return 0, &PathError{Op: "writeat", Path: f.name, Err: ErrUnsupported}
+	}
+	if f.t.write != nil {
+		f.t.write.take(int64(len(p)))
+	}
+	return w.WriteAt(p, off)
+}
+
+func (f *throttledFile) Stat() (FileInfo, error) { return f.file.Stat() }
+
+func (f *throttledFile) Close() error { return f.file.Close() }
+
+func (f *throttledFile) Seek(offset int64, whence int) (int64, error) {
+	return Seek(f.file, offset, whence)
+}
+
+func (f *throttledFile) ReadDir(n int) ([]DirEntry, error) {
+	if dir, ok := f.file.(ReadDirFile); ok {
+		return dir.ReadDir(n)
+	}
+	return nil, &PathError{Op: "readdir", Path: f.name, Err: ErrUnsupported}
+}
+
+func (f *throttledFile) Chmod(mode FileMode) error {
+	if file, ok := f.file.(ChmodFile); ok {
+		return file.Chmod(mode)
+	}
+	return &PathError{Op: "chmod", Path: f.name, Err: ErrUnsupported}
+}
+
+func (f *throttledFile) Chown(uid, gid int) error {
+	if file, ok := f.file.(ChownFile); ok {
+		return file.Chown(uid, gid)
+	}
+	return &PathError{Op: "chown", Path: f.name, Err: ErrUnsupported}
+}
+
+func (f *throttledFile) Chtimes(atime, mtime time.Time) error {
+	if file, ok := f.file.(ChtimesFile); ok {
+		return file.Chtimes(atime, mtime)
+	}
+	return &PathError{Op: "chtimes", Path: f.name, Err: ErrUnsupported}
+}
+
+func (f *throttledFile) Truncate(size int64) error {
+	if file, ok := f.file.(TruncateFile); ok {
+		return file.Truncate(size)
+	}
+	return &PathError{Op: "truncate", Path: f.name, Err: ErrUnsupported}
+}
+
+func (f *throttledFile) Sync() error {
+	if file, ok := f.file.(SyncFile); ok {
+		return file.Sync()
+	}
+	return &PathError{Op: "sync", Path: f.name, Err: ErrUnsupported}
+}
@@ -0,0 +1,27 @@
+package wrfs_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestThrottle(t *testing.T) {
+	fsys := Throttle(newLowerFS(t), 0, 10000)
+
+	start := time.Now()
+	check(t, WriteFile(fsys, "dir/new", make([]byte, 12000), 0644))
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Errorf("writing 12000 bytes at 10000 B/s with a burst of 10000 took %v, want at least 200ms", d)
+	}
+	start = time.Now()
+	data, err := ReadFile(fsys, "dir/new")
+	check(t, err)
+	if len(data) != 12000 {
+		t.Errorf("read %d bytes, want 12000", len(data))
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("unthrottled read took %v", d)
+	}
+}
@@ -0,0 +1,46 @@
+package wrfs
+
+import "time"
+
+// FileTimes holds the times of a file. Times that are unknown, because the file system or platform does not
+// record or report them, are zero.
+type FileTimes struct {
+	ModTime    time.Time // last modification of the contents
+	AccessTime time.Time // last access to the contents
+	ChangeTime time.Time // last change of the contents or metadata, such as the mode, owner or links
+	BirthTime  time.Time // creation of the file
+}
+
+// BirthtimeFS is a file system with a StatTimes method.
+type BirthtimeFS interface {
+	FS
+
+	// StatTimes returns the times of the named file, including its creation time where it is known.
+	StatTimes(name string) (FileTimes, error)
+}
+
+// StatTimes returns the times of the named file, including its creation and change times where they are known.
+//
+// If fsys does not implement BirthtimeFS, StatTimes calls Stat and extracts the times from the FileInfo with
+// FileInfoTimes.
+func StatTimes(fsys FS, name string) (FileTimes, error) {
+	if fsys, ok := fsys.(BirthtimeFS); ok {
+		return fsys.StatTimes(name)
+	}
+	fi, err := Stat(fsys, name)
+	if err != nil {
+		return FileTimes{}, err
+	}
+	return FileInfoTimes(fi), nil
+}
+
+// FileInfoTimes returns the times of a file described by fi. The times other than the modification time are
+// extracted from fi.Sys() if it describes a file of the host file system, and are otherwise zero.
+//
+// On Linux, the FileInfo of the host file system does not hold the creation time; StatTimes on a file system from
+// DirFS gets it with statx(2) instead.
+func FileInfoTimes(fi FileInfo) FileTimes {
+	t := sysTimes(fi.Sys())
+	t.ModTime = fi.ModTime()
+	return t
+}
@@ -0,0 +1,21 @@
+//go:build darwin || freebsd || netbsd
+// +build darwin freebsd netbsd
+
+package wrfs
+
+import (
+	"syscall"
+	"time"
+)
+
+func sysTimes(sys interface{}) FileTimes {
+	st, ok := sys.(*syscall.Stat_t)
+	if !ok {
+		return FileTimes{}
+	}
+	return FileTimes{
+		AccessTime: time.Unix(st.Atimespec.Unix()),
+		ChangeTime: time.Unix(st.Ctimespec.Unix()),
+		BirthTime:  time.Unix(st.Birthtimespec.Unix()),
+	}
+}
@@ -0,0 +1,15 @@
+package wrfs
+
+import (
+	"syscall"
+	"time"
+)
+
+// DragonFly does not record the creation time of files.
+func sysTimes(sys interface{}) FileTimes {
+	st, ok := sys.(*syscall.Stat_t)
+	if !ok {
+		return FileTimes{}
+	}
+	return FileTimes{AccessTime: time.Unix(st.Atim.Unix()), ChangeTime: time.Unix(st.Ctim.Unix())}
+}
@@ -0,0 +1,117 @@
+package wrfs
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+func sysTimes(sys interface{}) FileTimes {
+	st, ok := sys.(*syscall.Stat_t)
+	if !ok {
+		return FileTimes{}
+	}
+	return FileTimes{AccessTime: time.Unix(st.Atim.Unix()), ChangeTime: time.Unix(st.Ctim.Unix())}
+}
+
+// sysStatx is the number of the statx system call, which the syscall package does not define, or 0 on
+// architectures where it is not known.
+var sysStatx = map[string]uintptr{
+	"386":      383,
+	"amd64":    332,
+	"arm":      397,
+	"arm64":    291,
+	"loong64":  291,
+	"mips":     4366,
+	"mipsle":   4366,
+	"mips64":   5326,
+	"mips64le": 5326,
+	"ppc64":    383,
+	"ppc64le":  383,
+	"riscv64":  291,
+	"s390x":    379,
+}[runtime.GOARCH]
+
+const (
+	atFDCWD    = -0x64
+	statxAtime = 0x20
+	statxMtime = 0x40
+	statxCtime = 0x80
+	statxBtime = 0x800
+)
+
+type statxTimestamp struct {
+	Sec  int64
+	Nsec uint32
+	_    int32
+}
+
+// statxT is struct statx of Linux, up to the timestamps.
+type statxT struct {
+	Mask           uint32
+	Blksize        uint32
+	Attributes     uint64
+	Nlink          uint32
+	Uid            uint32
+	Gid            uint32
+	Mode           uint16
+	_              uint16
+	Ino            uint64
+	Size           uint64
+	Blocks         uint64
+	AttributesMask uint64
+	Atime          statxTimestamp
+	Btime          statxTimestamp
+	Ctime          statxTimestamp
+	Mtime          statxTimestamp
+	_              [144]byte
+}
+
+func (t statxTimestamp) time() time.Time { return time.Unix(t.Sec, int64(t.Nsec)) }
+
+func (fsys hostFS) StatTimes(name string) (FileTimes, error) {
+	if sysStatx == 0 {
+		return fsys.statTimes(name)
+	}
+	p, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return FileTimes{}, &PathError{Op: "stat", Path: name, Err: err}
+	}
+	dirfd := atFDCWD
+	var stx statxT
+	_, _, errno := syscall.Syscall6(sysStatx, uintptr(dirfd), uintptr(unsafe.Pointer(p)), 0,
+		statxAtime|statxMtime|statxCtime|statxBtime, uintptr(unsafe.Pointer(&stx)), 0)
+	switch errno {
+	case 0:
+	case syscall.ENOSYS, syscall.EPERM: // kernels before 4.11, or seccomp filters denying statx
+		return fsys.statTimes(name)
+	default:
+		return FileTimes{}, &PathError{Op: "stat", Path: name, Err: errno}
+	}
+	var t FileTimes
+	if stx.Mask&statxMtime != 0 {
+		t.ModTime = stx.Mtime.time()
+	}
+	if stx.Mask&statxAtime != 0 {
+		t.AccessTime = stx.Atime.time()
+	}
+	if stx.Mask&statxCtime != 0 {
+		t.ChangeTime = stx.Ctime.time()
+	}
+	if stx.Mask&statxBtime != 0 {
+		t.BirthTime = stx.Btime.time()
+	}
+	return t, nil
+}
+
+// statTimes returns the times of the named file from stat(2), without the creation time.
+func (hostFS) statTimes(name string) (FileTimes, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(name, &st); err != nil {
+		return FileTimes{}, &PathError{Op: "stat", Path: name, Err: err}
+	}
+	t := sysTimes(&st)
+	t.ModTime = time.Unix(st.Mtim.Unix())
+	return t, nil
+}
@@ -0,0 +1,18 @@
+package wrfs
+
+import (
+	"syscall"
+	"time"
+)
+
+func sysTimes(sys interface{}) FileTimes {
+	st, ok := sys.(*syscall.Stat_t)
+	if !ok {
+		return FileTimes{}
+	}
+	return FileTimes{
+		AccessTime: time.Unix(st.Atim.Unix()),
+		ChangeTime: time.Unix(st.Ctim.Unix()),
+		BirthTime:  time.Unix(st.X__st_birthtim.Unix()),
+	}
+}
@@ -0,0 +1,48 @@
+package wrfs_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+)
+
+func TestStatTimes(t *testing.T) {
+	fsys := memfs.New()
+	check(t, WriteFile(fsys, "file", []byte("data"), 0644))
+	created, err := StatTimes(fsys, "file")
+	check(t, err)
+	if created.BirthTime.IsZero() || !created.ChangeTime.Equal(created.ModTime) {
+		t.Errorf("StatTimes of a new file = %+v", created)
+	}
+	past := time.Now().Add(-time.Hour)
+	check(t, Chtimes(fsys, "file", past, past))
+	check(t, Chmod(fsys, "file", 0600))
+	times, err := StatTimes(fsys, "file")
+	check(t, err)
+	if !times.ModTime.Equal(past) || !times.AccessTime.Equal(past) || !times.BirthTime.Equal(created.BirthTime) ||
+		times.ChangeTime.Before(created.ChangeTime) {
+		t.Errorf("StatTimes after Chtimes and Chmod = %+v", times)
+	}
+	// Without BirthtimeFS, only the modification time of the FileInfo is known.
+	if times, err := StatTimes(ReadOnly(fsys), "file"); err != nil || times != (FileTimes{ModTime: past}) {
+		t.Errorf("StatTimes(ReadOnly(fsys)) = %+v, %v", times, err)
+	}
+
+	dir := DirFS(t.TempDir())
+	check(t, WriteFile(dir, "file", []byte("data"), 0644))
+	check(t, Chtimes(dir, "file", past, past))
+	times, err = StatTimes(dir, "file")
+	check(t, err)
+	if !times.ModTime.Equal(past) {
+		t.Errorf("StatTimes(DirFS).ModTime = %v, want %v", times.ModTime, past)
+	}
+	if !times.BirthTime.IsZero() && times.BirthTime.After(time.Now()) {
+		t.Errorf("StatTimes(DirFS).BirthTime = %v is in the future", times.BirthTime)
+	}
+	if _, err := StatTimes(dir, "missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("StatTimes(missing): got %v, want ErrNotExist", err)
+	}
+}
@@ -0,0 +1,18 @@
+package wrfs
+
+import (
+	"syscall"
+	"time"
+)
+
+// The FileInfo of Windows does not hold the change time, which needs a handle to the file.
+func sysTimes(sys interface{}) FileTimes {
+	d, ok := sys.(*syscall.Win32FileAttributeData)
+	if !ok {
+		return FileTimes{}
+	}
+	return FileTimes{
+		AccessTime: time.Unix(0, d.LastAccessTime.Nanoseconds()),
+		BirthTime:  time.Unix(0, d.CreationTime.Nanoseconds()),
+	}
+}
@@ -0,0 +1,235 @@
+package wrfs
+
+import (
+	"errors"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// A TrashEntry describes a file or directory in a Trash.
+type TrashEntry struct {
+	ID      string    // the name of the entry in the trash directory
+	Path    string    // the name the file had before it was removed
+	Deleted time.Time // when the file was removed
+}
+
+// A Trash holds the files removed through a file system returned by WithTrash, until they are restored
+// or the trash is emptied. It is safe for concurrent use.
+type Trash struct {
+	fsys FS
+	dir  string
+	mu   sync.Mutex
+}
+
+// WithTrash returns a file system in which Remove and RemoveAll move files and directories into the trash
+// directory dir of fsys instead of deleting them, and the Trash from which they can be restored.
+//
+// Each removed file or directory is stored in its own uniquely named directory in dir, together with the
+// name it had and the time it was removed, so that files removed with the same name do not collide.
+// The trash directory is hidden from ReadDir and Glob, and cannot be removed through the returned file system.
+func WithTrash(fsys FS, dir string) (FS, *Trash) {
+	t := &Trash{fsys: fsys, dir: dir}
+	return &trashFS{fsWrapper{fsys}, t}, t
+}
+
+// Names of the files in the directory of a trash entry.
+const (
+	trashData = "data"
+	trashInfo = "info"
+)
+
+// Entries returns the entries in the trash, oldest first.
+func (t *Trash) Entries() ([]TrashEntry, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.entries()
+}
+
+func (t *Trash) entries() ([]TrashEntry, error) {
+	dirs, err := ReadDir(t.fsys, t.dir)
+	if errors.Is(err, ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []TrashEntry
+	for _, d := range dirs {
+		data, err := ReadFile(t.fsys, path.Join(t.dir, d.Name(), trashInfo))
+		if err != nil {
+			// An entry that was being added or removed when the trash was read.
+			continue
+		}
+		e := TrashEntry{ID: d.Name()}
+		for _, line := range strings.Split(string(data), "\n") {
+			key, value, _ := strings.Cut(line, "=")
+			switch key {
+			case "path":
+				e.Path = value
+			case "deleted":
+				e.Deleted, _ = time.Parse(time.RFC3339Nano, value)
+			}
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Deleted.Before(entries[j].Deleted) })
+	return entries, nil
+}
+
+// put moves the named file or directory into the trash.
+func (t *Trash) put(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := MkdirAll(t.fsys, t.dir, 0700); err != nil {
+		return err
+	}
+	now := time.Now()
+	entry, err := MkdirTemp(t.fsys, t.dir, now.UTC().Format("20060102T150405Z")+"-*")
+	if err != nil {
+		return err
+	}
+	info := "path=" + name + "\ndeleted=" + now.Format(time.RFC3339Nano) + "\n"
+	if err := WriteFile(t.fsys, path.Join(entry, trashInfo), []byte(info), 0600); err != nil {
+		RemoveAll(t.fsys, entry)
+		return err
+	}
+	if err := Move(t.fsys, name, path.Join(entry, trashData)); err != nil {
+		RemoveAll(t.fsys, entry)
+		return err
+	}
+	return nil
+}
+
+// Restore moves the most recently removed file or directory with the given name back to that name,
+// recreating its parent directories if needed. It fails with an error matching ErrExist if the name
+// exists, and with an error matching ErrNotExist if there is no such file in the trash.
+func (t *Trash) Restore(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entries, err := t.entries()
+	if err != nil {
+		return err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Path != name {
+			continue
+		}
+		if _, err := lstatOrStat(t.fsys, name); err == nil {
+			return &PathError{Op: "restore", Path: name, Err: ErrExist}
+		}
+		if err := MkdirAll(t.fsys, path.Dir(name), 0777); err != nil {
+			return err
+		}
+		entry := path.Join(t.dir, entries[i].ID)
+		if err := Move(t.fsys, path.Join(entry, trashData), name); err != nil {
+			return err
+		}
+		return RemoveAll(t.fsys, entry)
+	}
+	return &PathError{Op: "restore", Path: name, Err: ErrNotExist}
+}
+
+// Empty permanently deletes the entries that were removed more than olderThan ago.
+// An olderThan of zero or less empties the trash.
+func (t *Trash) Empty(olderThan time.Duration) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entries, err := t.entries()
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-olderThan)
+	for _, e := range entries {
+		if olderThan > 0 && e.Deleted.After(cutoff) {
+			continue
+		}
+		if err := RemoveAll(t.fsys, path.Join(t.dir, e.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type trashFS struct {
+	fsWrapper
+	trash *Trash
+}
+
+// inTrash reports whether name is the trash directory or inside it, or contains it.
+func (t *trashFS) inTrash(name string) bool {
+	dir := t.trash.dir
+	return name == "." || name == dir || strings.HasPrefix(name, dir+"/") || strings.HasPrefix(dir, name+"/")
+}
+
+func (t *trashFS) hide(name string) bool {
+	return name == path.Base(t.trash.dir)
+}
+
+// Remove moves the named file or empty directory into the trash.
+func (t *trashFS) Remove(name string) error {
+	if t.inTrash(name) {
+		return &PathError{Op: "remove", Path: name, Err: ErrPermission}
+	}
+	fi, err := lstatOrStat(t.fsys, name)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		entries, err := ReadDir(t.fsys, name)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return &PathError{Op: "remove", Path: name, Err: errno.ENOTEMPTY}
+		}
+	}
+	return t.trash.put(name)
+}
+
+// RemoveAll moves the tree rooted at name into the trash.
+func (t *trashFS) RemoveAll(name string) error {
+	if t.inTrash(name) {
+		return &PathError{Op: "removeall", Path: name, Err: ErrPermission}
+	}
+	if _, err := lstatOrStat(t.fsys, name); errors.Is(err, ErrNotExist) {
+		return nil
+	}
+	return t.trash.put(name)
+}
+
+func (t *trashFS) Open(name string) (File, error) {
+	file, err := t.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if name == path.Dir(t.trash.dir) {
+		if fi, err := file.Stat(); err == nil && fi.IsDir() {
+			return hidingDir{file, t.hide}, nil
+		}
+	}
+	return file, nil
+}
+
+func (t *trashFS) ReadDir(name string) ([]DirEntry, error) {
+	entries, err := ReadDir(t.fsys, name)
+	if name == path.Dir(t.trash.dir) {
+		entries = filterEntries(entries, t.hide)
+	}
+	return entries, err
+}
+
+func (t *trashFS) Glob(pattern string) ([]string, error) {
+	matches, err := Glob(t.fsys, pattern)
+	filtered := matches[:0]
+	for _, match := range matches {
+		if match != t.trash.dir && !strings.HasPrefix(match, t.trash.dir+"/") {
+			filtered = append(filtered, match)
+		}
+	}
+	return filtered, err
+}
@@ -0,0 +1,53 @@
+package wrfs_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestTrash(t *testing.T) {
+	lower := newLowerFS(t)
+	fsys, trash := WithTrash(lower, ".trash")
+
+	check(t, Remove(fsys, "dir/file"))
+	check(t, WriteFile(fsys, "dir/file", []byte("second"), 0644))
+	check(t, Remove(fsys, "dir/file"))
+	check(t, RemoveAll(fsys, "dir/sub"))
+	if err := Remove(fsys, "dir/sub"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Remove of trashed file: got %v, want ErrNotExist", err)
+	}
+	if err := RemoveAll(fsys, ".trash"); !errors.Is(err, ErrPermission) {
+		t.Errorf("RemoveAll of trash: got %v, want ErrPermission", err)
+	}
+
+	entries, err := ReadDir(fsys, ".")
+	check(t, err)
+	if len(entries) != 1 || entries[0].Name() != "dir" {
+		t.Errorf("ReadDir(.) = %v, want only dir", entries)
+	}
+	trashed, err := trash.Entries()
+	check(t, err)
+	if len(trashed) != 3 || trashed[0].Path != "dir/file" || trashed[2].Path != "dir/sub" {
+		t.Errorf("Entries() = %v, want dir/file twice and dir/sub", trashed)
+	}
+
+	check(t, trash.Restore("dir/file"))
+	checkContents(t, fsys, "dir/file", "second")
+	if err := trash.Restore("dir/file"); !errors.Is(err, ErrExist) {
+		t.Errorf("Restore over existing file: got %v, want ErrExist", err)
+	}
+	check(t, trash.Restore("dir/sub"))
+	checkContents(t, fsys, "dir/sub/file", "lower")
+
+	check(t, trash.Empty(time.Hour))
+	if trashed, _ := trash.Entries(); len(trashed) != 1 {
+		t.Errorf("Empty(time.Hour) removed recent entries: %v", trashed)
+	}
+	check(t, trash.Empty(0))
+	if trashed, _ := trash.Entries(); len(trashed) != 0 {
+		t.Errorf("Empty(0) left %v", trashed)
+	}
+}
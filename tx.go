@@ -0,0 +1,197 @@
+package wrfs
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"sync"
+)
+
+// txStagePrefix is the prefix of the directories in which transactions stage their changes.
+const txStagePrefix = ".wrfs-tx-"
+
+// A TxFS is a transaction on a file system, started by Begin. Modifications made through the TxFS are
+// buffered, visible only through the TxFS, until they are applied to the underlying file system by Commit
+// or discarded by Rollback. A TxFS must not be used after Commit or Rollback, and files opened through it
+// must be closed before then.
+type TxFS struct {
+	*overlayFS
+	fsys  FS
+	stage string
+
+	mu   sync.Mutex
+	done bool
+}
+
+// Begin starts a transaction on fsys, whose changes are staged in a hidden temporary directory
+// at the root of fsys. The directory is removed by Commit and Rollback.
+//
+// Staging the changes in fsys itself allows Commit to move each new or modified file into place by
+// renaming it, so no file is ever seen partially written. Commit applies the changes to different
+// files one after the other, however, so concurrent readers of fsys can observe a partially applied
+// transaction, and an interrupted Commit leaves the remaining changes in the staging directory.
+func Begin(fsys FS) (*TxFS, error) {
+	stage, err := MkdirTemp(fsys, ".", txStagePrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	upper, err := Sub(fsys, stage)
+	if err != nil {
+		RemoveAll(fsys, stage)
+		return nil, err
+	}
+	lower := &txLower{fsWrapper{fsys}, path.Base(stage)}
+	return &TxFS{overlayFS: &overlayFS{upper: upper, lower: lower}, fsys: fsys, stage: stage}, nil
+}
+
+// finish marks the transaction as done, and fails if it already was.
+func (tx *TxFS) finish(op string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return &PathError{Op: op, Path: tx.stage, Err: ErrClosed}
+	}
+	tx.done = true
+	return nil
+}
+
+// Commit applies the changes made in the transaction to the underlying file system.
+func (tx *TxFS) Commit() error {
+	if err := tx.finish("commit"); err != nil {
+		return err
+	}
+	if err := tx.commitDir("."); err != nil {
+		return err
+	}
+	return RemoveAll(tx.fsys, tx.stage)
+}
+
+// Rollback discards the changes made in the transaction.
+func (tx *TxFS) Rollback() error {
+	if err := tx.finish("rollback"); err != nil {
+		return err
+	}
+	return RemoveAll(tx.fsys, tx.stage)
+}
+
+// commitDir applies the staged changes in the directory dir, which exists in the underlying file system.
+func (tx *TxFS) commitDir(dir string) error {
+	entries, err := ReadDir(tx.upper, dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() != WhiteoutOpaque {
+			continue
+		}
+		// The directory replaced a removed one, so none of the old contents survive.
+		old, err := ReadDir(tx.lower, dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range old {
+			if err := RemoveAll(tx.fsys, path.Join(dir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	for _, entry := range entries {
+		name := path.Join(dir, entry.Name())
+		switch {
+		case entry.Name() == WhiteoutOpaque:
+		case strings.HasPrefix(entry.Name(), WhiteoutPrefix):
+			if err := RemoveAll(tx.fsys, path.Join(dir, strings.TrimPrefix(entry.Name(), WhiteoutPrefix))); err != nil {
+				return err
+			}
+		case entry.IsDir():
+			if err := tx.commitMkdir(name); err != nil {
+				return err
+			}
+			if err := tx.commitDir(name); err != nil {
+				return err
+			}
+		default:
+			if fi, err := Lstat(tx.fsys, name); err == nil && fi.IsDir() {
+				if err := RemoveAll(tx.fsys, name); err != nil {
+					return err
+				}
+			}
+			if err := Rename(tx.fsys, path.Join(tx.stage, name), name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// commitMkdir makes sure that the staged directory name exists, with the same permissions, in the underlying
+// file system.
+func (tx *TxFS) commitMkdir(name string) error {
+	staged, err := Stat(tx.upper, name)
+	if err != nil {
+		return err
+	}
+	fi, err := Lstat(tx.fsys, name)
+	switch {
+	case errors.Is(err, ErrNotExist):
+		return Mkdir(tx.fsys, name, staged.Mode().Perm())
+	case err != nil:
+		return err
+	case !fi.IsDir():
+		if err := Remove(tx.fsys, name); err != nil {
+			return err
+		}
+		return Mkdir(tx.fsys, name, staged.Mode().Perm())
+	case fi.Mode().Perm() != staged.Mode().Perm():
+		return Chmod(tx.fsys, name, staged.Mode().Perm())
+	}
+	return nil
+}
+
+// txLower is the underlying file system of a transaction, with the staging directory hidden.
+type txLower struct {
+	fsWrapper
+	stage string
+}
+
+func (l *txLower) hide(name string) bool {
+	return name == l.stage
+}
+
+// staged reports whether name is in the staging directory.
+func (l *txLower) staged(name string) bool {
+	return name == l.stage || strings.HasPrefix(name, l.stage+"/")
+}
+
+func (l *txLower) Open(name string) (File, error) {
+	if l.staged(name) {
+		return nil, &PathError{Op: "open", Path: name, Err: ErrNotExist}
+	}
+	file, err := l.fsys.Open(name)
+	if err != nil || name != "." {
+		return file, err
+	}
+	return hidingDir{file, l.hide}, nil
+}
+
+func (l *txLower) Stat(name string) (FileInfo, error) {
+	if l.staged(name) {
+		return nil, &PathError{Op: "stat", Path: name, Err: ErrNotExist}
+	}
+	return Stat(l.fsys, name)
+}
+
+func (l *txLower) Lstat(name string) (FileInfo, error) {
+	if l.staged(name) {
+		return nil, &PathError{Op: "lstat", Path: name, Err: ErrNotExist}
+	}
+	return Lstat(l.fsys, name)
+}
+
+func (l *txLower) ReadDir(name string) ([]DirEntry, error) {
+	entries, err := ReadDir(l.fsys, name)
+	if name == "." {
+		entries = filterEntries(entries, l.hide)
+	}
+	return entries, err
+}
@@ -0,0 +1,55 @@
+package wrfs_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/wrfstest"
+)
+
+func TestTx(t *testing.T) {
+	lower := newLowerFS(t)
+	tx, err := Begin(lower)
+	check(t, err)
+	if err := wrfstest.TestWriteFS(tx, wrfstest.Dir("dir")); err != nil {
+		t.Fatal(err)
+	}
+	check(t, tx.Rollback())
+	if err := tx.Commit(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Commit after Rollback: got %v, want ErrClosed", err)
+	}
+	entries, err := ReadDir(lower, ".")
+	check(t, err)
+	if len(entries) != 1 {
+		t.Errorf("ReadDir(.) after Rollback = %v, want only dir", entries)
+	}
+
+	tx, err = Begin(lower)
+	check(t, err)
+	check(t, WriteFile(tx, "dir/file", []byte("tx"), 0644))
+	check(t, WriteFile(tx, "dir/new", []byte("new"), 0644))
+	check(t, RemoveAll(tx, "dir/sub"))
+	check(t, Mkdir(tx, "dir/sub", 0755))
+	check(t, Rename(tx, "dir/new", "dir/sub/new"))
+	entries, err = ReadDir(tx, ".")
+	check(t, err)
+	if len(entries) != 1 {
+		t.Errorf("ReadDir(.) in transaction = %v, want only dir", entries)
+	}
+	checkContents(t, lower, "dir/file", "lower")
+
+	check(t, tx.Commit())
+	checkContents(t, lower, "dir/file", "tx")
+	checkContents(t, lower, "dir/sub/new", "new")
+	for _, name := range []string{"dir/new", "dir/sub/file"} {
+		if _, err := Stat(lower, name); !errors.Is(err, ErrNotExist) {
+			t.Errorf("Stat(%s) after Commit: got %v, want ErrNotExist", name, err)
+		}
+	}
+	entries, err = ReadDir(lower, ".")
+	check(t, err)
+	if len(entries) != 1 {
+		t.Errorf("ReadDir(.) after Commit = %v, want only dir", entries)
+	}
+}
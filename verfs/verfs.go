@@ -0,0 +1,428 @@
+// Package verfs keeps the previous versions of the files in a wrfs file system.
+//
+// Before a regular file is overwritten, truncated, replaced by Rename or removed through a versioned file
+// system, its contents are saved as a new version in a shadow directory of the underlying file system.
+// The versions of a file can then be listed, opened and restored. Versions are kept per path: renaming
+// a file does not move its history, and a new file with the name of a removed one continues its history.
+//
+// For a file named dir/file, the versions are stored as dir/file~1, dir/file~2 and so on in the shadow
+// directory, with the modification time the file had when the version was saved. The shadow directory is
+// hidden from ReadDir, and cannot be accessed through the versioned file system.
+package verfs
+
+import (
+	"errors"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/relab/wrfs"
+)
+
+// DefaultDir is the shadow directory used when no Dir option is given.
+const DefaultDir = ".versions"
+
+// An Option configures New.
+type Option func(*FS)
+
+// Dir sets the name of the shadow directory in which versions are stored.
+func Dir(name string) Option {
+	return func(v *FS) { v.dir = name }
+}
+
+// MaxVersions limits the number of versions kept for each file to n, removing the oldest versions
+// as new ones are saved. By default, all versions are kept.
+func MaxVersions(n int) Option {
+	return func(v *FS) { v.max = n }
+}
+
+// A Version describes a saved version of a file.
+type Version struct {
+	ID      int       // the number of the version, increasing from 1 for each file
+	ModTime time.Time // the modification time of the file when the version was saved
+	Size    int64     // the size of the version
+}
+
+// FS is a file system that saves the previous versions of its files. It is created by New.
+type FS struct {
+	fsys wrfs.FS
+	dir  string
+	max  int
+
+	mu sync.Mutex // serializes the saving of versions
+}
+
+// New returns a versioned file system backed by fsys.
+func New(fsys wrfs.FS, opts ...Option) *FS {
+	v := &FS{fsys: fsys, dir: DefaultDir}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// shadowed reports whether name is in the shadow directory.
+func (v *FS) shadowed(name string) bool {
+	return name == v.dir || strings.HasPrefix(name, v.dir+"/")
+}
+
+// check returns an error if name is in the shadow directory.
+func (v *FS) check(op, name string) error {
+	if v.shadowed(name) {
+		return &wrfs.PathError{Op: op, Path: name, Err: wrfs.ErrPermission}
+	}
+	return nil
+}
+
+func (v *FS) check2(op, oldname, newname string) error {
+	if v.shadowed(oldname) || v.shadowed(newname) {
+		return &wrfs.LinkError{Op: op, Old: oldname, New: newname, Err: wrfs.ErrPermission}
+	}
+	return nil
+}
+
+// versionName returns the name under which the version id of name is stored.
+func (v *FS) versionName(name string, id int) string {
+	return path.Join(v.dir, name) + "~" + strconv.Itoa(id)
+}
+
+// Versions returns the saved versions of the named file, oldest first.
+func (v *FS) Versions(name string) ([]Version, error) {
+	if !wrfs.ValidPath(name) || name == "." {
+		return nil, &wrfs.PathError{Op: "versions", Path: name, Err: wrfs.ErrInvalid}
+	}
+	if err := v.check("versions", name); err != nil {
+		return nil, err
+	}
+	entries, err := wrfs.ReadDir(v.fsys, path.Join(v.dir, path.Dir(name)))
+	if errors.Is(err, wrfs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	prefix := path.Base(name) + "~"
+	var versions []Version
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), prefix) || !e.Type().IsRegular() {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(e.Name(), prefix))
+		if err != nil || id <= 0 {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, Version{ID: id, ModTime: fi.ModTime(), Size: fi.Size()})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].ID < versions[j].ID })
+	return versions, nil
+}
+
+// OpenVersion opens the version id of the named file for reading.
+func (v *FS) OpenVersion(name string, id int) (wrfs.File, error) {
+	if err := v.check("open", name); err != nil {
+		return nil, err
+	}
+	file, err := v.fsys.Open(v.versionName(name, id))
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "open", Path: name + "~" + strconv.Itoa(id), Err: wrfs.ErrNotExist}
+	}
+	return file, nil
+}
+
+// Restore replaces the contents of the named file with the version id, saving the current contents as a
+// new version first. The file is created if it does not exist.
+func (v *FS) Restore(name string, id int) error {
+	if err := v.check("restore", name); err != nil {
+		return err
+	}
+	src := v.versionName(name, id)
+	if _, err := wrfs.Stat(v.fsys, src); err != nil {
+		return &wrfs.PathError{Op: "restore", Path: name + "~" + strconv.Itoa(id), Err: wrfs.ErrNotExist}
+	}
+	if _, err := v.save(name, false); err != nil {
+		return err
+	}
+	return wrfs.CopyFile(v.fsys, name, v.fsys, src)
+}
+
+// save saves the contents of the named file as a new version if it is a regular file, by moving it into
+// the shadow directory if move is true, and by copying it otherwise. It reports whether a version was saved.
+func (v *FS) save(name string, move bool) (bool, error) {
+	fi, err := wrfs.Lstat(v.fsys, name)
+	if errors.Is(err, wrfs.ErrNotExist) || err == nil && !fi.Mode().IsRegular() {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	versions, err := v.Versions(name)
+	if err != nil {
+		return false, err
+	}
+	id := 1
+	if len(versions) > 0 {
+		id = versions[len(versions)-1].ID + 1
+	}
+	dst := v.versionName(name, id)
+	if err := wrfs.MkdirAll(v.fsys, path.Dir(dst), 0755); err != nil {
+		return false, err
+	}
+	if move {
+		err = wrfs.Move(v.fsys, name, dst)
+	} else if err = wrfs.CopyFile(v.fsys, dst, v.fsys, name); err == nil {
+		err = wrfs.Chtimes(v.fsys, dst, fi.ModTime(), fi.ModTime())
+		if errors.Is(err, wrfs.ErrUnsupported) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if v.max > 0 {
+		for _, old := range versions[:max(0, len(versions)+1-v.max)] {
+			if err := wrfs.Remove(v.fsys, v.versionName(name, old.ID)); err != nil {
+				return true, err
+			}
+		}
+	}
+	return true, nil
+}
+
+func (v *FS) Open(name string) (wrfs.File, error) {
+	if err := v.check("open", name); err != nil {
+		return nil, err
+	}
+	file, err := v.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if name == path.Dir(v.dir) {
+		return &hidingDir{file, path.Base(v.dir)}, nil
+	}
+	return file, nil
+}
+
+// OpenFile opens the named file, saving its contents as a new version first if it is opened for writing.
+func (v *FS) OpenFile(name string, flag int, perm wrfs.FileMode) (wrfs.File, error) {
+	if flag&(wrfs.O_WRONLY|wrfs.O_RDWR|wrfs.O_CREATE) == 0 {
+		return v.Open(name)
+	}
+	if err := v.check("open", name); err != nil {
+		return nil, err
+	}
+	if flag&(wrfs.O_WRONLY|wrfs.O_RDWR) != 0 {
+		if _, err := v.save(name, false); err != nil {
+			return nil, err
+		}
+	}
+	return wrfs.OpenFile(v.fsys, name, flag, perm)
+}
+
+func (v *FS) Stat(name string) (wrfs.FileInfo, error) {
+	if err := v.check("stat", name); err != nil {
+		return nil, err
+	}
+	return wrfs.Stat(v.fsys, name)
+}
+
+func (v *FS) Lstat(name string) (wrfs.FileInfo, error) {
+	if err := v.check("lstat", name); err != nil {
+		return nil, err
+	}
+	return wrfs.Lstat(v.fsys, name)
+}
+
+func (v *FS) ReadDir(name string) ([]wrfs.DirEntry, error) {
+	if err := v.check("readdir", name); err != nil {
+		return nil, err
+	}
+	entries, err := wrfs.ReadDir(v.fsys, name)
+	if name == path.Dir(v.dir) {
+		entries = hide(entries, path.Base(v.dir))
+	}
+	return entries, err
+}
+
+func (v *FS) Chmod(name string, mode wrfs.FileMode) error {
+	if err := v.check("chmod", name); err != nil {
+		return err
+	}
+	return wrfs.Chmod(v.fsys, name, mode)
+}
+
+func (v *FS) Chown(name string, uid, gid int) error {
+	if err := v.check("chown", name); err != nil {
+		return err
+	}
+	return wrfs.Chown(v.fsys, name, uid, gid)
+}
+
+func (v *FS) Lchown(name string, uid, gid int) error {
+	if err := v.check("lchown", name); err != nil {
+		return err
+	}
+	return wrfs.Lchown(v.fsys, name, uid, gid)
+}
+
+func (v *FS) Chtimes(name string, atime, mtime time.Time) error {
+	if err := v.check("chtimes", name); err != nil {
+		return err
+	}
+	return wrfs.Chtimes(v.fsys, name, atime, mtime)
+}
+
+func (v *FS) Mkdir(name string, perm wrfs.FileMode) error {
+	if err := v.check("mkdir", name); err != nil {
+		return err
+	}
+	return wrfs.Mkdir(v.fsys, name, perm)
+}
+
+func (v *FS) MkdirAll(name string, perm wrfs.FileMode) error {
+	if err := v.check("mkdir", name); err != nil {
+		return err
+	}
+	return wrfs.MkdirAll(v.fsys, name, perm)
+}
+
+func (v *FS) Readlink(name string) (string, error) {
+	if err := v.check("readlink", name); err != nil {
+		return "", err
+	}
+	return wrfs.Readlink(v.fsys, name)
+}
+
+// Remove removes the named file or empty directory. A regular file is moved into the shadow directory
+// as a new version.
+func (v *FS) Remove(name string) error {
+	if err := v.check("remove", name); err != nil {
+		return err
+	}
+	if saved, err := v.save(name, true); saved || err != nil {
+		return err
+	}
+	return wrfs.Remove(v.fsys, name)
+}
+
+// RemoveAll removes the tree rooted at name, moving each regular file in it into the shadow directory
+// as a new version.
+func (v *FS) RemoveAll(name string) error {
+	if err := v.check("removeall", name); err != nil {
+		return err
+	}
+	if name == "." || name == path.Dir(v.dir) {
+		return &wrfs.PathError{Op: "removeall", Path: name, Err: wrfs.ErrPermission}
+	}
+	err := wrfs.WalkDir(v.fsys, name, func(p string, d wrfs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		_, err = v.save(p, true)
+		return err
+	})
+	if err != nil && !errors.Is(err, wrfs.ErrNotExist) {
+		return err
+	}
+	return wrfs.RemoveAll(v.fsys, name)
+}
+
+// Rename renames oldpath to newpath, saving the file replaced at newpath as a new version.
+func (v *FS) Rename(oldpath, newpath string) error {
+	if err := v.check2("rename", oldpath, newpath); err != nil {
+		return err
+	}
+	if oldpath != newpath {
+		if _, err := wrfs.Lstat(v.fsys, oldpath); err == nil {
+			if _, err := v.save(newpath, false); err != nil {
+				return err
+			}
+		}
+	}
+	return wrfs.Rename(v.fsys, oldpath, newpath)
+}
+
+func (v *FS) Symlink(oldname, newname string) error {
+	if err := v.check2("symlink", oldname, newname); err != nil {
+		return err
+	}
+	return wrfs.Symlink(v.fsys, oldname, newname)
+}
+
+func (v *FS) Link(oldname, newname string) error {
+	if err := v.check2("link", oldname, newname); err != nil {
+		return err
+	}
+	return wrfs.Link(v.fsys, oldname, newname)
+}
+
+func (v *FS) SameFile(fi1, fi2 wrfs.FileInfo) bool {
+	return wrfs.SameFile(v.fsys, fi1, fi2)
+}
+
+func (v *FS) Sync(name string) error {
+	if err := v.check("sync", name); err != nil {
+		return err
+	}
+	return wrfs.Sync(v.fsys, name)
+}
+
+func (v *FS) Statfs(name string) (wrfs.FSInfo, error) {
+	return wrfs.Statfs(v.fsys, name)
+}
+
+// Truncate truncates the named file, saving its contents as a new version first.
+func (v *FS) Truncate(name string, size int64) error {
+	if err := v.check("truncate", name); err != nil {
+		return err
+	}
+	if _, err := v.save(name, false); err != nil {
+		return err
+	}
+	return wrfs.Truncate(v.fsys, name, size)
+}
+
+// Capabilities returns the capabilities of the underlying file system, except locking and watching,
+// which are not supported.
+func (v *FS) Capabilities() wrfs.CapSet {
+	return wrfs.Capabilities(v.fsys) &^ (wrfs.CapLock | wrfs.CapWatch | wrfs.CapMkfifo | wrfs.CapMknod | wrfs.CapLchtimes | wrfs.CapSyncDir)
+}
+
+func hide(entries []wrfs.DirEntry, name string) []wrfs.DirEntry {
+	for i, e := range entries {
+		if e.Name() == name {
+			return append(entries[:i], entries[i+1:]...)
+		}
+	}
+	return entries
+}
+
+// hidingDir is a directory that hides the entry with the given name, the shadow directory.
+type hidingDir struct {
+	wrfs.File
+	name string
+}
+
+func (d *hidingDir) ReadDir(n int) ([]wrfs.DirEntry, error) {
+	dir, ok := d.File.(wrfs.ReadDirFile)
+	if !ok {
+		return nil, &wrfs.PathError{Op: "readdir", Path: ".", Err: wrfs.ErrUnsupported}
+	}
+	for {
+		entries, err := dir.ReadDir(n)
+		entries = hide(entries, d.name)
+		if len(entries) > 0 || err != nil || n <= 0 {
+			return entries, err
+		}
+	}
+}
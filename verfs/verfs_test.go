@@ -0,0 +1,89 @@
+package verfs_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+	"github.com/relab/wrfs/verfs"
+	"github.com/relab/wrfs/wrfstest"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkContents(t *testing.T, fsys wrfs.FS, name, want string) {
+	t.Helper()
+	data, err := wrfs.ReadFile(fsys, name)
+	check(t, err)
+	if string(data) != want {
+		t.Errorf("%s contains %q, want %q", name, data, want)
+	}
+}
+
+func TestWriteFS(t *testing.T) {
+	if err := wrfstest.TestWriteFS(verfs.New(memfs.New())); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	fsys := verfs.New(memfs.New())
+	check(t, wrfs.Mkdir(fsys, "dir", 0755))
+	for _, data := range []string{"one", "two", "three"} {
+		check(t, wrfs.WriteFile(fsys, "dir/file", []byte(data), 0644))
+	}
+	check(t, wrfs.Rename(fsys, "dir/file", "dir/other"))
+	check(t, wrfs.Remove(fsys, "dir/other"))
+
+	versions, err := fsys.Versions("dir/file")
+	check(t, err)
+	if len(versions) != 2 || versions[0].ID != 1 || versions[1].Size != 3 {
+		t.Errorf("Versions(dir/file) = %v, want versions 1 and 2 of sizes 3", versions)
+	}
+	file, err := fsys.OpenVersion("dir/file", 2)
+	check(t, err)
+	data, err := io.ReadAll(file)
+	check(t, err)
+	check(t, file.Close())
+	if string(data) != "two" {
+		t.Errorf("version 2 contains %q, want %q", data, "two")
+	}
+	versions, err = fsys.Versions("dir/other")
+	check(t, err)
+	if len(versions) != 1 {
+		t.Errorf("Versions(dir/other) = %v, want the removed file", versions)
+	}
+
+	check(t, fsys.Restore("dir/file", 1))
+	checkContents(t, fsys, "dir/file", "one")
+	check(t, fsys.Restore("dir/other", 1))
+	checkContents(t, fsys, "dir/other", "three")
+
+	entries, err := wrfs.ReadDir(fsys, ".")
+	check(t, err)
+	if len(entries) != 1 || entries[0].Name() != "dir" {
+		t.Errorf("ReadDir(.) = %v, want only dir", entries)
+	}
+	if _, err := fsys.Open(verfs.DefaultDir); !errors.Is(err, wrfs.ErrPermission) {
+		t.Errorf("Open of shadow directory: got %v, want ErrPermission", err)
+	}
+}
+
+func TestMaxVersions(t *testing.T) {
+	fsys := verfs.New(memfs.New(), verfs.MaxVersions(2))
+	for _, data := range []string{"one", "two", "three", "four"} {
+		check(t, wrfs.WriteFile(fsys, "file", []byte(data), 0644))
+	}
+	versions, err := fsys.Versions("file")
+	check(t, err)
+	if len(versions) != 2 || versions[0].ID != 2 || versions[1].ID != 3 {
+		t.Errorf("Versions(file) = %v, want versions 2 and 3", versions)
+	}
+}
@@ -0,0 +1,190 @@
+package wrfs
+
+import (
+	"io/fs"
+	"path"
+	"sync"
+)
+
+// WalkFunc is the type of the function called by Walk to visit each file or directory, as filepath.WalkFunc is for
+// filepath.Walk.
+//
+// The path argument contains the argument to Walk as a prefix, and the info argument is the FileInfo for the named
+// path, as returned by Lstat. If the function returns SkipDir when invoked on a directory, Walk skips the directory's
+// contents entirely; when invoked on a file, Walk skips the remaining files in the containing directory. If it
+// returns SkipAll, Walk skips all remaining files and directories. Otherwise, if the function returns a non-nil
+// error, Walk stops entirely and returns that error.
+//
+// The err argument reports an error related to path, in which case the function is called with info set to nil if
+// path could not be statted, or with the FileInfo of a directory that could not be read. Returning the error stops
+// the walk, while returning nil continues it.
+type WalkFunc func(path string, info FileInfo, err error) error
+
+// Walk walks the file tree rooted at root, calling fn for each file or directory in the tree, including root, for
+// code written for filepath.Walk. Unlike WalkDir, which should be preferred otherwise, it calls fn after reading
+// each directory, with the FileInfo of each file. The FileInfos are those returned by the Info method of the
+// DirEntries read from the directories, so that no further Lstat calls are made where ReadDir already provides
+// them.
+//
+// The files are walked in lexical order. Walk does not follow symbolic links, including root.
+func Walk(fsys FS, root string, fn WalkFunc) error {
+	info, err := lstatOrStat(fsys, root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walk(fsys, root, info, fn)
+	}
+	if err == SkipDir || err == SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walk recursively descends name, calling fn.
+func walk(fsys FS, name string, info FileInfo, fn WalkFunc) error {
+	if !info.IsDir() {
+		return fn(name, info, nil)
+	}
+	entries, err := ReadDir(fsys, name)
+	err1 := fn(name, info, err)
+	// If err != nil, the directory cannot be walked, and fn has been told so.
+	if err != nil || err1 != nil {
+		return err1
+	}
+	for _, entry := range entries {
+		filename := path.Join(name, entry.Name())
+		fileInfo, err := entry.Info()
+		if err != nil {
+			fileInfo, err = lstatOrStat(fsys, filename)
+		}
+		if err != nil {
+			if err := fn(filename, fileInfo, err); err != nil && err != SkipDir {
+				return err
+			}
+			continue
+		}
+		if err := walk(fsys, filename, fileInfo, fn); err != nil {
+			if !fileInfo.IsDir() || err != SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WalkDirConcurrent walks the file tree rooted at root like WalkDir, but reads up to workers directories at the
+// same time, for file systems where each ReadDir takes long, such as those reached over a network. The calls to fn
+// are never made concurrently, and fn is called for a directory before it is read, and for its entries in lexical
+// order, but the entries of different directories may be visited in any order. As with WalkDir, a SkipDir returned
+// for a directory prevents it from being read, a SkipDir returned for a file skips the remaining entries of its
+// directory, and SkipAll ends the walk. If fn returns another error, WalkDirConcurrent returns it once the
+// directories being read have been read. A workers value less than 1 is treated as 1.
+func WalkDirConcurrent(fsys FS, root string, workers int, fn WalkDirFunc) error {
+	info, err := Stat(fsys, root)
+	if err == nil {
+		err = fn(root, fs.FileInfoToDirEntry(info), nil)
+	} else {
+		err = fn(root, nil, err)
+	}
+	if err != nil || info == nil || !info.IsDir() {
+		if err == SkipDir || err == SkipAll {
+			return nil
+		}
+		return err
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	w := &concurrentWalk{fsys: fsys, fn: fn, queue: []walkDir{{root, fs.FileInfoToDirEntry(info)}}}
+	w.cond.L = &w.mu
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work()
+		}()
+	}
+	wg.Wait()
+	return w.err
+}
+
+// walkDir is a directory waiting to be read by a concurrentWalk.
+type walkDir struct {
+	name string
+	d    DirEntry
+}
+
+// concurrentWalk is the state of WalkDirConcurrent, shared by its workers.
+type concurrentWalk struct {
+	fsys FS
+	fn   WalkDirFunc
+
+	mu     sync.Mutex // held while calling fn
+	cond   sync.Cond  // signaled when queue, active or done change
+	queue  []walkDir
+	active int // the number of directories being read
+	done   bool
+	err    error
+}
+
+// work reads directories from the queue until there are none left to read.
+func (w *concurrentWalk) work() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for {
+		for len(w.queue) == 0 && w.active > 0 && !w.done {
+			w.cond.Wait()
+		}
+		if w.done || len(w.queue) == 0 {
+			w.cond.Broadcast()
+			return
+		}
+		dir := w.queue[len(w.queue)-1]
+		w.queue = w.queue[:len(w.queue)-1]
+		w.active++
+		w.mu.Unlock()
+		entries, err := ReadDir(w.fsys, dir.name)
+		w.mu.Lock()
+		w.active--
+		if !w.done {
+			w.visit(dir, entries, err)
+		}
+		w.cond.Broadcast()
+	}
+}
+
+// visit calls fn for the entries read from dir, queuing the directories among them.
+func (w *concurrentWalk) visit(dir walkDir, entries []DirEntry, err error) {
+	if err != nil {
+		// Second call, to report the ReadDir error.
+		if err = w.fn(dir.name, dir.d, err); err != nil && err != SkipDir {
+			w.stop(err)
+			return
+		}
+	}
+	for _, entry := range entries {
+		name := path.Join(dir.name, entry.Name())
+		if err := w.fn(name, entry, nil); err != nil {
+			if err == SkipDir {
+				if entry.IsDir() {
+					continue
+				}
+				break
+			}
+			w.stop(err)
+			return
+		}
+		if entry.IsDir() {
+			w.queue = append(w.queue, walkDir{name, entry})
+		}
+	}
+}
+
+// stop ends the walk, returning err unless it is SkipAll.
+func (w *concurrentWalk) stop(err error) {
+	if err != SkipAll {
+		w.err = err
+	}
+	w.done = true
+}
@@ -0,0 +1,85 @@
+package wrfs_test
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestWalk(t *testing.T) {
+	fsys := newLowerFS(t)
+	check(t, WriteFile(fsys, "dir/sub/skipped", []byte("x"), 0644))
+	check(t, WriteFile(fsys, "top", []byte("top"), 0644))
+	var visited []string
+	check(t, Walk(fsys, ".", func(name string, info FileInfo, err error) error {
+		check(t, err)
+		visited = append(visited, name)
+		if name == "top" && info.Size() != 3 {
+			t.Errorf("Walk: size of top = %d, want 3", info.Size())
+		}
+		if name == "dir/sub/file" {
+			return SkipDir
+		}
+		return nil
+	}))
+	if got, want := strings.Join(visited, " "), ". dir dir/file dir/sub dir/sub/file top"; got != want {
+		t.Errorf("Walk visited %q, want %q", got, want)
+	}
+	var errs []string
+	check(t, Walk(fsys, "missing", func(name string, info FileInfo, err error) error {
+		if info != nil || !errors.Is(err, ErrNotExist) {
+			t.Errorf("Walk(missing): got %v, %v, want nil, ErrNotExist", info, err)
+		}
+		errs = append(errs, name)
+		return nil
+	}))
+	if len(errs) != 1 {
+		t.Errorf("Walk(missing) called fn %d times, want 1", len(errs))
+	}
+	if err := Walk(fsys, ".", func(string, FileInfo, error) error { return SkipAll }); err != nil {
+		t.Errorf("Walk returning SkipAll: %v", err)
+	}
+}
+
+func TestWalkDirConcurrent(t *testing.T) {
+	fsys := newLowerFS(t)
+	for _, dir := range []string{"a/b/c", "a/d", "e/f", "skip/g"} {
+		check(t, MkdirAll(fsys, dir, 0755))
+		check(t, WriteFile(fsys, dir+"/1", nil, 0644))
+		check(t, WriteFile(fsys, dir+"/2", nil, 0644))
+	}
+	var visited []string
+	check(t, WalkDirConcurrent(fsys, ".", 4, func(name string, d DirEntry, err error) error {
+		check(t, err)
+		visited = append(visited, name)
+		switch name {
+		case "skip":
+			return SkipDir
+		case "e/f/1":
+			return SkipDir
+		}
+		return nil
+	}))
+	sort.Strings(visited)
+	want := ". a a/b a/b/c a/b/c/1 a/b/c/2 a/d a/d/1 a/d/2 dir dir/file dir/sub dir/sub/file e e/f e/f/1 skip"
+	if got := strings.Join(visited, " "); got != want {
+		t.Errorf("WalkDirConcurrent visited %q, want %q", got, want)
+	}
+	stop := errors.New("stop")
+	if err := WalkDirConcurrent(fsys, ".", 4, func(name string, d DirEntry, err error) error {
+		if name == "a/d" {
+			return stop
+		}
+		return nil
+	}); err != stop {
+		t.Errorf("WalkDirConcurrent returning an error: got %v, want it", err)
+	}
+	if err := WalkDirConcurrent(fsys, "missing", 4, func(name string, d DirEntry, err error) error {
+		return err
+	}); !errors.Is(err, ErrNotExist) {
+		t.Errorf("WalkDirConcurrent(missing): got %v, want ErrNotExist", err)
+	}
+}
@@ -0,0 +1,200 @@
+package wasmfs
+
+import (
+	"bytes"
+	"io"
+	"syscall/js"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/blobfs"
+)
+
+// A Store is a blobfs.BlobStore keeping blobs in an IndexedDB database. Each blob is a record of the object store
+// "files" with the key of the blob as its key, and an object with the fields data, a Uint8Array, and modTime, the
+// time it was stored in milliseconds since the Unix epoch, as its value.
+type Store struct {
+	db js.Value
+}
+
+// OpenStore opens the IndexedDB database of the given name as a Store, creating the database if needed.
+func OpenStore(database string) (*Store, error) {
+	idb := js.Global().Get("indexedDB")
+	if idb.IsUndefined() {
+		return nil, &wrfs.PathError{Op: "open", Path: database, Err: wrfs.ErrUnsupported}
+	}
+	req := idb.Call("open", database, 1)
+	upgrade := js.FuncOf(func(this js.Value, args []js.Value) any {
+		req.Get("result").Call("createObjectStore", storeName)
+		return nil
+	})
+	defer upgrade.Release()
+	req.Set("onupgradeneeded", upgrade)
+	db, err := await(req)
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "open", Path: database, Err: err}
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	s.db.Call("close")
+	return nil
+}
+
+// objectStore returns the object store of the blobs in a new transaction of the given mode.
+func (s *Store) objectStore(mode string) (tx, store js.Value) {
+	tx = s.db.Call("transaction", storeName, mode)
+	return tx, tx.Call("objectStore", storeName)
+}
+
+// Get implements blobfs.BlobStore.
+func (s *Store) Get(key string) (io.ReadCloser, error) {
+	_, store := s.objectStore("readonly")
+	value, err := await(store.Call("get", key))
+	if err != nil {
+		return nil, &wrfs.PathError{Op: "get", Path: key, Err: err}
+	}
+	if value.IsUndefined() {
+		return nil, &wrfs.PathError{Op: "get", Path: key, Err: wrfs.ErrNotExist}
+	}
+	array := value.Get("data")
+	data := make([]byte, array.Length())
+	js.CopyBytesToGo(data, array)
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Put implements blobfs.BlobStore. It returns once the transaction storing the blob has completed.
+func (s *Store) Put(key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	array := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(array, data)
+	value := js.Global().Get("Object").New()
+	value.Set("data", array)
+	value.Set("modTime", time.Now().UnixMilli())
+	tx, store := s.objectStore("readwrite")
+	store.Call("put", value, key)
+	if err := awaitTx(tx); err != nil {
+		return &wrfs.PathError{Op: "put", Path: key, Err: err}
+	}
+	return nil
+}
+
+// Delete implements blobfs.BlobStore. Deleting a blob that does not exist succeeds.
+func (s *Store) Delete(key string) error {
+	tx, store := s.objectStore("readwrite")
+	store.Call("delete", key)
+	if err := awaitTx(tx); err != nil {
+		return &wrfs.PathError{Op: "delete", Path: key, Err: err}
+	}
+	return nil
+}
+
+// List implements blobfs.BlobStore. It lists the blobs in order of their keys, and reads them all before calling
+// fn, since a transaction cannot wait for Go code.
+func (s *Store) List(prefix string, fn func(blobfs.BlobInfo) error) error {
+	_, store := s.objectStore("readonly")
+	var req js.Value
+	if prefix == "" {
+		req = store.Call("openCursor")
+	} else {
+		// All keys starting with prefix sort between prefix and prefix followed by the greatest code unit.
+		keyRange := js.Global().Get("IDBKeyRange").Call("bound", prefix, prefix+"\uffff")
+		req = store.Call("openCursor", keyRange)
+	}
+	var infos []blobfs.BlobInfo
+	done := make(chan error, 1)
+	success := js.FuncOf(func(this js.Value, args []js.Value) any {
+		cursor := req.Get("result")
+		if cursor.IsNull() {
+			done <- nil
+			return nil
+		}
+		value := cursor.Get("value")
+		infos = append(infos, blobfs.BlobInfo{
+			Key:     cursor.Get("key").String(),
+			Size:    int64(value.Get("data").Length()),
+			ModTime: time.UnixMilli(int64(value.Get("modTime").Float())),
+		})
+		cursor.Call("continue")
+		return nil
+	})
+	defer success.Release()
+	failure := js.FuncOf(func(this js.Value, args []js.Value) any {
+		done <- jsError(req.Get("error"))
+		return nil
+	})
+	defer failure.Release()
+	req.Set("onsuccess", success)
+	req.Set("onerror", failure)
+	if err := <-done; err != nil {
+		return &wrfs.PathError{Op: "list", Path: prefix, Err: err}
+	}
+	for _, info := range infos {
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// await waits for the IndexedDB request req to finish, and returns its result.
+func await(req js.Value) (js.Value, error) {
+	done := make(chan error, 1)
+	success := js.FuncOf(func(this js.Value, args []js.Value) any {
+		done <- nil
+		return nil
+	})
+	defer success.Release()
+	failure := js.FuncOf(func(this js.Value, args []js.Value) any {
+		done <- jsError(req.Get("error"))
+		return nil
+	})
+	defer failure.Release()
+	req.Set("onsuccess", success)
+	req.Set("onerror", failure)
+	if err := <-done; err != nil {
+		return js.Undefined(), err
+	}
+	return req.Get("result"), nil
+}
+
+// awaitTx waits for the IndexedDB transaction tx to complete. A failed transaction fires an error event before it
+// is aborted, so only the abort event is handled.
+func awaitTx(tx js.Value) error {
+	done := make(chan error, 1)
+	complete := js.FuncOf(func(this js.Value, args []js.Value) any {
+		done <- nil
+		return nil
+	})
+	defer complete.Release()
+	failure := js.FuncOf(func(this js.Value, args []js.Value) any {
+		done <- jsError(tx.Get("error"))
+		return nil
+	})
+	defer failure.Release()
+	tx.Set("oncomplete", complete)
+	tx.Set("onabort", failure)
+	return <-done
+}
+
+// domError is an error reported by IndexedDB, such as a QuotaExceededError when the origin is out of storage.
+type domError struct {
+	name, message string
+}
+
+func (e *domError) Error() string {
+	return "wasmfs: " + e.name + ": " + e.message
+}
+
+// jsError returns the error describing the DOMException err, which may be null if a transaction was aborted.
+func jsError(err js.Value) error {
+	if err.IsNull() || err.IsUndefined() {
+		return &domError{name: "AbortError", message: "transaction aborted"}
+	}
+	return &domError{name: err.Get("name").String(), message: err.Get("message").String()}
+}
@@ -0,0 +1,44 @@
+//go:build !js
+// +build !js
+
+package wasmfs
+
+import (
+	"io"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/blobfs"
+)
+
+// A Store is a blobfs.BlobStore keeping blobs in an IndexedDB database. It is only supported with GOOS=js.
+type Store struct{}
+
+// OpenStore opens the IndexedDB database of the given name as a Store. It is only supported with GOOS=js.
+func OpenStore(database string) (*Store, error) {
+	return nil, &wrfs.PathError{Op: "open", Path: database, Err: wrfs.ErrUnsupported}
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return wrfs.ErrUnsupported
+}
+
+// Get implements blobfs.BlobStore.
+func (s *Store) Get(key string) (io.ReadCloser, error) {
+	return nil, wrfs.ErrUnsupported
+}
+
+// Put implements blobfs.BlobStore.
+func (s *Store) Put(key string, r io.Reader) error {
+	return wrfs.ErrUnsupported
+}
+
+// Delete implements blobfs.BlobStore.
+func (s *Store) Delete(key string) error {
+	return wrfs.ErrUnsupported
+}
+
+// List implements blobfs.BlobStore.
+func (s *Store) List(prefix string, fn func(blobfs.BlobInfo) error) error {
+	return wrfs.ErrUnsupported
+}
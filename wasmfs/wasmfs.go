@@ -0,0 +1,30 @@
+// Package wasmfs provides a file system for WebAssembly programs running in a browser, which keeps its files in an
+// IndexedDB database of the origin, so that they persist across page loads.
+//
+// IndexedDB is available both to pages and to web workers, unlike the synchronous access handles of the Origin
+// Private File System. The database is accessed through syscall/js, whose asynchronous requests the file system
+// waits for. Since the JavaScript event loop cannot run while a function called from JavaScript is blocked, the
+// file system must not be used directly in callbacks created with js.FuncOf, but from goroutines started by them.
+//
+// The package is only supported with GOOS=js; on other platforms, OpenStore and New fail with an error matching
+// wrfs.ErrUnsupported.
+package wasmfs
+
+import (
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/blobfs"
+)
+
+// storeName is the name of the object store of the database, which maps the names of files to their contents.
+const storeName = "files"
+
+// New returns a file system keeping its files in the IndexedDB database of the given name, creating the database
+// if needed. The file system is a blobfs.FS on top of the Store of the database, so files are read into memory
+// when opened, and stored when closed.
+func New(database string) (wrfs.FS, error) {
+	store, err := OpenStore(database)
+	if err != nil {
+		return nil, err
+	}
+	return blobfs.New(store), nil
+}
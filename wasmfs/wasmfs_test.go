@@ -0,0 +1,126 @@
+//go:build js
+// +build js
+
+package wasmfs_test
+
+import (
+	"errors"
+	"syscall/js"
+	"testing"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/blobfs"
+	"github.com/relab/wrfs/wasmfs"
+	"github.com/relab/wrfs/wrfstest"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeIndexedDB implements the parts of IndexedDB used by Store in memory, for JavaScript environments without it.
+// Like IndexedDB, it fires events asynchronously, and completes transactions once their requests have finished.
+const fakeIndexedDB = `(() => {
+	const later = (f) => setTimeout(f, 0);
+	const databases = new Map();
+	class Transaction {
+		constructor(records) {
+			this.records = records;
+			this.pending = 0;
+			this.done = false;
+			later(() => this.finish());
+		}
+		objectStore() { return this; }
+		finish() {
+			if (this.pending === 0 && !this.done) {
+				this.done = true;
+				if (this.oncomplete) this.oncomplete({});
+			}
+		}
+		request(step) {
+			const req = {result: undefined, error: null};
+			this.pending++;
+			const fire = () => later(() => {
+				req.result = step(fire);
+				if (req.onsuccess) req.onsuccess({target: req});
+				if (req.result === null || typeof req.result !== "object" || !req.result.continue) {
+					this.pending--;
+					later(() => this.finish());
+				}
+			});
+			fire();
+			return req;
+		}
+		get(key) { return this.request(() => this.records.get(key)); }
+		put(value, key) { return this.request(() => { this.records.set(key, value); return key; }); }
+		delete(key) { return this.request(() => { this.records.delete(key); }); }
+		openCursor(range) {
+			const keys = [...this.records.keys()].sort().filter((k) => !range || (k >= range.lower && k <= range.upper));
+			let i = 0;
+			return this.request((fire) => {
+				if (i >= keys.length) return null;
+				const key = keys[i++];
+				return {key: key, value: this.records.get(key), continue: fire};
+			});
+		}
+	}
+	globalThis.IDBKeyRange = {bound: (lower, upper) => ({lower: lower, upper: upper})};
+	globalThis.indexedDB = {
+		open(name, version) {
+			const req = {result: undefined, error: null};
+			later(() => {
+				let db = databases.get(name);
+				const upgrade = !db;
+				if (upgrade) {
+					db = {
+						stores: new Map(),
+						createObjectStore(store) { this.stores.set(store, new Map()); },
+						transaction(store, mode) { return new Transaction(this.stores.get(store)); },
+						close() {},
+					};
+					databases.set(name, db);
+				}
+				req.result = db;
+				if (upgrade && req.onupgradeneeded) req.onupgradeneeded({target: req});
+				if (req.onsuccess) req.onsuccess({target: req});
+			});
+			return req;
+		},
+	};
+})()`
+
+func TestFS(t *testing.T) {
+	if js.Global().Get("indexedDB").IsUndefined() {
+		js.Global().Call("eval", fakeIndexedDB)
+	}
+	fsys, err := wasmfs.New("wasmfs-test")
+	check(t, err)
+	if err := wrfstest.TestWriteFS(fsys, wrfstest.SkipChmod(), wrfstest.SkipChown(), wrfstest.SkipChtimes(),
+		wrfstest.SkipLinks()); err != nil {
+		t.Fatal(err)
+	}
+	check(t, wrfs.MkdirAll(fsys, "dir/sub", 0755))
+	check(t, wrfs.WriteFile(fsys, "dir/file", []byte("hello"), 0644))
+
+	// The files persist in the database, and can be read through another Store.
+	store, err := wasmfs.OpenStore("wasmfs-test")
+	check(t, err)
+	defer store.Close()
+	if _, err := store.Get("missing"); !errors.Is(err, wrfs.ErrNotExist) {
+		t.Errorf("Get of a missing blob: got %v, want ErrNotExist", err)
+	}
+	fsys = blobfs.New(store)
+	data, err := wrfs.ReadFile(fsys, "dir/file")
+	check(t, err)
+	if string(data) != "hello" {
+		t.Errorf("dir/file contains %q", data)
+	}
+	entries, err := wrfs.ReadDir(fsys, "dir")
+	check(t, err)
+	if len(entries) != 2 || entries[0].Name() != "file" || !entries[1].IsDir() {
+		t.Errorf("ReadDir returned %v", entries)
+	}
+}
@@ -0,0 +1,136 @@
+package wrfs
+
+import (
+	"strings"
+	"sync"
+)
+
+// An EventOp describes the kind of change reported by an Event. It is a bit set,
+// since a single event may describe several changes.
+type EventOp uint32
+
+const (
+	EventCreate EventOp = 1 << iota // a file was created or moved into a watched directory
+	EventWrite                      // the contents of a file were modified
+	EventRemove                     // a file was removed
+	EventRename                     // a file was renamed or moved out of a watched directory
+	EventChmod                      // the metadata of a file was changed
+)
+
+// AllEvents is the set of all event kinds.
+const AllEvents = EventCreate | EventWrite | EventRemove | EventRename | EventChmod
+
+func (op EventOp) String() string {
+	var names []string
+	for _, o := range []struct {
+		op   EventOp
+		name string
+	}{
+		{EventCreate, "create"},
+		{EventWrite, "write"},
+		{EventRemove, "remove"},
+		{EventRename, "rename"},
+		{EventChmod, "chmod"},
+	} {
+		if op&o.op != 0 {
+			names = append(names, o.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// An Event describes a change to a watched file or directory.
+type Event struct {
+	Name string  // name of the changed file, relative to the root of the file system
+	Op   EventOp // the changes
+}
+
+func (e Event) String() string {
+	return e.Op.String() + " " + e.Name
+}
+
+// WatchConfig holds the configuration of a watch.
+// File systems implementing WatchFS build it from the given options with NewWatchConfig.
+type WatchConfig struct {
+	Ops    EventOp // the event kinds to report
+	Buffer int     // capacity of the event channel
+}
+
+// A WatchOption configures Watch.
+type WatchOption func(*WatchConfig)
+
+// NewWatchConfig returns the configuration described by opts.
+// By default all events are reported and the event channel has a capacity of 64.
+func NewWatchConfig(opts ...WatchOption) WatchConfig {
+	c := WatchConfig{Ops: AllEvents, Buffer: 64}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// WatchOps makes Watch report only the given kinds of events.
+func WatchOps(ops EventOp) WatchOption {
+	return func(c *WatchConfig) { c.Ops = ops }
+}
+
+// WatchBuffer sets the capacity of the event channel returned by Watch.
+// If the channel is full, the watcher blocks until events are received.
+func WatchBuffer(n int) WatchOption {
+	return func(c *WatchConfig) { c.Buffer = n }
+}
+
+// WatchFS is a file system that can report changes to files.
+type WatchFS interface {
+	FS
+
+	// Watch starts watching the named file or directory and returns a channel on which changes are reported,
+	// and a function that stops the watch. If name is a directory, changes to its direct entries are reported.
+	// The channel is closed when the watch is stopped, or when the watched file is removed.
+	Watch(name string, opts ...WatchOption) (<-chan Event, func(), error)
+}
+
+// Watch starts watching the named file or directory and returns a channel on which changes are reported,
+// and a function that stops the watch. The stop function must be called to release the resources of the watch.
+//
+// If fsys implements WatchFS, Watch calls fsys.Watch.
+// Otherwise Watch returns an error matching ErrUnsupported.
+func Watch(fsys FS, name string, opts ...WatchOption) (<-chan Event, func(), error) {
+	if fsys, ok := fsys.(WatchFS); ok {
+		return fsys.Watch(name, opts...)
+	}
+	return nil, nil, &PathError{Op: "watch", Path: name, Err: ErrUnsupported}
+}
+
+// mapEvents returns a channel that receives the events of in with their names mapped by fn,
+// and a function that stops the forwarding and calls stop. Events for which fn returns false are dropped.
+// The returned channel is closed when in is closed or the returned stop function is called.
+func mapEvents(in <-chan Event, stop func(), buffer int, fn func(name string) (string, bool)) (<-chan Event, func()) {
+	out := make(chan Event, buffer)
+	done := make(chan struct{})
+	go func() {
+		defer close(out)
+		for ev := range in {
+			name, ok := fn(ev.Name)
+			if !ok {
+				continue
+			}
+			ev.Name = name
+			select {
+			case out <- ev:
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return out, func() {
+		once.Do(func() {
+			close(done)
+			stop()
+		})
+	}
+}
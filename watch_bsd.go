@@ -0,0 +1,104 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package wrfs
+
+import (
+	"sync"
+	"syscall"
+)
+
+const kqueueNotes = syscall.NOTE_DELETE | syscall.NOTE_WRITE | syscall.NOTE_EXTEND | syscall.NOTE_ATTRIB | syscall.NOTE_RENAME
+
+// Watch watches name using kqueue. Unlike inotify, kqueue does not report which entry of a directory
+// changed, so changes to the entries of a watched directory are reported as EventWrite on the directory.
+func (hostFS) Watch(name string, opts ...WatchOption) (<-chan Event, func(), error) {
+	c := NewWatchConfig(opts...)
+	fd, err := syscall.Open(name, syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, &PathError{Op: "watch", Path: name, Err: err}
+	}
+	kq, err := syscall.Kqueue()
+	if err != nil {
+		syscall.Close(fd)
+		return nil, nil, &PathError{Op: "watch", Path: name, Err: err}
+	}
+	// Closing the write end of the pipe wakes up the watching goroutine.
+	var p [2]int
+	if err := syscall.Pipe(p[:]); err != nil {
+		syscall.Close(fd)
+		syscall.Close(kq)
+		return nil, nil, &PathError{Op: "watch", Path: name, Err: err}
+	}
+	changes := make([]syscall.Kevent_t, 2)
+	syscall.SetKevent(&changes[0], fd, syscall.EVFILT_VNODE, syscall.EV_ADD|syscall.EV_CLEAR)
+	changes[0].Fflags = kqueueNotes
+	syscall.SetKevent(&changes[1], p[0], syscall.EVFILT_READ, syscall.EV_ADD)
+	if _, err := syscall.Kevent(kq, changes, nil, nil); err != nil {
+		for _, fd := range []int{fd, kq, p[0], p[1]} {
+			syscall.Close(fd)
+		}
+		return nil, nil, &PathError{Op: "watch", Path: name, Err: err}
+	}
+
+	events := make(chan Event, c.Buffer)
+	done := make(chan struct{})
+	go func() {
+		defer close(events)
+		defer func() {
+			syscall.Close(fd)
+			syscall.Close(kq)
+			syscall.Close(p[0])
+		}()
+		buf := make([]syscall.Kevent_t, 16)
+		for {
+			n, err := syscall.Kevent(kq, nil, buf, nil)
+			if err == syscall.EINTR {
+				continue
+			}
+			if err != nil {
+				return
+			}
+			for _, kev := range buf[:n] {
+				if int(kev.Ident) == p[0] {
+					return
+				}
+				ev := Event{Name: name, Op: kqueueOp(uint32(kev.Fflags)) & c.Ops}
+				if ev.Op != 0 {
+					select {
+					case events <- ev:
+					case <-done:
+						return
+					}
+				}
+				if kev.Fflags&syscall.NOTE_DELETE != 0 {
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			close(done)
+			syscall.Close(p[1])
+		})
+	}, nil
+}
+
+func kqueueOp(fflags uint32) (op EventOp) {
+	if fflags&(syscall.NOTE_WRITE|syscall.NOTE_EXTEND) != 0 {
+		op |= EventWrite
+	}
+	if fflags&syscall.NOTE_DELETE != 0 {
+		op |= EventRemove
+	}
+	if fflags&syscall.NOTE_RENAME != 0 {
+		op |= EventRename
+	}
+	if fflags&syscall.NOTE_ATTRIB != 0 {
+		op |= EventChmod
+	}
+	return op
+}
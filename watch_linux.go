@@ -0,0 +1,98 @@
+package wrfs
+
+import (
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_MODIFY | syscall.IN_DELETE |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVED_FROM | syscall.IN_MOVE_SELF | syscall.IN_ATTRIB
+
+func (hostFS) Watch(name string, opts ...WatchOption) (<-chan Event, func(), error) {
+	c := NewWatchConfig(opts...)
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, nil, &PathError{Op: "watch", Path: name, Err: err}
+	}
+	// Wrapping the non-blocking descriptor in an *os.File registers it with the runtime poller,
+	// such that closing the file interrupts a pending read.
+	file := os.NewFile(uintptr(fd), "inotify")
+	if _, err := syscall.InotifyAddWatch(fd, name, inotifyMask); err != nil {
+		file.Close()
+		return nil, nil, &PathError{Op: "watch", Path: name, Err: err}
+	}
+
+	events := make(chan Event, c.Buffer)
+	done := make(chan struct{})
+	go func() {
+		defer close(events)
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := file.Read(buf)
+			if err != nil {
+				return
+			}
+			for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+				raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				nameBuf := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(raw.Len)]
+				off += syscall.SizeofInotifyEvent + int(raw.Len)
+				if raw.Mask&syscall.IN_IGNORED != 0 {
+					// The watch was removed, either because the file was deleted or its file system unmounted.
+					return
+				}
+				ev := Event{Name: name, Op: inotifyOp(raw.Mask) & c.Ops}
+				if ev.Op == 0 {
+					continue
+				}
+				if child := cString(nameBuf); child != "" {
+					ev.Name = path.Join(name, child)
+				}
+				select {
+				case events <- ev:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			close(done)
+			file.Close()
+		})
+	}, nil
+}
+
+func inotifyOp(mask uint32) (op EventOp) {
+	if mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		op |= EventCreate
+	}
+	if mask&syscall.IN_MODIFY != 0 {
+		op |= EventWrite
+	}
+	if mask&(syscall.IN_DELETE|syscall.IN_DELETE_SELF) != 0 {
+		op |= EventRemove
+	}
+	if mask&(syscall.IN_MOVED_FROM|syscall.IN_MOVE_SELF) != 0 {
+		op |= EventRename
+	}
+	if mask&syscall.IN_ATTRIB != 0 {
+		op |= EventChmod
+	}
+	return op
+}
+
+// cString returns the NUL-terminated string at the start of b.
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,8 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package wrfs
+
+func (hostFS) Watch(name string, opts ...WatchOption) (<-chan Event, func(), error) {
+	return nil, nil, &PathError{Op: "watch", Path: name, Err: ErrUnsupported}
+}
@@ -0,0 +1,38 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wrfs_test
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestWatch(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("only inotify reports the names of changed directory entries")
+	}
+	fsys := getFS(t)
+	fileName := "TestWatch"
+
+	events, stop, err := Watch(fsys, ".", WatchOps(EventCreate|EventRemove))
+	check(t, err)
+	newFile(t, fsys, fileName)
+	check(t, Remove(fsys, fileName))
+	for _, want := range []Event{{fileName, EventCreate}, {fileName, EventRemove}} {
+		select {
+		case got := <-events:
+			if got != want {
+				t.Errorf("got event %v, want %v", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for event %v", want)
+		}
+	}
+	stop()
+	for range events {
+	}
+}
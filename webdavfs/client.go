@@ -0,0 +1,549 @@
+package webdavfs
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// An Option configures a client file system returned by New.
+type Option func(*FS)
+
+// Client sets the HTTP client used to send requests, instead of http.DefaultClient.
+func Client(c *http.Client) Option {
+	return func(fsys *FS) { fsys.client = c }
+}
+
+// BasicAuth makes the file system authenticate its requests with the given user name and password.
+func BasicAuth(user, password string) Option {
+	return func(fsys *FS) { fsys.user, fsys.password = user, password }
+}
+
+// FS is a file system accessing a WebDAV server, such as Nextcloud or one served by Handler.
+type FS struct {
+	root           *url.URL
+	client         *http.Client
+	user, password string
+}
+
+// New returns a file system for the tree of files of the WebDAV server at the URL root, such as
+// "https://cloud.example.com/remote.php/dav/files/user/". Files and directories are statted and listed with
+// PROPFIND, read with GET, and created with PUT and MKCOL; they are removed with DELETE and renamed with MOVE.
+//
+// Files opened for writing are buffered in memory and uploaded with PUT when closed, as WebDAV provides no way of
+// modifying parts of files. Those opened for reading are downloaded as they are read, with ranged requests after
+// seeking. WebDAV servers do not report permission bits, so directories are reported with mode 0755, files with mode
+// 0644, and the permission bits passed to OpenFile and Mkdir are ignored.
+func New(root string, opts ...Option) (*FS, error) {
+	u, err := url.Parse(root)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("webdavfs: URL scheme must be http or https: " + root)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	fsys := &FS{root: u, client: http.DefaultClient}
+	for _, opt := range opts {
+		opt(fsys)
+	}
+	return fsys, nil
+}
+
+// url returns the URL of name.
+func (fsys *FS) url(name string) string {
+	u := *fsys.root
+	if name != "." {
+		u.Path += "/" + name
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+// do sends a request for name, returning the response if its status is one of the given ones, and otherwise an
+// error describing the status.
+func (fsys *FS) do(op, method, name string, header http.Header, body io.Reader, statuses ...int) (*http.Response, error) {
+	if !wrfs.ValidPath(name) {
+		return nil, &wrfs.PathError{Op: op, Path: name, Err: wrfs.ErrInvalid}
+	}
+	req, err := http.NewRequest(method, fsys.url(name), body)
+	if err != nil {
+		return nil, &wrfs.PathError{Op: op, Path: name, Err: err}
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if fsys.user != "" || fsys.password != "" {
+		req.SetBasicAuth(fsys.user, fsys.password)
+	}
+	resp, err := fsys.client.Do(req)
+	if err != nil {
+		return nil, &wrfs.PathError{Op: op, Path: name, Err: err}
+	}
+	for _, status := range statuses {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	resp.Body.Close()
+	return nil, &wrfs.PathError{Op: op, Path: name, Err: statusErr(resp)}
+}
+
+// statusErr returns an error for the unexpected status of resp.
+func statusErr(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusConflict:
+		return wrfs.ErrNotExist
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return wrfs.ErrPermission
+	case http.StatusMethodNotAllowed, http.StatusPreconditionFailed:
+		return wrfs.ErrExist
+	case http.StatusNotImplemented:
+		return wrfs.ErrUnsupported
+	}
+	return errors.New("webdavfs: unexpected status " + resp.Status)
+}
+
+// propfindBody requests the properties that make up a FileInfo.
+const propfindBody = xml.Header + `<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/><D:getcontentlength/>` +
+	`<D:getlastmodified/></D:prop></D:propfind>`
+
+// multistatus is the body of a response to PROPFIND.
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Prop struct {
+				Collection   *struct{} `xml:"DAV: resourcetype>collection"`
+				Length       string    `xml:"DAV: getcontentlength"`
+				LastModified string    `xml:"DAV: getlastmodified"`
+			} `xml:"DAV: prop"`
+			Status string `xml:"DAV: status"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// propfind returns the information on name and, with depth "1", its entries, by the names of the files.
+func (fsys *FS) propfind(op, name, depth string) (map[string]*fileInfo, error) {
+	header := http.Header{"Depth": {depth}, "Content-Type": {"application/xml; charset=utf-8"}}
+	resp, err := fsys.do(op, "PROPFIND", name, header, strings.NewReader(propfindBody), http.StatusMultiStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, &wrfs.PathError{Op: op, Path: name, Err: err}
+	}
+	infos := make(map[string]*fileInfo)
+	for _, r := range ms.Responses {
+		u, err := url.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		p := strings.TrimSuffix(u.Path, "/")
+		if p != fsys.root.Path && !strings.HasPrefix(p, fsys.root.Path+"/") {
+			continue
+		}
+		entry := "."
+		if p != fsys.root.Path {
+			entry = p[len(fsys.root.Path)+1:]
+		}
+		fi := &fileInfo{name: path.Base(entry)}
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			fi.dir = ps.Prop.Collection != nil
+			fi.size, _ = strconv.ParseInt(ps.Prop.Length, 10, 64)
+			fi.modTime, _ = http.ParseTime(ps.Prop.LastModified)
+		}
+		infos[entry] = fi
+	}
+	return infos, nil
+}
+
+func (fsys *FS) Stat(name string) (wrfs.FileInfo, error) {
+	infos, err := fsys.propfind("stat", name, "0")
+	if err != nil {
+		return nil, err
+	}
+	fi, ok := infos[name]
+	if !ok {
+		return nil, &wrfs.PathError{Op: "stat", Path: name, Err: wrfs.ErrNotExist}
+	}
+	return fi, nil
+}
+
+func (fsys *FS) ReadDir(name string) ([]wrfs.DirEntry, error) {
+	infos, err := fsys.propfind("readdir", name, "1")
+	if err != nil {
+		return nil, err
+	}
+	if fi, ok := infos[name]; !ok || !fi.dir {
+		return nil, &wrfs.PathError{Op: "readdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	var entries []wrfs.DirEntry
+	for entry, fi := range infos {
+		if entry != name && path.Dir(entry) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(fi))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (fsys *FS) Open(name string) (wrfs.File, error) {
+	fi, err := fsys.Stat(name)
+	if err != nil {
+		var pathErr *wrfs.PathError
+		if errors.As(err, &pathErr) {
+			pathErr.Op = "open"
+		}
+		return nil, err
+	}
+	if fi.IsDir() {
+		return &dir{fsys: fsys, name: name, info: fi}, nil
+	}
+	return &reader{fsys: fsys, name: name, info: fi.(*fileInfo)}, nil
+}
+
+// OpenFile opens the named file. Files opened for writing are created with an empty PUT if O_CREATE is given and
+// they do not exist, and downloaded unless O_TRUNC is given; their contents are uploaded when they are closed.
+func (fsys *FS) OpenFile(name string, flag int, perm wrfs.FileMode) (wrfs.File, error) {
+	write := flag&(wrfs.O_WRONLY|wrfs.O_RDWR) != 0
+	if !write && flag&wrfs.O_CREATE == 0 {
+		return fsys.Open(name)
+	}
+	fi, err := fsys.Stat(name)
+	switch {
+	case err == nil && flag&(wrfs.O_CREATE|wrfs.O_EXCL) == wrfs.O_CREATE|wrfs.O_EXCL:
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrExist}
+	case err == nil && fi.IsDir() && write:
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	case errors.Is(err, wrfs.ErrNotExist) && flag&wrfs.O_CREATE != 0:
+		if err := fsys.put("open", name, nil); err != nil {
+			return nil, err
+		}
+		fi, err = &fileInfo{name: path.Base(name), modTime: time.Now()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !write {
+		return fsys.Open(name)
+	}
+	w := &writer{fsys: fsys, name: name, info: *fi.(*fileInfo), append: flag&wrfs.O_APPEND != 0,
+		read: flag&wrfs.O_RDWR != 0}
+	if flag&wrfs.O_TRUNC == 0 && fi.Size() > 0 {
+		if w.data, err = wrfs.ReadFile(fsys, name); err != nil {
+			return nil, err
+		}
+	}
+	w.info.size = int64(len(w.data))
+	return w, nil
+}
+
+// put uploads data as the contents of name.
+func (fsys *FS) put(op, name string, data []byte) error {
+	resp, err := fsys.do(op, http.MethodPut, name, nil, bytes.NewReader(data),
+		http.StatusOK, http.StatusCreated, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (fsys *FS) Mkdir(name string, perm wrfs.FileMode) error {
+	resp, err := fsys.do("mkdir", "MKCOL", name, nil, nil, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (fsys *FS) Remove(name string) error {
+	entries, err := fsys.ReadDir(name)
+	if err == nil && len(entries) > 0 {
+		return &wrfs.PathError{Op: "remove", Path: name, Err: errno.ENOTEMPTY}
+	}
+	resp, err := fsys.do("remove", http.MethodDelete, name, nil, nil, http.StatusOK, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (fsys *FS) RemoveAll(name string) error {
+	resp, err := fsys.do("removeall", http.MethodDelete, name, nil, nil, http.StatusOK, http.StatusNoContent)
+	if errors.Is(err, wrfs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (fsys *FS) Rename(oldpath, newpath string) error {
+	if !wrfs.ValidPath(newpath) {
+		return &wrfs.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: wrfs.ErrInvalid}
+	}
+	header := http.Header{"Destination": {fsys.url(newpath)}, "Overwrite": {"T"}}
+	resp, err := fsys.do("rename", "MOVE", oldpath, header, nil, http.StatusCreated, http.StatusNoContent)
+	if err != nil {
+		var pathErr *wrfs.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		return &wrfs.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	return resp.Body.Close()
+}
+
+// fileInfo describes a file of a WebDAV server.
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.dir }
+func (fi *fileInfo) Sys() any           { return nil }
+
+func (fi *fileInfo) Mode() wrfs.FileMode {
+	if fi.dir {
+		return wrfs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// dir is an open directory of a WebDAV server, listed when first read.
+type dir struct {
+	fsys    *FS
+	name    string
+	info    wrfs.FileInfo
+	entries []wrfs.DirEntry
+	listed  bool
+}
+
+func (d *dir) Stat() (wrfs.FileInfo, error) { return d.info, nil }
+func (d *dir) Close() error                 { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &wrfs.PathError{Op: "read", Path: d.name, Err: syscall.EISDIR}
+}
+
+func (d *dir) ReadDir(n int) ([]wrfs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.listed = entries, true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// reader is a file of a WebDAV server opened for reading, which is downloaded as it is read.
+type reader struct {
+	fsys *FS
+	name string
+	info *fileInfo
+	off  int64
+	body io.ReadCloser // the contents from off, or nil if not requested yet
+}
+
+func (r *reader) Stat() (wrfs.FileInfo, error) { return r.info, nil }
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.body == nil {
+		if r.off >= r.info.size {
+			return 0, io.EOF
+		}
+		body, err := r.get(r.off, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.off += int64(n)
+	return n, err
+}
+
+// get requests the contents of the file from off, up to end if not negative.
+func (r *reader) get(off, end int64) (io.ReadCloser, error) {
+	var header http.Header
+	if off > 0 || end >= 0 {
+		rng := "bytes=" + strconv.FormatInt(off, 10) + "-"
+		if end >= 0 {
+			rng += strconv.FormatInt(end, 10)
+		}
+		header = http.Header{"Range": {rng}}
+	}
+	resp, err := r.fsys.do("read", http.MethodGet, r.name, header, nil, http.StatusOK, http.StatusPartialContent)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK && off > 0 {
+		// The server ignored the range.
+		if _, err := io.CopyN(io.Discard, resp.Body, off); err != nil {
+			resp.Body.Close()
+			return nil, &wrfs.PathError{Op: "read", Path: r.name, Err: err}
+		}
+	}
+	return resp.Body, nil
+}
+
+func (r *reader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.info.size {
+		return 0, io.EOF
+	}
+	body, err := r.get(off, off+int64(len(p))-1)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	n, err := io.ReadFull(body, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r *reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.info.size
+	}
+	if offset < 0 {
+		return 0, &wrfs.PathError{Op: "seek", Path: r.name, Err: wrfs.ErrInvalid}
+	}
+	if offset != r.off && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.off = offset
+	return offset, nil
+}
+
+func (r *reader) Close() error {
+	if r.body != nil {
+		return r.body.Close()
+	}
+	return nil
+}
+
+// writer is a file of a WebDAV server opened for writing, whose contents are uploaded when it is closed.
+type writer struct {
+	fsys   *FS
+	name   string
+	info   fileInfo
+	data   []byte
+	off    int64
+	append bool
+	read   bool
+	closed bool
+}
+
+func (w *writer) Stat() (wrfs.FileInfo, error) {
+	fi := w.info
+	fi.size = int64(len(w.data))
+	return &fi, nil
+}
+
+func (w *writer) Read(p []byte) (int, error) {
+	if !w.read {
+		return 0, &wrfs.PathError{Op: "read", Path: w.name, Err: wrfs.ErrPermission}
+	}
+	if w.off >= int64(len(w.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, w.data[w.off:])
+	w.off += int64(n)
+	return n, nil
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, &wrfs.PathError{Op: "write", Path: w.name, Err: wrfs.ErrClosed}
+	}
+	if w.append {
+		w.off = int64(len(w.data))
+	}
+	if end := w.off + int64(len(p)); end > int64(len(w.data)) {
+		w.data = append(w.data, make([]byte, end-int64(len(w.data)))...)
+	}
+	n := copy(w.data[w.off:], p)
+	w.off += int64(n)
+	return n, nil
+}
+
+func (w *writer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += w.off
+	case io.SeekEnd:
+		offset += int64(len(w.data))
+	}
+	if offset < 0 {
+		return 0, &wrfs.PathError{Op: "seek", Path: w.name, Err: wrfs.ErrInvalid}
+	}
+	w.off = offset
+	return offset, nil
+}
+
+func (w *writer) Truncate(size int64) error {
+	if size < 0 {
+		return &wrfs.PathError{Op: "truncate", Path: w.name, Err: wrfs.ErrInvalid}
+	}
+	if size <= int64(len(w.data)) {
+		w.data = w.data[:size]
+	} else {
+		w.data = append(w.data, make([]byte, size-int64(len(w.data)))...)
+	}
+	return nil
+}
+
+// Close uploads the contents of the file.
+func (w *writer) Close() error {
+	if w.closed {
+		return &wrfs.PathError{Op: "close", Path: w.name, Err: wrfs.ErrClosed}
+	}
+	w.closed = true
+	return w.fsys.put("close", w.name, w.data)
+}
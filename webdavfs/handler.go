@@ -0,0 +1,475 @@
+// Package webdavfs serves wrfs file systems over WebDAV, and accesses WebDAV servers as wrfs file systems.
+package webdavfs
+
+import (
+	"encoding/xml"
+	"errors"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/relab/wrfs"
+)
+
+// Handler returns a handler serving fsys over WebDAV, as a class 1 server as defined by RFC 4918: it supports the
+// methods OPTIONS, GET, HEAD, PUT, DELETE, MKCOL, COPY, MOVE, PROPFIND and PROPPATCH, but not locking. Files are
+// read with Open and written with OpenFile, so that modifications require fsys to support them, and directories are
+// served as collections. GET requests for directories return a simple HTML listing.
+//
+// PROPFIND reports the live properties resourcetype, displayname, getcontentlength, getcontenttype, getetag and
+// getlastmodified. Dead properties cannot be stored, so PROPPATCH fails for every property.
+//
+// The paths of requests are those of fsys, with "/" referring to its root. The handler can be mounted under a prefix
+// with http.StripPrefix, which it takes into account in the URLs it reports and in the destinations of COPY and MOVE.
+// Clients can access any file fsys lets them, so fsys should be wrapped, such as with wrfs.ReadOnly, and the handler
+// with authentication, to restrict what they can do.
+func Handler(fsys wrfs.FS) http.Handler {
+	return &handler{fsys}
+}
+
+type handler struct {
+	fsys wrfs.FS
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := fsName(r.URL.Path)
+	var status int
+	var err error
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("DAV", "1")
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, MKCOL, COPY, MOVE, PROPFIND, PROPPATCH")
+		status = http.StatusOK
+	case http.MethodGet, http.MethodHead:
+		status, err = h.get(w, r, name)
+	case http.MethodPut:
+		status, err = h.put(r, name)
+	case http.MethodDelete:
+		status, err = h.delete(name)
+	case "MKCOL":
+		status, err = h.mkcol(r, name)
+	case "COPY", "MOVE":
+		status, err = h.copyMove(r, name)
+	case "PROPFIND":
+		status, err = h.propfind(w, r, name)
+	case "PROPPATCH":
+		status, err = h.proppatch(w, r, name)
+	default:
+		status = http.StatusMethodNotAllowed
+	}
+	if err != nil {
+		status = errStatus(err)
+	}
+	if status != 0 {
+		w.WriteHeader(status)
+	}
+}
+
+// errStatus returns the HTTP status reporting err.
+func errStatus(err error) int {
+	switch {
+	case errors.Is(err, wrfs.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, wrfs.ErrPermission):
+		return http.StatusForbidden
+	case errors.Is(err, wrfs.ErrExist):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, wrfs.ErrUnsupported):
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
+
+// fsName returns the name in the file system of the given URL path.
+func fsName(p string) string {
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return "."
+	}
+	return p[1:]
+}
+
+// prefix returns the prefix stripped from the path of r before it reached the handler, such as by http.StripPrefix.
+func prefix(r *http.Request) string {
+	u, err := url.ParseRequestURI(r.RequestURI)
+	if err != nil || !strings.HasSuffix(u.Path, r.URL.Path) {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, r.URL.Path)
+}
+
+// href returns the escaped URL path of name, with a trailing slash for directories.
+func href(prefix, name string, dir bool) string {
+	p := prefix + "/"
+	if name != "." {
+		p += name
+		if dir {
+			p += "/"
+		}
+	}
+	return (&url.URL{Path: p}).EscapedPath()
+}
+
+// parentExists reports whether the parent directory of name exists, returning a conflict status otherwise.
+func (h *handler) parentExists(name string) (int, error) {
+	fi, err := wrfs.Stat(h.fsys, path.Dir(name))
+	if errors.Is(err, wrfs.ErrNotExist) || err == nil && !fi.IsDir() {
+		return http.StatusConflict, nil
+	}
+	return 0, err
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request, name string) (int, error) {
+	file, err := h.fsys.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if fi.IsDir() {
+		entries, err := wrfs.ReadDir(h.fsys, name)
+		if err != nil {
+			return 0, err
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if r.Method == http.MethodHead {
+			return http.StatusOK, nil
+		}
+		io.WriteString(w, "<!doctype html>\n<pre>\n")
+		for _, e := range entries {
+			link := href(prefix(r), path.Join(name, e.Name()), e.IsDir())
+			text := e.Name()
+			if e.IsDir() {
+				text += "/"
+			}
+			io.WriteString(w, `<a href="`+html.EscapeString(link)+`">`+html.EscapeString(text)+"</a>\n")
+		}
+		io.WriteString(w, "</pre>\n")
+		return 0, nil
+	}
+	w.Header().Set("ETag", etag(fi))
+	if rs, ok := file.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, fi.Name(), fi.ModTime(), rs)
+		return 0, nil
+	}
+	// Files that cannot seek are served whole, without support for ranges.
+	w.Header().Set("Content-Type", contentType(fi.Name()))
+	w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+	w.Header().Set("Last-Modified", fi.ModTime().UTC().Format(http.TimeFormat))
+	if r.Method == http.MethodHead {
+		return http.StatusOK, nil
+	}
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, file)
+	return 0, nil
+}
+
+func (h *handler) put(r *http.Request, name string) (int, error) {
+	if name == "." {
+		return http.StatusMethodNotAllowed, nil
+	}
+	if status, err := h.parentExists(name); status != 0 || err != nil {
+		return status, err
+	}
+	fi, err := wrfs.Stat(h.fsys, name)
+	if err == nil && fi.IsDir() {
+		return http.StatusMethodNotAllowed, nil
+	}
+	status := http.StatusNoContent
+	if err != nil {
+		status = http.StatusCreated
+	}
+	file, err := wrfs.OpenFile(h.fsys, name, wrfs.O_WRONLY|wrfs.O_CREATE|wrfs.O_TRUNC, 0666)
+	if err != nil {
+		return 0, err
+	}
+	w, ok := file.(io.Writer)
+	if !ok {
+		file.Close()
+		return 0, &wrfs.PathError{Op: "write", Path: name, Err: wrfs.ErrUnsupported}
+	}
+	_, err = io.Copy(w, r.Body)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return status, err
+}
+
+func (h *handler) delete(name string) (int, error) {
+	if name == "." {
+		return http.StatusForbidden, nil
+	}
+	if _, err := wrfs.Lstat(h.fsys, name); err != nil {
+		return 0, err
+	}
+	return http.StatusNoContent, wrfs.RemoveAll(h.fsys, name)
+}
+
+func (h *handler) mkcol(r *http.Request, name string) (int, error) {
+	if r.ContentLength > 0 {
+		return http.StatusUnsupportedMediaType, nil
+	}
+	if _, err := wrfs.Lstat(h.fsys, name); err == nil {
+		return http.StatusMethodNotAllowed, nil
+	}
+	if status, err := h.parentExists(name); status != 0 || err != nil {
+		return status, err
+	}
+	return http.StatusCreated, wrfs.Mkdir(h.fsys, name, 0777)
+}
+
+// copyMove handles COPY and MOVE requests.
+func (h *handler) copyMove(r *http.Request, name string) (int, error) {
+	u, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil || u.Path == "" || u.Host != "" && u.Host != r.Host {
+		return http.StatusBadGateway, nil
+	}
+	dest := u.Path
+	if p := prefix(r); p != "" {
+		if !strings.HasPrefix(dest, p+"/") && dest != p {
+			return http.StatusBadGateway, nil
+		}
+		dest = dest[len(p):]
+	}
+	destName := fsName(dest)
+	if name == "." || destName == "." || destName == name || strings.HasPrefix(destName, name+"/") {
+		return http.StatusForbidden, nil
+	}
+	fi, err := wrfs.Lstat(h.fsys, name)
+	if err != nil {
+		return 0, err
+	}
+	if status, err := h.parentExists(destName); status != 0 || err != nil {
+		return status, err
+	}
+	status := http.StatusCreated
+	if _, err := wrfs.Lstat(h.fsys, destName); err == nil {
+		if r.Header.Get("Overwrite") == "F" {
+			return http.StatusPreconditionFailed, nil
+		}
+		if err := wrfs.RemoveAll(h.fsys, destName); err != nil {
+			return 0, err
+		}
+		status = http.StatusNoContent
+	}
+	if r.Method == "MOVE" {
+		return status, wrfs.Rename(h.fsys, name, destName)
+	}
+	switch {
+	case fi.IsDir():
+		if err := wrfs.Mkdir(h.fsys, destName, fi.Mode().Perm()); err != nil {
+			return 0, err
+		}
+		if r.Header.Get("Depth") == "0" {
+			return status, nil
+		}
+		dst, err := wrfs.Sub(h.fsys, destName)
+		if err != nil {
+			return 0, err
+		}
+		return status, wrfs.CopyFS(dst, h.fsys, name, wrfs.CopySymlinks(), wrfs.CopyTimes())
+	case fi.Mode()&wrfs.ModeSymlink != 0:
+		target, err := wrfs.Readlink(h.fsys, name)
+		if err != nil {
+			return 0, err
+		}
+		return status, wrfs.Symlink(h.fsys, target, destName)
+	}
+	return status, wrfs.CopyFile(h.fsys, destName, h.fsys, name)
+}
+
+// propfindRequest is the body of a PROPFIND request.
+type propfindRequest struct {
+	Prop     *propNames `xml:"DAV: prop"`
+	PropName *struct{}  `xml:"DAV: propname"`
+}
+
+// propNames are the names of the properties in a prop element.
+type propNames struct {
+	Names []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+// liveProps are the names of the properties reported by PROPFIND.
+var liveProps = []string{"resourcetype", "displayname", "getcontentlength", "getcontenttype", "getetag",
+	"getlastmodified"}
+
+func (h *handler) propfind(w http.ResponseWriter, r *http.Request, name string) (int, error) {
+	var req propfindRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		return http.StatusBadRequest, nil
+	}
+	if _, err := wrfs.Stat(h.fsys, name); err != nil {
+		return 0, err
+	}
+	var responses strings.Builder
+	respond := func(name string, fi wrfs.FileInfo) {
+		responses.WriteString("<D:response><D:href>")
+		xml.EscapeText(&responses, []byte(href(prefix(r), name, fi.IsDir())))
+		responses.WriteString("</D:href>")
+		var found, missing strings.Builder
+		switch {
+		case req.PropName != nil:
+			for _, prop := range liveProps {
+				if prop != "getcontentlength" || !fi.IsDir() {
+					found.WriteString("<D:" + prop + "/>")
+				}
+			}
+		case req.Prop != nil:
+			for _, n := range req.Prop.Names {
+				if value, ok := liveProp(n.XMLName, fi); ok {
+					found.WriteString(value)
+				} else {
+					missing.WriteString(emptyElement(n.XMLName))
+				}
+			}
+		default:
+			for _, prop := range liveProps {
+				if value, ok := liveProp(xml.Name{Space: "DAV:", Local: prop}, fi); ok {
+					found.WriteString(value)
+				}
+			}
+		}
+		writePropstat(&responses, found.String(), "200 OK")
+		writePropstat(&responses, missing.String(), "404 Not Found")
+		responses.WriteString("</D:response>")
+	}
+	depth := r.Header.Get("Depth")
+	err := wrfs.WalkDir(h.fsys, name, func(p string, d wrfs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		fi, err := wrfs.Stat(h.fsys, p)
+		if err != nil {
+			return nil // a dangling symbolic link
+		}
+		respond(p, fi)
+		if d.IsDir() && p != name && depth == "1" || depth == "0" {
+			return wrfs.SkipDir
+		}
+		return nil
+	})
+	if err != nil && err != wrfs.SkipDir {
+		return 0, err
+	}
+	writeMultistatus(w, responses.String())
+	return 0, nil
+}
+
+// writePropstat writes a propstat element for the given properties and status, if there are any properties.
+func writePropstat(w io.StringWriter, props, status string) {
+	if props != "" {
+		w.WriteString("<D:propstat><D:prop>" + props + "</D:prop><D:status>HTTP/1.1 " + status +
+			"</D:status></D:propstat>")
+	}
+}
+
+// writeMultistatus writes a multistatus response holding the given responses.
+func writeMultistatus(w http.ResponseWriter, responses string) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, xml.Header+`<D:multistatus xmlns:D="DAV:">`+responses+"</D:multistatus>\n")
+}
+
+// emptyElement returns an empty element of the given name.
+func emptyElement(n xml.Name) string {
+	if n.Space == "DAV:" {
+		return "<D:" + n.Local + "/>"
+	}
+	var ns strings.Builder
+	xml.EscapeText(&ns, []byte(n.Space))
+	return "<" + n.Local + ` xmlns="` + ns.String() + `"/>`
+}
+
+// liveProp returns the element of the named live property of a file described by fi, if it has it.
+func liveProp(n xml.Name, fi wrfs.FileInfo) (string, bool) {
+	if n.Space != "DAV:" {
+		return "", false
+	}
+	var value string
+	switch n.Local {
+	case "resourcetype":
+		if fi.IsDir() {
+			value = "<D:collection/>"
+		}
+	case "displayname":
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(fi.Name()))
+		value = b.String()
+	case "getcontentlength":
+		if fi.IsDir() {
+			return "", false
+		}
+		value = strconv.FormatInt(fi.Size(), 10)
+	case "getcontenttype":
+		if fi.IsDir() {
+			return "", false
+		}
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(contentType(fi.Name())))
+		value = b.String()
+	case "getetag":
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(etag(fi)))
+		value = b.String()
+	case "getlastmodified":
+		value = fi.ModTime().UTC().Format(http.TimeFormat)
+	default:
+		return "", false
+	}
+	return "<D:" + n.Local + ">" + value + "</D:" + n.Local + ">", true
+}
+
+// contentType returns the content type of a file by its extension.
+func contentType(name string) string {
+	if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// etag returns an entity tag of a file from its modification time and size.
+func etag(fi wrfs.FileInfo) string {
+	return `"` + strconv.FormatInt(fi.ModTime().UnixNano(), 16) + "-" + strconv.FormatInt(fi.Size(), 16) + `"`
+}
+
+// proppatchRequest is the body of a PROPPATCH request.
+type proppatchRequest struct {
+	Updates []struct {
+		Prop propNames `xml:"DAV: prop"`
+	} `xml:",any"`
+}
+
+func (h *handler) proppatch(w http.ResponseWriter, r *http.Request, name string) (int, error) {
+	var req proppatchRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		return http.StatusBadRequest, nil
+	}
+	fi, err := wrfs.Stat(h.fsys, name)
+	if err != nil {
+		return 0, err
+	}
+	var props strings.Builder
+	for _, update := range req.Updates {
+		for _, n := range update.Prop.Names {
+			props.WriteString(emptyElement(n.XMLName))
+		}
+	}
+	var response strings.Builder
+	response.WriteString("<D:response><D:href>")
+	xml.EscapeText(&response, []byte(href(prefix(r), name, fi.IsDir())))
+	response.WriteString("</D:href>")
+	writePropstat(&response, props.String(), "403 Forbidden")
+	response.WriteString("</D:response>")
+	writeMultistatus(w, response.String())
+	return 0, nil
+}
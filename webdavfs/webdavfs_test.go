@@ -0,0 +1,178 @@
+package webdavfs_test
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+	"github.com/relab/wrfs/webdavfs"
+	"github.com/relab/wrfs/wrfstest"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkContents(t *testing.T, fsys wrfs.FS, name, want string) {
+	t.Helper()
+	data, err := wrfs.ReadFile(fsys, name)
+	check(t, err)
+	if string(data) != want {
+		t.Errorf("%s contains %q, want %q", name, data, want)
+	}
+}
+
+// do sends a request to the server and returns the response with its body read.
+func do(t *testing.T, method, url, body string, header ...string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	check(t, err)
+	for i := 0; i < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	check(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	check(t, err)
+	return resp, string(data)
+}
+
+func TestHandler(t *testing.T) {
+	fsys := memfs.New()
+	srv := httptest.NewServer(http.StripPrefix("/dav", webdavfs.Handler(fsys)))
+	defer srv.Close()
+	url := srv.URL + "/dav"
+
+	for _, req := range []struct {
+		method, path, body string
+		header             []string
+		status             int
+	}{
+		{"MKCOL", "/dir", "", nil, http.StatusCreated},
+		{"MKCOL", "/dir", "", nil, http.StatusMethodNotAllowed},
+		{"MKCOL", "/missing/dir", "", nil, http.StatusConflict},
+		{"PUT", "/dir/file.txt", "hello", nil, http.StatusCreated},
+		{"PUT", "/dir/file.txt", "hello, world", nil, http.StatusNoContent},
+		{"PUT", "/missing/file", "", nil, http.StatusConflict},
+		{"COPY", "/dir", "", []string{"Destination", url + "/copy"}, http.StatusCreated},
+		{"MOVE", "/copy/file.txt", "", []string{"Destination", "/dav/moved.txt"}, http.StatusCreated},
+		{"COPY", "/dir/file.txt", "", []string{"Destination", "/dav/moved.txt", "Overwrite", "F"},
+			http.StatusPreconditionFailed},
+		{"MOVE", "/dir", "", []string{"Destination", "/dav/dir/sub"}, http.StatusForbidden},
+		{"MOVE", "/dir", "", []string{"Destination", "/elsewhere/dir"}, http.StatusBadGateway},
+		{"DELETE", "/copy", "", nil, http.StatusNoContent},
+		{"DELETE", "/copy", "", nil, http.StatusNotFound},
+		{"LOCK", "/dir", "", nil, http.StatusMethodNotAllowed},
+	} {
+		if resp, _ := do(t, req.method, url+req.path, req.body, req.header...); resp.StatusCode != req.status {
+			t.Errorf("%s %s: got status %d, want %d", req.method, req.path, resp.StatusCode, req.status)
+		}
+	}
+	checkContents(t, fsys, "dir/file.txt", "hello, world")
+	checkContents(t, fsys, "moved.txt", "hello, world")
+	if _, err := wrfs.Stat(fsys, "copy"); err == nil {
+		t.Error("DELETE did not remove copy")
+	}
+
+	resp, body := do(t, http.MethodGet, url+"/dir/file.txt", "", "Range", "bytes=7-")
+	if resp.StatusCode != http.StatusPartialContent || body != "world" {
+		t.Errorf("GET with range: got status %d and %q", resp.StatusCode, body)
+	}
+	if resp, _ := do(t, http.MethodOptions, url+"/", ""); resp.Header.Get("DAV") != "1" {
+		t.Errorf("OPTIONS: got DAV header %q", resp.Header.Get("DAV"))
+	}
+
+	resp, body = do(t, "PROPFIND", url+"/", `<?xml version="1.0"?>
+<propfind xmlns="DAV:"><prop><resourcetype/><getcontentlength/><x:unknown xmlns:x="urn:x"/></prop></propfind>`,
+		"Depth", "1")
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND: got status %d", resp.StatusCode)
+	}
+	var ms struct {
+		Responses []struct {
+			Href     string `xml:"href"`
+			Propstat []struct {
+				Prop struct {
+					Collection *struct{} `xml:"resourcetype>collection"`
+					Length     string    `xml:"getcontentlength"`
+					Unknown    *struct{} `xml:"urn:x unknown"`
+				} `xml:"prop"`
+				Status string `xml:"status"`
+			} `xml:"propstat"`
+		} `xml:"response"`
+	}
+	check(t, xml.Unmarshal([]byte(body), &ms))
+	var got []string
+	for _, r := range ms.Responses {
+		desc := r.Href
+		for _, ps := range r.Propstat {
+			switch {
+			case strings.Contains(ps.Status, "200") && ps.Prop.Collection != nil:
+				desc += " collection"
+			case strings.Contains(ps.Status, "200"):
+				desc += " " + ps.Prop.Length
+			case strings.Contains(ps.Status, "404") && ps.Prop.Unknown != nil:
+				desc += " unknown-missing"
+			}
+		}
+		got = append(got, desc)
+	}
+	sort.Strings(got)
+	want := []string{"/dav/ collection unknown-missing", "/dav/dir/ collection unknown-missing",
+		"/dav/moved.txt 12 unknown-missing"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("PROPFIND returned %q, want %q", got, want)
+	}
+
+	resp, body = do(t, "PROPPATCH", url+"/moved.txt", `<?xml version="1.0"?>
+<propertyupdate xmlns="DAV:"><set><prop><x:color xmlns:x="urn:x">red</x:color></prop></set></propertyupdate>`)
+	if resp.StatusCode != http.StatusMultiStatus || !strings.Contains(body, "403 Forbidden") {
+		t.Errorf("PROPPATCH: got status %d and %s", resp.StatusCode, body)
+	}
+}
+
+func TestClient(t *testing.T) {
+	fsys := memfs.New()
+	check(t, wrfs.MkdirAll(fsys, "dir/sub", 0755))
+	check(t, wrfs.Mkdir(fsys, "dir with space", 0755))
+	check(t, wrfs.WriteFile(fsys, "dir/file", []byte("hello, world"), 0644))
+	check(t, wrfs.WriteFile(fsys, "dir with space/ümlaut", []byte("x"), 0644))
+	srv := httptest.NewServer(http.StripPrefix("/dav", webdavfs.Handler(fsys)))
+	defer srv.Close()
+	client, err := webdavfs.New(srv.URL + "/dav/")
+	check(t, err)
+
+	check(t, fstest.TestFS(client, "dir/file", "dir/sub", "dir with space/ümlaut"))
+	if err := wrfstest.TestWriteFS(client, wrfstest.SkipChmod(), wrfstest.SkipChown(), wrfstest.SkipChtimes(),
+		wrfstest.SkipLinks()); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := wrfs.OpenFile(client, "dir/file", wrfs.O_WRONLY|wrfs.O_APPEND, 0)
+	check(t, err)
+	_, err = wrfs.Write(file, []byte("!"))
+	check(t, err)
+	check(t, file.Close())
+	checkContents(t, fsys, "dir/file", "hello, world!")
+	check(t, wrfs.Rename(client, "dir/file", "dir/sub/moved"))
+	checkContents(t, fsys, "dir/sub/moved", "hello, world!")
+	if err := wrfs.Remove(client, "dir/sub"); err == nil {
+		t.Error("Remove of a non-empty directory succeeded")
+	}
+	check(t, wrfs.RemoveAll(client, "dir"))
+	if _, err := wrfs.Stat(fsys, "dir"); !errors.Is(err, wrfs.ErrNotExist) {
+		t.Errorf("RemoveAll did not remove dir: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package wrfs
+
+import "time"
+
+// fsWrapper forwards every extension interface to the wrapped file system using the package helpers.
+// Wrappers embed it and override the methods they need to change. Note that fsWrapper forwards
+// MkdirAll, RemoveAll, ReadDir, Glob and Stat directly, so a wrapper that changes the behavior of
+// Mkdir, Remove or Open must also override these if the inner fast paths would bypass it.
+// ReadFile, WriteFile, MkdirTemp and CreateTemp are deliberately not forwarded, so that they always go
+// through Open, OpenFile and Mkdir.
+type fsWrapper struct {
+	fsys FS
+}
+
+func (w fsWrapper) Open(name string) (File, error) {
+	return w.fsys.Open(name)
+}
+
+func (w fsWrapper) Stat(name string) (FileInfo, error) {
+	return Stat(w.fsys, name)
+}
+
+func (w fsWrapper) Lstat(name string) (FileInfo, error) {
+	return Lstat(w.fsys, name)
+}
+
+func (w fsWrapper) ReadDir(name string) ([]DirEntry, error) {
+	return ReadDir(w.fsys, name)
+}
+
+func (w fsWrapper) Glob(pattern string) ([]string, error) {
+	return Glob(w.fsys, pattern)
+}
+
+func (w fsWrapper) OpenFile(name string, flag int, perm FileMode) (File, error) {
+	return OpenFile(w.fsys, name, flag, perm)
+}
+
+func (w fsWrapper) Chmod(name string, mode FileMode) error {
+	return Chmod(w.fsys, name, mode)
+}
+
+func (w fsWrapper) Chown(name string, uid, gid int) error {
+	return Chown(w.fsys, name, uid, gid)
+}
+
+func (w fsWrapper) Lchown(name string, uid, gid int) error {
+	return Lchown(w.fsys, name, uid, gid)
+}
+
+func (w fsWrapper) Chtimes(name string, atime, mtime time.Time) error {
+	return Chtimes(w.fsys, name, atime, mtime)
+}
+
+func (w fsWrapper) Mkdir(name string, perm FileMode) error {
+	return Mkdir(w.fsys, name, perm)
+}
+
+func (w fsWrapper) MkdirAll(path string, perm FileMode) error {
+	return MkdirAll(w.fsys, path, perm)
+}
+
+func (w fsWrapper) Readlink(name string) (string, error) {
+	return Readlink(w.fsys, name)
+}
+
+func (w fsWrapper) Remove(name string) error {
+	return Remove(w.fsys, name)
+}
+
+func (w fsWrapper) RemoveAll(path string) error {
+	return RemoveAll(w.fsys, path)
+}
+
+func (w fsWrapper) Rename(oldpath, newpath string) error {
+	return Rename(w.fsys, oldpath, newpath)
+}
+
+func (w fsWrapper) SameFile(fi1, fi2 FileInfo) bool {
+	return SameFile(w.fsys, fi1, fi2)
+}
+
+func (w fsWrapper) Symlink(oldname, newname string) error {
+	return Symlink(w.fsys, oldname, newname)
+}
+
+func (w fsWrapper) Link(oldname, newname string) error {
+	return Link(w.fsys, oldname, newname)
+}
+
+func (w fsWrapper) Sync(name string) error {
+	return Sync(w.fsys, name)
+}
+
+func (w fsWrapper) SyncDir(dir string) error {
+	return SyncDir(w.fsys, dir)
+}
+
+func (w fsWrapper) Statfs(name string) (FSInfo, error) {
+	return Statfs(w.fsys, name)
+}
+
+func (w fsWrapper) OpenLock(name string) (LockFile, error) {
+	return OpenLock(w.fsys, name)
+}
+
+func (w fsWrapper) Watch(name string, opts ...WatchOption) (<-chan Event, func(), error) {
+	return Watch(w.fsys, name, opts...)
+}
+
+// Capabilities reports the capabilities of the wrapped file system, except for Mkfifo, Mknod and Lchtimes, which
+// are not forwarded, so that wrappers do not modify files without going through them.
+func (w fsWrapper) Capabilities() CapSet {
+	return Capabilities(w.fsys) &^ (CapMkfifo | CapMknod | CapLchtimes)
+}
+
+func (w fsWrapper) Truncate(name string, size int64) error {
+	return Truncate(w.fsys, name, size)
+}
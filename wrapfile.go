@@ -0,0 +1,64 @@
+package wrfs
+
+import (
+	"io"
+	"os"
+)
+
+// FileWrapper forwards the optional interfaces that io.Copy, io.SectionReader and similar functions
+// take fast paths with to the wrapped File: io.ReaderAt, io.WriterTo and io.ReaderFrom, along with io.Writer
+// and io.Seeker, which ReadAt and WriteAt fall back to. It also implements SysFile, so that OSFile finds the
+// file of the operating system below it. Wrappers of open files embed it instead of File, and override the
+// methods they need to change, so that wrapping a file of the host file system keeps, for example, the
+// copy_file_range(2) path of io.Copy.
+//
+// The forwarded methods go directly to the wrapped File, so a wrapper that changes or observes Read must
+// also override ReadAt and WriteTo, and one that changes or observes Write must also override ReadFrom.
+// A wrapper that must not be bypassed at all must override SysFile to return nil.
+// When the wrapped File does not implement them, ReadAt, Write and Seek fail with ErrUnsupported, and WriteTo
+// and ReadFrom copy through Read and Write.
+type FileWrapper struct {
+	File
+}
+
+func (f FileWrapper) ReadAt(p []byte, off int64) (int, error) {
+	if r, ok := f.File.(io.ReaderAt); ok {
+		return r.ReadAt(p, off)
+	}
+	return 0, fileErr("readat", f.File, ErrUnsupported)
+}
+
+func (f FileWrapper) Write(p []byte) (int, error) {
+	return Write(f.File, p)
+}
+
+func (f FileWrapper) Seek(offset int64, whence int) (int64, error) {
+	return Seek(f.File, offset, whence)
+}
+
+func (f FileWrapper) WriteTo(w io.Writer) (int64, error) {
+	if wt, ok := f.File.(io.WriterTo); ok {
+		return wt.WriteTo(w)
+	}
+	// Hide WriteTo from io.Copy, which would otherwise call it again.
+	return io.Copy(w, struct{ io.Reader }{f.File})
+}
+
+func (f FileWrapper) ReadFrom(r io.Reader) (int64, error) {
+	if rf, ok := f.File.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	return io.Copy(fileWriter{f.File}, r)
+}
+
+func (f FileWrapper) SysFile() *os.File {
+	file, _ := OSFile(f.File)
+	return file
+}
+
+// fileWriter is an io.Writer that writes to a file with Write.
+type fileWriter struct {
+	file File
+}
+
+func (w fileWriter) Write(p []byte) (int, error) { return Write(w.file, p) }
@@ -0,0 +1,44 @@
+package wrfs_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	. "github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+)
+
+func TestFileWrapper(t *testing.T) {
+	fsys := memfs.New()
+	check(t, WriteFile(fsys, "file", []byte("hello, world"), 0644))
+	file, err := Rewrite(fsys, RewriteRule{From: "current", To: "file"}).Open("current")
+	check(t, err)
+	defer file.Close()
+	r, ok := file.(io.ReaderAt)
+	if !ok {
+		t.Fatal("a renamed file of Rewrite does not implement io.ReaderAt")
+	}
+	p := make([]byte, 5)
+	if n, err := r.ReadAt(p, 7); err != nil || string(p[:n]) != "world" {
+		t.Errorf("ReadAt: got %q, %v, want %q", p[:n], err, "world")
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, file); err != nil || buf.String() != "hello, world" {
+		t.Errorf("io.Copy: got %q, %v", buf.String(), err)
+	}
+
+	out, err := OpenFile(fsys, "out", O_WRONLY|O_CREATE, 0644)
+	check(t, err)
+	w := FileWrapper{struct{ WriterFile }{out.(WriterFile)}}
+	if _, err := w.ReadFrom(strings.NewReader("copied")); err != nil {
+		t.Errorf("ReadFrom: %v", err)
+	}
+	if _, err := w.ReadAt(p, 0); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("ReadAt of a file without it: got %v, want ErrUnsupported", err)
+	}
+	check(t, out.Close())
+	checkContents(t, fsys, "out", "copied")
+}
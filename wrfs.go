@@ -6,11 +6,29 @@ package wrfs
 import (
 	"errors"
 	"io"
+	"os"
 )
 
-// TODO: replace this with errors.ErrUnsupported: https://github.com/golang/go/issues/41198
+// ErrUnsupported is returned, wrapped in a *PathError or *LinkError, when a file system or file does not
+// support an operation. It is errors.ErrUnsupported, so system errors such as ENOTSUP also match it.
+var ErrUnsupported = errors.ErrUnsupported
 
-var ErrUnsupported = errors.New("unsupported operation")
+// LinkError records an error during a link, symlink or rename system call and the paths that caused it.
+type LinkError = os.LinkError
+
+// IsNotSupported reports whether err indicates that an operation is not supported by a file system or file.
+func IsNotSupported(err error) bool {
+	return errors.Is(err, ErrUnsupported)
+}
+
+// fileErr returns a *PathError for an operation on file, naming the file by the name reported by its Stat method.
+func fileErr(op string, file File, err error) error {
+	var name string
+	if fi, serr := file.Stat(); serr == nil {
+		name = fi.Name()
+	}
+	return &PathError{Op: op, Path: name, Err: err}
+}
 
 // safeClose closes an io.Closer and stores the error in errPtr
 func safeClose(closer io.Closer, errPtr *error) {
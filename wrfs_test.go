@@ -4,8 +4,11 @@
 package wrfs_test
 
 import (
+	"errors"
 	"os"
+	"syscall"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	. "github.com/relab/wrfs"
@@ -156,6 +159,13 @@ func TestSymlink(t *testing.T) {
 	if link != src {
 		t.Errorf("got: %v, want: %v", link, src)
 	}
+
+	for _, name := range []string{dest, "../" + dest} {
+		var linkErr *LinkError
+		if err := Symlink(fsys, src, name); !errors.As(err, &linkErr) || linkErr.New != name {
+			t.Errorf("Symlink to %s: got %v, want *LinkError for %s", name, err, name)
+		}
+	}
 }
 
 func TestLink(t *testing.T) {
@@ -222,6 +232,14 @@ func newFile(t *testing.T, fsys FS, fileName string) {
 	check(t, file.Close())
 }
 
+func writeFile(t *testing.T, fsys FS, fileName string, data []byte) {
+	file, err := Create(fsys, fileName)
+	check(t, err)
+	_, err = file.Write(data)
+	check(t, err)
+	check(t, file.Close())
+}
+
 func checkMode(t *testing.T, fsys FS, fileName string, want FileMode) {
 	fi, err := Stat(fsys, fileName)
 	check(t, err)
@@ -231,8 +249,19 @@ func checkMode(t *testing.T, fsys FS, fileName string, want FileMode) {
 	}
 }
 
-func check(t *testing.T, err error) {
-	if err != nil {
-		t.Fatal(err)
+func TestIsNotSupportedErrno(t *testing.T) {
+	if !IsNotSupported(syscall.ENOTSUP) {
+		t.Error("IsNotSupported(ENOTSUP) = false, want true")
+	}
+}
+
+func TestIsNotSupported(t *testing.T) {
+	_, err := Lstat(struct{ FS }{fstest.MapFS{}}, "file")
+	var pathErr *PathError
+	if !IsNotSupported(err) || !errors.As(err, &pathErr) || pathErr.Op != "lstat" {
+		t.Errorf("Lstat on FS without Lstat: got %v, want *PathError matching ErrUnsupported", err)
+	}
+	if IsNotSupported(ErrNotExist) {
+		t.Error("IsNotSupported(ErrNotExist) = true, want false")
 	}
 }
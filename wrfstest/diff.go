@@ -0,0 +1,246 @@
+package wrfstest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// diffDir is the directory in which TestDifferential operates on the candidate file system.
+const diffDir = "wrfstest.diff"
+
+// diffNames are the paths that TestDifferential operates on. They are chosen from a small set,
+// so that operations frequently collide with existing files and directories.
+var diffNames = []string{"a", "b", "c", "a/a", "a/b", "b/a", "a/a/a"}
+
+var diffFlags = []int{
+	os.O_RDONLY,
+	os.O_WRONLY | os.O_CREATE,
+	os.O_RDWR | os.O_CREATE | os.O_EXCL,
+	os.O_WRONLY | os.O_TRUNC,
+	os.O_WRONLY | os.O_APPEND,
+	os.O_RDWR | os.O_CREATE | os.O_TRUNC,
+}
+
+// TestDifferential applies a random sequence of operations to fsys and to a DirFS in a temporary directory,
+// and checks that they report the same class of errors and end up with the same file trees.
+// The operations are Mkdir, OpenFile with various flags followed by a write or read, Rename, Remove and Chmod,
+// applied to a small set of names. The sequence is determined by seed, and has the given number of steps.
+//
+// TestDifferential operates in a directory named "wrfstest.diff" in fsys, which it removes when done.
+// Operations that fsys does not support are skipped, as are comparisons of permission bits if it does
+// not support Chmod. Only the owner permission bits are compared, so that the umask does not matter.
+//
+// If the file systems diverge, TestDifferential returns an error describing the divergence and the
+// operations leading up to it.
+func TestDifferential(fsys wrfs.FS, seed int64, steps int) error {
+	tmp, err := os.MkdirTemp("", "wrfstest")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := wrfs.Mkdir(fsys, diffDir, 0755); err != nil {
+		return err
+	}
+	defer wrfs.RemoveAll(fsys, diffDir)
+	candidate, err := wrfs.Sub(fsys, diffDir)
+	if err != nil {
+		return err
+	}
+
+	d := &differ{
+		candidate: candidate,
+		reference: wrfs.DirFS(tmp),
+		rnd:       rand.New(rand.NewSource(seed)),
+		chmod:     true,
+	}
+	for i := 0; i < steps; i++ {
+		if err := d.step(); err != nil {
+			return fmt.Errorf("wrfstest: seed %d: %v\noperations:\n\t%s", seed, err, strings.Join(d.log, "\n\t"))
+		}
+	}
+	return nil
+}
+
+type differ struct {
+	candidate wrfs.FS
+	reference wrfs.FS
+	rnd       *rand.Rand
+	chmod     bool     // whether the candidate supports Chmod
+	log       []string // operations performed so far
+}
+
+func (d *differ) name() string {
+	return diffNames[d.rnd.Intn(len(diffNames))]
+}
+
+func (d *differ) step() error {
+	var desc string
+	var op func(fsys wrfs.FS) (string, error)
+	var replace func() error // for renames, removes the target from the reference
+	switch d.rnd.Intn(5) {
+	case 0:
+		name := d.name()
+		desc = "mkdir " + name
+		op = func(fsys wrfs.FS) (string, error) { return "", wrfs.Mkdir(fsys, name, 0755) }
+	case 1:
+		name, flag := d.name(), diffFlags[d.rnd.Intn(len(diffFlags))]
+		data := []byte(fmt.Sprint(d.rnd.Intn(1000)))
+		desc = fmt.Sprintf("openfile %s %#x, write %q", name, flag, data)
+		op = func(fsys wrfs.FS) (string, error) { return openAndAccess(fsys, name, flag, data) }
+	case 2:
+		oldname, newname := d.name(), d.name()
+		desc = "rename " + oldname + " " + newname
+		op = func(fsys wrfs.FS) (string, error) { return "", wrfs.Rename(fsys, oldname, newname) }
+		replace = func() error { return wrfs.Remove(d.reference, newname) }
+	case 3:
+		name := d.name()
+		desc = "remove " + name
+		op = func(fsys wrfs.FS) (string, error) { return "", wrfs.Remove(fsys, name) }
+	case 4:
+		// Keep the owner permissions, since permissions are not enforced for root, nor by many implementations.
+		name, mode := d.name(), []wrfs.FileMode{0700, 0711, 0750, 0755}[d.rnd.Intn(4)]
+		desc = fmt.Sprintf("chmod %s %v", name, mode)
+		op = func(fsys wrfs.FS) (string, error) { return "", wrfs.Chmod(fsys, name, mode) }
+	}
+	d.log = append(d.log, desc)
+
+	got, gotErr := op(d.candidate)
+	if wrfs.IsNotSupported(gotErr) {
+		if strings.HasPrefix(desc, "chmod") {
+			d.chmod = false
+		}
+		d.log[len(d.log)-1] += " (unsupported)"
+		return nil
+	}
+	want, wantErr := op(d.reference)
+	if replace != nil && gotErr == nil && errors.Is(wantErr, wrfs.ErrExist) {
+		// os.Rename refuses to replace a directory, while rename(2), and file systems that follow it,
+		// replace empty ones.
+		if err := replace(); err == nil {
+			want, wantErr = op(d.reference)
+		}
+	}
+	if g, w := errorClass(gotErr), errorClass(wantErr); g != w {
+		return fmt.Errorf("%s: got error %v (%s), want %v (%s)", desc, gotErr, g, wantErr, w)
+	}
+	if got != want {
+		return fmt.Errorf("%s: read %q, want %q", desc, got, want)
+	}
+	return d.compareTrees()
+}
+
+// openAndAccess opens the named file with flag, and writes data to it if it is writable, or reads it otherwise.
+// It returns the data read, if any.
+func openAndAccess(fsys wrfs.FS, name string, flag int, data []byte) (read string, err error) {
+	file, err := wrfs.OpenFile(fsys, name, flag, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	fi, err := file.Stat()
+	if err != nil || fi.IsDir() {
+		return "", err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		_, err = wrfs.Write(file, data)
+		return "", err
+	}
+	b, err := io.ReadAll(file)
+	return string(b), err
+}
+
+// errorClass returns a description of the kind of err that is comparable between file systems.
+func errorClass(err error) string {
+	if err == nil {
+		return "nil"
+	}
+	if errors.Is(err, syscall.EINVAL) {
+		// Operating systems report invalid arguments with EINVAL, which does not match ErrInvalid.
+		err = wrfs.ErrInvalid
+	}
+	for _, k := range errKinds {
+		if errors.Is(err, k.err) {
+			return k.name
+		}
+	}
+	for _, e := range []error{syscall.ENOTDIR, syscall.EISDIR, errno.ENOTEMPTY, errno.EBADF} {
+		if errors.Is(err, e) {
+			return e.Error()
+		}
+	}
+	return "other"
+}
+
+// treeEntry describes a file in a tree for comparison.
+type treeEntry struct {
+	dir  bool
+	perm wrfs.FileMode
+	data []byte
+}
+
+func (d *differ) tree(fsys wrfs.FS) (map[string]treeEntry, error) {
+	tree := make(map[string]treeEntry)
+	err := wrfs.WalkDir(fsys, ".", func(name string, entry wrfs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		fi, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		e := treeEntry{dir: entry.IsDir()}
+		if d.chmod {
+			e.perm = fi.Mode().Perm() & 0700
+		}
+		if !e.dir {
+			e.data, err = wrfs.ReadFile(fsys, name)
+		}
+		tree[name] = e
+		return err
+	})
+	return tree, err
+}
+
+func (d *differ) compareTrees() error {
+	got, err := d.tree(d.candidate)
+	if err != nil {
+		return fmt.Errorf("walking candidate: %v", err)
+	}
+	want, err := d.tree(d.reference)
+	if err != nil {
+		return fmt.Errorf("walking reference: %v", err)
+	}
+	for name, w := range want {
+		g, ok := got[name]
+		switch {
+		case !ok:
+			return fmt.Errorf("%s is missing", name)
+		case g.dir != w.dir:
+			return fmt.Errorf("%s: got directory %v, want %v", name, g.dir, w.dir)
+		case g.perm != w.perm:
+			return fmt.Errorf("%s: got owner permissions %v, want %v", name, g.perm, w.perm)
+		case !bytes.Equal(g.data, w.data):
+			return fmt.Errorf("%s: got contents %q, want %q", name, g.data, w.data)
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			return fmt.Errorf("%s exists, but should not", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package wrfstest
+
+import (
+	"bytes"
+	"testing/fstest"
+)
+
+// FromFstest returns a MapFS with the files of m, so that fixtures written for fstest.MapFS can be used where a
+// writable file system is needed. The data of the files is copied, so writes to the MapFS do not modify m.
+// Entries of m that are nil are omitted.
+func FromFstest(m fstest.MapFS) MapFS {
+	fsys := make(MapFS, len(m))
+	for name, f := range m {
+		if f != nil {
+			fsys[name] = &MapFile{Data: bytes.Clone(f.Data), Mode: f.Mode, ModTime: f.ModTime, Sys: f.Sys}
+		}
+	}
+	return fsys
+}
+
+// ToFstest returns an fstest.MapFS with the files of fsys, copying their data like FromFstest.
+func ToFstest(fsys MapFS) fstest.MapFS {
+	m := make(fstest.MapFS, len(fsys))
+	for name, f := range fsys {
+		if f != nil {
+			m[name] = &fstest.MapFile{Data: bytes.Clone(f.Data), Mode: f.Mode, ModTime: f.ModTime, Sys: f.Sys}
+		}
+	}
+	return m
+}
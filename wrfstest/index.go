@@ -0,0 +1,125 @@
+package wrfstest
+
+import (
+	"os"
+	"path"
+	"sort"
+
+	"github.com/relab/wrfs"
+)
+
+// An IndexedMapFS is a MapFS with a prebuilt directory index, which makes opening and reading a directory
+// proportional to the number of its entries instead of the number of files in the map. It is intended for
+// tests with large trees, where WalkDir over a plain MapFS takes quadratic time.
+//
+// The index is rebuilt lazily after the tree is changed through the methods of IndexedMapFS.
+// Callers that modify the map directly must call Reindex afterwards.
+type IndexedMapFS struct {
+	MapFS
+	index map[string][]string // sorted entry names of each directory with entries
+}
+
+// Index returns an IndexedMapFS for fsys. The returned file system shares the map with fsys.
+func (fsys MapFS) Index() *IndexedMapFS {
+	x := &IndexedMapFS{MapFS: fsys}
+	x.Reindex()
+	return x
+}
+
+// Reindex rebuilds the directory index from the map.
+func (fsys *IndexedMapFS) Reindex() {
+	dirs := make(map[string]map[string]bool)
+	for name := range fsys.MapFS {
+		for name != "." {
+			dir, elem := path.Dir(name), path.Base(name)
+			entries, ok := dirs[dir]
+			if !ok {
+				entries = make(map[string]bool)
+				dirs[dir] = entries
+			}
+			if entries[elem] {
+				break // the ancestors have been added already
+			}
+			entries[elem] = true
+			name = dir
+		}
+	}
+	fsys.index = make(map[string][]string, len(dirs))
+	for dir, entries := range dirs {
+		names := make([]string, 0, len(entries))
+		for elem := range entries {
+			names = append(names, elem)
+		}
+		sort.Strings(names)
+		fsys.index[dir] = names
+	}
+}
+
+// invalidate discards the index after a successful change to the tree.
+func (fsys *IndexedMapFS) invalidate(err error) error {
+	if err == nil {
+		fsys.index = nil
+	}
+	return err
+}
+
+// Open opens the named file for reading, using the index to list directories.
+func (fsys *IndexedMapFS) Open(name string) (wrfs.File, error) {
+	if !wrfs.ValidPath(name) {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrInvalid}
+	}
+	file := fsys.MapFS[name]
+	if file != nil && !file.Mode.IsDir() {
+		return fsys.MapFS.Open(name)
+	}
+	if fsys.index == nil {
+		fsys.Reindex()
+	}
+	names, ok := fsys.index[name]
+	if file == nil && !ok && name != "." {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrNotExist}
+	}
+	if file == nil {
+		file = &MapFile{Mode: wrfs.ModeDir | 0555}
+	}
+	entries := make([]mapFileInfo, len(names))
+	for i, elem := range names {
+		f, ok := fsys.MapFS[path.Join(name, elem)]
+		if !ok {
+			f = &MapFile{Mode: wrfs.ModeDir | 0555}
+		}
+		entries[i] = mapFileInfo{elem, f}
+	}
+	return &mapDir{name: name, info: mapFileInfo{path.Base(name), file}, entries: entries}, nil
+}
+
+func (fsys *IndexedMapFS) OpenFile(name string, flag int, perm wrfs.FileMode) (wrfs.File, error) {
+	if flag&os.O_CREATE == 0 {
+		if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+			return fsys.Open(name)
+		}
+		return fsys.MapFS.OpenFile(name, flag, perm)
+	}
+	file, err := fsys.MapFS.OpenFile(name, flag, perm)
+	return file, fsys.invalidate(err)
+}
+
+func (fsys *IndexedMapFS) Mkdir(name string, perm wrfs.FileMode) error {
+	return fsys.invalidate(fsys.MapFS.Mkdir(name, perm))
+}
+
+func (fsys *IndexedMapFS) Remove(name string) error {
+	return fsys.invalidate(fsys.MapFS.Remove(name))
+}
+
+func (fsys *IndexedMapFS) RemoveAll(name string) error {
+	return fsys.invalidate(fsys.MapFS.RemoveAll(name))
+}
+
+func (fsys *IndexedMapFS) Rename(oldpath, newpath string) error {
+	return fsys.invalidate(fsys.MapFS.Rename(oldpath, newpath))
+}
+
+func (fsys *IndexedMapFS) Link(oldname, newname string) error {
+	return fsys.invalidate(fsys.MapFS.Link(oldname, newname))
+}
@@ -0,0 +1,649 @@
+package wrfstest
+
+import (
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/errno"
+)
+
+// A MapFS is a simple writable in-memory file system for use in tests,
+// represented as a map from path names (arguments to Open) to information about the files or directories they represent.
+//
+// Like fstest.MapFS, the map need not include parent directories for files contained in the map;
+// those will be synthesized if needed. Unlike fstest.MapFS, files can be created and written through OpenFile,
+// which implements the flags and access modes of os.OpenFile, so that MapFS can serve as a reference
+// implementation in tests. Open files refer to their *MapFile, so writes are visible through the map.
+//
+// MapFS is not safe for concurrent use, except for concurrent reads, and for locking files opened with OpenLock.
+type MapFS map[string]*MapFile
+
+// A MapFile describes a single file in a MapFS.
+type MapFile struct {
+	Data    []byte        // file content
+	Mode    wrfs.FileMode // FileInfo.Mode
+	ModTime time.Time     // FileInfo.ModTime
+	Sys     interface{}   // FileInfo.Sys
+}
+
+var (
+	_ wrfs.FS          = MapFS(nil)
+	_ wrfs.OpenFileFS  = MapFS(nil)
+	_ wrfs.MkdirFS     = MapFS(nil)
+	_ wrfs.RemoveFS    = MapFS(nil)
+	_ wrfs.RenameFS    = MapFS(nil)
+	_ wrfs.RemoveAllFS = MapFS(nil)
+	_ wrfs.LinkFS      = MapFS(nil)
+	_ wrfs.SameFileFS  = MapFS(nil)
+	_ wrfs.TruncateFS  = MapFS(nil)
+	_ wrfs.SnapshotFS  = MapFS(nil)
+	_ wrfs.LockFS      = MapFS(nil)
+)
+
+// Open opens the named file for reading.
+func (fsys MapFS) Open(name string) (wrfs.File, error) {
+	if !wrfs.ValidPath(name) {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrInvalid}
+	}
+	file := fsys[name]
+	if file != nil && !file.Mode.IsDir() {
+		return &openMapFile{name: name, file: file, flag: os.O_RDONLY}, nil
+	}
+
+	// Directory, possibly synthesized.
+	entries, ok := fsys.children(name)
+	if file == nil && !ok && name != "." {
+		if err := fsys.checkParent("open", name); err != nil {
+			return nil, err
+		}
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrNotExist}
+	}
+	if file == nil {
+		file = &MapFile{Mode: wrfs.ModeDir | 0555}
+	}
+	return &mapDir{name: name, info: mapFileInfo{path.Base(name), file}, entries: entries}, nil
+}
+
+// children returns the entries of the named directory, sorted by name,
+// and reports whether the directory has any entries.
+func (fsys MapFS) children(dir string) ([]mapFileInfo, bool) {
+	prefix := dir + "/"
+	if dir == "." {
+		prefix = ""
+	}
+	var entries []mapFileInfo
+	seen := make(map[string]bool)
+	for fname, f := range fsys {
+		if !strings.HasPrefix(fname, prefix) || fname == dir {
+			continue
+		}
+		elem := fname[len(prefix):]
+		if i := strings.Index(elem, "/"); i >= 0 {
+			elem = elem[:i]
+			f = nil // synthesized directory, unless listed explicitly
+		}
+		if seen[elem] {
+			continue
+		}
+		if f == nil {
+			if g, ok := fsys[prefix+elem]; ok {
+				f = g
+			} else {
+				f = &MapFile{Mode: wrfs.ModeDir | 0555}
+			}
+		}
+		seen[elem] = true
+		entries = append(entries, mapFileInfo{elem, f})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries, len(entries) > 0
+}
+
+// isDir reports whether name is a directory, either listed explicitly or synthesized.
+func (fsys MapFS) isDir(name string) bool {
+	if name == "." {
+		return true
+	}
+	if file, ok := fsys[name]; ok {
+		return file.Mode.IsDir()
+	}
+	_, ok := fsys.children(name)
+	return ok
+}
+
+// OpenFile opens the named file with the specified flag and, if the file is created, with permissions perm.
+// It implements O_CREATE, O_EXCL, O_TRUNC and O_APPEND like os.OpenFile, and the returned file enforces the
+// access mode given by O_RDONLY, O_WRONLY or O_RDWR. O_SYNC is ignored.
+func (fsys MapFS) OpenFile(name string, flag int, perm wrfs.FileMode) (wrfs.File, error) {
+	if !wrfs.ValidPath(name) {
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrInvalid}
+	}
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	file, exists := fsys[name]
+
+	if fsys.isDir(name) {
+		switch {
+		case flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+			return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrExist}
+		case writable:
+			return nil, &wrfs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+		}
+		return fsys.Open(name)
+	}
+
+	switch {
+	case exists && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrExist}
+	case !exists:
+		if err := fsys.checkParent("open", name); err != nil {
+			return nil, err
+		}
+		if flag&os.O_CREATE == 0 {
+			return nil, &wrfs.PathError{Op: "open", Path: name, Err: wrfs.ErrNotExist}
+		}
+		file = &MapFile{Mode: perm & wrfs.ModePerm, ModTime: time.Now()}
+		fsys[name] = file
+	}
+	if writable && flag&os.O_TRUNC != 0 && len(file.Data) > 0 {
+		file.Data = nil
+		file.ModTime = time.Now()
+	}
+	return &openMapFile{name: name, file: file, flag: flag}, nil
+}
+
+// checkParent checks that the parent directory of name exists.
+func (fsys MapFS) checkParent(op, name string) error {
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		if fsys.isDir(dir) {
+			if dir == path.Dir(name) {
+				return nil
+			}
+			return &wrfs.PathError{Op: op, Path: name, Err: wrfs.ErrNotExist}
+		}
+		if _, ok := fsys[dir]; ok {
+			return &wrfs.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+		}
+	}
+}
+
+// Mkdir creates a new directory with the specified name and permission bits.
+func (fsys MapFS) Mkdir(name string, perm wrfs.FileMode) error {
+	if !wrfs.ValidPath(name) {
+		return &wrfs.PathError{Op: "mkdir", Path: name, Err: wrfs.ErrInvalid}
+	}
+	if _, ok := fsys[name]; ok || fsys.isDir(name) {
+		return &wrfs.PathError{Op: "mkdir", Path: name, Err: wrfs.ErrExist}
+	}
+	if err := fsys.checkParent("mkdir", name); err != nil {
+		return err
+	}
+	fsys[name] = &MapFile{Mode: wrfs.ModeDir | perm&wrfs.ModePerm, ModTime: time.Now()}
+	return nil
+}
+
+// Remove removes the named file or empty directory.
+func (fsys MapFS) Remove(name string) error {
+	if !wrfs.ValidPath(name) || name == "." {
+		return &wrfs.PathError{Op: "remove", Path: name, Err: wrfs.ErrInvalid}
+	}
+	if _, ok := fsys.children(name); ok {
+		return &wrfs.PathError{Op: "remove", Path: name, Err: errno.ENOTEMPTY}
+	}
+	if _, ok := fsys[name]; !ok {
+		if err := fsys.checkParent("remove", name); err != nil {
+			return err
+		}
+		return &wrfs.PathError{Op: "remove", Path: name, Err: wrfs.ErrNotExist}
+	}
+	delete(fsys, name)
+	return nil
+}
+
+// Truncate changes the size of the named file, discarding data beyond size or extending the file with zeros.
+func (fsys MapFS) Truncate(name string, size int64) error {
+	if !wrfs.ValidPath(name) || size < 0 {
+		return &wrfs.PathError{Op: "truncate", Path: name, Err: wrfs.ErrInvalid}
+	}
+	file, ok := fsys[name]
+	if !ok {
+		if fsys.isDir(name) {
+			return &wrfs.PathError{Op: "truncate", Path: name, Err: syscall.EISDIR}
+		}
+		return &wrfs.PathError{Op: "truncate", Path: name, Err: wrfs.ErrNotExist}
+	}
+	if file.Mode.IsDir() {
+		return &wrfs.PathError{Op: "truncate", Path: name, Err: syscall.EISDIR}
+	}
+	file.truncate(size)
+	return nil
+}
+
+// truncate resizes the contents of f to size, padding with zeros.
+func (f *MapFile) truncate(size int64) {
+	if size <= int64(len(f.Data)) {
+		f.Data = f.Data[:size:size]
+	} else {
+		data := make([]byte, size)
+		copy(data, f.Data)
+		f.Data = data
+	}
+	f.ModTime = time.Now()
+}
+
+// Snapshot returns a read-only copy of fsys. Unlike the snapshots of memfs, it copies the contents of all files.
+func (fsys MapFS) Snapshot() (wrfs.FS, error) {
+	snap := make(MapFS, len(fsys))
+	for name, file := range fsys {
+		c := *file
+		c.Data = append([]byte(nil), file.Data...)
+		snap[name] = &c
+	}
+	return wrfs.ReadOnly(snap), nil
+}
+
+// RemoveAll removes path and any children it contains.
+// If the path does not exist, RemoveAll returns nil (no error).
+func (fsys MapFS) RemoveAll(name string) error {
+	if !wrfs.ValidPath(name) || name == "." {
+		return &wrfs.PathError{Op: "removeall", Path: name, Err: wrfs.ErrInvalid}
+	}
+	prefix := name + "/"
+	for fname := range fsys {
+		if fname == name || strings.HasPrefix(fname, prefix) {
+			delete(fsys, fname)
+		}
+	}
+	return nil
+}
+
+// Link creates newname as a hard link to the oldname file, such that both names refer to the same *MapFile.
+func (fsys MapFS) Link(oldname, newname string) error {
+	linkErr := func(err error) error {
+		return &wrfs.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+	if !wrfs.ValidPath(oldname) || !wrfs.ValidPath(newname) {
+		return linkErr(wrfs.ErrInvalid)
+	}
+	file, ok := fsys[oldname]
+	if !ok {
+		if fsys.isDir(oldname) {
+			return linkErr(wrfs.ErrPermission)
+		}
+		return linkErr(wrfs.ErrNotExist)
+	}
+	if file.Mode.IsDir() {
+		return linkErr(wrfs.ErrPermission)
+	}
+	if _, ok := fsys[newname]; ok || fsys.isDir(newname) {
+		return linkErr(wrfs.ErrExist)
+	}
+	if err := fsys.checkParent("link", newname); err != nil {
+		return linkErr(err.(*wrfs.PathError).Err)
+	}
+	fsys[newname] = file
+	return nil
+}
+
+// SameFile reports whether fi1 and fi2 describe the same *MapFile.
+// Synthesized directories are never the same file.
+func (fsys MapFS) SameFile(fi1, fi2 wrfs.FileInfo) bool {
+	i1, ok1 := fi1.(*mapFileInfo)
+	i2, ok2 := fi2.(*mapFileInfo)
+	return ok1 && ok2 && i1.f == i2.f
+}
+
+// Rename renames (moves) oldpath to newpath. If newpath already exists and is not a directory, Rename replaces it.
+// Like os.Rename, Rename fails with an error matching ErrExist if newpath is a directory.
+// Renaming a directory moves all of its descendants.
+func (fsys MapFS) Rename(oldpath, newpath string) error {
+	linkErr := func(err error) error {
+		return &wrfs.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	if !wrfs.ValidPath(oldpath) || !wrfs.ValidPath(newpath) || oldpath == "." || newpath == "." {
+		return linkErr(wrfs.ErrInvalid)
+	}
+	for _, name := range []string{oldpath, newpath} {
+		if err := fsys.checkParent("rename", name); err != nil {
+			return linkErr(err.(*wrfs.PathError).Err)
+		}
+	}
+	_, oldExists := fsys[oldpath]
+	oldIsDir := fsys.isDir(oldpath)
+	if !oldExists && !oldIsDir {
+		return linkErr(wrfs.ErrNotExist)
+	}
+	if fsys.isDir(newpath) {
+		return linkErr(wrfs.ErrExist)
+	}
+	if oldIsDir && strings.HasPrefix(newpath, oldpath+"/") {
+		return linkErr(wrfs.ErrInvalid)
+	}
+
+	if _, ok := fsys[newpath]; ok {
+		switch {
+		case oldpath == newpath || fsys[oldpath] == fsys[newpath]:
+			return nil
+		case oldIsDir:
+			return linkErr(syscall.ENOTDIR)
+		}
+		delete(fsys, newpath)
+	}
+
+	if !oldIsDir {
+		fsys[newpath] = fsys[oldpath]
+		delete(fsys, oldpath)
+		return nil
+	}
+	if !oldExists {
+		// Make the synthesized directory explicit, since its new parent may not have other descendants.
+		fsys[oldpath] = &MapFile{Mode: wrfs.ModeDir | 0555}
+	}
+	prefix := oldpath + "/"
+	moved := make(map[string]*MapFile)
+	for name, file := range fsys {
+		if name == oldpath || strings.HasPrefix(name, prefix) {
+			moved[newpath+name[len(oldpath):]] = file
+			delete(fsys, name)
+		}
+	}
+	for name, file := range moved {
+		fsys[name] = file
+	}
+	return nil
+}
+
+// A mapFileInfo implements fs.FileInfo and fs.DirEntry for a given map file.
+type mapFileInfo struct {
+	name string
+	f    *MapFile
+}
+
+func (i *mapFileInfo) Name() string                 { return i.name }
+func (i *mapFileInfo) Size() int64                  { return int64(len(i.f.Data)) }
+func (i *mapFileInfo) Mode() wrfs.FileMode          { return i.f.Mode }
+func (i *mapFileInfo) Type() wrfs.FileMode          { return i.f.Mode.Type() }
+func (i *mapFileInfo) ModTime() time.Time           { return i.f.ModTime }
+func (i *mapFileInfo) IsDir() bool                  { return i.f.Mode.IsDir() }
+func (i *mapFileInfo) Sys() interface{}             { return i.f.Sys }
+func (i *mapFileInfo) Info() (wrfs.FileInfo, error) { return i, nil }
+
+// An openMapFile is a regular file open for reading and/or writing.
+type openMapFile struct {
+	name   string
+	file   *MapFile
+	flag   int
+	offset int64
+	closed bool
+	lock   lockMode // lock held through this file; guarded by lockMu
+}
+
+func (f *openMapFile) check(op string, allowed bool) error {
+	if f.closed {
+		return &wrfs.PathError{Op: op, Path: f.name, Err: wrfs.ErrClosed}
+	}
+	if !allowed {
+		return &wrfs.PathError{Op: op, Path: f.name, Err: errno.EBADF}
+	}
+	return nil
+}
+
+func (f *openMapFile) readable() bool {
+	return f.flag&(os.O_WRONLY|os.O_RDWR) != os.O_WRONLY
+}
+
+func (f *openMapFile) writable() bool {
+	return f.flag&(os.O_WRONLY|os.O_RDWR) != 0
+}
+
+func (f *openMapFile) Stat() (wrfs.FileInfo, error) {
+	if err := f.check("stat", true); err != nil {
+		return nil, err
+	}
+	return &mapFileInfo{path.Base(f.name), f.file}, nil
+}
+
+func (f *openMapFile) Close() error {
+	if err := f.check("close", true); err != nil {
+		return err
+	}
+	f.closed = true
+	lockMu.Lock()
+	f.unlock()
+	lockMu.Unlock()
+	return nil
+}
+
+func (f *openMapFile) Read(b []byte) (int, error) {
+	if err := f.check("read", f.readable()); err != nil {
+		return 0, err
+	}
+	if f.offset >= int64(len(f.file.Data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, f.file.Data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *openMapFile) ReadAt(b []byte, offset int64) (int, error) {
+	if err := f.check("readat", f.readable()); err != nil {
+		return 0, err
+	}
+	if offset < 0 {
+		return 0, &wrfs.PathError{Op: "readat", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	if offset > int64(len(f.file.Data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, f.file.Data[offset:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *openMapFile) Write(b []byte) (int, error) {
+	if err := f.check("write", f.writable()); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(f.file.Data))
+	}
+	n := f.writeAt(b, f.offset)
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *openMapFile) WriteAt(b []byte, offset int64) (int, error) {
+	if err := f.check("writeat", f.writable()); err != nil {
+		return 0, err
+	}
+	if offset < 0 || f.flag&os.O_APPEND != 0 {
+		return 0, &wrfs.PathError{Op: "writeat", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	return f.writeAt(b, offset), nil
+}
+
+func (f *openMapFile) writeAt(b []byte, offset int64) int {
+	if end := offset + int64(len(b)); end > int64(len(f.file.Data)) {
+		f.file.truncate(end)
+	}
+	f.file.ModTime = time.Now()
+	return copy(f.file.Data[offset:], b)
+}
+
+// Truncate changes the size of the file. The file must be open for writing.
+func (f *openMapFile) Truncate(size int64) error {
+	if err := f.check("truncate", f.writable()); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &wrfs.PathError{Op: "truncate", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	f.file.truncate(size)
+	return nil
+}
+
+func (f *openMapFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.check("seek", true); err != nil {
+		return 0, err
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.file.Data))
+	}
+	if offset < 0 {
+		return 0, &wrfs.PathError{Op: "seek", Path: f.name, Err: wrfs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// OpenLock opens the named file such that it can be locked, creating it with mode 0666 if it does not exist.
+func (fsys MapFS) OpenLock(name string) (wrfs.LockFile, error) {
+	file, err := fsys.OpenFile(name, os.O_RDONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := file.(*openMapFile); ok {
+		return f, nil
+	}
+	file.Close()
+	return nil, &wrfs.PathError{Op: "lock", Path: name, Err: wrfs.ErrUnsupported}
+}
+
+// The lock state of all MapFiles, which is kept outside of them so that they can be copied, and lockCond,
+// which is signaled when a lock is released.
+var (
+	lockMu   sync.Mutex
+	lockCond = sync.NewCond(&lockMu)
+	locks    = make(map[*MapFile]*fileLock)
+)
+
+// fileLock is the lock state of a MapFile.
+type fileLock struct {
+	readers int  // number of shared locks
+	writer  bool // whether the file is locked exclusively
+}
+
+type lockMode int
+
+const (
+	unlocked lockMode = iota
+	sharedLock
+	exclusiveLock
+)
+
+// Lock acquires an exclusive lock on the file, blocking until no other file holds a lock on the same MapFile.
+func (f *openMapFile) Lock() error {
+	_, err := f.acquire(exclusiveLock, true)
+	return err
+}
+
+// RLock acquires a shared lock on the file, blocking until no other file holds an exclusive lock on the same MapFile.
+func (f *openMapFile) RLock() error {
+	_, err := f.acquire(sharedLock, true)
+	return err
+}
+
+// TryLock attempts to acquire an exclusive lock on the file without blocking, and reports whether it succeeded.
+func (f *openMapFile) TryLock() (bool, error) {
+	return f.acquire(exclusiveLock, false)
+}
+
+// Unlock releases the lock held through the file.
+func (f *openMapFile) Unlock() error {
+	if err := f.check("unlock", true); err != nil {
+		return err
+	}
+	lockMu.Lock()
+	defer lockMu.Unlock()
+	f.unlock()
+	return nil
+}
+
+// acquire acquires a lock of the given mode, waiting for it if wait is set, and reports whether it did.
+func (f *openMapFile) acquire(mode lockMode, wait bool) (bool, error) {
+	if err := f.check("lock", true); err != nil {
+		return false, err
+	}
+	lockMu.Lock()
+	defer lockMu.Unlock()
+	// Like flock, converting a lock releases it before acquiring the new one.
+	f.unlock()
+	l := locks[f.file]
+	if l == nil {
+		l = &fileLock{}
+		locks[f.file] = l
+	}
+	for l.writer || (mode == exclusiveLock && l.readers > 0) {
+		if !wait {
+			return false, nil
+		}
+		lockCond.Wait()
+	}
+	if mode == exclusiveLock {
+		l.writer = true
+	} else {
+		l.readers++
+	}
+	f.lock = mode
+	return true, nil
+}
+
+// unlock releases the lock held through f. The caller must hold lockMu.
+func (f *openMapFile) unlock() {
+	l := locks[f.file]
+	switch f.lock {
+	case unlocked:
+		return
+	case sharedLock:
+		l.readers--
+	case exclusiveLock:
+		l.writer = false
+	}
+	f.lock = unlocked
+	if l.readers == 0 && !l.writer {
+		delete(locks, f.file)
+	}
+	lockCond.Broadcast()
+}
+
+// A mapDir is a directory fs.File (so also an fs.ReadDirFile) open for reading.
+type mapDir struct {
+	name    string
+	info    mapFileInfo
+	entries []mapFileInfo
+	offset  int
+}
+
+func (d *mapDir) Stat() (wrfs.FileInfo, error) { return &d.info, nil }
+func (d *mapDir) Close() error                 { return nil }
+func (d *mapDir) Read(b []byte) (int, error) {
+	return 0, &wrfs.PathError{Op: "read", Path: d.name, Err: syscall.EISDIR}
+}
+
+func (d *mapDir) ReadDir(count int) ([]wrfs.DirEntry, error) {
+	n := len(d.entries) - d.offset
+	if n == 0 && count > 0 {
+		return nil, io.EOF
+	}
+	if count > 0 && n > count {
+		n = count
+	}
+	list := make([]wrfs.DirEntry, n)
+	for i := range list {
+		list[i] = &d.entries[d.offset+i]
+	}
+	d.offset += n
+	return list, nil
+}
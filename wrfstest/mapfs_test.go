@@ -0,0 +1,316 @@
+package wrfstest_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/fstest"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/errno"
+	"github.com/relab/wrfs/wrfstest"
+)
+
+func TestMapFS(t *testing.T) {
+	fsys := wrfstest.MapFS{
+		"a/b/c.txt": {Data: []byte("hello")},
+		"d":         {Mode: wrfs.ModeDir | 0755},
+	}
+	if err := fstest.TestFS(fsys, "a/b/c.txt", "d"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMapFSOpenFile(t *testing.T) {
+	fsys := wrfstest.MapFS{"file": {Data: []byte("hello")}}
+
+	if _, err := fsys.OpenFile("file", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644); !errors.Is(err, wrfs.ErrExist) {
+		t.Errorf("O_EXCL on existing file: got %v, want ErrExist", err)
+	}
+	if _, err := fsys.OpenFile("missing", os.O_RDWR, 0); !errors.Is(err, wrfs.ErrNotExist) {
+		t.Errorf("open missing file without O_CREATE: got %v, want ErrNotExist", err)
+	}
+	if _, err := fsys.OpenFile("missing/file", os.O_RDWR|os.O_CREATE, 0644); !errors.Is(err, wrfs.ErrNotExist) {
+		t.Errorf("create in missing directory: got %v, want ErrNotExist", err)
+	}
+
+	file, err := fsys.OpenFile("file", os.O_RDONLY, 0)
+	check(t, err)
+	if _, err := wrfs.Write(file, []byte("x")); !errors.Is(err, errno.EBADF) {
+		t.Errorf("write to read-only file: got %v, want EBADF", err)
+	}
+	check(t, file.Close())
+
+	file, err = fsys.OpenFile("file", os.O_WRONLY|os.O_APPEND, 0)
+	check(t, err)
+	if _, err := file.Read(make([]byte, 1)); !errors.Is(err, errno.EBADF) {
+		t.Errorf("read from write-only file: got %v, want EBADF", err)
+	}
+	_, err = wrfs.Write(file, []byte(", world"))
+	check(t, err)
+	check(t, file.Close())
+	if got := string(fsys["file"].Data); got != "hello, world" {
+		t.Errorf("after append: got %q, want %q", got, "hello, world")
+	}
+
+	file, err = fsys.OpenFile("file", os.O_RDWR|os.O_TRUNC, 0)
+	check(t, err)
+	_, err = wrfs.Write(file, []byte("new"))
+	check(t, err)
+	_, err = wrfs.Seek(file, 0, io.SeekStart)
+	check(t, err)
+	data, err := io.ReadAll(file)
+	check(t, err)
+	if string(data) != "new" {
+		t.Errorf("after truncate: got %q, want %q", data, "new")
+	}
+	check(t, file.Close())
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMapFSRename(t *testing.T) {
+	fsys := wrfstest.MapFS{
+		"dir/a":       {Data: []byte("a")},
+		"dir/sub/b":   {Data: []byte("b")},
+		"file":        {Data: []byte("file")},
+		"empty":       {Mode: wrfs.ModeDir | 0755},
+		"full/c":      {Data: []byte("c")},
+		"other/empty": {Mode: wrfs.ModeDir | 0755},
+	}
+
+	if err := fsys.Rename("dir", "empty"); !errors.Is(err, wrfs.ErrExist) {
+		t.Errorf("rename onto directory: got %v, want ErrExist", err)
+	}
+	if err := fsys.Rename("file", "empty"); !errors.Is(err, wrfs.ErrExist) {
+		t.Errorf("rename file onto directory: got %v, want ErrExist", err)
+	}
+	if err := fsys.Rename("dir", "file"); !errors.Is(err, syscall.ENOTDIR) {
+		t.Errorf("rename directory onto file: got %v, want ENOTDIR", err)
+	}
+	if err := fsys.Rename("dir", "dir/sub/x"); !errors.Is(err, wrfs.ErrInvalid) {
+		t.Errorf("rename directory into itself: got %v, want ErrInvalid", err)
+	}
+
+	check(t, fsys.Rename("dir", "moved"))
+	check(t, fsys.Rename("file", "moved/a"))
+	if err := fstest.TestFS(fsys, "moved/a", "moved/sub/b", "empty", "full/c", "other/empty"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrfs.Stat(fsys, "dir"); !errors.Is(err, wrfs.ErrNotExist) {
+		t.Errorf("stat of renamed directory: got %v, want ErrNotExist", err)
+	}
+	if got := string(fsys["moved/a"].Data); got != "file" {
+		t.Errorf("replaced file contains %q, want %q", got, "file")
+	}
+}
+
+func TestMapFSLink(t *testing.T) {
+	fsys := wrfstest.MapFS{"dir/file": {Data: []byte("data")}}
+
+	check(t, fsys.Link("dir/file", "link"))
+	if err := fsys.Link("dir/file", "link"); !errors.Is(err, wrfs.ErrExist) {
+		t.Errorf("link onto existing file: got %v, want ErrExist", err)
+	}
+	check(t, wrfs.WriteFile(fsys, "link", []byte("new data"), 0))
+	if got := string(fsys["dir/file"].Data); got != "new data" {
+		t.Errorf("write through link: got %q, want %q", got, "new data")
+	}
+	fi1, err := wrfs.Stat(fsys, "dir/file")
+	check(t, err)
+	fi2, err := wrfs.Stat(fsys, "link")
+	check(t, err)
+	if !wrfs.SameFile(fsys, fi1, fi2) {
+		t.Error("SameFile of hard links = false, want true")
+	}
+
+	check(t, wrfs.RemoveAll(fsys, "dir"))
+	check(t, wrfs.RemoveAll(fsys, "dir"))
+	if _, err := wrfs.Stat(fsys, "dir"); !errors.Is(err, wrfs.ErrNotExist) {
+		t.Errorf("stat after RemoveAll: got %v, want ErrNotExist", err)
+	}
+	if _, ok := fsys["link"]; !ok {
+		t.Error("RemoveAll removed the other link")
+	}
+}
+
+func TestMapFSTruncate(t *testing.T) {
+	fsys := wrfstest.MapFS{"file": {Data: []byte("hello")}}
+
+	check(t, fsys.Truncate("file", 2))
+	check(t, fsys.Truncate("file", 4))
+	if got := string(fsys["file"].Data); got != "he\x00\x00" {
+		t.Errorf("after Truncate: got %q, want %q", got, "he\x00\x00")
+	}
+
+	// Exercise the fallback through TruncateFile.
+	noTruncate := struct{ wrfs.OpenFileFS }{fsys}
+	check(t, wrfs.Truncate(noTruncate, "file", 1))
+	if got := string(fsys["file"].Data); got != "h" {
+		t.Errorf("after file Truncate: got %q, want %q", got, "h")
+	}
+
+	file, err := fsys.Open("file")
+	check(t, err)
+	defer file.Close()
+	if err := file.(wrfs.TruncateFile).Truncate(0); !errors.Is(err, errno.EBADF) {
+		t.Errorf("Truncate of read-only file: got %v, want EBADF", err)
+	}
+}
+
+func TestMapFSLock(t *testing.T) {
+	fsys := wrfstest.MapFS{"dir": {Mode: wrfs.ModeDir | 0755}}
+
+	a, err := wrfs.Lock(fsys, "lock")
+	check(t, err)
+	if _, ok := fsys["lock"]; !ok {
+		t.Error("OpenLock did not create the file")
+	}
+	if _, err := wrfs.TryLock(fsys, "lock"); !errors.Is(err, wrfs.ErrLocked) {
+		t.Errorf("TryLock of a locked file: got %v, want ErrLocked", err)
+	}
+	check(t, a.RLock())
+	b, err := wrfs.RLock(fsys, "lock")
+	check(t, err)
+	if ok, err := b.TryLock(); ok || err != nil {
+		t.Errorf("TryLock while shared by another file: got %v, %v, want false", ok, err)
+	}
+
+	// Lock blocks until the other shared lock is released.
+	locked := make(chan error)
+	go func() { locked <- b.Lock() }()
+	check(t, a.Close())
+	check(t, <-locked)
+	check(t, b.Unlock())
+	c, err := wrfs.TryLock(fsys, "lock")
+	check(t, err)
+	check(t, c.Close())
+	check(t, b.Close())
+
+	if _, err := fsys.OpenLock("dir"); !errors.Is(err, wrfs.ErrUnsupported) {
+		t.Errorf("OpenLock of a directory: got %v, want ErrUnsupported", err)
+	}
+}
+
+func TestIndexedMapFS(t *testing.T) {
+	m := wrfstest.MapFS{"empty": {Mode: wrfs.ModeDir | 0755}}
+	var names []string
+	for i := 0; i < 20000; i++ {
+		name := fmt.Sprintf("d%d/e%d/f%d", i%10, i%100, i)
+		m[name] = &wrfstest.MapFile{Data: []byte(name)}
+		names = append(names, name)
+	}
+	fsys := m.Index()
+
+	var n int
+	err := wrfs.WalkDir(fsys, ".", func(name string, d wrfs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			n++
+		}
+		return err
+	})
+	check(t, err)
+	if n != len(names) {
+		t.Errorf("WalkDir visited %d files, want %d", n, len(names))
+	}
+
+	check(t, wrfs.WriteFile(fsys, "empty/new", nil, 0644))
+	check(t, wrfs.Rename(fsys, "d0", "moved"))
+	if err := fstest.TestFS(fsys, "empty/new", "moved/e0/f0", "d1/e1/f1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	run := func(fsys wrfs.FS) string {
+		var out strings.Builder
+		entries, err := wrfs.ReadDir(fsys, "dir")
+		check(t, err)
+		for _, entry := range entries {
+			data, err := wrfs.ReadFile(fsys, "dir/"+entry.Name())
+			check(t, err)
+			fmt.Fprintf(&out, "%s=%s;", entry.Name(), data)
+		}
+		if _, err := wrfs.Stat(fsys, "missing"); !errors.Is(err, wrfs.ErrNotExist) {
+			t.Errorf("Stat(missing): got %v, want ErrNotExist", err)
+		}
+		check(t, wrfs.WriteFile(fsys, "dir/c", []byte("c"), 0644))
+		return out.String()
+	}
+
+	rec := wrfstest.NewRecorder(wrfstest.MapFS{
+		"dir/a": {Data: []byte("a")},
+		"dir/b": {Data: []byte("b")},
+	})
+	want := run(rec)
+
+	var log bytes.Buffer
+	check(t, wrfstest.WriteLog(&log, rec.Calls()))
+	calls, err := wrfstest.ReadLog(&log)
+	check(t, err)
+	rep := wrfstest.NewReplayer(calls)
+	if got := run(rep); got != want {
+		t.Errorf("replay: got %q, want %q", got, want)
+	}
+	check(t, rep.Done())
+
+	if _, err := rep.Open("dir/a"); !errors.Is(err, wrfstest.ErrReplayMismatch) {
+		t.Errorf("call after log: got %v, want ErrReplayMismatch", err)
+	}
+}
+
+func TestTxtar(t *testing.T) {
+	archive := "comment\n-- a.txt --\nhello\n-- dir/b.txt --\nno newline\n-- empty --\n"
+	fsys := wrfstest.FromTxtar([]byte(archive))
+	if err := fstest.TestFS(fsys, "a.txt", "dir/b.txt", "empty"); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(fsys["dir/b.txt"].Data); got != "no newline\n" {
+		t.Errorf("dir/b.txt contains %q, want %q", got, "no newline\n")
+	}
+
+	data, err := wrfstest.ToTxtar(fsys, ".")
+	check(t, err)
+	if want := archive[len("comment\n"):]; string(data) != want {
+		t.Errorf("ToTxtar(.) = %q, want %q", data, want)
+	}
+	data, err = wrfstest.ToTxtar(fsys, "dir")
+	check(t, err)
+	if want := "-- b.txt --\nno newline\n"; string(data) != want {
+		t.Errorf("ToTxtar(dir) = %q, want %q", data, want)
+	}
+}
+
+func TestFstest(t *testing.T) {
+	m := fstest.MapFS{
+		"a.txt":     {Data: []byte("hello"), Mode: 0600},
+		"dir/b.txt": {Data: []byte("world")},
+		"empty":     {Mode: wrfs.ModeDir | 0755},
+	}
+	fsys := wrfstest.FromFstest(m)
+	if err := fstest.TestFS(fsys, "a.txt", "dir/b.txt", "empty"); err != nil {
+		t.Fatal(err)
+	}
+	check(t, wrfs.WriteFile(fsys, "a.txt", []byte("changed"), 0))
+	if string(m["a.txt"].Data) != "hello" {
+		t.Errorf("write through the MapFS changed the fstest.MapFS to %q", m["a.txt"].Data)
+	}
+
+	back := wrfstest.ToFstest(fsys)
+	if err := fstest.TestFS(back, "a.txt", "dir/b.txt", "empty"); err != nil {
+		t.Fatal(err)
+	}
+	if f := back["a.txt"]; string(f.Data) != "changed" || f.Mode != 0600 {
+		t.Errorf("a.txt has data %q and mode %v", f.Data, f.Mode)
+	}
+}
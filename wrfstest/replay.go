@@ -0,0 +1,516 @@
+package wrfstest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/relab/wrfs"
+)
+
+// A Call is a single file system call captured by a Recorder.
+type Call struct {
+	Op      string       `json:"op"`
+	Path    string       `json:"path"`
+	Args    []string     `json:"args,omitempty"`    // remaining arguments, such as the new name, flags or mode
+	Err     string       `json:"err,omitempty"`     // error message, if the call failed
+	ErrKind string       `json:"errkind,omitempty"` // name of the wrfs error matched by the error, if any
+	Info    *FileRecord  `json:"info,omitempty"`    // result of Stat and Lstat, and the opened file
+	Entries []FileRecord `json:"entries,omitempty"` // result of ReadDir, and the entries of an opened directory
+	Data    []byte       `json:"data,omitempty"`    // result of ReadFile, and the contents of an opened file
+	Target  string       `json:"target,omitempty"`  // result of Readlink
+}
+
+// A FileRecord is the recorded form of a FileInfo.
+type FileRecord struct {
+	Name    string        `json:"name"`
+	Size    int64         `json:"size"`
+	Mode    wrfs.FileMode `json:"mode"`
+	ModTime time.Time     `json:"modtime"`
+}
+
+func newFileRecord(fi wrfs.FileInfo) FileRecord {
+	return FileRecord{Name: fi.Name(), Size: fi.Size(), Mode: fi.Mode(), ModTime: fi.ModTime()}
+}
+
+// fileInfo returns a FileInfo describing the recorded file, and the file's contents.
+func (rec FileRecord) fileInfo(data []byte) *mapFileInfo {
+	if data == nil && rec.Size > 0 {
+		// Entries are recorded without contents, but must report their size.
+		data = make([]byte, rec.Size)
+	}
+	return &mapFileInfo{rec.Name, &MapFile{Data: data, Mode: rec.Mode, ModTime: rec.ModTime}}
+}
+
+var errKinds = []struct {
+	name string
+	err  error
+}{
+	{"notexist", wrfs.ErrNotExist},
+	{"exist", wrfs.ErrExist},
+	{"permission", wrfs.ErrPermission},
+	{"invalid", wrfs.ErrInvalid},
+	{"closed", wrfs.ErrClosed},
+	{"unsupported", wrfs.ErrUnsupported},
+}
+
+// replayedError is an error read from a log. It has the recorded message and matches the recorded kind.
+type replayedError struct {
+	msg  string
+	kind error
+}
+
+func (e *replayedError) Error() string { return e.msg }
+func (e *replayedError) Unwrap() error { return e.kind }
+
+func (c *Call) setErr(err error) {
+	if err == nil {
+		return
+	}
+	c.Err = err.Error()
+	for _, k := range errKinds {
+		if errors.Is(err, k.err) {
+			c.ErrKind = k.name
+			break
+		}
+	}
+}
+
+func (c *Call) err() error {
+	if c.Err == "" {
+		return nil
+	}
+	err := &replayedError{msg: c.Err}
+	for _, k := range errKinds {
+		if k.name == c.ErrKind {
+			err.kind = k.err
+		}
+	}
+	return err
+}
+
+// open returns a read-only file with the recorded contents or entries.
+func (c *Call) open(name string) wrfs.File {
+	info := c.Info.fileInfo(c.Data)
+	if !info.IsDir() {
+		return &openMapFile{name: name, file: info.f, flag: os.O_RDONLY}
+	}
+	entries := make([]mapFileInfo, len(c.Entries))
+	for i, e := range c.Entries {
+		entries[i] = *e.fileInfo(nil)
+	}
+	return &mapDir{name: name, info: *info, entries: entries}
+}
+
+// WriteLog writes calls to w as a sequence of JSON objects, one per line.
+func WriteLog(w io.Writer, calls []Call) error {
+	enc := json.NewEncoder(w)
+	for _, call := range calls {
+		if err := enc.Encode(call); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadLog reads calls written by WriteLog from r.
+func ReadLog(r io.Reader) ([]Call, error) {
+	var calls []Call
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var call Call
+		err := dec.Decode(&call)
+		if err == io.EOF {
+			return calls, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, call)
+	}
+}
+
+// A Recorder is a file system that captures every call to the file system it wraps, so that they can be
+// replayed later with a Replayer.
+//
+// Opening a regular file for reading records its contents, and opening a directory records its entries;
+// the returned file is an in-memory copy, so reads behave the same during recording and replay.
+// Files opened for writing are returned unchanged, and writes to them are not recorded.
+type Recorder struct {
+	fsys  wrfs.FS
+	mu    sync.Mutex
+	calls []Call
+}
+
+// NewRecorder returns a Recorder that records the calls to fsys.
+func NewRecorder(fsys wrfs.FS) *Recorder {
+	return &Recorder{fsys: fsys}
+}
+
+// Calls returns the calls recorded so far.
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+func (r *Recorder) record(call Call, err error) {
+	call.setErr(err)
+	r.mu.Lock()
+	r.calls = append(r.calls, call)
+	r.mu.Unlock()
+}
+
+func (r *Recorder) Open(name string) (wrfs.File, error) {
+	call := Call{Op: "open", Path: name}
+	file, err := r.snapshot(&call, func() (wrfs.File, error) { return r.fsys.Open(name) })
+	r.record(call, err)
+	return file, err
+}
+
+// snapshot opens a file with open, records its contents in call, and returns an in-memory copy of it.
+func (r *Recorder) snapshot(call *Call, open func() (wrfs.File, error)) (wrfs.File, error) {
+	file, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	rec := newFileRecord(fi)
+	call.Info = &rec
+	if fi.IsDir() {
+		dir, ok := file.(wrfs.ReadDirFile)
+		if !ok {
+			return nil, &wrfs.PathError{Op: "readdir", Path: call.Path, Err: wrfs.ErrUnsupported}
+		}
+		entries, err := dir.ReadDir(-1)
+		if err != nil {
+			return nil, err
+		}
+		if call.Entries, err = entryRecords(entries); err != nil {
+			return nil, err
+		}
+	} else if call.Data, err = io.ReadAll(file); err != nil {
+		return nil, err
+	}
+	return call.open(call.Path), nil
+}
+
+func entryRecords(entries []wrfs.DirEntry) ([]FileRecord, error) {
+	records := make([]FileRecord, len(entries))
+	for i, entry := range entries {
+		fi, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		records[i] = newFileRecord(fi)
+	}
+	return records, nil
+}
+
+func (r *Recorder) OpenFile(name string, flag int, perm wrfs.FileMode) (wrfs.File, error) {
+	call := Call{Op: "openfile", Path: name, Args: []string{strconv.Itoa(flag), perm.String()}}
+	var file wrfs.File
+	var err error
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) == 0 {
+		file, err = r.snapshot(&call, func() (wrfs.File, error) { return wrfs.OpenFile(r.fsys, name, flag, perm) })
+	} else {
+		file, err = wrfs.OpenFile(r.fsys, name, flag, perm)
+	}
+	r.record(call, err)
+	return file, err
+}
+
+func (r *Recorder) Stat(name string) (wrfs.FileInfo, error) {
+	fi, err := wrfs.Stat(r.fsys, name)
+	r.recordInfo("stat", name, fi, err)
+	return fi, err
+}
+
+func (r *Recorder) Lstat(name string) (wrfs.FileInfo, error) {
+	fi, err := wrfs.Lstat(r.fsys, name)
+	r.recordInfo("lstat", name, fi, err)
+	return fi, err
+}
+
+func (r *Recorder) recordInfo(op, name string, fi wrfs.FileInfo, err error) {
+	call := Call{Op: op, Path: name}
+	if err == nil {
+		rec := newFileRecord(fi)
+		call.Info = &rec
+	}
+	r.record(call, err)
+}
+
+func (r *Recorder) ReadDir(name string) ([]wrfs.DirEntry, error) {
+	call := Call{Op: "readdir", Path: name}
+	entries, err := wrfs.ReadDir(r.fsys, name)
+	if err == nil {
+		call.Entries, err = entryRecords(entries)
+	}
+	r.record(call, err)
+	return entries, err
+}
+
+func (r *Recorder) ReadFile(name string) ([]byte, error) {
+	data, err := wrfs.ReadFile(r.fsys, name)
+	r.record(Call{Op: "readfile", Path: name, Data: data}, err)
+	return data, err
+}
+
+func (r *Recorder) Readlink(name string) (string, error) {
+	target, err := wrfs.Readlink(r.fsys, name)
+	r.record(Call{Op: "readlink", Path: name, Target: target}, err)
+	return target, err
+}
+
+func (r *Recorder) Mkdir(name string, perm wrfs.FileMode) error {
+	err := wrfs.Mkdir(r.fsys, name, perm)
+	r.record(Call{Op: "mkdir", Path: name, Args: []string{perm.String()}}, err)
+	return err
+}
+
+func (r *Recorder) MkdirAll(name string, perm wrfs.FileMode) error {
+	err := wrfs.MkdirAll(r.fsys, name, perm)
+	r.record(Call{Op: "mkdirall", Path: name, Args: []string{perm.String()}}, err)
+	return err
+}
+
+func (r *Recorder) Remove(name string) error {
+	err := wrfs.Remove(r.fsys, name)
+	r.record(Call{Op: "remove", Path: name}, err)
+	return err
+}
+
+func (r *Recorder) RemoveAll(name string) error {
+	err := wrfs.RemoveAll(r.fsys, name)
+	r.record(Call{Op: "removeall", Path: name}, err)
+	return err
+}
+
+func (r *Recorder) Rename(oldpath, newpath string) error {
+	err := wrfs.Rename(r.fsys, oldpath, newpath)
+	r.record(Call{Op: "rename", Path: oldpath, Args: []string{newpath}}, err)
+	return err
+}
+
+func (r *Recorder) Symlink(oldname, newname string) error {
+	err := wrfs.Symlink(r.fsys, oldname, newname)
+	r.record(Call{Op: "symlink", Path: newname, Args: []string{oldname}}, err)
+	return err
+}
+
+func (r *Recorder) Link(oldname, newname string) error {
+	err := wrfs.Link(r.fsys, oldname, newname)
+	r.record(Call{Op: "link", Path: newname, Args: []string{oldname}}, err)
+	return err
+}
+
+func (r *Recorder) Chmod(name string, mode wrfs.FileMode) error {
+	err := wrfs.Chmod(r.fsys, name, mode)
+	r.record(Call{Op: "chmod", Path: name, Args: []string{mode.String()}}, err)
+	return err
+}
+
+func (r *Recorder) Chtimes(name string, atime, mtime time.Time) error {
+	err := wrfs.Chtimes(r.fsys, name, atime, mtime)
+	r.record(Call{Op: "chtimes", Path: name, Args: timeArgs(atime, mtime)}, err)
+	return err
+}
+
+func (r *Recorder) Truncate(name string, size int64) error {
+	err := wrfs.Truncate(r.fsys, name, size)
+	r.record(Call{Op: "truncate", Path: name, Args: []string{strconv.FormatInt(size, 10)}}, err)
+	return err
+}
+
+func timeArgs(atime, mtime time.Time) []string {
+	return []string{atime.UTC().Format(time.RFC3339Nano), mtime.UTC().Format(time.RFC3339Nano)}
+}
+
+// A Replayer is a file system that serves calls from a log recorded by a Recorder.
+// The calls must be made in the same order, with the same arguments, as when they were recorded;
+// a call that does not match the next recorded call fails with an error matching ErrReplayMismatch.
+// Files opened for writing accept writes, but discard them.
+type Replayer struct {
+	mu    sync.Mutex
+	calls []Call
+	next  int
+}
+
+// ErrReplayMismatch is returned by a Replayer for calls that do not match the recorded log.
+var ErrReplayMismatch = errors.New("call does not match recorded log")
+
+// NewReplayer returns a Replayer that serves the given calls.
+func NewReplayer(calls []Call) *Replayer {
+	return &Replayer{calls: calls}
+}
+
+// Done returns an error if some of the recorded calls have not been replayed.
+func (r *Replayer) Done() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.next < len(r.calls) {
+		c := r.calls[r.next]
+		return fmt.Errorf("wrfstest: %d recorded calls not replayed, starting with %s %s", len(r.calls)-r.next, c.Op, c.Path)
+	}
+	return nil
+}
+
+// replay returns the next recorded call, which must match the given call.
+func (r *Replayer) replay(op, name string, args ...string) (*Call, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.next >= len(r.calls) {
+		return nil, &wrfs.PathError{Op: op, Path: name, Err: fmt.Errorf("%w: no more calls", ErrReplayMismatch)}
+	}
+	c := &r.calls[r.next]
+	if c.Op != op || c.Path != name || !equalArgs(c.Args, args) {
+		return nil, &wrfs.PathError{Op: op, Path: name,
+			Err: fmt.Errorf("%w: want %s %s %v", ErrReplayMismatch, c.Op, c.Path, c.Args)}
+	}
+	r.next++
+	return c, nil
+}
+
+func equalArgs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// replayErr replays a call that only returns an error.
+func (r *Replayer) replayErr(op, name string, args ...string) error {
+	c, err := r.replay(op, name, args...)
+	if err != nil {
+		return err
+	}
+	return c.err()
+}
+
+func (r *Replayer) Open(name string) (wrfs.File, error) {
+	c, err := r.replay("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.err(); err != nil {
+		return nil, err
+	}
+	return c.open(name), nil
+}
+
+func (r *Replayer) OpenFile(name string, flag int, perm wrfs.FileMode) (wrfs.File, error) {
+	c, err := r.replay("openfile", name, strconv.Itoa(flag), perm.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := c.err(); err != nil {
+		return nil, err
+	}
+	if c.Info != nil {
+		return c.open(name), nil
+	}
+	return &openMapFile{name: name, file: &MapFile{Mode: perm}, flag: flag}, nil
+}
+
+func (r *Replayer) Stat(name string) (wrfs.FileInfo, error) {
+	return r.replayInfo("stat", name)
+}
+
+func (r *Replayer) Lstat(name string) (wrfs.FileInfo, error) {
+	return r.replayInfo("lstat", name)
+}
+
+func (r *Replayer) replayInfo(op, name string) (wrfs.FileInfo, error) {
+	c, err := r.replay(op, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.err(); err != nil {
+		return nil, err
+	}
+	return c.Info.fileInfo(nil), nil
+}
+
+func (r *Replayer) ReadDir(name string) ([]wrfs.DirEntry, error) {
+	c, err := r.replay("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]wrfs.DirEntry, len(c.Entries))
+	for i, e := range c.Entries {
+		entries[i] = e.fileInfo(nil)
+	}
+	return entries, c.err()
+}
+
+func (r *Replayer) ReadFile(name string) ([]byte, error) {
+	c, err := r.replay("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	return c.Data, c.err()
+}
+
+func (r *Replayer) Readlink(name string) (string, error) {
+	c, err := r.replay("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	return c.Target, c.err()
+}
+
+func (r *Replayer) Mkdir(name string, perm wrfs.FileMode) error {
+	return r.replayErr("mkdir", name, perm.String())
+}
+
+func (r *Replayer) MkdirAll(name string, perm wrfs.FileMode) error {
+	return r.replayErr("mkdirall", name, perm.String())
+}
+
+func (r *Replayer) Remove(name string) error {
+	return r.replayErr("remove", name)
+}
+
+func (r *Replayer) RemoveAll(name string) error {
+	return r.replayErr("removeall", name)
+}
+
+func (r *Replayer) Rename(oldpath, newpath string) error {
+	return r.replayErr("rename", oldpath, newpath)
+}
+
+func (r *Replayer) Symlink(oldname, newname string) error {
+	return r.replayErr("symlink", newname, oldname)
+}
+
+func (r *Replayer) Link(oldname, newname string) error {
+	return r.replayErr("link", newname, oldname)
+}
+
+func (r *Replayer) Chmod(name string, mode wrfs.FileMode) error {
+	return r.replayErr("chmod", name, mode.String())
+}
+
+func (r *Replayer) Chtimes(name string, atime, mtime time.Time) error {
+	return r.replayErr("chtimes", name, timeArgs(atime, mtime)...)
+}
+
+func (r *Replayer) Truncate(name string, size int64) error {
+	return r.replayErr("truncate", name, strconv.FormatInt(size, 10))
+}
@@ -0,0 +1,424 @@
+// Package wrfstest implements support for testing implementations and users of the wrfs extension interfaces.
+package wrfstest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/relab/wrfs"
+)
+
+// An Option configures TestWriteFS.
+type Option func(*config)
+
+type config struct {
+	dir        string
+	skipChown  bool
+	skipLinks  bool
+	skipChmod  bool
+	skipChtime bool
+}
+
+// Dir sets the directory in which TestWriteFS creates its scratch directory. The default is ".".
+func Dir(dir string) Option {
+	return func(c *config) { c.dir = dir }
+}
+
+// SkipChown disables the Chown and Lchown tests.
+func SkipChown() Option {
+	return func(c *config) { c.skipChown = true }
+}
+
+// SkipChmod disables the Chmod tests.
+func SkipChmod() Option {
+	return func(c *config) { c.skipChmod = true }
+}
+
+// SkipChtimes disables the Chtimes tests.
+func SkipChtimes() Option {
+	return func(c *config) { c.skipChtime = true }
+}
+
+// SkipLinks disables the Symlink, Readlink, Lstat and Link tests.
+func SkipLinks() Option {
+	return func(c *config) { c.skipLinks = true }
+}
+
+// TestWriteFS tests the write operations of a file system implementation.
+// It creates a scratch directory in fsys, exercises OpenFile with various flag combinations,
+// Mkdir, MkdirAll, Remove, RemoveAll, Rename, Chmod, Chown, Chtimes, Truncate and symbolic links,
+// checks the results through the read interfaces, and finally removes the scratch directory.
+//
+// Operations that fsys does not support, that is, which fail with an error matching wrfs.ErrUnsupported,
+// are skipped, along with the checks that depend on them. Every other deviation from the behavior of
+// the os package is reported.
+//
+// Typical usage inside a test is:
+//
+//	if err := wrfstest.TestWriteFS(myFS); err != nil {
+//		t.Fatal(err)
+//	}
+func TestWriteFS(fsys wrfs.FS, opts ...Option) error {
+	c := config{dir: "."}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	t := &fsTester{fsys: fsys, dir: path.Join(c.dir, "wrfstest.tmp")}
+	if err := wrfs.Mkdir(fsys, t.dir, 0777); err != nil {
+		return fmt.Errorf("creating scratch directory: %w", err)
+	}
+
+	t.testOpenFile()
+	t.testMkdir()
+	t.testRemove()
+	t.testRename()
+	t.testTruncate()
+	if !c.skipChmod {
+		t.testChmod()
+	}
+	if !c.skipChown {
+		t.testChown()
+	}
+	if !c.skipChtime {
+		t.testChtimes()
+	}
+	if !c.skipLinks {
+		t.testSymlink()
+		t.testLink()
+	}
+
+	if err := wrfs.RemoveAll(fsys, t.dir); err != nil {
+		t.errorf("removing scratch directory: %v", err)
+	}
+	if len(t.errors) == 0 {
+		return nil
+	}
+	return errors.New("TestWriteFS found errors:\n" + strings.Join(t.errors, "\n"))
+}
+
+type fsTester struct {
+	fsys   wrfs.FS
+	dir    string
+	errors []string
+}
+
+func (t *fsTester) errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+// path returns the path of name in the scratch directory.
+func (t *fsTester) path(name string) string {
+	return path.Join(t.dir, name)
+}
+
+// ok reports whether err is nil. Unsupported operations are not reported as errors.
+func (t *fsTester) ok(op string, err error) bool {
+	if err == nil {
+		return true
+	}
+	if !errors.Is(err, wrfs.ErrUnsupported) {
+		t.errorf("%s: %v", op, err)
+	}
+	return false
+}
+
+// expect checks that err matches target.
+func (t *fsTester) expect(op string, err, target error) {
+	if !errors.Is(err, target) {
+		t.errorf("%s: got error %v, want %v", op, err, target)
+	}
+}
+
+// expectFailure checks that err is not nil. An error matching ErrUnsupported passes, as unsupported operations
+// are skipped.
+func (t *fsTester) expectFailure(op string, err error) {
+	if err == nil {
+		t.errorf("%s: succeeded, want an error", op)
+	}
+}
+
+func (t *fsTester) writeFile(name string, data string) bool {
+	return t.ok("WriteFile("+name+")", wrfs.WriteFile(t.fsys, t.path(name), []byte(data), 0666))
+}
+
+func (t *fsTester) checkContents(op, name, want string) {
+	data, err := wrfs.ReadFile(t.fsys, t.path(name))
+	if err != nil {
+		t.errorf("%s: ReadFile(%s): %v", op, name, err)
+		return
+	}
+	if string(data) != want {
+		t.errorf("%s: %s contains %q, want %q", op, name, data, want)
+	}
+}
+
+func (t *fsTester) checkNotExist(op, name string) {
+	_, err := wrfs.Lstat(t.fsys, t.path(name))
+	if errors.Is(err, wrfs.ErrUnsupported) {
+		_, err = wrfs.Stat(t.fsys, t.path(name))
+	}
+	t.expect(op+": Stat("+name+")", err, wrfs.ErrNotExist)
+}
+
+func (t *fsTester) checkDir(op, name string) {
+	fi, err := wrfs.Stat(t.fsys, t.path(name))
+	if err != nil {
+		t.errorf("%s: Stat(%s): %v", op, name, err)
+		return
+	}
+	if !fi.IsDir() {
+		t.errorf("%s: %s is not a directory", op, name)
+	}
+}
+
+func (t *fsTester) openFile(name string, flag int) (wrfs.File, error) {
+	return wrfs.OpenFile(t.fsys, t.path(name), flag, 0666)
+}
+
+func (t *fsTester) testOpenFile() {
+	_, err := t.openFile("missing", os.O_RDONLY)
+	t.expect("OpenFile(missing, O_RDONLY)", err, wrfs.ErrNotExist)
+
+	f, err := t.openFile("file", os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if !t.ok("OpenFile(file, O_WRONLY|O_CREATE|O_EXCL)", err) {
+		return
+	}
+	_, err = wrfs.Write(f, []byte("hello"))
+	t.ok("Write(file)", err)
+	t.ok("Close(file)", f.Close())
+	t.checkContents("OpenFile(O_CREATE)", "file", "hello")
+
+	_, err = t.openFile("file", os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	t.expect("OpenFile(file, O_CREATE|O_EXCL) on existing file", err, wrfs.ErrExist)
+
+	if f, err = t.openFile("file", os.O_WRONLY|os.O_APPEND); t.ok("OpenFile(file, O_WRONLY|O_APPEND)", err) {
+		_, err = wrfs.Write(f, []byte(", world"))
+		t.ok("Write(file) with O_APPEND", err)
+		t.ok("Close(file)", f.Close())
+		t.checkContents("OpenFile(O_APPEND)", "file", "hello, world")
+	}
+
+	if f, err = t.openFile("file", os.O_WRONLY); t.ok("OpenFile(file, O_WRONLY)", err) {
+		_, err = wrfs.Write(f, []byte("J"))
+		t.ok("Write(file)", err)
+		t.ok("Close(file)", f.Close())
+		t.checkContents("OpenFile(O_WRONLY)", "file", "Jello, world")
+	}
+
+	// The contents depend on which of the above writes are supported.
+	before, _ := wrfs.ReadFile(t.fsys, t.path("file"))
+	if f, err = t.openFile("file", os.O_RDONLY); t.ok("OpenFile(file, O_RDONLY)", err) {
+		if _, err := wrfs.Write(f, []byte("x")); err == nil {
+			t.errorf("Write to file opened with O_RDONLY succeeded")
+		}
+		t.ok("Close(file)", f.Close())
+		t.checkContents("Write to read-only file", "file", string(before))
+	}
+
+	if f, err = t.openFile("file", os.O_RDWR|os.O_TRUNC); t.ok("OpenFile(file, O_RDWR|O_TRUNC)", err) {
+		_, err = wrfs.Write(f, []byte("new"))
+		t.ok("Write(file)", err)
+		if _, err := wrfs.Seek(f, 0, io.SeekStart); t.ok("Seek(file)", err) {
+			data, err := io.ReadAll(f)
+			if t.ok("Read(file) with O_RDWR", err) && string(data) != "new" {
+				t.errorf("Read(file) with O_RDWR: got %q, want %q", data, "new")
+			}
+		}
+		t.ok("Close(file)", f.Close())
+		t.checkContents("OpenFile(O_TRUNC)", "file", "new")
+	}
+
+	_, err = t.openFile("missing/file", os.O_WRONLY|os.O_CREATE)
+	t.expect("OpenFile(missing/file, O_CREATE)", err, wrfs.ErrNotExist)
+	t.ok("Remove(file)", wrfs.Remove(t.fsys, t.path("file")))
+}
+
+func (t *fsTester) testMkdir() {
+	if !t.ok("Mkdir(dir)", wrfs.Mkdir(t.fsys, t.path("dir"), 0777)) {
+		return
+	}
+	t.checkDir("Mkdir", "dir")
+	t.expect("Mkdir(dir) on existing directory", wrfs.Mkdir(t.fsys, t.path("dir"), 0777), wrfs.ErrExist)
+	t.expect("Mkdir(missing/dir)", wrfs.Mkdir(t.fsys, t.path("missing/dir"), 0777), wrfs.ErrNotExist)
+
+	if t.ok("MkdirAll(dir/a/b/c)", wrfs.MkdirAll(t.fsys, t.path("dir/a/b/c"), 0777)) {
+		t.checkDir("MkdirAll", "dir/a/b/c")
+	}
+	t.ok("MkdirAll(dir/a) on existing directory", wrfs.MkdirAll(t.fsys, t.path("dir/a"), 0777))
+	if t.writeFile("dir/file", "") {
+		t.expectFailure("MkdirAll(dir/file/x) below a file", wrfs.MkdirAll(t.fsys, t.path("dir/file/x"), 0777))
+	}
+
+	entries, err := wrfs.ReadDir(t.fsys, t.path("dir"))
+	if t.ok("ReadDir(dir)", err) {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		if got := strings.Join(names, ","); got != "a,file" {
+			t.errorf("ReadDir(dir): got entries %s, want a,file", got)
+		}
+	}
+	t.ok("RemoveAll(dir)", wrfs.RemoveAll(t.fsys, t.path("dir")))
+}
+
+func (t *fsTester) testRemove() {
+	if !t.ok("MkdirAll(rm/dir)", wrfs.MkdirAll(t.fsys, t.path("rm/dir"), 0777)) || !t.writeFile("rm/file", "x") {
+		return
+	}
+	t.expectFailure("Remove(rm) on non-empty directory", wrfs.Remove(t.fsys, t.path("rm")))
+	if t.ok("Remove(rm/file)", wrfs.Remove(t.fsys, t.path("rm/file"))) {
+		t.checkNotExist("Remove", "rm/file")
+	}
+	if t.ok("Remove(rm/dir)", wrfs.Remove(t.fsys, t.path("rm/dir"))) {
+		t.checkNotExist("Remove", "rm/dir")
+	}
+	t.expect("Remove(rm/missing)", wrfs.Remove(t.fsys, t.path("rm/missing")), wrfs.ErrNotExist)
+
+	if !t.ok("MkdirAll(rm/a/b)", wrfs.MkdirAll(t.fsys, t.path("rm/a/b"), 0777)) || !t.writeFile("rm/a/b/file", "x") {
+		return
+	}
+	if t.ok("RemoveAll(rm)", wrfs.RemoveAll(t.fsys, t.path("rm"))) {
+		t.checkNotExist("RemoveAll", "rm")
+	}
+	t.ok("RemoveAll(missing)", wrfs.RemoveAll(t.fsys, t.path("missing")))
+}
+
+func (t *fsTester) testRename() {
+	if !t.writeFile("old", "data") {
+		return
+	}
+	if !t.ok("Rename(old, new)", wrfs.Rename(t.fsys, t.path("old"), t.path("new"))) {
+		return
+	}
+	t.checkNotExist("Rename", "old")
+	t.checkContents("Rename", "new", "data")
+
+	if t.writeFile("other", "other") && t.ok("Rename(other, new) over existing file", wrfs.Rename(t.fsys, t.path("other"), t.path("new"))) {
+		t.checkContents("Rename over existing file", "new", "other")
+	}
+
+	if t.ok("MkdirAll(mvdir/sub)", wrfs.MkdirAll(t.fsys, t.path("mvdir/sub"), 0777)) && t.writeFile("mvdir/sub/file", "nested") {
+		if t.ok("Rename(mvdir, moved)", wrfs.Rename(t.fsys, t.path("mvdir"), t.path("moved"))) {
+			t.checkNotExist("Rename directory", "mvdir")
+			t.checkContents("Rename directory", "moved/sub/file", "nested")
+		}
+	}
+	t.expect("Rename(missing, x)", unwrapLinkError(wrfs.Rename(t.fsys, t.path("missing"), t.path("x"))), wrfs.ErrNotExist)
+	wrfs.RemoveAll(t.fsys, t.path("moved"))
+	wrfs.Remove(t.fsys, t.path("new"))
+}
+
+// unwrapLinkError returns the underlying error of *wrfs.LinkErrors.
+func unwrapLinkError(err error) error {
+	var linkErr *wrfs.LinkError
+	if errors.As(err, &linkErr) {
+		return linkErr.Err
+	}
+	return err
+}
+
+func (t *fsTester) testTruncate() {
+	if !t.writeFile("trunc", "0123456789") {
+		return
+	}
+	if t.ok("Truncate(trunc, 4)", wrfs.Truncate(t.fsys, t.path("trunc"), 4)) {
+		t.checkContents("Truncate shrink", "trunc", "0123")
+	}
+	if t.ok("Truncate(trunc, 6)", wrfs.Truncate(t.fsys, t.path("trunc"), 6)) {
+		t.checkContents("Truncate grow", "trunc", "0123\x00\x00")
+	}
+	wrfs.Remove(t.fsys, t.path("trunc"))
+}
+
+func (t *fsTester) testChmod() {
+	if !t.writeFile("chmod", "") {
+		return
+	}
+	for _, mode := range []wrfs.FileMode{0600, 0751} {
+		if !t.ok(fmt.Sprintf("Chmod(chmod, %v)", mode), wrfs.Chmod(t.fsys, t.path("chmod"), mode)) {
+			break
+		}
+		fi, err := wrfs.Stat(t.fsys, t.path("chmod"))
+		if t.ok("Stat(chmod)", err) && fi.Mode().Perm() != mode {
+			t.errorf("Chmod(chmod, %v): mode is %v", mode, fi.Mode().Perm())
+		}
+	}
+	wrfs.Remove(t.fsys, t.path("chmod"))
+}
+
+func (t *fsTester) testChown() {
+	if !t.writeFile("chown", "") {
+		return
+	}
+	t.ok("Chown(chown, -1, -1)", wrfs.Chown(t.fsys, t.path("chown"), -1, -1))
+	wrfs.Remove(t.fsys, t.path("chown"))
+}
+
+func (t *fsTester) testChtimes() {
+	if !t.writeFile("chtimes", "") {
+		return
+	}
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	if t.ok("Chtimes(chtimes)", wrfs.Chtimes(t.fsys, t.path("chtimes"), mtime, mtime)) {
+		fi, err := wrfs.Stat(t.fsys, t.path("chtimes"))
+		if t.ok("Stat(chtimes)", err) && !fi.ModTime().Equal(mtime) {
+			t.errorf("Chtimes(chtimes): ModTime is %v, want %v", fi.ModTime(), mtime)
+		}
+	}
+	wrfs.Remove(t.fsys, t.path("chtimes"))
+}
+
+func (t *fsTester) testSymlink() {
+	if !t.writeFile("target", "target") {
+		return
+	}
+	if !t.ok("Symlink(target, symlink)", wrfs.Symlink(t.fsys, "target", t.path("symlink"))) {
+		return
+	}
+	if link, err := wrfs.Readlink(t.fsys, t.path("symlink")); t.ok("Readlink(symlink)", err) && link != "target" {
+		t.errorf("Readlink(symlink): got %q, want %q", link, "target")
+	}
+	if fi, err := wrfs.Lstat(t.fsys, t.path("symlink")); t.ok("Lstat(symlink)", err) && fi.Mode()&wrfs.ModeSymlink == 0 {
+		t.errorf("Lstat(symlink): mode %v is not a symlink", fi.Mode())
+	}
+	if fi, err := wrfs.Stat(t.fsys, t.path("symlink")); t.ok("Stat(symlink)", err) && !fi.Mode().IsRegular() {
+		t.errorf("Stat(symlink): mode %v is not a regular file", fi.Mode())
+	}
+	t.checkContents("Symlink", "symlink", "target")
+	t.expect("Symlink(target, symlink) on existing file", unwrapLinkError(wrfs.Symlink(t.fsys, "target", t.path("symlink"))), wrfs.ErrExist)
+	if t.ok("Remove(symlink)", wrfs.Remove(t.fsys, t.path("symlink"))) {
+		t.checkContents("Remove(symlink)", "target", "target")
+	}
+	wrfs.Remove(t.fsys, t.path("target"))
+}
+
+func (t *fsTester) testLink() {
+	if !t.writeFile("original", "original") {
+		return
+	}
+	if !t.ok("Link(original, hardlink)", wrfs.Link(t.fsys, t.path("original"), t.path("hardlink"))) {
+		return
+	}
+	t.checkContents("Link", "hardlink", "original")
+	if f, err := t.openFile("hardlink", os.O_WRONLY|os.O_APPEND); t.ok("OpenFile(hardlink)", err) {
+		wrfs.Write(f, []byte("!"))
+		f.Close()
+		t.checkContents("Write through hard link", "original", "original!")
+	}
+	fi1, err1 := wrfs.Stat(t.fsys, t.path("original"))
+	fi2, err2 := wrfs.Stat(t.fsys, t.path("hardlink"))
+	if t.ok("Stat(original)", err1) && t.ok("Stat(hardlink)", err2) {
+		if _, ok := t.fsys.(wrfs.SameFileFS); ok && !wrfs.SameFile(t.fsys, fi1, fi2) {
+			t.errorf("SameFile(original, hardlink) returned false")
+		}
+	}
+	wrfs.Remove(t.fsys, t.path("original"))
+	wrfs.Remove(t.fsys, t.path("hardlink"))
+}
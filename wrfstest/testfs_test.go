@@ -0,0 +1,78 @@
+package wrfstest_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+	"github.com/relab/wrfs/wrfstest"
+)
+
+func TestWriteFS(t *testing.T) {
+	t.Run("memfs", func(t *testing.T) {
+		if err := wrfstest.TestWriteFS(memfs.New()); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("MapFS", func(t *testing.T) {
+		if err := wrfstest.TestWriteFS(wrfstest.MapFS{}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("DirFS", func(t *testing.T) {
+		if err := wrfstest.TestWriteFS(wrfs.DirFS(t.TempDir())); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestDifferential(t *testing.T) {
+	for seed := int64(0); seed < 20; seed++ {
+		if err := wrfstest.TestDifferential(memfs.New(), seed, 200); err != nil {
+			t.Fatal(err)
+		}
+		if err := wrfstest.TestDifferential(wrfstest.MapFS{}, seed, 200); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// errorRecorder is a testing.TB that records the errors reported to it.
+type errorRecorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *errorRecorder) Helper() {}
+
+func (r *errorRecorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestTrackFS(t *testing.T) {
+	fsys := wrfstest.NewTrackFS(memfs.New())
+	if err := wrfstest.TestWriteFS(fsys); err != nil {
+		t.Fatal(err)
+	}
+	check(t, wrfs.WriteFile(fsys, "file", []byte("data"), 0644))
+	check(t, wrfs.Chmod(fsys, "file", 0600))
+	check(t, wrfs.Chtimes(fsys, "file", time.Now(), time.Now()))
+	check(t, wrfs.Truncate(fsys, "file", 2))
+	check(t, wrfs.MkdirAll(fsys, "dir/sub", 0755))
+	check(t, wrfs.RemoveAll(fsys, "dir"))
+	fsys.CheckClosed(t)
+
+	leaked, err := fsys.Open("file")
+	check(t, err)
+	r := &errorRecorder{TB: t}
+	fsys.CheckClosed(r)
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "file was opened but not closed") ||
+		!strings.Contains(r.errors[0], "TestTrackFS") {
+		t.Errorf("CheckClosed reported %q, want one leak of file opened in TestTrackFS", r.errors)
+	}
+	check(t, leaked.Close())
+	fsys.CheckClosed(t)
+}
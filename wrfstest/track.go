@@ -0,0 +1,190 @@
+package wrfstest
+
+import (
+	"io"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/relab/wrfs"
+)
+
+// A TrackFS is a file system that keeps track of the files opened through it, so that tests can check that
+// every file is closed. It records the stack trace of each Open and OpenFile call, and CheckClosed reports
+// the files that are still open along with where they were opened.
+//
+// TrackFS forwards the operations that cannot be done on an open file, such as Mkdir, Remove and Rename,
+// to the file system it wraps. Operations that the wrfs helpers can fall back to doing on an open file,
+// such as Stat, ReadDir, Chmod and Truncate, are not forwarded, so that the files opened by the helpers are
+// tracked as well.
+type TrackFS struct {
+	fsys wrfs.FS
+
+	mu    sync.Mutex
+	next  int
+	files map[*trackedFile]int // open files and the order in which they were opened
+}
+
+// NewTrackFS returns a TrackFS that tracks the files opened in fsys.
+func NewTrackFS(fsys wrfs.FS) *TrackFS {
+	return &TrackFS{fsys: fsys, files: make(map[*trackedFile]int)}
+}
+
+// CheckClosed reports an error to t for each file that has been opened but not closed.
+// It is typically deferred or registered with t.Cleanup at the start of a test.
+func (fsys *TrackFS) CheckClosed(t testing.TB) {
+	t.Helper()
+	fsys.mu.Lock()
+	open := make([]*trackedFile, 0, len(fsys.files))
+	for f := range fsys.files {
+		open = append(open, f)
+	}
+	sort.Slice(open, func(i, j int) bool { return fsys.files[open[i]] < fsys.files[open[j]] })
+	fsys.mu.Unlock()
+
+	for _, f := range open {
+		t.Errorf("wrfstest: %s was opened but not closed; opened at:\n%s", f.name, f.stack)
+	}
+}
+
+func (fsys *TrackFS) track(name string, file wrfs.File, err error) (wrfs.File, error) {
+	if err != nil {
+		return nil, err
+	}
+	f := &trackedFile{file: file, name: name, stack: debug.Stack(), fsys: fsys}
+	fsys.mu.Lock()
+	fsys.files[f] = fsys.next
+	fsys.next++
+	fsys.mu.Unlock()
+	return f, nil
+}
+
+func (fsys *TrackFS) Open(name string) (wrfs.File, error) {
+	file, err := fsys.fsys.Open(name)
+	return fsys.track(name, file, err)
+}
+
+func (fsys *TrackFS) OpenFile(name string, flag int, perm wrfs.FileMode) (wrfs.File, error) {
+	file, err := wrfs.OpenFile(fsys.fsys, name, flag, perm)
+	return fsys.track(name, file, err)
+}
+
+func (fsys *TrackFS) Lstat(name string) (wrfs.FileInfo, error) {
+	return wrfs.Lstat(fsys.fsys, name)
+}
+
+func (fsys *TrackFS) Readlink(name string) (string, error) {
+	return wrfs.Readlink(fsys.fsys, name)
+}
+
+func (fsys *TrackFS) Mkdir(name string, perm wrfs.FileMode) error {
+	return wrfs.Mkdir(fsys.fsys, name, perm)
+}
+
+func (fsys *TrackFS) Remove(name string) error {
+	return wrfs.Remove(fsys.fsys, name)
+}
+
+func (fsys *TrackFS) Rename(oldpath, newpath string) error {
+	return wrfs.Rename(fsys.fsys, oldpath, newpath)
+}
+
+func (fsys *TrackFS) Symlink(oldname, newname string) error {
+	return wrfs.Symlink(fsys.fsys, oldname, newname)
+}
+
+func (fsys *TrackFS) Link(oldname, newname string) error {
+	return wrfs.Link(fsys.fsys, oldname, newname)
+}
+
+func (fsys *TrackFS) SameFile(fi1, fi2 wrfs.FileInfo) bool {
+	return wrfs.SameFile(fsys.fsys, fi1, fi2)
+}
+
+// trackedFile is a file opened through a TrackFS. It forwards the optional file interfaces of the wrfs
+// package to the underlying file, returning ErrUnsupported if the underlying file does not implement them.
+type trackedFile struct {
+	file  wrfs.File
+	name  string
+	stack []byte
+	fsys  *TrackFS
+}
+
+func (f *trackedFile) unsupported(op string) error {
+	return &wrfs.PathError{Op: op, Path: f.name, Err: wrfs.ErrUnsupported}
+}
+
+func (f *trackedFile) Close() error {
+	f.fsys.mu.Lock()
+	delete(f.fsys.files, f)
+	f.fsys.mu.Unlock()
+	return f.file.Close()
+}
+
+func (f *trackedFile) Stat() (wrfs.FileInfo, error) { return f.file.Stat() }
+
+func (f *trackedFile) Read(p []byte) (int, error) { return f.file.Read(p) }
+
+func (f *trackedFile) Write(p []byte) (int, error) { return wrfs.Write(f.file, p) }
+
+func (f *trackedFile) Seek(offset int64, whence int) (int64, error) {
+	return wrfs.Seek(f.file, offset, whence)
+}
+
+func (f *trackedFile) ReadDir(n int) ([]wrfs.DirEntry, error) {
+	if dir, ok := f.file.(wrfs.ReadDirFile); ok {
+		return dir.ReadDir(n)
+	}
+	return nil, f.unsupported("readdir")
+}
+
+func (f *trackedFile) ReadAt(p []byte, off int64) (int, error) {
+	if r, ok := f.file.(io.ReaderAt); ok {
+		return r.ReadAt(p, off)
+	}
+	return 0, f.unsupported("readat")
+}
+
+func (f *trackedFile) WriteAt(p []byte, off int64) (int, error) {
+	if w, ok := f.file.(io.WriterAt); ok {
+		return w.WriteAt(p, off)
+	}
+	return 0, f.unsupported("writeat")
+}
+
+func (f *trackedFile) Chmod(mode wrfs.FileMode) error {
+	if file, ok := f.file.(wrfs.ChmodFile); ok {
+		return file.Chmod(mode)
+	}
+	return f.unsupported("chmod")
+}
+
+func (f *trackedFile) Chown(uid, gid int) error {
+	if file, ok := f.file.(wrfs.ChownFile); ok {
+		return file.Chown(uid, gid)
+	}
+	return f.unsupported("chown")
+}
+
+func (f *trackedFile) Chtimes(atime, mtime time.Time) error {
+	if file, ok := f.file.(wrfs.ChtimesFile); ok {
+		return file.Chtimes(atime, mtime)
+	}
+	return f.unsupported("chtimes")
+}
+
+func (f *trackedFile) Truncate(size int64) error {
+	if file, ok := f.file.(wrfs.TruncateFile); ok {
+		return file.Truncate(size)
+	}
+	return f.unsupported("truncate")
+}
+
+func (f *trackedFile) Sync() error {
+	if file, ok := f.file.(wrfs.SyncFile); ok {
+		return file.Sync()
+	}
+	return f.unsupported("sync")
+}
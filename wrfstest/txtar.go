@@ -0,0 +1,103 @@
+package wrfstest
+
+import (
+	"bytes"
+	"path"
+	"strings"
+
+	"github.com/relab/wrfs"
+)
+
+// FromTxtar returns a MapFS containing the files of a txtar archive.
+// The comment section of the archive is ignored, and the files have mode 0644.
+//
+// The txtar format is described at https://pkg.go.dev/golang.org/x/tools/txtar: each file is introduced by a
+// marker line of the form "-- name --", and extends to the next marker line or the end of the archive.
+func FromTxtar(archive []byte) MapFS {
+	fsys := make(MapFS)
+	_, name, rest := findFileMarker(archive)
+	for name != "" {
+		data, next, after := findFileMarker(rest)
+		fsys[path.Clean(name)] = &MapFile{Data: data, Mode: 0644}
+		name, rest = next, after
+	}
+	return fsys
+}
+
+// ToTxtar serializes the regular files in the tree rooted at root in fsys as a txtar archive,
+// naming each file by its path relative to root. Since txtar only records files, empty directories are
+// omitted, and irregular files such as symbolic links cause ToTxtar to fail with an error matching ErrInvalid.
+// A newline is added to files that do not end in one.
+func ToTxtar(fsys wrfs.FS, root string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := wrfs.WalkDir(fsys, root, func(name string, d wrfs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return &wrfs.PathError{Op: "totxtar", Path: name, Err: wrfs.ErrInvalid}
+		}
+		data, err := wrfs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		rel := name
+		if root != "." {
+			rel = strings.TrimPrefix(name, root+"/")
+		}
+		buf.WriteString("-- " + rel + " --\n")
+		buf.Write(data)
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+		return nil
+	})
+	return buf.Bytes(), err
+}
+
+var (
+	newlineMarker = []byte("\n-- ")
+	marker        = []byte("-- ")
+	markerEnd     = []byte(" --")
+)
+
+// findFileMarker finds the next file marker in data, and returns the data before the marker,
+// the file name, and the data after the marker line. If there is no marker, it returns data, "" and nil.
+func findFileMarker(data []byte) (before []byte, name string, after []byte) {
+	var i int
+	for {
+		if name, after = isMarker(data[i:]); name != "" {
+			return data[:i], name, after
+		}
+		j := bytes.Index(data[i:], newlineMarker)
+		if j < 0 {
+			return fixNL(data), "", nil
+		}
+		i += j + 1 // positioned at start of new possible marker
+	}
+}
+
+// isMarker checks whether data begins with a file marker line, and if so returns the name and the data after it.
+func isMarker(data []byte) (name string, after []byte) {
+	if !bytes.HasPrefix(data, marker) {
+		return "", nil
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data, after = data[:i], data[i+1:]
+	}
+	if !(bytes.HasSuffix(data, markerEnd) && len(data) >= len(marker)+len(markerEnd)) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data[len(marker) : len(data)-len(markerEnd)])), after
+}
+
+// fixNL returns data with a final newline added, if data is not empty and does not end in one.
+func fixNL(data []byte) []byte {
+	if len(data) == 0 || data[len(data)-1] == '\n' {
+		return data
+	}
+	d := make([]byte, len(data)+1)
+	copy(d, data)
+	d[len(data)] = '\n'
+	return d
+}
@@ -0,0 +1,40 @@
+package wrfs
+
+import (
+	"io"
+	"os"
+)
+
+// WriteFileFS is a file system that supports the WriteFile function.
+type WriteFileFS interface {
+	FS
+
+	// WriteFile writes data to the named file, creating it if necessary.
+	// If the file does not exist, WriteFile creates it with permissions perm (before umask);
+	// otherwise WriteFile truncates it before writing, without changing permissions.
+	WriteFile(name string, data []byte, perm FileMode) error
+}
+
+// WriteFile writes data to the named file, creating it if necessary.
+// If the file does not exist, WriteFile creates it with permissions perm (before umask);
+// otherwise WriteFile truncates it before writing, without changing permissions.
+//
+// If fsys implements WriteFileFS, WriteFile calls fsys.WriteFile.
+// Otherwise WriteFile calls OpenFile and uses Write and Close on the returned file.
+func WriteFile(fsys FS, name string, data []byte, perm FileMode) (err error) {
+	if fsys, ok := fsys.(WriteFileFS); ok {
+		return fsys.WriteFile(name, data, perm)
+	}
+
+	file, err := OpenFile(fsys, name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer safeClose(file, &err)
+
+	n, err := Write(file, data)
+	if err == nil && n < len(data) {
+		err = io.ErrShortWrite
+	}
+	return err
+}
@@ -0,0 +1,26 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wrfs_test
+
+import (
+	"testing"
+
+	. "github.com/relab/wrfs"
+)
+
+func TestWriteFile(t *testing.T) {
+	fsys := getFS(t)
+	fileName := "TestWriteFile"
+	data := []byte("hello, world")
+
+	check(t, WriteFile(fsys, fileName, []byte("something longer than data"), 0644))
+	check(t, WriteFile(fsys, fileName, data, 0600))
+
+	got, err := ReadFile(fsys, fileName)
+	check(t, err)
+	if string(got) != string(data) {
+		t.Errorf("got: %q, want: %q", got, data)
+	}
+	checkMode(t, fsys, fileName, 0644)
+}
@@ -0,0 +1,80 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"io"
+	"path"
+
+	"github.com/relab/wrfs"
+)
+
+// Create writes a zip archive of the tree rooted at root in src to w, naming the files by their paths relative to
+// root. The archive holds the directories, regular files and symbolic links of the tree in lexical order, with
+// their types and permission bits recorded in the external attributes as on Unix, and their modification times.
+// Regular files are compressed with Deflate, and symbolic links hold their targets as contents. Other types of
+// files cause Create to fail with an error matching wrfs.ErrInvalid.
+//
+// Create does not close w.
+func Create(w io.Writer, src wrfs.FS, root string) error {
+	root = path.Clean(root)
+	zw := zip.NewWriter(w)
+	err := wrfs.WalkDir(src, root, func(name string, d wrfs.DirEntry, err error) error {
+		if err != nil || name == root {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		mode := fi.Mode()
+		if !mode.IsDir() && !mode.IsRegular() && mode&wrfs.ModeSymlink == 0 {
+			return &wrfs.PathError{Op: "create", Path: name, Err: wrfs.ErrInvalid}
+		}
+		hdr, err := zip.FileInfoHeader(fi)
+		if err != nil {
+			return err
+		}
+		hdr.Name = relName(root, name)
+		if mode.IsDir() {
+			hdr.Name += "/"
+		} else if mode.IsRegular() {
+			hdr.Method = zip.Deflate
+		}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil || mode.IsDir() {
+			return err
+		}
+		if mode&wrfs.ModeSymlink != 0 {
+			target, err := wrfs.Readlink(src, name)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(fw, target)
+			return err
+		}
+		return copyFile(fw, src, name)
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// relName returns name relative to root, where name is inside root.
+func relName(root, name string) string {
+	if root == "." {
+		return name
+	}
+	return name[len(root)+1:]
+}
+
+// copyFile writes the contents of the named file to w.
+func copyFile(w io.Writer, fsys wrfs.FS, name string) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
@@ -0,0 +1,143 @@
+// Package zipfs extracts zip archives into wrfs file systems, and creates them from wrfs file systems.
+package zipfs
+
+import (
+	"archive/zip"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/internal/extract"
+)
+
+// Extract extracts the files of the archive r into dst. Directories are created with MkdirAll, regular files with
+// OpenFile, replacing existing files, and symbolic links with Symlink. The types of the files are taken from their
+// external attributes, as are their permission bits for archives created on Unix or macOS; those of other archives
+// default to 0755 for directories and 0644 for files. The permission bits and modification times are then set with
+// Chmod and Chtimes, where dst supports them; those of directories once all files have been extracted. Parent
+// directories missing from the archive are created with permission bits 0755. Other types of files are skipped, and
+// backslashes in names are treated as separators, as written by some Windows archivers.
+//
+// Extract refuses to write outside of dst: names in the archive that are absolute or lead outside with "..", names
+// whose parent directories are symbolic links in dst, and directories whose names are symbolic links in dst cause it
+// to fail with an error matching wrfs.ErrPermission, as do symbolic links with targets that are absolute or outside
+// of dst.
+func Extract(dst wrfs.FS, r *zip.Reader) error {
+	var dirs []*zip.File
+	for _, f := range r.File {
+		name, err := safeName(dst, f.Name)
+		if err != nil {
+			return err
+		}
+		switch mode := f.Mode(); {
+		case mode.IsDir():
+			if name != "." {
+				if err = extract.NotSymlink(dst, name); err == nil {
+					err = wrfs.MkdirAll(dst, name, 0755)
+				}
+			}
+			dirs = append(dirs, f)
+		case mode&wrfs.ModeSymlink != 0:
+			if err = wrfs.MkdirAll(dst, path.Dir(name), 0755); err == nil {
+				err = extractSymlink(dst, name, f)
+			}
+		case mode.IsRegular():
+			if err = wrfs.MkdirAll(dst, path.Dir(name), 0755); err == nil {
+				err = extractFile(dst, name, f)
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if f.Mode().IsRegular() {
+			if err := setMetadata(dst, name, f); err != nil {
+				return err
+			}
+		}
+	}
+	// Extracting the files of a directory changes its modification time, so it is set last.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		name, err := safeName(dst, dirs[i].Name)
+		if err != nil {
+			return err
+		}
+		if err := setMetadata(dst, name, dirs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// safeName returns the cleaned name of a file in the archive, treating backslashes as separators, or an error if it
+// is outside of dst or inside a symbolic link.
+func safeName(dst wrfs.FS, name string) (string, error) {
+	return extract.SafeName(dst, strings.ReplaceAll(name, `\`, "/"))
+}
+
+// extractSymlink creates name as a symbolic link to the target stored as the contents of f.
+func extractSymlink(dst wrfs.FS, name string, f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	target, err := io.ReadAll(io.LimitReader(rc, 4096))
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	if !extract.Inside(name, string(target)) {
+		return &wrfs.LinkError{Op: "extract", Old: string(target), New: f.Name, Err: wrfs.ErrPermission}
+	}
+	if err := extract.Replace(dst, name); err != nil {
+		return err
+	}
+	return wrfs.Symlink(dst, string(target), name)
+}
+
+// extractFile writes the contents of f to name.
+func extractFile(dst wrfs.FS, name string, f *zip.File) (err error) {
+	if err := extract.Replace(dst, name); err != nil {
+		return err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	file, err := wrfs.OpenFile(dst, name, wrfs.O_WRONLY|wrfs.O_CREATE|wrfs.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	w, ok := file.(io.Writer)
+	if !ok {
+		return &wrfs.PathError{Op: "write", Path: name, Err: wrfs.ErrUnsupported}
+	}
+	_, err = io.Copy(w, rc)
+	return err
+}
+
+// setMetadata sets the permission bits and modification time of name from f.
+func setMetadata(dst wrfs.FS, name string, f *zip.File) error {
+	mode := f.Mode()
+	if creator := f.CreatorVersion >> 8; creator != creatorUnix && creator != creatorMacOS {
+		mode = mode&^wrfs.ModePerm | 0644
+		if mode.IsDir() {
+			mode |= 0111
+		}
+	}
+	return extract.SetMetadata(dst, name, mode, f.Modified)
+}
+
+// The "version made by" systems of archives whose external attributes hold Unix modes.
+const (
+	creatorUnix  = 3
+	creatorMacOS = 19
+)
@@ -0,0 +1,152 @@
+package zipfs_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/relab/wrfs"
+	"github.com/relab/wrfs/memfs"
+	"github.com/relab/wrfs/zipfs"
+)
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkContents(t *testing.T, fsys wrfs.FS, name, want string) {
+	t.Helper()
+	data, err := wrfs.ReadFile(fsys, name)
+	check(t, err)
+	if string(data) != want {
+		t.Errorf("%s contains %q, want %q", name, data, want)
+	}
+}
+
+// entry is a file of an archive, whose mode is recorded as on Unix if not zero.
+type entry struct {
+	name string
+	mode wrfs.FileMode
+	data string
+}
+
+// archive returns a zip archive of the given entries, all modified at mtime.
+func archive(t *testing.T, mtime time.Time, entries ...entry) *zip.Reader {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Modified: mtime}
+		if e.mode != 0 {
+			hdr.SetMode(e.mode)
+		}
+		fw, err := w.CreateHeader(hdr)
+		check(t, err)
+		_, err = fw.Write([]byte(e.data))
+		check(t, err)
+	}
+	check(t, w.Close())
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	check(t, err)
+	return r
+}
+
+func TestExtract(t *testing.T) {
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := memfs.New()
+	check(t, wrfs.Mkdir(fsys, "dir", 0755))
+	check(t, wrfs.WriteFile(fsys, "dir/link", []byte("replaced"), 0644))
+	check(t, zipfs.Extract(fsys, archive(t, mtime,
+		entry{name: "dir/", mode: wrfs.ModeDir | 0750},
+		entry{name: "./dir/file", mode: 0600, data: "contents"},
+		entry{name: "dir/link", mode: wrfs.ModeSymlink | 0777, data: "file"},
+		entry{name: `dos\file`, data: "dos"},
+		entry{name: "fifo", mode: wrfs.ModeNamedPipe | 0644},
+	)))
+	checkContents(t, fsys, "dir/link", "contents")
+	checkContents(t, fsys, "dos/file", "dos")
+	for name, mode := range map[string]wrfs.FileMode{"dir": wrfs.ModeDir | 0750, "dir/file": 0600, "dos/file": 0644} {
+		fi, err := wrfs.Stat(fsys, name)
+		check(t, err)
+		if fi.Mode() != mode || !fi.ModTime().Equal(mtime) {
+			t.Errorf("%s has mode %v and time %v, want %v and %v", name, fi.Mode(), fi.ModTime(), mode, mtime)
+		}
+	}
+	if _, err := wrfs.Lstat(fsys, "fifo"); !errors.Is(err, wrfs.ErrNotExist) {
+		t.Errorf("Extract created named pipe: %v", err)
+	}
+
+	for _, e := range []entry{
+		{name: "../escape"},
+		{name: "/etc/escape"},
+		{name: `..\escape`},
+		{name: "up", mode: wrfs.ModeSymlink | 0777, data: "../.."},
+		{name: "abs", mode: wrfs.ModeSymlink | 0777, data: "/etc"},
+		{name: "dir/link/escape"},
+	} {
+		if err := zipfs.Extract(fsys, archive(t, mtime, e)); !errors.Is(err, wrfs.ErrPermission) {
+			t.Errorf("Extract of %s: got %v, want ErrPermission", e.name, err)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	src := memfs.New()
+	check(t, wrfs.MkdirAll(src, "root/dir/sub", 0750))
+	check(t, wrfs.WriteFile(src, "root/dir/file", []byte("contents"), 0600))
+	check(t, wrfs.WriteFile(src, "root/top", nil, 0644))
+	check(t, wrfs.Symlink(src, "dir/file", "root/link"))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, name := range []string{"root/dir", "root/dir/sub", "root/dir/file", "root/top"} {
+		check(t, wrfs.Chtimes(src, name, mtime, mtime))
+	}
+
+	var buf bytes.Buffer
+	check(t, zipfs.Create(&buf, src, "root/"))
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	check(t, err)
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	if got, want := strings.Join(names, " "), "dir/ dir/file dir/sub/ link top"; got != want {
+		t.Errorf("Create archived %q, want %q", got, want)
+	}
+
+	dst := memfs.New()
+	check(t, zipfs.Extract(dst, r))
+	want, err := wrfs.HashTree(src, "root", sha256.New)
+	check(t, err)
+	got, err := wrfs.HashTree(dst, ".", sha256.New)
+	check(t, err)
+	if !bytes.Equal(got, want) {
+		t.Error("extracted tree differs from archived one")
+	}
+	fi, err := wrfs.Stat(dst, "dir/file")
+	check(t, err)
+	if !fi.ModTime().Equal(mtime) {
+		t.Errorf("extracted dir/file has time %v, want %v", fi.ModTime(), mtime)
+	}
+}
+
+func TestExtractSymlinkDir(t *testing.T) {
+	fsys := wrfs.DirFS(t.TempDir())
+	check(t, wrfs.Mkdir(fsys, "outside", 0700))
+	check(t, wrfs.Mkdir(fsys, "dst", 0755))
+	dst, err := wrfs.Sub(fsys, "dst")
+	check(t, err)
+	check(t, wrfs.Symlink(dst, "../outside", "d"))
+	err = zipfs.Extract(dst, archive(t, time.Now(), entry{name: "d/", mode: wrfs.ModeDir | 0777}))
+	if !errors.Is(err, wrfs.ErrPermission) {
+		t.Errorf("Extract of a directory over a symbolic link: got %v, want ErrPermission", err)
+	}
+	if fi, err := wrfs.Stat(fsys, "outside"); err != nil || fi.Mode().Perm() != 0700 {
+		t.Errorf("the directory outside of dst has mode %v, %v, want 0700", fi.Mode(), err)
+	}
+}